@@ -0,0 +1,217 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/bench"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the throughput and latency of the authentication webhook",
+	Long: `Sends TokenReviews to the authentication webhook and reports its throughput
+and latency percentiles.
+
+By default the webhook is served in-process with the mappings of the server
+configuration (--config), and tokens are signed with fake credentials and
+verified against a stub STS that answers every GetCallerIdentity with --arn,
+or with the recorded response of --sts-response. Map that ARN to have the
+TokenReviews authenticate, and pass --log-level=warn to keep the log lines of
+every request out of the report.
+
+With --url, TokenReviews are sent to a running server instead. Its STS calls
+are real, so pass real tokens with --token.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterID := viper.GetString("clusterID")
+		if clusterID == "" {
+			fmt.Fprintf(os.Stderr, "error: cluster ID not specified\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		opts := bench.Options{
+			URL:         viper.GetString("bench.url"),
+			Tokens:      viper.GetStringSlice("bench.token"),
+			Requests:    viper.GetInt("bench.requests"),
+			Concurrency: viper.GetInt("bench.concurrency"),
+		}
+		client, err := benchClient(opts.Concurrency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not configure the client: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Client = client
+		if opts.URL != "" {
+			if len(opts.Tokens) == 0 {
+				fmt.Fprintf(os.Stderr, "error: --token must be specified with --url\n")
+				cmd.Usage()
+				os.Exit(1)
+			}
+		} else {
+			url, err := serveBenchWebhook(clusterID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not start the webhook: %v\n", err)
+				os.Exit(1)
+			}
+			opts.URL = url
+			if len(opts.Tokens) == 0 {
+				opts.Tokens, err = bench.SyntheticTokens(viper.GetInt("bench.tokens"), clusterID, viper.GetString("bench.region"))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "could not generate tokens: %v\n", err)
+					os.Exit(1)
+				}
+			}
+		}
+
+		result, err := bench.Run(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not run benchmark: %v\n", err)
+			os.Exit(1)
+		}
+		printBenchResult(opts, result)
+	},
+}
+
+// serveBenchWebhook serves the webhook of the server configuration on a
+// loopback port, verifying tokens against a stub STS, and returns its URL.
+func serveBenchWebhook(clusterID string) (string, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return "", err
+	}
+	cfg.ClusterID = clusterID
+	// circuit breakers would trip on the stub's fake credentials
+	cfg.CircuitBreakerFailureThreshold = 0
+	// the EC2 provider of the handler otherwise looks the region up in
+	// instance metadata
+	if os.Getenv("AWS_REGION") == "" && os.Getenv("AWS_DEFAULT_REGION") == "" {
+		os.Setenv("AWS_REGION", viper.GetString("bench.region"))
+	}
+
+	stub := &bench.StubSTS{Latency: viper.GetDuration("bench.stsLatency")}
+	if file := viper.GetString("bench.stsResponse"); file != "" {
+		if stub.Response, err = ioutil.ReadFile(file); err != nil {
+			return "", err
+		}
+	} else if stub.Response, err = bench.SyntheticResponse(viper.GetString("bench.arn")); err != nil {
+		return "", err
+	}
+
+	mappers, err := server.BuildMapperChain(cfg)
+	if err != nil {
+		return "", err
+	}
+	stopCh := make(chan struct{})
+	timer := time.AfterFunc(viper.GetDuration("bench.loadTimeout"), func() { close(stopCh) })
+	defer timer.Stop()
+	for _, m := range mappers {
+		if err := mapper.Load(m, stopCh); err != nil {
+			return "", fmt.Errorf("could not load mappings from %s: %v", m.Name(), err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go (&http.Server{Handler: server.NewHandler(cfg, mappers, stub)}).Serve(listener)
+	return fmt.Sprintf("http://%s/authenticate", listener.Addr()), nil
+}
+
+// benchClient returns a client keeping a connection per concurrent request
+// open and trusting the CA of --ca-file, if set.
+func benchClient(concurrency int) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: viper.GetBool("bench.insecureSkipTLSVerify"),
+	}
+	if caFile := viper.GetString("bench.caFile"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+	}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: concurrency,
+		},
+	}, nil
+}
+
+func printBenchResult(opts bench.Options, result *bench.Result) {
+	fmt.Printf("URL:           %s\n", opts.URL)
+	fmt.Printf("Requests:      %d\n", len(result.Latencies))
+	fmt.Printf("Concurrency:   %d\n", opts.Concurrency)
+	fmt.Printf("Tokens:        %d\n", len(opts.Tokens))
+	fmt.Printf("Elapsed:       %v\n", result.Elapsed)
+	fmt.Printf("Throughput:    %.1f req/s\n", result.Throughput())
+	fmt.Printf("Authenticated: %d\n", result.Authenticated)
+	fmt.Printf("Statuses:      %v\n", result.Statuses)
+	fmt.Printf("Latency:       p50 %v, p90 %v, p99 %v, max %v\n",
+		result.Percentile(50), result.Percentile(90), result.Percentile(99), result.Percentile(100))
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().Int("requests", 1000, "Number of TokenReviews to send")
+	viper.BindPFlag("bench.requests", benchCmd.Flags().Lookup("requests"))
+	benchCmd.Flags().Int("concurrency", 10, "Number of TokenReviews in flight at a time")
+	viper.BindPFlag("bench.concurrency", benchCmd.Flags().Lookup("concurrency"))
+	benchCmd.Flags().Int("tokens", 100, "Number of distinct synthetic tokens to send in turn")
+	viper.BindPFlag("bench.tokens", benchCmd.Flags().Lookup("tokens"))
+	benchCmd.Flags().String("region", "us-east-1", "AWS region whose STS endpoint synthetic tokens are signed for")
+	viper.BindPFlag("bench.region", benchCmd.Flags().Lookup("region"))
+	benchCmd.Flags().String("arn", "arn:aws:sts::123456789012:assumed-role/bench/session",
+		"ARN the stub STS returns for every synthetic token")
+	viper.BindPFlag("bench.arn", benchCmd.Flags().Lookup("arn"))
+	benchCmd.Flags().String("sts-response", "",
+		"`File` with a recorded JSON GetCallerIdentity response for the stub STS to replay instead of one for --arn")
+	viper.BindPFlag("bench.stsResponse", benchCmd.Flags().Lookup("sts-response"))
+	benchCmd.Flags().Duration("sts-latency", 0, "Latency the stub STS adds to every response")
+	viper.BindPFlag("bench.stsLatency", benchCmd.Flags().Lookup("sts-latency"))
+	benchCmd.Flags().Duration("load-timeout", 30*time.Second,
+		"How long to wait for mappings to load from the cluster.")
+	viper.BindPFlag("bench.loadTimeout", benchCmd.Flags().Lookup("load-timeout"))
+
+	benchCmd.Flags().String("url", "", "`URL` of the authentication webhook of a running server, such as https://127.0.0.1:21362/authenticate")
+	viper.BindPFlag("bench.url", benchCmd.Flags().Lookup("url"))
+	benchCmd.Flags().StringSlice("token", nil, "Tokens to send in turn instead of synthetic ones. Required with --url.")
+	viper.BindPFlag("bench.token", benchCmd.Flags().Lookup("token"))
+	benchCmd.Flags().String("ca-file", "", "PEM `file` of the CA to trust for the certificate of --url. Defaults to the system roots.")
+	viper.BindPFlag("bench.caFile", benchCmd.Flags().Lookup("ca-file"))
+	benchCmd.Flags().Bool("insecure-skip-tls-verify", false, "Don't verify the certificate of --url")
+	viper.BindPFlag("bench.insecureSkipTLSVerify", benchCmd.Flags().Lookup("insecure-skip-tls-verify"))
+}
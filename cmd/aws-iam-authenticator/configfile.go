@@ -0,0 +1,191 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// configAPIVersion is the version of the schema of the configuration file.
+// Files without an apiVersion are read as this version.
+const configAPIVersion = "iamauthenticator.k8s.aws/v1alpha1"
+
+// fileOnlyConfigKeys are the keys that have no flag and can only be set in
+// the configuration file or by environment variables. Keys under them are
+// known too.
+var fileOnlyConfigKeys = []string{
+	"apiVersion",
+	"clientRoles",
+	"defaultRole", // documented by earlier releases, but unused
+	"server.bootstrapMapRoles",
+	"server.mapRoles",
+	"server.mapUsers",
+	"server.mappingAssertions",
+}
+
+// knownConfigKeys are the lowercased keys bound to flags or environment
+// variables, recorded before the configuration file is read.
+var knownConfigKeys sets.String
+
+// recordKnownConfigKeys records the keys bound to flags and environment
+// variables. Call it before reading the configuration file.
+func recordKnownConfigKeys() {
+	knownConfigKeys = sets.NewString(viper.AllKeys()...)
+}
+
+func isKnownConfigKey(key string) bool {
+	if knownConfigKeys.Has(key) {
+		return true
+	}
+	for _, k := range fileOnlyConfigKeys {
+		k = strings.ToLower(k)
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfigFile checks the apiVersion of the configuration file path and
+// returns the keys it sets that the authenticator doesn't know, which are
+// usually typos and would be ignored.
+func checkConfigFile(path string) ([]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if apiVersion := v.GetString("apiVersion"); apiVersion != "" && apiVersion != configAPIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion %q, expected %q", apiVersion, configAPIVersion)
+	}
+	var unknown []string
+	for _, key := range v.AllKeys() {
+		if !isKnownConfigKey(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the configuration file",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file and the files and directories the server uses",
+	Long: `Check the configuration file given with --config and its overlays: their
+apiVersion, that they only set known keys, that the settings are valid, that
+the webhook kubeconfig and state directory can be written, and that the
+configured certificates and CA bundles can be loaded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if cfgFile == "" {
+			fmt.Fprintf(os.Stderr, "error: --config not specified\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		failed := false
+		check := func(what string, err error) {
+			if err != nil {
+				failed = true
+				fmt.Printf("FAIL %s: %v\n", what, err)
+			} else {
+				fmt.Printf("ok   %s\n", what)
+			}
+		}
+
+		for _, path := range append([]string{cfgFile}, cfgOverlays...) {
+			unknown, err := checkConfigFile(path)
+			if err == nil && len(unknown) > 0 {
+				err = fmt.Errorf("unknown keys %s", strings.Join(unknown, ", "))
+			}
+			check(path, err)
+		}
+		cfg, err := getConfig()
+		check("settings", err)
+		if err != nil {
+			os.Exit(1)
+		}
+		for _, err := range validateServerFiles(cfg) {
+			check(err.what, err.err)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// fileCheck is the result of checking a file or directory the server uses.
+type fileCheck struct {
+	what string
+	err  error
+}
+
+// validateServerFiles checks the files and directories the server reads
+// and writes on startup.
+func validateServerFiles(cfg config.Config) []fileCheck {
+	var checks []fileCheck
+	if cfg.KubeconfigPregenerated {
+		_, err := ioutil.ReadFile(cfg.GenerateKubeconfigPath)
+		checks = append(checks, fileCheck{"pregenerated kubeconfig " + cfg.GenerateKubeconfigPath, err})
+	} else if cfg.TLSSecret == "" {
+		checks = append(checks, fileCheck{"kubeconfig directory " + filepath.Dir(cfg.GenerateKubeconfigPath), checkWritableDir(filepath.Dir(cfg.GenerateKubeconfigPath))})
+	}
+	if cfg.TLSSecret == "" {
+		checks = append(checks, fileCheck{"state directory " + cfg.StateDir, checkWritableDir(cfg.StateDir)})
+		_, err := cfg.LoadExistingCertificate()
+		checks = append(checks, fileCheck{"existing certificate", err})
+	}
+	if cfg.ClientCAFile != "" {
+		_, err := cfg.LoadClientCAs()
+		checks = append(checks, fileCheck{"client CA file " + cfg.ClientCAFile, err})
+	}
+	if cfg.MetricsTLSCertFile != "" {
+		_, err := tls.LoadX509KeyPair(cfg.MetricsTLSCertFile, cfg.MetricsTLSKeyFile)
+		checks = append(checks, fileCheck{"metrics certificate " + cfg.MetricsTLSCertFile, err})
+	}
+	return checks
+}
+
+// checkWritableDir checks that a file can be created in dir.
+func checkWritableDir(dir string) error {
+	f, err := ioutil.TempFile(dir, ".validate")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
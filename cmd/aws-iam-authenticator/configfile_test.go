@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func writeTestConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	recordKnownConfigKeys()
+
+	path := writeTestConfig(t, dir, "config.yaml", `apiVersion: iamauthenticator.k8s.aws/v1alpha1
+clusterID: cluster
+server:
+  port: 21362
+  sateDir: /var/aws-iam-authenticator
+  mapRoles:
+  - roleARN: arn:aws:iam::123456789012:role/Admin
+    username: admin
+clientRoles:
+- roleARN: arn:aws:iam::123456789012:role/Dev
+unknownTopLevel: true
+`)
+	unknown, err := checkConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"server.satedir", "unknowntoplevel"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown keys = %v, want %v", unknown, want)
+	}
+
+	// files without an apiVersion are read as the current version
+	path = writeTestConfig(t, dir, "noversion.yaml", "clusterID: cluster\nserver:\n  stateDir: /tmp\n")
+	unknown, err = checkConfigFile(path)
+	if err != nil || len(unknown) != 0 {
+		t.Errorf("checkConfigFile without an apiVersion = %v, %v", unknown, err)
+	}
+
+	path = writeTestConfig(t, dir, "future.yaml", "apiVersion: iamauthenticator.k8s.aws/v2\nclusterID: cluster\n")
+	if _, err := checkConfigFile(path); err == nil || !strings.Contains(err.Error(), "unsupported apiVersion") {
+		t.Errorf("expected an unsupported apiVersion error, got %v", err)
+	}
+
+	if _, err := checkConfigFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestValidateServerFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	failed := func(checks []fileCheck) []string {
+		var what []string
+		for _, check := range checks {
+			if check.err != nil {
+				what = append(what, check.what)
+			}
+		}
+		return what
+	}
+
+	cfg := config.Config{
+		StateDir:               dir,
+		GenerateKubeconfigPath: filepath.Join(dir, "kubeconfig.yaml"),
+	}
+	if got := failed(validateServerFiles(cfg)); len(got) != 0 {
+		t.Errorf("expected all checks to pass, got failures of %v", got)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	cfg = config.Config{
+		StateDir:               missing,
+		GenerateKubeconfigPath: filepath.Join(dir, "kubeconfig.yaml"),
+		ClientCAFile:           writeTestConfig(t, dir, "ca.pem", "not a certificate"),
+		MetricsTLSCertFile:     filepath.Join(dir, "metrics.crt"),
+		MetricsTLSKeyFile:      filepath.Join(dir, "metrics.key"),
+	}
+	want := []string{
+		"state directory " + missing,
+		"client CA file " + cfg.ClientCAFile,
+		"metrics certificate " + cfg.MetricsTLSCertFile,
+	}
+	if got := failed(validateServerFiles(cfg)); !reflect.DeepEqual(got, want) {
+		t.Errorf("failed checks = %v, want %v", got, want)
+	}
+
+	cfg = config.Config{
+		StateDir:               dir,
+		GenerateKubeconfigPath: filepath.Join(dir, "pregenerated.yaml"),
+		KubeconfigPregenerated: true,
+	}
+	if got := failed(validateServerFiles(cfg)); !reflect.DeepEqual(got, []string{"pregenerated kubeconfig " + cfg.GenerateKubeconfigPath}) {
+		t.Errorf("expected the missing pregenerated kubeconfig to fail, got %v", got)
+	}
+}
+
+func TestReadConfigFilesOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := writeTestConfig(t, dir, "config.yaml", "clusterID: base\nserver:\n  port: 21362\n  stateDir: /var/base\n")
+	overlay := writeTestConfig(t, dir, "overlay.yaml", "server:\n  stateDir: /var/overlay\n")
+
+	defer func(file string, overlays []string) {
+		cfgFile, cfgOverlays = file, overlays
+		viper.SetConfigFile("")
+	}(cfgFile, cfgOverlays)
+	cfgFile, cfgOverlays = base, []string{overlay}
+	if err := readConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.ConfigFileUsed(); got != base {
+		t.Errorf("ConfigFileUsed = %s, want the base file %s", got, base)
+	}
+	if got := viper.GetString("server.stateDir"); got != "/var/overlay" {
+		t.Errorf("server.stateDir = %s, want the overlay's", got)
+	}
+	if got := viper.GetInt("server.port"); got != 21362 {
+		t.Errorf("server.port = %d, want the base's", got)
+	}
+
+	// reading again, as reloads do, starts from the base file
+	if err := ioutil.WriteFile(overlay, []byte("clusterID: overlay\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetString("server.stateDir"); got != "/var/base" {
+		t.Errorf("server.stateDir after a reload = %s, want the base's", got)
+	}
+	if got := viper.GetString("clusterID"); got != "overlay" {
+		t.Errorf("clusterID after a reload = %s, want the overlay's", got)
+	}
+}
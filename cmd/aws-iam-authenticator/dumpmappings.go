@@ -0,0 +1,145 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
+)
+
+var dumpMappingsCmd = &cobra.Command{
+	Use:   "dump-mappings",
+	Short: "Print the mappings a running server enforces",
+	Long: `Fetches the merged role, user and account mappings of all backends from the
+/mappings endpoint of a running server (enabled with --mappings-token-file)
+and prints them with the backend each comes from. Mappings that an earlier
+backend shadows are marked with shadowedBy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := viper.GetString("dumpMappings.output")
+		if output != "json" && output != "yaml" {
+			fmt.Fprintf(os.Stderr, "error: output must be json or yaml\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		tokenFile := viper.GetString("dumpMappings.tokenFile")
+		if tokenFile == "" {
+			fmt.Fprintf(os.Stderr, "error: --token-file not specified\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read token: %v\n", err)
+			os.Exit(1)
+		}
+
+		client, err := dumpMappingsClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not configure the client: %v\n", err)
+			os.Exit(1)
+		}
+		u, err := url.Parse(viper.GetString("dumpMappings.server"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid server URL: %v\n", err)
+			os.Exit(1)
+		}
+		u.Path = server.MappingsPath
+		u.RawQuery = url.Values{"format": []string{output}}.Encode()
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create request: %v\n", err)
+			os.Exit(1)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not get mappings: %v\n", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read mappings: %v\n", err)
+			os.Exit(1)
+		}
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "could not get mappings: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+			os.Exit(1)
+		}
+		os.Stdout.Write(body)
+	},
+}
+
+// dumpMappingsClient returns a client trusting the server CA of --ca-file, if
+// set, and presenting the client certificate of --client-certificate.
+func dumpMappingsClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: viper.GetBool("dumpMappings.insecureSkipTLSVerify"),
+	}
+	if caFile := viper.GetString("dumpMappings.caFile"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+	}
+	if certFile := viper.GetString("dumpMappings.clientCertificate"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, viper.GetString("dumpMappings.clientKey"))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(dumpMappingsCmd)
+	dumpMappingsCmd.Flags().String("server", "https://127.0.0.1:21362", "Base `URL` of the server")
+	viper.BindPFlag("dumpMappings.server", dumpMappingsCmd.Flags().Lookup("server"))
+	dumpMappingsCmd.Flags().String("token-file", "", "`File` with the bearer token of the server's --mappings-token-file")
+	viper.BindPFlag("dumpMappings.tokenFile", dumpMappingsCmd.Flags().Lookup("token-file"))
+	dumpMappingsCmd.Flags().StringP("output", "o", "yaml", "Output format: json or yaml")
+	viper.BindPFlag("dumpMappings.output", dumpMappingsCmd.Flags().Lookup("output"))
+	dumpMappingsCmd.Flags().String("ca-file", "", "PEM `file` of the CA to trust for the server certificate, such as cert.pem in the server's state directory. Defaults to the system roots.")
+	viper.BindPFlag("dumpMappings.caFile", dumpMappingsCmd.Flags().Lookup("ca-file"))
+	dumpMappingsCmd.Flags().Bool("insecure-skip-tls-verify", false, "Don't verify the server certificate")
+	viper.BindPFlag("dumpMappings.insecureSkipTLSVerify", dumpMappingsCmd.Flags().Lookup("insecure-skip-tls-verify"))
+	dumpMappingsCmd.Flags().String("client-certificate", "", "Client certificate `file` to present, if the server requires one (--client-ca-file)")
+	viper.BindPFlag("dumpMappings.clientCertificate", dumpMappingsCmd.Flags().Lookup("client-certificate"))
+	dumpMappingsCmd.Flags().String("client-key", "", "Key `file` of --client-certificate")
+	viper.BindPFlag("dumpMappings.clientKey", dumpMappingsCmd.Flags().Lookup("client-key"))
+}
@@ -19,10 +19,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 var initCmd = &cobra.Command{
@@ -36,6 +42,22 @@ var initCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		// the host paths are where the files end up on the control plane
+		// nodes, and are referenced by the generated manifests
+		if stateDir := viper.GetString("init.stateDir"); stateDir != "" {
+			cfg.StateDir = stateDir
+		}
+		if kubeconfigPath := viper.GetString("init.generateKubeconfig"); kubeconfigPath != "" {
+			cfg.GenerateKubeconfigPath = kubeconfigPath
+		}
+		if modes := viper.GetStringSlice("init.backendMode"); len(modes) > 0 {
+			if errs := mapper.ValidateBackendMode(modes); len(errs) > 0 {
+				fmt.Fprintf(os.Stderr, "invalid backend mode: %v\n", utilerrors.NewAggregate(errs))
+				os.Exit(1)
+			}
+			cfg.BackendMode = modes
+		}
+
 		localCfg := cfg
 		localCfg.GenerateKubeconfigPath = "aws-iam-authenticator.kubeconfig"
 		localCfg.StateDir = "./"
@@ -50,6 +72,28 @@ var initCmd = &cobra.Command{
 		logrus.Infof("copy %s to %s on kubernetes master node(s)", localCfg.KeyPath(), cfg.KeyPath())
 		logrus.Infof("copy %s to %s on kubernetes master node(s)", localCfg.GenerateKubeconfigPath, cfg.GenerateKubeconfigPath)
 		logrus.Infof("configure your apiserver with `--authentication-token-webhook-config-file=%s` to enable authentication with aws-iam-authenticator", cfg.GenerateKubeconfigPath)
+
+		_, configMapName := configmap.Location(cfg)
+		opts := config.ManifestOptions{
+			Image:         viper.GetString("init.image"),
+			Workload:      viper.GetString("init.workload"),
+			Replicas:      viper.GetInt("init.replicas"),
+			ConfigMapName: configMapName,
+		}
+		if path := viper.GetString("init.manifestsOutput"); path != "" {
+			if err := cfg.WriteManifests(path, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "could not write manifests: %v\n", err)
+				os.Exit(1)
+			}
+			logrus.Infof("add your mappings to %s and apply it with `kubectl apply -f %s`", path, path)
+		}
+		if path := viper.GetString("init.helmValuesOutput"); path != "" {
+			if err := cfg.WriteHelmValues(path, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "could not write Helm values: %v\n", err)
+				os.Exit(1)
+			}
+			logrus.Infof("wrote Helm values to %s", path)
+		}
 	},
 }
 
@@ -66,5 +110,55 @@ func init() {
 		"IP Address to bind the server to listen to. (should be a 127.0.0.1 or 0.0.0.0)")
 	viper.BindPFlag("server.address", initCmd.Flags().Lookup("address"))
 
+	initCmd.Flags().String("kubeconfig-client-certificate",
+		"",
+		"Path, on the API server, of a client certificate to reference from the generated webhook kubeconfig (for use with --client-ca-file).")
+	viper.BindPFlag("server.kubeconfigClientCertificate", initCmd.Flags().Lookup("kubeconfig-client-certificate"))
+
+	initCmd.Flags().String("kubeconfig-client-key",
+		"",
+		"Path, on the API server, of the private key for --kubeconfig-client-certificate.")
+	viper.BindPFlag("server.kubeconfigClientKey", initCmd.Flags().Lookup("kubeconfig-client-key"))
+
+	initCmd.Flags().String("state-dir",
+		"",
+		"State `directory` on the control plane nodes that the certificate and key are copied to. Defaults to the server's --state-dir.")
+	viper.BindPFlag("init.stateDir", initCmd.Flags().Lookup("state-dir"))
+
+	initCmd.Flags().String("generate-kubeconfig",
+		"",
+		"`path` on the control plane nodes that the webhook kubeconfig is copied to. Defaults to the server's --generate-kubeconfig.")
+	viper.BindPFlag("init.generateKubeconfig", initCmd.Flags().Lookup("generate-kubeconfig"))
+
+	initCmd.Flags().StringSlice("backend-mode",
+		nil,
+		fmt.Sprintf("Backends to configure in the generated manifests. Comma-delimited list of: %s", strings.Join(mapper.BackendModeChoices, ",")))
+	viper.BindPFlag("init.backendMode", initCmd.Flags().Lookup("backend-mode"))
+
+	initCmd.Flags().String("manifests-output",
+		"",
+		"Also write the ServiceAccount, RBAC, configuration and server workload manifests to this `file`.")
+	viper.BindPFlag("init.manifestsOutput", initCmd.Flags().Lookup("manifests-output"))
+
+	initCmd.Flags().String("helm-values-output",
+		"",
+		"Also write the configuration as a Helm values `file`.")
+	viper.BindPFlag("init.helmValuesOutput", initCmd.Flags().Lookup("helm-values-output"))
+
+	initCmd.Flags().String("image",
+		config.DefaultImage,
+		"Server image used in the generated manifests.")
+	viper.BindPFlag("init.image", initCmd.Flags().Lookup("image"))
+
+	initCmd.Flags().String("workload",
+		config.WorkloadDaemonSet,
+		fmt.Sprintf("Workload to run the server as in the generated manifests: %s (every control plane node) or %s.", config.WorkloadDaemonSet, config.WorkloadDeployment))
+	viper.BindPFlag("init.workload", initCmd.Flags().Lookup("workload"))
+
+	initCmd.Flags().Int("replicas",
+		1,
+		"Replicas of the Deployment when --workload=Deployment.")
+	viper.BindPFlag("init.replicas", initCmd.Flags().Lookup("replicas"))
+
 	rootCmd.AddCommand(initCmd)
 }
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/decision"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+)
+
+var mapCmd = &cobra.Command{
+	Use:   "map",
+	Short: "Inspect identity mappings",
+}
+
+var mapTestCmd = &cobra.Command{
+	Use:   "test ARN",
+	Short: "Show how an IAM ARN is mapped by the aws-auth ConfigMap",
+	Long: `Evaluates an IAM user, role or assumed-role ARN against the aws-auth
+ConfigMap, either from a local manifest (--file) or from the cluster, and
+prints the matching mapping with its username and groups rendered. Exits
+non-zero if the ARN is not mapped, so it can be used to check mapping changes
+in CI.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cm, err := loadAWSAuth()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load aws-auth: %v\n", err)
+			os.Exit(1)
+		}
+		users, roles, accounts, err := configmap.ParseMap(cm.Data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse aws-auth: %v\n", err)
+			os.Exit(1)
+		}
+
+		rules := decision.Rules{
+			Accounts:                accounts,
+			StrictARNMatching:       viper.GetBool("server.strictARNMatching") || config.DefaultFeatureGate.Enabled(config.StrictARNMatching),
+			SSORoleCanonicalization: config.DefaultFeatureGate.Enabled(config.SSORoleCanonicalization),
+		}
+		for _, r := range roles {
+			rules.Mappings = append(rules.Mappings, decision.Mapping{ARN: r.RoleARN, Username: r.Username, Groups: r.Groups, NotAfter: r.NotAfter})
+		}
+		for _, u := range users {
+			rules.Mappings = append(rules.Mappings, decision.Mapping{ARN: u.UserARN, Username: u.Username, Groups: u.Groups, NotAfter: u.NotAfter})
+		}
+
+		identity, err := identityFromARN(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		var resolve decision.PrivateDNSResolver
+		if name := viper.GetString("map.privateDNSName"); name != "" {
+			resolve = func(string) (string, error) { return name, nil }
+		}
+		d, err := decision.Evaluate(rules, identity, resolve)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not evaluate %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		matched, _ := decision.Match(rules, d.CanonicalARN, time.Now())
+
+		if viper.GetString("map.output") == "json" {
+			value, err := json.MarshalIndent(struct {
+				decision.Decision
+				Mapping *decision.Mapping `json:"mapping,omitempty"`
+			}{d, matched}, "", "    ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not marshal result: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s\n", value)
+		} else {
+			fmt.Printf("CanonicalARN: %s\n", d.CanonicalARN)
+			if matched != nil {
+				fmt.Printf("Mapping: arn=%s username=%s groups=%v\n", matched.ARN, matched.Username, matched.Groups)
+			}
+			fmt.Printf("Result: %s\n", d.Reason)
+			if d.Allowed {
+				fmt.Printf("Username: %s\nGroups: %v\n", d.Username, d.Groups)
+			}
+		}
+		if !d.Allowed {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadAWSAuth reads the aws-auth ConfigMap from --file, or from the cluster,
+// where the server configuration locates it.
+func loadAWSAuth() (*core_v1.ConfigMap, error) {
+	if path := viper.GetString("map.file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err = utilyaml.ToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		var cm core_v1.ConfigMap
+		if err := json.Unmarshal(data, &cm); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		if cm.Kind != "ConfigMap" {
+			return nil, fmt.Errorf("%s is a %q, not a ConfigMap", path, cm.Kind)
+		}
+		return &cm, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = viper.GetString("map.kubeconfig")
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := configmap.Location(config.Config{
+		BackendConfigMapNamespace: viper.GetString("server.backendConfigMapNamespace"),
+		BackendConfigMapName:      viper.GetString("server.backendConfigMapName"),
+	})
+	return clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+// identityFromARN builds the identity STS would return for identityARN,
+// taking the session name from assumed-role ARNs.
+func identityFromARN(identityARN string) (decision.Identity, error) {
+	principal, err := arn.Parse(identityARN)
+	if err != nil {
+		return decision.Identity{}, fmt.Errorf("%q is not a valid ARN: %v", identityARN, err)
+	}
+	return decision.Identity{
+		ARN:         identityARN,
+		AccountID:   principal.AccountID,
+		SessionName: principal.SessionName,
+		AccessKeyID: viper.GetString("map.accessKeyID"),
+	}, nil
+}
+
+func init() {
+	mapTestCmd.Flags().StringP("file", "f", "",
+		"aws-auth ConfigMap manifest to evaluate instead of the ConfigMap in the cluster.")
+	viper.BindPFlag("map.file", mapTestCmd.Flags().Lookup("file"))
+	mapTestCmd.Flags().String("kubeconfig", "",
+		"kubeconfig of the cluster to read the aws-auth ConfigMap from. Defaults to the kubectl default.")
+	viper.BindPFlag("map.kubeconfig", mapTestCmd.Flags().Lookup("kubeconfig"))
+	mapTestCmd.Flags().String("private-dns-name", "",
+		"Value to render {{EC2PrivateDNSName}} as, since the EC2 API isn't queried.")
+	viper.BindPFlag("map.privateDNSName", mapTestCmd.Flags().Lookup("private-dns-name"))
+	mapTestCmd.Flags().String("access-key-id", "",
+		"Value to render {{AccessKeyID}} as.")
+	viper.BindPFlag("map.accessKeyID", mapTestCmd.Flags().Lookup("access-key-id"))
+	mapTestCmd.Flags().StringP("output", "o", "", "Output format. Only `json` is supported currently.")
+	viper.BindPFlag("map.output", mapTestCmd.Flags().Lookup("output"))
+
+	mapCmd.AddCommand(mapTestCmd)
+	rootCmd.AddCommand(mapCmd)
+}
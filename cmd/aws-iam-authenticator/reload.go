@@ -0,0 +1,178 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mappersLoadTimeout bounds how long the backends of a reloaded configuration
+// have to load their mappings before the reload is abandoned.
+const mappersLoadTimeout = time.Minute
+
+// configReloader reloads the configuration of the server on SIGHUP and when
+// the configuration files change, without dropping its listeners. A
+// configuration that doesn't load or validate is logged and the server keeps
+// the one it has.
+type configReloader struct {
+	server *server.Server
+	cfg    config.Config
+	// mappersStopCh stops the mappers of cfg.
+	mappersStopCh chan struct{}
+	// modTimes are the modification times of the configuration files when
+	// they were last read.
+	modTimes []time.Time
+	hup      chan os.Signal
+}
+
+// newConfigReloader returns the reloader of s, which was created with cfg
+// and mappers started until mappersStopCh is closed. SIGHUP no longer
+// terminates the process from then on.
+func newConfigReloader(s *server.Server, cfg config.Config, mappersStopCh chan struct{}) *configReloader {
+	r := &configReloader{
+		server:        s,
+		cfg:           cfg,
+		mappersStopCh: mappersStopCh,
+		modTimes:      configModTimes(),
+		hup:           make(chan os.Signal, 1),
+	}
+	signal.Notify(r.hup, syscall.SIGHUP)
+	return r
+}
+
+// run reloads the configuration on SIGHUP and, every ConfigReloadInterval,
+// when the configuration files changed, until stopCh is closed. The mappers
+// are stopped then.
+func (r *configReloader) run(stopCh <-chan struct{}) {
+	defer signal.Stop(r.hup)
+	var tick <-chan time.Time
+	if r.cfg.ConfigReloadInterval > 0 && cfgFile != "" {
+		ticker := time.NewTicker(r.cfg.ConfigReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stopCh:
+			close(r.mappersStopCh)
+			return
+		case <-r.hup:
+			logrus.Info("reloading the configuration on SIGHUP")
+			r.modTimes = configModTimes()
+			r.reload(stopCh)
+		case <-tick:
+			modTimes := configModTimes()
+			if reflect.DeepEqual(modTimes, r.modTimes) {
+				continue
+			}
+			r.modTimes = modTimes
+			logrus.Info("reloading the configuration files, which changed")
+			r.reload(stopCh)
+		}
+	}
+}
+
+// reload reads the configuration files again, applies the log level and
+// replaces the reloadable settings of the server. If the configuration
+// changed, the mappers are rebuilt and replace the current ones once they
+// have loaded their mappings, so no request is served by a backend that is
+// still listing them; the replaced mappers are stopped.
+func (r *configReloader) reload(stopCh <-chan struct{}) {
+	if err := readConfigFiles(); err != nil {
+		logrus.WithError(err).Error("could not reload the configuration, keeping the current one")
+		return
+	}
+	if err := reconfigureLogging(); err != nil {
+		logrus.WithError(err).Error("could not reload the logging configuration, keeping the current one")
+	}
+	cfg, err := getConfig()
+	if err != nil {
+		logrus.WithError(err).Error("could not reload the configuration, keeping the current one")
+		return
+	}
+	if reflect.DeepEqual(cfg, r.cfg) {
+		logrus.Info("the server configuration is unchanged")
+		return
+	}
+
+	mappersStopCh := make(chan struct{})
+	mappers, shadowMappers, err := startMappers(cfg, mappersStopCh)
+	if err != nil {
+		close(mappersStopCh)
+		logrus.WithError(err).Error("could not reload the configuration, keeping the current one")
+		return
+	}
+	if err := loadMappers(append(append([]mapper.Mapper{}, mappers...), shadowMappers...), stopCh); err != nil {
+		close(mappersStopCh)
+		logrus.WithError(err).Error("could not reload the configuration, keeping the current one")
+		return
+	}
+	r.server.Reload(cfg, mappers, shadowMappers)
+	close(r.mappersStopCh)
+	r.mappersStopCh = mappersStopCh
+	r.cfg = cfg
+}
+
+// loadMappers waits for mappers to load their mappings, for at most
+// mappersLoadTimeout or until stopCh is closed.
+func loadMappers(mappers []mapper.Mapper, stopCh <-chan struct{}) error {
+	done := make(chan struct{})
+	defer close(done)
+	loadStopCh := make(chan struct{})
+	go func() {
+		defer close(loadStopCh)
+		select {
+		case <-time.After(mappersLoadTimeout):
+		case <-stopCh:
+		case <-done:
+		}
+	}()
+	for _, m := range mappers {
+		if err := mapper.Load(m, loadStopCh); err != nil {
+			return fmt.Errorf("backend %s did not load its mappings: %v", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+// configModTimes returns the modification times of the configuration file and
+// its overlays. Files that can't be read have the zero time.
+func configModTimes() []time.Time {
+	if cfgFile == "" {
+		return nil
+	}
+	var modTimes []time.Time
+	for _, path := range append([]string{cfgFile}, cfgOverlays...) {
+		var modTime time.Time
+		if fi, err := os.Stat(path); err == nil {
+			modTime = fi.ModTime()
+		}
+		modTimes = append(modTimes, modTime)
+	}
+	return modTimes
+}
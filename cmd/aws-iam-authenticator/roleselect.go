@@ -0,0 +1,173 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+
+	"gopkg.in/yaml.v2"
+)
+
+// clientRole is an entry of the clientRoles configuration section: a role
+// the token command offers to assume when --role isn't given.
+type clientRole struct {
+	RoleARN string
+	// ClusterID limits the role to a cluster. Roles without one are offered
+	// for every cluster.
+	ClusterID string
+}
+
+// candidateRoles returns the ARNs of the configured roles for clusterID.
+func candidateRoles(roles []clientRole, clusterID string) []string {
+	var candidates []string
+	for _, role := range roles {
+		if role.ClusterID == "" || role.ClusterID == clusterID {
+			candidates = append(candidates, role.RoleARN)
+		}
+	}
+	return candidates
+}
+
+// roleChoicesFilename is the file remembering the role chosen per cluster.
+func roleChoicesFilename() string {
+	return filepath.Join(token.UserHomeDir(), ".kube", "cache", "aws-iam-authenticator", "roles.yaml")
+}
+
+// readRoleChoices returns the remembered role per cluster ID. A missing or
+// unreadable file remembers nothing.
+func readRoleChoices() map[string]string {
+	choices := map[string]string{}
+	if data, err := ioutil.ReadFile(roleChoicesFilename()); err == nil {
+		_ = yaml.Unmarshal(data, &choices)
+	}
+	return choices
+}
+
+func writeRoleChoice(clusterID, roleARN string) error {
+	choices := readRoleChoices()
+	choices[clusterID] = roleARN
+	data, err := yaml.Marshal(choices)
+	if err != nil {
+		return err
+	}
+	filename := roleChoicesFilename()
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// isTerminal returns whether file is a terminal.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// selectRole returns the role to assume for clusterID when --role isn't
+// given: the only candidate, the remembered choice, or the one picked at an
+// interactive prompt, which is then remembered. It returns "" when there are
+// no candidates.
+func selectRole(roles []clientRole, clusterID string, choose bool) (string, error) {
+	candidates := candidateRoles(roles, clusterID)
+	switch len(candidates) {
+	case 0:
+		return "", nil
+	case 1:
+		return candidates[0], nil
+	}
+	if !choose {
+		remembered := readRoleChoices()[clusterID]
+		for _, candidate := range candidates {
+			if candidate == remembered {
+				return remembered, nil
+			}
+		}
+	}
+	// stdout carries the ExecCredential, so prompt on stderr
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return "", fmt.Errorf("%d roles are configured for cluster %s: pass --role or choose one in a terminal", len(candidates), clusterID)
+	}
+	role, err := promptRole(bufio.NewReader(os.Stdin), os.Stderr, candidates)
+	if err != nil {
+		return "", err
+	}
+	if err := writeRoleChoice(clusterID, role); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to remember the role: %v\n", err)
+	}
+	return role, nil
+}
+
+// promptRole asks to pick one of candidates, by number or by typing a fuzzy
+// filter that narrows them down until a single one is left.
+func promptRole(in *bufio.Reader, out io.Writer, candidates []string) (string, error) {
+	matches := candidates
+	for {
+		for i, role := range matches {
+			fmt.Fprintf(out, "%3d) %s\n", i+1, role)
+		}
+		fmt.Fprintf(out, "Role (number or filter): ")
+		answer, err := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" && err != nil {
+			return "", fmt.Errorf("no role selected")
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(matches) {
+			return matches[n-1], nil
+		}
+		var filtered []string
+		for _, role := range candidates {
+			if fuzzyMatch(answer, role) {
+				filtered = append(filtered, role)
+			}
+		}
+		switch len(filtered) {
+		case 0:
+			fmt.Fprintf(out, "No role matches %q\n", answer)
+			matches = candidates
+		case 1:
+			return filtered[0], nil
+		default:
+			matches = filtered
+		}
+		if err != nil {
+			return "", fmt.Errorf("no role selected")
+		}
+	}
+}
+
+// fuzzyMatch returns whether the characters of pattern appear in s in order,
+// ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
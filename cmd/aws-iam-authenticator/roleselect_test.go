@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testClientRoles = []clientRole{
+	{RoleARN: "arn:aws:iam::123456789012:role/Admin"},
+	{RoleARN: "arn:aws:iam::123456789012:role/Developer", ClusterID: "dev"},
+	{RoleARN: "arn:aws:iam::123456789012:role/ReadOnly", ClusterID: "prod"},
+}
+
+func TestCandidateRoles(t *testing.T) {
+	for clusterID, want := range map[string][]string{
+		"dev":   {"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::123456789012:role/Developer"},
+		"prod":  {"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::123456789012:role/ReadOnly"},
+		"other": {"arn:aws:iam::123456789012:role/Admin"},
+	} {
+		if got := candidateRoles(testClientRoles, clusterID); !reflect.DeepEqual(got, want) {
+			t.Errorf("candidateRoles(%s) = %v, want %v", clusterID, got, want)
+		}
+	}
+}
+
+// withTestHome points the home directory, where role choices are remembered,
+// to a temporary directory until the returned function is called.
+func withTestHome(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "roleselect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, hadHome := os.LookupEnv("HOME")
+	os.Setenv("HOME", dir)
+	return func() {
+		if hadHome {
+			os.Setenv("HOME", home)
+		} else {
+			os.Unsetenv("HOME")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRoleChoices(t *testing.T) {
+	defer withTestHome(t)()
+
+	if choices := readRoleChoices(); len(choices) != 0 {
+		t.Errorf("expected no remembered choices, got %v", choices)
+	}
+	if err := writeRoleChoice("dev", "arn:aws:iam::123456789012:role/Developer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRoleChoice("prod", "arn:aws:iam::123456789012:role/ReadOnly"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"dev":  "arn:aws:iam::123456789012:role/Developer",
+		"prod": "arn:aws:iam::123456789012:role/ReadOnly",
+	}
+	if got := readRoleChoices(); !reflect.DeepEqual(got, want) {
+		t.Errorf("readRoleChoices = %v, want %v", got, want)
+	}
+	info, err := os.Stat(roleChoicesFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the choices to be private, got mode %v", info.Mode())
+	}
+}
+
+func TestSelectRole(t *testing.T) {
+	defer withTestHome(t)()
+
+	if role, err := selectRole(nil, "dev", false); role != "" || err != nil {
+		t.Errorf("selectRole without roles = %q, %v", role, err)
+	}
+	if role, err := selectRole(testClientRoles, "other", true); role != "arn:aws:iam::123456789012:role/Admin" || err != nil {
+		t.Errorf("selectRole of the only candidate = %q, %v", role, err)
+	}
+	if err := writeRoleChoice("dev", "arn:aws:iam::123456789012:role/Developer"); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := selectRole(testClientRoles, "dev", false); role != "arn:aws:iam::123456789012:role/Developer" || err != nil {
+		t.Errorf("selectRole of the remembered choice = %q, %v", role, err)
+	}
+}
+
+func TestPromptRole(t *testing.T) {
+	candidates := []string{
+		"arn:aws:iam::123456789012:role/Admin",
+		"arn:aws:iam::123456789012:role/Developer",
+		"arn:aws:iam::210987654321:role/Developer",
+	}
+	for _, c := range []struct {
+		input string
+		want  string
+	}{
+		{"2\n", candidates[1]},
+		{"admin\n", candidates[0]},
+		// the filter narrows the list, which is then numbered anew
+		{"dev\n2\n", candidates[2]},
+		{"dev\n2109\n", candidates[2]},
+		{"nothing\n1\n", candidates[0]},
+		{"0\nadm", candidates[0]},
+	} {
+		out := &bytes.Buffer{}
+		got, err := promptRole(bufio.NewReader(strings.NewReader(c.input)), out, candidates)
+		if err != nil {
+			t.Errorf("promptRole(%q): %v", c.input, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("promptRole(%q) = %s, want %s", c.input, got, c.want)
+		}
+	}
+
+	for _, input := range []string{"", "dev\n", "nothing"} {
+		if _, err := promptRole(bufio.NewReader(strings.NewReader(input)), ioutil.Discard, candidates); err == nil {
+			t.Errorf("promptRole(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "anything", true},
+		{"dev", "arn:aws:iam::123456789012:role/Developer", true},
+		{"DEV", "arn:aws:iam::123456789012:role/Developer", true},
+		{"rdev", "arn:aws:iam::123456789012:role/Developer", true},
+		{"ved", "arn:aws:iam::123456789012:role/Developer", false},
+		{"é", "rolé", true},
+		{"ee", "e", false},
+	} {
+		if got := fuzzyMatch(c.pattern, c.s); got != c.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
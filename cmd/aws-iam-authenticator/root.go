@@ -17,29 +17,53 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
 
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/roleinfo"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/component-base/featuregate"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 )
 
+// configEnvPrefix prefixes the environment variables setting configuration
+// keys.
+const configEnvPrefix = "AWS_IAM_AUTHENTICATOR"
+
 var cfgFile string
+var cfgOverlays []string
+var strictConfig bool
 
 var rootCmd = &cobra.Command{
 	Use:   "aws-iam-authenticator",
 	Short: "A tool to authenticate to Kubernetes using AWS IAM credentials",
 }
 
-var featureGates = featuregate.NewFeatureGate()
+// organizationParentPattern matches the IDs of organizational units and
+// roots of AWS Organizations.
+var organizationParentPattern = regexp.MustCompile(`^(r-[0-9a-z]{4,32}|ou-[0-9a-z]{4,32}-[0-9a-z]{8,32})$`)
 
 func main() {
 	Execute()
@@ -56,8 +80,16 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "Load configuration from `filename`")
+	rootCmd.PersistentFlags().StringSliceVar(&cfgOverlays, "config-overlay", nil,
+		"Configuration `files` merged over --config in order, e.g. per-environment overrides. Later files take precedence; flags and environment variables override all files.")
+	rootCmd.PersistentFlags().BoolVar(&strictConfig, "strict-config", false,
+		"Fail when the configuration files set keys the authenticator doesn't know instead of logging them")
 
 	rootCmd.PersistentFlags().StringP("log-format", "l", "text", "Specify log format to use when logging to stderr [text or json]")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log `level`: panic, fatal, error, warn, info, debug or trace")
+	viper.BindPFlag("logLevel", rootCmd.PersistentFlags().Lookup("log-level"))
+	rootCmd.PersistentFlags().StringToString("log-component-level", nil,
+		fmt.Sprintf("Log levels of individual components overriding --log-level, e.g. mapper=debug. Components are: %s", strings.Join(logging.Components(), ", ")))
 
 	rootCmd.PersistentFlags().StringP(
 		"cluster-id",
@@ -67,53 +99,278 @@ func init() {
 	viper.BindPFlag("clusterID", rootCmd.PersistentFlags().Lookup("cluster-id"))
 	viper.BindEnv("clusterID", "KUBERNETES_AWS_AUTHENTICATOR_CLUSTER_ID")
 
-	featureGates.Add(config.DefaultFeatureGates)
-	featureGates.AddFlag(rootCmd.PersistentFlags())
+	// Every configuration key can be set by an environment variable named
+	// after it, e.g. AWS_IAM_AUTHENTICATOR_SERVER_BACKENDMODE for
+	// server.backendMode. Flags take precedence over environment variables,
+	// which take precedence over the configuration files.
+	viper.SetEnvPrefix(configEnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	config.DefaultFeatureGate.AddFlag(rootCmd.PersistentFlags())
 }
 
 func initConfig() {
-	logrus.SetFormatter(getLogFormatter())
+	configureLogging()
 	if cfgFile == "" {
+		if len(cfgOverlays) > 0 {
+			fmt.Println("--config-overlay requires a base --config file")
+			os.Exit(1)
+		}
 		return
 	}
+	recordKnownConfigKeys()
+	if err := readConfigFiles(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// the configuration file may set logLevel
+	configureLogging()
+}
+
+// readConfigFiles checks the configuration file and its overlays and reads
+// them into viper, replacing the settings read before.
+func readConfigFiles() error {
+	if cfgFile == "" {
+		return nil
+	}
+	for _, path := range append([]string{cfgFile}, cfgOverlays...) {
+		unknown, err := checkConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("Invalid configuration file %q: %v", path, err)
+		}
+		if len(unknown) == 0 {
+			continue
+		}
+		if strictConfig {
+			return fmt.Errorf("Configuration file %q sets unknown keys: %s", path, strings.Join(unknown, ", "))
+		}
+		logrus.WithField("keys", unknown).Warnf("ignoring unknown keys in configuration file %q", path)
+	}
 	viper.SetConfigFile(cfgFile)
 	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("Can't read configuration file %q: %v\n", cfgFile, err)
-		os.Exit(1)
+		return fmt.Errorf("Can't read configuration file %q: %v", cfgFile, err)
 	}
+	// Overlays are merged key by key into the nested maps of the base, so
+	// an overlay only needs the keys it changes. Lists (such as mapRoles)
+	// are replaced as a whole rather than appended to. viper merges the
+	// file it is configured with, so point it back at the base afterwards
+	// for ConfigFileUsed and later reads.
+	defer viper.SetConfigFile(cfgFile)
+	for _, overlay := range cfgOverlays {
+		viper.SetConfigFile(overlay)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("Can't merge configuration overlay %q: %v", overlay, err)
+		}
+		logrus.WithField("overlay", overlay).Info("merged configuration overlay")
+	}
+	return nil
 }
 
 func getConfig() (config.Config, error) {
 	cfg := config.Config{
 		PartitionID:                       viper.GetString("server.partition"),
 		ClusterID:                         viper.GetString("clusterID"),
+		AdditionalClusterIDs:              getStringSlice("server.additionalClusterIDs"),
+		ClusterIDHeaders:                  getStringSlice("server.clusterIDHeaders"),
+		ClientIPHeader:                    viper.GetString("server.clientIPHeader"),
+		AllowedClockSkew:                  viper.GetDuration("server.allowedClockSkew"),
+		MinRemainingValidity:              viper.GetDuration("server.minRemainingValidity"),
+		STSCacheTTL:                       viper.GetDuration("server.stsCacheTTL"),
+		STSEndpointHostnames:              getStringSlice("server.stsEndpointHostnames"),
+		AllowedSTSRegions:                 getStringSlice("server.allowedSTSRegions"),
+		RejectLongLivedKeys:               viper.GetBool("server.rejectLongLivedKeys"),
+		STSHTTPSProxy:                     viper.GetString("server.stsHTTPSProxy"),
+		STSNoProxy:                        getStringSlice("server.stsNoProxy"),
+		STSCABundle:                       viper.GetString("server.stsCABundle"),
+		STSIPFamily:                       viper.GetString("server.stsIPFamily"),
+		STSHappyEyeballsDelay:             viper.GetDuration("server.stsHappyEyeballsDelay"),
+		STSDialTimeout:                    viper.GetDuration("server.stsDialTimeout"),
+		STSEndpointOverride:               viper.GetString("server.stsEndpointOverride"),
+		STSRetries:                        viper.GetInt("server.stsRetries"),
+		STSRetryBackoff:                   viper.GetDuration("server.stsRetryBackoff"),
+		STSRetryDeadline:                  viper.GetDuration("server.stsRetryDeadline"),
+		AuthenticationTimeout:             viper.GetDuration("server.authenticationTimeout"),
 		ServerEC2DescribeInstancesRoleARN: viper.GetString("server.ec2DescribeInstancesRoleARN"),
+		IAMGroupsRoleARN:                  viper.GetString("server.iamGroupsRoleARN"),
+		IAMGroupsCacheTTL:                 viper.GetDuration("server.iamGroupsCacheTTL"),
+		RoleInfoExtraDescription:          viper.GetBool("server.roleInfoExtraDescription"),
+		RoleInfoExtraTags:                 getStringSlice("server.roleInfoExtraTags"),
+		RoleInfoRoleARN:                   viper.GetString("server.roleInfoRoleARN"),
+		RoleInfoCacheTTL:                  viper.GetDuration("server.roleInfoCacheTTL"),
+		PostMappingHookURL:                viper.GetString("server.postMappingHookURL"),
+		PostMappingHookCABundle:           viper.GetString("server.postMappingHookCABundle"),
+		PostMappingHookTimeout:            viper.GetDuration("server.postMappingHookTimeout"),
+		PostMappingHookFailurePolicy:      viper.GetString("server.postMappingHookFailurePolicy"),
+		RoleTagsRoleARN:                   viper.GetString("server.roleTagsRoleARN"),
+		RoleTagsCacheTTL:                  viper.GetDuration("server.roleTagsCacheTTL"),
+		RoleTagsNegativeCacheTTL:          viper.GetDuration("server.roleTagsNegativeCacheTTL"),
+		RoleTagsAllowedGroups:             getStringSlice("server.roleTagsAllowedGroups"),
+		EKSAccessEntriesCluster:           viper.GetString("server.eksAccessEntriesCluster"),
+		EKSAccessEntriesRegion:            viper.GetString("server.eksAccessEntriesRegion"),
+		EKSAccessEntriesRoleARN:           viper.GetString("server.eksAccessEntriesRoleARN"),
+		EKSAccessEntriesRefreshInterval:   viper.GetDuration("server.eksAccessEntriesRefreshInterval"),
+		EKSAccessEntriesQueueURL:          viper.GetString("server.eksAccessEntriesQueueURL"),
 		HostPort:                          viper.GetInt("server.port"),
+		AuthenticatePaths:                 getStringSlice("server.authenticatePaths"),
+		SocketPath:                        viper.GetString("server.socketPath"),
+		SocketMode:                        viper.GetInt("server.socketMode"),
 		Hostname:                          viper.GetString("server.hostname"),
 		GenerateKubeconfigPath:            viper.GetString("server.generateKubeconfig"),
 		KubeconfigPregenerated:            viper.GetBool("server.kubeconfigPregenerated"),
 		StateDir:                          viper.GetString("server.stateDir"),
 		Address:                           viper.GetString("server.address"),
+		ClientCAFile:                      viper.GetString("server.clientCAFile"),
+		TLSSecret:                         viper.GetString("server.tlsSecret"),
+		CertLifetime:                      viper.GetDuration("server.certLifetime"),
+		CertRotateBefore:                  viper.GetDuration("server.certRotateBefore"),
+		CertReloadInterval:                viper.GetDuration("server.certReloadInterval"),
+		ConfigReloadInterval:              viper.GetDuration("server.configReloadInterval"),
+		KubeconfigClientCertificate:       viper.GetString("server.kubeconfigClientCertificate"),
+		KubeconfigClientKey:               viper.GetString("server.kubeconfigClientKey"),
 		Kubeconfig:                        viper.GetString("server.kubeconfig"),
 		Master:                            viper.GetString("server.master"),
-		BackendMode:                       viper.GetStringSlice("server.backendMode"),
+		KubeAPIQPS:                        float32(viper.GetFloat64("server.kubeAPIQps")),
+		KubeAPIBurst:                      viper.GetInt("server.kubeAPIBurst"),
+		KubeAPIUserAgent:                  viper.GetString("server.kubeAPIUserAgent"),
+		KubeAPITimeout:                    viper.GetDuration("server.kubeAPITimeout"),
+		KubeAPIRetryMinBackoff:            viper.GetDuration("server.kubeAPIRetryMinBackoff"),
+		KubeAPIRetryMaxBackoff:            viper.GetDuration("server.kubeAPIRetryMaxBackoff"),
+		KubeAPIOutageThreshold:            viper.GetDuration("server.kubeAPIOutageThreshold"),
+		BackendMode:                       getStringSlice("server.backendMode"),
+		ShadowBackendMode:                 getStringSlice("server.shadowBackendMode"),
+		BackupMappingFile:                 viper.GetString("server.backupMappingFile"),
+		BackendConfigMapNamespace:         viper.GetString("server.backendConfigMapNamespace"),
+		BackendConfigMapName:              viper.GetString("server.backendConfigMapName"),
+		BackendConfigMapSelector:          viper.GetString("server.backendConfigMapSelector"),
+		CRDNamespacedMappings:             viper.GetBool("server.crdNamespacedMappings"),
+		CRDRoleGCAction:                   viper.GetString("server.crdRoleGCAction"),
+		CRDRoleGCInterval:                 viper.GetDuration("server.crdRoleGCInterval"),
+		CRDRoleGCGracePeriod:              viper.GetDuration("server.crdRoleGCGracePeriod"),
+		CRDRoleGCRoleARN:                  viper.GetString("server.crdRoleGCRoleARN"),
+		StrictARNMatching:                 viper.GetBool("server.strictARNMatching") || config.DefaultFeatureGate.Enabled(config.StrictARNMatching),
+		FailOnPartialParse:                viper.GetBool("server.failOnPartialParse"),
+		FailOnUsernameCollisions:          viper.GetBool("server.failOnUsernameCollisions"),
+		KubernetesEvents:                  viper.GetBool("server.kubernetesEvents"),
+		ConfigMapDeletionGracePeriod:      viper.GetDuration("server.configMapDeletionGracePeriod"),
+		UnsafeGroupsAction:                viper.GetString("server.unsafeGroupsAction"),
+		ReservedGroupPrefixes:             getStringSlice("server.reservedGroupPrefixes"),
+		MaxGroups:                         viper.GetInt("server.maxGroups"),
+		MaxGroupNameLength:                viper.GetInt("server.maxGroupNameLength"),
+		GroupNamePattern:                  viper.GetString("server.groupNamePattern"),
+		GroupLimitsAction:                 viper.GetString("server.groupLimitsAction"),
 		EC2DescribeInstancesQps:           viper.GetInt("server.ec2DescribeInstancesQps"),
 		EC2DescribeInstancesBurst:         viper.GetInt("server.ec2DescribeInstancesBurst"),
-		ScrubbedAWSAccounts:               viper.GetStringSlice("server.scrubbedAccounts"),
+		ScrubbedAWSAccounts:               getStringSlice("server.scrubbedAccounts"),
+		AuditLogPath:                      viper.GetString("server.auditLogPath"),
+		AuditLogMaxSize:                   viper.GetInt("server.auditLogMaxSize"),
+		AuditLogMaxBackups:                viper.GetInt("server.auditLogMaxBackups"),
+		AuditLogMaxAge:                    viper.GetInt("server.auditLogMaxAge"),
+		MappingFiles:                      getStringSlice("server.mappingFiles"),
+		AccountsFile:                      viper.GetString("server.accountsFile"),
+		AccountsCacheTTL:                  viper.GetDuration("server.accountsCacheTTL"),
+		AccountsMaxStale:                  viper.GetDuration("server.accountsMaxStale"),
+		OrganizationsRoleARN:              viper.GetString("server.organizationsRoleARN"),
+		OrganizationsRefreshInterval:      viper.GetDuration("server.organizationsRefreshInterval"),
+		UnmappedUsername:                  viper.GetString("server.unmappedUsername"),
+		UnmappedGroups:                    getStringSlice("server.unmappedGroups"),
+		CircuitBreakerFailureThreshold:    viper.GetInt("server.circuitBreakerFailureThreshold"),
+		CircuitBreakerOpenDuration:        viper.GetDuration("server.circuitBreakerOpenDuration"),
+		TracingOTLPEndpoint:               viper.GetString("server.tracingOTLPEndpoint"),
+		TracingSampleRatio:                viper.GetFloat64("server.tracingSampleRatio"),
+		AuditAnnotations:                  viper.GetBool("server.auditAnnotations"),
+		ValidateAudiences:                 viper.GetBool("server.validateAudiences"),
+		IdentityExtras:                    viper.GetBool("server.identityExtras"),
+		ReplayDetection:                   viper.GetBool("server.replayDetection"),
+		ReplayMaxUses:                     viper.GetInt("server.replayMaxUses"),
+		ReplayBindSource:                  viper.GetBool("server.replayBindSource"),
+		SharedCacheURL:                    viper.GetString("server.sharedCacheURL"),
+		ShutdownGracePeriod:               viper.GetDuration("server.shutdownGracePeriod"),
+		NegativeCacheTTL:                  viper.GetDuration("server.negativeCacheTTL"),
+		SharedCacheTimeout:                viper.GetDuration("server.sharedCacheTimeout"),
+		RateLimitQPS:                      viper.GetInt("server.rateLimitQps"),
+		RateLimitBurst:                    viper.GetInt("server.rateLimitBurst"),
+		RateLimitPerSourceQPS:             viper.GetInt("server.rateLimitPerSourceQps"),
+		RateLimitPerSourceBurst:           viper.GetInt("server.rateLimitPerSourceBurst"),
+		MaxInFlightRequests:               viper.GetInt("server.maxInFlightRequests"),
+		GRPCPort:                          viper.GetInt("server.grpcPort"),
+		DisableKeepAlives:                 viper.GetBool("server.disableKeepAlives"),
+		IdleTimeout:                       viper.GetDuration("server.idleTimeout"),
+		DisableHTTP2:                      viper.GetBool("server.disableHTTP2"),
+		HTTP2MaxConcurrentStreams:         viper.GetInt("server.http2MaxConcurrentStreams"),
+		MetricsPort:                       viper.GetInt("server.metricsPort"),
+		MetricsAddress:                    viper.GetString("server.metricsAddress"),
+		MetricsTLSCertFile:                viper.GetString("server.metricsTLSCertFile"),
+		MetricsTLSKeyFile:                 viper.GetString("server.metricsTLSKeyFile"),
+		MetricsBearerTokenFile:            viper.GetString("server.metricsBearerTokenFile"),
+		DebugPort:                         viper.GetInt("server.debugPort"),
+		MappingsTokenFile:                 viper.GetString("server.mappingsTokenFile"),
+		AWSAuthValidationWebhook:          viper.GetBool("server.awsAuthValidationWebhook"),
+		BootstrapWriter:                   viper.GetBool("server.bootstrapWriter"),
+		BootstrapWriterInterval:           viper.GetDuration("server.bootstrapWriterInterval"),
+		NodeRoleAutoScalingGroups:         getStringSlice("server.nodeRoleAutoScalingGroups"),
+		NodeRoleInstanceTags:              getStringSlice("server.nodeRoleInstanceTags"),
+		NodeRoleDiscoveryRoleARN:          viper.GetString("server.nodeRoleDiscoveryRoleARN"),
 	}
-	if err := viper.UnmarshalKey("server.mapRoles", &cfg.RoleMappings); err != nil {
+	if err := unmarshalKey("server.mapRoles", &cfg.RoleMappings); err != nil {
 		return cfg, fmt.Errorf("invalid server role mappings: %v", err)
 	}
-	if err := viper.UnmarshalKey("server.mapUsers", &cfg.UserMappings); err != nil {
+	if err := unmarshalKey("server.bootstrapMapRoles", &cfg.BootstrapRoleMappings); err != nil {
+		return cfg, fmt.Errorf("invalid bootstrap role mappings: %v", err)
+	}
+	if err := unmarshalKey("server.mappingAssertions", &cfg.MappingAssertions); err != nil {
+		return cfg, fmt.Errorf("invalid mapping assertions: %v", err)
+	}
+	for _, a := range cfg.MappingAssertions {
+		if a.ARN == "" {
+			return cfg, errors.New("mapping assertions must have an arn")
+		}
+	}
+	if err := unmarshalKey("server.mapUsers", &cfg.UserMappings); err != nil {
 		logrus.WithError(err).Fatal("invalid server user mappings")
 	}
-	if err := viper.UnmarshalKey("server.mapAccounts", &cfg.AutoMappedAWSAccounts); err != nil {
+	if err := unmarshalKey("server.mapAccounts", &cfg.AutoMappedAWSAccounts); err != nil {
 		logrus.WithError(err).Fatal("invalid server account mappings")
 	}
+	if err := unmarshalKey("server.mapOrganizationalUnits", &cfg.AutoMappedOrganizationalUnits); err != nil {
+		return cfg, fmt.Errorf("invalid server organizational unit mappings: %v", err)
+	}
+	for _, parent := range cfg.AutoMappedOrganizationalUnits {
+		if !organizationParentPattern.MatchString(parent) {
+			return cfg, fmt.Errorf("%q is not an organizational unit or root ID", parent)
+		}
+	}
+	if len(cfg.AutoMappedOrganizationalUnits) > 0 && cfg.OrganizationsRefreshInterval <= 0 {
+		return cfg, errors.New("organizations refresh interval must be positive")
+	}
+	if err := unmarshalKey("server.sessionNamePolicies", &cfg.SessionNamePolicies); err != nil {
+		return cfg, fmt.Errorf("invalid session name policies: %v", err)
+	}
+	if err := server.ValidateSessionNamePolicies(cfg.SessionNamePolicies); err != nil {
+		return cfg, err
+	}
+	if err := unmarshalKey("server.mappingRules", &cfg.MappingRules); err != nil {
+		return cfg, fmt.Errorf("invalid mapping rules: %v", err)
+	}
+	if err := server.ValidateMappingRules(cfg.MappingRules); err != nil {
+		return cfg, err
+	}
+	if err := unmarshalKey("server.unmappedAccounts", &cfg.UnmappedAccounts); err != nil {
+		return cfg, fmt.Errorf("invalid unmapped accounts: %v", err)
+	}
+	if (len(cfg.UnmappedAccounts) > 0) != (cfg.UnmappedUsername != "") {
+		return cfg, errors.New("unmapped accounts and unmapped username must be set together")
+	}
 
 	if cfg.ClusterID == "" {
 		return cfg, errors.New("cluster ID cannot be empty")
 	}
+	if cfg.KubeAPIQPS < 0 || cfg.KubeAPIBurst < 0 || cfg.KubeAPITimeout < 0 {
+		return cfg, errors.New("API server QPS, burst and timeout cannot be negative")
+	}
+	if cfg.KubeAPIRetryMinBackoff < 0 || cfg.KubeAPIRetryMaxBackoff < 0 || cfg.KubeAPIOutageThreshold < 0 {
+		return cfg, errors.New("API server retry backoffs and outage threshold cannot be negative")
+	}
 
 	partitionKeys := []string{}
 	partitionMap := map[string]endpoints.Partition{}
@@ -125,21 +382,234 @@ func getConfig() (config.Config, error) {
 		return cfg, errors.New("Invalid partition")
 	}
 
+	for _, hostname := range cfg.STSEndpointHostnames {
+		if hostname == "" || strings.ContainsAny(hostname, "/:") {
+			return cfg, fmt.Errorf("invalid STS endpoint hostname %q: expected a hostname without scheme, port or path", hostname)
+		}
+	}
+	for _, header := range cfg.ClusterIDHeaders {
+		if err := token.ValidateClusterIDHeader(header); err != nil {
+			return cfg, err
+		}
+	}
+	var err error
+	if cfg.STSPinnedIPs, err = httputil.ParsePinnedIPs(getStringSlice("server.stsPinnedIPs")); err != nil {
+		return cfg, err
+	}
+	if cfg.CRDNamespacedMappingARNs, err = crd.ParseNamespacedMappingARNs(getStringSlice("server.crdNamespacedMappingARNs")); err != nil {
+		return cfg, err
+	}
+	if err := httputil.ValidateIPFamily(cfg.STSIPFamily); err != nil {
+		return cfg, err
+	}
+	if cfg.STSDialTimeout < 0 {
+		return cfg, errors.New("STS dial timeout cannot be negative")
+	}
+	if cfg.STSRetries < 0 || cfg.STSRetryBackoff < 0 || cfg.STSRetryDeadline < 0 {
+		return cfg, errors.New("STS retries, retry backoff and retry deadline cannot be negative")
+	}
+	if cfg.MinRemainingValidity < 0 || cfg.MinRemainingValidity > token.MaxRefreshBefore {
+		return cfg, fmt.Errorf("minimum remaining validity must be between 0s and %s", token.MaxRefreshBefore)
+	}
+	if cfg.AuthenticationTimeout < 0 {
+		return cfg, errors.New("authentication timeout cannot be negative")
+	}
+	if cfg.STSEndpointOverride != "" {
+		u, err := url.Parse(cfg.STSEndpointOverride)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid STS endpoint override %q: expected an http or https URL", cfg.STSEndpointOverride)
+		}
+	}
+
+	if err := server.ValidateAuthenticatePaths(cfg.AuthenticatePaths); err != nil {
+		return cfg, err
+	}
+	if cfg.IdleTimeout < 0 {
+		return cfg, errors.New("idle timeout cannot be negative")
+	}
+	if cfg.HTTP2MaxConcurrentStreams < 0 {
+		return cfg, errors.New("HTTP/2 max concurrent streams cannot be negative")
+	}
+	if cfg.SocketMode < 0 || cfg.SocketMode > 0777 {
+		return cfg, fmt.Errorf("socket mode must be octal permissions such as 0660, not %#o", cfg.SocketMode)
+	}
+	if (cfg.MetricsTLSCertFile == "") != (cfg.MetricsTLSKeyFile == "") {
+		return cfg, errors.New("metrics TLS certificate and key must be set together")
+	}
+	if cfg.MetricsPort == 0 && (cfg.MetricsTLSCertFile != "" || cfg.MetricsBearerTokenFile != "") {
+		return cfg, errors.New("metrics TLS and bearer token require a metrics port")
+	}
+
+	if cfg.IAMGroupsCacheTTL < 0 {
+		return cfg, errors.New("IAM groups cache TTL cannot be negative")
+	}
+	for _, key := range cfg.RoleInfoExtraTags {
+		if err := roleinfo.ValidateTagKey(key); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.RoleInfoCacheTTL < 0 {
+		return cfg, errors.New("role info cache TTL cannot be negative")
+	}
+	if cfg.PostMappingHookURL != "" {
+		if err := server.ValidatePostMappingHookURL(cfg.PostMappingHookURL); err != nil {
+			return cfg, err
+		}
+		if cfg.PostMappingHookTimeout <= 0 {
+			return cfg, errors.New("post-mapping hook timeout must be positive")
+		}
+		if !sets.NewString(server.HookFailurePolicies...).Has(cfg.PostMappingHookFailurePolicy) {
+			return cfg, fmt.Errorf("post-mapping hook failure policy must be one of %s, not %q", strings.Join(server.HookFailurePolicies, ", "), cfg.PostMappingHookFailurePolicy)
+		}
+	}
+	if cfg.RoleTagsCacheTTL < 0 || cfg.RoleTagsNegativeCacheTTL < 0 {
+		return cfg, errors.New("role tags cache TTLs cannot be negative")
+	}
+	if cfg.EKSAccessEntriesRefreshInterval < 0 {
+		return cfg, errors.New("EKS access entries refresh interval cannot be negative")
+	}
+	if (len(cfg.NodeRoleAutoScalingGroups) > 0 || len(cfg.NodeRoleInstanceTags) > 0) && !cfg.BootstrapWriter {
+		return cfg, errors.New("node role discovery requires the bootstrap writer")
+	}
+
+	if cfg.ReplayMaxUses < 0 {
+		return cfg, errors.New("replay max uses cannot be negative")
+	}
+	if !sets.NewString(mapper.UnsafeGroupsActions...).Has(cfg.UnsafeGroupsAction) {
+		return cfg, fmt.Errorf("unsafe groups action must be one of %s, not %q", strings.Join(mapper.UnsafeGroupsActions, ", "), cfg.UnsafeGroupsAction)
+	}
+	if cfg.CRDRoleGCAction != "" {
+		if !sets.NewString(crd.RoleGCActions...).Has(cfg.CRDRoleGCAction) {
+			return cfg, fmt.Errorf("CRD role garbage collection action must be one of %s, not %q", strings.Join(crd.RoleGCActions, ", "), cfg.CRDRoleGCAction)
+		}
+		if cfg.CRDRoleGCInterval <= 0 {
+			return cfg, errors.New("CRD role garbage collection interval must be positive")
+		}
+		if cfg.CRDRoleGCGracePeriod < 0 {
+			return cfg, errors.New("CRD role garbage collection grace period cannot be negative")
+		}
+	}
+	if cfg.MaxGroups < 0 || cfg.MaxGroupNameLength < 0 {
+		return cfg, errors.New("group limits cannot be negative")
+	}
+	if _, err := mapper.CompileGroupNamePattern(cfg.GroupNamePattern); err != nil {
+		return cfg, err
+	}
+	if !sets.NewString(mapper.GroupLimitsActions...).Has(cfg.GroupLimitsAction) {
+		return cfg, fmt.Errorf("group limits action must be one of %s, not %q", strings.Join(mapper.GroupLimitsActions, ", "), cfg.GroupLimitsAction)
+	}
+	if cfg.NegativeCacheTTL < 0 {
+		return cfg, errors.New("negative cache TTL cannot be negative")
+	}
+	if cfg.ShutdownGracePeriod < 0 {
+		return cfg, errors.New("shutdown grace period cannot be negative")
+	}
+	if cfg.ConfigMapDeletionGracePeriod < 0 {
+		return cfg, errors.New("ConfigMap deletion grace period cannot be negative")
+	}
+	if cfg.SharedCacheURL != "" && cfg.SharedCacheTimeout <= 0 {
+		return cfg, errors.New("shared cache timeout must be positive")
+	}
+
 	if errs := mapper.ValidateBackendMode(cfg.BackendMode); len(errs) > 0 {
 		return cfg, utilerrors.NewAggregate(errs)
 	}
+	if msgs := validation.IsDNS1123Label(cfg.BackendConfigMapNamespace); cfg.BackendConfigMapNamespace != "" && len(msgs) > 0 {
+		return cfg, fmt.Errorf("invalid backend ConfigMap namespace %q: %s", cfg.BackendConfigMapNamespace, strings.Join(msgs, ", "))
+	}
+	if msgs := validation.IsDNS1123Subdomain(cfg.BackendConfigMapName); cfg.BackendConfigMapName != "" && len(msgs) > 0 {
+		return cfg, fmt.Errorf("invalid backend ConfigMap name %q: %s", cfg.BackendConfigMapName, strings.Join(msgs, ", "))
+	}
+	if _, err := labels.Parse(cfg.BackendConfigMapSelector); err != nil {
+		return cfg, fmt.Errorf("invalid backend ConfigMap selector: %v", err)
+	}
+	if len(cfg.ShadowBackendMode) > 0 {
+		if errs := mapper.ValidateBackendMode(cfg.ShadowBackendMode); len(errs) > 0 {
+			return cfg, fmt.Errorf("invalid shadow backend mode: %v", utilerrors.NewAggregate(errs))
+		}
+	}
 
 	return cfg, nil
 }
 
-func getLogFormatter() logrus.Formatter {
+// getStringSlice is viper.GetStringSlice, also splitting lists set by
+// environment variables on commas.
+func getStringSlice(key string) []string {
+	if s, ok := viper.Get(key).(string); ok {
+		return splitList(s)
+	}
+	return viper.GetStringSlice(key)
+}
+
+// unmarshalKey is viper.UnmarshalKey, also decoding structured values set by
+// environment variables. Those are YAML or JSON documents, except that lists
+// of strings can also be separated by commas.
+func unmarshalKey(key string, out interface{}) error {
+	s, ok := viper.Get(key).(string)
+	if !ok {
+		return viper.UnmarshalKey(key, out, viper.DecodeHook(decodeConfigHook))
+	}
+	if list, ok := out.(*[]string); ok && !strings.HasPrefix(strings.TrimSpace(s), "[") {
+		*list = splitList(s)
+		return nil
+	}
+	data, err := utilyaml.ToJSON([]byte(s))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// decodeConfigHook converts the strings of structured values, such as the
+// notAfter of mappings, to RFC 3339 timestamps. It replaces the default hooks
+// of viper, so it also converts durations and comma-separated lists.
+func decodeConfigHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	s, ok := data.(string)
+	if !ok || from.Kind() != reflect.String {
+		return data, nil
+	}
+	switch {
+	case to == reflect.TypeOf(time.Time{}):
+		return time.Parse(time.RFC3339, s)
+	case to == reflect.TypeOf(time.Duration(0)):
+		return time.ParseDuration(s)
+	case to.Kind() == reflect.Slice && s == "":
+		return []string{}, nil
+	case to.Kind() == reflect.Slice:
+		return strings.Split(s, ","), nil
+	}
+	return data, nil
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func configureLogging() {
+	if err := reconfigureLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// reconfigureLogging applies the logging flags and the logLevel key of the
+// configuration.
+func reconfigureLogging() error {
 	format, _ := rootCmd.PersistentFlags().GetString("log-format")
+	level := viper.GetString("logLevel")
+	componentLevels, _ := rootCmd.PersistentFlags().GetStringToString("log-component-level")
 
-	if format == "json" {
-		return &logrus.JSONFormatter{}
-	} else if format != "text" {
+	knownFormat := format
+	if format != logging.FormatText && format != logging.FormatJSON {
+		knownFormat = logging.FormatText
+	}
+	if err := logging.Configure(knownFormat, level, componentLevels); err != nil {
+		return err
+	}
+	if knownFormat != format {
 		logrus.Warnf("Unknown log format specified (%s), will use default text formatter instead.", format)
 	}
-
-	return &logrus.TextFormatter{FullTimestamp: true}
+	return nil
 }
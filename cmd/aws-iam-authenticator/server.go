@@ -19,11 +19,19 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
-	"k8s.io/sample-controller/pkg/signals"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/noderoles"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sharedcache"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/sirupsen/logrus"
@@ -37,6 +45,30 @@ const (
 	// Default Ec2 TPS Variables
 	DefaultEC2DescribeInstancesQps   = 15
 	DefaultEC2DescribeInstancesBurst = 5
+	// DefaultCircuitBreakerOpenDuration is how long a failing backend is
+	// skipped before it is probed again.
+	DefaultCircuitBreakerOpenDuration = 30 * time.Second
+	// DefaultAccountsCacheTTL is how long the --accounts-file allowlist is
+	// cached before it is read again.
+	DefaultAccountsCacheTTL = time.Minute
+	// DefaultAccountsMaxStale is how long past its TTL the cached allowlist
+	// is used while the file can't be read.
+	DefaultAccountsMaxStale = 10 * time.Minute
+	// DefaultOrganizationsRefreshInterval is how often the accounts of
+	// mapOrganizationalUnits are listed again.
+	DefaultOrganizationsRefreshInterval = 10 * time.Minute
+	// DefaultEKSAccessEntriesRefreshInterval is how often the access entries
+	// of the EKSAccessEntries backend are listed again.
+	DefaultEKSAccessEntriesRefreshInterval = 5 * time.Minute
+	// DefaultBootstrapWriterInterval is how often aws-auth is checked for
+	// missing bootstrap mappings.
+	DefaultBootstrapWriterInterval = time.Minute
+	// DefaultCertReloadInterval is how often the serving certificate is
+	// checked for changes on disk and nearing expiry.
+	DefaultCertReloadInterval = time.Minute
+	// DefaultShutdownGracePeriod is how long requests in flight are drained
+	// on shutdown, within the default termination grace period of pods.
+	DefaultShutdownGracePeriod = 25 * time.Second
 )
 
 // serverCmd represents the server command
@@ -45,29 +77,107 @@ var serverCmd = &cobra.Command{
 	Short: "Run a webhook validation server suitable that validates tokens using AWS IAM",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
+		if preflight, _ := cmd.Flags().GetBool("preflight"); preflight {
+			os.Exit(runPreflight())
+		}
+		runService(runServer)
+	},
+}
 
-		stopCh := signals.SetupSignalHandler()
+// runPreflight prints a report of the pre-flight checks of the server
+// configuration and returns the exit code: 1 if any check failed.
+func runPreflight() int {
+	results := []server.PreflightResult{{Check: "config", Detail: "parsed"}}
+	cfg, err := getConfig()
+	if err != nil {
+		results[0] = server.PreflightResult{Check: "config", Err: err}
+	} else {
+		results = append(results, server.Preflight(cfg)...)
+	}
+	code := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("FAIL  %-12s %v\n", result.Check, result.Err)
+			code = 1
+			continue
+		}
+		fmt.Printf("OK    %-12s %s\n", result.Check, result.Detail)
+	}
+	return code
+}
+
+// runServer runs the server until stopCh is closed.
+func runServer(stopCh <-chan struct{}) {
+	var err error
 
-		cfg, err := getConfig()
+	cfg, err := getConfig()
+	if err != nil {
+		logrus.Fatalf("%s", err)
+	}
+
+	mappersStopCh := make(chan struct{})
+	mappers, shadowMappers, err := startMappers(cfg, mappersStopCh)
+	if err != nil {
+		logrus.Fatalf("%s", err)
+	}
+
+	if cfg.BootstrapWriter {
+		sources := []configmap.BootstrapSource{configmap.StaticBootstrapSource(cfg.BootstrapRoleMappings)}
+		nodeRoles, err := noderoles.New(cfg)
 		if err != nil {
-			logrus.Fatalf("%s", err)
+			logrus.Fatalf("failed to set up node role discovery: %v", err)
+		}
+		if nodeRoles != nil {
+			sources = append(sources, nodeRoles)
+		}
+		writer, err := configmap.NewBootstrapWriter(cfg, cfg.BootstrapWriterInterval, sources...)
+		if err != nil {
+			logrus.Fatalf("failed to create the bootstrap writer: %v", err)
+		}
+		identity := os.Getenv("POD_NAME")
+		if identity == "" {
+			identity, _ = os.Hostname()
+		}
+		go writer.Run(identity, stopCh)
+	}
+
+	httpServer := server.New(cfg, mappers, shadowMappers)
+	reloader := newConfigReloader(httpServer, cfg, mappersStopCh)
+	go reloader.run(stopCh)
+	httpServer.Run(stopCh)
+}
+
+// startMappers builds and starts the mapper chain and the shadow mapper chain
+// of cfg until stopCh is closed.
+func startMappers(cfg config.Config, stopCh <-chan struct{}) ([]mapper.Mapper, []mapper.Mapper, error) {
+	mappers, err := server.BuildMapperChain(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build mapper chain: %v", err)
+	}
+	for _, m := range mappers {
+		logrus.Infof("starting mapper %q", m.Name())
+		if err := m.Start(stopCh); err != nil {
+			return nil, nil, fmt.Errorf("start mapper %q failed", m.Name())
 		}
+	}
 
-		mappers, err := server.BuildMapperChain(cfg)
+	var shadowMappers []mapper.Mapper
+	if len(cfg.ShadowBackendMode) > 0 {
+		shadowCfg := cfg
+		shadowCfg.BackendMode = cfg.ShadowBackendMode
+		shadowCfg.BackupMappingFile = ""
+		shadowMappers, err = server.BuildMapperChain(shadowCfg)
 		if err != nil {
-			logrus.Fatalf("failed to build mapper chain: %v", err)
+			return nil, nil, fmt.Errorf("failed to build shadow mapper chain: %v", err)
 		}
-		for _, m := range mappers {
-			logrus.Infof("starting mapper %q", m.Name())
+		for _, m := range shadowMappers {
+			logrus.Infof("starting shadow mapper %q", m.Name())
 			if err := m.Start(stopCh); err != nil {
-				logrus.Fatalf("start mapper %q failed", m.Name())
+				return nil, nil, fmt.Errorf("start shadow mapper %q failed", m.Name())
 			}
 		}
-
-		httpServer := server.New(cfg, mappers)
-		httpServer.Run(stopCh)
-	},
+	}
+	return mappers, shadowMappers, nil
 }
 
 func init() {
@@ -98,23 +208,309 @@ func init() {
 
 	serverCmd.Flags().String("kubeconfig",
 		"",
-		"kubeconfig file path for using a local kubeconfig to configure the client to talk to the API server for the IAMIdentityMappings.")
+		"kubeconfig file path for using a local kubeconfig to configure the client to talk to the API server for the IAMIdentityMappings. Without it or --master, the in-cluster configuration of the pod is used.")
 	viper.BindPFlag("server.kubeconfig", serverCmd.Flags().Lookup("kubeconfig"))
 	serverCmd.Flags().String("master",
 		"",
 		"master is the URL to the api server")
 	viper.BindPFlag("server.master", serverCmd.Flags().Lookup("master"))
+	serverCmd.Flags().Float64("kube-api-qps",
+		0,
+		"Rate of requests to the API server, e.g. by the EKSConfigMap and CRD backends. 0 keeps the client-go default.")
+	viper.BindPFlag("server.kubeAPIQps", serverCmd.Flags().Lookup("kube-api-qps"))
+	serverCmd.Flags().Int("kube-api-burst",
+		0,
+		"Burst of requests to the API server above --kube-api-qps. 0 keeps the client-go default.")
+	viper.BindPFlag("server.kubeAPIBurst", serverCmd.Flags().Lookup("kube-api-burst"))
+	serverCmd.Flags().String("kube-api-user-agent",
+		"",
+		"User agent of requests to the API server. Defaults to aws-iam-authenticator/<version>.")
+	viper.BindPFlag("server.kubeAPIUserAgent", serverCmd.Flags().Lookup("kube-api-user-agent"))
+	serverCmd.Flags().Duration("kube-api-timeout",
+		0,
+		"Timeout of requests to the API server, including watches, which are then re-established. 0 disables the timeout.")
+	viper.BindPFlag("server.kubeAPITimeout", serverCmd.Flags().Lookup("kube-api-timeout"))
+	serverCmd.Flags().Duration("kube-api-retry-min-backoff",
+		time.Second,
+		"Initial delay before the EKSConfigMap backend retries a failed or ended watch of the API server. It doubles while watches keep failing.")
+	viper.BindPFlag("server.kubeAPIRetryMinBackoff", serverCmd.Flags().Lookup("kube-api-retry-min-backoff"))
+	serverCmd.Flags().Duration("kube-api-retry-max-backoff",
+		2*time.Minute,
+		"Maximum delay before the EKSConfigMap backend retries a failed or ended watch of the API server.")
+	viper.BindPFlag("server.kubeAPIRetryMaxBackoff", serverCmd.Flags().Lookup("kube-api-retry-max-backoff"))
+	serverCmd.Flags().Duration("kube-api-outage-threshold",
+		0,
+		"How long the API server may be unreachable before the EKSConfigMap backend reports it is degraded and serves its last known good mappings, retrying at --kube-api-retry-max-backoff. 0 never reports an outage.")
+	viper.BindPFlag("server.kubeAPIOutageThreshold", serverCmd.Flags().Lookup("kube-api-outage-threshold"))
+
+	serverCmd.Flags().Bool("preflight",
+		false,
+		"Check the configuration, AWS credentials, API server access, serving certificate and state directory, print a report and exit instead of serving. Exits non-zero if a check fails, for use as an init container.")
 
 	serverCmd.Flags().String("address",
 		"127.0.0.1",
 		"IP Address to bind the server to listen to. (should be a 127.0.0.1 or 0.0.0.0)")
 	viper.BindPFlag("server.address", serverCmd.Flags().Lookup("address"))
 
+	serverCmd.Flags().StringSlice("authenticate-paths",
+		[]string{config.DefaultAuthenticatePath},
+		"URL paths to serve the authentication webhook on, such as a versioned path next to the old one while the webhook kubeconfigs of the API servers are migrated. The generated kubeconfig uses the first.")
+	viper.BindPFlag("server.authenticatePaths", serverCmd.Flags().Lookup("authenticate-paths"))
+
+	serverCmd.Flags().String("socket-path",
+		"",
+		"Listen on this UNIX socket `path` for clients on the same host instead of --address and --port, controlling access with the socket's permissions")
+	viper.BindPFlag("server.socketPath", serverCmd.Flags().Lookup("socket-path"))
+	serverCmd.Flags().String("socket-mode",
+		"0660",
+		"Octal permissions of --socket-path")
+	viper.BindPFlag("server.socketMode", serverCmd.Flags().Lookup("socket-mode"))
+
+	serverCmd.Flags().String("tls-secret",
+		"",
+		"`namespace/name` of a kubernetes.io/tls Secret (e.g. issued by cert-manager) to serve instead of a self-signed certificate. The Secret is watched for renewals.")
+	viper.BindPFlag("server.tlsSecret", serverCmd.Flags().Lookup("tls-secret"))
+
+	serverCmd.Flags().Duration("cert-lifetime",
+		0,
+		"Validity period of generated self-signed certificates. 0 means 100 years.")
+	viper.BindPFlag("server.certLifetime", serverCmd.Flags().Lookup("cert-lifetime"))
+
+	serverCmd.Flags().Duration("cert-rotate-before",
+		0,
+		"Replace a generated self-signed certificate (and regenerate the webhook kubeconfig) when it expires within this duration. 0 disables rotation.")
+	viper.BindPFlag("server.certRotateBefore", serverCmd.Flags().Lookup("cert-rotate-before"))
+
+	serverCmd.Flags().Duration("cert-reload-interval",
+		DefaultCertReloadInterval,
+		"How often to reload the certificate and key from the state directory if they changed, and check them for rotation. 0 disables reloading.")
+	viper.BindPFlag("server.certReloadInterval", serverCmd.Flags().Lookup("cert-reload-interval"))
+
+	serverCmd.Flags().Duration("config-reload-interval",
+		0,
+		"How often to check the configuration files for changes, which are reloaded without a restart like on SIGHUP. 0 disables checking.")
+	viper.BindPFlag("server.configReloadInterval", serverCmd.Flags().Lookup("config-reload-interval"))
+
+	serverCmd.Flags().Duration("shutdown-grace-period",
+		DefaultShutdownGracePeriod,
+		"How long requests in flight are given to finish on SIGTERM after the server stops accepting connections. Keep it below the pod's terminationGracePeriodSeconds.")
+	viper.BindPFlag("server.shutdownGracePeriod", serverCmd.Flags().Lookup("shutdown-grace-period"))
+
+	serverCmd.Flags().String("client-ca-file",
+		"",
+		"If set, require clients (the API server) to present a TLS certificate signed by a CA in this PEM `file`.")
+	viper.BindPFlag("server.clientCAFile", serverCmd.Flags().Lookup("client-ca-file"))
+
+	serverCmd.Flags().String("kubeconfig-client-certificate",
+		"",
+		"Path, on the API server, of a client certificate to reference from the generated webhook kubeconfig (for use with --client-ca-file).")
+	viper.BindPFlag("server.kubeconfigClientCertificate", serverCmd.Flags().Lookup("kubeconfig-client-certificate"))
+
+	serverCmd.Flags().String("kubeconfig-client-key",
+		"",
+		"Path, on the API server, of the private key for --kubeconfig-client-certificate.")
+	viper.BindPFlag("server.kubeconfigClientKey", serverCmd.Flags().Lookup("kubeconfig-client-key"))
+
+	serverCmd.Flags().StringSlice("additional-cluster-ids",
+		nil,
+		"Cluster IDs to accept tokens for besides --cluster-id, e.g. while renaming a cluster. Tokens for these IDs take an extra STS call per ID tried.")
+	viper.BindPFlag("server.additionalClusterIDs", serverCmd.Flags().Lookup("additional-cluster-ids"))
+	serverCmd.Flags().StringSlice("cluster-id-headers",
+		[]string{token.DefaultClusterIDHeader},
+		"Headers tokens may sign the cluster ID in, for clients of forks or distributions that renamed it. The first one signed in a token is sent to STS.")
+	viper.BindPFlag("server.clusterIDHeaders", serverCmd.Flags().Lookup("cluster-id-headers"))
+	serverCmd.Flags().String("client-ip-header",
+		"",
+		"Request `header` carrying the IP address of the client that minted a token, such as X-Forwarded-For, which tokens bound with token --bind-source-ip are checked against. Only set it if a trusted proxy in front of the server sets the header. Without it, bound tokens are checked against the address of the caller, which is the API server when the server runs as its webhook.")
+	viper.BindPFlag("server.clientIPHeader", serverCmd.Flags().Lookup("client-ip-header"))
+
+	serverCmd.Flags().Duration("allowed-clock-skew",
+		token.DefaultAllowedClockSkew,
+		"Difference tolerated between the signing time of a token and the server clock. Tokens rejected because of skew are counted with reason clock_skew in the token verification errors metric.")
+	viper.BindPFlag("server.allowedClockSkew", serverCmd.Flags().Lookup("allowed-clock-skew"))
+	serverCmd.Flags().Duration("min-remaining-validity",
+		0,
+		"Reject tokens that expire in less than this, so retried TokenReviews don't straddle the expiry of the token. Clients should refresh tokens at least this long before they expire with `aws-iam-authenticator token --refresh-before`.")
+	viper.BindPFlag("server.minRemainingValidity", serverCmd.Flags().Lookup("min-remaining-validity"))
+
+	serverCmd.Flags().Duration("sts-cache-ttl",
+		0,
+		"How long to cache the identity STS returns for a token, so a client resending it isn't verified with STS again. Cached identities never outlive their token. 0 disables the cache.")
+	viper.BindPFlag("server.stsCacheTTL", serverCmd.Flags().Lookup("sts-cache-ttl"))
+
+	serverCmd.Flags().Duration("negative-cache-ttl",
+		0,
+		"How long to reject a token whose identity isn't mapped without verifying it with STS again, plus up to 20% jitter. A mapping added in the meantime applies to the token once this expires. 0 disables the cache.")
+	viper.BindPFlag("server.negativeCacheTTL", serverCmd.Flags().Lookup("negative-cache-ttl"))
+
+	serverCmd.Flags().StringSlice("sts-endpoint-hostnames",
+		nil,
+		"Hostnames of STS endpoints accepted in tokens besides the public ones, such as VPC interface endpoints (vpce-xxxx.sts.us-east-1.vpce.amazonaws.com). Tokens are verified by sending them to their host.")
+	viper.BindPFlag("server.stsEndpointHostnames", serverCmd.Flags().Lookup("sts-endpoint-hostnames"))
+
+	serverCmd.Flags().StringSlice("allowed-sts-regions",
+		nil,
+		"If set, only accept tokens signed for these STS regions, such as those clients presign against with --region. Tokens for the global STS endpoint are signed for us-east-1.")
+	viper.BindPFlag("server.allowedSTSRegions", serverCmd.Flags().Lookup("allowed-sts-regions"))
+	serverCmd.Flags().Bool("reject-long-lived-keys",
+		false,
+		"Deny tokens signed with long-lived access keys (AKIA...) such as those of IAM users, accepting only temporary STS credentials (ASIA...).")
+	viper.BindPFlag("server.rejectLongLivedKeys", serverCmd.Flags().Lookup("reject-long-lived-keys"))
+
+	serverCmd.Flags().String("sts-https-proxy",
+		"",
+		"`URL` of the proxy to call STS through. Defaults to the HTTPS_PROXY and NO_PROXY environment variables.")
+	viper.BindPFlag("server.stsHTTPSProxy", serverCmd.Flags().Lookup("sts-https-proxy"))
+	serverCmd.Flags().StringSlice("sts-no-proxy",
+		nil,
+		"STS hosts to call directly despite --sts-https-proxy, such as VPC endpoints. A leading dot matches subdomains and * all hosts.")
+	viper.BindPFlag("server.stsNoProxy", serverCmd.Flags().Lookup("sts-no-proxy"))
+	serverCmd.Flags().String("sts-ca-bundle",
+		"",
+		"PEM `file` of CAs to trust for STS besides the system ones, such as the CA of a TLS-intercepting egress proxy.")
+	viper.BindPFlag("server.stsCABundle", serverCmd.Flags().Lookup("sts-ca-bundle"))
+	serverCmd.Flags().StringSlice("sts-pinned-ips",
+		nil,
+		"STS hosts to call at fixed IP addresses without resolving them, as host=ip entries. Repeat a host to try several addresses in turn.")
+	viper.BindPFlag("server.stsPinnedIPs", serverCmd.Flags().Lookup("sts-pinned-ips"))
+	serverCmd.Flags().String("sts-ip-family",
+		"",
+		"Call STS at addresses of this family (ipv4 or ipv6) before the others. By default both are raced.")
+	viper.BindPFlag("server.stsIPFamily", serverCmd.Flags().Lookup("sts-ip-family"))
+	serverCmd.Flags().Duration("sts-happy-eyeballs-delay",
+		300*time.Millisecond,
+		"How long to try the first address family of STS before racing the other. Negative disables racing.")
+	viper.BindPFlag("server.stsHappyEyeballsDelay", serverCmd.Flags().Lookup("sts-happy-eyeballs-delay"))
+	serverCmd.Flags().Duration("sts-dial-timeout",
+		httputil.DefaultDialTimeout,
+		"Maximum time to resolve an STS host and connect to it.")
+	viper.BindPFlag("server.stsDialTimeout", serverCmd.Flags().Lookup("sts-dial-timeout"))
+
+	serverCmd.Flags().String("sts-endpoint-override",
+		"",
+		"`URL` to send tokens to for verification instead of their STS host, such as a mock STS for end-to-end tests or air-gapped demos. Never set this in production.")
+	viper.BindPFlag("server.stsEndpointOverride", serverCmd.Flags().Lookup("sts-endpoint-override"))
+
+	serverCmd.Flags().Int("sts-retries",
+		2,
+		"How many times to retry a throttled or failed (5xx) sts:GetCallerIdentity call. 0 disables retries.")
+	viper.BindPFlag("server.stsRetries", serverCmd.Flags().Lookup("sts-retries"))
+	serverCmd.Flags().Duration("sts-retry-backoff",
+		token.DefaultSTSRetryBackoff,
+		"Initial delay before retrying an STS call. It doubles with every retry, and a random part of it is waited.")
+	viper.BindPFlag("server.stsRetryBackoff", serverCmd.Flags().Lookup("sts-retry-backoff"))
+	serverCmd.Flags().Duration("sts-retry-deadline",
+		5*time.Second,
+		"STS calls are not retried later than this after the first call for a token, so the TokenReview is answered in time. 0 for no deadline.")
+	viper.BindPFlag("server.stsRetryDeadline", serverCmd.Flags().Lookup("sts-retry-deadline"))
+	serverCmd.Flags().Duration("authentication-timeout",
+		10*time.Second,
+		"Maximum time to verify a token with STS before denying it with the timeout reason, besides the deadline of the request. Keep it below the webhook timeout of the API server. 0 for no limit.")
+	viper.BindPFlag("server.authenticationTimeout", serverCmd.Flags().Lookup("authentication-timeout"))
+
 	serverCmd.Flags().StringSlice("backend-mode",
 		[]string{mapper.ModeMountedFile},
 		fmt.Sprintf("Ordered list of backends to get mappings from. The first one that returns a matching mapping wins. Comma-delimited list of: %s", strings.Join(mapper.BackendModeChoices, ",")))
 	viper.BindPFlag("server.backendMode", serverCmd.Flags().Lookup("backend-mode"))
 
+	serverCmd.Flags().String("backup-mapping-file",
+		"",
+		"YAML `file` of break-glass mapRoles and mapUsers consulted after every backend. It is read once on startup and never from the cluster.")
+	viper.BindPFlag("server.backupMappingFile", serverCmd.Flags().Lookup("backup-mapping-file"))
+
+	serverCmd.Flags().StringSlice("shadow-backend-mode",
+		nil,
+		"Ordered list of backends to evaluate in dry-run alongside --backend-mode. Differences from the live mapping are logged and counted in metrics but never enforced.")
+	viper.BindPFlag("server.shadowBackendMode", serverCmd.Flags().Lookup("shadow-backend-mode"))
+
+	serverCmd.Flags().String("backend-configmap-namespace",
+		configmap.DefaultNamespace,
+		"Namespace of the ConfigMap the EKSConfigMap backend reads mappings from")
+	viper.BindPFlag("server.backendConfigMapNamespace", serverCmd.Flags().Lookup("backend-configmap-namespace"))
+	serverCmd.Flags().String("backend-configmap-name",
+		configmap.DefaultName,
+		"Name of the ConfigMap the EKSConfigMap backend reads mappings from")
+	viper.BindPFlag("server.backendConfigMapName", serverCmd.Flags().Lookup("backend-configmap-name"))
+	serverCmd.Flags().String("backend-configmap-selector",
+		"",
+		"Label selector of more ConfigMaps in the backend ConfigMap namespace whose mappings are merged with the backend ConfigMap, e.g. aws-iam-authenticator/mappings=team")
+	viper.BindPFlag("server.backendConfigMapSelector", serverCmd.Flags().Lookup("backend-configmap-selector"))
+
+	serverCmd.Flags().Duration("configmap-deletion-grace-period",
+		0,
+		"How long the last mappings of the backend ConfigMap are kept after it is deleted, while the aws_iam_authenticator_configmap_deleted metric is raised. 0 drops them immediately.")
+	viper.BindPFlag("server.configMapDeletionGracePeriod", serverCmd.Flags().Lookup("configmap-deletion-grace-period"))
+
+	serverCmd.Flags().Bool("fail-on-partial-parse",
+		false,
+		"Keep the previously loaded mappings of a backend ConfigMap when any of its sections fails to parse, instead of dropping the entries of the broken section")
+	viper.BindPFlag("server.failOnPartialParse", serverCmd.Flags().Lookup("fail-on-partial-parse"))
+	serverCmd.Flags().Bool("fail-on-username-collisions",
+		false,
+		"Keep the previously loaded mappings of the backend ConfigMaps when new ones map several ARNs to the same static username, instead of loading them with a warning")
+	viper.BindPFlag("server.failOnUsernameCollisions", serverCmd.Flags().Lookup("fail-on-username-collisions"))
+
+	serverCmd.Flags().Bool("kubernetes-events",
+		false,
+		"Emit Kubernetes Events on the backend ConfigMaps when their mappings are loaded, fail to parse, conflict or fail the mapping assertions")
+	viper.BindPFlag("server.kubernetesEvents", serverCmd.Flags().Lookup("kubernetes-events"))
+
+	serverCmd.Flags().String("unsafe-groups-action",
+		mapper.UnsafeGroupsAllow,
+		fmt.Sprintf("What to do with identities mapped to --reserved-group-prefixes by a backend other than MountedFile, which can be edited from within the cluster. One of: %s", strings.Join(mapper.UnsafeGroupsActions, ",")))
+	viper.BindPFlag("server.unsafeGroupsAction", serverCmd.Flags().Lookup("unsafe-groups-action"))
+	serverCmd.Flags().StringSlice("reserved-group-prefixes",
+		mapper.DefaultReservedGroupPrefixes,
+		"Prefixes of the groups checked by --unsafe-groups-action")
+	viper.BindPFlag("server.reservedGroupPrefixes", serverCmd.Flags().Lookup("reserved-group-prefixes"))
+
+	serverCmd.Flags().Int("max-groups",
+		0,
+		"Maximum number of groups an identity is authenticated with, including those of IAM groups (0 is unlimited)")
+	viper.BindPFlag("server.maxGroups", serverCmd.Flags().Lookup("max-groups"))
+	serverCmd.Flags().Int("max-group-name-length",
+		0,
+		"Maximum length of the group names an identity is authenticated with (0 is unlimited)")
+	viper.BindPFlag("server.maxGroupNameLength", serverCmd.Flags().Lookup("max-group-name-length"))
+	serverCmd.Flags().String("group-name-pattern",
+		"",
+		"Regular expression the whole group names an identity is authenticated with must match (empty matches any)")
+	viper.BindPFlag("server.groupNamePattern", serverCmd.Flags().Lookup("group-name-pattern"))
+	serverCmd.Flags().String("group-limits-action",
+		mapper.GroupLimitsReject,
+		fmt.Sprintf("What to do with identities whose groups exceed --max-groups, --max-group-name-length or --group-name-pattern. One of: %s", strings.Join(mapper.GroupLimitsActions, ",")))
+	viper.BindPFlag("server.groupLimitsAction", serverCmd.Flags().Lookup("group-limits-action"))
+
+	serverCmd.Flags().Bool("strict-arn-matching",
+		false,
+		"Match mapped ARNs byte for byte instead of case-insensitively, for policies that treat IAM names as case-sensitive. Mappings whose ARNs differ only by case are logged.")
+	viper.BindPFlag("server.strictARNMatching", serverCmd.Flags().Lookup("strict-arn-matching"))
+
+	serverCmd.Flags().Bool("crd-namespaced-mappings",
+		false,
+		"Also map identities with NamespacedIAMIdentityMappings in the CRD backend, prefixing their usernames and groups with ns:<namespace>:. Requires deploy/namespacediamidentitymapping.yaml.")
+	viper.BindPFlag("server.crdNamespacedMappings", serverCmd.Flags().Lookup("crd-namespaced-mappings"))
+	serverCmd.Flags().StringSlice("crd-namespaced-mapping-arns",
+		nil,
+		"ARNs the NamespacedIAMIdentityMappings of a namespace may map, as namespace=arn entries. An ARN ending with * is a prefix. Mappings of other ARNs are ignored.")
+	viper.BindPFlag("server.crdNamespacedMappingARNs", serverCmd.Flags().Lookup("crd-namespaced-mapping-arns"))
+	serverCmd.Flags().String("crd-role-gc-action",
+		"",
+		fmt.Sprintf("Check the roles of IAMIdentityMappings with iam:GetRole and act on those that no longer exist. One of: %s (empty disables it)", strings.Join(crd.RoleGCActions, ",")))
+	viper.BindPFlag("server.crdRoleGCAction", serverCmd.Flags().Lookup("crd-role-gc-action"))
+	serverCmd.Flags().Duration("crd-role-gc-interval",
+		time.Hour,
+		"How often --crd-role-gc-action checks the roles of IAMIdentityMappings")
+	viper.BindPFlag("server.crdRoleGCInterval", serverCmd.Flags().Lookup("crd-role-gc-interval"))
+	serverCmd.Flags().Duration("crd-role-gc-grace-period",
+		24*time.Hour,
+		"How long the role of an IAMIdentityMapping must be missing before --crd-role-gc-action=delete deletes it")
+	viper.BindPFlag("server.crdRoleGCGracePeriod", serverCmd.Flags().Lookup("crd-role-gc-grace-period"))
+	serverCmd.Flags().String("crd-role-gc-role-arn",
+		"",
+		"IAM role assumed to call iam:GetRole for --crd-role-gc-action. Only roles of its account are checked.")
+	viper.BindPFlag("server.crdRoleGCRoleARN", serverCmd.Flags().Lookup("crd-role-gc-role-arn"))
+
 	serverCmd.Flags().Int(
 		"port",
 		DefaultPort,
@@ -133,6 +529,346 @@ func init() {
 		"AWS EC2 rate Limiting with burst")
 	viper.BindPFlag("server.ec2DescribeInstancesBurst", serverCmd.Flags().Lookup("ec2-describeInstances-burst"))
 
+	serverCmd.Flags().String("ec2-describeInstances-role-arn",
+		"",
+		"Role `ARN` assumed to describe the EC2 instances of private DNS name usernames, e.g. when they run in another account.")
+	viper.BindPFlag("server.ec2DescribeInstancesRoleARN", serverCmd.Flags().Lookup("ec2-describeInstances-role-arn"))
+
+	serverCmd.Flags().StringSlice("scrubbed-accounts",
+		nil,
+		"AWS account `IDs` scrubbed from logs and audit records.")
+	viper.BindPFlag("server.scrubbedAccounts", serverCmd.Flags().Lookup("scrubbed-accounts"))
+
+	serverCmd.Flags().String("audit-log-path",
+		"",
+		"If set, all authentication decisions are logged as JSON lines to this `path`. '-' means standard out.")
+	viper.BindPFlag("server.auditLogPath", serverCmd.Flags().Lookup("audit-log-path"))
+
+	serverCmd.Flags().Int("audit-log-maxsize",
+		0,
+		"Maximum size in megabytes of the audit log file before it gets rotated. 0 disables rotation.")
+	viper.BindPFlag("server.auditLogMaxSize", serverCmd.Flags().Lookup("audit-log-maxsize"))
+
+	serverCmd.Flags().Int("audit-log-maxbackup",
+		0,
+		"Maximum number of rotated audit log files to retain. 0 retains all of them.")
+	viper.BindPFlag("server.auditLogMaxBackups", serverCmd.Flags().Lookup("audit-log-maxbackup"))
+
+	serverCmd.Flags().Int("audit-log-maxage",
+		0,
+		"Maximum number of days to retain rotated audit log files. 0 retains them regardless of age.")
+	viper.BindPFlag("server.auditLogMaxAge", serverCmd.Flags().Lookup("audit-log-maxage"))
+
+	serverCmd.Flags().Bool("audit-annotations",
+		false,
+		"Add the original ARN, mapping source and STS latency to the user extras under authentication.kubernetes.io/ keys so they appear in API server audit logs.")
+	viper.BindPFlag("server.auditAnnotations", serverCmd.Flags().Lookup("audit-annotations"))
+
+	serverCmd.Flags().StringSlice("mapping-files",
+		nil,
+		"Paths or globs of files of mapRoles, mapUsers and mapAccounts to add to those of the configuration file (MountedFile backend). Files can include others and use their YAML anchors.")
+	viper.BindPFlag("server.mappingFiles", serverCmd.Flags().Lookup("mapping-files"))
+
+	serverCmd.Flags().String("accounts-file",
+		"",
+		"Path of a YAML list of AWS account IDs whose identities are allowed without a mapping, in addition to mapAccounts. Re-read every --accounts-cache-ttl (MountedFile backend).")
+	viper.BindPFlag("server.accountsFile", serverCmd.Flags().Lookup("accounts-file"))
+
+	serverCmd.Flags().Duration("accounts-cache-ttl",
+		DefaultAccountsCacheTTL,
+		"How long the --accounts-file allowlist is cached before it is read again.")
+	viper.BindPFlag("server.accountsCacheTTL", serverCmd.Flags().Lookup("accounts-cache-ttl"))
+
+	serverCmd.Flags().Duration("accounts-max-stale",
+		DefaultAccountsMaxStale,
+		"How long past --accounts-cache-ttl the cached allowlist is still used while --accounts-file can't be read. After that account checks fail.")
+	viper.BindPFlag("server.accountsMaxStale", serverCmd.Flags().Lookup("accounts-max-stale"))
+
+	serverCmd.Flags().String("organizations-role-arn",
+		"",
+		"IAM role to assume before listing the accounts of mapOrganizationalUnits with AWS Organizations")
+	viper.BindPFlag("server.organizationsRoleARN", serverCmd.Flags().Lookup("organizations-role-arn"))
+
+	serverCmd.Flags().StringSlice("map-accounts",
+		nil,
+		"AWS account `IDs` whose users and roles are mapped to their ARNs as usernames, without groups.")
+	viper.BindPFlag("server.mapAccounts", serverCmd.Flags().Lookup("map-accounts"))
+
+	serverCmd.Flags().StringSlice("map-organizational-units",
+		nil,
+		"Organizational unit or root `IDs` whose accounts are mapped like --map-accounts.")
+	viper.BindPFlag("server.mapOrganizationalUnits", serverCmd.Flags().Lookup("map-organizational-units"))
+
+	serverCmd.Flags().Duration("organizations-refresh-interval",
+		DefaultOrganizationsRefreshInterval,
+		"How long the accounts of mapOrganizationalUnits are cached before they are listed again.")
+	viper.BindPFlag("server.organizationsRefreshInterval", serverCmd.Flags().Lookup("organizations-refresh-interval"))
+
+	serverCmd.Flags().StringSlice("unmapped-accounts",
+		nil,
+		"AWS account `IDs` whose identities no backend maps are authenticated as --unmapped-username instead of being denied.")
+	viper.BindPFlag("server.unmappedAccounts", serverCmd.Flags().Lookup("unmapped-accounts"))
+	serverCmd.Flags().String("unmapped-username",
+		"",
+		"Username template of identities of --unmapped-accounts that no backend maps, e.g. aws-unmapped:{{AccountID}}:{{SessionName}}")
+	viper.BindPFlag("server.unmappedUsername", serverCmd.Flags().Lookup("unmapped-username"))
+	serverCmd.Flags().StringSlice("unmapped-groups",
+		nil,
+		"Group templates of identities of --unmapped-accounts that no backend maps, e.g. aws:authenticated")
+	viper.BindPFlag("server.unmappedGroups", serverCmd.Flags().Lookup("unmapped-groups"))
+
+	serverCmd.Flags().Int("circuit-breaker-failure-threshold",
+		0,
+		"Number of consecutive errors from a backend after which it is skipped until --circuit-breaker-open-duration has passed. 0 disables circuit breaking.")
+	viper.BindPFlag("server.circuitBreakerFailureThreshold", serverCmd.Flags().Lookup("circuit-breaker-failure-threshold"))
+
+	serverCmd.Flags().Duration("circuit-breaker-open-duration",
+		DefaultCircuitBreakerOpenDuration,
+		"How long a backend with an open circuit breaker is skipped before it is probed again.")
+	viper.BindPFlag("server.circuitBreakerOpenDuration", serverCmd.Flags().Lookup("circuit-breaker-open-duration"))
+
+	serverCmd.Flags().String("tracing-otlp-endpoint",
+		"",
+		"Base URL of an OTLP/HTTP collector (e.g. http://localhost:4318) to export authentication traces to. Empty disables tracing.")
+	viper.BindPFlag("server.tracingOTLPEndpoint", serverCmd.Flags().Lookup("tracing-otlp-endpoint"))
+	viper.BindEnv("server.tracingOTLPEndpoint", "OTEL_EXPORTER_OTLP_ENDPOINT")
+
+	serverCmd.Flags().Float64("tracing-sample-ratio",
+		1.0,
+		"Fraction of authentication requests to trace when the caller did not send a sampled trace context.")
+	viper.BindPFlag("server.tracingSampleRatio", serverCmd.Flags().Lookup("tracing-sample-ratio"))
+
+	serverCmd.Flags().Int("rate-limit-qps",
+		0,
+		"Maximum authenticate requests per second from all sources combined. Excess requests get 429 Too Many Requests. 0 disables the limit.")
+	viper.BindPFlag("server.rateLimitQps", serverCmd.Flags().Lookup("rate-limit-qps"))
+
+	serverCmd.Flags().Int("rate-limit-burst",
+		0,
+		"Maximum burst of authenticate requests from all sources combined.")
+	viper.BindPFlag("server.rateLimitBurst", serverCmd.Flags().Lookup("rate-limit-burst"))
+
+	serverCmd.Flags().Int("rate-limit-per-source-qps",
+		0,
+		"Maximum authenticate requests per second from a single source IP. 0 disables the limit.")
+	viper.BindPFlag("server.rateLimitPerSourceQps", serverCmd.Flags().Lookup("rate-limit-per-source-qps"))
+
+	serverCmd.Flags().Int("rate-limit-per-source-burst",
+		0,
+		"Maximum burst of authenticate requests from a single source IP.")
+	viper.BindPFlag("server.rateLimitPerSourceBurst", serverCmd.Flags().Lookup("rate-limit-per-source-burst"))
+
+	serverCmd.Flags().Int("max-in-flight-requests",
+		0,
+		"Maximum number of authenticate requests served concurrently. 0 disables the limit.")
+	viper.BindPFlag("server.maxInFlightRequests", serverCmd.Flags().Lookup("max-in-flight-requests"))
+
+	serverCmd.Flags().Int("grpc-port",
+		0,
+		"Port to serve the gRPC authentication API on, with the same address and certificate as the webhook. 0 disables it.")
+	viper.BindPFlag("server.grpcPort", serverCmd.Flags().Lookup("grpc-port"))
+
+	serverCmd.Flags().Bool("disable-keep-alives",
+		false,
+		"Close webhook connections after each request instead of reusing them.")
+	viper.BindPFlag("server.disableKeepAlives", serverCmd.Flags().Lookup("disable-keep-alives"))
+	serverCmd.Flags().Duration("idle-timeout",
+		0,
+		"Close keep-alive connections idle for this long. 0 keeps them open until the client closes them.")
+	viper.BindPFlag("server.idleTimeout", serverCmd.Flags().Lookup("idle-timeout"))
+	serverCmd.Flags().Bool("disable-http2",
+		false,
+		"Serve the webhook over HTTP/1.1 only, instead of letting API servers multiplex TokenReviews over HTTP/2 connections.")
+	viper.BindPFlag("server.disableHTTP2", serverCmd.Flags().Lookup("disable-http2"))
+	serverCmd.Flags().Int("http2-max-concurrent-streams",
+		250,
+		"Maximum number of requests a client may send at once over one HTTP/2 connection to the webhook or gRPC listener.")
+	viper.BindPFlag("server.http2MaxConcurrentStreams", serverCmd.Flags().Lookup("http2-max-concurrent-streams"))
+
+	serverCmd.Flags().Int("metrics-port",
+		0,
+		"Port to serve /metrics on instead of the webhook port. 0 serves metrics on the webhook port.")
+	viper.BindPFlag("server.metricsPort", serverCmd.Flags().Lookup("metrics-port"))
+	serverCmd.Flags().String("metrics-address",
+		"",
+		"Address to bind the metrics listener of --metrics-port to. Empty listens on all interfaces.")
+	viper.BindPFlag("server.metricsAddress", serverCmd.Flags().Lookup("metrics-address"))
+	serverCmd.Flags().String("metrics-tls-cert-file",
+		"",
+		"Serve the metrics listener over TLS with the certificate in this `file`. Requires --metrics-tls-key-file.")
+	viper.BindPFlag("server.metricsTLSCertFile", serverCmd.Flags().Lookup("metrics-tls-cert-file"))
+	serverCmd.Flags().String("metrics-tls-key-file",
+		"",
+		"Key `file` of --metrics-tls-cert-file.")
+	viper.BindPFlag("server.metricsTLSKeyFile", serverCmd.Flags().Lookup("metrics-tls-key-file"))
+	serverCmd.Flags().String("metrics-bearer-token-file",
+		"",
+		"Require scrapers of the metrics listener to send the bearer token in this `file`.")
+	viper.BindPFlag("server.metricsBearerTokenFile", serverCmd.Flags().Lookup("metrics-bearer-token-file"))
+
+	serverCmd.Flags().String("mappings-token-file",
+		"",
+		"Serve the merged mappings of all backends at /mappings to callers sending the bearer token in this `file`. Empty disables the endpoint.")
+	viper.BindPFlag("server.mappingsTokenFile", serverCmd.Flags().Lookup("mappings-token-file"))
+
+	serverCmd.Flags().Int("debug-port",
+		0,
+		"Port on localhost to serve pprof profiles, expvar variables and the loaded mappings on, under /debug/. 0 disables it.")
+	viper.BindPFlag("server.debugPort", serverCmd.Flags().Lookup("debug-port"))
+
+	serverCmd.Flags().Bool("identity-extras",
+		true,
+		"Add the caller's AWS ARN, canonical ARN, account ID, session name and access key ID to the user extras. Mappings can override it with identityExtras.")
+	viper.BindPFlag("server.identityExtras", serverCmd.Flags().Lookup("identity-extras"))
+
+	serverCmd.Flags().String("iam-groups-role-arn",
+		"",
+		"IAM role to assume before calling iam:ListGroupsForUser for user mappings with lookupIAMGroups")
+	viper.BindPFlag("server.iamGroupsRoleARN", serverCmd.Flags().Lookup("iam-groups-role-arn"))
+
+	serverCmd.Flags().Duration("iam-groups-cache-ttl",
+		5*time.Minute,
+		"How long the IAM groups of a user with lookupIAMGroups are cached")
+	viper.BindPFlag("server.iamGroupsCacheTTL", serverCmd.Flags().Lookup("iam-groups-cache-ttl"))
+
+	serverCmd.Flags().Bool("role-info-extra-description",
+		false,
+		"Add the description of the IAM role of role sessions to the user extras, from iam:GetRole")
+	viper.BindPFlag("server.roleInfoExtraDescription", serverCmd.Flags().Lookup("role-info-extra-description"))
+	serverCmd.Flags().StringSlice("role-info-extra-tags",
+		nil,
+		"Keys of the tags of the IAM role of role sessions to add to the user extras, from iam:GetRole")
+	viper.BindPFlag("server.roleInfoExtraTags", serverCmd.Flags().Lookup("role-info-extra-tags"))
+	serverCmd.Flags().String("role-info-role-arn",
+		"",
+		"IAM role to assume before calling iam:GetRole for the role description and tags extras")
+	viper.BindPFlag("server.roleInfoRoleARN", serverCmd.Flags().Lookup("role-info-role-arn"))
+	serverCmd.Flags().Duration("role-info-cache-ttl",
+		10*time.Minute,
+		"How long the description and tags of a role, or the failure to get them, are cached")
+	viper.BindPFlag("server.roleInfoCacheTTL", serverCmd.Flags().Lookup("role-info-cache-ttl"))
+
+	serverCmd.Flags().String("post-mapping-hook-url",
+		"",
+		"URL of a webhook POSTed every mapped identity, which may add or remove groups or deny it")
+	viper.BindPFlag("server.postMappingHookURL", serverCmd.Flags().Lookup("post-mapping-hook-url"))
+	serverCmd.Flags().String("post-mapping-hook-ca-bundle",
+		"",
+		"PEM file of CAs the post-mapping hook is trusted with besides the system ones")
+	viper.BindPFlag("server.postMappingHookCABundle", serverCmd.Flags().Lookup("post-mapping-hook-ca-bundle"))
+	serverCmd.Flags().Duration("post-mapping-hook-timeout",
+		2*time.Second,
+		"Timeout of each call to the post-mapping hook")
+	viper.BindPFlag("server.postMappingHookTimeout", serverCmd.Flags().Lookup("post-mapping-hook-timeout"))
+	serverCmd.Flags().String("post-mapping-hook-failure-policy",
+		server.HookFailureDeny,
+		fmt.Sprintf("What to do with identities when the post-mapping hook fails or times out. One of: %s", strings.Join(server.HookFailurePolicies, ",")))
+	viper.BindPFlag("server.postMappingHookFailurePolicy", serverCmd.Flags().Lookup("post-mapping-hook-failure-policy"))
+
+	serverCmd.Flags().String("role-tags-role-arn",
+		"",
+		"IAM role to assume before calling iam:GetRole for the IAMRoleTags backend")
+	viper.BindPFlag("server.roleTagsRoleARN", serverCmd.Flags().Lookup("role-tags-role-arn"))
+
+	serverCmd.Flags().Duration("role-tags-cache-ttl",
+		5*time.Minute,
+		"How long the IAMRoleTags backend caches the mapping of a tagged role")
+	viper.BindPFlag("server.roleTagsCacheTTL", serverCmd.Flags().Lookup("role-tags-cache-ttl"))
+
+	serverCmd.Flags().Duration("role-tags-negative-cache-ttl",
+		time.Minute,
+		"How long the IAMRoleTags backend caches that a role doesn't exist or isn't tagged")
+	viper.BindPFlag("server.roleTagsNegativeCacheTTL", serverCmd.Flags().Lookup("role-tags-negative-cache-ttl"))
+
+	serverCmd.Flags().StringSlice("role-tags-allowed-groups",
+		nil,
+		"The only groups the tags of a role may grant with the IAMRoleTags backend. By default any group but system: ones may be granted.")
+	viper.BindPFlag("server.roleTagsAllowedGroups", serverCmd.Flags().Lookup("role-tags-allowed-groups"))
+
+	serverCmd.Flags().String("eks-access-entries-cluster",
+		"",
+		"Name of the EKS cluster whose access entries the EKSAccessEntries backend maps")
+	viper.BindPFlag("server.eksAccessEntriesCluster", serverCmd.Flags().Lookup("eks-access-entries-cluster"))
+
+	serverCmd.Flags().String("eks-access-entries-region",
+		"",
+		"Region of --eks-access-entries-cluster. Defaults to the region of the AWS SDK configuration, e.g. AWS_REGION.")
+	viper.BindPFlag("server.eksAccessEntriesRegion", serverCmd.Flags().Lookup("eks-access-entries-region"))
+
+	serverCmd.Flags().String("eks-access-entries-role-arn",
+		"",
+		"IAM role to assume before calling eks:ListAccessEntries and eks:DescribeAccessEntry for the EKSAccessEntries backend")
+	viper.BindPFlag("server.eksAccessEntriesRoleARN", serverCmd.Flags().Lookup("eks-access-entries-role-arn"))
+
+	serverCmd.Flags().Duration("eks-access-entries-refresh-interval",
+		DefaultEKSAccessEntriesRefreshInterval,
+		"How often the EKSAccessEntries backend lists the access entries again. 0 loads them only on startup.")
+	viper.BindPFlag("server.eksAccessEntriesRefreshInterval", serverCmd.Flags().Lookup("eks-access-entries-refresh-interval"))
+
+	serverCmd.Flags().String("eks-access-entries-queue-url",
+		"",
+		"URL of an SQS queue of change notifications on which the EKSAccessEntries backend lists the access entries again. "+
+			"The queue must be in the region of --eks-access-entries-cluster.")
+	viper.BindPFlag("server.eksAccessEntriesQueueURL", serverCmd.Flags().Lookup("eks-access-entries-queue-url"))
+
+	serverCmd.Flags().Bool("validate-audiences",
+		false,
+		"Require the cluster ID a token was signed for to be one of the audiences of TokenReviews that request audiences (apiserver --api-audiences).")
+	viper.BindPFlag("server.validateAudiences", serverCmd.Flags().Lookup("validate-audiences"))
+
+	serverCmd.Flags().Bool("replay-detection",
+		false,
+		"Record verified tokens until they expire, to reject replays as --replay-max-uses and --replay-bind-source say.")
+	viper.BindPFlag("server.replayDetection", serverCmd.Flags().Lookup("replay-detection"))
+	serverCmd.Flags().Int("replay-max-uses",
+		0,
+		"With --replay-detection, reject tokens after this many uses. 0 allows unlimited uses.")
+	viper.BindPFlag("server.replayMaxUses", serverCmd.Flags().Lookup("replay-max-uses"))
+	serverCmd.Flags().Bool("replay-bind-source",
+		false,
+		"With --replay-detection, reject tokens presented again from a different client IP than their first use. Without --client-ip-header the client is the API server, so do not enable this with several API servers behind a load balancer: a token reused against another API server would be rejected.")
+	viper.BindPFlag("server.replayBindSource", serverCmd.Flags().Lookup("replay-bind-source"))
+
+	serverCmd.Flags().String("shared-cache-url",
+		"",
+		"Redis (redis://, rediss://) or memcached (memcached://) server to share the STS cache and replay detection between replicas through. Set a URL with a password in the configuration file rather than on the command line.")
+	viper.BindPFlag("server.sharedCacheURL", serverCmd.Flags().Lookup("shared-cache-url"))
+
+	serverCmd.Flags().Duration("shared-cache-timeout",
+		sharedcache.DefaultTimeout,
+		"Timeout of each request to the shared cache. The local caches are used when it fails.")
+	viper.BindPFlag("server.sharedCacheTimeout", serverCmd.Flags().Lookup("shared-cache-timeout"))
+
+	serverCmd.Flags().Bool("aws-auth-validation-webhook",
+		false,
+		"Serve a validating admission webhook at /validate-aws-auth that rejects aws-auth ConfigMap edits with invalid mappings.")
+	viper.BindPFlag("server.awsAuthValidationWebhook", serverCmd.Flags().Lookup("aws-auth-validation-webhook"))
+
+	serverCmd.Flags().Bool("bootstrap-writer",
+		false,
+		"Add the server.bootstrapMapRoles mappings of the configuration to the aws-auth ConfigMap when their roles aren't mapped there yet. The replicas elect a single writer with a lock ConfigMap in kube-system.")
+	viper.BindPFlag("server.bootstrapWriter", serverCmd.Flags().Lookup("bootstrap-writer"))
+
+	serverCmd.Flags().Duration("bootstrap-writer-interval",
+		DefaultBootstrapWriterInterval,
+		"How often the bootstrap writer checks aws-auth for missing mappings.")
+	viper.BindPFlag("server.bootstrapWriterInterval", serverCmd.Flags().Lookup("bootstrap-writer-interval"))
+
+	serverCmd.Flags().StringSlice("node-role-auto-scaling-groups",
+		nil,
+		"Auto Scaling groups whose instance roles the bootstrap writer adds to aws-auth as node mappings. Names can contain * wildcards.")
+	viper.BindPFlag("server.nodeRoleAutoScalingGroups", serverCmd.Flags().Lookup("node-role-auto-scaling-groups"))
+
+	serverCmd.Flags().StringSlice("node-role-instance-tags",
+		nil,
+		"Tags (key=value, or key for any value) of the EC2 instances whose roles the bootstrap writer adds to aws-auth as node mappings. Instances must have all of them.")
+	viper.BindPFlag("server.nodeRoleInstanceTags", serverCmd.Flags().Lookup("node-role-instance-tags"))
+
+	serverCmd.Flags().String("node-role-discovery-role-arn",
+		"",
+		"IAM role to assume before calling ec2:DescribeInstances and iam:GetInstanceProfile to discover node roles")
+	viper.BindPFlag("server.nodeRoleDiscoveryRoleARN", serverCmd.Flags().Lookup("node-role-discovery-role-arn"))
+
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	_ = fs.Parse([]string{})
 	flag.CommandLine = fs
@@ -0,0 +1,122 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"k8s.io/sample-controller/pkg/signals"
+)
+
+// serviceName is the name of the Windows service and of its event log
+// source.
+const serviceName = "aws-iam-authenticator"
+
+// runService runs run as a Windows service when started by the service
+// control manager, logging to the event log and stopping when the service
+// is stopped or the host shuts down. In an interactive session it runs run
+// until the process is signaled to stop.
+func runService(run func(stopCh <-chan struct{})) {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		logrus.Fatalf("could not determine whether running as a Windows service: %v", err)
+	}
+	if interactive {
+		run(signals.SetupSignalHandler())
+		return
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		logrus.WithError(err).Warn("Could not open the event log, only logging to stderr")
+	} else {
+		defer elog.Close()
+		logrus.AddHook(&eventLogHook{elog: elog})
+	}
+	if err := svc.Run(serviceName, &service{run: run}); err != nil {
+		logrus.Fatalf("service %s failed: %v", serviceName, err)
+	}
+}
+
+// service is the svc.Handler running the server.
+type service struct {
+	run func(stopCh <-chan struct{})
+}
+
+// Execute runs the server until the service control manager stops the
+// service, giving it the shutdown grace period to drain requests.
+func (s *service) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(stopCh)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stopCh)
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// eventLogHook writes log entries to the Windows event log.
+type eventLogHook struct {
+	elog *eventlog.Log
+}
+
+// eventID is the ID of all the events logged; they are told apart by their
+// message.
+const eventID = 1
+
+func (h *eventLogHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel}
+}
+
+func (h *eventLogHook) Fire(entry *logrus.Entry) error {
+	msg, err := entry.String()
+	if err != nil {
+		return fmt.Errorf("could not format the entry for the event log: %v", err)
+	}
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return h.elog.Error(eventID, msg)
+	case logrus.WarnLevel:
+		return h.elog.Warning(eventID, msg)
+	default:
+		return h.elog.Info(eventID, msg)
+	}
+}
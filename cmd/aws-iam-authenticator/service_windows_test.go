@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// executeService runs Execute of a service running run, returning the
+// channels of the change requests and of the statuses it reports and the
+// channel receiving its exit code.
+func executeService(run func(stopCh <-chan struct{})) (chan svc.ChangeRequest, chan svc.Status, chan uint32) {
+	requests := make(chan svc.ChangeRequest)
+	status := make(chan svc.Status, 10)
+	exitCode := make(chan uint32, 1)
+	go func() {
+		_, code := (&service{run: run}).Execute(nil, requests, status)
+		exitCode <- code
+	}()
+	return requests, status, exitCode
+}
+
+func expectState(t *testing.T, status chan svc.Status, want svc.State) svc.Status {
+	select {
+	case s := <-status:
+		if s.State != want {
+			t.Fatalf("expected state %d, got %d", want, s.State)
+		}
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for state %d", want)
+	}
+	return svc.Status{}
+}
+
+func TestServiceStop(t *testing.T) {
+	for _, cmd := range []svc.Cmd{svc.Stop, svc.Shutdown} {
+		stopped := make(chan struct{})
+		requests, status, exitCode := executeService(func(stopCh <-chan struct{}) {
+			<-stopCh
+			close(stopped)
+		})
+		expectState(t, status, svc.StartPending)
+		running := expectState(t, status, svc.Running)
+		if running.Accepts != svc.AcceptStop|svc.AcceptShutdown {
+			t.Errorf("expected the service to accept stop and shutdown, got %d", running.Accepts)
+		}
+
+		requests <- svc.ChangeRequest{Cmd: svc.Interrogate, CurrentStatus: running}
+		expectState(t, status, svc.Running)
+
+		requests <- svc.ChangeRequest{Cmd: cmd}
+		expectState(t, status, svc.StopPending)
+		select {
+		case code := <-exitCode:
+			if code != 0 {
+				t.Errorf("expected exit code 0, got %d", code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the service to stop")
+		}
+		select {
+		case <-stopped:
+		default:
+			t.Errorf("expected the server to be stopped before Execute returns on %d", cmd)
+		}
+	}
+}
+
+func TestServiceRunReturns(t *testing.T) {
+	_, status, exitCode := executeService(func(<-chan struct{}) {})
+	expectState(t, status, svc.StartPending)
+	select {
+	case <-exitCode:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the service to stop once the server returned")
+	}
+}
@@ -0,0 +1,467 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
+	crdclientset "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/clientset/versioned"
+)
+
+const (
+	crdGroupVersion = "iamauthenticator.k8s.aws/v1alpha1"
+	crdPath         = "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Interactively configure the server for a cluster",
+	Long: `Walks through choosing the mapping backends, generating the certificate
+and webhook kubeconfig, installing the IAMIdentityMapping CRD and writing an
+example mapping for the current AWS identity. Each step is checked against the
+cluster in the current kubeconfig context and the AWS account of the current
+credentials.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		w := &setupWizard{
+			in:  bufio.NewReader(os.Stdin),
+			out: os.Stdout,
+		}
+		if err := w.run(); err != nil {
+			fmt.Fprintf(os.Stderr, "setup failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// setupWizard holds the answers collected by the setup command.
+type setupWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	outputDir    string
+	clusterID    string
+	callerARN    string
+	canonicalARN string
+	modes        []string
+	eksCluster   string
+	restConfig   *rest.Config
+	clientset    kubernetes.Interface
+	cfg          config.Config
+	username     string
+	groups       []string
+}
+
+func (w *setupWizard) run() error {
+	w.outputDir = viper.GetString("setup.outputDir")
+	if err := os.MkdirAll(w.outputDir, 0755); err != nil {
+		return err
+	}
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"AWS credentials", w.checkAWS},
+		{"Kubernetes cluster", w.checkCluster},
+		{"Backend mode", w.chooseBackends},
+		{"Certificate and webhook kubeconfig", w.generateFiles},
+		{"IAMIdentityMapping CRD", w.installCRD},
+		{"Example mapping", w.writeMappings},
+	}
+	for i, step := range steps {
+		fmt.Fprintf(w.out, "\n[%d/%d] %s\n", i+1, len(steps), step.name)
+		if err := step.run(); err != nil {
+			return fmt.Errorf("%s: %v", step.name, err)
+		}
+	}
+	fmt.Fprintf(w.out, "\nSetup complete. Start the server with:\n\n  aws-iam-authenticator server --config %s\n\n",
+		filepath.Join(w.outputDir, "config.yaml"))
+	fmt.Fprintf(w.out, "and configure your API server with `--authentication-token-webhook-config-file=%s`.\n", w.cfg.GenerateKubeconfigPath)
+	return nil
+}
+
+// ask prompts for a value, returning def if the answer is empty or stdin is
+// closed.
+func (w *setupWizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	// a read error (such as EOF) leaves whatever was read before it
+	answer, _ := w.in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
+
+func (w *setupWizard) confirm(question string, def bool) bool {
+	defAnswer := "y/N"
+	if def {
+		defAnswer = "Y/n"
+	}
+	switch strings.ToLower(w.ask(question+" ("+defAnswer+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+func (w *setupWizard) ok(format string, args ...interface{}) {
+	fmt.Fprintf(w.out, "  ok: "+format+"\n", args...)
+}
+
+func (w *setupWizard) checkAWS() error {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create AWS session: %v", err)
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("could not call sts:GetCallerIdentity, check your AWS credentials: %v", err)
+	}
+	w.callerARN = *identity.Arn
+	w.canonicalARN, err = arn.Canonicalize(w.callerARN)
+	if err != nil {
+		return err
+	}
+	w.ok("authenticated to account %s as %s", *identity.Account, w.callerARN)
+
+	w.clusterID = w.ask("Cluster ID (tokens are only accepted for this ID)", viper.GetString("clusterID"))
+	if w.clusterID == "" {
+		return fmt.Errorf("a cluster ID is required")
+	}
+	return nil
+}
+
+func (w *setupWizard) checkCluster() error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = viper.GetString("setup.kubeconfig")
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("could not load kubeconfig: %v", err)
+	}
+	restConfig.Timeout = 30 * time.Second
+	w.restConfig = restConfig
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	w.clientset = clientset
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("could not reach the API server at %s: %v", restConfig.Host, err)
+	}
+	w.ok("connected to %s (Kubernetes %s)", restConfig.Host, version.GitVersion)
+	return nil
+}
+
+func (w *setupWizard) chooseBackends() error {
+	fmt.Fprintf(w.out, "  Backends are searched in order, the first mapping found wins:\n")
+	fmt.Fprintf(w.out, "    %s: mappings in the server configuration file\n", mapper.ModeMountedFile)
+	namespace, name := configmap.Location(w.cfg)
+	fmt.Fprintf(w.out, "    %s: mappings in the %s/%s ConfigMap\n", mapper.ModeEKSConfigMap, namespace, name)
+	fmt.Fprintf(w.out, "    %s: IAMIdentityMapping custom resources\n", mapper.ModeCRD)
+	fmt.Fprintf(w.out, "    %s: tags of the IAM roles themselves\n", mapper.ModeIAMRoleTags)
+	fmt.Fprintf(w.out, "    %s: access entries of an EKS cluster\n", mapper.ModeEKSAccessEntries)
+	for {
+		answer := w.ask("Backend mode (comma-separated)", mapper.ModeMountedFile)
+		modes := strings.Split(answer, ",")
+		for i := range modes {
+			modes[i] = strings.TrimSpace(modes[i])
+		}
+		if errs := mapper.ValidateBackendMode(modes); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(w.out, "  %v\n", err)
+			}
+			continue
+		}
+		w.modes = modes
+		w.ok("using %s", strings.Join(modes, ","))
+		if w.usesMode(mapper.ModeEKSAccessEntries) {
+			if w.eksCluster = w.ask("EKS cluster whose access entries are mapped", ""); w.eksCluster == "" {
+				return fmt.Errorf("the %s backend needs an EKS cluster", mapper.ModeEKSAccessEntries)
+			}
+		}
+		return nil
+	}
+}
+
+func (w *setupWizard) generateFiles() error {
+	w.cfg = config.Config{
+		ClusterID:              w.clusterID,
+		Hostname:               w.ask("Hostname the API server uses to reach the authenticator", "localhost"),
+		Address:                w.ask("Address to listen on", "127.0.0.1"),
+		HostPort:               DefaultPort,
+		StateDir:               w.outputDir,
+		GenerateKubeconfigPath: filepath.Join(w.outputDir, "aws-iam-authenticator.kubeconfig"),
+	}
+	if err := w.cfg.GenerateFiles(); err != nil {
+		return err
+	}
+	// make sure what was written can be loaded back by the server
+	cert, err := w.cfg.LoadExistingCertificate()
+	if err != nil || cert == nil {
+		return fmt.Errorf("generated certificate could not be loaded: %v", err)
+	}
+	if _, err := clientcmd.LoadFromFile(w.cfg.GenerateKubeconfigPath); err != nil {
+		return fmt.Errorf("generated webhook kubeconfig is invalid: %v", err)
+	}
+	w.ok("wrote %s, %s and %s", w.cfg.CertPath(), w.cfg.KeyPath(), w.cfg.GenerateKubeconfigPath)
+	fmt.Fprintf(w.out, "  Copy them to the state directory and webhook kubeconfig path on your control plane nodes.\n")
+	return nil
+}
+
+func (w *setupWizard) usesMode(mode string) bool {
+	for _, m := range w.modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *setupWizard) crdInstalled() bool {
+	_, err := w.clientset.Discovery().ServerResourcesForGroupVersion(crdGroupVersion)
+	return err == nil
+}
+
+func (w *setupWizard) installCRD() error {
+	if !w.usesMode(mapper.ModeCRD) {
+		fmt.Fprintf(w.out, "  skipped, the %s backend is not used\n", mapper.ModeCRD)
+		return nil
+	}
+	if w.crdInstalled() {
+		w.ok("already installed")
+		return nil
+	}
+	manifest := w.ask("Path of the CRD manifest", "deploy/iamidentitymapping.yaml")
+	if !w.confirm("Install the CRD into the cluster?", true) {
+		fmt.Fprintf(w.out, "  skipped, install it with `kubectl apply -f %s`\n", manifest)
+		return nil
+	}
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+	body, err := utilyaml.ToJSON(data)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %v", manifest, err)
+	}
+	err = w.clientset.Discovery().RESTClient().Post().
+		AbsPath(crdPath).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do().
+		Error()
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("could not create the CRD: %v", err)
+	}
+	// the API group only shows up in discovery once the CRD is established
+	for i := 0; i < 30 && !w.crdInstalled(); i++ {
+		time.Sleep(time.Second)
+	}
+	if !w.crdInstalled() {
+		return fmt.Errorf("the CRD was created but %s is not being served", crdGroupVersion)
+	}
+	w.ok("installed and serving %s", crdGroupVersion)
+	return nil
+}
+
+func (w *setupWizard) writeMappings() error {
+	fmt.Fprintf(w.out, "  Map your current identity, %s, so you keep access to the cluster.\n", w.canonicalARN)
+	w.username = w.ask("Kubernetes username", "admin")
+	w.groups = strings.Split(w.ask("Kubernetes groups (comma-separated)", "system:masters"), ",")
+	for i := range w.groups {
+		w.groups[i] = strings.TrimSpace(w.groups[i])
+	}
+
+	if err := w.writeServerConfig(); err != nil {
+		return err
+	}
+	if w.usesMode(mapper.ModeEKSConfigMap) {
+		if err := w.applyConfigMapMapping(); err != nil {
+			return err
+		}
+	}
+	if w.usesMode(mapper.ModeCRD) {
+		if err := w.applyCRDMapping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *setupWizard) isRole() bool {
+	return strings.Contains(w.canonicalARN, ":role/")
+}
+
+// writeServerConfig writes the server configuration file, including the
+// example mapping for the MountedFile backend.
+func (w *setupWizard) writeServerConfig() error {
+	server := map[string]interface{}{
+		"backendMode":        w.modes,
+		"hostname":           w.cfg.Hostname,
+		"address":            w.cfg.Address,
+		"port":               w.cfg.HostPort,
+		"stateDir":           "/var/aws-iam-authenticator",
+		"generateKubeconfig": "/etc/kubernetes/aws-iam-authenticator/kubeconfig.yaml",
+	}
+	if w.eksCluster != "" {
+		server["eksAccessEntriesCluster"] = w.eksCluster
+	}
+	if w.usesMode(mapper.ModeMountedFile) {
+		if w.isRole() {
+			server["mapRoles"] = []map[string]interface{}{{"roleARN": w.canonicalARN, "username": w.username, "groups": w.groups}}
+		} else {
+			server["mapUsers"] = []map[string]interface{}{{"userARN": w.canonicalARN, "username": w.username, "groups": w.groups}}
+		}
+	}
+	data, err := yaml.Marshal(map[string]interface{}{
+		"clusterID": w.clusterID,
+		"server":    server,
+	})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(w.outputDir, "config.yaml")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	w.ok("wrote %s", path)
+	return nil
+}
+
+func (w *setupWizard) applyConfigMapMapping() error {
+	key, arnKey := "mapUsers", "userarn"
+	if w.isRole() {
+		key, arnKey = "mapRoles", "rolearn"
+	}
+	entries, err := yaml.Marshal([]map[string]interface{}{{arnKey: w.canonicalARN, "username": w.username, "groups": w.groups}})
+	if err != nil {
+		return err
+	}
+	awsAuthNS, awsAuthName := configmap.Location(w.cfg)
+	configMaps := w.clientset.CoreV1().ConfigMaps(awsAuthNS)
+	if _, err := configMaps.Get(awsAuthName, metav1.GetOptions{}); err == nil {
+		fmt.Fprintf(w.out, "  %s/%s already exists, add this to its %s to map your identity:\n\n%s\n", awsAuthNS, awsAuthName, key, entries)
+		return nil
+	} else if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("could not read %s/%s: %v", awsAuthNS, awsAuthName, err)
+	}
+	if !w.confirm(fmt.Sprintf("Create %s/%s with this mapping?", awsAuthNS, awsAuthName), true) {
+		return nil
+	}
+	_, err = configMaps.Create(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: awsAuthNS, Name: awsAuthName},
+		Data:       map[string]string{key: string(entries)},
+	})
+	if err != nil {
+		return fmt.Errorf("could not create %s/%s: %v", awsAuthNS, awsAuthName, err)
+	}
+	w.ok("created %s/%s", awsAuthNS, awsAuthName)
+	return nil
+}
+
+func (w *setupWizard) applyCRDMapping() error {
+	if !w.crdInstalled() {
+		fmt.Fprintf(w.out, "  skipped the IAMIdentityMapping, the CRD is not installed\n")
+		return nil
+	}
+	if !w.confirm("Create an IAMIdentityMapping for this mapping?", true) {
+		return nil
+	}
+	clientset, err := crdclientset.NewForConfig(w.restConfig)
+	if err != nil {
+		return err
+	}
+	_, err = clientset.IamauthenticatorV1alpha1().IAMIdentityMappings().Create(&iamauthenticatorv1alpha1.IAMIdentityMapping{
+		ObjectMeta: metav1.ObjectMeta{Name: objectName(w.username)},
+		Spec: iamauthenticatorv1alpha1.IAMIdentityMappingSpec{
+			ARN:      w.canonicalARN,
+			Username: w.username,
+			Groups:   w.groups,
+		},
+	})
+	if k8serrors.IsAlreadyExists(err) {
+		w.ok("IAMIdentityMapping %q already exists", objectName(w.username))
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not create the IAMIdentityMapping: %v", err)
+	}
+	w.ok("created IAMIdentityMapping %q", objectName(w.username))
+	return nil
+}
+
+// objectName turns a username such as "admin:{{SessionName}}" into a valid
+// object name.
+func objectName(username string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, username)
+	return strings.Trim(name, "-.")
+}
+
+func init() {
+	setupCmd.Flags().String("output-dir",
+		"aws-iam-authenticator-setup",
+		"`Directory` to write the certificate, key, webhook kubeconfig and server configuration to.")
+	viper.BindPFlag("setup.outputDir", setupCmd.Flags().Lookup("output-dir"))
+
+	setupCmd.Flags().String("kubeconfig",
+		"",
+		"kubeconfig file of the cluster to set up. Defaults to the current context.")
+	viper.BindPFlag("setup.kubeconfig", setupCmd.Flags().Lookup("kubeconfig"))
+
+	rootCmd.AddCommand(setupCmd)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+func newTestWizard(input string) (*setupWizard, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &setupWizard{in: bufio.NewReader(strings.NewReader(input)), out: out}, out
+}
+
+func TestSetupAsk(t *testing.T) {
+	w, out := newTestWizard("answer\n\n")
+	if got := w.ask("Question", "default"); got != "answer" {
+		t.Errorf("ask = %q, want answer", got)
+	}
+	if got := w.ask("Question", "default"); got != "default" {
+		t.Errorf("ask of an empty answer = %q, want default", got)
+	}
+	// stdin is closed
+	if got := w.ask("Question", "default"); got != "default" {
+		t.Errorf("ask at EOF = %q, want default", got)
+	}
+	if !strings.Contains(out.String(), "Question [default]: ") {
+		t.Errorf("expected the default in the prompt, got %q", out.String())
+	}
+}
+
+func TestSetupConfirm(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		def   bool
+		want  bool
+	}{
+		{"y\n", false, true},
+		{"YES\n", false, true},
+		{"n\n", true, false},
+		{"no\n", true, false},
+		{"\n", true, true},
+		{"\n", false, false},
+		{"maybe\n", true, true},
+		{"", false, false},
+	} {
+		w, _ := newTestWizard(c.input)
+		if got := w.confirm("Continue?", c.def); got != c.want {
+			t.Errorf("confirm(%q, %v) = %v, want %v", c.input, c.def, got, c.want)
+		}
+	}
+}
+
+func TestSetupChooseBackends(t *testing.T) {
+	w, out := newTestWizard("Unknown\n" + mapper.ModeMountedFile + ", " + mapper.ModeEKSAccessEntries + "\nmy-cluster\n")
+	if err := w.chooseBackends(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{mapper.ModeMountedFile, mapper.ModeEKSAccessEntries}; !reflect.DeepEqual(w.modes, want) {
+		t.Errorf("modes = %v, want %v", w.modes, want)
+	}
+	if w.eksCluster != "my-cluster" {
+		t.Errorf("eksCluster = %q, want my-cluster", w.eksCluster)
+	}
+	if !strings.Contains(out.String(), "Unknown") {
+		t.Errorf("expected the invalid mode to be reported, got %q", out.String())
+	}
+
+	w, _ = newTestWizard(mapper.ModeEKSAccessEntries + "\n\n")
+	if err := w.chooseBackends(); err == nil {
+		t.Error("expected an error without an EKS cluster")
+	}
+}
+
+func TestSetupWriteServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "setup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		canonicalARN string
+		key          string
+		arnKey       string
+	}{
+		{"arn:aws:iam::123456789012:role/Admin", "mapRoles", "roleARN"},
+		{"arn:aws:iam::123456789012:user/alice", "mapUsers", "userARN"},
+	} {
+		w, _ := newTestWizard("")
+		w.outputDir = dir
+		w.clusterID = "cluster"
+		w.canonicalARN = c.canonicalARN
+		w.modes = []string{mapper.ModeMountedFile}
+		w.username = "admin"
+		w.groups = []string{"system:masters"}
+		w.cfg.Hostname = "localhost"
+		if err := w.writeServerConfig(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "config.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var written map[string]interface{}
+		if err := yaml.Unmarshal(data, &written); err != nil {
+			t.Fatal(err)
+		}
+		if written["clusterID"] != "cluster" {
+			t.Errorf("clusterID = %v, want cluster", written["clusterID"])
+		}
+		if !strings.Contains(string(data), c.key+":") || !strings.Contains(string(data), c.arnKey+": "+c.canonicalARN) {
+			t.Errorf("expected a %s mapping of %s, got:\n%s", c.key, c.canonicalARN, data)
+		}
+	}
+}
+
+func TestSetupApplyConfigMapMapping(t *testing.T) {
+	w, out := newTestWizard("y\n")
+	w.clientset = fake.NewSimpleClientset()
+	w.canonicalARN = "arn:aws:iam::123456789012:role/Admin"
+	w.username = "admin"
+	w.groups = []string{"system:masters"}
+	if err := w.applyConfigMapMapping(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := w.clientset.CoreV1().ConfigMaps("kube-system").Get("aws-auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cm.Data["mapRoles"], "rolearn: "+w.canonicalARN) {
+		t.Errorf("expected the mapping in mapRoles, got %v", cm.Data)
+	}
+
+	// an existing ConfigMap is left alone
+	w, out = newTestWizard("")
+	w.clientset = fake.NewSimpleClientset(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "aws-auth"},
+	})
+	w.canonicalARN = "arn:aws:iam::123456789012:user/alice"
+	w.username = "alice"
+	if err := w.applyConfigMapMapping(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "already exists, add this to its mapUsers") {
+		t.Errorf("expected the mapping to be printed, got %q", out.String())
+	}
+	cm, err = w.clientset.CoreV1().ConfigMaps("kube-system").Get("aws-auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 0 {
+		t.Errorf("expected the existing ConfigMap to be unchanged, got %v", cm.Data)
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	for username, want := range map[string]string{
+		"admin":                  "admin",
+		"Admin":                  "admin",
+		"admin:{{SessionName}}":  "admin---sessionname",
+		"{{AccountID}}.dev":      "accountid--.dev",
+		"system:node:{{EC2...}}": "system-node---ec2",
+	} {
+		if got := objectName(username); got != want {
+			t.Errorf("objectName(%q) = %q, want %q", username, got, want)
+		}
+	}
+}
@@ -17,13 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"time"
 
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
 )
 
 var tokenCmd = &cobra.Command{
@@ -32,6 +37,7 @@ var tokenCmd = &cobra.Command{
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
 		region := viper.GetString("region")
+		stsRegionFromProfile := viper.GetBool("stsRegionFromProfile")
 		roleARN := viper.GetString("role")
 		externalID := viper.GetString("externalID")
 		clusterID := viper.GetString("clusterID")
@@ -39,6 +45,15 @@ var tokenCmd = &cobra.Command{
 		forwardSessionName := viper.GetBool("forwardSessionName")
 		sessionName := viper.GetString("sessionName")
 		cache := viper.GetBool("cache")
+		cacheBackend := viper.GetString("cacheBackend")
+		expiration := viper.GetDuration("tokenExpiration")
+		refreshBefore := viper.GetDuration("refreshBefore")
+		stsEndpoint := viper.GetString("stsEndpoint")
+		format := viper.GetString("tokenFormat")
+		bindSourceIP := viper.GetString("bindSourceIP")
+		allProfiles := viper.GetString("allProfiles")
+		chooseRole := viper.GetBool("chooseRole")
+		clusterIDHeader := viper.GetString("clusterIDHeader")
 
 		if clusterID == "" {
 			fmt.Fprintf(os.Stderr, "Error: cluster ID not specified\n")
@@ -46,12 +61,48 @@ var tokenCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if expiration < token.MinTokenExpiration || expiration > token.MaxTokenExpiration {
+			fmt.Fprintf(os.Stderr, "Error: --token-expiration must be between %s and %s\n", token.MinTokenExpiration, token.MaxTokenExpiration)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if refreshBefore < 0 || refreshBefore > token.MaxRefreshBefore {
+			fmt.Fprintf(os.Stderr, "Error: --refresh-before must be between 0s and %s\n", token.MaxRefreshBefore)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		if err := token.ValidateClusterIDHeader(clusterIDHeader); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		if format == token.TokenFormatV2 && !config.DefaultFeatureGate.Enabled(config.TokenV2) {
+			fmt.Fprintf(os.Stderr, "Error: --token-format=v2 requires the %s feature gate\n", config.TokenV2)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
 		if forwardSessionName && sessionName != "" {
 			fmt.Fprintf(os.Stderr, "Error: cannot specify both --forward-session-name and --session-name parameter\n")
 			cmd.Usage()
 			os.Exit(1)
 		}
 
+		if roleARN == "" && allProfiles == "" {
+			var roles []clientRole
+			if err := unmarshalKey("clientRoles", &roles); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid clientRoles: %v\n", err)
+				os.Exit(1)
+			}
+			var err error
+			if roleARN, err = selectRole(roles, clusterID, chooseRole); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		var tok token.Token
 		var out string
 		var err error
@@ -61,13 +112,35 @@ var tokenCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		tok, err = gen.GetWithOptions(&token.GetTokenOptions{
+		options := token.GetTokenOptions{
 			ClusterID:            clusterID,
 			AssumeRoleARN:        roleARN,
 			AssumeRoleExternalID: externalID,
 			SessionName:          sessionName,
 			Region:               region,
-		})
+			STSRegionFromProfile: stsRegionFromProfile,
+			Expiration:           expiration,
+			RefreshBefore:        refreshBefore,
+			STSEndpoint:          stsEndpoint,
+			Format:               format,
+			BindSourceIP:         bindSourceIP,
+			CacheBackend:         cacheBackend,
+			ClusterIDHeader:      clusterIDHeader,
+		}
+		if allProfiles != "" {
+			if tokenOnly {
+				err = batchTokens(gen, options, allProfiles)
+			} else {
+				err = batchKubeconfig(options, allProfiles, viper.GetString("kubeconfigServer"), viper.GetString("kubeconfigCertificateAuthority"))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		tok, err = gen.GetWithOptions(&options)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not get token: %v\n", err)
 			os.Exit(1)
@@ -81,9 +154,155 @@ var tokenCmd = &cobra.Command{
 	},
 }
 
+// kubeconfig is the kubeconfig file of a cluster with a context per AWS
+// profile.
+type kubeconfig struct {
+	APIVersion string              `yaml:"apiVersion"`
+	Kind       string              `yaml:"kind"`
+	Clusters   []kubeconfigCluster `yaml:"clusters"`
+	Contexts   []kubeconfigContext `yaml:"contexts"`
+	Users      []kubeconfigUser    `yaml:"users"`
+}
+
+type kubeconfigCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	} `yaml:"cluster"`
+}
+
+type kubeconfigContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	} `yaml:"context"`
+}
+
+// kubeconfigUser is the users entry of a kubeconfig file running
+// aws-iam-authenticator with an AWS profile.
+type kubeconfigUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Exec struct {
+			APIVersion string       `yaml:"apiVersion"`
+			Command    string       `yaml:"command"`
+			Args       []string     `yaml:"args"`
+			Env        []execEnvVar `yaml:"env"`
+		} `yaml:"exec"`
+	} `yaml:"user"`
+}
+
+type execEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// batchTokens generates a token for the cluster with every AWS profile
+// matching pattern and prints each profile and its token, reporting the
+// profiles that failed on stderr.
+func batchTokens(gen token.Generator, options token.GetTokenOptions, pattern string) error {
+	profiles, err := matchingProfiles(pattern)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, profile := range profiles {
+		profileOptions := options
+		profileOptions.Profile = profile
+		tok, err := gen.GetWithOptions(&profileOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not get token for profile %s: %v\n", profile, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s\t%s\n", profile, tok.Token)
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not get tokens for %d of %d profiles", failed, len(profiles))
+	}
+	return nil
+}
+
+// batchKubeconfig prints a kubeconfig file for the cluster at server, whose
+// CA certificates are in the caFile if set, with a context and a user running
+// aws-iam-authenticator with each AWS profile matching pattern. No token is
+// generated, the profiles are used when kubectl runs the users.
+func batchKubeconfig(options token.GetTokenOptions, pattern, server, caFile string) error {
+	if server == "" {
+		return fmt.Errorf("--kubeconfig-server is required to print the kubeconfig of --all-profiles")
+	}
+	profiles, err := matchingProfiles(pattern)
+	if err != nil {
+		return err
+	}
+
+	cfg := kubeconfig{APIVersion: "v1", Kind: "Config"}
+	var cluster kubeconfigCluster
+	cluster.Name = options.ClusterID
+	cluster.Cluster.Server = server
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("could not read the certificate authority: %v", err)
+		}
+		cluster.Cluster.CertificateAuthorityData = base64.StdEncoding.EncodeToString(ca)
+	}
+	cfg.Clusters = []kubeconfigCluster{cluster}
+
+	for _, profile := range profiles {
+		name := options.ClusterID + "-" + profile
+
+		var context kubeconfigContext
+		context.Name = name
+		context.Context.Cluster = options.ClusterID
+		context.Context.User = name
+		cfg.Contexts = append(cfg.Contexts, context)
+
+		var user kubeconfigUser
+		user.Name = name
+		user.User.Exec.APIVersion = "client.authentication.k8s.io/v1alpha1"
+		user.User.Exec.Command = "aws-iam-authenticator"
+		user.User.Exec.Args = []string{"token", "-i", options.ClusterID}
+		if options.AssumeRoleARN != "" {
+			user.User.Exec.Args = append(user.User.Exec.Args, "-r", options.AssumeRoleARN)
+		}
+		if options.Region != "" {
+			user.User.Exec.Args = append(user.User.Exec.Args, "--region", options.Region)
+		}
+		user.User.Exec.Env = []execEnvVar{{Name: "AWS_PROFILE", Value: profile}}
+		cfg.Users = append(cfg.Users, user)
+	}
+
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", out)
+	return nil
+}
+
+// matchingProfiles returns the AWS profiles matching pattern, failing if
+// there are none.
+func matchingProfiles(pattern string) ([]string, error) {
+	profiles, err := token.Profiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no AWS profiles match %q", pattern)
+	}
+	return profiles, nil
+}
+
 func init() {
 	rootCmd.AddCommand(tokenCmd)
-	tokenCmd.Flags().String("region", "", "AWS region to use for assume role calls")
+	tokenCmd.Flags().String("region", "", "AWS region whose regional STS endpoint is used for assume role calls and to presign the token")
+	tokenCmd.Flags().Bool("sts-region-from-profile",
+		false,
+		"Presign the token against the regional STS endpoint of the region of the AWS profile or environment instead of the global endpoint, when --region isn't set")
 	tokenCmd.Flags().StringP("role", "r", "", "Assume an IAM Role ARN before signing this token")
 	tokenCmd.Flags().StringP("external-id", "e", "", "External ID to pass when assuming the IAM Role")
 	tokenCmd.Flags().StringP("session-name", "s", "", "Session name to pass when assuming the IAM Role")
@@ -92,12 +311,57 @@ func init() {
 		false,
 		"Enable mapping a federated sessions caller-specified-role-name attribute onto newly assumed sessions. NOTE: Only applicable when a new role is requested via --role")
 	tokenCmd.Flags().Bool("cache", false, "Cache the credential on disk until it expires. Uses the aws profile specified by AWS_PROFILE or the default profile.")
+	tokenCmd.Flags().String("cache-backend",
+		token.CacheBackendAuto,
+		"Where --cache stores credentials: keyring (the macOS Keychain, the Secret Service through secret-tool on Linux, or a DPAPI-encrypted file on Windows), file (a plaintext file), or auto to use the keyring when it is available and the file otherwise")
+	tokenCmd.Flags().Duration("token-expiration",
+		token.MaxTokenExpiration,
+		"How long the token is reported as valid for, between 1m and 15m. Shorter values make clients refresh tokens more often; tokens are reported as expiring at least 1m before STS stops accepting them.")
+	tokenCmd.Flags().Duration("refresh-before",
+		time.Minute,
+		"Report the token as expiring at least this long before STS stops accepting it, so clients refresh it in time for servers requiring a minimum remaining validity.")
+	tokenCmd.Flags().String("sts-endpoint",
+		"",
+		"`URL` of the STS endpoint to assume --role and presign the token with, such as a VPC interface endpoint. The server must accept its hostname with --sts-endpoint-hostnames.")
+	tokenCmd.Flags().String("token-format",
+		token.TokenFormatV1,
+		"Token `format`: v1, or the more compact v2 which requires servers that accept v2 tokens. Falls back to v1 if the presigned request cannot be encoded as v2.")
+	tokenCmd.Flags().String("bind-source-ip",
+		"",
+		"Bind the token to this `IP` address: the server only accepts it when it is presented from this address, limiting the use of a leaked token. The server checks it against the address of its caller, which is the API server when it runs as a webhook, unless it is configured with --client-ip-header.")
+	tokenCmd.Flags().String("all-profiles",
+		"",
+		"Print the kubeconfig of the cluster with a context and user per AWS profile of the shared config and credentials files matching this `glob` (or, with --token-only, generate a token with each profile and print the profile and its token)")
+	tokenCmd.Flags().String("kubeconfig-server",
+		"",
+		"`URL` of the API server of the cluster in the kubeconfig printed by --all-profiles")
+	tokenCmd.Flags().String("kubeconfig-certificate-authority",
+		"",
+		"PEM `file` of the CA certificates of the API server to embed in the kubeconfig printed by --all-profiles")
+	tokenCmd.Flags().Bool("choose-role",
+		false,
+		"Prompt for the role to assume among the clientRoles of the configuration file again instead of using the one remembered for the cluster")
+	tokenCmd.Flags().String("cluster-id-header",
+		token.DefaultClusterIDHeader,
+		"Header to sign the cluster ID in. Only change it for servers that accept it with --cluster-id-headers.")
 	viper.BindPFlag("region", tokenCmd.Flags().Lookup("region"))
+	viper.BindPFlag("stsRegionFromProfile", tokenCmd.Flags().Lookup("sts-region-from-profile"))
 	viper.BindPFlag("role", tokenCmd.Flags().Lookup("role"))
 	viper.BindPFlag("externalID", tokenCmd.Flags().Lookup("external-id"))
 	viper.BindPFlag("tokenOnly", tokenCmd.Flags().Lookup("token-only"))
 	viper.BindPFlag("forwardSessionName", tokenCmd.Flags().Lookup("forward-session-name"))
 	viper.BindPFlag("sessionName", tokenCmd.Flags().Lookup("session-name"))
 	viper.BindPFlag("cache", tokenCmd.Flags().Lookup("cache"))
+	viper.BindPFlag("cacheBackend", tokenCmd.Flags().Lookup("cache-backend"))
+	viper.BindPFlag("tokenExpiration", tokenCmd.Flags().Lookup("token-expiration"))
+	viper.BindPFlag("refreshBefore", tokenCmd.Flags().Lookup("refresh-before"))
+	viper.BindPFlag("stsEndpoint", tokenCmd.Flags().Lookup("sts-endpoint"))
+	viper.BindPFlag("tokenFormat", tokenCmd.Flags().Lookup("token-format"))
+	viper.BindPFlag("bindSourceIP", tokenCmd.Flags().Lookup("bind-source-ip"))
+	viper.BindPFlag("allProfiles", tokenCmd.Flags().Lookup("all-profiles"))
+	viper.BindPFlag("kubeconfigServer", tokenCmd.Flags().Lookup("kubeconfig-server"))
+	viper.BindPFlag("kubeconfigCertificateAuthority", tokenCmd.Flags().Lookup("kubeconfig-certificate-authority"))
+	viper.BindPFlag("chooseRole", tokenCmd.Flags().Lookup("choose-role"))
+	viper.BindPFlag("clusterIDHeader", tokenCmd.Flags().Lookup("cluster-id-header"))
 	viper.BindEnv("role", "DEFAULT_ROLE")
 }
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tokenDecodeCmd = &cobra.Command{
+	Use:   "decode <token>",
+	Short: "Print what a token contains without calling STS",
+	Long: `Decodes the presigned sts:GetCallerIdentity URL of a token and prints its
+signing region, access key ID and type, expiry and signed headers, and
+whether it passes the checks the server makes before calling STS. Pass - to
+read the token from stdin.
+
+The cluster ID is not part of the token: the server sends its own in the
+signed header, and STS only accepts the signature if it matches.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tok := args[0]
+		if tok == "-" {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not read token: %v\n", err)
+				os.Exit(1)
+			}
+			tok = string(data)
+		}
+
+		decoded, err := token.Decode(strings.TrimSpace(tok), token.VerifierOptions{
+			PartitionID:          viper.GetString("tokenDecode.partition"),
+			AllowedClockSkew:     token.DefaultAllowedClockSkew,
+			STSEndpointHostnames: viper.GetStringSlice("tokenDecode.stsEndpointHostnames"),
+			AllowedSTSRegions:    viper.GetStringSlice("tokenDecode.allowedSTSRegions"),
+			ClusterIDHeaders:     viper.GetStringSlice("tokenDecode.clusterIDHeaders"),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode token: %v\n", err)
+			os.Exit(1)
+		}
+		if viper.GetString("tokenDecode.output") == "json" {
+			value, _ := json.MarshalIndent(decoded, "", "    ")
+			fmt.Printf("%s\n", value)
+		} else {
+			printDecodedToken(decoded)
+		}
+		if decoded.ValidationError != "" {
+			os.Exit(1)
+		}
+	},
+}
+
+func printDecodedToken(d *token.DecodedToken) {
+	fmt.Printf("Format:          %s\n", d.Format)
+	fmt.Printf("Host:            %s\n", d.Host)
+	fmt.Printf("Region:          %s\n", d.Region)
+	fmt.Printf("Access key ID:   %s (%s)\n", d.AccessKeyID, d.AccessKeyType)
+	if !d.SignedAt.IsZero() {
+		fmt.Printf("Signed at:       %s\n", d.SignedAt.Format(time.RFC3339))
+		fmt.Printf("Expires at:      %s (%s)\n", d.Expiration.Format(time.RFC3339), expiresIn(d.Expiration))
+	}
+	fmt.Printf("Signed headers:  %s\n", strings.Join(d.SignedHeaders, ", "))
+	fmt.Printf("Cluster ID:      %s\n", yesNo(d.ClusterIDSigned, "signed in "+d.ClusterIDHeader, "not signed"))
+	fmt.Printf("Source IP bound: %s\n", yesNo(d.SourceIPBound, "yes", "no"))
+	if d.ValidationError != "" {
+		fmt.Printf("Validation:      failed: %s\n", d.ValidationError)
+	} else {
+		fmt.Printf("Validation:      passed (STS was not called)\n")
+	}
+}
+
+func expiresIn(expiration time.Time) string {
+	if left := time.Until(expiration); left > 0 {
+		return "in " + left.Round(time.Second).String()
+	}
+	return "expired " + (-time.Until(expiration)).Round(time.Second).String() + " ago"
+}
+
+func yesNo(b bool, yes, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenDecodeCmd)
+	tokenDecodeCmd.Flags().StringP("output", "o", "", "Output format. Only `json` is supported currently.")
+	viper.BindPFlag("tokenDecode.output", tokenDecodeCmd.Flags().Lookup("output"))
+	tokenDecodeCmd.Flags().String("partition",
+		endpoints.AwsPartitionID,
+		"The AWS partition whose STS endpoints the token may be presigned for")
+	viper.BindPFlag("tokenDecode.partition", tokenDecodeCmd.Flags().Lookup("partition"))
+	tokenDecodeCmd.Flags().StringSlice("sts-endpoint-hostnames", nil,
+		"Hostnames of STS endpoints accepted besides the public ones, like the server's --sts-endpoint-hostnames")
+	viper.BindPFlag("tokenDecode.stsEndpointHostnames", tokenDecodeCmd.Flags().Lookup("sts-endpoint-hostnames"))
+	tokenDecodeCmd.Flags().StringSlice("allowed-sts-regions", nil,
+		"If set, check the token is signed for one of these regions, like the server's --allowed-sts-regions")
+	viper.BindPFlag("tokenDecode.allowedSTSRegions", tokenDecodeCmd.Flags().Lookup("allowed-sts-regions"))
+	tokenDecodeCmd.Flags().StringSlice("cluster-id-headers", nil,
+		"Headers the cluster ID may be signed in, like the server's --cluster-id-headers")
+	viper.BindPFlag("tokenDecode.clusterIDHeaders", tokenDecodeCmd.Flags().Lookup("cluster-id-headers"))
+}
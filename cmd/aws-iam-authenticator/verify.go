@@ -20,12 +20,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/server"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var verifyCmd = &cobra.Command{
@@ -56,18 +62,91 @@ var verifyCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if !viper.GetBool("verify.map") {
+			printVerifyResult(output, id)
+			return
+		}
+
+		username, groups, source, err := mapVerifiedIdentity(id)
+		if err == mapper.ErrNotMapped {
+			printVerifyResult(output, id)
+			fmt.Fprintf(os.Stderr, "identity %s is not mapped by any backend\n", id.CanonicalARN)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "could not map identity: %v\n", err)
+			os.Exit(1)
+		}
 		if output == "json" {
-			value, err := json.MarshalIndent(id, "", "    ")
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "could not unmarshal token: %v\n", err)
-			}
-			fmt.Printf("%s\n", value)
+			printVerifyResult(output, mappedIdentity{
+				Identity:      id,
+				Username:      username,
+				Groups:        groups,
+				MappingSource: source,
+			})
 		} else {
-			fmt.Printf("%+v\n", id)
+			printVerifyResult(output, id)
+			fmt.Printf("Username: %s\nGroups: %v\nMappingSource: %s\n", username, groups, source)
 		}
 	},
 }
 
+// mappedIdentity is the JSON output of verify --map.
+type mappedIdentity struct {
+	*token.Identity
+	Username      string
+	Groups        []string
+	MappingSource string
+}
+
+func printVerifyResult(output string, v interface{}) {
+	if output == "json" {
+		value, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not unmarshal token: %v\n", err)
+		}
+		fmt.Printf("%s\n", value)
+	} else {
+		fmt.Printf("%+v\n", v)
+	}
+}
+
+// mapVerifiedIdentity maps id with the backends of the server configuration,
+// loading ConfigMap and CRD mappings from the cluster once.
+func mapVerifiedIdentity(id *token.Identity) (string, []string, string, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return "", nil, "", err
+	}
+	if modes := viper.GetStringSlice("verify.backendMode"); len(modes) > 0 {
+		if errs := mapper.ValidateBackendMode(modes); len(errs) > 0 {
+			return "", nil, "", utilerrors.NewAggregate(errs)
+		}
+		cfg.BackendMode = modes
+	}
+	if kubeconfig := viper.GetString("verify.kubeconfig"); kubeconfig != "" {
+		cfg.Kubeconfig = kubeconfig
+	} else if cfg.Kubeconfig == "" && cfg.Master == "" {
+		// outside a cluster, use the same kubeconfig as kubectl
+		cfg.Kubeconfig = clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+	}
+	// circuit breakers only help a long-running server
+	cfg.CircuitBreakerFailureThreshold = 0
+
+	mappers, err := server.BuildMapperChain(cfg)
+	if err != nil {
+		return "", nil, "", err
+	}
+	stopCh := make(chan struct{})
+	timer := time.AfterFunc(viper.GetDuration("verify.loadTimeout"), func() { close(stopCh) })
+	defer timer.Stop()
+	for _, m := range mappers {
+		if err := mapper.Load(m, stopCh); err != nil {
+			return "", nil, "", fmt.Errorf("could not load mappings from %s: %v", m.Name(), err)
+		}
+	}
+	return server.MapIdentity(cfg, mappers, id)
+}
+
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 	verifyCmd.Flags().StringP("token", "t", "", "Token to verify")
@@ -75,6 +154,19 @@ func init() {
 	viper.BindPFlag("token", verifyCmd.Flags().Lookup("token"))
 	viper.BindPFlag("output", verifyCmd.Flags().Lookup("output"))
 
+	verifyCmd.Flags().Bool("map", false,
+		"Also map the identity with the backends of the server configuration (--config) and print the Kubernetes username and groups it would authenticate as.")
+	viper.BindPFlag("verify.map", verifyCmd.Flags().Lookup("map"))
+	verifyCmd.Flags().StringSlice("backend-mode", nil,
+		fmt.Sprintf("Backends to map the identity with, overriding the server configuration. Comma-delimited list of: %s", strings.Join(mapper.BackendModeChoices, ",")))
+	viper.BindPFlag("verify.backendMode", verifyCmd.Flags().Lookup("backend-mode"))
+	verifyCmd.Flags().String("kubeconfig", "",
+		"kubeconfig of the cluster to load ConfigMap and CRD mappings from. Defaults to the server configuration, then the kubectl default.")
+	viper.BindPFlag("verify.kubeconfig", verifyCmd.Flags().Lookup("kubeconfig"))
+	verifyCmd.Flags().Duration("load-timeout", 30*time.Second,
+		"How long to wait for mappings to load from the cluster.")
+	viper.BindPFlag("verify.loadTimeout", verifyCmd.Flags().Lookup("load-timeout"))
+
 	partitionKeys := []string{}
 	for _, p := range endpoints.DefaultPartitions() {
 		partitionKeys = append(partitionKeys, p.ID())
@@ -0,0 +1,70 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command decision-wasm exposes the authentication decision engine to
+// JavaScript. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o decision.wasm ./cmd/decision-wasm
+//
+// Once loaded it registers a global function
+// iamAuthenticatorEvaluate(rulesJSON, identityJSON) returning the decision as
+// JSON, or {"error": "..."} if the input is invalid. {{EC2PrivateDNSName}}
+// templates cannot be rendered since there is no EC2 API access.
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/decision"
+)
+
+func evaluate(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return errorJSON("expected arguments (rulesJSON, identityJSON)")
+	}
+	var rules decision.Rules
+	if err := json.Unmarshal([]byte(args[0].String()), &rules); err != nil {
+		return errorJSON("invalid rules: " + err.Error())
+	}
+	var identity decision.Identity
+	if err := json.Unmarshal([]byte(args[1].String()), &identity); err != nil {
+		return errorJSON("invalid identity: " + err.Error())
+	}
+	d, err := decision.Evaluate(rules, identity, nil)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+	return string(out)
+}
+
+func errorJSON(message string) string {
+	out, _ := json.Marshal(map[string]string{"error": message})
+	return string(out)
+}
+
+func main() {
+	js.Global().Set("iamAuthenticatorEvaluate", js.FuncOf(evaluate))
+	// keep the module alive so the function stays callable
+	select {}
+}
@@ -1,3 +1,11 @@
+// Package arn parses and canonicalizes the ARNs of the IAM principals the
+// authenticator maps, with the semantics of the server, so other tools such
+// as CI validators and admission webhooks can reuse them.
+//
+// The canonical ARN of a principal is the ARN mappings match: the IAM role
+// of an assumed-role session, and the ARN itself otherwise. ARNs of role
+// sessions don't include the path of their role, so roles are mapped by
+// their ARN without path (see Principal.WithoutPath).
 package arn
 
 import (
@@ -8,53 +16,230 @@ import (
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 )
 
-// Canonicalize validates IAM resources are appropriate for the authenticator
-// and converts STS assumed roles into the IAM role resource.
-//
-// Supported IAM resources are:
-//   * AWS account: arn:aws:iam::123456789012:root
-//   * IAM user: arn:aws:iam::123456789012:user/Bob
-//   * IAM role: arn:aws:iam::123456789012:role/S3Access
-//   * IAM Assumed role: arn:aws:sts::123456789012:assumed-role/Accounting-Role/Mary (converted to IAM role)
-//   * Federated user: arn:aws:sts::123456789012:federated-user/Bob
-func Canonicalize(arn string) (string, error) {
+// Types of principals.
+const (
+	// TypeRoot is an AWS account: arn:aws:iam::123456789012:root
+	TypeRoot = "root"
+	// TypeUser is an IAM user: arn:aws:iam::123456789012:user/Bob
+	TypeUser = "user"
+	// TypeRole is an IAM role: arn:aws:iam::123456789012:role/S3Access
+	TypeRole = "role"
+	// TypeAssumedRole is a session of an IAM role:
+	// arn:aws:sts::123456789012:assumed-role/Accounting-Role/Mary
+	TypeAssumedRole = "assumed-role"
+	// TypeFederatedUser is a federated user:
+	// arn:aws:sts::123456789012:federated-user/Bob
+	TypeFederatedUser = "federated-user"
+)
+
+// SSORolePath is the path, possibly followed by a region, of the roles IAM
+// Identity Center (AWS SSO) creates for permission sets.
+const SSORolePath = "/aws-reserved/sso.amazonaws.com/"
+
+// Principal is the ARN of an IAM principal split into its parts.
+type Principal struct {
+	// Partition is the partition of the ARN, such as aws or aws-us-gov.
+	Partition string
+	// Service is iam, or sts for assumed roles and federated users.
+	Service   string
+	AccountID string
+	// Type is one of the Type constants.
+	Type string
+	// Path is the path of users and roles, "/" if they have none. The path
+	// of an assumed role is whatever its ARN has between assumed-role/ and
+	// the role name, which is usually nothing. Root and federated users
+	// have none.
+	Path string
+	// Name is the name of the user, role or federated user, or of the
+	// role of an assumed-role session. Roots have none.
+	Name string
+	// SessionName is the session name of assumed-role sessions.
+	SessionName string
+}
+
+// Parse parses the ARN of an IAM principal of a recognized partition.
+func Parse(arn string) (Principal, error) {
 	parsed, err := awsarn.Parse(arn)
 	if err != nil {
-		return "", fmt.Errorf("arn '%s' is invalid: '%v'", arn, err)
+		return Principal{}, fmt.Errorf("arn '%s' is invalid: '%v'", arn, err)
 	}
-
 	if err := checkPartition(parsed.Partition); err != nil {
-		return "", fmt.Errorf("arn '%s' does not have a recognized partition", arn)
+		return Principal{}, fmt.Errorf("arn '%s' does not have a recognized partition", arn)
+	}
+	p := Principal{
+		Partition: parsed.Partition,
+		Service:   parsed.Service,
+		AccountID: parsed.AccountID,
 	}
-
 	parts := strings.Split(parsed.Resource, "/")
-	resource := parts[0]
+	p.Type = parts[0]
 
 	switch parsed.Service {
 	case "sts":
-		switch resource {
-		case "federated-user":
-			return arn, nil
-		case "assumed-role":
-			if len(parts) < 3 {
-				return "", fmt.Errorf("assumed-role arn '%s' does not have a role", arn)
+		switch p.Type {
+		case TypeFederatedUser:
+			if len(parts) != 2 || parts[1] == "" {
+				return Principal{}, fmt.Errorf("federated-user arn '%s' does not have a name", arn)
+			}
+			p.Name = parts[1]
+		case TypeAssumedRole:
+			if len(parts) < 3 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+				return Principal{}, fmt.Errorf("assumed-role arn '%s' does not have a role", arn)
 			}
-			// IAM ARNs can contain paths, part[0] is resource, parts[len(parts)] is the SessionName.
-			role := strings.Join(parts[1:len(parts)-1], "/")
-			return fmt.Sprintf("arn:%s:iam::%s:role/%s", parsed.Partition, parsed.AccountID, role), nil
+			p.Path = "/" + strings.Join(parts[1:len(parts)-2], "/")
+			if len(parts) > 3 {
+				p.Path += "/"
+			}
+			p.Name = parts[len(parts)-2]
+			p.SessionName = parts[len(parts)-1]
 		default:
-			return "", fmt.Errorf("unrecognized resource %s for service sts", parsed.Resource)
+			return Principal{}, fmt.Errorf("unrecognized resource %s for service sts", parsed.Resource)
 		}
 	case "iam":
-		switch resource {
-		case "role", "user", "root":
-			return arn, nil
+		switch p.Type {
+		case TypeRoot:
+			if len(parts) != 1 {
+				return Principal{}, fmt.Errorf("unrecognized resource %s for service iam", parsed.Resource)
+			}
+		case TypeRole, TypeUser:
+			if len(parts) < 2 || parts[len(parts)-1] == "" {
+				return Principal{}, fmt.Errorf("%s arn '%s' does not have a name", p.Type, arn)
+			}
+			p.Path = "/" + strings.Join(parts[1:len(parts)-1], "/")
+			if len(parts) > 2 {
+				p.Path += "/"
+			}
+			p.Name = parts[len(parts)-1]
 		default:
-			return "", fmt.Errorf("unrecognized resource %s for service iam", parsed.Resource)
+			return Principal{}, fmt.Errorf("unrecognized resource %s for service iam", parsed.Resource)
 		}
+	default:
+		return Principal{}, fmt.Errorf("service %s in arn %s is not a valid service for identities", parsed.Service, arn)
 	}
+	return p, nil
+}
 
-	return "", fmt.Errorf("service %s in arn %s is not a valid service for identities", parsed.Service, arn)
+// String returns the ARN of p.
+func (p Principal) String() string {
+	resource := p.Type
+	switch p.Type {
+	case TypeUser, TypeRole:
+		resource += p.path() + p.Name
+	case TypeAssumedRole:
+		resource += p.path() + p.Name + "/" + p.SessionName
+	case TypeFederatedUser:
+		resource += "/" + p.Name
+	}
+	return awsarn.ARN{
+		Partition: p.Partition,
+		Service:   p.Service,
+		AccountID: p.AccountID,
+		Resource:  resource,
+	}.String()
+}
+
+func (p Principal) path() string {
+	if p.Path == "" {
+		return "/"
+	}
+	return p.Path
+}
+
+// Canonical returns the principal mappings of p match: the IAM role of
+// assumed-role sessions, and p otherwise.
+func (p Principal) Canonical() Principal {
+	if p.Type != TypeAssumedRole {
+		return p
+	}
+	return Principal{
+		Partition: p.Partition,
+		Service:   "iam",
+		AccountID: p.AccountID,
+		Type:      TypeRole,
+		Path:      p.Path,
+		Name:      p.Name,
+	}
+}
+
+// WithoutPath returns p without the path of its user or role, as in the
+// canonical ARNs of assumed-role sessions.
+func (p Principal) WithoutPath() Principal {
+	if p.Path != "" {
+		p.Path = "/"
+	}
+	return p
+}
+
+// IsSSORole reports whether p is a role IAM Identity Center created for a
+// permission set. The ARNs of its sessions, like those of all roles, don't
+// include its path.
+func (p Principal) IsSSORole() bool {
+	return p.Type == TypeRole && strings.HasPrefix(p.Path, SSORolePath)
+}
+
+// Key returns the key mappings of canonicalARN are stored and looked up by:
+// the ARN lowercased, or unchanged if strict. With ssoRoleCanonicalization,
+// roles of IAM Identity Center are keyed without their path, like the
+// canonical ARNs of their sessions.
+func Key(canonicalARN string, strict, ssoRoleCanonicalization bool) string {
+	if ssoRoleCanonicalization {
+		if p, err := Parse(canonicalARN); err == nil && p.IsSSORole() {
+			canonicalARN = p.WithoutPath().String()
+		}
+	}
+	if strict {
+		return canonicalARN
+	}
+	return strings.ToLower(canonicalARN)
+}
+
+// Canonicalize validates IAM resources are appropriate for the authenticator
+// and converts STS assumed roles into the IAM role resource.
+//
+// Supported IAM resources are:
+//   * AWS account: arn:aws:iam::123456789012:root
+//   * IAM user: arn:aws:iam::123456789012:user/Bob
+//   * IAM role: arn:aws:iam::123456789012:role/S3Access
+//   * IAM Assumed role: arn:aws:sts::123456789012:assumed-role/Accounting-Role/Mary (converted to IAM role)
+//   * Federated user: arn:aws:sts::123456789012:federated-user/Bob
+func Canonicalize(arn string) (string, error) {
+	p, err := Parse(arn)
+	if err != nil {
+		return "", err
+	}
+	if p.Type != TypeAssumedRole {
+		return arn, nil
+	}
+	return p.Canonical().String(), nil
+}
+
+// CanonicalizeInPartition behaves like Canonicalize but also requires the
+// ARN to be in the given partition, e.g. aws-us-gov for a GovCloud cluster.
+// An empty partition accepts any recognized partition.
+func CanonicalizeInPartition(arn, partition string) (string, error) {
+	canonicalARN, err := Canonicalize(arn)
+	if err != nil || partition == "" {
+		return canonicalARN, err
+	}
+	// Canonicalize has already parsed the ARN successfully
+	parsed, _ := awsarn.Parse(canonicalARN)
+	if parsed.Partition != partition {
+		return "", fmt.Errorf("arn '%s' is in partition %s, expected %s", arn, parsed.Partition, partition)
+	}
+	return canonicalARN, nil
+}
+
+// RoleName returns the name of the IAM role of a role or assumed-role ARN,
+// without its path.
+func RoleName(arn string) (string, error) {
+	p, err := Parse(arn)
+	if err != nil {
+		return "", err
+	}
+	if p.Type != TypeRole && p.Type != TypeAssumedRole {
+		return "", fmt.Errorf("%q is not an IAM role ARN", arn)
+	}
+	return p.Name, nil
 }
 
 func checkPartition(partition string) error {
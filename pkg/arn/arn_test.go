@@ -33,3 +33,200 @@ func TestUserARN(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalizeInPartition(t *testing.T) {
+	for _, tc := range []struct {
+		arn       string
+		partition string
+		expected  string
+		wantErr   bool
+	}{
+		{"arn:aws:iam::123456789012:user/Alice", "", "arn:aws:iam::123456789012:user/Alice", false},
+		{"arn:aws:iam::123456789012:user/Alice", "aws", "arn:aws:iam::123456789012:user/Alice", false},
+		{"arn:aws:iam::123456789012:user/Alice", "aws-cn", "", true},
+		{"arn:aws-cn:sts::123456789012:assumed-role/Admin/Session", "aws-cn", "arn:aws-cn:iam::123456789012:role/Admin", false},
+		{"arn:aws-us-gov:iam::123456789012:role/Admin", "aws-us-gov", "arn:aws-us-gov:iam::123456789012:role/Admin", false},
+		{"arn:aws-us-gov:iam::123456789012:role/Admin", "aws-iso", "", true},
+		{"NOT AN ARN", "aws", "", true},
+	} {
+		actual, err := CanonicalizeInPartition(tc.arn, tc.partition)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("CanonicalizeInPartition(%s, %s) expected err: %v, actual err: %v", tc.arn, tc.partition, tc.wantErr, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("CanonicalizeInPartition(%s, %s) expected: %s, actual: %s", tc.arn, tc.partition, tc.expected, actual)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		arn       string
+		want      Principal
+		canonical string
+		noPath    string
+	}{
+		{
+			arn:       "arn:aws:iam::123456789012:root",
+			want:      Principal{Partition: "aws", Service: "iam", AccountID: "123456789012", Type: TypeRoot},
+			canonical: "arn:aws:iam::123456789012:root",
+			noPath:    "arn:aws:iam::123456789012:root",
+		},
+		{
+			arn:       "arn:aws:iam::123456789012:user/Alice",
+			want:      Principal{Partition: "aws", Service: "iam", AccountID: "123456789012", Type: TypeUser, Path: "/", Name: "Alice"},
+			canonical: "arn:aws:iam::123456789012:user/Alice",
+			noPath:    "arn:aws:iam::123456789012:user/Alice",
+		},
+		{
+			arn:       "arn:aws:iam::123456789012:user/division/team/Alice",
+			want:      Principal{Partition: "aws", Service: "iam", AccountID: "123456789012", Type: TypeUser, Path: "/division/team/", Name: "Alice"},
+			canonical: "arn:aws:iam::123456789012:user/division/team/Alice",
+			noPath:    "arn:aws:iam::123456789012:user/Alice",
+		},
+		{
+			arn:       "arn:aws:iam::123456789012:role/Admin",
+			want:      Principal{Partition: "aws", Service: "iam", AccountID: "123456789012", Type: TypeRole, Path: "/", Name: "Admin"},
+			canonical: "arn:aws:iam::123456789012:role/Admin",
+			noPath:    "arn:aws:iam::123456789012:role/Admin",
+		},
+		{
+			arn:       "arn:aws-us-gov:iam::123456789012:role/team/payments/Admin",
+			want:      Principal{Partition: "aws-us-gov", Service: "iam", AccountID: "123456789012", Type: TypeRole, Path: "/team/payments/", Name: "Admin"},
+			canonical: "arn:aws-us-gov:iam::123456789012:role/team/payments/Admin",
+			noPath:    "arn:aws-us-gov:iam::123456789012:role/Admin",
+		},
+		{
+			arn:       "arn:aws:sts::123456789012:assumed-role/Admin/alice@example.com",
+			want:      Principal{Partition: "aws", Service: "sts", AccountID: "123456789012", Type: TypeAssumedRole, Path: "/", Name: "Admin", SessionName: "alice@example.com"},
+			canonical: "arn:aws:iam::123456789012:role/Admin",
+			noPath:    "arn:aws:sts::123456789012:assumed-role/Admin/alice@example.com",
+		},
+		{
+			arn:       "arn:aws-cn:sts::123456789012:assumed-role/Org/Team/Admin/Session",
+			want:      Principal{Partition: "aws-cn", Service: "sts", AccountID: "123456789012", Type: TypeAssumedRole, Path: "/Org/Team/", Name: "Admin", SessionName: "Session"},
+			canonical: "arn:aws-cn:iam::123456789012:role/Org/Team/Admin",
+			noPath:    "arn:aws-cn:sts::123456789012:assumed-role/Admin/Session",
+		},
+		{
+			arn:       "arn:aws-iso-b:sts::123456789012:federated-user/Bob",
+			want:      Principal{Partition: "aws-iso-b", Service: "sts", AccountID: "123456789012", Type: TypeFederatedUser, Name: "Bob"},
+			canonical: "arn:aws-iso-b:sts::123456789012:federated-user/Bob",
+			noPath:    "arn:aws-iso-b:sts::123456789012:federated-user/Bob",
+		},
+	} {
+		p, err := Parse(tc.arn)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", tc.arn, err)
+			continue
+		}
+		if p != tc.want {
+			t.Errorf("Parse(%s) = %+v, want %+v", tc.arn, p, tc.want)
+		}
+		if p.String() != tc.arn {
+			t.Errorf("Parse(%s).String() = %s", tc.arn, p.String())
+		}
+		if got := p.Canonical().String(); got != tc.canonical {
+			t.Errorf("Parse(%s).Canonical() = %s, want %s", tc.arn, got, tc.canonical)
+		}
+		if got := p.WithoutPath().String(); got != tc.noPath {
+			t.Errorf("Parse(%s).WithoutPath() = %s, want %s", tc.arn, got, tc.noPath)
+		}
+		if canonical, err := Canonicalize(tc.arn); err != nil || canonical != tc.canonical {
+			t.Errorf("Canonicalize(%s) = %s, %v, want %s", tc.arn, canonical, err, tc.canonical)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, arn := range []string{
+		"",
+		"NOT AN ARN",
+		"arn:aws:iam::123456789012",
+		"arn:aws-mars:iam::123456789012:user/Alice",
+		"arn:aws:s3:::bucket",
+		"arn:aws:ec2:us-east-1:123456789012:instance/i-0123456789abcdef0",
+		"arn:aws:iam::123456789012:group/Developers",
+		"arn:aws:iam::123456789012:instance-profile/Node",
+		"arn:aws:iam::123456789012:root/Alice",
+		"arn:aws:iam::123456789012:user",
+		"arn:aws:iam::123456789012:user/",
+		"arn:aws:iam::123456789012:role/team/",
+		"arn:aws:sts::123456789012:assumed-role/Admin",
+		"arn:aws:sts::123456789012:assumed-role/Admin/",
+		"arn:aws:sts::123456789012:assumed-role//Session",
+		"arn:aws:sts::123456789012:federated-user",
+		"arn:aws:sts::123456789012:federated-user/a/b",
+		"arn:aws:sts::123456789012:user/Alice",
+	} {
+		if p, err := Parse(arn); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", arn, p)
+		}
+		if _, err := Canonicalize(arn); err == nil {
+			t.Errorf("Canonicalize(%q) succeeded, want an error", arn)
+		}
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	for _, tc := range []struct {
+		arn     string
+		want    string
+		wantErr bool
+	}{
+		{"arn:aws:iam::123456789012:role/Admin", "Admin", false},
+		{"arn:aws:iam::123456789012:role/team/Admin", "Admin", false},
+		{"arn:aws:sts::123456789012:assumed-role/Admin/Session", "Admin", false},
+		{"arn:aws:iam::123456789012:user/Admin", "", true},
+		{"NOT AN ARN", "", true},
+	} {
+		got, err := RoleName(tc.arn)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("RoleName(%s) = %q, %v, want %q, error %v", tc.arn, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestIsSSORole(t *testing.T) {
+	for _, tc := range []struct {
+		arn  string
+		want bool
+	}{
+		{"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Admin_0123456789abcdef", true},
+		{"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/eu-west-1/AWSReservedSSO_Admin_0123456789abcdef", true},
+		{"arn:aws:iam::123456789012:role/AWSReservedSSO_Admin_0123456789abcdef", false},
+		{"arn:aws:iam::123456789012:user/aws-reserved/sso.amazonaws.com/Admin", false},
+		{"arn:aws:iam::123456789012:role/team/Admin", false},
+	} {
+		p, err := Parse(tc.arn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.IsSSORole(); got != tc.want {
+			t.Errorf("IsSSORole(%s) = %v, want %v", tc.arn, got, tc.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	const ssoRole = "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/eu-west-1/AWSReservedSSO_Admin_0123456789abcdef"
+	for _, tc := range []struct {
+		arn    string
+		strict bool
+		sso    bool
+		want   string
+	}{
+		{"arn:aws:iam::123456789012:role/Admin", false, false, "arn:aws:iam::123456789012:role/admin"},
+		{"arn:aws:iam::123456789012:role/Admin", true, false, "arn:aws:iam::123456789012:role/Admin"},
+		{ssoRole, true, false, ssoRole},
+		{ssoRole, true, true, "arn:aws:iam::123456789012:role/AWSReservedSSO_Admin_0123456789abcdef"},
+		{ssoRole, false, true, "arn:aws:iam::123456789012:role/awsreservedsso_admin_0123456789abcdef"},
+		{"arn:aws:iam::123456789012:role/team/Admin", true, true, "arn:aws:iam::123456789012:role/team/Admin"},
+		{"not an arn", false, true, "not an arn"},
+	} {
+		if got := Key(tc.arn, tc.strict, tc.sso); got != tc.want {
+			t.Errorf("Key(%s, %v, %v) = %s, want %s", tc.arn, tc.strict, tc.sso, got, tc.want)
+		}
+	}
+}
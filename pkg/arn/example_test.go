@@ -0,0 +1,33 @@
+package arn_test
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+)
+
+func ExampleParse() {
+	p, err := arn.Parse("arn:aws:sts::123456789012:assumed-role/Developer/alice")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(p.Type, p.Name, p.SessionName)
+	fmt.Println(p.Canonical())
+	// Output:
+	// assumed-role Developer alice
+	// arn:aws:iam::123456789012:role/Developer
+}
+
+func ExamplePrincipal_WithoutPath() {
+	// mappings of roles with a path match the canonical ARNs of their
+	// sessions without it
+	p, err := arn.Parse("arn:aws:iam::123456789012:role/team/payments/Developer")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(p.Path)
+	fmt.Println(p.WithoutPath())
+	// Output:
+	// /team/payments/
+	// arn:aws:iam::123456789012:role/Developer
+}
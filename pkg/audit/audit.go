@@ -0,0 +1,152 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes a structured record of every authentication decision
+// made by the server.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+)
+
+var logger = logging.For(logging.ComponentServer)
+
+const (
+	// DecisionAllow is recorded when a TokenReview was authenticated.
+	DecisionAllow = "allow"
+	// DecisionDeny is recorded when a TokenReview was rejected.
+	DecisionDeny = "deny"
+
+	// stdoutPath is the special path that sends audit events to stdout.
+	stdoutPath = "-"
+)
+
+// Event is a single audit log entry, written as one line of JSON.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	// SourceIP is the address of the client (normally the API server) that
+	// sent the TokenReview.
+	SourceIP string `json:"sourceIP"`
+	// ClientIP is the address tokens bound to a source IP are checked
+	// against: the client IP header of the request, if the server is
+	// configured with one, or SourceIP.
+	ClientIP string `json:"clientIP,omitempty"`
+	// ARN is the raw ARN returned by sts:GetCallerIdentity.
+	ARN string `json:"arn,omitempty"`
+	// CanonicalARN is the ARN used to look up mappings.
+	CanonicalARN string   `json:"canonicalARN,omitempty"`
+	AccountID    string   `json:"accountID,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	// Decision is either DecisionAllow or DecisionDeny.
+	Decision string `json:"decision"`
+	// Reason is the metric result label describing why the decision was made
+	// (e.g., "success", "invalid_token", "uknown_user").
+	Reason string `json:"reason"`
+	// Warnings are problems with an allowed identity, such as a mapping
+	// granting reserved groups.
+	Warnings       []string `json:"warnings,omitempty"`
+	LatencySeconds float64  `json:"latencySeconds"`
+}
+
+// Logger records audit events.
+type Logger interface {
+	Log(event Event)
+}
+
+// Options configures where audit events are written and how the log file is
+// rotated.
+type Options struct {
+	// Path is the file audit events are appended to. "-" writes to stdout.
+	Path string
+	// MaxSize is the maximum size in megabytes of the log file before it is
+	// rotated. Zero disables rotation.
+	MaxSize int
+	// MaxBackups is the maximum number of rotated log files to keep. Zero
+	// keeps all of them.
+	MaxBackups int
+	// MaxAge is the maximum number of days to keep rotated log files. Zero
+	// keeps them regardless of age.
+	MaxAge int
+}
+
+type jsonLogger struct {
+	mutex sync.Mutex
+	out   io.Writer
+	// file is the rotated log file out writes to, closed by Close. It is
+	// nil when logging to stdout or a writer of the caller.
+	file io.Closer
+}
+
+// New creates a Logger that writes JSON lines according to opts. It returns
+// nil if opts.Path is empty, meaning audit logging is disabled.
+func New(opts Options) (Logger, error) {
+	if opts.Path == "" {
+		return nil, nil
+	}
+	if opts.Path == stdoutPath {
+		return NewWithWriter(os.Stdout), nil
+	}
+	out, err := newRotatingFile(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLogger{out: out, file: out}, nil
+}
+
+// Close syncs and closes the log file of l, if it writes to one, so no
+// event is lost on shutdown. Events logged afterwards are dropped.
+func Close(l Logger) error {
+	if closer, ok := l.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (l *jsonLogger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// NewWithWriter creates a Logger that writes JSON lines to out.
+func NewWithWriter(out io.Writer) Logger {
+	return &jsonLogger{out: out}
+}
+
+func (l *jsonLogger) Log(event Event) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		logger.WithError(err).Error("could not encode audit event")
+		return
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := l.out.Write(line); err != nil {
+		logger.WithError(err).Error("could not write audit event")
+	}
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter(&buf)
+	l.Log(Event{ARN: "arn:aws:iam::123456789012:user/Alice", Decision: DecisionAllow, Username: "alice"})
+	l.Log(Event{Decision: DecisionDeny, Reason: "invalid_token"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("could not decode audit event: %v", err)
+	}
+	if event.Username != "alice" || event.Decision != DecisionAllow {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	l, err := New(Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l != nil {
+		t.Errorf("expected nil logger when no path is set")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newRotatingFile(Options{Path: filepath.Join(dir, "audit.log"), MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	chunk := bytes.Repeat([]byte("a"), megabyte/2+1)
+	for i := 0; i < 8; i++ {
+		if _, err := r.Write(chunk); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups to be kept, got %v", backups)
+	}
+	info, err := os.Stat(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > megabyte {
+		t.Errorf("expected current log to be rotated, size is %d", info.Size())
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	r, err := newRotatingFile(Options{Path: path, MaxSize: 1, MaxAge: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	stale := r.backupName(now.Add(-2 * day))
+	if err := ioutil.WriteFile(stale, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write(bytes.Repeat([]byte("a"), megabyte)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale backup %s to be removed", stale)
+	}
+	if _, err := os.Stat(r.backupName(now)); err != nil {
+		t.Errorf("expected fresh backup to be kept: %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	l, err := New(Options{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Log(Event{Username: "alice"})
+	if err := Close(l); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "alice") {
+		t.Errorf("expected the event to be written, got %q, %v", data, err)
+	}
+
+	if err := Close(NewWithWriter(os.Stdout)); err != nil {
+		t.Errorf("unexpected error closing a writer logger: %v", err)
+	}
+	if err := Close(nil); err != nil {
+		t.Errorf("unexpected error closing a disabled logger: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	megabyte = 1024 * 1024
+	day      = 24 * time.Hour
+
+	// backupTimeFormat is inserted between the name and extension of rotated
+	// files, e.g. "audit-2021-01-02T15-04-05.000.log".
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+)
+
+// rotatingFile is an io.Writer that appends to a file and rotates it once it
+// grows past maxSize, pruning old backups by count and age.
+type rotatingFile struct {
+	mutex      sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	file       *os.File
+	size       int64
+	now        func() time.Time
+}
+
+func newRotatingFile(opts Options) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       opts.Path,
+		maxSize:    int64(opts.MaxSize) * megabyte,
+		maxBackups: opts.MaxBackups,
+		maxAge:     time.Duration(opts.MaxAge) * day,
+		now:        time.Now,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close syncs the log file to disk and closes it.
+func (r *rotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.file.Sync(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// open opens (or creates) the log file for appending.
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("could not create audit log directory: %v", err)
+	}
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not stat audit log: %v", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file aside, opens a fresh one and prunes backups.
+// Must be called with the mutex held.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, r.backupName(r.now())); err != nil {
+		return fmt.Errorf("could not rotate audit log: %v", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(r.path, ext)
+	return fmt.Sprintf("%s-%s%s", prefix, t.UTC().Format(backupTimeFormat), ext)
+}
+
+// prune removes rotated files beyond maxBackups or older than maxAge.
+func (r *rotatingFile) prune() error {
+	if r.maxBackups == 0 && r.maxAge == 0 {
+		return nil
+	}
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(r.path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		path string
+		time time.Time
+	}
+	backups := []backup{}
+	for _, m := range matches {
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext))
+		if err != nil {
+			// not one of ours
+			continue
+		}
+		backups = append(backups, backup{path: m, time: t})
+	}
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	cutoff := r.now().Add(-r.maxAge)
+	for i, b := range backups {
+		if (r.maxBackups > 0 && i >= r.maxBackups) || (r.maxAge > 0 && b.time.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
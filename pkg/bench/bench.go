@@ -0,0 +1,157 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bench measures the throughput and latency of the authenticator's
+// TokenReview webhook, to capacity-plan it before large cluster rollouts.
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+)
+
+// Options configure a benchmark.
+type Options struct {
+	// URL is the webhook endpoint TokenReviews are sent to.
+	URL string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// Tokens are sent in turn, one per request.
+	Tokens []string
+	// Requests is the number of requests sent.
+	Requests int
+	// Concurrency is the number of requests in flight at a time.
+	Concurrency int
+}
+
+// Result is the outcome of a benchmark.
+type Result struct {
+	// Elapsed is the wall time of the benchmark.
+	Elapsed time.Duration
+	// Latencies of the requests, sorted.
+	Latencies []time.Duration
+	// Statuses counts the responses by HTTP status code, or "error" for
+	// requests that got none.
+	Statuses map[string]int
+	// Authenticated is the number of TokenReviews that authenticated.
+	Authenticated int
+}
+
+// Throughput returns the requests completed per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency under which p percent of the requests
+// completed.
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+// Run sends opts.Requests TokenReviews to opts.URL, opts.Concurrency at a
+// time, and measures their latency.
+func Run(opts Options) (*Result, error) {
+	if len(opts.Tokens) == 0 {
+		return nil, errors.New("no tokens to send")
+	}
+	if opts.Requests <= 0 || opts.Concurrency <= 0 {
+		return nil, errors.New("requests and concurrency must be positive")
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	bodies := make([][]byte, len(opts.Tokens))
+	for i, tok := range opts.Tokens {
+		body, err := json.Marshal(authenticationv1beta1.TokenReview{
+			Spec: authenticationv1beta1.TokenReviewSpec{Token: tok},
+		})
+		if err != nil {
+			return nil, err
+		}
+		bodies[i] = body
+	}
+
+	result := &Result{Statuses: map[string]int{}}
+	var mu sync.Mutex
+	next := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				status, authenticated, latency := send(client, opts.URL, bodies[i%len(bodies)])
+				mu.Lock()
+				result.Latencies = append(result.Latencies, latency)
+				result.Statuses[status]++
+				if authenticated {
+					result.Authenticated++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < opts.Requests; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, nil
+}
+
+// send posts a TokenReview and returns the response status, whether it
+// authenticated and the latency.
+func send(client *http.Client, url string, body []byte) (string, bool, time.Duration) {
+	start := time.Now()
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "error", false, time.Since(start)
+	}
+	defer resp.Body.Close()
+	var review authenticationv1beta1.TokenReview
+	err = json.NewDecoder(resp.Body).Decode(&review)
+	// drain the body so the connection is reused
+	io.Copy(ioutil.Discard, resp.Body)
+	latency := time.Since(start)
+	return strconv.Itoa(resp.StatusCode), err == nil && review.Status.Authenticated, latency
+}
@@ -0,0 +1,80 @@
+package bench
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review authenticationv1beta1.TokenReview
+		json.NewDecoder(r.Body).Decode(&review)
+		if review.Spec.Token == "bad" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		review.Status.Authenticated = review.Spec.Token == "good"
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer srv.Close()
+
+	result, err := Run(Options{URL: srv.URL, Tokens: []string{"good", "bad"}, Requests: 10, Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Latencies) != 10 || result.Statuses["200"] != 5 || result.Statuses["403"] != 5 || result.Authenticated != 5 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.Percentile(50) > result.Percentile(99) || result.Percentile(100) != result.Latencies[9] {
+		t.Errorf("unexpected percentiles %v", result.Latencies)
+	}
+	if result.Throughput() <= 0 {
+		t.Errorf("expected a positive throughput, got %v", result.Throughput())
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	if _, err := Run(Options{URL: "http://localhost", Requests: 1, Concurrency: 1}); err == nil {
+		t.Errorf("expected an error without tokens")
+	}
+	if _, err := Run(Options{URL: "http://localhost", Tokens: []string{"t"}}); err == nil {
+		t.Errorf("expected an error without requests")
+	}
+}
+
+func TestSyntheticTokensVerify(t *testing.T) {
+	response, err := SyntheticResponse("arn:aws:sts::123456789012:assumed-role/bench/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := SyntheticTokens(2, "cluster", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0] == tokens[1] {
+		t.Fatalf("expected 2 distinct tokens, got %v", tokens)
+	}
+	v := token.NewVerifierWithOptions(token.VerifierOptions{
+		ClusterID:   "cluster",
+		PartitionID: "aws",
+		Transport:   &StubSTS{Response: response, Latency: time.Millisecond},
+	})
+	id, err := v.Verify(tokens[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.CanonicalARN != "arn:aws:iam::123456789012:role/bench" || id.SessionName != "session" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
+
+func TestSyntheticResponseInvalidARN(t *testing.T) {
+	if _, err := SyntheticResponse("bench"); err == nil {
+		t.Errorf("expected an error for an invalid ARN")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// StubSTS answers every sts:GetCallerIdentity request with a recorded
+// response, so tokens signed with fake credentials verify without calling
+// AWS. It is an http.RoundTripper for the STS client of the server.
+type StubSTS struct {
+	// Response is the body of the responses, a GetCallerIdentity response
+	// in JSON.
+	Response []byte
+	// Latency is added to every response to simulate STS.
+	Latency time.Duration
+}
+
+// RoundTrip answers req with the recorded response.
+func (s *StubSTS) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.Latency > 0 {
+		select {
+		case <-time.After(s.Latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(s.Response)),
+		ContentLength: int64(len(s.Response)),
+		Request:       req,
+	}, nil
+}
+
+// SyntheticResponse returns a GetCallerIdentity response for the IAM user or
+// assumed role arn, in JSON.
+func SyntheticResponse(arn string) ([]byte, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil, fmt.Errorf("%q is not an ARN", arn)
+	}
+	userID := "AIDABENCHMARK00000000"
+	if i := strings.LastIndex(parts[5], "/"); strings.HasPrefix(parts[5], "assumed-role/") && i >= 0 {
+		userID = "AROABENCHMARK00000000:" + parts[5][i+1:]
+	}
+	var response struct {
+		GetCallerIdentityResponse struct {
+			GetCallerIdentityResult struct {
+				Account string `json:"Account"`
+				Arn     string `json:"Arn"`
+				UserID  string `json:"UserId"`
+			} `json:"GetCallerIdentityResult"`
+			ResponseMetadata struct {
+				RequestID string `json:"RequestId"`
+			} `json:"ResponseMetadata"`
+		} `json:"GetCallerIdentityResponse"`
+	}
+	result := &response.GetCallerIdentityResponse.GetCallerIdentityResult
+	result.Account, result.Arn, result.UserID = parts[4], arn, userID
+	response.GetCallerIdentityResponse.ResponseMetadata.RequestID = "00000000-0000-0000-0000-000000000000"
+	return json.Marshal(response)
+}
+
+// SyntheticTokens returns n distinct tokens for clusterID presigned against
+// the STS endpoint of region with fake temporary credentials. Each has its
+// own access key ID, so the server verifies each one instead of serving it
+// from its STS cache.
+func SyntheticTokens(n int, clusterID, region string) ([]string, error) {
+	gen, err := token.NewGenerator(false, false)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		sess, err := session.NewSession(&aws.Config{
+			Region:              aws.String(region),
+			STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
+			Credentials:         credentials.NewStaticCredentials(fmt.Sprintf("ASIABENCH%011d", i), "secret", "session"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		tok, err := gen.GetWithSTS(clusterID, sts.New(sess))
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok.Token)
+	}
+	return tokens, nil
+}
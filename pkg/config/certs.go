@@ -22,8 +22,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/base64"
 	"encoding/pem"
+	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
@@ -52,14 +53,25 @@ func (c *Config) GetOrCreateCertificate() (*tls.Certificate, error) {
 	if cert != nil {
 		return cert, nil
 	}
+	return c.RotateCertificate()
+}
+
+// RotateCertificate generates a new self-signed certificate and private key,
+// replacing any existing ones in the StateDir.
+func (c *Config) RotateCertificate() (*tls.Certificate, error) {
+	// generate a new RSA-2048 keypair
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
 
 	// generate a self-signed certificate and write out the certificate and private key
-	certBytes, keyBytes, err := c.selfSignCertificate()
+	certBytes, keyBytes, err := c.selfSignCertificate(privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"certPath": c.certPath(),
 		"keyPath":  c.keyPath(),
 	}).Info("saving new key and certificate")
@@ -93,33 +105,61 @@ func (c *Config) LoadExistingCertificate() (*tls.Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"certPath": c.certPath(),
 		"keyPath":  c.keyPath(),
 	}).Info("loaded existing keypair")
 	return &cert, nil
 }
 
+// LoadClientCAs loads the CA bundle used to verify client certificates. It
+// returns nil if no ClientCAFile is configured.
+func (c *Config) LoadClientCAs() (*x509.CertPool, error) {
+	if c.ClientCAFile == "" {
+		return nil, nil
+	}
+	caPEM, err := ioutil.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in client CA file %q", c.ClientCAFile)
+	}
+	logger.WithField("clientCAFile", c.ClientCAFile).Info("loaded client CA bundle, client certificates are required")
+	return pool, nil
+}
+
+// dumpPEM writes the PEM block to a temporary file and renames it into
+// place, so a concurrent reader never sees a partially written file.
 func dumpPEM(filename string, mode os.FileMode, blockType string, bytes []byte) error {
-	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	tmp := filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return pem.Encode(f, &pem.Block{Type: blockType, Bytes: bytes})
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: bytes}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
 }
 
-func (c *Config) selfSignCertificate() ([]byte, []byte, error) {
-
-	// generate a new RSA-2048 keypair
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, nil, err
+// CertificateLifetime returns the validity period of generated certificates.
+func (c *Config) CertificateLifetime() time.Duration {
+	if c.CertLifetime > 0 {
+		return c.CertLifetime
 	}
+	return certLifetime
+}
 
-	// choose a beginning and end for the cert's lifetime (currently ~infinite)
+func (c *Config) selfSignCertificate(privateKey *rsa.PrivateKey) ([]byte, []byte, error) {
+	// choose a beginning and end for the cert's lifetime (~infinite by default)
 	notBefore := time.Now()
-	notAfter := notBefore.Add(certLifetime)
+	notAfter := notBefore.Add(c.CertificateLifetime())
 
 	// choose a random 128 bit serial number
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
@@ -161,18 +201,9 @@ func (c *Config) selfSignCertificate() ([]byte, []byte, error) {
 
 	keyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"certBytes": len(certBytes),
 		"keyBytes":  len(keyBytes),
 	}).Info("generated a new private key and certificate")
 	return certBytes, keyBytes, nil
 }
-
-// certToPEMBase64 returns the Base64 encoded PEM block for a given DER
-// certificate (i.e., it returns "Base64(PEM(asn1))").
-func certToPEMBase64(der []byte) string {
-	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: der,
-	}))
-}
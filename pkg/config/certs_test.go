@@ -2,9 +2,16 @@ package config
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -66,7 +73,11 @@ func TestSelfSignCert(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		certBytes, keyBytes, err := test.config.selfSignCertificate()
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		certBytes, keyBytes, err := test.config.selfSignCertificate(privateKey)
 		if err != nil {
 			if err != test.err {
 				t.Errorf("Expected error %v, got %v", test.err, err)
@@ -102,3 +113,80 @@ func TestSelfSignCert(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-ca")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Config{Address: "127.0.0.1", Hostname: "127.0.0.1"}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	certBytes, _, err := cfg.selfSignCertificate(privateKey)
+	if err != nil {
+		t.Fatalf("selfSignCertificate: %v", err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	garbageFile := filepath.Join(dir, "garbage.pem")
+	if err := ioutil.WriteFile(garbageFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		file    string
+		pool    bool
+		wantErr bool
+	}{
+		{file: "", pool: false},
+		{file: caFile, pool: true},
+		{file: garbageFile, wantErr: true},
+		{file: filepath.Join(dir, "missing.pem"), wantErr: true},
+	}
+	for _, test := range tests {
+		pool, err := (&Config{ClientCAFile: test.file}).LoadClientCAs()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: expected error %t, got %v", test.file, test.wantErr, err)
+		}
+		if (pool != nil) != test.pool {
+			t.Errorf("%q: expected pool %t, got %v", test.file, test.pool, pool)
+		}
+	}
+}
+
+func TestKubeconfigClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		params   kubeconfigParams
+		expected bool
+	}{
+		{params: kubeconfigParams{ServerURL: "https://127.0.0.1:21362/authenticate"}},
+		{params: kubeconfigParams{ServerURL: "https://127.0.0.1:21362/authenticate", ClientCertificate: "/pki/client.crt", ClientKey: "/pki/client.key"}, expected: true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "kubeconfig.yaml")
+		if err := test.params.writeTo(path); err != nil {
+			t.Fatalf("writeTo: %v", err)
+		}
+		out, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		hasCert := strings.Contains(string(out), "client-certificate: /pki/client.crt") &&
+			strings.Contains(string(out), "client-key: /pki/client.key")
+		if hasCert != test.expected {
+			t.Errorf("expected client certificate %t in kubeconfig:\n%s", test.expected, out)
+		}
+	}
+}
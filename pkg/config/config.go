@@ -17,25 +17,42 @@ limitations under the License.
 package config
 
 import (
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"net/url"
 	"path/filepath"
 	"strconv"
 
-	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 )
 
+var logger = logging.For(logging.ComponentServer)
+
+// DefaultAuthenticatePath is where the authentication webhook is served
+// unless AuthenticatePaths is set.
+const DefaultAuthenticatePath = "/authenticate"
+
 // ServerURL returns the URL to connect to this server.
 func (c *Config) ServerURL() string {
 	u := url.URL{
 		Scheme: "https",
 		Host:   c.ServerAddr(),
-		Path:   "/authenticate",
+		Path:   c.AuthenticatePath(),
 	}
 	return u.String()
 }
 
+// AuthenticatePath returns the path of the authentication webhook clients
+// should use: the first of AuthenticatePaths.
+func (c *Config) AuthenticatePath() string {
+	if len(c.AuthenticatePaths) == 0 {
+		return DefaultAuthenticatePath
+	}
+	return c.AuthenticatePaths[0]
+}
+
 // ServerAddr returns the host and port clients should use for server endpoint.
 func (c *Config) ServerAddr() string {
 	return net.JoinHostPort(c.Hostname, strconv.Itoa(c.HostPort))
@@ -67,14 +84,25 @@ func (c *Config) CreateKubeconfig() error {
 		return fmt.Errorf("failed to load an existing certificate: %v", err)
 	}
 
+	return c.WriteKubeconfig(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Certificate[0],
+	}))
+}
+
+// WriteKubeconfig writes a kubeconfig for the webhook server that trusts the
+// PEM encoded caBundle.
+func (c *Config) WriteKubeconfig(caBundle []byte) error {
 	// write a kubeconfig suitable for the API server to call us
-	logrus.WithField("kubeconfigPath", c.GenerateKubeconfigPath).Info("writing webhook kubeconfig file")
-	err = kubeconfigParams{
+	logger.WithField("kubeconfigPath", c.GenerateKubeconfigPath).Info("writing webhook kubeconfig file")
+	err := kubeconfigParams{
 		ServerURL:                  c.ServerURL(),
-		CertificateAuthorityBase64: certToPEMBase64(cert.Certificate[0]),
+		CertificateAuthorityBase64: base64.StdEncoding.EncodeToString(caBundle),
+		ClientCertificate:          c.KubeconfigClientCertificate,
+		ClientKey:                  c.KubeconfigClientKey,
 	}.writeTo(c.GenerateKubeconfigPath)
 	if err != nil {
-		logrus.WithField("kubeconfigPath", c.GenerateKubeconfigPath).WithError(err).Fatal("could not write kubeconfig")
+		logger.WithField("kubeconfigPath", c.GenerateKubeconfigPath).WithError(err).Fatal("could not write kubeconfig")
 	}
 	return nil
 }
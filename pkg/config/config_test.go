@@ -30,6 +30,14 @@ func TestServerUrl(t *testing.T) {
 			},
 			expected: "https://[2001:db8::1:0]:1234/authenticate",
 		},
+		{
+			config: Config{
+				Hostname:          "example.com",
+				HostPort:          6443,
+				AuthenticatePaths: []string{"/v1/authenticate", "/authenticate"},
+			},
+			expected: "https://example.com:6443/v1/authenticate",
+		},
 	}
 
 	for _, test := range tests {
@@ -27,6 +27,6 @@ const (
 	// will be stored.
 	keyFilename = "key.pem"
 
-	// certLifetime is the lifetime of the CA certificate (100 years)
+	// certLifetime is the default lifetime of the CA certificate (100 years)
 	certLifetime = time.Hour * 24 * 365 * 100
 )
@@ -17,14 +17,41 @@ limitations under the License.
 package config
 
 import (
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/component-base/featuregate"
 )
 
 const (
 	// IAMIdentityMappingCRD enables using CRDs to manage allowed users
 	IAMIdentityMappingCRD featuregate.Feature = "IAMIdentityMappingCRD"
+
+	// SSORoleCanonicalization matches mapped roles that IAM Identity Center
+	// (AWS SSO) created for permission sets without their
+	// /aws-reserved/sso.amazonaws.com/ path, which the ARNs of their
+	// sessions don't include, so the ARNs the IAM console shows can be
+	// mapped.
+	SSORoleCanonicalization featuregate.Feature = "SSORoleCanonicalization"
+
+	// StrictARNMatching enables strict ARN matching as if the
+	// StrictARNMatching setting were true.
+	StrictARNMatching featuregate.Feature = "StrictARNMatching"
+
+	// TokenV2 accepts v2 tokens on the server and lets the token command
+	// generate them.
+	TokenV2 featuregate.Feature = "TokenV2"
 )
 
 var DefaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
-	IAMIdentityMappingCRD: {Default: false, PreRelease: featuregate.Alpha},
+	IAMIdentityMappingCRD:   {Default: false, PreRelease: featuregate.Alpha},
+	SSORoleCanonicalization: {Default: false, PreRelease: featuregate.Alpha},
+	StrictARNMatching:       {Default: false, PreRelease: featuregate.Alpha},
+	TokenV2:                 {Default: true, PreRelease: featuregate.Beta},
+}
+
+// DefaultFeatureGate is the registry of the feature gates, set with the
+// --feature-gates flag.
+var DefaultFeatureGate featuregate.MutableFeatureGate = featuregate.NewFeatureGate()
+
+func init() {
+	utilruntime.Must(DefaultFeatureGate.Add(DefaultFeatureGates))
 }
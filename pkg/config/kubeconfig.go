@@ -30,9 +30,14 @@ clusters:
       certificate-authority-data: {{.CertificateAuthorityBase64}}
       server: {{.ServerURL}}
 # users refers to the API Server's webhook configuration
-# (we don't need to authenticate the API server).
+# (the API server only authenticates when client certificates are required).
 users:
   - name: apiserver
+{{- if .ClientCertificate}}
+    user:
+      client-certificate: {{.ClientCertificate}}
+      client-key: {{.ClientKey}}
+{{- end}}
 # kubeconfig files require a context. Provide one for the API Server.
 current-context: webhook
 contexts:
@@ -45,6 +50,8 @@ contexts:
 type kubeconfigParams struct {
 	ServerURL                  string
 	CertificateAuthorityBase64 string
+	ClientCertificate          string
+	ClientKey                  string
 }
 
 func (p kubeconfigParams) writeTo(outputPath string) error {
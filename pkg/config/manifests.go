@@ -0,0 +1,293 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// Workload kinds the server manifests can be generated for.
+const (
+	WorkloadDaemonSet  = "DaemonSet"
+	WorkloadDeployment = "Deployment"
+)
+
+// DefaultImage is the server image referenced by generated manifests.
+const DefaultImage = "602401143452.dkr.ecr.us-west-2.amazonaws.com/amazon/aws-iam-authenticator:v0.5.3"
+
+// ManifestOptions are the settings of generated manifests that aren't part of
+// the server configuration.
+type ManifestOptions struct {
+	// Image is the server container image.
+	Image string
+	// Workload is WorkloadDaemonSet, to run on every control plane node, or
+	// WorkloadDeployment.
+	Workload string
+	// Replicas of a Deployment.
+	Replicas int
+	// ConfigMapName is the name of the ConfigMap the server reads mappings
+	// from, as returned by configmap.Location, "aws-auth" if empty.
+	ConfigMapName string
+}
+
+type manifestParams struct {
+	ManifestOptions
+	ClusterID              string
+	BackendMode            []string
+	HostPort               int
+	StateDir               string
+	KubeconfigPath         string
+	KubeconfigDir          string
+	KubeconfigPregenerated bool
+	BootstrapWriter        bool
+}
+
+func (c *Config) manifestParams(opts ManifestOptions) (manifestParams, error) {
+	if opts.Workload != WorkloadDaemonSet && opts.Workload != WorkloadDeployment {
+		return manifestParams{}, fmt.Errorf("workload must be %s or %s, not %q", WorkloadDaemonSet, WorkloadDeployment, opts.Workload)
+	}
+	if opts.Image == "" {
+		opts.Image = DefaultImage
+	}
+	if opts.Replicas < 1 {
+		opts.Replicas = 1
+	}
+	if opts.ConfigMapName == "" {
+		opts.ConfigMapName = "aws-auth"
+	}
+	return manifestParams{
+		ManifestOptions:        opts,
+		ClusterID:              c.ClusterID,
+		BackendMode:            c.BackendMode,
+		HostPort:               c.HostPort,
+		StateDir:               c.StateDir,
+		KubeconfigPath:         c.GenerateKubeconfigPath,
+		KubeconfigDir:          filepath.Dir(c.GenerateKubeconfigPath),
+		KubeconfigPregenerated: c.KubeconfigPregenerated,
+		BootstrapWriter:        c.BootstrapWriter,
+	}, nil
+}
+
+var manifestsTemplate = template.Must(
+	template.New("manifests").Option("missingkey=error").Parse(`# Generated by aws-iam-authenticator init for cluster {{.ClusterID}}.
+# Add your mappings to the config.yaml below{{range .BackendMode}}{{if eq . "EKSConfigMap"}}, the {{$.ConfigMapName}} ConfigMap{{end}}{{if eq . "CRD"}}, IAMIdentityMappings (install deploy/iamidentitymapping.yaml){{end}}{{end}}.
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: aws-iam-authenticator
+rules:
+- apiGroups: ["iamauthenticator.k8s.aws"]
+  resources: ["iamidentitymappings", "namespacediamidentitymappings"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["iamauthenticator.k8s.aws"]
+  resources: ["iamidentitymappings/status"]
+  verbs: ["patch", "update"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "update", "patch"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["list", "watch"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["{{.ConfigMapName}}"]
+  verbs: ["get"{{if .BootstrapWriter}}, "update"{{end}}]
+{{- if .BootstrapWriter}}
+# the bootstrap writer creates the ConfigMap if it is missing, and elects the
+# replica writing it with the aws-iam-authenticator-bootstrap-writer Lease
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["create"]
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  verbs: ["create"]
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  resourceNames: ["aws-iam-authenticator-bootstrap-writer"]
+  verbs: ["get", "update"]
+{{- end}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: aws-iam-authenticator
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: aws-iam-authenticator
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: aws-iam-authenticator
+subjects:
+- kind: ServiceAccount
+  name: aws-iam-authenticator
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: aws-iam-authenticator
+  namespace: kube-system
+  labels:
+    k8s-app: aws-iam-authenticator
+data:
+  config.yaml: |
+    clusterID: {{printf "%q" .ClusterID}}
+    server:
+      port: {{.HostPort}}
+      stateDir: {{.StateDir}}
+      generateKubeconfig: {{.KubeconfigPath}}
+      kubeconfigPregenerated: {{.KubeconfigPregenerated}}
+      backendMode:
+{{- range .BackendMode}}
+      - {{.}}
+{{- end}}
+      mapRoles: []
+      mapUsers: []
+      mapAccounts: []
+---
+apiVersion: apps/v1
+kind: {{.Workload}}
+metadata:
+  name: aws-iam-authenticator
+  namespace: kube-system
+  labels:
+    k8s-app: aws-iam-authenticator
+spec:
+{{- if eq .Workload "Deployment"}}
+  replicas: {{.Replicas}}
+{{- else}}
+  updateStrategy:
+    type: RollingUpdate
+{{- end}}
+  selector:
+    matchLabels:
+      k8s-app: aws-iam-authenticator
+  template:
+    metadata:
+      labels:
+        k8s-app: aws-iam-authenticator
+    spec:
+      serviceAccountName: aws-iam-authenticator
+      # run on the host network of the control plane nodes, where the API
+      # server reaches the webhook through the generated kubeconfig
+      hostNetwork: true
+      priorityClassName: system-node-critical
+      nodeSelector:
+        node-role.kubernetes.io/master: ""
+      tolerations:
+      - effect: NoSchedule
+        key: node-role.kubernetes.io/master
+      - key: CriticalAddonsOnly
+        operator: Exists
+{{- if eq .Workload "Deployment"}}
+      affinity:
+        podAntiAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+          - topologyKey: kubernetes.io/hostname
+            labelSelector:
+              matchLabels:
+                k8s-app: aws-iam-authenticator
+{{- end}}
+      containers:
+      - name: aws-iam-authenticator
+        image: {{.Image}}
+        args:
+        - server
+        - --config=/etc/aws-iam-authenticator/config.yaml
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop:
+            - ALL
+        resources:
+          requests:
+            memory: 20Mi
+            cpu: 10m
+          limits:
+            memory: 20Mi
+            cpu: 100m
+        volumeMounts:
+        - name: config
+          mountPath: /etc/aws-iam-authenticator/
+        - name: state
+          mountPath: {{.StateDir}}
+        - name: output
+          mountPath: {{.KubeconfigDir}}
+      volumes:
+      - name: config
+        configMap:
+          name: aws-iam-authenticator
+      - name: state
+        hostPath:
+          path: {{.StateDir}}
+      - name: output
+        hostPath:
+          path: {{.KubeconfigDir}}
+`))
+
+var helmValuesTemplate = template.Must(
+	template.New("values").Option("missingkey=error").Parse(`# Generated by aws-iam-authenticator init for cluster {{.ClusterID}}.
+image: {{.Image}}
+workload: {{.Workload}}
+replicas: {{.Replicas}}
+clusterID: {{printf "%q" .ClusterID}}
+server:
+  port: {{.HostPort}}
+  backendMode:
+{{- range .BackendMode}}
+  - {{.}}
+{{- end}}
+  kubeconfigPregenerated: {{.KubeconfigPregenerated}}
+hostPaths:
+  stateDir: {{.StateDir}}
+  kubeconfig: {{.KubeconfigPath}}
+mapRoles: []
+mapUsers: []
+mapAccounts: []
+`))
+
+// WriteManifests writes the ServiceAccount, RBAC, configuration and server
+// workload for this configuration to path, ready to apply.
+func (c *Config) WriteManifests(path string, opts ManifestOptions) error {
+	return c.writeTemplate(manifestsTemplate, path, opts)
+}
+
+// WriteHelmValues writes this configuration to path as a Helm values file.
+func (c *Config) WriteHelmValues(path string, opts ManifestOptions) error {
+	return c.writeTemplate(helmValuesTemplate, path, opts)
+}
+
+func (c *Config) writeTemplate(t *template.Template, path string, opts ManifestOptions) error {
+	params, err := c.manifestParams(opts)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return t.Execute(f, params)
+}
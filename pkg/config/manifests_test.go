@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func TestWriteManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Config{
+		ClusterID:              "my-cluster",
+		BackendMode:            []string{"EKSConfigMap", "MountedFile"},
+		HostPort:               21362,
+		StateDir:               "/srv/authenticator",
+		GenerateKubeconfigPath: "/srv/kubernetes/authenticator/kubeconfig.yaml",
+	}
+	for _, workload := range []string{WorkloadDaemonSet, WorkloadDeployment} {
+		path := filepath.Join(dir, workload+".yaml")
+		if err := cfg.WriteManifests(path, ManifestOptions{Workload: workload, Replicas: 3}); err != nil {
+			t.Fatalf("WriteManifests: %v", err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+
+		var kinds []string
+		var server *unstructured.Unstructured
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: generated manifests don't parse: %v", workload, err)
+			}
+			if obj.Object == nil {
+				continue
+			}
+			kinds = append(kinds, obj.GetKind())
+			if obj.GetKind() == workload {
+				server = obj
+			}
+		}
+		if len(kinds) != 5 || server == nil {
+			t.Fatalf("%s: expected RBAC, ConfigMap and %s, got %v", workload, workload, kinds)
+		}
+		volumes, _, _ := unstructured.NestedSlice(server.Object, "spec", "template", "spec", "volumes")
+		var hostPaths []string
+		for _, v := range volumes {
+			if path, ok, _ := unstructured.NestedString(v.(map[string]interface{}), "hostPath", "path"); ok {
+				hostPaths = append(hostPaths, path)
+			}
+		}
+		if len(hostPaths) != 2 || hostPaths[0] != "/srv/authenticator" || hostPaths[1] != "/srv/kubernetes/authenticator" {
+			t.Errorf("%s: unexpected host paths %v", workload, hostPaths)
+		}
+		replicas, found, _ := unstructured.NestedFieldNoCopy(server.Object, "spec", "replicas")
+		if workload == WorkloadDeployment && fmt.Sprint(replicas) != "3" {
+			t.Errorf("expected 3 replicas, got %v", replicas)
+		} else if workload == WorkloadDaemonSet && found {
+			t.Errorf("expected no replicas for a DaemonSet")
+		}
+	}
+
+	if err := cfg.WriteManifests(filepath.Join(dir, "bad.yaml"), ManifestOptions{Workload: "StatefulSet"}); err == nil {
+		t.Errorf("expected an error for an unsupported workload")
+	}
+}
+
+func TestWriteManifestsConfigMapName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Config{ClusterID: "my-cluster", BackendMode: []string{"EKSConfigMap"}}
+	path := filepath.Join(dir, "manifests.yaml")
+	if err := cfg.WriteManifests(path, ManifestOptions{Workload: WorkloadDaemonSet, ConfigMapName: "iam-auth"}); err != nil {
+		t.Fatalf("WriteManifests: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`resourceNames: ["iam-auth"]`)) || bytes.Contains(data, []byte("aws-auth")) {
+		t.Errorf("expected the RBAC to grant access to the iam-auth ConfigMap only:\n%s", data)
+	}
+}
+
+func TestWriteManifestsBootstrapWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, writer := range []bool{false, true} {
+		cfg := Config{ClusterID: "my-cluster", BackendMode: []string{"EKSConfigMap"}, BootstrapWriter: writer}
+		path := filepath.Join(dir, "manifests.yaml")
+		if err := cfg.WriteManifests(path, ManifestOptions{Workload: WorkloadDaemonSet}); err != nil {
+			t.Fatalf("WriteManifests: %v", err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+
+		var rules []interface{}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("generated manifests don't parse: %v", err)
+			}
+			if obj.GetKind() == "ClusterRole" {
+				rules, _, _ = unstructured.NestedSlice(obj.Object, "rules")
+			}
+		}
+		var updatesAWSAuth, updatesLease bool
+		for _, r := range rules {
+			rule := r.(map[string]interface{})
+			names, _, _ := unstructured.NestedStringSlice(rule, "resourceNames")
+			verbs, _, _ := unstructured.NestedStringSlice(rule, "verbs")
+			for _, verb := range verbs {
+				if verb == "update" && len(names) == 1 && names[0] == "aws-auth" {
+					updatesAWSAuth = true
+				}
+				if verb == "update" && len(names) == 1 && names[0] == "aws-iam-authenticator-bootstrap-writer" {
+					updatesLease = true
+				}
+			}
+		}
+		if updatesAWSAuth != writer || updatesLease != writer {
+			t.Errorf("bootstrap writer %t: expected update on aws-auth and the lease %t, got %t and %t", writer, writer, updatesAWSAuth, updatesLease)
+		}
+	}
+}
@@ -16,6 +16,8 @@ limitations under the License.
 
 package config
 
+import "time"
+
 type IdentityMapping struct {
 	IdentityARN string
 
@@ -26,6 +28,23 @@ type IdentityMapping struct {
 	// Groups is a list of Kubernetes groups this role will authenticate
 	// as (e.g., `system:masters`). Each group name can include placeholders.
 	Groups []string
+
+	// IdentityExtras, if set, overrides Config.IdentityExtras for this
+	// mapping.
+	IdentityExtras *bool
+
+	// LookupIAMGroups adds the IAM groups of the user to Groups. Only user
+	// mappings set it.
+	LookupIAMGroups bool
+
+	// NotAfter, if set, is when the mapping expires. Expired mappings are
+	// ignored.
+	NotAfter *time.Time
+}
+
+// Expired reports whether the mapping expired at now.
+func (m *IdentityMapping) Expired(now time.Time) bool {
+	return m.NotAfter != nil && now.After(*m.NotAfter)
 }
 
 // RoleMapping is a mapping of an AWS Role ARN to a Kubernetes username and a
@@ -53,6 +72,58 @@ type RoleMapping struct {
 	// Groups is a list of Kubernetes groups this role will authenticate
 	// as (e.g., `system:masters`). Each group name can include placeholders.
 	Groups []string
+
+	// IdentityExtras, if set, overrides Config.IdentityExtras for this
+	// mapping.
+	IdentityExtras *bool
+
+	// NotAfter, if set, is when the mapping expires, e.g. for time-bound
+	// access. Expired mappings are ignored.
+	NotAfter *time.Time
+}
+
+// MappingAssertion is a mapping that a new revision of in-cluster mappings
+// must contain to be activated.
+type MappingAssertion struct {
+	// ARN is the user or role ARN that must be mapped.
+	ARN string
+
+	// Username, if set, is the username pattern ARN must be mapped to.
+	Username string
+
+	// Groups are groups ARN must be mapped to, among others.
+	Groups []string
+}
+
+// SessionNamePolicy requires the sessions of a role to have names matching
+// a pattern, so a role shared by several people can't be used with a session
+// name chosen at will.
+type SessionNamePolicy struct {
+	// RoleARN is the role the policy applies to. Empty applies it to every
+	// role.
+	RoleARN string
+
+	// Pattern is a regular expression session names must match entirely.
+	Pattern string
+}
+
+// MappingRule maps the identities its match expression selects, for logic
+// too complex for static mappings. Expressions are written in a subset of
+// CEL over the attributes of the verified identity (see pkg/expr).
+type MappingRule struct {
+	// Name identifies the rule in logs.
+	Name string
+
+	// Match returns whether the rule maps an identity.
+	Match string
+
+	// Username returns the username of the identities the rule maps. It may
+	// contain the templates of static mappings.
+	Username string
+
+	// Groups returns the list of groups of the identities the rule maps.
+	// Empty maps them to no group.
+	Groups string
 }
 
 // UserMapping is a static mapping of a single AWS User ARN to a
@@ -66,6 +137,18 @@ type UserMapping struct {
 
 	// Groups is a list of Kubernetes groups this role will authenticate as (e.g., `system:masters`)
 	Groups []string
+
+	// IdentityExtras, if set, overrides Config.IdentityExtras for this
+	// mapping.
+	IdentityExtras *bool
+
+	// LookupIAMGroups, if true, adds a group "iam:<group name>" for each IAM
+	// group the user is a member of, as returned by iam:ListGroupsForUser.
+	LookupIAMGroups bool
+
+	// NotAfter, if set, is when the mapping expires, e.g. for time-bound
+	// access. Expired mappings are ignored.
+	NotAfter *time.Time
 }
 
 // Config specifies the configuration for a aws-iam-authenticator server
@@ -79,6 +162,91 @@ type Config struct {
 	// aws-iam-authenticator installation.
 	ClusterID string
 
+	// AdditionalClusterIDs are accepted besides ClusterID, so tokens
+	// generated for a previous or next cluster ID keep working during a
+	// rename or migration.
+	AdditionalClusterIDs []string
+	// ClusterIDHeaders are the headers tokens may sign the cluster ID in,
+	// for clients of forks and distributions that renamed x-k8s-aws-id.
+	// Defaults to x-k8s-aws-id.
+	ClusterIDHeaders []string
+	// ClientIPHeader is the request header carrying the IP address of the
+	// client that minted a token, which tokens bound to a source IP are
+	// checked against. It must be set by a trusted proxy in front of the
+	// authenticator, as the API server doesn't forward the address of its
+	// clients. Without it, bound tokens are checked against the address of
+	// the caller of the authenticator, normally the API server.
+	ClientIPHeader string
+
+	// AllowedClockSkew is the difference tolerated between the signing time
+	// of a token and the server clock, so clients whose clocks are slightly
+	// off aren't rejected.
+	AllowedClockSkew time.Duration
+	// MinRemainingValidity, if positive, rejects tokens expiring in less
+	// than this, so retries of the API server don't straddle the expiry of
+	// the token. Clients should report tokens as expiring at least this long
+	// before they do, with aws-iam-authenticator token --refresh-before.
+	MinRemainingValidity time.Duration
+
+	// STSCacheTTL, if non-zero, is how long the identity STS returns for a
+	// token is cached, so clients that resend the same token don't cause
+	// another GetCallerIdentity call. Tokens with a new signature always go
+	// to STS.
+	STSCacheTTL time.Duration
+
+	// STSEndpointHostnames are accepted as token hosts besides the public
+	// STS endpoints, such as the hostnames of STS VPC interface endpoints
+	// (vpce-xxxx.sts.us-east-1.vpce.amazonaws.com) in clusters without
+	// internet access.
+	STSEndpointHostnames []string
+
+	// AllowedSTSRegions, if set, are the only regions tokens may be signed
+	// for, such as those clients presign against with --region. Tokens for
+	// the global STS endpoint are signed for us-east-1.
+	AllowedSTSRegions []string
+
+	// RejectLongLivedKeys denies tokens signed with long-lived access keys
+	// (AKIA...), such as those of IAM users, and only accepts temporary STS
+	// credentials (ASIA...), such as those of assumed roles and SSO.
+	RejectLongLivedKeys bool
+
+	// STSHTTPSProxy is the proxy STS is called through. If it is empty, the
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	STSHTTPSProxy string
+	// STSNoProxy lists STS hosts called directly despite STSHTTPSProxy, such
+	// as VPC endpoints.
+	STSNoProxy []string
+	// STSCABundle is a PEM file of CAs trusted for STS besides the system
+	// ones, such as the CA of a TLS-intercepting egress proxy.
+	STSCABundle string
+	// STSPinnedIPs maps STS host names to the IP addresses they are called
+	// at without resolving them, for VPCs where DNS is slow or unreliable.
+	STSPinnedIPs map[string][]string
+	// STSIPFamily, if set to ipv4 or ipv6, calls STS at addresses of that
+	// family before the others. Otherwise both are raced (happy eyeballs),
+	// the second after STSHappyEyeballsDelay.
+	STSIPFamily           string
+	STSHappyEyeballsDelay time.Duration
+	// STSDialTimeout bounds resolving STS hosts and connecting to them.
+	STSDialTimeout time.Duration
+	// STSEndpointOverride, if set, is the URL tokens are sent to for
+	// verification instead of their STS host, such as a mock STS (see
+	// pkg/ststest) in end-to-end tests and air-gapped demos.
+	STSEndpointOverride string
+	// STSRetries is how many times a throttled or failed (5xx)
+	// GetCallerIdentity call is retried, backing off exponentially from
+	// STSRetryBackoff with jitter. No retry starts later than
+	// STSRetryDeadline after the first call, so TokenReviews are answered
+	// before the API server gives up on the webhook.
+	STSRetries       int
+	STSRetryBackoff  time.Duration
+	STSRetryDeadline time.Duration
+	// AuthenticationTimeout, if positive, bounds the STS calls made to verify
+	// a token, besides the deadline of the request. Tokens that can't be
+	// verified in time are denied with the timeout reason. Keep it below the
+	// webhook timeout of the API server.
+	AuthenticationTimeout time.Duration
+
 	// KubeconfigPregenerated is set to `true` when a webhook kubeconfig is
 	// pre-generated by running the `init` command, and therefore the
 	// `server` shouldn't unnecessarily re-generate a new one.
@@ -86,6 +254,19 @@ type Config struct {
 
 	// HostPort is the TCP Port on which to listen for authentication checks.
 	HostPort int
+	// AuthenticatePaths are the URL paths the authentication webhook is
+	// served on, such as a versioned path next to the old one while the
+	// webhook kubeconfigs of the API servers are migrated. The generated
+	// kubeconfig uses the first. Defaults to /authenticate.
+	AuthenticatePaths []string
+
+	// SocketPath, if set, is a UNIX socket the server listens on for
+	// authentication checks instead of Address and HostPort, for clients on
+	// the same host. The webhook is still served over TLS on it.
+	SocketPath string
+	// SocketMode is the permissions of SocketPath, which control the local
+	// users allowed to connect to it.
+	SocketMode int
 
 	// Hostname is the address clients should use for this server.
 	Hostname string
@@ -108,10 +289,98 @@ type Config struct {
 	// Kubernetes username + groups.
 	UserMappings []UserMapping
 
+	// GRPCPort, if set, is the port the gRPC authentication API is served
+	// on, on Address with the same certificate as the webhook.
+	GRPCPort int
+
+	// DisableKeepAlives closes webhook connections after each request.
+	DisableKeepAlives bool
+	// IdleTimeout, if positive, closes keep-alive connections that have been
+	// idle for this long.
+	IdleTimeout time.Duration
+	// DisableHTTP2 serves the webhook over HTTP/1.1 only. Otherwise API
+	// servers may multiplex concurrent TokenReviews over one connection
+	// with HTTP/2, saving TLS handshakes.
+	DisableHTTP2 bool
+	// HTTP2MaxConcurrentStreams is how many requests a client may send over
+	// one HTTP/2 connection at once, on the webhook and gRPC listeners.
+	HTTP2MaxConcurrentStreams int
+
+	// MetricsPort, if set, is the port Prometheus metrics are served on,
+	// on MetricsAddress, instead of on the webhook listener.
+	MetricsPort int
+	// MetricsAddress is the address of the metrics listener. Empty listens
+	// on all interfaces.
+	MetricsAddress string
+	// MetricsTLSCertFile and MetricsTLSKeyFile, if set, serve the metrics
+	// listener over TLS with this certificate.
+	MetricsTLSCertFile string
+	MetricsTLSKeyFile  string
+	// MetricsBearerTokenFile, if set, holds the bearer token scrapers must
+	// send to the metrics listener.
+	MetricsBearerTokenFile string
+
+	// MappingsTokenFile, if set, holds the bearer token that callers of the
+	// mappings snapshot endpoint must send. The endpoint is disabled
+	// without it.
+	MappingsTokenFile string
+
+	// DebugPort, if set, is the port on localhost pprof profiles, expvar
+	// variables and the loaded mappings are served on under /debug/.
+	DebugPort int
+
+	// AWSAuthValidationWebhook serves a validating admission webhook for the
+	// aws-auth ConfigMap, which rejects edits with invalid mappings.
+	AWSAuthValidationWebhook bool
+
+	// BootstrapWriter enables writing BootstrapRoleMappings to the aws-auth
+	// ConfigMap. The replicas elect one writer among them.
+	BootstrapWriter bool
+	// BootstrapRoleMappings are added to the aws-auth ConfigMap by the
+	// bootstrap writer when their role isn't mapped there yet, e.g. the
+	// instance roles of node groups.
+	BootstrapRoleMappings []RoleMapping
+	// BootstrapWriterInterval is how often the bootstrap writer checks
+	// aws-auth for missing mappings.
+	BootstrapWriterInterval time.Duration
+	// NodeRoleAutoScalingGroups and NodeRoleInstanceTags select the EC2
+	// instances whose instance profile roles the bootstrap writer adds as
+	// node mappings: the instances of the Auto Scaling groups, and those
+	// with all the tags (key=value or key). Names and values can contain *
+	// wildcards.
+	NodeRoleAutoScalingGroups []string
+	NodeRoleInstanceTags      []string
+	// NodeRoleDiscoveryRoleARN is an optional IAM role assumed before
+	// calling ec2:DescribeInstances and iam:GetInstanceProfile to discover
+	// node roles.
+	NodeRoleDiscoveryRoleARN string
+
 	// AutoMappedAWSAccounts is a list of AWS accounts that are allowed without an explicit user/role mapping.
 	// IAM ARN from these accounts automatically maps to the Kubernetes username.
 	AutoMappedAWSAccounts []string
 
+	// AutoMappedOrganizationalUnits are AWS Organizations OU or root IDs
+	// whose active accounts, including those of nested OUs, are allowed
+	// like AutoMappedAWSAccounts by the MountedFile backend. They are listed
+	// again every OrganizationsRefreshInterval, so new member accounts are
+	// trusted automatically.
+	AutoMappedOrganizationalUnits []string
+	// OrganizationsRoleARN is an optional IAM role assumed before calling
+	// Organizations, typically in the management account.
+	OrganizationsRoleARN string
+	// OrganizationsRefreshInterval is how long the accounts of
+	// AutoMappedOrganizationalUnits are cached. Like AccountsFile, they are
+	// used for up to AccountsMaxStale more while Organizations fails.
+	OrganizationsRefreshInterval time.Duration
+
+	// UnmappedAccounts are AWS accounts whose identities, when no backend
+	// maps them, are authenticated as UnmappedUsername with UnmappedGroups
+	// instead of being denied. Both may use the templates of mappings, such
+	// as "aws-unmapped:{{AccountID}}:{{SessionName}}".
+	UnmappedAccounts []string
+	UnmappedUsername string
+	UnmappedGroups   []string
+
 	// ScrubbedAWSAccounts is a list of AWS accounts that the role ARNs and uids
 	// are scrubbed from server log statements
 	ScrubbedAWSAccounts []string
@@ -122,6 +391,87 @@ type Config struct {
 	// running.
 	ServerEC2DescribeInstancesRoleARN string
 
+	// IAMGroupsRoleARN is an optional IAM role assumed before calling
+	// iam:ListGroupsForUser for user mappings with LookupIAMGroups. If
+	// empty, the server's own credentials are used.
+	IAMGroupsRoleARN string
+	// IAMGroupsCacheTTL is how long the IAM groups of a user are cached.
+	IAMGroupsCacheTTL time.Duration
+
+	// RoleInfoExtraDescription and RoleInfoExtraTags add the description
+	// and these tags of the IAM role of authenticated role sessions to the
+	// user extras, from iam:GetRole, for admission controllers.
+	RoleInfoExtraDescription bool
+	RoleInfoExtraTags        []string
+	// RoleInfoRoleARN is an optional IAM role assumed before calling
+	// iam:GetRole for the role extras. Only roles of the account of the
+	// credentials can be described.
+	RoleInfoRoleARN string
+	// RoleInfoCacheTTL is how long the description and tags of a role, or
+	// the failure to get them, are cached.
+	RoleInfoCacheTTL time.Duration
+
+	// RoleTagsRoleARN is an optional IAM role assumed before calling
+	// iam:GetRole for the IAMRoleTags backend. Only roles of the account of
+	// the credentials are mapped.
+	RoleTagsRoleARN string
+	// RoleTagsCacheTTL is how long the IAMRoleTags backend caches the
+	// mapping of a tagged role.
+	RoleTagsCacheTTL time.Duration
+	// RoleTagsNegativeCacheTTL is how long the IAMRoleTags backend caches
+	// that a role doesn't exist or isn't tagged.
+	RoleTagsNegativeCacheTTL time.Duration
+	// RoleTagsAllowedGroups, if set, are the only groups role tags may
+	// grant. Otherwise any group but "system:" ones may be granted.
+	RoleTagsAllowedGroups []string
+
+	// EKSAccessEntriesCluster is the name of the EKS cluster whose access
+	// entries the EKSAccessEntries backend maps.
+	EKSAccessEntriesCluster string
+	// EKSAccessEntriesRegion is the region of EKSAccessEntriesCluster,
+	// defaulting to the region of the SDK's configuration.
+	EKSAccessEntriesRegion string
+	// EKSAccessEntriesRoleARN is an optional IAM role assumed before calling
+	// eks:ListAccessEntries and eks:DescribeAccessEntry, e.g. in the
+	// account of the EKS cluster.
+	EKSAccessEntriesRoleARN string
+	// EKSAccessEntriesRefreshInterval is how often the access entries are
+	// listed again.
+	EKSAccessEntriesRefreshInterval time.Duration
+	// EKSAccessEntriesQueueURL is an optional SQS queue whose messages
+	// notify the EKSAccessEntries backend of changes to the access entries,
+	// which it then lists again without waiting for the refresh interval.
+	EKSAccessEntriesQueueURL string
+
+	// ClientCAFile is an optional path to a PEM bundle of CA certificates. If
+	// set, the HTTPS listener requires clients to present a certificate
+	// signed by one of them, so only the API server can call the webhook.
+	ClientCAFile string
+
+	// TLSSecret is an optional "namespace/name" of a kubernetes.io/tls
+	// Secret, such as one issued by cert-manager, to serve instead of a
+	// self-signed certificate. The Secret is watched for renewals.
+	TLSSecret string
+
+	// CertLifetime is the validity period of generated self-signed
+	// certificates. Zero means the default of 100 years.
+	CertLifetime time.Duration
+	// CertRotateBefore is how long before expiry a generated self-signed
+	// certificate is replaced with a new one. Zero disables rotation.
+	CertRotateBefore time.Duration
+	// CertReloadInterval is how often the certificate and key in StateDir
+	// are checked for changes and nearing expiry. Zero disables reloading.
+	CertReloadInterval time.Duration
+	// ConfigReloadInterval is how often the configuration files are checked
+	// for changes, which are reloaded like on SIGHUP. Zero disables checking.
+	ConfigReloadInterval time.Duration
+
+	// KubeconfigClientCertificate and KubeconfigClientKey are optional paths,
+	// as seen by the API server, of the client certificate and key written
+	// into the generated webhook kubeconfig for use with ClientCAFile.
+	KubeconfigClientCertificate string
+	KubeconfigClientKey         string
+
 	// Address defines the hostname or IP Address to bind the HTTPS server to listen to. This is useful when creating
 	// a local server to handle the authentication request for development.
 	Address string
@@ -135,11 +485,232 @@ type Config struct {
 	// +optional
 	Kubeconfig string
 
+	// KubeAPIQPS and KubeAPIBurst, if positive, override the client-go
+	// defaults limiting the rate of requests to the API server.
+	KubeAPIQPS   float32
+	KubeAPIBurst int
+	// KubeAPIUserAgent, if set, is the user agent of requests to the API
+	// server instead of aws-iam-authenticator/<version>.
+	KubeAPIUserAgent string
+	// KubeAPITimeout, if positive, bounds requests to the API server,
+	// including watches, which are then re-established.
+	KubeAPITimeout time.Duration
+	// KubeAPIRetryMinBackoff and KubeAPIRetryMaxBackoff, if positive, bound
+	// the delay before the EKSConfigMap backend retries a failed or ended
+	// watch. The delay doubles while watches keep failing.
+	KubeAPIRetryMinBackoff time.Duration
+	KubeAPIRetryMaxBackoff time.Duration
+	// KubeAPIOutageThreshold, if positive, is how long the API server may be
+	// unreachable before the EKSConfigMap backend reports it is degraded to
+	// its last known good mappings and retries at KubeAPIRetryMaxBackoff.
+	KubeAPIOutageThreshold time.Duration
+
 	// BackendMode is an ordered list of backends to get mappings from. Comma-delimited list of: MountedFile,EKSConfigMap,CRD
 	BackendMode []string
+	// BackupMappingFile, if set, is a file of break-glass mapRoles and
+	// mapUsers consulted after the backends of BackendMode. It is read once
+	// on startup, never from the cluster, so access can be recovered when
+	// the ConfigMap or CRD backends are corrupted.
+	BackupMappingFile string
+
+	// BackendConfigMapNamespace and BackendConfigMapName locate the ConfigMap
+	// of the EKSConfigMap backend, kube-system/aws-auth if empty. The
+	// bootstrap writer and the validating webhook use the same ConfigMap.
+	BackendConfigMapNamespace string
+	BackendConfigMapName      string
+	// BackendConfigMapSelector, if set, is a label selector of more
+	// ConfigMaps in BackendConfigMapNamespace whose mappings are merged with
+	// those of BackendConfigMapName, so teams can own their mappings. An ARN
+	// mapped by several keeps the mapping of BackendConfigMapName, or else of
+	// the first ConfigMap by name.
+	BackendConfigMapSelector string
+	// ConfigMapDeletionGracePeriod is how long the last mappings of
+	// BackendConfigMapName are kept after it is deleted, so an accidental
+	// deletion doesn't lock everyone out. 0 drops them immediately.
+	ConfigMapDeletionGracePeriod time.Duration
+	// MappingAssertions are checked against each new revision of the
+	// mappings of the EKSConfigMap backend before it is activated. A
+	// revision failing any of them isn't activated, so the previous one
+	// stays in use, and is logged and counted in metrics.
+	MappingAssertions []MappingAssertion
+	// FailOnPartialParse keeps the mappings previously loaded from a
+	// ConfigMap when any of its sections fails to parse, instead of loading
+	// what could be parsed and silently dropping the entries of the broken
+	// section. A ConfigMap that never parsed maps nothing.
+	FailOnPartialParse bool
+	// FailOnUsernameCollisions doesn't activate revisions of the mappings of
+	// the EKSConfigMap backend mapping several ARNs to the same static
+	// username, which are otherwise activated with a warning, as these ARNs
+	// would share the RBAC bindings of the username.
+	FailOnUsernameCollisions bool
+	// KubernetesEvents emits Kubernetes Events on the backend ConfigMaps when
+	// their mappings are loaded, fail to parse, conflict or fail the mapping
+	// assertions, so kubectl describe shows them.
+	KubernetesEvents bool
+	// UnsafeGroupsAction is what happens to identities mapped to groups
+	// starting with one of ReservedGroupPrefixes by a backend other than
+	// MountedFile, which can be edited from within the cluster: "allow",
+	// "warn", which logs and audits them, or "reject", which denies them.
+	UnsafeGroupsAction string
+	// ReservedGroupPrefixes are the groups checked by UnsafeGroupsAction.
+	ReservedGroupPrefixes []string
+	// MaxGroups, MaxGroupNameLength and GroupNamePattern limit the groups
+	// identities are authenticated with, including those of IAM groups.
+	// Zero values are unlimited.
+	MaxGroups          int
+	MaxGroupNameLength int
+	GroupNamePattern   string
+	// GroupLimitsAction is what happens to identities whose groups exceed
+	// the limits: "reject", which denies them, or "truncate", which drops
+	// the groups over the limits.
+	GroupLimitsAction string
+	// StrictARNMatching matches mapped ARNs with the canonical ARN of
+	// identities byte for byte instead of case-insensitively, for
+	// organizations whose policies treat IAM names as case-sensitive. The
+	// IAMRoleTags backend is unaffected, as IAM looks roles up regardless of
+	// case.
+	StrictARNMatching bool
+	// SessionNamePolicies deny role sessions whose name doesn't match the
+	// policies of their role, even if the role is mapped.
+	SessionNamePolicies []SessionNamePolicy
+	// MappingRules map the identities no backend maps, before the
+	// unmapped fallback. The path and tags of roles are looked up with
+	// RoleInfoRoleARN and cached for RoleInfoCacheTTL.
+	MappingRules []MappingRule
+	// PostMappingHookURL is an optional webhook POSTed every mapped identity,
+	// which may change its groups or deny it, so entitlement systems can be
+	// plugged in. PostMappingHookCABundle are CAs it is trusted with besides
+	// the system ones.
+	PostMappingHookURL      string
+	PostMappingHookCABundle string
+	// PostMappingHookTimeout bounds each call to the hook.
+	PostMappingHookTimeout time.Duration
+	// PostMappingHookFailurePolicy is what happens to identities when the
+	// hook fails or times out: "allow", which authenticates them with the
+	// mapped groups, or "deny".
+	PostMappingHookFailurePolicy string
+	// CRDNamespacedMappings makes the CRD backend also map identities with
+	// NamespacedIAMIdentityMappings, whose usernames and groups are prefixed
+	// with "ns:<namespace>:" so namespace owners can manage them. They are
+	// consulted after every other backend.
+	CRDNamespacedMappings bool
+	// CRDNamespacedMappingARNs are the ARNs the NamespacedIAMIdentityMappings
+	// of each namespace may map, keyed by namespace. An ARN ending with * is
+	// a prefix. Mappings of other ARNs are ignored.
+	CRDNamespacedMappingARNs map[string][]string
+	// CRDRoleGCAction, if set, checks the roles of IAMIdentityMappings with
+	// iam:GetRole every CRDRoleGCInterval and acts on those that no longer
+	// exist: "label" labels them, and "delete" also deletes them once their
+	// role has been missing for CRDRoleGCGracePeriod. Only roles of the
+	// account of the credentials, or of the assumed CRDRoleGCRoleARN, are
+	// checked.
+	CRDRoleGCAction      string
+	CRDRoleGCInterval    time.Duration
+	CRDRoleGCGracePeriod time.Duration
+	CRDRoleGCRoleARN     string
+	// ShadowBackendMode is an ordered list of backends evaluated alongside
+	// BackendMode in dry-run. Their results are only compared with the live
+	// mapping, logged and counted, never enforced.
+	ShadowBackendMode []string
 
 	// Ec2 DescribeInstances rate limiting variables initially set to defaults until we completely
 	// understand we don't need to change
 	EC2DescribeInstancesQps   int
 	EC2DescribeInstancesBurst int
+	// AuditLogPath is the file every authentication decision is appended to
+	// as a line of JSON. "-" writes to stdout, empty disables audit logging.
+	AuditLogPath string
+	// AuditLogMaxSize is the size in megabytes at which the audit log is
+	// rotated. Zero disables rotation.
+	AuditLogMaxSize int
+	// AuditLogMaxBackups is the number of rotated audit logs to retain. Zero
+	// retains all of them.
+	AuditLogMaxBackups int
+	// AuditLogMaxAge is the number of days to retain rotated audit logs. Zero
+	// retains them regardless of age.
+	AuditLogMaxAge int
+	// MappingFiles are paths or globs of files of mapRoles, mapUsers and
+	// mapAccounts added to those of the configuration file by the
+	// MountedFile backend. Files can include others with an include list of
+	// paths or globs relative to them, and use the YAML anchors of the files
+	// they include. They are read when the server starts.
+	MappingFiles []string
+	// AccountsFile is a YAML list of account IDs allowed in addition to
+	// AutoMappedAWSAccounts by the MountedFile backend. It is re-read every
+	// AccountsCacheTTL, so accounts can be added without a restart.
+	AccountsFile string
+	// AccountsCacheTTL is how long the AccountsFile allowlist is cached.
+	AccountsCacheTTL time.Duration
+	// AccountsMaxStale is how long past AccountsCacheTTL the cached allowlist
+	// is still used while AccountsFile can't be read. After that account
+	// checks fail instead of answering from a stale list.
+	AccountsMaxStale time.Duration
+	// CircuitBreakerFailureThreshold is the number of consecutive errors
+	// after which a mapper backend is skipped until CircuitBreakerOpenDuration
+	// has passed. Zero disables circuit breaking.
+	CircuitBreakerFailureThreshold int
+	// CircuitBreakerOpenDuration is how long a tripped backend is skipped
+	// before a single probe request is sent to it again.
+	CircuitBreakerOpenDuration time.Duration
+	// TracingOTLPEndpoint is the base URL of an OTLP/HTTP collector that
+	// authentication trace spans are exported to. Empty disables tracing.
+	TracingOTLPEndpoint string
+	// TracingSampleRatio is the fraction of authentication requests that are
+	// traced when the caller did not send a sampled trace context.
+	TracingSampleRatio float64
+	// AuditAnnotations adds the original ARN, the mapper backend that mapped
+	// the identity and the STS verification latency to the user extras under
+	// authentication.kubernetes.io/ keys, so they appear in the API server's
+	// audit log.
+	AuditAnnotations bool
+	// IdentityExtras adds the caller's AWS ARN, canonical ARN, account ID,
+	// session name and access key ID to the user extras, so admission
+	// controllers and the API server's audit log see the original AWS
+	// identity. Mappings can turn it on or off for themselves.
+	IdentityExtras bool
+	// ValidateAudiences requires the cluster ID a token was signed for to be
+	// one of the audiences of TokenReviews that request audiences, as the
+	// apiserver does when it runs with --api-audiences. The cluster ID is
+	// returned as the audience the token is valid for.
+	ValidateAudiences bool
+	// ReplayDetection records verified tokens until they expire, rejecting
+	// them as ReplayMaxUses and ReplayBindSource say.
+	ReplayDetection bool
+	// ReplayMaxUses rejects a token after this many uses when
+	// ReplayDetection is enabled. Zero allows unlimited uses.
+	ReplayMaxUses int
+	// ReplayBindSource rejects a token presented again from a different
+	// client IP than its first use when ReplayDetection is enabled. Without
+	// ClientIPHeader the client is the API server, so it rejects tokens
+	// legitimately reused against another API server of an HA control
+	// plane.
+	ReplayBindSource bool
+	// NegativeCacheTTL is how long tokens whose identity isn't mapped are
+	// rejected without verifying them with STS again, plus up to 20% jitter.
+	// Zero disables the cache.
+	NegativeCacheTTL time.Duration
+	// ShutdownGracePeriod is how long the requests in flight are given to
+	// finish when the server is stopped, after it stops accepting
+	// connections.
+	ShutdownGracePeriod time.Duration
+	// SharedCacheURL, if set, is a Redis ("redis://", "rediss://") or
+	// memcached ("memcached://") server the STS cache and replay detection
+	// are shared through, so they are consistent across replicas. Anyone
+	// who can write to it can make the server accept arbitrary identities.
+	SharedCacheURL string
+	// SharedCacheTimeout bounds each request to the shared cache. The local
+	// caches are used when it fails.
+	SharedCacheTimeout time.Duration
+	// RateLimitQPS and RateLimitBurst limit the rate of authenticate
+	// requests from all sources combined. Zero QPS disables the limit.
+	RateLimitQPS   int
+	RateLimitBurst int
+	// RateLimitPerSourceQPS and RateLimitPerSourceBurst limit the rate of
+	// authenticate requests from a single source IP. Zero QPS disables the
+	// limit.
+	RateLimitPerSourceQPS   int
+	RateLimitPerSourceBurst int
+	// MaxInFlightRequests limits the number of authenticate requests served
+	// concurrently. Zero disables the limit.
+	MaxInFlightRequests int
 }
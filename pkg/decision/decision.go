@@ -0,0 +1,196 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package decision holds the pure authentication decision logic: canonicalize
+// the caller ARN, match it against the identity mappings, render the username
+// and group templates and apply the account policy.
+//
+// The server renders templates through this package and mapping ARNs are
+// keyed like the server's backends key them, so its results are identical to
+// the server's. It depends on no Kubernetes or AWS clients and
+// can be compiled to WebAssembly (see cmd/decision-wasm) for tools that need
+// to answer "would this ARN get access".
+package decision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+)
+
+// Reasons reported in a Decision.
+const (
+	ReasonMapped         = "mapped"
+	ReasonAccountAllowed = "account_allowed"
+	ReasonNotMapped      = "not_mapped"
+)
+
+// Pattern to match EC2 instance IDs
+var instanceIDPattern = regexp.MustCompile("^i-(\\w{8}|\\w{17})$")
+
+// Mapping maps an IAM role or user ARN to a username and groups, which may
+// contain template parameters.
+type Mapping struct {
+	ARN      string   `json:"arn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+	// NotAfter, if set, is when the mapping expires. Expired mappings are
+	// ignored.
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+}
+
+// Rules are the mappings and auto-mapped accounts to evaluate against.
+type Rules struct {
+	Mappings []Mapping `json:"mappings"`
+	Accounts []string  `json:"accounts"`
+	// StrictARNMatching matches ARNs case-sensitively, like the server's
+	// strictARNMatching.
+	StrictARNMatching bool `json:"strictARNMatching,omitempty"`
+	// SSORoleCanonicalization matches the roles of IAM Identity Center
+	// without their path, like the server's SSORoleCanonicalization feature
+	// gate.
+	SSORoleCanonicalization bool `json:"ssoRoleCanonicalization,omitempty"`
+}
+
+// Identity is the caller identity as verified by STS.
+type Identity struct {
+	ARN         string `json:"arn"`
+	AccountID   string `json:"accountID"`
+	UserID      string `json:"userID"`
+	SessionName string `json:"sessionName"`
+	AccessKeyID string `json:"accessKeyID"`
+}
+
+// Decision is the outcome of evaluating an Identity against Rules.
+type Decision struct {
+	Allowed      bool     `json:"allowed"`
+	CanonicalARN string   `json:"canonicalARN"`
+	Username     string   `json:"username,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	Reason       string   `json:"reason"`
+}
+
+// PrivateDNSResolver returns the private DNS name of an EC2 instance, used to
+// render {{EC2PrivateDNSName}}. It may be nil if no resolver is available.
+type PrivateDNSResolver func(instanceID string) (string, error)
+
+// Evaluate decides whether identity is authenticated by rules now, and as
+// whom.
+func Evaluate(rules Rules, identity Identity, resolve PrivateDNSResolver) (Decision, error) {
+	canonicalARN, err := arn.Canonicalize(identity.ARN)
+	if err != nil {
+		return Decision{}, err
+	}
+	d := Decision{CanonicalARN: canonicalARN, Reason: ReasonNotMapped}
+
+	mapping, err := Match(rules, canonicalARN, time.Now())
+	if err != nil {
+		return d, err
+	}
+	if mapping != nil {
+		username, groups, err := Render(mapping.Username, mapping.Groups, identity, resolve)
+		if err != nil {
+			return d, err
+		}
+		d.Allowed = true
+		d.Username = username
+		d.Groups = groups
+		d.Reason = ReasonMapped
+		return d, nil
+	}
+
+	for _, account := range rules.Accounts {
+		if account == identity.AccountID {
+			d.Allowed = true
+			d.Username = canonicalARN
+			d.Groups = []string{}
+			d.Reason = ReasonAccountAllowed
+			return d, nil
+		}
+	}
+	return d, nil
+}
+
+// Match returns the mapping of rules for canonicalARN that hasn't expired at
+// now, or nil if there is none. ARNs are compared by their arn.Key after
+// canonicalization, as the server's backends compare them, following the
+// StrictARNMatching and SSORoleCanonicalization settings of rules.
+func Match(rules Rules, canonicalARN string, now time.Time) (*Mapping, error) {
+	mappings := rules.Mappings
+	canonicalARN = arn.Key(canonicalARN, rules.StrictARNMatching, rules.SSORoleCanonicalization)
+	for i := range mappings {
+		if mappings[i].NotAfter != nil && now.After(*mappings[i].NotAfter) {
+			continue
+		}
+		mappingARN, err := arn.Canonicalize(arn.Key(mappings[i].ARN, rules.StrictARNMatching, rules.SSORoleCanonicalization))
+		if err != nil {
+			return nil, fmt.Errorf("error canonicalizing ARN: %v", err)
+		}
+		if mappingARN == canonicalARN {
+			return &mappings[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Render renders the username and group templates of a mapping.
+func Render(username string, groups []string, identity Identity, resolve PrivateDNSResolver) (string, []string, error) {
+	renderedUsername, err := RenderTemplate(username, identity, resolve)
+	if err != nil {
+		return "", nil, fmt.Errorf("error rendering username template %q: %s", username, err.Error())
+	}
+
+	renderedGroups := []string{}
+	for _, groupPattern := range groups {
+		group, err := RenderTemplate(groupPattern, identity, resolve)
+		if err != nil {
+			return "", nil, fmt.Errorf("error rendering group template %q: %s", groupPattern, err.Error())
+		}
+		renderedGroups = append(renderedGroups, group)
+	}
+
+	return renderedUsername, renderedGroups, nil
+}
+
+// RenderTemplate replaces the template parameters in template with values
+// from identity.
+func RenderTemplate(template string, identity Identity, resolve PrivateDNSResolver) (string, error) {
+	// Private DNS requires EC2 API call
+	if strings.Contains(template, "{{EC2PrivateDNSName}}") {
+		if !instanceIDPattern.MatchString(identity.SessionName) {
+			return "", fmt.Errorf("SessionName did not contain an instance id")
+		}
+		if resolve == nil {
+			return "", fmt.Errorf("EC2PrivateDNSName cannot be resolved here")
+		}
+		privateDNSName, err := resolve(identity.SessionName)
+		if err != nil {
+			return "", err
+		}
+		template = strings.Replace(template, "{{EC2PrivateDNSName}}", privateDNSName, -1)
+	}
+
+	template = strings.Replace(template, "{{AccountID}}", identity.AccountID, -1)
+	sessionName := strings.Replace(identity.SessionName, "@", "-", -1)
+	template = strings.Replace(template, "{{SessionName}}", sessionName, -1)
+	template = strings.Replace(template, "{{SessionNameRaw}}", identity.SessionName, -1)
+	template = strings.Replace(template, "{{AccessKeyID}}", identity.AccessKeyID, -1)
+
+	return template, nil
+}
@@ -0,0 +1,155 @@
+package decision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	rules := Rules{
+		Mappings: []Mapping{
+			{
+				ARN:      "arn:aws:iam::123456789012:role/Admin",
+				Username: "admin:{{SessionName}}",
+				Groups:   []string{"system:masters"},
+			},
+			{
+				ARN:      "arn:aws:iam::123456789012:role/Nodes",
+				Username: "system:node:{{EC2PrivateDNSName}}",
+				Groups:   []string{"system:bootstrappers", "system:nodes"},
+			},
+			{
+				ARN:      "arn:aws:iam::123456789012:user/Alice",
+				Username: "alice",
+				Groups:   []string{"{{AccountID}}-devs"},
+			},
+		},
+		Accounts: []string{"999999999999"},
+	}
+	resolve := func(instanceID string) (string, error) {
+		return "ip-10-0-0-1.ec2.internal", nil
+	}
+
+	cases := []struct {
+		identity Identity
+		want     Decision
+		err      bool
+	}{
+		{
+			identity: Identity{ARN: "arn:aws:sts::123456789012:assumed-role/admin/jane@example.com", AccountID: "123456789012", SessionName: "jane@example.com"},
+			want: Decision{
+				Allowed:      true,
+				CanonicalARN: "arn:aws:iam::123456789012:role/admin",
+				Username:     "admin:jane-example.com",
+				Groups:       []string{"system:masters"},
+				Reason:       ReasonMapped,
+			},
+		},
+		{
+			identity: Identity{ARN: "arn:aws:sts::123456789012:assumed-role/Nodes/i-0123456789abcdef0", AccountID: "123456789012", SessionName: "i-0123456789abcdef0"},
+			want: Decision{
+				Allowed:      true,
+				CanonicalARN: "arn:aws:iam::123456789012:role/Nodes",
+				Username:     "system:node:ip-10-0-0-1.ec2.internal",
+				Groups:       []string{"system:bootstrappers", "system:nodes"},
+				Reason:       ReasonMapped,
+			},
+		},
+		{
+			identity: Identity{ARN: "arn:aws:iam::123456789012:user/Alice", AccountID: "123456789012"},
+			want: Decision{
+				Allowed:      true,
+				CanonicalARN: "arn:aws:iam::123456789012:user/Alice",
+				Username:     "alice",
+				Groups:       []string{"123456789012-devs"},
+				Reason:       ReasonMapped,
+			},
+		},
+		{
+			identity: Identity{ARN: "arn:aws:iam::999999999999:user/Bob", AccountID: "999999999999"},
+			want: Decision{
+				Allowed:      true,
+				CanonicalARN: "arn:aws:iam::999999999999:user/Bob",
+				Username:     "arn:aws:iam::999999999999:user/Bob",
+				Groups:       []string{},
+				Reason:       ReasonAccountAllowed,
+			},
+		},
+		{
+			identity: Identity{ARN: "arn:aws:iam::123456789012:user/Mallory", AccountID: "123456789012"},
+			want: Decision{
+				CanonicalARN: "arn:aws:iam::123456789012:user/Mallory",
+				Reason:       ReasonNotMapped,
+			},
+		},
+		{
+			identity: Identity{ARN: "not-an-arn"},
+			err:      true,
+		},
+	}
+	for _, c := range cases {
+		got, err := Evaluate(rules, c.identity, resolve)
+		if (err != nil) != c.err {
+			t.Errorf("%s: expected error %t, got %v", c.identity.ARN, c.err, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %+v, got %+v", c.identity.ARN, c.want, got)
+		}
+	}
+}
+
+func TestRenderTemplatePrivateDNSName(t *testing.T) {
+	identity := Identity{SessionName: "i-aaaaaaaa"}
+	if _, err := RenderTemplate("{{EC2PrivateDNSName}}", identity, nil); err == nil {
+		t.Errorf("expected an error without a resolver")
+	}
+	failing := func(string) (string, error) { return "", errors.New("throttled") }
+	if _, err := RenderTemplate("{{EC2PrivateDNSName}}", identity, failing); err == nil || err.Error() != "throttled" {
+		t.Errorf("expected the resolver error, got %v", err)
+	}
+	if got, err := RenderTemplate("{{SessionNameRaw}}", identity, nil); err != nil || got != "i-aaaaaaaa" {
+		t.Errorf("expected templates without EC2PrivateDNSName to render without a resolver, got %q, %v", got, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	mappings := []Mapping{
+		{ARN: "arn:aws:iam::123456789012:role/Expired", Username: "expired", NotAfter: &past},
+		{ARN: "arn:aws:iam::123456789012:role/Admin", Username: "admin", NotAfter: &future},
+		{ARN: "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Admin_0123456789abcdef", Username: "sso"},
+	}
+
+	cases := []struct {
+		canonicalARN string
+		strict       bool
+		sso          bool
+		want         string
+	}{
+		{canonicalARN: "arn:aws:iam::123456789012:role/Expired"},
+		{canonicalARN: "arn:aws:iam::123456789012:role/admin", want: "admin"},
+		{canonicalARN: "arn:aws:iam::123456789012:role/admin", strict: true},
+		{canonicalARN: "arn:aws:iam::123456789012:role/Admin", strict: true, want: "admin"},
+		{canonicalARN: "arn:aws:iam::123456789012:role/AWSReservedSSO_Admin_0123456789abcdef"},
+		{canonicalARN: "arn:aws:iam::123456789012:role/AWSReservedSSO_Admin_0123456789abcdef", sso: true, want: "sso"},
+	}
+	for _, c := range cases {
+		rules := Rules{Mappings: mappings, StrictARNMatching: c.strict, SSORoleCanonicalization: c.sso}
+		m, err := Match(rules, c.canonicalARN, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.canonicalARN, err)
+			continue
+		}
+		var got string
+		if m != nil {
+			got = m.Username
+		}
+		if got != c.want {
+			t.Errorf("%s (strict %t, sso %t): expected %q, got %q", c.canonicalARN, c.strict, c.sso, c.want, got)
+		}
+	}
+}
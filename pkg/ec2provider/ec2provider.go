@@ -19,8 +19,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/aws-iam-authenticator/pkg"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 )
 
+var logger = logging.For(logging.ComponentServer)
+
 const (
 	// max limit of k8s nodes support
 	maxChannelSize = 8000
@@ -92,20 +95,20 @@ func newSession(roleARN string, qps int, burst int) *session.Session {
 		ec2metadata := ec2metadata.New(sess)
 		regionFound, err := ec2metadata.Region()
 		if err != nil {
-			logrus.WithError(err).Fatal("Region not found in shared credentials, environment variable, or instance metadata.")
+			logger.WithError(err).Fatal("Region not found in shared credentials, environment variable, or instance metadata.")
 		}
 		sess.Config.Region = aws.String(regionFound)
 	}
 
 	if roleARN != "" {
-		logrus.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"roleARN": roleARN,
 		}).Infof("Using assumed role for EC2 API")
 
 		rateLimitedClient, err := httputil.NewRateLimitedClient(qps, burst)
 
 		if err != nil {
-			logrus.Errorf("Getting error = %s while creating rate limited client ", err)
+			logger.Errorf("Getting error = %s while creating rate limited client ", err)
 		}
 
 		ap := &stscreds.AssumeRoleProvider{
@@ -168,10 +171,10 @@ func (p *ec2ProviderImpl) GetPrivateDNSName(id string) (string, error) {
 	if err == nil {
 		return privateDNSName, nil
 	}
-	logrus.Debugf("Missed the cache for the InstanceId = %s Verifying if its already in requestQueue ", id)
+	logger.Debugf("Missed the cache for the InstanceId = %s Verifying if its already in requestQueue ", id)
 	// check if the request for instanceId already in queue.
 	if p.getRequestInFlightForInstanceId(id) {
-		logrus.Debugf("Found the InstanceId:= %s request In Queue waiting in 5 seconds loop ", id)
+		logger.Debugf("Found the InstanceId:= %s request In Queue waiting in 5 seconds loop ", id)
 		for i := 0; i < totalIterationForWaitInterval; i++ {
 			time.Sleep(defaultWaitInterval)
 			privateDNSName, err := p.getPrivateDNSNameCache(id)
@@ -181,18 +184,18 @@ func (p *ec2ProviderImpl) GetPrivateDNSName(id string) (string, error) {
 		}
 		return "", fmt.Errorf("failed to find node %s in PrivateDNSNameCache returning from loop", id)
 	}
-	logrus.Debugf("Missed the requestQueue cache for the InstanceId = %s", id)
+	logger.Debugf("Missed the requestQueue cache for the InstanceId = %s", id)
 	p.setRequestInFlightForInstanceId(id)
 	requestQueueLength := p.getRequestInFlightSize()
 	//The code verifies if the requestQuqueMap size is greater than max request in flight with rate
 	//limiting then writes to the channel where we are making batch ec2:DescribeInstances API call.
 	if requestQueueLength > maxAllowedInflightRequest {
-		logrus.Debugf("Writing to buffered channel for instance Id %s ", id)
+		logger.Debugf("Writing to buffered channel for instance Id %s ", id)
 		p.instanceIdsChannel <- id
 		return p.GetPrivateDNSName(id)
 	}
 
-	logrus.Infof("Calling ec2:DescribeInstances for the InstanceId = %s ", id)
+	logger.Infof("Calling ec2:DescribeInstances for the InstanceId = %s ", id)
 	// Look up instance from EC2 API
 	output, err := p.ec2.DescribeInstances(&ec2.DescribeInstancesInput{
 		InstanceIds: aws.StringSlice([]string{id}),
@@ -224,7 +227,7 @@ func (p *ec2ProviderImpl) StartEc2DescribeBatchProcessing() {
 		var instanceId string
 		select {
 		case instanceId = <-p.instanceIdsChannel:
-			logrus.Debugf("Received the Instance Id := %s from buffered Channel for batch processing ", instanceId)
+			logger.Debugf("Received the Instance Id := %s from buffered Channel for batch processing ", instanceId)
 			instanceIdList = append(instanceIdList, instanceId)
 		default:
 			// Waiting for more elements to get added to the buffered Channel
@@ -253,17 +256,17 @@ func (p *ec2ProviderImpl) StartEc2DescribeBatchProcessing() {
 
 func (p *ec2ProviderImpl) getPrivateDnsAndPublishToCache(instanceIdList []string) {
 	// Look up instance from EC2 API
-	logrus.Infof("Making Batch Query to DescribeInstances for %v instances ", len(instanceIdList))
+	logger.Infof("Making Batch Query to DescribeInstances for %v instances ", len(instanceIdList))
 	output, err := p.ec2.DescribeInstances(&ec2.DescribeInstancesInput{
 		InstanceIds: aws.StringSlice(instanceIdList),
 	})
 	if err != nil {
-		logrus.Errorf("Batch call failed querying private DNS from EC2 API for nodes [%s] : with error = []%s ", instanceIdList, err.Error())
+		logger.Errorf("Batch call failed querying private DNS from EC2 API for nodes [%s] : with error = []%s ", instanceIdList, err.Error())
 	} else {
 		if output.NextToken != nil {
-			logrus.Debugf("Successfully got the batch result , output.NextToken = %s ", *output.NextToken)
+			logger.Debugf("Successfully got the batch result , output.NextToken = %s ", *output.NextToken)
 		} else {
-			logrus.Debugf("Successfully got the batch result , output.NextToken is nil ")
+			logger.Debugf("Successfully got the batch result , output.NextToken is nil ")
 		}
 		// Adding the result to privateDNSChache as well as removing from the requestQueueMap.
 		for _, reservation := range output.Reservations {
@@ -275,7 +278,7 @@ func (p *ec2ProviderImpl) getPrivateDnsAndPublishToCache(instanceIdList []string
 		}
 	}
 
-	logrus.Debugf("Removing instances from request Queue after getting response from Ec2")
+	logger.Debugf("Removing instances from request Queue after getting response from Ec2")
 	for _, id := range instanceIdList {
 		p.unsetRequestInFlightForInstanceId(id)
 	}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eksapi is a minimal client of the EKS API for reading the access
+// entries of a cluster. The SDK's EKS package isn't vendored, so the client
+// is set up the way the generated service clients are, with the REST
+// protocol's request building and JSON responses.
+package eksapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/private/protocol/rest"
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+)
+
+const (
+	serviceID  = "eks"
+	apiVersion = "2017-11-01"
+)
+
+// ErrNotFound is returned when the cluster or access entry doesn't exist.
+var ErrNotFound = errors.New("EKS resource not found")
+
+// Client calls the EKS API.
+type Client struct {
+	*client.Client
+}
+
+// New creates a Client for the EKS endpoint of region, or of the SDK's
+// default region if empty, using the SDK's default credential chain or the
+// role of roleARN assumed with them.
+func New(region, roleARN string) *Client {
+	cfg := aws.NewConfig()
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "authenticatorUserAgent",
+		Fn: request.MakeAddToUserAgentHandler(
+			"aws-iam-authenticator", pkg.Version),
+	})
+	var cfgs []*aws.Config
+	if roleARN != "" {
+		cfgs = append(cfgs, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, roleARN)))
+	}
+	return NewFromConfigProvider(sess, cfgs...)
+}
+
+// NewFromConfigProvider creates a Client from a session, like the
+// constructors of the SDK's service clients.
+func NewFromConfigProvider(p client.ConfigProvider, cfgs ...*aws.Config) *Client {
+	c := p.ClientConfig(serviceID, cfgs...)
+	cl := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   serviceID,
+			ServiceID:     "EKS",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			PartitionID:   c.PartitionID,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+	cl.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	cl.Handlers.Build.PushBackNamed(rest.BuildHandler)
+	cl.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "eksapi.Unmarshal", Fn: unmarshal})
+	cl.Handlers.UnmarshalError.PushBackNamed(request.NamedHandler{Name: "eksapi.UnmarshalError", Fn: unmarshalError})
+	return &Client{cl}
+}
+
+func unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	if err := jsonutil.UnmarshalJSON(r.Data, r.HTTPResponse.Body); err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed decoding JSON response", err)
+	}
+}
+
+func unmarshalError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	body, err := ioutil.ReadAll(r.HTTPResponse.Body)
+	if err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed reading error response", err)
+		return
+	}
+	var resp struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &resp)
+	// The type is followed by a documentation URL, e.g.
+	// "ResourceNotFoundException:http://internal.amazon.com/...".
+	code := r.HTTPResponse.Header.Get("X-Amzn-Errortype")
+	if i := strings.Index(code, ":"); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" {
+		code = "UnknownError"
+	}
+	r.Error = awserr.NewRequestFailure(awserr.New(code, resp.Message, nil), r.HTTPResponse.StatusCode, r.RequestID)
+}
+
+// send sends the operation name with input and decodes the response into
+// output. A ResourceNotFoundException is returned as ErrNotFound.
+func (c *Client) send(name, path string, input, output interface{}) error {
+	req := c.NewRequest(&request.Operation{
+		Name:       name,
+		HTTPMethod: "GET",
+		HTTPPath:   path,
+	}, input, output)
+	err := req.Send()
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ResourceNotFoundException" {
+		return ErrNotFound
+	}
+	return err
+}
+
+type listAccessEntriesInput struct {
+	_ struct{} `type:"structure" nopayload:"true"`
+
+	ClusterName *string `location:"uri" locationName:"name" type:"string" required:"true"`
+	MaxResults  *int64  `location:"querystring" locationName:"maxResults" type:"integer"`
+	NextToken   *string `location:"querystring" locationName:"nextToken" type:"string"`
+}
+
+type listAccessEntriesOutput struct {
+	_ struct{} `type:"structure"`
+
+	AccessEntries []*string `locationName:"accessEntries" type:"list"`
+	NextToken     *string   `locationName:"nextToken" type:"string"`
+}
+
+// ListAccessEntries returns the principal ARNs of the access entries of
+// cluster, following pagination.
+func (c *Client) ListAccessEntries(cluster string) ([]string, error) {
+	var arns []string
+	input := &listAccessEntriesInput{ClusterName: aws.String(cluster), MaxResults: aws.Int64(100)}
+	for {
+		output := &listAccessEntriesOutput{}
+		if err := c.send("ListAccessEntries", "/clusters/{name}/access-entries", input, output); err != nil {
+			return nil, fmt.Errorf("could not list the access entries of EKS cluster %q: %w", cluster, err)
+		}
+		arns = append(arns, aws.StringValueSlice(output.AccessEntries)...)
+		if aws.StringValue(output.NextToken) == "" {
+			return arns, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+type describeAccessEntryInput struct {
+	_ struct{} `type:"structure" nopayload:"true"`
+
+	ClusterName  *string `location:"uri" locationName:"name" type:"string" required:"true"`
+	PrincipalArn *string `location:"uri" locationName:"principalArn" type:"string" required:"true"`
+}
+
+type describeAccessEntryOutput struct {
+	_ struct{} `type:"structure"`
+
+	AccessEntry *accessEntry `locationName:"accessEntry" type:"structure"`
+}
+
+type accessEntry struct {
+	_ struct{} `type:"structure"`
+
+	KubernetesGroups []*string `locationName:"kubernetesGroups" type:"list"`
+	PrincipalArn     *string   `locationName:"principalArn" type:"string"`
+	Type             *string   `locationName:"type" type:"string"`
+	Username         *string   `locationName:"username" type:"string"`
+}
+
+// Types of access entries.
+const (
+	AccessEntryTypeStandard     = "STANDARD"
+	AccessEntryTypeEC2Linux     = "EC2_LINUX"
+	AccessEntryTypeEC2Windows   = "EC2_WINDOWS"
+	AccessEntryTypeFargateLinux = "FARGATE_LINUX"
+)
+
+// AccessEntry is an access entry of a cluster returned by
+// DescribeAccessEntry.
+type AccessEntry struct {
+	// PrincipalARN is the ARN of the IAM user or role, including its path.
+	PrincipalARN string
+	// Type is one of the AccessEntryType constants, or a type added to EKS
+	// later.
+	Type string
+	// Username is the Kubernetes username of the principal, which EKS
+	// defaults for the type if it wasn't set.
+	Username string
+	// KubernetesGroups are the groups of the principal. Node and Fargate
+	// entries have none; EKS grants them the groups of nodes implicitly.
+	KubernetesGroups []string
+}
+
+// DescribeAccessEntry returns the access entry of principalARN in cluster.
+func (c *Client) DescribeAccessEntry(cluster, principalARN string) (*AccessEntry, error) {
+	output := &describeAccessEntryOutput{}
+	input := &describeAccessEntryInput{ClusterName: aws.String(cluster), PrincipalArn: aws.String(principalARN)}
+	if err := c.send("DescribeAccessEntry", "/clusters/{name}/access-entries/{principalArn}", input, output); err != nil {
+		return nil, fmt.Errorf("could not describe the access entry of %q: %w", principalARN, err)
+	}
+	if output.AccessEntry == nil {
+		return nil, fmt.Errorf("could not describe the access entry of %q: %w", principalARN, ErrNotFound)
+	}
+	return &AccessEntry{
+		PrincipalARN:     aws.StringValue(output.AccessEntry.PrincipalArn),
+		Type:             aws.StringValue(output.AccessEntry.Type),
+		Username:         aws.StringValue(output.AccessEntry.Username),
+		KubernetesGroups: aws.StringValueSlice(output.AccessEntry.KubernetesGroups),
+	}, nil
+}
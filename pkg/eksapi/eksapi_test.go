@@ -0,0 +1,101 @@
+package eksapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// testClient returns a Client of an EKS endpoint answering each request with
+// the next of responses, or a ResourceNotFoundException for an empty one.
+// The escaped paths and queries of the requests are appended to requests.
+func testClient(requests *[]string, responses ...string) (*Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.URL.EscapedPath()
+		if r.URL.RawQuery != "" {
+			request += "?" + r.URL.RawQuery
+		}
+		*requests = append(*requests, request)
+		response := responses[len(*requests)-1]
+		if response == "" {
+			w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException:http://internal.amazon.com/coral/com.amazonaws.eks/")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No cluster found for name: missing."}`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+	}))
+	return NewFromConfigProvider(sess), server.Close
+}
+
+func TestListAccessEntries(t *testing.T) {
+	var requests []string
+	c, done := testClient(&requests,
+		`{"accessEntries":["arn:aws:iam::123456789012:role/Admin"],"nextToken":"page2"}`,
+		`{"accessEntries":["arn:aws:iam::123456789012:user/Alice"]}`,
+	)
+	defer done()
+
+	arns, err := c.ListAccessEntries("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::123456789012:user/Alice"}
+	if !reflect.DeepEqual(arns, expected) {
+		t.Errorf("expected %v, got %v", expected, arns)
+	}
+	expectedRequests := []string{
+		"/clusters/prod/access-entries?maxResults=100",
+		"/clusters/prod/access-entries?maxResults=100&nextToken=page2",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("expected requests %v, got %v", expectedRequests, requests)
+	}
+}
+
+func TestListAccessEntriesNotFound(t *testing.T) {
+	var requests []string
+	c, done := testClient(&requests, "")
+	defer done()
+
+	if _, err := c.ListAccessEntries("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDescribeAccessEntry(t *testing.T) {
+	var requests []string
+	c, done := testClient(&requests,
+		`{"accessEntry":{"clusterName":"prod","principalArn":"arn:aws:iam::123456789012:role/teams/Dev","kubernetesGroups":["dev"],"type":"STANDARD","username":"dev-{{SessionName}}"}}`,
+	)
+	defer done()
+
+	entry, err := c.DescribeAccessEntry("prod", "arn:aws:iam::123456789012:role/teams/Dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &AccessEntry{
+		PrincipalARN:     "arn:aws:iam::123456789012:role/teams/Dev",
+		Type:             AccessEntryTypeStandard,
+		Username:         "dev-{{SessionName}}",
+		KubernetesGroups: []string{"dev"},
+	}
+	if !reflect.DeepEqual(entry, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entry)
+	}
+	if expectedPath := "/clusters/prod/access-entries/arn%3Aaws%3Aiam%3A%3A123456789012%3Arole%2Fteams%2FDev"; requests[0] != expectedPath {
+		t.Errorf("expected request %s, got %s", expectedPath, requests[0])
+	}
+}
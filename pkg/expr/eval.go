@@ -0,0 +1,458 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type node interface {
+	eval(vars Activation) (interface{}, error)
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (n *literal) eval(Activation) (interface{}, error) {
+	return n.v, nil
+}
+
+type variable struct {
+	name string
+}
+
+func (n *variable) eval(vars Activation) (interface{}, error) {
+	v, err := vars(n.name)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(v)
+}
+
+type list struct {
+	elems []node
+}
+
+func (n *list) eval(vars Activation) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.elems))
+	for _, elem := range n.elems {
+		v, err := elem.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (n *unary) eval(vars Activation) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch v := x.(type) {
+	case bool:
+		if n.op == "!" {
+			return !v, nil
+		}
+	case int64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("no such overload: %s%s", n.op, typeName(x))
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (n *binary) eval(vars Activation) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// && and || short-circuit
+	if n.op == "&&" || n.op == "||" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("no such overload: %s %s ...", typeName(x), n.op)
+		}
+		if b == (n.op == "||") {
+			return b, nil
+		}
+		y, err := n.y.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := y.(bool); !ok {
+			return nil, fmt.Errorf("no such overload: bool %s %s", n.op, typeName(y))
+		}
+		return y, nil
+	}
+	y, err := n.y.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(x, y), nil
+	case "!=":
+		return !reflect.DeepEqual(x, y), nil
+	case "in":
+		switch container := y.(type) {
+		case []interface{}:
+			for _, elem := range container {
+				if reflect.DeepEqual(elem, x) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			if key, ok := x.(string); ok {
+				_, found := container[key]
+				return found, nil
+			}
+		}
+	case "+":
+		switch xv := x.(type) {
+		case int64:
+			if yv, ok := y.(int64); ok {
+				return xv + yv, nil
+			}
+		case string:
+			if yv, ok := y.(string); ok {
+				return xv + yv, nil
+			}
+		case []interface{}:
+			if yv, ok := y.([]interface{}); ok {
+				return append(append([]interface{}{}, xv...), yv...), nil
+			}
+		}
+	case "-":
+		xv, xok := x.(int64)
+		yv, yok := y.(int64)
+		if xok && yok {
+			return xv - yv, nil
+		}
+	case "<", "<=", ">", ">=":
+		if cmp, ok := compare(x, y); ok {
+			switch n.op {
+			case "<":
+				return cmp < 0, nil
+			case "<=":
+				return cmp <= 0, nil
+			case ">":
+				return cmp > 0, nil
+			default:
+				return cmp >= 0, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no such overload: %s %s %s", typeName(x), n.op, typeName(y))
+}
+
+// compare orders two ints or two strings.
+func compare(x, y interface{}) (int, bool) {
+	switch xv := x.(type) {
+	case int64:
+		if yv, ok := y.(int64); ok {
+			switch {
+			case xv < yv:
+				return -1, true
+			case xv > yv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if yv, ok := y.(string); ok {
+			return strings.Compare(xv, yv), true
+		}
+	}
+	return 0, false
+}
+
+type conditional struct {
+	cond, then, otherwise node
+}
+
+func (n *conditional) eval(vars Activation) (interface{}, error) {
+	cond, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := cond.(bool)
+	if !ok {
+		return nil, fmt.Errorf("no such overload: %s ? ... : ...", typeName(cond))
+	}
+	if b {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+type index struct {
+	x, i node
+}
+
+func (n *index) eval(vars Activation) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.i.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch container := x.(type) {
+	case []interface{}:
+		if pos, ok := i.(int64); ok {
+			if pos < 0 || pos >= int64(len(container)) {
+				return nil, fmt.Errorf("index out of range: %d", pos)
+			}
+			return container[pos], nil
+		}
+	case map[string]interface{}:
+		if key, ok := i.(string); ok {
+			return lookupKey(container, key)
+		}
+	}
+	return nil, fmt.Errorf("no such overload: %s[%s]", typeName(x), typeName(i))
+}
+
+type selection struct {
+	x     node
+	field string
+}
+
+func (n *selection) eval(vars Activation) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no such overload: %s.%s", typeName(x), n.field)
+	}
+	return lookupKey(m, n.field)
+}
+
+func lookupKey(m map[string]interface{}, key string) (interface{}, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", key)
+	}
+	return v, nil
+}
+
+type call struct {
+	name   string
+	fn     function
+	target node
+	args   []node
+	// re is the compiled literal pattern of matches.
+	re *regexp.Regexp
+}
+
+func (n *call) eval(vars Activation) (interface{}, error) {
+	var args []interface{}
+	if n.target != nil {
+		target, err := n.target.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, target)
+	}
+	for _, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if n.re != nil {
+		if s, ok := args[0].(string); ok {
+			return n.re.MatchString(s), nil
+		}
+	}
+	v, ok, err := n.fn.impl(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.name, err)
+	}
+	if !ok {
+		types := make([]string, 0, len(args))
+		for _, arg := range args {
+			types = append(types, typeName(arg))
+		}
+		return nil, fmt.Errorf("no such overload: %s(%s)", n.name, strings.Join(types, ", "))
+	}
+	return v, nil
+}
+
+// function implements a function or method. The target of methods is their
+// first argument. impl returns false if there is no overload for the types of
+// the arguments.
+type function struct {
+	minArgs, maxArgs int
+	impl             func(args []interface{}) (interface{}, bool, error)
+}
+
+func (f function) arity() string {
+	if f.minArgs == f.maxArgs {
+		return fmt.Sprint(f.minArgs)
+	}
+	return fmt.Sprintf("%d to %d", f.minArgs, f.maxArgs)
+}
+
+var functions = map[string]function{
+	"size": {1, 1, func(args []interface{}) (interface{}, bool, error) {
+		return size(args[0])
+	}},
+}
+
+var methods = map[string]function{
+	"size": {0, 0, func(args []interface{}) (interface{}, bool, error) {
+		return size(args[0])
+	}},
+	"contains":   stringFunction(1, func(s string, args []string) interface{} { return strings.Contains(s, args[0]) }),
+	"startsWith": stringFunction(1, func(s string, args []string) interface{} { return strings.HasPrefix(s, args[0]) }),
+	"endsWith":   stringFunction(1, func(s string, args []string) interface{} { return strings.HasSuffix(s, args[0]) }),
+	"lowerAscii": stringFunction(0, func(s string, args []string) interface{} { return strings.ToLower(s) }),
+	"upperAscii": stringFunction(0, func(s string, args []string) interface{} { return strings.ToUpper(s) }),
+	"trim":       stringFunction(0, func(s string, args []string) interface{} { return strings.TrimSpace(s) }),
+	"replace":    stringFunction(2, func(s string, args []string) interface{} { return strings.Replace(s, args[0], args[1], -1) }),
+	"split": stringFunction(1, func(s string, args []string) interface{} {
+		parts := strings.Split(s, args[0])
+		values := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			values = append(values, part)
+		}
+		return values
+	}),
+	"matches": {1, 1, func(args []interface{}) (interface{}, bool, error) {
+		s, ok := args[0].(string)
+		pattern, pok := args[1].(string)
+		if !ok || !pok {
+			return nil, false, nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, true, err
+		}
+		return re.MatchString(s), true, nil
+	}},
+	"join": {0, 1, func(args []interface{}) (interface{}, bool, error) {
+		elems, ok := args[0].([]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+		sep := ""
+		if len(args) > 1 {
+			if sep, ok = args[1].(string); !ok {
+				return nil, false, nil
+			}
+		}
+		parts := make([]string, 0, len(elems))
+		for _, elem := range elems {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, false, nil
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, sep), true, nil
+	}},
+}
+
+// stringFunction returns a method on strings taking n string arguments.
+func stringFunction(n int, impl func(s string, args []string) interface{}) function {
+	return function{n, n, func(args []interface{}) (interface{}, bool, error) {
+		strs := make([]string, 0, len(args))
+		for _, arg := range args {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, false, nil
+			}
+			strs = append(strs, s)
+		}
+		return impl(strs[0], strs[1:]), true, nil
+	}}
+}
+
+func size(v interface{}) (interface{}, bool, error) {
+	switch v := v.(type) {
+	case string:
+		return int64(len([]rune(v))), true, nil
+	case []interface{}:
+		return int64(len(v)), true, nil
+	case map[string]interface{}:
+		return int64(len(v)), true, nil
+	}
+	return nil, false, nil
+}
+
+// normalize converts the values of variables to the types expressions
+// operate on: string, int64, bool, []interface{} and map[string]interface{}.
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string, int64, bool, []interface{}, map[string]interface{}:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, s)
+		}
+		return values, nil
+	case map[string]string:
+		values := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			values[k] = s
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported variable type %T", v)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "int"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package expr evaluates expressions of a subset of the Common Expression
+// Language (CEL), for mapping rules too complex for static mappings.
+//
+// Expressions operate on strings, ints, bools, lists and string-keyed maps
+// with the literals, the ! - + == != < <= > >= in && || ?: operators, list
+// and map indexes, map field selection and these functions:
+//
+//	size(x), x.size()                 length of a string, list or map
+//	s.contains(t), s.startsWith(t), s.endsWith(t)
+//	s.matches(re)                     RE2 search, unanchored like CEL
+//	s.lowerAscii(), s.upperAscii(), s.trim()
+//	s.replace(old, new), s.split(sep) list of strings
+//	l.join(), l.join(sep)             string of a list of strings
+//
+// Undeclared variables and functions are rejected when expressions are
+// compiled, type errors when they are evaluated.
+package expr
+
+import (
+	"fmt"
+)
+
+// Activation returns the value of the variable name. Variables are resolved
+// only when evaluation reaches them, so costly ones can be looked up lazily.
+// Values are strings, ints, bools, []string, map[string]string or the types
+// expressions operate on.
+type Activation func(name string) (interface{}, error)
+
+// Program is a compiled expression.
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile parses src, which may use the variables.
+func Compile(src string, variables []string) (*Program, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, vars: map[string]bool{}}
+	for _, v := range variables {
+		p.vars[v] = true
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// String returns the source of the program.
+func (p *Program) String() string {
+	return p.src
+}
+
+// Eval evaluates the program.
+func (p *Program) Eval(vars Activation) (interface{}, error) {
+	return p.root.eval(vars)
+}
+
+// EvalBool evaluates the program, which must return a bool.
+func (p *Program) EvalBool(vars Activation) (bool, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+// EvalString evaluates the program, which must return a string.
+func (p *Program) EvalString(vars Activation) (string, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %s", typeName(v))
+	}
+	return s, nil
+}
+
+// EvalStrings evaluates the program, which must return a list of strings.
+func (p *Program) EvalStrings(vars Activation) ([]string, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	elems, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list of strings, got %s", typeName(v))
+	}
+	strs := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		s, ok := elem.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a list of strings, got an element of type %s", typeName(elem))
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
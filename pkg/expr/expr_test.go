@@ -0,0 +1,415 @@
+package expr
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testVars(name string) (interface{}, error) {
+	switch name {
+	case "roleName":
+		return "Developer", nil
+	case "rolePath":
+		return "/team/payments/", nil
+	case "sessionName":
+		return "alice", nil
+	case "groups":
+		return []string{"developers", "viewers"}, nil
+	case "tags":
+		return map[string]string{"team": "payments", "cost-center": "42"}, nil
+	case "count":
+		return 3, nil
+	}
+	return nil, errors.New("lookup failed")
+}
+
+var testVariables = []string{"roleName", "rolePath", "sessionName", "groups", "tags", "count", "failing"}
+
+func TestEval(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want interface{}
+	}{
+		{`"a" + 'b'`, "ab"},
+		{`rolePath.contains("/team/")`, true},
+		{`rolePath.startsWith("/team/") && roleName.endsWith("per")`, true},
+		{`rolePath.split("/")[2]`, "payments"},
+		{`roleName.lowerAscii() + ":" + sessionName`, "developer:alice"},
+		{`sessionName.matches("^[a-z]+$")`, true},
+		{`sessionName.matches("[0-9]")`, false},
+		{`tags.team`, "payments"},
+		{`tags["cost-center"]`, "42"},
+		{`"owner" in tags`, false},
+		{`"viewers" in groups`, true},
+		{`groups + ["payments"]`, []interface{}{"developers", "viewers", "payments"}},
+		{`size(groups) == 2 && groups.size() < count`, true},
+		{`count - 4`, int64(-1)},
+		{`!(count >= 3)`, false},
+		{`"team" in tags ? "team:" + tags.team : "none"`, "team:payments"},
+		{`groups.join(",")`, "developers,viewers"},
+		{`" x ".trim().upperAscii().replace("X", "y")`, "y"},
+		// short-circuits don't evaluate the failing variable
+		{`true || failing`, true},
+		{`false && failing`, false},
+	} {
+		p, err := Compile(c.src, testVariables)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", c.src, err)
+			continue
+		}
+		got, err := p.Eval(testVars)
+		if err != nil {
+			t.Errorf("Eval(%s): %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`roleName ==`,
+		`unknown == "a"`,
+		`roleName.unknown()`,
+		`roleName.contains()`,
+		`sessionName.matches("(")`,
+		`"unterminated`,
+		`roleName # comment`,
+		`(roleName`,
+		`roleName roleName`,
+		`tags.`,
+	} {
+		if _, err := Compile(src, testVariables); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", src)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, src := range []string{
+		`roleName + 1`,
+		`tags.owner`,
+		`groups[2]`,
+		`failing == "a"`,
+		`roleName && true`,
+		`count ? "a" : "b"`,
+		`-roleName`,
+	} {
+		p, err := Compile(src, testVariables)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", src, err)
+			continue
+		}
+		if _, err := p.Eval(testVars); err == nil {
+			t.Errorf("Eval(%s) succeeded, want an error", src)
+		}
+	}
+}
+
+func TestEvalTypes(t *testing.T) {
+	p, err := Compile(`[roleName, sessionName]`, testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs, err := p.EvalStrings(testVars)
+	if err != nil || !reflect.DeepEqual(strs, []string{"Developer", "alice"}) {
+		t.Errorf("EvalStrings = %v, %v", strs, err)
+	}
+	if _, err := p.EvalString(testVars); err == nil {
+		t.Error("EvalString of a list succeeded, want an error")
+	}
+	if _, err := p.EvalBool(testVars); err == nil {
+		t.Error("EvalBool of a list succeeded, want an error")
+	}
+}
+
+func TestEvalOperators(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want interface{}
+	}{
+		// literals
+		{`42`, int64(42)},
+		{`"double"`, "double"},
+		{`'single'`, "single"},
+		{`'it\'s'`, "it's"},
+		{`"tab\tquote\""`, "tab\tquote\""},
+		{`true`, true},
+		{`false`, false},
+		{`[]`, []interface{}{}},
+		{`[1, "a", true]`, []interface{}{int64(1), "a", true}},
+		// unary operators
+		{`!true`, false},
+		{`!!true`, true},
+		{`-count`, int64(-3)},
+		{`--count`, int64(3)},
+		// arithmetic and concatenation
+		{`1 + 2`, int64(3)},
+		{`1 - 2 - 3`, int64(-4)},
+		{`[1] + []`, []interface{}{int64(1)}},
+		// equality
+		{`1 == 1`, true},
+		{`"a" == 'a'`, true},
+		{`1 == "1"`, false},
+		{`[1, "a"] == [1, "a"]`, true},
+		{`tags == tags`, true},
+		{`"a" != "b"`, true},
+		{`1 != 1`, false},
+		// ordering of ints and strings
+		{`1 < 2`, true},
+		{`2 < 2`, false},
+		{`2 <= 2`, true},
+		{`3 > 2`, true},
+		{`2 >= 3`, false},
+		{`"ab" < "b"`, true},
+		{`"b" >= "ab"`, true},
+		// membership
+		{`1 in [1, 2]`, true},
+		{`"x" in []`, false},
+		{`"team" in tags`, true},
+		// logical operators and precedence
+		{`true && false`, false},
+		{`false || true`, true},
+		{`1 + 2 == 3 && !false || false`, true},
+		{`false && true || true`, true},
+		{`!(1 < 2) || 2 - 1 == 1`, true},
+		// conditionals are right associative
+		{`false ? 1 : 2`, int64(2)},
+		{`true ? false ? 1 : 2 : 3`, int64(2)},
+		{`false ? 1 : true ? 2 : 3`, int64(2)},
+		// indexes and field selection
+		{`groups[0]`, "developers"},
+		{`[groups][0][1]`, "viewers"},
+		{`tags["team"]`, "payments"},
+		{`tags.team.upperAscii()`, "PAYMENTS"},
+		// functions and methods
+		{`size("héllo")`, int64(5)},
+		{`size(groups)`, int64(2)},
+		{`size(tags)`, int64(2)},
+		{`tags.size()`, int64(2)},
+		{`"".size()`, int64(0)},
+		{`roleName.contains("velo")`, true},
+		{`roleName.startsWith("dev")`, false},
+		{`roleName.endsWith("")`, true},
+		{`"MiXeD".lowerAscii()`, "mixed"},
+		{`"MiXeD".upperAscii()`, "MIXED"},
+		{`"\t x \n".trim()`, "x"},
+		{`"a-b-c".replace("-", "")`, "abc"},
+		{`"a,b".split(",")`, []interface{}{"a", "b"}},
+		{`groups.join()`, "developersviewers"},
+		{`[].join("-")`, ""},
+		{`roleName.matches("^Dev")`, true},
+		// patterns that aren't literals are compiled on evaluation
+		{`roleName.matches(sessionName.replace("alice", "^Dev"))`, true},
+		{`roleName.matches(sessionName)`, false},
+	} {
+		p, err := Compile(c.src, testVariables)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", c.src, err)
+			continue
+		}
+		if p.String() != c.src {
+			t.Errorf("String() = %s, want %s", p.String(), c.src)
+		}
+		got, err := p.Eval(testVars)
+		if err != nil {
+			t.Errorf("Eval(%s): %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrorMessages(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{``, "expected an expression at column 1, found end of expression"},
+		{`roleName ==`, "expected an expression at column 12, found end of expression"},
+		{`roleName roleName`, "unexpected token at column 10, found roleName"},
+		{`roleName # comment`, "unexpected character '#' at column 10"},
+		{`roleName = "a"`, "unexpected character '=' at column 10"},
+		{`"unterminated`, "unterminated string at column 1"},
+		{`'\q'`, `invalid string '\q' at column 1`},
+		{`99999999999999999999`, "invalid integer 99999999999999999999 at column 1"},
+		{`unknown == "a"`, "undeclared variable unknown at column 1"},
+		{`unknown()`, "undeclared function unknown at column 1"},
+		{`roleName.unknown()`, "undeclared method unknown at column 10"},
+		{`size()`, "function size takes 1 arguments, not 0 at column 1"},
+		{`roleName.size(1)`, "method size takes 0 arguments, not 1"},
+		{`roleName.replace("a")`, "method replace takes 2 arguments, not 1"},
+		{`groups.join(",", ",")`, "method join takes 0 to 1 arguments, not 2"},
+		{`roleName.matches(1)`, "the pattern of matches must be a string"},
+		{`roleName.matches("(")`, `invalid pattern "("`},
+		{`(roleName`, `expected ")" at column 10, found end of expression`},
+		{`groups[0`, `expected "]" at column 9`},
+		{`[1, 2`, `expected "," at column 6`},
+		{`size(1 2)`, `expected "," at column 8, found 2`},
+		{`true ? 1`, `expected ":" at column 9`},
+		{`tags.`, "expected a field or method name at column 6"},
+		{`tags."team"`, `expected a field or method name at column 6, found "team"`},
+		{`in`, "unexpected keyword in at column 1"},
+		{`1 in in`, "unexpected keyword in at column 6"},
+		{`)`, "expected an expression at column 1, found )"},
+		{`!`, "expected an expression at column 2"},
+	} {
+		_, err := Compile(c.src, testVariables)
+		if err == nil {
+			t.Errorf("Compile(%s) succeeded, want %q", c.src, c.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Compile(%s) = %q, want %q", c.src, err, c.want)
+		}
+	}
+}
+
+func TestEvalErrorMessages(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		// type errors
+		{`1 + "a"`, "no such overload: int + string"},
+		{`"a" - "b"`, "no such overload: string - string"},
+		{`[1] - [1]`, "no such overload: list - list"},
+		{`1 < "a"`, "no such overload: int < string"},
+		{`true <= false`, "no such overload: bool <= bool"},
+		{`tags > tags`, "no such overload: map > map"},
+		{`!1`, "no such overload: !int"},
+		{`-"a"`, "no such overload: -string"},
+		{`1 && true`, "no such overload: int && ..."},
+		{`true && 1`, "no such overload: bool && int"},
+		{`false || "a"`, "no such overload: bool || string"},
+		{`"a" ? 1 : 2`, "no such overload: string ? ... : ..."},
+		{`1 in 1`, "no such overload: int in int"},
+		{`1 in tags`, "no such overload: int in map"},
+		{`groups["a"]`, "no such overload: list[string]"},
+		{`tags[1]`, "no such overload: map[int]"},
+		{`roleName[0]`, "no such overload: string[int]"},
+		{`roleName.field`, "no such overload: string.field"},
+		{`groups.contains("a")`, "no such overload: contains(list, string)"},
+		{`roleName.replace(1 + 1, "a")`, "no such overload: replace(string, int, string)"},
+		{`size(1)`, "no such overload: size(int)"},
+		{`count.size()`, "no such overload: size(int)"},
+		{`[1].join()`, "no such overload: join(list)"},
+		{`groups.join(1)`, "no such overload: join(list, int)"},
+		{`count.matches("a")`, "no such overload: matches(int, string)"},
+		{`roleName.matches(sessionName + "(")`, "matches: error parsing regexp"},
+		// missing fields, indexes and variables
+		{`tags.owner`, "no such key: owner"},
+		{`tags["owner"]`, "no such key: owner"},
+		{`groups[2]`, "index out of range: 2"},
+		{`groups[-1]`, "index out of range: -1"},
+		{`failing`, "lookup failed"},
+		{`[failing]`, "lookup failed"},
+		{`size(failing)`, "lookup failed"},
+		{`roleName.contains(failing)`, "lookup failed"},
+		{`failing.size()`, "lookup failed"},
+		{`tags[failing]`, "lookup failed"},
+		{`true ? failing : 1`, "lookup failed"},
+	} {
+		p, err := Compile(c.src, testVariables)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", c.src, err)
+			continue
+		}
+		_, err = p.Eval(testVars)
+		if err == nil {
+			t.Errorf("Eval(%s) succeeded, want %q", c.src, c.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Eval(%s) = %q, want %q", c.src, err, c.want)
+		}
+	}
+}
+
+func TestEvalUnsupportedVariable(t *testing.T) {
+	p, err := Compile(`ratio`, []string{"ratio"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Eval(func(string) (interface{}, error) { return 1.5, nil })
+	if err == nil || err.Error() != "unsupported variable type float64" {
+		t.Errorf("Eval = %v, want an unsupported variable type error", err)
+	}
+}
+
+// parserCorpus are expressions mutated by TestParserRobustness.
+var parserCorpus = []string{
+	`"a" + 'b'`,
+	`rolePath.split("/")[2]`,
+	`"team" in tags ? "team:" + tags.team : "none"`,
+	`size(groups) == 2 && groups.size() < count`,
+	`!(count >= 3) || -count != 1`,
+	`[roleName, sessionName].join(",").matches("^D[a-z]+,a")`,
+	`'it\'s' != "tab\t"`,
+}
+
+// parserFragments are the pieces TestParserRobustness joins into expressions.
+var parserFragments = []string{
+	"roleName", "groups", "tags", "count", "failing", "unknown", "true", "false", "in",
+	"size", "contains", "matches", "join", "split", "replace",
+	"0", "1", "-1", "99999999999999999999", `"a"`, `'b'`, `"("`, `"\`, `'`,
+	"==", "!=", "<=", ">=", "<", ">", "&&", "||", "!", "+", "-",
+	"(", ")", "[", "]", ",", ".", "?", ":", " ", "#", "=",
+}
+
+// TestParserRobustness compiles and evaluates random and mutated expressions,
+// which must fail with errors rather than panic.
+func TestParserRobustness(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	check := func(src string) {
+		defer func() {
+			if err := recover(); err != nil {
+				t.Fatalf("panic on %q: %v", src, err)
+			}
+		}()
+		p, err := Compile(src, testVariables)
+		if err != nil {
+			return
+		}
+		p.Eval(testVars)
+	}
+
+	for i := 0; i < 20000; i++ {
+		var b strings.Builder
+		for n := r.Intn(12); n >= 0; n-- {
+			b.WriteString(parserFragments[r.Intn(len(parserFragments))])
+		}
+		check(b.String())
+	}
+	for i := 0; i < 20000; i++ {
+		src := []byte(parserCorpus[r.Intn(len(parserCorpus))])
+		for n := r.Intn(4); n >= 0 && len(src) > 0; n-- {
+			pos := r.Intn(len(src))
+			switch r.Intn(3) {
+			case 0:
+				src = append(src[:pos], src[pos+1:]...)
+			case 1:
+				src = append(src[:pos], append([]byte{byte(r.Intn(128))}, src[pos:]...)...)
+			default:
+				other := r.Intn(len(src))
+				src[pos], src[other] = src[other], src[pos]
+			}
+		}
+		check(string(src))
+	}
+	for i := 0; i < 5000; i++ {
+		src := make([]byte, r.Intn(16))
+		r.Read(src)
+		check(string(src))
+	}
+	check(strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000))
+	check(strings.Repeat("!", 1000) + "true")
+}
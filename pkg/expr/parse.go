@@ -0,0 +1,432 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// val is the value of string and int literals.
+	val interface{}
+	// pos is the offset of the token in the source.
+	pos int
+}
+
+// operators lists the operators longest first, so "==" isn't lexed as "=".
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "(", ")", "[", "]", ",", ".", "?", ":", "!", "<", ">", "+", "-"}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			n, err := strconv.ParseInt(src[start:i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid integer %s at column %d", src[start:i], start+1)
+			}
+			toks = append(toks, token{kind: tokInt, text: src[start:i], val: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at column %d", start+1)
+			}
+			i++
+			s, err := unquote(src[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s at column %d: %v", src[start:i], start+1, err)
+			}
+			toks = append(toks, token{kind: tokString, text: src[start:i], val: s, pos: start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at column %d", c, i+1)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// unquote returns the value of a double or single quoted string literal,
+// which use the escapes of Go strings.
+func unquote(quoted string) (string, error) {
+	if quoted[0] == '\'' {
+		body := quoted[1 : len(quoted)-1]
+		body = strings.Replace(body, `\'`, `'`, -1)
+		body = strings.Replace(body, `"`, `\"`, -1)
+		quoted = `"` + body + `"`
+	}
+	return strconv.Unquote(quoted)
+}
+
+// parser is a recursive descent parser of the CEL grammar, by operator
+// precedence.
+type parser struct {
+	toks []token
+	i    int
+	vars map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the operator or keyword text.
+func (p *parser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == tokOp || tok.kind == tokIdent) && tok.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	found := tok.text
+	if tok.kind == tokEOF {
+		found = "end of expression"
+	}
+	return fmt.Errorf("%s at column %d, found %s", fmt.Sprintf(format, args...), tok.pos+1, found)
+}
+
+// expr parses a conditional: or ? expr : expr
+func (p *parser) expr() (node, error) {
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	then, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &conditional{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.relation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		y, err := p.relation()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+var relations = []string{"==", "!=", "<=", ">=", "<", ">", "in"}
+
+func (p *parser) relation() (node, error) {
+	x, err := p.addition()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range relations {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+		y, err := p.addition()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) addition() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		if p.accept("+") {
+			op = "+"
+		} else if p.accept("-") {
+			op = "-"
+		} else {
+			return x, nil
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &unary{op: op, x: x}, nil
+		}
+	}
+	return p.member()
+}
+
+// member parses field selections, method calls and indexes.
+func (p *parser) member() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			tok := p.peek()
+			if tok.kind != tokIdent {
+				return nil, p.errorf("expected a field or method name")
+			}
+			p.next()
+			if !p.accept("(") {
+				x = &selection{x: x, field: tok.text}
+				continue
+			}
+			args, err := p.args(")")
+			if err != nil {
+				return nil, err
+			}
+			x, err = newCall(tok.text, x, args)
+			if err != nil {
+				return nil, fmt.Errorf("%v at column %d", err, tok.pos+1)
+			}
+		case p.accept("["):
+			i, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &index{x: x, i: i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokString, tokInt:
+		p.next()
+		return &literal{v: tok.val}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literal{v: true}, nil
+		case "false":
+			return &literal{v: false}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected keyword in at column %d", tok.pos+1)
+		}
+		if p.accept("(") {
+			args, err := p.args(")")
+			if err != nil {
+				return nil, err
+			}
+			call, err := newCall(tok.text, nil, args)
+			if err != nil {
+				return nil, fmt.Errorf("%v at column %d", err, tok.pos+1)
+			}
+			return call, nil
+		}
+		if !p.vars[tok.text] {
+			return nil, fmt.Errorf("undeclared variable %s at column %d", tok.text, tok.pos+1)
+		}
+		return &variable{name: tok.text}, nil
+	}
+	switch {
+	case p.accept("("):
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case p.accept("["):
+		elems, err := p.args("]")
+		if err != nil {
+			return nil, err
+		}
+		return &list{elems: elems}, nil
+	}
+	return nil, p.errorf("expected an expression")
+}
+
+// args parses a comma-separated list of expressions up to end.
+func (p *parser) args(end string) ([]node, error) {
+	var args []node
+	if p.accept(end) {
+		return args, nil
+	}
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(end) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newCall returns the call of the function or, if target isn't nil, the
+// method name, checking that it exists and its number of arguments.
+func newCall(name string, target node, args []node) (node, error) {
+	table, kind := functions, "function"
+	if target != nil {
+		table, kind = methods, "method"
+	}
+	fn, ok := table[name]
+	if !ok {
+		return nil, fmt.Errorf("undeclared %s %s", kind, name)
+	}
+	if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("%s %s takes %s arguments, not %d", kind, name, fn.arity(), len(args))
+	}
+	c := &call{name: name, fn: fn, target: target, args: args}
+	// regular expressions given as literals are compiled once
+	if name == "matches" {
+		if pattern, ok := args[0].(*literal); ok {
+			s, ok := pattern.v.(string)
+			if !ok {
+				return nil, fmt.Errorf("the pattern of matches must be a string")
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", s, err)
+			}
+			c.re = re
+		}
+	}
+	return c, nil
+}
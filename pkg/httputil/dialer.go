@@ -0,0 +1,145 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// IP families connections can prefer.
+const (
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
+// DialerOptions configures how outbound connections resolve and dial hosts.
+type DialerOptions struct {
+	// PinnedIPs maps lowercase host names to the IP addresses connections to
+	// them are made to, without resolving them.
+	PinnedIPs map[string][]string
+	// IPFamily, if set to IPFamilyIPv4 or IPFamilyIPv6, tries the addresses
+	// of that family before the others, one at a time. Otherwise addresses
+	// are tried in the system's order, racing IPv4 and IPv6 (happy
+	// eyeballs).
+	IPFamily string
+	// DialTimeout bounds resolving a host and connecting to it. Defaults to
+	// 30 seconds.
+	DialTimeout time.Duration
+	// HappyEyeballsDelay is how long the first address family is tried
+	// before racing the other one. Zero is the default of 300ms, negative
+	// disables racing.
+	HappyEyeballsDelay time.Duration
+}
+
+// DefaultDialTimeout is the DialTimeout of DialerOptions by default, as in
+// http.DefaultTransport.
+const DefaultDialTimeout = 30 * time.Second
+
+// ValidateIPFamily returns an error unless family is empty, IPFamilyIPv4 or
+// IPFamilyIPv6.
+func ValidateIPFamily(family string) error {
+	switch family {
+	case "", IPFamilyIPv4, IPFamilyIPv6:
+		return nil
+	default:
+		return fmt.Errorf("unknown IP family %q, must be %s or %s", family, IPFamilyIPv4, IPFamilyIPv6)
+	}
+}
+
+// ParsePinnedIPs parses host=ip entries into PinnedIPs. A host pinned by
+// several entries is tried at each of their addresses in turn.
+func ParsePinnedIPs(entries []string) (map[string][]string, error) {
+	pinned := map[string][]string{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || net.ParseIP(parts[1]) == nil {
+			return nil, fmt.Errorf("invalid pinned IP %q: expected host=ip", entry)
+		}
+		host := strings.ToLower(parts[0])
+		pinned[host] = append(pinned[host], parts[1])
+	}
+	return pinned, nil
+}
+
+type dialer struct {
+	net.Dialer
+	pinnedIPs map[string][]string
+	ipFamily  string
+}
+
+func newDialer(opts DialerOptions) *dialer {
+	d := &dialer{
+		Dialer: net.Dialer{
+			Timeout:       opts.DialTimeout,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: opts.HappyEyeballsDelay,
+		},
+		pinnedIPs: opts.PinnedIPs,
+		ipFamily:  opts.IPFamily,
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = DefaultDialTimeout
+	}
+	return d
+}
+
+// DialContext connects to addr at its pinned IPs, or at its resolved
+// addresses in the order of the preferred IP family.
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, pinned := d.pinnedIPs[strings.ToLower(host)]
+	if !pinned && (d.ipFamily == "" || net.ParseIP(host) != nil) {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	if !pinned {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP.String())
+		}
+	}
+
+	var firstErr error
+	for _, ip := range d.preferred(ips) {
+		conn, err := d.Dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, firstErr
+}
+
+// preferred returns ips with the addresses of the preferred family first.
+func (d *dialer) preferred(ips []string) []string {
+	if d.ipFamily == "" {
+		return ips
+	}
+	var first, rest []string
+	for _, ip := range ips {
+		if isIPv4 := net.ParseIP(ip).To4() != nil; isIPv4 == (d.ipFamily == IPFamilyIPv4) {
+			first = append(first, ip)
+		} else {
+			rest = append(rest, ip)
+		}
+	}
+	return append(first, rest...)
+}
@@ -0,0 +1,61 @@
+package httputil
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewTransportPinnedIPs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	transport, err := NewTransport(TransportOptions{
+		Dialer: DialerOptions{PinnedIPs: map[string][]string{"sts.invalid": {"127.0.0.1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get("http://STS.invalid:" + port + "/")
+	if err != nil {
+		t.Fatalf("expected the pinned host to be called at its IP, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDialerPreferred(t *testing.T) {
+	ips := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2"}
+	for _, c := range []struct {
+		family string
+		want   []string
+	}{
+		{"", ips},
+		{IPFamilyIPv4, []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2"}},
+		{IPFamilyIPv6, []string{"2001:db8::1", "2001:db8::2", "10.0.0.1", "10.0.0.2"}},
+	} {
+		if got := newDialer(DialerOptions{IPFamily: c.family}).preferred(ips); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.family, got, c.want)
+		}
+	}
+}
+
+func TestParsePinnedIPs(t *testing.T) {
+	got, err := ParsePinnedIPs([]string{"STS.amazonaws.com=10.0.0.1", "sts.amazonaws.com=2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"sts.amazonaws.com": {"10.0.0.1", "2001:db8::1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, entry := range []string{"sts.amazonaws.com", "=10.0.0.1", "sts.amazonaws.com=sts"} {
+		if _, err := ParsePinnedIPs([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+	if err := ValidateIPFamily("ipv5"); err == nil {
+		t.Errorf("expected an error for an unknown IP family")
+	}
+}
@@ -0,0 +1,174 @@
+package httputil
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Reasons passed to LimiterOptions.OnReject.
+const (
+	RejectGlobal   = "global"
+	RejectSource   = "source"
+	RejectInFlight = "in_flight"
+)
+
+// sourceIdleTimeout is how long a per-source limiter is kept after the
+// source's last request.
+const sourceIdleTimeout = 10 * time.Minute
+
+// LimiterOptions configures a RequestLimiter. A zero QPS or MaxInFlight
+// disables the corresponding limit.
+type LimiterOptions struct {
+	// QPS and Burst limit the rate of requests from all sources combined.
+	QPS   int
+	Burst int
+	// PerSourceQPS and PerSourceBurst limit the rate of requests from a
+	// single source IP.
+	PerSourceQPS   int
+	PerSourceBurst int
+	// MaxInFlight limits the number of requests served concurrently.
+	MaxInFlight int
+	// OnReject, if set, is called with the reason whenever a request is
+	// rejected.
+	OnReject func(reason string)
+}
+
+// RequestLimiter rejects requests exceeding the configured rates or
+// concurrency with 429 Too Many Requests and a Retry-After header.
+type RequestLimiter struct {
+	opts     LimiterOptions
+	global   *rate.Limiter
+	inFlight chan struct{}
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	sources   map[string]*sourceLimiter
+	lastSweep time.Time
+}
+
+type sourceLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRequestLimiter returns a RequestLimiter, or nil if opts disables all
+// limits.
+func NewRequestLimiter(opts LimiterOptions) *RequestLimiter {
+	if opts.QPS <= 0 && opts.PerSourceQPS <= 0 && opts.MaxInFlight <= 0 {
+		return nil
+	}
+	l := &RequestLimiter{
+		opts:    opts,
+		now:     time.Now,
+		sources: map[string]*sourceLimiter{},
+	}
+	if opts.QPS > 0 {
+		l.global = rate.NewLimiter(rate.Limit(opts.QPS), burst(opts.Burst))
+	}
+	if opts.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, opts.MaxInFlight)
+	}
+	return l
+}
+
+func burst(b int) int {
+	if b < 1 {
+		return 1
+	}
+	return b
+}
+
+// Handler wraps next with the limits. A nil RequestLimiter returns next
+// unchanged.
+func (l *RequestLimiter) Handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if l.inFlight != nil {
+			select {
+			case l.inFlight <- struct{}{}:
+				defer func() { <-l.inFlight }()
+			default:
+				l.reject(w, RejectInFlight, time.Second)
+				return
+			}
+		}
+		if l.opts.PerSourceQPS > 0 {
+			if ok, delay := allow(l.sourceLimiter(req)); !ok {
+				l.reject(w, RejectSource, delay)
+				return
+			}
+		}
+		if l.global != nil {
+			if ok, delay := allow(l.global); !ok {
+				l.reject(w, RejectGlobal, delay)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// allow takes a token from limiter if one is available now, otherwise it
+// returns how long until one will be.
+func allow(limiter *rate.Limiter) (bool, time.Duration) {
+	r := limiter.Reserve()
+	if !r.OK() {
+		return false, time.Second
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return true, 0
+	}
+	r.Cancel()
+	return false, delay
+}
+
+func (l *RequestLimiter) reject(w http.ResponseWriter, reason string, retryAfter time.Duration) {
+	if l.opts.OnReject != nil {
+		l.opts.OnReject(reason)
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
+
+func (l *RequestLimiter) sourceLimiter(req *http.Request) *rate.Limiter {
+	source, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		source = req.RemoteAddr
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sourceIdleTimeout {
+		for key, s := range l.sources {
+			if now.Sub(s.lastSeen) > sourceIdleTimeout {
+				delete(l.sources, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	s, ok := l.sources[source]
+	if !ok {
+		s = &sourceLimiter{
+			limiter: rate.NewLimiter(rate.Limit(l.opts.PerSourceQPS), burst(l.opts.PerSourceBurst)),
+		}
+		l.sources[source] = s
+	}
+	s.lastSeen = now
+	return s.limiter
+}
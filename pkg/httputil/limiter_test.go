@@ -0,0 +1,93 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRequestLimiterDisabled(t *testing.T) {
+	if l := NewRequestLimiter(LimiterOptions{}); l != nil {
+		t.Fatalf("expected no limiter without limits, got %+v", l)
+	}
+	var l *RequestLimiter
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if h := l.Handler(next); h == nil {
+		t.Fatalf("expected the wrapped handler from a nil limiter")
+	}
+}
+
+func TestRequestLimiterRates(t *testing.T) {
+	tbs := []struct {
+		opts     LimiterOptions
+		sources  []string
+		rejected map[string]int
+	}{
+		{
+			opts:     LimiterOptions{QPS: 1, Burst: 2},
+			sources:  []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"},
+			rejected: map[string]int{RejectGlobal: 1},
+		},
+		{
+			opts:     LimiterOptions{PerSourceQPS: 1, PerSourceBurst: 1},
+			sources:  []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.2:1"},
+			rejected: map[string]int{RejectSource: 1},
+		},
+		{
+			opts:     LimiterOptions{QPS: 10, Burst: 10, PerSourceQPS: 1, PerSourceBurst: 2},
+			sources:  []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3", "10.0.0.2:1"},
+			rejected: map[string]int{RejectSource: 1},
+		},
+	}
+	for i, tb := range tbs {
+		rejected := map[string]int{}
+		tb.opts.OnReject = func(reason string) { rejected[reason]++ }
+		h := NewRequestLimiter(tb.opts).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for _, source := range tb.sources {
+			req := httptest.NewRequest("POST", "http://k8s.io/authenticate", nil)
+			req.RemoteAddr = source
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+			if resp.Code == http.StatusTooManyRequests && resp.Header().Get("Retry-After") == "" {
+				t.Errorf("#%d: expected Retry-After header on 429", i)
+			}
+		}
+		if len(rejected) != len(tb.rejected) {
+			t.Errorf("#%d: expected rejections %v, got %v", i, tb.rejected, rejected)
+		}
+		for reason, count := range tb.rejected {
+			if rejected[reason] != count {
+				t.Errorf("#%d: expected rejections %v, got %v", i, tb.rejected, rejected)
+			}
+		}
+	}
+}
+
+func TestRequestLimiterInFlight(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+	h := NewRequestLimiter(LimiterOptions{MaxInFlight: 1}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "http://k8s.io/authenticate", nil))
+	}()
+	<-started
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "http://k8s.io/authenticate", nil))
+	if resp.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, was %d", http.StatusTooManyRequests, resp.Code)
+	}
+	if resp.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", resp.Header().Get("Retry-After"))
+	}
+	close(block)
+	wg.Wait()
+}
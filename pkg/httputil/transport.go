@@ -0,0 +1,82 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TransportOptions configures the proxy, trusted CAs and dialer of outbound
+// requests.
+type TransportOptions struct {
+	// HTTPSProxy is the URL of the proxy requests are sent through. If it is
+	// empty, the HTTPS_PROXY and NO_PROXY environment variables are used.
+	HTTPSProxy string
+	// NoProxy lists the hosts requests go to directly despite HTTPSProxy:
+	// host names, domains with a leading dot that also match their
+	// subdomains, or "*" for all hosts.
+	NoProxy []string
+	// CABundle is the path of a PEM file of CAs trusted besides the system
+	// ones, such as the CA of a TLS-intercepting proxy.
+	CABundle string
+	// Dialer configures how hosts are resolved and connected to.
+	Dialer DialerOptions
+}
+
+// NewTransport returns a transport like http.DefaultTransport with the proxy,
+// CAs and dialer of opts.
+func NewTransport(opts TransportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = newDialer(opts.Dialer).DialContext
+
+	if opts.HTTPSProxy != "" {
+		proxyURL, err := url.Parse(opts.HTTPSProxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid HTTPS proxy URL %q", opts.HTTPSProxy)
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if matchesNoProxy(req.URL.Hostname(), opts.NoProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	if opts.CABundle != "" {
+		pem, err := ioutil.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", opts.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return transport, nil
+}
+
+func matchesNoProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case host == entry:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package iamapi is a minimal client of the IAM API. The SDK's IAM package
+// isn't vendored for the few calls the server makes, so the client is set up
+// the way the generated service clients are, with the query protocol IAM
+// shares with STS.
+package iamapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+)
+
+// apiVersion is the version of the IAM query API.
+const apiVersion = "2010-05-08"
+
+// ErrNoSuchEntity is returned when the requested user or role doesn't exist.
+var ErrNoSuchEntity = errors.New("no such IAM entity")
+
+// Client calls the IAM API.
+type Client struct {
+	*client.Client
+}
+
+// New creates a Client for the IAM endpoint of partitionID using the SDK's
+// default credential chain, or the role of roleARN assumed with them.
+func New(partitionID, roleARN string) *Client {
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(GlobalRegion(partitionID, endpoints.IamServiceID))))
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "authenticatorUserAgent",
+		Fn: request.MakeAddToUserAgentHandler(
+			"aws-iam-authenticator", pkg.Version),
+	})
+	var cfgs []*aws.Config
+	if roleARN != "" {
+		cfgs = append(cfgs, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, roleARN)))
+	}
+	return NewFromConfigProvider(sess, cfgs...)
+}
+
+// NewFromConfigProvider creates a Client from a session, like the
+// constructors of the SDK's service clients.
+func NewFromConfigProvider(p client.ConfigProvider, cfgs ...*aws.Config) *Client {
+	c := p.ClientConfig(endpoints.IamServiceID, cfgs...)
+	cl := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   endpoints.IamServiceID,
+			ServiceID:     "IAM",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			PartitionID:   c.PartitionID,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+	cl.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	cl.Handlers.Build.PushBackNamed(query.BuildHandler)
+	cl.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	cl.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	cl.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return &Client{cl}
+}
+
+// send sends the operation name with input and decodes the response into
+// output. A NoSuchEntity error is returned as ErrNoSuchEntity.
+func (c *Client) send(name string, input, output interface{}) error {
+	req := c.NewRequest(&request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output)
+	err := req.Send()
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchEntity" {
+		return ErrNoSuchEntity
+	}
+	return err
+}
+
+type listGroupsForUserInput struct {
+	_ struct{} `type:"structure"`
+
+	Marker   *string `min:"1" type:"string"`
+	UserName *string `min:"1" type:"string" required:"true"`
+}
+
+type listGroupsForUserOutput struct {
+	_ struct{} `type:"structure"`
+
+	Groups      []*group `type:"list" required:"true"`
+	IsTruncated *bool    `type:"boolean"`
+	Marker      *string  `type:"string"`
+}
+
+type group struct {
+	_ struct{} `type:"structure"`
+
+	GroupName *string `min:"1" type:"string" required:"true"`
+}
+
+// ListGroupsForUser returns the names of all groups of the IAM user
+// userName, following pagination.
+func (c *Client) ListGroupsForUser(userName string) ([]string, error) {
+	var names []string
+	input := &listGroupsForUserInput{UserName: aws.String(userName)}
+	for {
+		output := &listGroupsForUserOutput{}
+		if err := c.send("ListGroupsForUser", input, output); err != nil {
+			return nil, fmt.Errorf("could not list the IAM groups of %q: %w", userName, err)
+		}
+		for _, g := range output.Groups {
+			names = append(names, aws.StringValue(g.GroupName))
+		}
+		if !aws.BoolValue(output.IsTruncated) || aws.StringValue(output.Marker) == "" {
+			return names, nil
+		}
+		input.Marker = output.Marker
+	}
+}
+
+type getRoleInput struct {
+	_ struct{} `type:"structure"`
+
+	RoleName *string `min:"1" type:"string" required:"true"`
+}
+
+type getRoleOutput struct {
+	_ struct{} `type:"structure"`
+
+	Role *role `type:"structure" required:"true"`
+}
+
+type role struct {
+	_ struct{} `type:"structure"`
+
+	Arn         *string `min:"20" type:"string" required:"true"`
+	Description *string `type:"string"`
+	Tags        []*tag  `type:"list"`
+}
+
+type tag struct {
+	_ struct{} `type:"structure"`
+
+	Key   *string `min:"1" type:"string" required:"true"`
+	Value *string `type:"string" required:"true"`
+}
+
+// Role is an IAM role returned by GetRole.
+type Role struct {
+	// ARN is the ARN of the role, including its path.
+	ARN string
+	// Description is the description of the role, if it has one.
+	Description string
+	// Tags are the tags of the role by key.
+	Tags map[string]string
+}
+
+// GetRole returns the IAM role roleName of the account of the client's
+// credentials.
+func (c *Client) GetRole(roleName string) (*Role, error) {
+	output := &getRoleOutput{}
+	if err := c.send("GetRole", &getRoleInput{RoleName: aws.String(roleName)}, output); err != nil {
+		return nil, fmt.Errorf("could not get IAM role %q: %w", roleName, err)
+	}
+	r := &Role{
+		ARN:         aws.StringValue(output.Role.Arn),
+		Description: aws.StringValue(output.Role.Description),
+		Tags:        map[string]string{},
+	}
+	for _, t := range output.Role.Tags {
+		r.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return r, nil
+}
+
+type getInstanceProfileInput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceProfileName *string `min:"1" type:"string" required:"true"`
+}
+
+type getInstanceProfileOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceProfile *instanceProfile `type:"structure" required:"true"`
+}
+
+type instanceProfile struct {
+	_ struct{} `type:"structure"`
+
+	Roles []*role `type:"list" required:"true"`
+}
+
+// GetInstanceProfile returns the ARNs, including their paths, of the roles
+// of the instance profile profileName of the account of the client's
+// credentials.
+func (c *Client) GetInstanceProfile(profileName string) ([]string, error) {
+	output := &getInstanceProfileOutput{}
+	if err := c.send("GetInstanceProfile", &getInstanceProfileInput{InstanceProfileName: aws.String(profileName)}, output); err != nil {
+		return nil, fmt.Errorf("could not get IAM instance profile %q: %w", profileName, err)
+	}
+	var arns []string
+	for _, r := range output.InstanceProfile.Roles {
+		arns = append(arns, aws.StringValue(r.Arn))
+	}
+	return arns, nil
+}
+
+// GlobalRegion returns the region requests to the global service serviceID
+// of the partition are signed for, such as us-east-1 for IAM. Global
+// services have one endpoint per partition, which every region of the
+// partition resolves to.
+func GlobalRegion(partitionID, serviceID string) string {
+	for _, p := range endpoints.DefaultPartitions() {
+		if p.ID() != partitionID {
+			continue
+		}
+		var regions []string
+		for _, e := range p.Services()[serviceID].Endpoints() {
+			if resolved, err := e.ResolveEndpoint(); err == nil && resolved.SigningRegion != "" {
+				regions = append(regions, resolved.SigningRegion)
+			}
+		}
+		sort.Strings(regions)
+		if len(regions) > 0 {
+			return regions[0]
+		}
+	}
+	return endpoints.UsEast1RegionID
+}
@@ -0,0 +1,121 @@
+package iamapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// testClient returns a Client of an IAM endpoint answering each request with
+// the next of responses, or a NoSuchEntity error for an empty one. The form
+// values of the requests are appended to requests.
+func testClient(requests *[]url.Values, responses ...string) (*Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(body))
+		*requests = append(*requests, values)
+		response := responses[len(*requests)-1]
+		if response == "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>not found</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+	}))
+	return NewFromConfigProvider(sess), server.Close
+}
+
+func TestGlobalRegion(t *testing.T) {
+	for _, c := range []struct {
+		partition, service, expected string
+	}{
+		{"aws", "iam", "us-east-1"},
+		{"aws-cn", "iam", "cn-north-1"},
+		{"aws-us-gov", "iam", "us-gov-west-1"},
+		{"aws", "organizations", "us-east-1"},
+		{"aws-us-gov", "organizations", "us-gov-west-1"},
+		{"unknown", "iam", "us-east-1"},
+	} {
+		if region := GlobalRegion(c.partition, c.service); region != c.expected {
+			t.Errorf("%s %s: expected %s, got %s", c.partition, c.service, c.expected, region)
+		}
+	}
+}
+
+func TestListGroupsForUser(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests,
+		`<ListGroupsForUserResponse><ListGroupsForUserResult><Groups><member><GroupName>dev</GroupName></member></Groups><IsTruncated>true</IsTruncated><Marker>page2</Marker></ListGroupsForUserResult></ListGroupsForUserResponse>`,
+		`<ListGroupsForUserResponse><ListGroupsForUserResult><Groups><member><GroupName>ops</GroupName></member></Groups><IsTruncated>false</IsTruncated></ListGroupsForUserResult></ListGroupsForUserResponse>`,
+	)
+	defer done()
+
+	names, err := c.ListGroupsForUser("Alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"dev", "ops"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if len(requests) != 2 || requests[0].Get("Action") != "ListGroupsForUser" || requests[0].Get("UserName") != "Alice" || requests[1].Get("Marker") != "page2" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+}
+
+func TestGetRole(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests,
+		`<GetRoleResponse><GetRoleResult><Role><Arn>arn:aws:iam::111122223333:role/teams/Dev</Arn><RoleName>Dev</RoleName><Description>Developers</Description><Tags><member><Key>kubernetes/username</Key><Value>dev</Value></member></Tags></Role></GetRoleResult></GetRoleResponse>`,
+		``,
+	)
+	defer done()
+
+	role, err := c.GetRole("Dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Role{ARN: "arn:aws:iam::111122223333:role/teams/Dev", Description: "Developers", Tags: map[string]string{"kubernetes/username": "dev"}}
+	if !reflect.DeepEqual(role, expected) {
+		t.Errorf("expected %+v, got %+v", expected, role)
+	}
+	if requests[0].Get("Action") != "GetRole" || requests[0].Get("RoleName") != "Dev" {
+		t.Errorf("unexpected request %v", requests[0])
+	}
+
+	if _, err := c.GetRole("Missing"); !errors.Is(err, ErrNoSuchEntity) {
+		t.Errorf("expected ErrNoSuchEntity, got %v", err)
+	}
+}
+
+func TestGetInstanceProfile(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests,
+		`<GetInstanceProfileResponse><GetInstanceProfileResult><InstanceProfile><InstanceProfileName>nodes</InstanceProfileName><Roles><member><Arn>arn:aws:iam::111122223333:role/eks/NodeRole</Arn><RoleName>NodeRole</RoleName></member></Roles></InstanceProfile></GetInstanceProfileResult></GetInstanceProfileResponse>`,
+	)
+	defer done()
+
+	arns, err := c.GetInstanceProfile("nodes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"arn:aws:iam::111122223333:role/eks/NodeRole"}; !reflect.DeepEqual(arns, expected) {
+		t.Errorf("expected %v, got %v", expected, arns)
+	}
+	if requests[0].Get("Action") != "GetInstanceProfile" || requests[0].Get("InstanceProfileName") != "nodes" {
+		t.Errorf("unexpected request %v", requests[0])
+	}
+}
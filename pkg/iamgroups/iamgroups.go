@@ -0,0 +1,136 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package iamgroups resolves Kubernetes groups from the IAM group membership
+// of IAM users.
+package iamgroups
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// GroupPrefix is prepended to the name of an IAM group to form the name of
+// its Kubernetes group.
+const GroupPrefix = "iam:"
+
+// Provider returns the Kubernetes groups of IAM users.
+type Provider interface {
+	// Groups returns GroupPrefix followed by the name of each IAM group the
+	// IAM user userARN is a member of.
+	Groups(userARN string) ([]string, error)
+}
+
+// Options configures a Provider.
+type Options struct {
+	// PartitionID is the partition of the IAM endpoint to call.
+	PartitionID string
+	// RoleARN, if set, is assumed to call IAM, for users in another account
+	// than the server's credentials.
+	RoleARN string
+	// CacheTTL is how long the groups of a user are cached.
+	CacheTTL time.Duration
+}
+
+type provider struct {
+	lister   groupLister
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	groups  []string
+	expires time.Time
+}
+
+// groupLister lists the names of the IAM groups of an IAM user.
+type groupLister interface {
+	ListGroupsForUser(userName string) ([]string, error)
+}
+
+// New creates a Provider calling IAM with the SDK's default credential
+// chain, or with the role of opts.RoleARN assumed with them.
+func New(opts Options) Provider {
+	return newProvider(iamapi.New(opts.PartitionID, opts.RoleARN), opts.CacheTTL)
+}
+
+func newProvider(lister groupLister, cacheTTL time.Duration) *provider {
+	return &provider{
+		lister:   lister,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    map[string]cacheEntry{},
+	}
+}
+
+func (p *provider) Groups(userARN string) ([]string, error) {
+	key := strings.ToLower(userARN)
+	now := p.now()
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		metrics.IAMGroupLookups.WithLabelValues(metrics.LookupHit).Inc()
+		return entry.groups, nil
+	}
+
+	userName, err := userNameFromARN(userARN)
+	if err != nil {
+		metrics.IAMGroupLookups.WithLabelValues(metrics.LookupError).Inc()
+		return nil, err
+	}
+	names, err := p.lister.ListGroupsForUser(userName)
+	if err != nil {
+		metrics.IAMGroupLookups.WithLabelValues(metrics.LookupError).Inc()
+		return nil, err
+	}
+	metrics.IAMGroupLookups.WithLabelValues(metrics.LookupMiss).Inc()
+	sort.Strings(names)
+	groups := make([]string, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, GroupPrefix+name)
+	}
+
+	if p.cacheTTL > 0 {
+		p.mu.Lock()
+		p.cache[key] = cacheEntry{groups: groups, expires: now.Add(p.cacheTTL)}
+		p.mu.Unlock()
+	}
+	return groups, nil
+}
+
+// userNameFromARN returns the name of the IAM user of userARN, without its
+// path.
+func userNameFromARN(userARN string) (string, error) {
+	principal, err := arn.Parse(userARN)
+	if err != nil {
+		return "", err
+	}
+	if principal.Type != arn.TypeUser {
+		return "", fmt.Errorf("%q is not an IAM user ARN", userARN)
+	}
+	return principal.Name, nil
+}
@@ -0,0 +1,62 @@
+package iamgroups
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeLister struct {
+	groups []string
+	err    error
+	calls  int
+}
+
+func (l *fakeLister) ListGroupsForUser(userName string) ([]string, error) {
+	l.calls++
+	return l.groups, l.err
+}
+
+func TestGroups(t *testing.T) {
+	lister := &fakeLister{groups: []string{"ops", "dev"}}
+	p := newProvider(lister, time.Minute)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		groups, err := p.Groups("arn:aws:iam::111122223333:user/team/Alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := []string{"iam:dev", "iam:ops"}; !reflect.DeepEqual(groups, expected) {
+			t.Errorf("expected %v, got %v", expected, groups)
+		}
+	}
+	if lister.calls != 1 {
+		t.Errorf("expected 1 call to IAM, got %d", lister.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	lister.err = errors.New("throttled")
+	if _, err := p.Groups("arn:aws:iam::111122223333:user/team/Alice"); err == nil {
+		t.Error("expected an error once the cache expired")
+	}
+
+	if _, err := p.Groups("arn:aws:iam::111122223333:role/Admin"); err == nil {
+		t.Error("expected an error for a role ARN")
+	}
+}
+
+func TestUserNameFromARN(t *testing.T) {
+	for arn, expected := range map[string]string{
+		"arn:aws:iam::111122223333:user/Alice":          "Alice",
+		"arn:aws:iam::111122223333:user/path/to/Alice":  "Alice",
+		"arn:aws-cn:iam::111122223333:user/Bob@example": "Bob@example",
+	} {
+		name, err := userNameFromARN(arn)
+		if err != nil || name != expected {
+			t.Errorf("%s: expected %q, got %q (%v)", arn, expected, name, err)
+		}
+	}
+}
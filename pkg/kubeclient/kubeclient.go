@@ -0,0 +1,83 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubeclient builds the clients the server uses to talk to the
+// Kubernetes API server.
+package kubeclient
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// UserAgent is the user agent of requests to the API server unless
+// Config.KubeAPIUserAgent overrides it.
+func UserAgent() string {
+	return "aws-iam-authenticator/" + pkg.Version
+}
+
+// RESTConfig returns the client configuration for the API server of cfg.
+// Master and Kubeconfig select the server when set; otherwise the server is
+// running as a pod and uses its service account token and the in-cluster
+// address of the API server.
+func RESTConfig(cfg config.Config) (*rest.Config, error) {
+	var restConfig *rest.Config
+	var err error
+	if cfg.Master != "" || cfg.Kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags(cfg.Master, cfg.Kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+		if err == rest.ErrNotInCluster {
+			err = fmt.Errorf("%v; set --kubeconfig or --master when not running in a pod", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't create kubernetes config: %v", err)
+	}
+	if cfg.KubeAPIQPS > 0 {
+		restConfig.QPS = cfg.KubeAPIQPS
+	}
+	if cfg.KubeAPIBurst > 0 {
+		restConfig.Burst = cfg.KubeAPIBurst
+	}
+	if cfg.KubeAPITimeout > 0 {
+		restConfig.Timeout = cfg.KubeAPITimeout
+	}
+	restConfig.UserAgent = cfg.KubeAPIUserAgent
+	if restConfig.UserAgent == "" {
+		restConfig.UserAgent = UserAgent()
+	}
+	return restConfig, nil
+}
+
+// NewClientset returns a client for the API server of cfg.
+func NewClientset(cfg config.Config) (kubernetes.Interface, error) {
+	restConfig, err := RESTConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("can't create kubernetes client: %v", err)
+	}
+	return clientset, nil
+}
@@ -0,0 +1,81 @@
+package kubeclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://kubernetes.example.com
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: secret
+`
+
+func TestRESTConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restConfig, err := RESTConfig(config.Config{Kubeconfig: kubeconfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restConfig.Host != "https://kubernetes.example.com" {
+		t.Errorf("host = %q", restConfig.Host)
+	}
+	if restConfig.QPS != 0 || restConfig.Burst != 0 {
+		t.Errorf("QPS, burst = %v, %v, want client-go defaults", restConfig.QPS, restConfig.Burst)
+	}
+	if restConfig.UserAgent != UserAgent() {
+		t.Errorf("user agent = %q, want %q", restConfig.UserAgent, UserAgent())
+	}
+
+	restConfig, err = RESTConfig(config.Config{
+		Kubeconfig:       kubeconfig,
+		KubeAPIQPS:       20,
+		KubeAPIBurst:     40,
+		KubeAPIUserAgent: "authenticator-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restConfig.QPS != 20 || restConfig.Burst != 40 {
+		t.Errorf("QPS, burst = %v, %v, want 20, 40", restConfig.QPS, restConfig.Burst)
+	}
+	if restConfig.UserAgent != "authenticator-test" {
+		t.Errorf("user agent = %q", restConfig.UserAgent)
+	}
+}
+
+func TestRESTConfigNotInCluster(t *testing.T) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		t.Skip("running in a pod")
+	}
+	_, err := RESTConfig(config.Config{})
+	if err == nil || !strings.Contains(err.Error(), "--kubeconfig") {
+		t.Errorf("err = %v, want a hint to set --kubeconfig", err)
+	}
+}
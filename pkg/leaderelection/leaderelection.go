@@ -0,0 +1,248 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelection elects a single leader among the server replicas
+// for work that must only be done once, such as writing to the aws-auth
+// ConfigMap. The lease is recorded in a coordination.k8s.io Lease, like the
+// client-go Lease lock, so existing tooling can show the current holder.
+package leaderelection
+
+import (
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+)
+
+var logger = logging.For(logging.ComponentMapper)
+
+// Defaults for Config.
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewPeriod   = 5 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// Config configures an election.
+type Config struct {
+	// Leases is the namespace of the lock Lease.
+	Leases v1.LeaseInterface
+	// Name of the lock Lease, created if missing.
+	Name string
+	// Identity of this candidate, e.g. the pod name. It must be unique
+	// among the candidates.
+	Identity string
+	// LeaseDuration is how long a lease is valid for without being renewed.
+	// Other candidates take over when it elapses.
+	LeaseDuration time.Duration
+	// RenewPeriod is how often the leader renews the lease.
+	RenewPeriod time.Duration
+	// RetryPeriod is how often the other candidates try to acquire it.
+	RetryPeriod time.Duration
+}
+
+// record is the lease record stored in the spec of the Lease.
+type record struct {
+	HolderIdentity       string
+	LeaseDurationSeconds int
+	AcquireTime          metav1.MicroTime
+	RenewTime            metav1.MicroTime
+	LeaderTransitions    int
+}
+
+type elector struct {
+	Config
+	now func() time.Time
+}
+
+// Run takes part in the election until stopCh is closed. Each time this
+// candidate becomes the leader, lead is run with a channel that is closed
+// when the lease is lost or the election stops; lead should return promptly
+// after that. The lease is released on stop so another candidate can take
+// over without waiting for it to expire.
+func Run(cfg Config, stopCh <-chan struct{}, lead func(stopCh <-chan struct{})) {
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = DefaultLeaseDuration
+	}
+	if cfg.RenewPeriod == 0 {
+		cfg.RenewPeriod = DefaultRenewPeriod
+	}
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = DefaultRetryPeriod
+	}
+	e := &elector{Config: cfg, now: time.Now}
+	for {
+		if !e.acquire(stopCh) {
+			return
+		}
+		logger.WithField("lock", e.Name).Infof("%s became the leader", e.Identity)
+		leadStop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			lead(leadStop)
+		}()
+		stopped := e.renew(stopCh)
+		close(leadStop)
+		<-done
+		if stopped {
+			e.release()
+			return
+		}
+		logger.WithField("lock", e.Name).Warnf("%s lost the leader lease", e.Identity)
+	}
+}
+
+// acquire retries until the lease is acquired, returning false if stopCh is
+// closed first.
+func (e *elector) acquire(stopCh <-chan struct{}) bool {
+	ticker := time.NewTicker(e.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		if e.tryAcquireOrRenew() {
+			return true
+		}
+		select {
+		case <-stopCh:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew keeps renewing the lease until a renewal fails for longer than the
+// lease is valid, returning false, or stopCh is closed, returning true.
+func (e *elector) renew(stopCh <-chan struct{}) bool {
+	ticker := time.NewTicker(e.RenewPeriod)
+	defer ticker.Stop()
+	lastRenew := e.now()
+	for {
+		select {
+		case <-stopCh:
+			return true
+		case <-ticker.C:
+		}
+		if e.tryAcquireOrRenew() {
+			lastRenew = e.now()
+		} else if e.now().Sub(lastRenew) >= e.LeaseDuration-e.RenewPeriod {
+			// stop leading before another candidate can take over
+			return false
+		}
+	}
+}
+
+// tryAcquireOrRenew returns whether this candidate holds the lease after
+// trying to acquire or renew it.
+func (e *elector) tryAcquireOrRenew() bool {
+	now := metav1.NewMicroTime(e.now())
+	desired := record{
+		HolderIdentity:       e.Identity,
+		LeaseDurationSeconds: int(e.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	lease, err := e.Leases.Get(e.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		lease = &coordination_v1.Lease{ObjectMeta: metav1.ObjectMeta{Name: e.Name}}
+		setRecord(lease, desired)
+		if _, err := e.Leases.Create(lease); err != nil {
+			logger.WithError(err).WithField("lock", e.Name).Warn("could not create the leader lock")
+			return false
+		}
+		return true
+	} else if err != nil {
+		logger.WithError(err).WithField("lock", e.Name).Warn("could not get the leader lock")
+		return false
+	}
+
+	current := getRecord(lease)
+	if current.HolderIdentity == e.Identity {
+		desired.AcquireTime = current.AcquireTime
+		desired.LeaderTransitions = current.LeaderTransitions
+	} else {
+		expiry := current.RenewTime.Add(time.Duration(current.LeaseDurationSeconds) * time.Second)
+		if current.HolderIdentity != "" && now.Time.Before(expiry) {
+			return false
+		}
+		desired.LeaderTransitions = current.LeaderTransitions + 1
+	}
+
+	lease = lease.DeepCopy()
+	setRecord(lease, desired)
+	// the update fails with a conflict if another candidate changed the
+	// lease since it was read
+	if _, err := e.Leases.Update(lease); err != nil {
+		logger.WithError(err).WithField("lock", e.Name).Debug("could not update the leader lease")
+		return false
+	}
+	return true
+}
+
+// release gives up the lease if this candidate still holds it.
+func (e *elector) release() {
+	lease, err := e.Leases.Get(e.Name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	current := getRecord(lease)
+	if current.HolderIdentity != e.Identity {
+		return
+	}
+	current.HolderIdentity = ""
+	lease = lease.DeepCopy()
+	setRecord(lease, current)
+	if _, err := e.Leases.Update(lease); err != nil {
+		logger.WithError(err).WithField("lock", e.Name).Warn("could not release the leader lease")
+	}
+}
+
+func getRecord(lease *coordination_v1.Lease) record {
+	var r record
+	spec := lease.Spec
+	if spec.HolderIdentity != nil {
+		r.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		r.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.AcquireTime != nil {
+		r.AcquireTime = *spec.AcquireTime
+	}
+	if spec.RenewTime != nil {
+		r.RenewTime = *spec.RenewTime
+	}
+	if spec.LeaseTransitions != nil {
+		r.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	return r
+}
+
+func setRecord(lease *coordination_v1.Lease, r record) {
+	leaseDurationSeconds := int32(r.LeaseDurationSeconds)
+	leaseTransitions := int32(r.LeaderTransitions)
+	lease.Spec = coordination_v1.LeaseSpec{
+		HolderIdentity:       &r.HolderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &r.AcquireTime,
+		RenewTime:            &r.RenewTime,
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
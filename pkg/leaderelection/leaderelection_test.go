@@ -0,0 +1,83 @@
+package leaderelection
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTryAcquireOrRenew(t *testing.T) {
+	leases := k8sfake.NewSimpleClientset().CoordinationV1().Leases("kube-system")
+	now := time.Now()
+	clock := func() time.Time { return now }
+	newElector := func(identity string) *elector {
+		return &elector{Config: Config{Leases: leases, Name: "lock", Identity: identity, LeaseDuration: 15 * time.Second}, now: clock}
+	}
+	a, b := newElector("a"), newElector("b")
+
+	if !a.tryAcquireOrRenew() {
+		t.Fatalf("expected a to create the lock and lead")
+	}
+	if b.tryAcquireOrRenew() {
+		t.Errorf("expected b not to acquire a lease held by a")
+	}
+	now = now.Add(10 * time.Second)
+	if !a.tryAcquireOrRenew() {
+		t.Errorf("expected a to renew its lease")
+	}
+	now = now.Add(10 * time.Second)
+	if b.tryAcquireOrRenew() {
+		t.Errorf("expected b not to acquire the renewed lease")
+	}
+	now = now.Add(6 * time.Second)
+	if !b.tryAcquireOrRenew() {
+		t.Fatalf("expected b to take over the expired lease")
+	}
+	if a.tryAcquireOrRenew() {
+		t.Errorf("expected a not to take the lease back from b")
+	}
+
+	lease, _ := leases.Get("lock", metav1.GetOptions{})
+	if r := getRecord(lease); r.HolderIdentity != "b" || r.LeaderTransitions != 1 {
+		t.Errorf("unexpected lease record %+v", r)
+	}
+
+	b.release()
+	if !a.tryAcquireOrRenew() {
+		t.Errorf("expected a to acquire the released lease")
+	}
+}
+
+func TestRun(t *testing.T) {
+	leases := k8sfake.NewSimpleClientset().CoordinationV1().Leases("kube-system")
+	stopCh := make(chan struct{})
+	leading := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Run(Config{Leases: leases, Name: "lock", Identity: "a", RenewPeriod: 10 * time.Millisecond, RetryPeriod: 10 * time.Millisecond},
+			stopCh, func(leadStop <-chan struct{}) {
+				close(leading)
+				<-leadStop
+			})
+	}()
+
+	select {
+	case <-leading:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting to lead")
+	}
+	close(stopCh)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for Run to return")
+	}
+
+	lease, _ := leases.Get("lock", metav1.GetOptions{})
+	if r := getRecord(lease); r.HolderIdentity != "" {
+		t.Errorf("expected the lease to be released, held by %q", r.HolderIdentity)
+	}
+}
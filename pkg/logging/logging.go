@@ -0,0 +1,115 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging configures the format and levels of the logs, with a
+// separate level per component so e.g. the mappers can be debugged without
+// the noise of every request.
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Components with their own log level.
+const (
+	ComponentServer   = "server"
+	ComponentMapper   = "mapper"
+	ComponentVerifier = "verifier"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var loggers = map[string]*logrus.Logger{
+	ComponentServer:   newLogger(),
+	ComponentMapper:   newLogger(),
+	ComponentVerifier: newLogger(),
+}
+
+func newLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetFormatter(newFormatter(FormatText))
+	return l
+}
+
+func newFormatter(format string) logrus.Formatter {
+	if format == FormatJSON {
+		return &logrus.JSONFormatter{}
+	}
+	return &logrus.TextFormatter{FullTimestamp: true}
+}
+
+// For returns the logger of component. Its entries carry a component field
+// and are filtered by the level of the component. Loggers of unknown
+// components log through the standard logger.
+func For(component string) *logrus.Entry {
+	l, ok := loggers[component]
+	if !ok {
+		l = logrus.StandardLogger()
+	}
+	return l.WithField("component", component)
+}
+
+// Components returns the names of the components with their own level.
+func Components() []string {
+	components := make([]string, 0, len(loggers))
+	for c := range loggers {
+		components = append(components, c)
+	}
+	sort.Strings(components)
+	return components
+}
+
+// Configure sets the format of all logs to FormatText or FormatJSON, their
+// level, and the levels of the components in componentLevels, which
+// override level.
+func Configure(format, level string, componentLevels map[string]string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("unknown log format %q, must be %s or %s", format, FormatText, FormatJSON)
+	}
+	defaultLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels := map[string]logrus.Level{}
+	for component, l := range componentLevels {
+		if _, ok := loggers[component]; !ok {
+			return fmt.Errorf("unknown log component %q, must be one of %s", component, strings.Join(Components(), ", "))
+		}
+		if levels[component], err = logrus.ParseLevel(l); err != nil {
+			return fmt.Errorf("invalid level for log component %s: %v", component, err)
+		}
+	}
+
+	logrus.SetFormatter(newFormatter(format))
+	logrus.SetLevel(defaultLevel)
+	for component, l := range loggers {
+		l.SetFormatter(newFormatter(format))
+		if componentLevel, ok := levels[component]; ok {
+			l.SetLevel(componentLevel)
+		} else {
+			l.SetLevel(defaultLevel)
+		}
+	}
+	return nil
+}
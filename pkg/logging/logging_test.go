@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigure(t *testing.T) {
+	defer Configure(FormatText, "info", nil)
+
+	if err := Configure(FormatJSON, "warn", map[string]string{ComponentMapper: "debug"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := loggers[ComponentMapper].GetLevel(); got != logrus.DebugLevel {
+		t.Errorf("expected the mapper level to be debug, got %s", got)
+	}
+	if got := loggers[ComponentServer].GetLevel(); got != logrus.WarnLevel {
+		t.Errorf("expected the server level to be warn, got %s", got)
+	}
+	if got := logrus.GetLevel(); got != logrus.WarnLevel {
+		t.Errorf("expected the standard level to be warn, got %s", got)
+	}
+
+	var buf bytes.Buffer
+	loggers[ComponentMapper].SetOutput(&buf)
+	For(ComponentMapper).WithField("arn", "arn:aws:iam::123456789012:role/Admin").Debug("mapped")
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log entry, got %q: %v", buf.String(), err)
+	}
+	if entry["component"] != ComponentMapper || entry["arn"] == "" || entry["msg"] != "mapped" {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+
+	for _, c := range []struct {
+		format, level string
+		components    map[string]string
+	}{
+		{"xml", "info", nil},
+		{FormatText, "loud", nil},
+		{FormatText, "info", map[string]string{"nope": "debug"}},
+		{FormatText, "info", map[string]string{ComponentServer: "loud"}},
+	} {
+		if err := Configure(c.format, c.level, c.components); err == nil {
+			t.Errorf("Configure(%q, %q, %v): expected an error", c.format, c.level, c.components)
+		}
+	}
+}
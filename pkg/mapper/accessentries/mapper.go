@@ -0,0 +1,284 @@
+package accessentries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/eksapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sqsapi"
+)
+
+var logger = logging.For(logging.ComponentMapper)
+
+// nodeGroups are the groups EKS grants the nodes of EC2 and Fargate access
+// entries, which have no Kubernetes groups of their own.
+var nodeGroups = map[string][]string{
+	eksapi.AccessEntryTypeEC2Linux:     {"system:bootstrappers", "system:nodes"},
+	eksapi.AccessEntryTypeEC2Windows:   {"system:bootstrappers", "system:nodes", "eks:kube-proxy-windows"},
+	eksapi.AccessEntryTypeFargateLinux: {"system:bootstrappers", "system:nodes", "system:node-proxier"},
+}
+
+// nodeUsernames are the usernames EKS gives the nodes of EC2 and Fargate
+// access entries.
+var nodeUsernames = map[string]string{
+	eksapi.AccessEntryTypeEC2Linux:     "system:node:{{EC2PrivateDNSName}}",
+	eksapi.AccessEntryTypeEC2Windows:   "system:node:{{EC2PrivateDNSName}}",
+	eksapi.AccessEntryTypeFargateLinux: "system:node:{{SessionName}}",
+}
+
+// queueRetryInterval is how long receiving change notifications waits after
+// failing before trying again.
+var queueRetryInterval = 30 * time.Second
+
+type accessEntryClient interface {
+	ListAccessEntries(cluster string) ([]string, error)
+	DescribeAccessEntry(cluster, principalARN string) (*eksapi.AccessEntry, error)
+}
+
+type changeQueue interface {
+	ReceiveMessages(ctx context.Context, queueURL string) ([]string, error)
+	DeleteMessage(queueURL, receiptHandle string) error
+}
+
+// AccessEntriesMapper maps the IAM principals of the access entries of an
+// EKS cluster, so a self-managed cluster can share the access of an
+// EKS-managed one. The entries are listed and described every
+// refreshInterval, and whenever a change notification arrives on queueURL
+// if set; their access policies are authorization, which this backend
+// leaves to Kubernetes RBAC.
+type AccessEntriesMapper struct {
+	eks             accessEntryClient
+	cluster         string
+	refreshInterval time.Duration
+	queue           changeQueue
+	queueURL        string
+	strict          bool
+	loads           *mapper.LoadTracker
+	changes         *mapper.ChangeRecorder
+
+	// loadMu keeps a periodic and a notified load from recording their
+	// entries out of order.
+	loadMu   sync.Mutex
+	mu       sync.RWMutex
+	mappings map[string]config.IdentityMapping
+}
+
+var _ mapper.Mapper = &AccessEntriesMapper{}
+var _ mapper.Loader = &AccessEntriesMapper{}
+var _ mapper.Lister = &AccessEntriesMapper{}
+var _ mapper.StatusReporter = &AccessEntriesMapper{}
+
+func NewAccessEntriesMapper(cfg config.Config) (*AccessEntriesMapper, error) {
+	if cfg.EKSAccessEntriesCluster == "" {
+		return nil, errors.New("the EKS cluster of the access entries must be set")
+	}
+	m := newAccessEntriesMapper(eksapi.New(cfg.EKSAccessEntriesRegion, cfg.EKSAccessEntriesRoleARN), cfg)
+	if cfg.EKSAccessEntriesQueueURL != "" {
+		m.queue = sqsapi.New(cfg.EKSAccessEntriesRegion, cfg.EKSAccessEntriesRoleARN)
+	}
+	return m, nil
+}
+
+func newAccessEntriesMapper(eks accessEntryClient, cfg config.Config) *AccessEntriesMapper {
+	return &AccessEntriesMapper{
+		eks:             eks,
+		cluster:         cfg.EKSAccessEntriesCluster,
+		refreshInterval: cfg.EKSAccessEntriesRefreshInterval,
+		queueURL:        cfg.EKSAccessEntriesQueueURL,
+		strict:          cfg.StrictARNMatching,
+		loads:           mapper.NewLoadTracker(mapper.ModeEKSAccessEntries),
+		changes:         mapper.NewChangeRecorder(mapper.ModeEKSAccessEntries),
+	}
+}
+
+func (m *AccessEntriesMapper) Name() string {
+	return mapper.ModeEKSAccessEntries
+}
+
+// Start loads the access entries and refreshes them every refreshInterval,
+// and on change notifications, until stopCh is closed. Failed refreshes keep
+// the mappings last loaded.
+func (m *AccessEntriesMapper) Start(stopCh <-chan struct{}) error {
+	if m.queue != nil && m.queueURL != "" {
+		go m.watchQueue(stopCh)
+	}
+	go func() {
+		if err := m.Load(stopCh); err != nil {
+			logger.WithError(err).Error("could not load EKS access entries")
+		}
+		if m.refreshInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(m.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := m.Load(stopCh); err != nil {
+					logger.WithError(err).Error("could not refresh EKS access entries")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// watchQueue reloads the access entries whenever messages arrive on the
+// queue, e.g. from an EventBridge rule or SNS topic on changes to the access
+// entries. The messages are deleted only once the reload succeeded, so a
+// failed one is retried when SQS delivers them again.
+func (m *AccessEntriesMapper) watchQueue(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		handles, err := m.queue.ReceiveMessages(ctx, m.queueURL)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Error("could not receive EKS access entry change notifications")
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(queueRetryInterval):
+			}
+			continue
+		}
+		if len(handles) == 0 {
+			continue
+		}
+		if err := m.Load(stopCh); err != nil {
+			logger.WithError(err).Error("could not reload EKS access entries on change notification")
+			continue
+		}
+		for _, handle := range handles {
+			if err := m.queue.DeleteMessage(m.queueURL, handle); err != nil {
+				logger.WithError(err).Warn("could not delete EKS access entry change notification")
+			}
+		}
+	}
+}
+
+// Load lists and describes the access entries of the cluster and replaces
+// the mappings with theirs.
+func (m *AccessEntriesMapper) Load(_ <-chan struct{}) error {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	mappings, err := m.fetch()
+	if err != nil {
+		m.loads.Failed(err, time.Now())
+		return err
+	}
+	m.mu.Lock()
+	m.mappings = mappings
+	m.mu.Unlock()
+	m.loads.Succeeded("", time.Now())
+	m.changes.Record(m.List())
+	logger.WithField("mappings", len(mappings)).Debug("loaded EKS access entries")
+	return nil
+}
+
+func (m *AccessEntriesMapper) fetch() (map[string]config.IdentityMapping, error) {
+	arns, err := m.eks.ListAccessEntries(m.cluster)
+	if err != nil {
+		return nil, err
+	}
+	mappings := map[string]config.IdentityMapping{}
+	for _, principalARN := range arns {
+		entry, err := m.eks.DescribeAccessEntry(m.cluster, principalARN)
+		if errors.Is(err, eksapi.ErrNotFound) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping, err := mappingFor(entry)
+		if err != nil {
+			logger.WithError(err).WithField("arn", principalARN).Warn("ignoring EKS access entry")
+			continue
+		}
+		mappings[mapper.ARNKey(mapping.IdentityARN, m.strict)] = *mapping
+	}
+	return mappings, nil
+}
+
+// mappingFor returns the mapping of entry. Role ARNs lose their path, as the
+// canonical ARNs of assumed roles don't have it.
+func mappingFor(entry *eksapi.AccessEntry) (*config.IdentityMapping, error) {
+	principal, err := arn.Parse(entry.PrincipalARN)
+	if err != nil || principal.Service != "iam" {
+		return nil, fmt.Errorf("%q is not an IAM principal", entry.PrincipalARN)
+	}
+	principalARN := entry.PrincipalARN
+	if principal.Type == arn.TypeRole {
+		principalARN = principal.WithoutPath().String()
+	}
+
+	mapping := &config.IdentityMapping{
+		IdentityARN: principalARN,
+		Username:    entry.Username,
+		Groups:      entry.KubernetesGroups,
+	}
+	switch entry.Type {
+	case eksapi.AccessEntryTypeStandard, "":
+		if mapping.Username == "" {
+			mapping.Username = principalARN
+			if principal.Type == arn.TypeRole {
+				mapping.Username = fmt.Sprintf("arn:%s:sts::%s:assumed-role/%s/{{SessionName}}", principal.Partition, principal.AccountID, principal.Name)
+			}
+		}
+	case eksapi.AccessEntryTypeEC2Linux, eksapi.AccessEntryTypeEC2Windows, eksapi.AccessEntryTypeFargateLinux:
+		if mapping.Username == "" {
+			mapping.Username = nodeUsernames[entry.Type]
+		}
+		mapping.Groups = append(append([]string{}, nodeGroups[entry.Type]...), entry.KubernetesGroups...)
+	default:
+		return nil, fmt.Errorf("unsupported access entry type %q", entry.Type)
+	}
+	return mapping, nil
+}
+
+func (m *AccessEntriesMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if mapping, ok := m.mappings[mapper.ARNKey(canonicalARN, m.strict)]; ok {
+		return &mapping, nil
+	}
+	return nil, mapper.ErrNotMapped
+}
+
+func (m *AccessEntriesMapper) IsAccountAllowed(accountID string) (bool, error) {
+	return false, nil
+}
+
+func (m *AccessEntriesMapper) List() ([]config.IdentityMapping, []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mappings := make([]config.IdentityMapping, 0, len(m.mappings))
+	for _, mapping := range m.mappings {
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+func (m *AccessEntriesMapper) LoadStatus() mapper.LoadStatus {
+	return m.loads.LoadStatus()
+}
@@ -0,0 +1,245 @@
+package accessentries
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/eksapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+type fakeEKS struct {
+	entries map[string]*eksapi.AccessEntry
+	listErr error
+}
+
+func (f *fakeEKS) ListAccessEntries(cluster string) ([]string, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	var arns []string
+	for arn := range f.entries {
+		arns = append(arns, arn)
+	}
+	// an entry deleted after it was listed
+	return append(arns, "arn:aws:iam::123456789012:role/Deleted"), nil
+}
+
+func (f *fakeEKS) DescribeAccessEntry(cluster, principalARN string) (*eksapi.AccessEntry, error) {
+	if cluster != "prod" {
+		return nil, eksapi.ErrNotFound
+	}
+	entry, ok := f.entries[principalARN]
+	if !ok {
+		return nil, eksapi.ErrNotFound
+	}
+	return entry, nil
+}
+
+// fakeQueue delivers the receipt handles sent on messages and sends the
+// deleted ones on deleted.
+type fakeQueue struct {
+	messages chan []string
+	deleted  chan string
+}
+
+func (f *fakeQueue) ReceiveMessages(ctx context.Context, queueURL string) ([]string, error) {
+	select {
+	case handles := <-f.messages:
+		return handles, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fakeQueue) DeleteMessage(queueURL, receiptHandle string) error {
+	f.deleted <- receiptHandle
+	return nil
+}
+
+func TestMap(t *testing.T) {
+	eks := &fakeEKS{entries: map[string]*eksapi.AccessEntry{
+		"arn:aws:iam::123456789012:role/teams/Dev": {
+			PrincipalARN:     "arn:aws:iam::123456789012:role/teams/Dev",
+			Type:             eksapi.AccessEntryTypeStandard,
+			Username:         "dev-{{SessionName}}",
+			KubernetesGroups: []string{"developers"},
+		},
+		"arn:aws:iam::123456789012:user/Alice": {
+			PrincipalARN: "arn:aws:iam::123456789012:user/Alice",
+			Type:         eksapi.AccessEntryTypeStandard,
+		},
+		"arn:aws:iam::123456789012:role/Nodes": {
+			PrincipalARN: "arn:aws:iam::123456789012:role/Nodes",
+			Type:         eksapi.AccessEntryTypeEC2Linux,
+			Username:     "system:node:{{EC2PrivateDNSName}}",
+		},
+		"arn:aws:iam::123456789012:role/Pods": {
+			PrincipalARN: "arn:aws:iam::123456789012:role/Pods",
+			Type:         eksapi.AccessEntryTypeFargateLinux,
+		},
+		"arn:aws:iam::123456789012:role/Future": {
+			PrincipalARN: "arn:aws:iam::123456789012:role/Future",
+			Type:         "HYPOTHETICAL",
+		},
+	}}
+	m := newAccessEntriesMapper(eks, config.Config{EKSAccessEntriesCluster: "prod"})
+	if _, err := m.Map("arn:aws:iam::123456789012:role/dev"); err != mapper.ErrNotMapped {
+		t.Errorf("expected ErrNotMapped before loading, got %v", err)
+	}
+	if err := m.Load(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, c := range []struct {
+		arn      string
+		expected *config.IdentityMapping
+	}{
+		{"arn:aws:iam::123456789012:role/Dev", &config.IdentityMapping{
+			IdentityARN: "arn:aws:iam::123456789012:role/Dev",
+			Username:    "dev-{{SessionName}}",
+			Groups:      []string{"developers"},
+		}},
+		{"arn:aws:iam::123456789012:user/alice", &config.IdentityMapping{
+			IdentityARN: "arn:aws:iam::123456789012:user/Alice",
+			Username:    "arn:aws:iam::123456789012:user/Alice",
+		}},
+		{"arn:aws:iam::123456789012:role/Nodes", &config.IdentityMapping{
+			IdentityARN: "arn:aws:iam::123456789012:role/Nodes",
+			Username:    "system:node:{{EC2PrivateDNSName}}",
+			Groups:      []string{"system:bootstrappers", "system:nodes"},
+		}},
+		{"arn:aws:iam::123456789012:role/Pods", &config.IdentityMapping{
+			IdentityARN: "arn:aws:iam::123456789012:role/Pods",
+			Username:    "system:node:{{SessionName}}",
+			Groups:      []string{"system:bootstrappers", "system:nodes", "system:node-proxier"},
+		}},
+		{"arn:aws:iam::123456789012:role/Future", nil},
+		{"arn:aws:iam::123456789012:role/Deleted", nil},
+	} {
+		mapping, err := m.Map(c.arn)
+		if c.expected == nil {
+			if err != mapper.ErrNotMapped {
+				t.Errorf("%s: expected ErrNotMapped, got %v, %v", c.arn, mapping, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.arn, err)
+			continue
+		}
+		if !reflect.DeepEqual(mapping, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.arn, c.expected, mapping)
+		}
+	}
+	if mappings, _ := m.List(); len(mappings) != 4 {
+		t.Errorf("expected 4 mappings to be listed, got %v", mappings)
+	}
+}
+
+func TestMapDefaultRoleUsername(t *testing.T) {
+	mapping, err := mappingFor(&eksapi.AccessEntry{
+		PrincipalARN: "arn:aws:iam::123456789012:role/path/Admin",
+		Type:         eksapi.AccessEntryTypeStandard,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "arn:aws:sts::123456789012:assumed-role/Admin/{{SessionName}}"; mapping.Username != expected {
+		t.Errorf("expected username %s, got %s", expected, mapping.Username)
+	}
+}
+
+func TestLoadFailureKeepsMappings(t *testing.T) {
+	eks := &fakeEKS{entries: map[string]*eksapi.AccessEntry{
+		"arn:aws:iam::123456789012:user/Alice": {
+			PrincipalARN: "arn:aws:iam::123456789012:user/Alice",
+			Type:         eksapi.AccessEntryTypeStandard,
+			Username:     "alice",
+		},
+	}}
+	m := newAccessEntriesMapper(eks, config.Config{EKSAccessEntriesCluster: "prod"})
+	if err := m.Load(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eks.listErr = errors.New("throttled")
+	if err := m.Load(nil); err == nil {
+		t.Fatalf("expected the failed refresh to be returned")
+	}
+	if _, err := m.Map("arn:aws:iam::123456789012:user/Alice"); err != nil {
+		t.Errorf("expected the last entries to be kept, got %v", err)
+	}
+	if status := m.LoadStatus(); status.LastError == "" || status.LastSuccessfulLoad.IsZero() {
+		t.Errorf("expected the failure and the last successful load to be recorded, got %+v", status)
+	}
+}
+
+func TestChangeNotificationReloads(t *testing.T) {
+	eks := &fakeEKS{entries: map[string]*eksapi.AccessEntry{
+		"arn:aws:iam::123456789012:user/Alice": {
+			PrincipalARN: "arn:aws:iam::123456789012:user/Alice",
+			Type:         eksapi.AccessEntryTypeStandard,
+			Username:     "alice",
+		},
+	}}
+	queue := &fakeQueue{messages: make(chan []string), deleted: make(chan string, 10)}
+	// no refresh interval, so only notifications reload the entries
+	m := newAccessEntriesMapper(eks, config.Config{
+		EKSAccessEntriesCluster:  "prod",
+		EKSAccessEntriesQueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/access-entries",
+	})
+	m.queue = queue
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := m.Start(stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, "the initial load", func() bool {
+		_, err := m.Map("arn:aws:iam::123456789012:user/Alice")
+		return err == nil
+	})
+
+	// a failed reload keeps the notification for SQS to deliver again
+	eks.listErr = errors.New("throttled")
+	queue.messages <- []string{"handle-1"}
+	waitFor(t, "the failed reload", func() bool { return m.LoadStatus().LastError != "" })
+	select {
+	case handle := <-queue.deleted:
+		t.Fatalf("expected the notification of the failed reload to be kept, %s was deleted", handle)
+	default:
+	}
+
+	eks.listErr = nil
+	eks.entries["arn:aws:iam::123456789012:user/Bob"] = &eksapi.AccessEntry{
+		PrincipalARN: "arn:aws:iam::123456789012:user/Bob",
+		Type:         eksapi.AccessEntryTypeStandard,
+		Username:     "bob",
+	}
+	queue.messages <- []string{"handle-1", "handle-2"}
+	for _, expected := range []string{"handle-1", "handle-2"} {
+		select {
+		case handle := <-queue.deleted:
+			if handle != expected {
+				t.Errorf("expected %s to be deleted, got %s", expected, handle)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s to be deleted", expected)
+		}
+	}
+	if mapping, err := m.Map("arn:aws:iam::123456789012:user/Bob"); err != nil || mapping.Username != "bob" {
+		t.Errorf("expected the notified entry to be mapped, got %v, %v", mapping, err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// ErrAccountsUnavailable is returned when an account allowlist cannot be
+// fetched and there is no cached copy recent enough to use. It means the
+// account is neither known to be allowed nor known not to be.
+var ErrAccountsUnavailable = errors.New("account allowlist is unavailable")
+
+// accountRetryInterval is how long a failed fetch is remembered before the
+// source is queried again, so an unavailable source isn't hit on every
+// request.
+const accountRetryInterval = 5 * time.Second
+
+// AccountSource lists the AWS accounts whose identities are allowed to
+// authenticate without an explicit mapping.
+type AccountSource interface {
+	// Name identifies the source in logs and metrics.
+	Name() string
+	// Accounts returns every allowed account ID.
+	Accounts() ([]string, error)
+}
+
+// FileAccountSource reads the allowlist from a YAML list of account IDs, the
+// same format as mapAccounts, re-reading the file on every fetch.
+type FileAccountSource struct {
+	Path string
+}
+
+var _ AccountSource = &FileAccountSource{}
+
+func (s *FileAccountSource) Name() string {
+	return "file"
+}
+
+func (s *FileAccountSource) Accounts() ([]string, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []string
+	if err := yaml.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("could not parse accounts file %s: %v", s.Path, err)
+	}
+	return accounts, nil
+}
+
+// AccountCache answers allowlist checks from an AccountSource, fetching the
+// full list at most once per ttl.
+//
+// When a refresh fails the previous list keeps being used, with a warning,
+// until it is maxStale past its ttl. After that, or if the source has never
+// answered, IsAllowed returns ErrAccountsUnavailable so callers can tell
+// "not allowed" apart from "unknown".
+type AccountCache struct {
+	source   AccountSource
+	ttl      time.Duration
+	maxStale time.Duration
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	accounts  map[string]bool
+	fetchedAt time.Time
+	failedAt  time.Time
+	lastErr   error
+}
+
+// NewAccountCache caches source for ttl and serves a stale copy for up to
+// maxStale while the source fails.
+func NewAccountCache(source AccountSource, ttl, maxStale time.Duration) *AccountCache {
+	return &AccountCache{
+		source:   source,
+		ttl:      ttl,
+		maxStale: maxStale,
+		now:      time.Now,
+	}
+}
+
+// IsAllowed reports whether accountID is in the allowlist.
+func (c *AccountCache) IsAllowed(accountID string) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if c.accounts == nil || now.Sub(c.fetchedAt) >= c.ttl {
+		c.refresh(now)
+	}
+	if c.accounts == nil {
+		return false, fmt.Errorf("%w: %v", ErrAccountsUnavailable, c.lastErr)
+	}
+	if age := now.Sub(c.fetchedAt); age >= c.ttl+c.maxStale {
+		return false, fmt.Errorf("%w: cached copy from %s ago is too stale: %v", ErrAccountsUnavailable, age.Round(time.Second), c.lastErr)
+	}
+	return c.accounts[accountID], nil
+}
+
+// Must be called with the mutex held.
+func (c *AccountCache) refresh(now time.Time) {
+	if !c.failedAt.IsZero() && now.Sub(c.failedAt) < accountRetryInterval {
+		return
+	}
+	accounts, err := c.source.Accounts()
+	if err != nil {
+		metrics.AccountAllowlistRefreshes.WithLabelValues(c.source.Name(), metrics.RefreshError).Inc()
+		logger.WithError(err).WithField("source", c.source.Name()).Warn("could not refresh account allowlist, using the cached copy if any")
+		c.failedAt = now
+		c.lastErr = err
+		return
+	}
+	metrics.AccountAllowlistRefreshes.WithLabelValues(c.source.Name(), metrics.RefreshSuccess).Inc()
+	c.accounts = make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		c.accounts[account] = true
+	}
+	c.fetchedAt = now
+	c.failedAt = time.Time{}
+	c.lastErr = nil
+}
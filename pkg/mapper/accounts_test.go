@@ -0,0 +1,97 @@
+package mapper
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeAccountSource struct {
+	accounts []string
+	err      error
+	calls    int
+}
+
+func (s *fakeAccountSource) Name() string { return "fake" }
+func (s *fakeAccountSource) Accounts() ([]string, error) {
+	s.calls++
+	return s.accounts, s.err
+}
+
+func TestAccountCache(t *testing.T) {
+	source := &fakeAccountSource{err: errors.New("throttled")}
+	c := NewAccountCache(source, time.Minute, 5*time.Minute)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	if _, err := c.IsAllowed("123"); !errors.Is(err, ErrAccountsUnavailable) {
+		t.Fatalf("expected ErrAccountsUnavailable before the first fetch, got %v", err)
+	}
+
+	now = now.Add(accountRetryInterval)
+	source.accounts, source.err = []string{"123"}, nil
+	if allowed, err := c.IsAllowed("123"); !allowed || err != nil {
+		t.Fatalf("expected 123 to be allowed, got %t, %v", allowed, err)
+	}
+	if allowed, err := c.IsAllowed("456"); allowed || err != nil {
+		t.Fatalf("expected 456 not to be allowed, got %t, %v", allowed, err)
+	}
+	if source.calls != 2 {
+		t.Errorf("expected lookups within the TTL to be cached, got %d fetches", source.calls)
+	}
+
+	// the source fails after the TTL, the stale list keeps answering
+	now = now.Add(2 * time.Minute)
+	source.err = errors.New("throttled")
+	if allowed, err := c.IsAllowed("123"); !allowed || err != nil {
+		t.Fatalf("expected the stale list to be used, got %t, %v", allowed, err)
+	}
+	c.IsAllowed("123")
+	if source.calls != 3 {
+		t.Errorf("expected failed fetches to be retried after %s, got %d fetches", accountRetryInterval, source.calls)
+	}
+
+	// past maxStale the answer is unknown rather than "not allowed"
+	now = now.Add(5 * time.Minute)
+	if _, err := c.IsAllowed("123"); !errors.Is(err, ErrAccountsUnavailable) {
+		t.Fatalf("expected ErrAccountsUnavailable past maxStale, got %v", err)
+	}
+
+	source.err = nil
+	now = now.Add(accountRetryInterval)
+	if allowed, err := c.IsAllowed("123"); !allowed || err != nil {
+		t.Fatalf("expected the cache to recover, got %t, %v", allowed, err)
+	}
+}
+
+func TestFileAccountSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accounts")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.yaml")
+	if err := ioutil.WriteFile(path, []byte("- \"012345678901\"\n- \"456789012345\"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s := &FileAccountSource{Path: path}
+	accounts, err := s.Accounts()
+	if err != nil {
+		t.Fatalf("Accounts: %v", err)
+	}
+	if want := []string{"012345678901", "456789012345"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("expected %v, got %v", want, accounts)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not: a list"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := s.Accounts(); err == nil {
+		t.Errorf("expected an error for a malformed file")
+	}
+}
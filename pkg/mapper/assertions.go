@@ -0,0 +1,32 @@
+package mapper
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// CheckAssertions returns an error for each assertion that mappings don't
+// satisfy. ARNs are compared with ARNKey.
+func CheckAssertions(assertions []config.MappingAssertion, mappings []config.IdentityMapping, strict bool) []error {
+	byARN := make(map[string]config.IdentityMapping, len(mappings))
+	for _, m := range mappings {
+		byARN[ARNKey(m.IdentityARN, strict)] = m
+	}
+	var errs []error
+	for _, a := range assertions {
+		m, ok := byARN[ARNKey(a.ARN, strict)]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s is not mapped", a.ARN))
+		case a.Username != "" && m.Username != a.Username:
+			errs = append(errs, fmt.Errorf("%s is mapped to username %q, not %q", a.ARN, m.Username, a.Username))
+		default:
+			if missing := sets.NewString(a.Groups...).Difference(sets.NewString(m.Groups...)); missing.Len() > 0 {
+				errs = append(errs, fmt.Errorf("%s is not mapped to groups %v", a.ARN, missing.List()))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,33 @@
+package mapper
+
+import (
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func TestCheckAssertions(t *testing.T) {
+	mappings := []config.IdentityMapping{{
+		IdentityARN: "arn:aws:iam::111122223333:role/Admin",
+		Username:    "admin",
+		Groups:      []string{"system:masters", "admins"},
+	}}
+	for _, c := range []struct {
+		name      string
+		assertion config.MappingAssertion
+		strict    bool
+		fails     bool
+	}{
+		{"satisfied", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/Admin", Username: "admin", Groups: []string{"system:masters"}}, false, false},
+		{"case-insensitive", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/admin"}, false, false},
+		{"strict", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/admin"}, true, true},
+		{"unmapped", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/Other"}, false, true},
+		{"username", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/Admin", Username: "root"}, false, true},
+		{"groups", config.MappingAssertion{ARN: "arn:aws:iam::111122223333:role/Admin", Groups: []string{"system:masters", "ops"}}, false, true},
+	} {
+		errs := CheckAssertions([]config.MappingAssertion{c.assertion}, mappings, c.strict)
+		if (len(errs) > 0) != c.fails {
+			t.Errorf("%s: expected failure %t, got %v", c.name, c.fails, errs)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mapper
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// Kinds of changes between two loads of the mappings of a backend.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// MappingChange is a mapping or an account that was added, removed or
+// changed by a reload of a backend.
+type MappingChange struct {
+	// Change is ChangeAdded, ChangeRemoved or ChangeChanged.
+	Change string
+	// ARN is the canonical ARN of a changed mapping, empty for accounts.
+	ARN string
+	// AccountID is the changed account, empty for mappings.
+	AccountID string
+	// Old and New are the mapping before and after the change, nil if it
+	// was added or removed.
+	Old, New *config.IdentityMapping
+}
+
+// DiffMappings returns the changes from the mappings and accounts old to
+// those of new, sorted by ARN and then account.
+func DiffMappings(oldMappings []config.IdentityMapping, oldAccounts []string, newMappings []config.IdentityMapping, newAccounts []string) []MappingChange {
+	before := map[string]*config.IdentityMapping{}
+	for i := range oldMappings {
+		before[oldMappings[i].IdentityARN] = &oldMappings[i]
+	}
+	after := map[string]*config.IdentityMapping{}
+	for i := range newMappings {
+		after[newMappings[i].IdentityARN] = &newMappings[i]
+	}
+	var changes []MappingChange
+	for arn, old := range before {
+		cur, ok := after[arn]
+		switch {
+		case !ok:
+			changes = append(changes, MappingChange{Change: ChangeRemoved, ARN: arn, Old: old})
+		case !sameIdentityMapping(*old, *cur):
+			changes = append(changes, MappingChange{Change: ChangeChanged, ARN: arn, Old: old, New: cur})
+		}
+	}
+	for arn, cur := range after {
+		if _, ok := before[arn]; !ok {
+			changes = append(changes, MappingChange{Change: ChangeAdded, ARN: arn, New: cur})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ARN < changes[j].ARN })
+
+	oldSet, newSet := map[string]bool{}, map[string]bool{}
+	for _, account := range oldAccounts {
+		oldSet[account] = true
+	}
+	for _, account := range newAccounts {
+		newSet[account] = true
+	}
+	var accountChanges []MappingChange
+	for account := range oldSet {
+		if !newSet[account] {
+			accountChanges = append(accountChanges, MappingChange{Change: ChangeRemoved, AccountID: account})
+		}
+	}
+	for account := range newSet {
+		if !oldSet[account] {
+			accountChanges = append(accountChanges, MappingChange{Change: ChangeAdded, AccountID: account})
+		}
+	}
+	sort.Slice(accountChanges, func(i, j int) bool { return accountChanges[i].AccountID < accountChanges[j].AccountID })
+	return append(changes, accountChanges...)
+}
+
+// sameIdentityMapping reports whether a and b map to the same user the same
+// way. Unset and empty groups are the same.
+func sameIdentityMapping(a, b config.IdentityMapping) bool {
+	if len(a.Groups) == 0 && len(b.Groups) == 0 {
+		a.Groups, b.Groups = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ChangeRecorder logs and counts the changes between successive loads of the
+// mappings of a backend, so audit trails capture who gained or lost access
+// to the cluster and when. The zero value is not usable; use
+// NewChangeRecorder.
+type ChangeRecorder struct {
+	backend string
+
+	mu       sync.Mutex
+	recorded bool
+	mappings []config.IdentityMapping
+	accounts []string
+}
+
+// NewChangeRecorder returns a ChangeRecorder for backend.
+func NewChangeRecorder(backend string) *ChangeRecorder {
+	return &ChangeRecorder{backend: backend}
+}
+
+// Record logs and counts the changes from the mappings and accounts
+// previously recorded to mappings and accounts, and returns them. The first
+// load is only recorded, as there is nothing to compare it with.
+func (r *ChangeRecorder) Record(mappings []config.IdentityMapping, accounts []string) []MappingChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recorded {
+		r.recorded = true
+		r.mappings, r.accounts = mappings, accounts
+		logger.WithFields(logrus.Fields{
+			"backend":  r.backend,
+			"mappings": len(mappings),
+			"accounts": len(accounts),
+		}).Info("loaded mappings")
+		return nil
+	}
+	changes := DiffMappings(r.mappings, r.accounts, mappings, accounts)
+	r.mappings, r.accounts = mappings, accounts
+	for _, c := range changes {
+		metrics.MappingChanges.WithLabelValues(r.backend, c.Change).Inc()
+		fields := logrus.Fields{
+			"backend": r.backend,
+			"change":  c.Change,
+		}
+		if c.AccountID != "" {
+			fields["accountID"] = c.AccountID
+			logger.WithFields(fields).Info("account mapping changed")
+			continue
+		}
+		fields["arn"] = c.ARN
+		if c.Old != nil {
+			fields["oldUsername"] = c.Old.Username
+			fields["oldGroups"] = c.Old.Groups
+		}
+		if c.New != nil {
+			fields["username"] = c.New.Username
+			fields["groups"] = c.New.Groups
+		}
+		logger.WithFields(fields).Info("mapping changed")
+	}
+	return changes
+}
@@ -0,0 +1,53 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func TestDiffMappings(t *testing.T) {
+	old := []config.IdentityMapping{
+		{IdentityARN: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{"system:masters"}},
+		{IdentityARN: "arn:aws:iam::111122223333:role/dev", Username: "dev", Groups: []string{}},
+		{IdentityARN: "arn:aws:iam::111122223333:user/bob", Username: "bob"},
+	}
+	cur := []config.IdentityMapping{
+		{IdentityARN: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{"viewers"}},
+		{IdentityARN: "arn:aws:iam::111122223333:role/dev", Username: "dev"},
+		{IdentityARN: "arn:aws:iam::111122223333:user/alice", Username: "alice"},
+	}
+	changes := DiffMappings(old, []string{"444455556666"}, cur, []string{"777788889999"})
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Change+" "+c.ARN+c.AccountID)
+	}
+	want := []string{
+		"changed arn:aws:iam::111122223333:role/admin",
+		"added arn:aws:iam::111122223333:user/alice",
+		"removed arn:aws:iam::111122223333:user/bob",
+		"removed 444455556666",
+		"added 777788889999",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes %v, got %v", want, got)
+	}
+	if changes[0].Old.Groups[0] != "system:masters" || changes[0].New.Groups[0] != "viewers" {
+		t.Errorf("unexpected change %+v %+v", changes[0].Old, changes[0].New)
+	}
+}
+
+func TestChangeRecorder(t *testing.T) {
+	r := NewChangeRecorder("test")
+	mappings := []config.IdentityMapping{{IdentityARN: "arn:aws:iam::111122223333:role/admin", Username: "admin"}}
+	if changes := r.Record(mappings, nil); len(changes) != 0 {
+		t.Errorf("expected the first load to only be recorded, got %+v", changes)
+	}
+	if changes := r.Record(mappings, nil); len(changes) != 0 {
+		t.Errorf("expected no changes reloading the same mappings, got %+v", changes)
+	}
+	if changes := r.Record(nil, nil); len(changes) != 1 || changes[0].Change != ChangeRemoved {
+		t.Errorf("expected the mapping to be removed, got %+v", changes)
+	}
+}
@@ -0,0 +1,134 @@
+package mapper
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned by a backend whose circuit breaker is open. The
+// caller should fall through to the next backend in the chain.
+var ErrCircuitOpen = errors.New("backend circuit breaker is open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker wraps a Mapper and stops calling it after consecutive
+// failures, so that a degraded backend fails fast instead of adding its
+// latency to every authentication. After OpenDuration a single probe request
+// is let through (half-open); its success closes the circuit again.
+//
+// ErrNotMapped is not considered a failure.
+type CircuitBreaker struct {
+	Mapper
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+
+	mutex         sync.Mutex
+	state         circuitState
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+var _ Mapper = &CircuitBreaker{}
+
+// NewCircuitBreaker wraps m in a circuit breaker that opens after
+// failureThreshold consecutive errors and probes again after openDuration.
+func NewCircuitBreaker(m Mapper, failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		Mapper:           m,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}
+	metrics.CircuitBreakerState.WithLabelValues(m.Name()).Set(float64(circuitClosed))
+	return cb
+}
+
+func (cb *CircuitBreaker) Map(canonicalARN string) (*config.IdentityMapping, error) {
+	if !cb.allow() {
+		return nil, ErrCircuitOpen
+	}
+	mapping, err := cb.Mapper.Map(canonicalARN)
+	cb.record(err == nil || err == ErrNotMapped)
+	return mapping, err
+}
+
+// allow reports whether a request may be sent to the wrapped backend.
+func (cb *CircuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openDuration {
+			return false
+		}
+		cb.setState(circuitHalfOpen)
+		cb.probeInFlight = true
+		return true
+	case circuitHalfOpen:
+		if cb.probeInFlight {
+			return false
+		}
+		cb.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.probeInFlight = false
+	if success {
+		cb.failures = 0
+		if cb.state != circuitClosed {
+			cb.setState(circuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.failureThreshold {
+		cb.openedAt = cb.now()
+		cb.setState(circuitOpen)
+	}
+}
+
+// Must be called with the mutex held.
+func (cb *CircuitBreaker) setState(state circuitState) {
+	if cb.state != state {
+		logger.WithFields(logrus.Fields{
+			"backend": cb.Name(),
+			"from":    cb.state.String(),
+			"to":      state.String(),
+		}).Warn("mapper circuit breaker changed state")
+	}
+	cb.state = state
+	metrics.CircuitBreakerState.WithLabelValues(cb.Name()).Set(float64(state))
+}
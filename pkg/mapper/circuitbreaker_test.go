@@ -0,0 +1,76 @@
+package mapper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+type fakeMapper struct {
+	err   error
+	calls int
+}
+
+func (m *fakeMapper) Name() string                          { return "fake" }
+func (m *fakeMapper) Start(stopCh <-chan struct{}) error    { return nil }
+func (m *fakeMapper) IsAccountAllowed(string) (bool, error) { return false, nil }
+func (m *fakeMapper) Map(string) (*config.IdentityMapping, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &config.IdentityMapping{Username: "user"}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	backend := &fakeMapper{err: errors.New("timeout")}
+	cb := NewCircuitBreaker(backend, 2, time.Minute)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb.Map("arn"); err != backend.err {
+			t.Fatalf("expected backend error, got %v", err)
+		}
+	}
+	if _, err := cb.Map("arn"); err != ErrCircuitOpen {
+		t.Fatalf("expected circuit to be open, got %v", err)
+	}
+	if backend.calls != 2 {
+		t.Errorf("expected backend to be called twice, got %d", backend.calls)
+	}
+
+	// a failing probe re-opens the circuit immediately
+	now = now.Add(time.Minute)
+	if _, err := cb.Map("arn"); err != backend.err {
+		t.Fatalf("expected probe to reach backend, got %v", err)
+	}
+	if _, err := cb.Map("arn"); err != ErrCircuitOpen {
+		t.Fatalf("expected circuit to re-open after failed probe, got %v", err)
+	}
+
+	// a successful probe closes it
+	now = now.Add(time.Minute)
+	backend.err = nil
+	if _, err := cb.Map("arn"); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	if cb.state != circuitClosed {
+		t.Errorf("expected circuit to be closed, was %s", cb.state)
+	}
+}
+
+func TestCircuitBreakerIgnoresNotMapped(t *testing.T) {
+	backend := &fakeMapper{err: ErrNotMapped}
+	cb := NewCircuitBreaker(backend, 1, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := cb.Map("arn"); err != ErrNotMapped {
+			t.Fatalf("expected ErrNotMapped, got %v", err)
+		}
+	}
+	if cb.state != circuitClosed {
+		t.Errorf("expected circuit to stay closed, was %s", cb.state)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mapper
+
+import (
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// UsernameCollision is a static username that several ARNs are mapped to.
+// Kubernetes tells users apart by username, so each of these ARNs gets the
+// RBAC bindings of the others.
+type UsernameCollision struct {
+	Username string   `json:"username"`
+	ARNs     []string `json:"arns"`
+}
+
+// UsernameCollisions returns the static usernames mappings map several ARNs
+// to, sorted by username. Templated usernames render per identity, so they
+// aren't compared.
+func UsernameCollisions(mappings []config.IdentityMapping) []UsernameCollision {
+	arns := map[string]map[string]bool{}
+	for _, m := range mappings {
+		if m.Username == "" || strings.Contains(m.Username, "{{") {
+			continue
+		}
+		if arns[m.Username] == nil {
+			arns[m.Username] = map[string]bool{}
+		}
+		arns[m.Username][m.IdentityARN] = true
+	}
+	var collisions []UsernameCollision
+	for username, set := range arns {
+		if len(set) < 2 {
+			continue
+		}
+		c := UsernameCollision{Username: username}
+		for arn := range set {
+			c.ARNs = append(c.ARNs, arn)
+		}
+		sort.Strings(c.ARNs)
+		collisions = append(collisions, c)
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].Username < collisions[j].Username })
+	return collisions
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/kubeclient"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/leaderelection"
+)
+
+// BootstrapLockName is the Lease, in the namespace of the aws-auth
+// ConfigMap, that elects the replica writing bootstrap mappings.
+const BootstrapLockName = "aws-iam-authenticator-bootstrap-writer"
+
+// BootstrapSource provides role mappings that the BootstrapWriter keeps in
+// the aws-auth ConfigMap, such as the instance roles of node groups.
+type BootstrapSource interface {
+	Name() string
+	RoleMappings() ([]config.RoleMapping, error)
+}
+
+// StaticBootstrapSource is a fixed list of role mappings from the
+// configuration.
+type StaticBootstrapSource []config.RoleMapping
+
+func (s StaticBootstrapSource) Name() string {
+	return "config"
+}
+
+func (s StaticBootstrapSource) RoleMappings() ([]config.RoleMapping, error) {
+	return s, nil
+}
+
+// BootstrapWriter adds the role mappings of its sources to the aws-auth
+// ConfigMap, so new node groups get mapped without editing it by hand. It
+// only adds mappings for roles that aren't mapped yet: existing entries,
+// including ones it added earlier, are left to the cluster admins to change
+// or remove.
+type BootstrapWriter struct {
+	configMaps v1.ConfigMapInterface
+	// leases holds the lock electing the writer.
+	leases coordinationv1.LeaseInterface
+	// namespace and name locate the ConfigMap written to.
+	namespace string
+	name      string
+	sources   []BootstrapSource
+	interval  time.Duration
+}
+
+// NewBootstrapWriter creates a BootstrapWriter for the cluster of cfg that
+// reconciles the mappings of sources every interval.
+func NewBootstrapWriter(cfg config.Config, interval time.Duration, sources ...BootstrapSource) (*BootstrapWriter, error) {
+	clientset, err := kubeclient.NewClientset(cfg)
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := Location(cfg)
+	return &BootstrapWriter{
+		configMaps: clientset.CoreV1().ConfigMaps(namespace),
+		leases:     clientset.CoordinationV1().Leases(namespace),
+		namespace:  namespace,
+		name:       name,
+		sources:    sources,
+		interval:   interval,
+	}, nil
+}
+
+// Run reconciles every interval while this replica, named identity, is the
+// elected writer, until stopCh is closed.
+func (w *BootstrapWriter) Run(identity string, stopCh <-chan struct{}) {
+	leaderelection.Run(leaderelection.Config{
+		Leases:   w.leases,
+		Name:     BootstrapLockName,
+		Identity: identity,
+	}, stopCh, func(leadStop <-chan struct{}) {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			if err := w.Reconcile(); err != nil {
+				logger.WithError(err).Error("could not write bootstrap mappings to aws-auth")
+			}
+			select {
+			case <-leadStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// bootstrapRoleMapping is the aws-auth format of a role mapping.
+type bootstrapRoleMapping struct {
+	RoleARN        string   `yaml:"rolearn"`
+	Username       string   `yaml:"username"`
+	Groups         []string `yaml:"groups,omitempty"`
+	IdentityExtras *bool    `yaml:"identityextras,omitempty"`
+}
+
+// Reconcile adds the mappings of the sources that aren't in aws-auth yet,
+// creating it if needed. A source that fails is skipped, and aws-auth isn't
+// written if its mapRoles can't be parsed.
+func (w *BootstrapWriter) Reconcile() error {
+	cm, err := w.configMaps.Get(w.name, metav1.GetOptions{})
+	create := k8serrors.IsNotFound(err)
+	if create {
+		cm = &core_v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: w.name, Namespace: w.namespace}}
+	} else if err != nil {
+		return fmt.Errorf("could not get the %s ConfigMap: %v", w.name, err)
+	}
+
+	_, roles, _, err := ParseMap(map[string]string{"mapRoles": cm.Data["mapRoles"]})
+	if err != nil {
+		return fmt.Errorf("not modifying aws-auth with unparseable mapRoles: %v", err)
+	}
+	mapped := map[string]bool{}
+	for _, r := range roles {
+		mapped[strings.ToLower(r.RoleARN)] = true
+	}
+
+	var added []string
+	for _, source := range w.sources {
+		mappings, err := source.RoleMappings()
+		if err != nil {
+			logger.WithError(err).WithField("source", source.Name()).Warn("could not get bootstrap mappings")
+			continue
+		}
+		for _, m := range mappings {
+			if mapped[strings.ToLower(m.RoleARN)] {
+				continue
+			}
+			mapped[strings.ToLower(m.RoleARN)] = true
+			roles = append(roles, m)
+			added = append(added, m.RoleARN)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	out := make([]bootstrapRoleMapping, 0, len(roles))
+	for _, r := range roles {
+		out = append(out, bootstrapRoleMapping{RoleARN: r.RoleARN, Username: r.Username, Groups: r.Groups, IdentityExtras: r.IdentityExtras})
+	}
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data["mapRoles"] = string(data)
+	// an update conflicts if aws-auth changed since it was read, and is
+	// retried with the new contents on the next reconcile
+	if create {
+		_, err = w.configMaps.Create(cm)
+	} else {
+		_, err = w.configMaps.Update(cm)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write the %s ConfigMap: %v", w.name, err)
+	}
+	logger.WithField("roles", added).Info("added bootstrap mappings to aws-auth")
+	return nil
+}
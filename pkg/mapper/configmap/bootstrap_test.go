@@ -0,0 +1,77 @@
+package configmap
+
+import (
+	"errors"
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+type failingBootstrapSource struct{}
+
+func (failingBootstrapSource) Name() string { return "failing" }
+
+func (failingBootstrapSource) RoleMappings() ([]config.RoleMapping, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestBootstrapWriterReconcile(t *testing.T) {
+	nodeRole := config.RoleMapping{
+		RoleARN:  "arn:aws:iam::123456789012:role/NodeGroupA",
+		Username: "system:node:{{EC2PrivateDNSName}}",
+		Groups:   []string{"system:bootstrappers", "system:nodes"},
+	}
+	w := &BootstrapWriter{
+		configMaps: k8sfake.NewSimpleClientset().CoreV1().ConfigMaps("kube-system"),
+		namespace:  DefaultNamespace,
+		name:       DefaultName,
+		sources:    []BootstrapSource{failingBootstrapSource{}, StaticBootstrapSource{nodeRole}},
+	}
+
+	// aws-auth is created when missing
+	if err := w.Reconcile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, err := w.configMaps.Get("aws-auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected aws-auth to be created: %v", err)
+	}
+	_, roles, _, err := ParseMap(cm.Data)
+	if err != nil || len(roles) != 1 || roles[0].RoleARN != nodeRole.RoleARN || len(roles[0].Groups) != 2 {
+		t.Fatalf("unexpected roles %+v (err %v)", roles, err)
+	}
+
+	// existing mappings are kept, and a mapped role isn't changed
+	cm.Data["mapRoles"] = `- rolearn: arn:aws:iam::123456789012:role/nodegroupa
+  username: admin-edited
+- rolearn: arn:aws:iam::123456789012:role/Admin
+  username: admin
+  groups: [system:masters]
+`
+	cm.Data["mapUsers"] = userMapping
+	w.configMaps.Update(cm)
+	w.sources = append(w.sources, StaticBootstrapSource{{RoleARN: "arn:aws:iam::123456789012:role/NodeGroupB", Username: "system:node:{{EC2PrivateDNSName}}"}})
+	if err := w.Reconcile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, _ = w.configMaps.Get("aws-auth", metav1.GetOptions{})
+	_, roles, _, _ = ParseMap(cm.Data)
+	if len(roles) != 3 || roles[0].Username != "admin-edited" || roles[1].Groups[0] != "system:masters" || roles[2].RoleARN != "arn:aws:iam::123456789012:role/NodeGroupB" {
+		t.Errorf("unexpected roles %+v", roles)
+	}
+	if cm.Data["mapUsers"] != userMapping {
+		t.Errorf("expected mapUsers to be unchanged")
+	}
+
+	// unparseable mappings aren't overwritten
+	w.configMaps = k8sfake.NewSimpleClientset(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "aws-auth"},
+		Data:       map[string]string{"mapRoles": "- rolearn: [oops"},
+	}).CoreV1().ConfigMaps("kube-system")
+	if err := w.Reconcile(); err == nil {
+		t.Errorf("expected an error for unparseable mapRoles")
+	}
+}
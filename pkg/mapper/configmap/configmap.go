@@ -1,9 +1,14 @@
 package configmap
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"sync"
 	"time"
@@ -11,16 +16,70 @@ import (
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/kubeclient"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
 )
 
+var logger = logging.For(logging.ComponentMapper)
+
+const (
+	// configMapSizeLimit is the maximum size of a ConfigMap accepted by the
+	// API server.
+	configMapSizeLimit = 1024 * 1024
+	// configMapSizeWarnRatio is the fraction of configMapSizeLimit above
+	// which a warning is logged on every update.
+	configMapSizeWarnRatio = 0.8
+	// maxDecompressedSize bounds how much a compressed mapping payload may
+	// expand to.
+	maxDecompressedSize = 16 * 1024 * 1024
+
+	// watchIdleTimeout is how long the watch may go without delivering an
+	// event before it is assumed to be wedged and is re-established. The
+	// fresh watch replays the current ConfigMap, so a restart is harmless.
+	watchIdleTimeout = 10 * time.Minute
+	// watchMinBackoff and watchMaxBackoff bound the delay before
+	// re-establishing a watch; the delay doubles while watches keep ending
+	// within watchHealthyDuration of being started.
+	watchMinBackoff      = time.Second
+	watchMaxBackoff      = 2 * time.Minute
+	watchHealthyDuration = time.Minute
+)
+
+const (
+	// DefaultNamespace and DefaultName locate the ConfigMap mappings are read
+	// from unless configured otherwise.
+	DefaultNamespace = "kube-system"
+	DefaultName      = "aws-auth"
+)
+
+// Location returns the namespace and name of the ConfigMap mappings are read
+// from with cfg.
+func Location(cfg config.Config) (namespace, name string) {
+	namespace, name = cfg.BackendConfigMapNamespace, cfg.BackendConfigMapName
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if name == "" {
+		name = DefaultName
+	}
+	return namespace, name
+}
+
+// gzipMagic is the header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
 type MapStore struct {
 	mutex sync.RWMutex
 	users map[string]config.UserMapping
@@ -28,76 +87,336 @@ type MapStore struct {
 	// Used as set.
 	awsAccounts map[string]interface{}
 	configMap   v1.ConfigMapInterface
+	// name is the name of the ConfigMap, DefaultName if empty.
+	name string
+	// selector, if set, selects more ConfigMaps in the namespace whose
+	// mappings are merged with those of the main one.
+	selector labels.Selector
+	// sources are the mappings of each ConfigMap loaded, by name.
+	sources      map[string]configMapMappings
+	sourcesMutex sync.Mutex
+	// watchIdleTimeout overrides the package default when non-zero.
+	watchIdleTimeout time.Duration
+	// retryMinBackoff and retryMaxBackoff override watchMinBackoff and
+	// watchMaxBackoff when non-zero.
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+	// outageThreshold, if positive, is how long the API server may be
+	// unreachable before the MapStore is degraded. unreachableSince and
+	// degraded are guarded by outageMutex.
+	outageThreshold  time.Duration
+	unreachableSince time.Time
+	degraded         bool
+	outageMutex      sync.Mutex
+	// partition, if set, is the partition mapped ARNs are expected to be in.
+	partition string
+	// strict disables lowercasing ARNs, so they only match with the same
+	// case.
+	strict bool
+	// unsafeGroupsAction, unless empty or allow, logs mappings granting
+	// groups starting with one of reservedGroupPrefixes when loaded.
+	unsafeGroupsAction    string
+	reservedGroupPrefixes []string
+	// deletionGracePeriod is how long the mappings of the main ConfigMap are
+	// kept after it is deleted. deletionTimer drops them when it ends and is
+	// guarded by sourcesMutex.
+	deletionGracePeriod time.Duration
+	deletionTimer       *time.Timer
+	// assertions must be satisfied by new mappings for them to be saved.
+	assertions []config.MappingAssertion
+	// failOnPartialParse keeps the previous mappings of a ConfigMap that
+	// fails to parse instead of saving what could be parsed.
+	failOnPartialParse bool
+	// failOnUsernameCollisions keeps the previous mappings when new ones map
+	// several ARNs to the same static username.
+	failOnUsernameCollisions bool
+	// loads, if set, records the last parse of the main ConfigMap.
+	loads *mapper.LoadTracker
+	// changes, if set, logs the changes saved mappings make.
+	changes *mapper.ChangeRecorder
+	// recorder, if set, emits Events on the ConfigMaps when their mappings
+	// are loaded or fail to load.
+	recorder record.EventRecorder
 }
 
-func New(masterURL, kubeConfig string) (*MapStore, error) {
-	clientconfig, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
-	if err != nil {
-		return nil, err
-	}
-	clientset, err := kubernetes.NewForConfig(clientconfig)
+// New creates a MapStore for the ConfigMap name in namespace of the API
+// server of cfg.
+func New(cfg config.Config, namespace, name string) (*MapStore, error) {
+	clientset, err := kubeclient.NewClientset(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	ms := MapStore{}
-	ms.configMap = clientset.CoreV1().ConfigMaps("kube-system")
+	ms := MapStore{
+		name:    name,
+		loads:   mapper.NewLoadTracker(mapper.ModeEKSConfigMap),
+		changes: mapper.NewChangeRecorder(mapper.ModeEKSConfigMap),
+	}
+	ms.configMap = clientset.CoreV1().ConfigMaps(namespace)
+	if cfg.KubernetesEvents {
+		ms.recorder = newEventRecorder(clientset)
+	}
 	return &ms, nil
 }
 
+// configMapName returns the name of the ConfigMap mappings are read from.
+func (ms *MapStore) configMapName() string {
+	if ms.name == "" {
+		return DefaultName
+	}
+	return ms.name
+}
+
 // Starts a go routine which will watch the configmap and update the in memory data
 // when the values change.
+//
+// The watch is supervised: it is re-established with exponential backoff when
+// the result channel closes or delivers an error, and restarted when it has
+// not delivered an event for watchIdleTimeout, since a watch can silently
+// wedge after some API server failures without its channel ever closing.
 func (ms *MapStore) startLoadConfigMap(stopCh <-chan struct{}) {
 	go func() {
+		minBackoff, maxBackoff := ms.watchBackoffs()
+		backoff := minBackoff
 		for {
+			started := time.Now()
+			reason := ms.watchConfigMap(stopCh)
+			if reason == "" {
+				return
+			}
+			metrics.WatchRestarts.WithLabelValues(reason).Inc()
+			if time.Since(started) >= watchHealthyDuration {
+				backoff = minBackoff
+			}
+			if ms.isDegraded() {
+				backoff = maxBackoff
+			}
+			logger.WithFields(logrus.Fields{
+				"reason":  reason,
+				"backoff": backoff,
+			}).Warn("Re-establishing aws-auth watch")
 			select {
 			case <-stopCh:
 				return
-			default:
-				watcher, err := ms.configMap.Watch(metav1.ListOptions{
-					Watch:         true,
-					FieldSelector: fields.OneTermEqualSelector("metadata.name", "aws-auth").String(),
-				})
-				if err != nil {
-					logrus.Warn("Unable to re-establish watch.  Sleeping for 5 seconds")
-					time.Sleep(5 * time.Second)
-					continue
-				}
-				for r := range watcher.ResultChan() {
-					switch r.Type {
-					case watch.Error:
-						logrus.WithFields(logrus.Fields{"error": r}).Error("recieved a watch error")
-					case watch.Deleted:
-						logrus.Info("Resetting configmap on delete")
-						userMappings := make([]config.UserMapping, 0)
-						roleMappings := make([]config.RoleMapping, 0)
-						awsAccounts := make([]string, 0)
-						ms.saveMap(userMappings, roleMappings, awsAccounts)
-					case watch.Added, watch.Modified:
-						switch cm := r.Object.(type) {
-						case *core_v1.ConfigMap:
-							if cm.Name != "aws-auth" {
-								break
-							}
-							logrus.Info("Received aws-auth watch event")
-							userMappings, roleMappings, awsAccounts, err := ms.parseMap(cm.Data)
-							if err != nil {
-								logrus.Errorf("There was an error parsing the config maps.  Only saving data that was good, %+v", err)
-							}
-							ms.saveMap(userMappings, roleMappings, awsAccounts)
-							if err != nil {
-								logrus.Error(err)
-							}
-						}
-
-					}
-				}
-				logrus.Error("Watch channel closed.")
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
 			}
 		}
 	}()
 }
 
+// watchConfigMap consumes a single watch of the aws-auth ConfigMap until it
+// ends and returns the reason it ended, or "" if stopCh was closed. The
+// watch is always stopped before returning so its goroutines don't leak.
+//
+// With a selector, all the ConfigMaps of the namespace are listed and then
+// watched, so ConfigMaps deleted while no watch was established are dropped.
+func (ms *MapStore) watchConfigMap(stopCh <-chan struct{}) string {
+	opts := metav1.ListOptions{
+		Watch:         true,
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", ms.configMapName()).String(),
+	}
+	if ms.selector != nil {
+		list, err := ms.configMap.List(metav1.ListOptions{})
+		if err != nil {
+			logger.WithError(err).Warn("Unable to list ConfigMaps")
+			ms.apiUnreachable(err, time.Now())
+			return metrics.WatchRestartFailed
+		}
+		ms.loadConfigMaps(list.Items)
+		opts = metav1.ListOptions{Watch: true, ResourceVersion: list.ResourceVersion}
+	}
+	watcher, err := ms.configMap.Watch(opts)
+	if err != nil {
+		logger.WithError(err).Warn("Unable to establish aws-auth watch")
+		ms.apiUnreachable(err, time.Now())
+		return metrics.WatchRestartFailed
+	}
+	defer watcher.Stop()
+	ms.apiReachable()
+
+	idleTimeout := ms.watchIdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = watchIdleTimeout
+	}
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return ""
+		case <-idle.C:
+			logger.WithField("timeout", idleTimeout).Warn("No aws-auth watch events received, restarting watch")
+			return metrics.WatchRestartIdle
+		case r, ok := <-watcher.ResultChan():
+			if !ok {
+				logger.Error("Watch channel closed.")
+				return metrics.WatchRestartClosed
+			}
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(idleTimeout)
+			if r.Type == watch.Error {
+				logger.WithFields(logrus.Fields{"error": r}).Error("recieved a watch error")
+				return metrics.WatchRestartError
+			}
+			ms.handleWatchEvent(r)
+		}
+	}
+}
+
+func (ms *MapStore) handleWatchEvent(r watch.Event) {
+	switch r.Type {
+	case watch.Deleted:
+		cm, ok := r.Object.(*core_v1.ConfigMap)
+		if !ok {
+			logger.Info("Resetting configmap on delete")
+			ms.replaceSources(nil)
+			break
+		}
+		if cm.Name == ms.configMapName() {
+			ms.removeMain()
+		} else if ms.hasSource(cm.Name) {
+			logger.WithField("configmap", cm.Name).Info("Removing mappings of deleted ConfigMap")
+			ms.removeSource(cm.Name)
+		}
+	case watch.Added, watch.Modified:
+		switch cm := r.Object.(type) {
+		case *core_v1.ConfigMap:
+			if ms.selects(cm) {
+				logger.WithField("configmap", cm.Name).Info("Received aws-auth watch event")
+				ms.loadConfigMap(cm)
+			} else if ms.hasSource(cm.Name) {
+				// the ConfigMap was relabeled out of the selector
+				logger.WithField("configmap", cm.Name).Info("Removing mappings of ConfigMap no longer selected")
+				ms.removeSource(cm.Name)
+			}
+		}
+	}
+}
+
+// selects returns whether the mappings of cm are used: it is the main
+// ConfigMap or matches the selector.
+func (ms *MapStore) selects(cm *core_v1.ConfigMap) bool {
+	if cm.Name == ms.configMapName() {
+		return true
+	}
+	return ms.selector != nil && ms.selector.Matches(labels.Set(cm.Labels))
+}
+
+// loadConfigMaps replaces the mappings with those of the selected ConfigMaps
+// in items.
+func (ms *MapStore) loadConfigMaps(items []core_v1.ConfigMap) {
+	sources := map[string]configMapMappings{}
+	for i := range items {
+		if ms.selects(&items[i]) {
+			sources[items[i].Name] = ms.parseConfigMap(&items[i])
+		}
+	}
+	ms.replaceSources(sources)
+}
+
+func (ms *MapStore) loadConfigMap(cm *core_v1.ConfigMap) {
+	ms.setSource(cm.Name, ms.parseConfigMap(cm))
+}
+
+// parseConfigMap returns the mappings of cm. On error only the mappings that
+// could be parsed are returned, unless failOnPartialParse is set, in which
+// case the mappings previously loaded from cm are.
+func (ms *MapStore) parseConfigMap(cm *core_v1.ConfigMap) configMapMappings {
+	main := cm.Name == ms.configMapName()
+	if main {
+		checkConfigMapSize(cm)
+	}
+	userMappings, roleMappings, awsAccounts, err := ms.parseMap(cm.Data)
+	ref := configMapRef(cm)
+	// Events are only emitted once per version, not when a watch restart
+	// replays the ConfigMap
+	previous := ms.source(cm.Name).ref
+	newVersion := previous == nil || previous.ResourceVersion != cm.ResourceVersion
+	if err != nil {
+		logger.WithField("configmap", cm.Name).Errorf("There was an error parsing the config maps.  Only saving data that was good, %+v", err)
+		if newVersion {
+			ms.event(ref, core_v1.EventTypeWarning, EventParseFailed, "Could not parse the mappings: %v", err)
+		}
+	} else if newVersion {
+		ms.event(ref, core_v1.EventTypeNormal, EventMappingsLoaded, "Loaded %d role mappings, %d user mappings and %d accounts", len(roleMappings), len(userMappings), len(awsAccounts))
+	}
+	if main && ms.loads != nil {
+		if err != nil {
+			ms.loads.Failed(err, time.Now())
+		} else {
+			ms.loads.Succeeded(cm.ResourceVersion, time.Now())
+		}
+	}
+	if err != nil && ms.failOnPartialParse {
+		logger.WithField("configmap", cm.Name).Warn("Keeping the previous mappings of the config map")
+		previous := ms.source(cm.Name)
+		previous.ref = ref
+		return previous
+	}
+	ms.warnPartitionMismatches(userMappings, roleMappings)
+	return configMapMappings{users: userMappings, roles: roleMappings, accounts: awsAccounts, ref: ref}
+}
+
+// warnPartitionMismatches logs mappings for ARNs outside the expected
+// partition. Identities are only ever verified in that partition, so such
+// mappings can never match, which usually means they were copied from a
+// cluster in another partition.
+func (ms *MapStore) warnPartitionMismatches(userMappings []config.UserMapping, roleMappings []config.RoleMapping) {
+	if ms.partition == "" {
+		return
+	}
+	for _, u := range userMappings {
+		if _, err := arn.CanonicalizeInPartition(u.UserARN, ms.partition); err != nil {
+			logger.Warnf("aws-auth mapping for user %s will not match: %v", u.UserARN, err)
+		}
+	}
+	for _, r := range roleMappings {
+		if _, err := arn.CanonicalizeInPartition(r.RoleARN, ms.partition); err != nil {
+			logger.Warnf("aws-auth mapping for role %s will not match: %v", r.RoleARN, err)
+		}
+	}
+}
+
+// LoadStatus returns when the main ConfigMap was last parsed without errors,
+// and its resourceVersion then.
+func (ms *MapStore) LoadStatus() mapper.LoadStatus {
+	if ms.loads == nil {
+		return mapper.LoadStatus{}
+	}
+	return ms.loads.LoadStatus()
+}
+
+// Load reads the aws-auth ConfigMap, and those matching the selector, once.
+// A missing ConfigMap leaves no mappings, as it does for the watch.
+func (ms *MapStore) Load() error {
+	var items []core_v1.ConfigMap
+	cm, err := ms.configMap.Get(ms.configMapName(), metav1.GetOptions{})
+	if err == nil {
+		items = append(items, *cm)
+	} else if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("could not get the %s ConfigMap: %v", ms.configMapName(), err)
+	}
+	if ms.selector != nil {
+		list, err := ms.configMap.List(metav1.ListOptions{LabelSelector: ms.selector.String()})
+		if err != nil {
+			return fmt.Errorf("could not list the selected ConfigMaps: %v", err)
+		}
+		items = append(items, list.Items...)
+	}
+	ms.loadConfigMaps(items)
+	return nil
+}
+
 type ErrParsingMap struct {
 	errors []error
 }
@@ -106,14 +425,84 @@ func (err ErrParsingMap) Error() string {
 	return fmt.Sprintf("error parsing config map: %v", err.errors)
 }
 
+// configMapSize returns the number of bytes cm's data accounts for towards
+// the ConfigMap size limit.
+func configMapSize(cm *core_v1.ConfigMap) int {
+	size := 0
+	for k, v := range cm.Data {
+		size += len(k) + len(v)
+	}
+	for k, v := range cm.BinaryData {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// checkConfigMapSize records the size of cm and warns when it approaches the
+// ConfigMap size limit, suggesting compressed mapping payloads.
+func checkConfigMapSize(cm *core_v1.ConfigMap) {
+	size := configMapSize(cm)
+	metrics.ConfigMapSize.Set(float64(size))
+	if float64(size) >= configMapSizeWarnRatio*configMapSizeLimit {
+		logger.WithFields(logrus.Fields{
+			"bytes": size,
+			"limit": configMapSizeLimit,
+		}).Warnf("aws-auth ConfigMap is %.0f%% of the maximum ConfigMap size, consider storing mappings as gzip+base64", 100*float64(size)/configMapSizeLimit)
+	}
+}
+
+// decodeMappingData returns data unchanged unless it is a base64 encoded gzip
+// stream, in which case it returns the decompressed contents.
+func decodeMappingData(data string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil || !bytes.HasPrefix(compressed, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("could not decompress mapping data: %v", err)
+	}
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return "", fmt.Errorf("could not decompress mapping data: %v", err)
+	}
+	if len(decompressed) > maxDecompressedSize {
+		return "", fmt.Errorf("decompressed mapping data exceeds %d bytes", maxDecompressedSize)
+	}
+	return string(decompressed), nil
+}
+
 // Acquire lock before calling
 func (ms *MapStore) parseMap(m map[string]string) ([]config.UserMapping, []config.RoleMapping, []string, error) {
+	return ParseMap(m)
+}
+
+// ParseMap parses the mapUsers, mapRoles and mapAccounts keys of aws-auth
+// ConfigMap data. On error the mappings that could be parsed are still
+// returned.
+func ParseMap(m map[string]string) ([]config.UserMapping, []config.RoleMapping, []string, error) {
+	userMappings, roleMappings, awsAccounts, errs := parseMapData(m)
+	var err error
+	if len(errs) > 0 {
+		logger.Warnf("Errors parsing configmap: %+v", errs)
+		metrics.ConfigMapParseErrors.Inc()
+		err = ErrParsingMap{errors: errs}
+	}
+	return userMappings, roleMappings, awsAccounts, err
+}
+
+// parseMapData parses the mappings in the data of the aws-auth ConfigMap,
+// returning what could be parsed and the errors for the rest.
+func parseMapData(m map[string]string) ([]config.UserMapping, []config.RoleMapping, []string, []error) {
 	errs := make([]error, 0)
 	userMappings := make([]config.UserMapping, 0)
 	if userData, ok := m["mapUsers"]; ok {
-		userJson, err := utilyaml.ToJSON([]byte(userData))
+		userData, err := decodeMappingData(userData)
 		if err != nil {
 			errs = append(errs, err)
+		} else if userJson, err := utilyaml.ToJSON([]byte(userData)); err != nil {
+			errs = append(errs, err)
 		} else {
 			err = json.Unmarshal(userJson, &userMappings)
 			if err != nil {
@@ -124,9 +513,11 @@ func (ms *MapStore) parseMap(m map[string]string) ([]config.UserMapping, []confi
 
 	roleMappings := make([]config.RoleMapping, 0)
 	if roleData, ok := m["mapRoles"]; ok {
-		roleJson, err := utilyaml.ToJSON([]byte(roleData))
+		roleData, err := decodeMappingData(roleData)
 		if err != nil {
 			errs = append(errs, err)
+		} else if roleJson, err := utilyaml.ToJSON([]byte(roleData)); err != nil {
+			errs = append(errs, err)
 		} else {
 			err = json.Unmarshal(roleJson, &roleMappings)
 			if err != nil {
@@ -137,18 +528,15 @@ func (ms *MapStore) parseMap(m map[string]string) ([]config.UserMapping, []confi
 
 	awsAccounts := make([]string, 0)
 	if accountsData, ok := m["mapAccounts"]; ok {
-		err := yaml.Unmarshal([]byte(accountsData), &awsAccounts)
+		accountsData, err := decodeMappingData(accountsData)
 		if err != nil {
 			errs = append(errs, err)
+		} else if err := yaml.Unmarshal([]byte(accountsData), &awsAccounts); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	var err error
-	if len(errs) > 0 {
-		logrus.Warnf("Errors parsing configmap: %+v", errs)
-		err = ErrParsingMap{errors: errs}
-	}
-	return userMappings, roleMappings, awsAccounts, err
+	return userMappings, roleMappings, awsAccounts, errs
 }
 
 func (ms *MapStore) saveMap(userMappings []config.UserMapping, roleMappings []config.RoleMapping, awsAccounts []string) {
@@ -159,10 +547,10 @@ func (ms *MapStore) saveMap(userMappings []config.UserMapping, roleMappings []co
 	ms.awsAccounts = make(map[string]interface{})
 
 	for _, user := range userMappings {
-		ms.users[strings.ToLower(user.UserARN)] = user
+		ms.users[mapper.ARNKey(user.UserARN, ms.strict)] = user
 	}
 	for _, role := range roleMappings {
-		ms.roles[strings.ToLower(role.RoleARN)] = role
+		ms.roles[mapper.ARNKey(role.RoleARN, ms.strict)] = role
 	}
 	for _, awsAccount := range awsAccounts {
 		ms.awsAccounts[awsAccount] = nil
@@ -195,6 +583,38 @@ func (ms *MapStore) RoleMapping(arn string) (config.RoleMapping, error) {
 	}
 }
 
+// List returns the role and user mappings and the accounts of the last
+// ConfigMap loaded.
+func (ms *MapStore) List() ([]config.IdentityMapping, []string) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	var mappings []config.IdentityMapping
+	for arn, role := range ms.roles {
+		mappings = append(mappings, config.IdentityMapping{
+			IdentityARN:    arn,
+			Username:       role.Username,
+			Groups:         role.Groups,
+			IdentityExtras: role.IdentityExtras,
+			NotAfter:       role.NotAfter,
+		})
+	}
+	for arn, user := range ms.users {
+		mappings = append(mappings, config.IdentityMapping{
+			IdentityARN:     arn,
+			Username:        user.Username,
+			Groups:          user.Groups,
+			IdentityExtras:  user.IdentityExtras,
+			NotAfter:        user.NotAfter,
+			LookupIAMGroups: user.LookupIAMGroups,
+		})
+	}
+	var accounts []string
+	for account := range ms.awsAccounts {
+		accounts = append(accounts, account)
+	}
+	return mappings, accounts
+}
+
 func (ms *MapStore) AWSAccount(id string) bool {
 	ms.mutex.RLock()
 	defer ms.mutex.RUnlock()
@@ -1,18 +1,26 @@
 package configmap
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"reflect"
 	"testing"
 
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	core_v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/kubernetes/typed/core/v1/fake"
 	k8stesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
 )
 
 var testUser = config.UserMapping{Username: "matlan", Groups: []string{"system:master", "dev"}}
@@ -234,3 +242,227 @@ func TestLoadConfigMap(t *testing.T) {
 	}
 
 }
+
+func gzipBase64(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestParseMapCompressed(t *testing.T) {
+	ms := makeStore()
+	users, roles, accounts, err := ms.parseMap(map[string]string{
+		"mapUsers":    gzipBase64(t, userMapping),
+		"mapRoles":    roleMapping,
+		"mapAccounts": gzipBase64(t, autoMappedAWSAccountsYAML),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing compressed mappings: %v", err)
+	}
+	if len(users) != 2 || users[1].Username != "nic" {
+		t.Errorf("unexpected user mappings: %+v", users)
+	}
+	if len(roles) != 1 {
+		t.Errorf("unexpected role mappings: %+v", roles)
+	}
+	if !reflect.DeepEqual(accounts, []string{"123", "345"}) {
+		t.Errorf("unexpected accounts: %v", accounts)
+	}
+}
+
+func TestParseMapIdentityExtras(t *testing.T) {
+	_, roles, _, err := ParseMap(map[string]string{
+		"mapRoles": `
+- rolearn: arn:aws:iam::123456789012:role/ci
+  username: ci
+  identityextras: false
+- rolearn: arn:aws:iam::123456789012:role/admin
+  username: admin
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing mappings: %v", err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("unexpected role mappings: %+v", roles)
+	}
+	if roles[0].IdentityExtras == nil || *roles[0].IdentityExtras {
+		t.Errorf("expected identityextras to be false for %s", roles[0].RoleARN)
+	}
+	if roles[1].IdentityExtras != nil {
+		t.Errorf("expected identityextras to be unset for %s", roles[1].RoleARN)
+	}
+}
+
+func TestDecodeMappingDataCorrupt(t *testing.T) {
+	corrupt := base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0x00})
+	if _, err := decodeMappingData(corrupt); err == nil {
+		t.Errorf("expected an error decompressing corrupt gzip data")
+	}
+}
+
+func TestLoadConfigMapWatchdog(t *testing.T) {
+	ms, fakeConfigMaps := makeStoreWClient()
+	ms.watchIdleTimeout = 100 * time.Millisecond
+
+	watchers := make(chan *watch.FakeWatcher, 10)
+	fakeConfigMaps.Fake.Fake.AddWatchReactor("configmaps",
+		func(action k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			watchers <- watcher
+			return true, watcher, nil
+		})
+	restarts := metrics.WatchRestarts.WithLabelValues(metrics.WatchRestartIdle)
+	before := counterValue(t, restarts)
+
+	stopCh := make(chan struct{})
+	ms.startLoadConfigMap(stopCh)
+	defer close(stopCh)
+
+	first := <-watchers
+	var second *watch.FakeWatcher
+	select {
+	case second = <-watchers:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("idle watch was not re-established")
+	}
+	meta := metav1.ObjectMeta{Name: "aws-auth"}
+	second.Add(&core_v1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"mapAccounts": autoMappedAWSAccountsYAML}})
+	time.Sleep(5 * time.Millisecond)
+
+	if !first.IsStopped() {
+		t.Errorf("expected the idle watch to be stopped")
+	}
+	if after := counterValue(t, restarts); after != before+1 {
+		t.Errorf("expected idle restart counter to be %v, got %v", before+1, after)
+	}
+	if !ms.AWSAccount("123") {
+		t.Errorf("AWS Account '123' not in allowed accounts after the watch was restarted")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ms := makeStore()
+	ms.configMap = k8sfake.NewSimpleClientset().CoreV1().ConfigMaps("kube-system")
+	if err := ms.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if ms.AWSAccount("123") {
+		t.Errorf("expected a missing ConfigMap to clear the mappings")
+	}
+
+	ms.configMap = k8sfake.NewSimpleClientset(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "aws-auth"},
+		Data: map[string]string{
+			"mapUsers":    userMapping,
+			"mapAccounts": autoMappedAWSAccountsYAML,
+		},
+	}).CoreV1().ConfigMaps("kube-system")
+	if err := ms.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !ms.AWSAccount("123") {
+		t.Errorf("AWS Account '123' not in allowed accounts after Load")
+	}
+	if _, err := ms.UserMapping("arn:iam:nic"); err != nil {
+		t.Errorf("Expected to find user 'nic' after Load but got error: %v", err)
+	}
+}
+
+func TestLoadConfigMapFailOnPartialParse(t *testing.T) {
+	for _, failOnPartialParse := range []bool{false, true} {
+		ms := makeStore()
+		ms.failOnPartialParse = failOnPartialParse
+		ms.loadConfigMap(&core_v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws-auth"},
+			Data:       map[string]string{"mapUsers": userMapping, "mapRoles": roleMapping},
+		})
+		ms.loadConfigMap(&core_v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws-auth"},
+			Data:       map[string]string{"mapUsers": updatedUserMapping, "mapRoles": "- rolearn: [invalid"},
+		})
+
+		_, roleErr := ms.RoleMapping("arn:iam:123:role/me")
+		_, userErr := ms.UserMapping("arn:iam:beswar")
+		if failOnPartialParse {
+			if roleErr != nil {
+				t.Errorf("expected the previous role mapping to be kept, got %v", roleErr)
+			}
+			if userErr == nil {
+				t.Errorf("expected the user mappings of the broken ConfigMap not to be loaded")
+			}
+		} else {
+			if roleErr == nil {
+				t.Errorf("expected the role mappings of the broken section to be dropped")
+			}
+			if userErr != nil {
+				t.Errorf("expected the user mappings that parsed to be loaded, got %v", userErr)
+			}
+		}
+	}
+}
+
+func TestLoadStatus(t *testing.T) {
+	ms := makeStore()
+	ms.loads = mapper.NewLoadTracker("test")
+	ms.loadConfigMap(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-auth", ResourceVersion: "42"},
+		Data:       map[string]string{"mapUsers": userMapping},
+	})
+	status := ms.LoadStatus()
+	if status.Generation != "42" || status.LastSuccessfulLoad.IsZero() || status.LastError != "" {
+		t.Fatalf("unexpected status after a successful load: %+v", status)
+	}
+	var m dto.Metric
+	if err := metrics.MappingsGeneration.WithLabelValues("test").Write(&m); err != nil {
+		t.Fatalf("could not read the generation metric: %v", err)
+	}
+	if v := m.GetGauge().GetValue(); v != 42 {
+		t.Errorf("expected the generation metric to be 42, was %v", v)
+	}
+
+	ms.loadConfigMap(&core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-auth", ResourceVersion: "43"},
+		Data:       map[string]string{"mapUsers": "- userarn: [invalid"},
+	})
+	failed := ms.LoadStatus()
+	if failed.Generation != "42" || !failed.LastSuccessfulLoad.Equal(status.LastSuccessfulLoad) {
+		t.Errorf("expected a failed load to keep the last successful one, got %+v", failed)
+	}
+	if failed.LastError == "" || failed.LastErrorTime.IsZero() {
+		t.Errorf("expected a failed load to be recorded, got %+v", failed)
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("could not read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestParseMapNotAfter(t *testing.T) {
+	users, _, _, err := ParseMap(map[string]string{
+		"mapUsers": `
+- userarn: arn:aws:iam::123456789012:user/contractor
+  username: contractor
+  notafter: "2021-12-31T23:59:59Z"
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing mappings: %v", err)
+	}
+	want := time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC)
+	if len(users) != 1 || users[0].NotAfter == nil || !users[0].NotAfter.Equal(want) {
+		t.Errorf("expected notafter %v, got %+v", want, users)
+	}
+}
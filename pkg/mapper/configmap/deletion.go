@@ -0,0 +1,68 @@
+package configmap
+
+import (
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// removeMain handles the deletion of the main ConfigMap, dropping its
+// mappings unless they are kept for deletionGracePeriod.
+func (ms *MapStore) removeMain() {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	if ms.mainDeletedLocked() {
+		return
+	}
+	if _, ok := ms.sources[ms.configMapName()]; ok {
+		logger.WithField("configmap", ms.configMapName()).Info("Removing mappings of deleted ConfigMap")
+		delete(ms.sources, ms.configMapName())
+		ms.mergeSources()
+	}
+}
+
+// mainDeletedLocked handles the main ConfigMap going missing and returns
+// whether its last mappings are kept, which they are for deletionGracePeriod
+// so an accidental deletion doesn't lock everyone out. Acquire sourcesMutex
+// before calling.
+func (ms *MapStore) mainDeletedLocked() bool {
+	if _, ok := ms.sources[ms.configMapName()]; !ok {
+		return false
+	}
+	metrics.ConfigMapDeleted.Set(1)
+	if ms.deletionGracePeriod <= 0 {
+		return false
+	}
+	if ms.deletionTimer == nil {
+		logger.WithField("gracePeriod", ms.deletionGracePeriod).Errorf("The %s ConfigMap was deleted, keeping its last mappings until it is recreated or the grace period ends", ms.configMapName())
+		var timer *time.Timer
+		timer = time.AfterFunc(ms.deletionGracePeriod, func() { ms.expireMain(timer) })
+		ms.deletionTimer = timer
+	}
+	return true
+}
+
+// mainRestoredLocked handles the main ConfigMap being loaded, keeping its
+// mappings from expiring. Acquire sourcesMutex before calling.
+func (ms *MapStore) mainRestoredLocked() {
+	if ms.deletionTimer != nil {
+		ms.deletionTimer.Stop()
+		ms.deletionTimer = nil
+		logger.Infof("The %s ConfigMap was recreated within the deletion grace period", ms.configMapName())
+	}
+	metrics.ConfigMapDeleted.Set(0)
+}
+
+// expireMain drops the mappings kept since the main ConfigMap was deleted
+// once timer fires, unless it was recreated meanwhile.
+func (ms *MapStore) expireMain(timer *time.Timer) {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	if ms.deletionTimer != timer {
+		return
+	}
+	ms.deletionTimer = nil
+	logger.Errorf("The %s ConfigMap deletion grace period ended, removing its mappings", ms.configMapName())
+	delete(ms.sources, ms.configMapName())
+	ms.mergeSources()
+}
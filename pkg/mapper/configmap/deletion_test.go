@@ -0,0 +1,48 @@
+package configmap
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const adminRole = "arn:aws:iam::111122223333:role/admin"
+
+func TestDeletionGracePeriod(t *testing.T) {
+	main := teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n")
+	ms := &MapStore{deletionGracePeriod: time.Hour}
+	ms.handleWatchEvent(watch.Event{Type: watch.Added, Object: main})
+
+	ms.handleWatchEvent(watch.Event{Type: watch.Deleted, Object: main})
+	if _, err := ms.RoleMapping(adminRole); err != nil {
+		t.Fatalf("expected the mappings to be kept during the grace period, got %v", err)
+	}
+	// a relist without the ConfigMap keeps them too
+	ms.loadConfigMaps(nil)
+	if _, err := ms.RoleMapping(adminRole); err != nil {
+		t.Fatalf("expected the mappings to be kept during the grace period after a relist, got %v", err)
+	}
+
+	// recreating it stops the grace period
+	ms.handleWatchEvent(watch.Event{Type: watch.Added, Object: main})
+	if ms.deletionTimer != nil {
+		t.Errorf("expected the grace period to end when the ConfigMap was recreated")
+	}
+
+	ms.handleWatchEvent(watch.Event{Type: watch.Deleted, Object: main})
+	ms.expireMain(ms.deletionTimer)
+	if _, err := ms.RoleMapping(adminRole); err == nil {
+		t.Errorf("expected the mappings to be dropped after the grace period")
+	}
+}
+
+func TestDeletionNoGracePeriod(t *testing.T) {
+	main := teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n")
+	ms := &MapStore{}
+	ms.handleWatchEvent(watch.Event{Type: watch.Added, Object: main})
+	ms.handleWatchEvent(watch.Event{Type: watch.Deleted, Object: main})
+	if _, err := ms.RoleMapping(adminRole); err == nil {
+		t.Errorf("expected the mappings to be dropped immediately")
+	}
+}
@@ -0,0 +1,63 @@
+package configmap
+
+import (
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent is the source of the Events emitted on ConfigMaps.
+const eventComponent = "aws-iam-authenticator"
+
+// Reasons of the Events emitted on ConfigMaps.
+const (
+	// EventMappingsLoaded is emitted when a new version of a ConfigMap is
+	// loaded.
+	EventMappingsLoaded = "MappingsLoaded"
+	// EventParseFailed is emitted when the mappings of a ConfigMap fail to
+	// parse.
+	EventParseFailed = "MappingsParseFailed"
+	// EventDuplicateMapping is emitted on a ConfigMap mapping an ARN that
+	// another ConfigMap already maps.
+	EventDuplicateMapping = "DuplicateMapping"
+	// EventAssertionsFailed is emitted on the main ConfigMap when the
+	// merged mappings fail the mapping assertions.
+	EventAssertionsFailed = "MappingAssertionsFailed"
+	// EventUsernameCollision is emitted on the main ConfigMap when the
+	// merged mappings map several ARNs to the same static username.
+	EventUsernameCollision = "UsernameCollision"
+	// EventTeamMappingIgnored is emitted on a selected ConfigMap whose
+	// mapAccounts or mappings granting reserved groups are ignored, as only
+	// the main ConfigMap may set them.
+	EventTeamMappingIgnored = "TeamMappingIgnored"
+)
+
+// newEventRecorder returns a recorder emitting Events with clientset.
+func newEventRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, core_v1.EventSource{Component: eventComponent})
+}
+
+// configMapRef returns a reference to cm for its Events.
+func configMapRef(cm *core_v1.ConfigMap) *core_v1.ObjectReference {
+	return &core_v1.ObjectReference{
+		Kind:            "ConfigMap",
+		APIVersion:      "v1",
+		Namespace:       cm.Namespace,
+		Name:            cm.Name,
+		UID:             cm.UID,
+		ResourceVersion: cm.ResourceVersion,
+	}
+}
+
+// event emits an Event on the ConfigMap ref, if Events are enabled and the
+// ConfigMap is known.
+func (ms *MapStore) event(ref *core_v1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if ms.recorder == nil || ref == nil {
+		return
+	}
+	ms.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,72 @@
+package configmap
+
+import (
+	"strings"
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// recordedEvents drains the events of recorder.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestConfigMapEvents(t *testing.T) {
+	ms := makeStore()
+	recorder := record.NewFakeRecorder(10)
+	ms.recorder = recorder
+	load := func(resourceVersion, mapRoles string) []string {
+		ms.loadConfigMap(&core_v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws-auth", Namespace: "kube-system", ResourceVersion: resourceVersion},
+			Data:       map[string]string{"mapRoles": mapRoles},
+		})
+		return recordedEvents(recorder)
+	}
+
+	if events := load("1", roleMapping); len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+EventMappingsLoaded) {
+		t.Errorf("expected a %s event, got %v", EventMappingsLoaded, events)
+	}
+	if events := load("1", roleMapping); len(events) != 0 {
+		t.Errorf("expected no event reloading the same version, got %v", events)
+	}
+	if events := load("2", "- rolearn: [invalid"); len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+EventParseFailed) {
+		t.Errorf("expected a %s event, got %v", EventParseFailed, events)
+	}
+}
+
+func TestConfigMapEventsDuplicateMapping(t *testing.T) {
+	ms := makeStore()
+	recorder := record.NewFakeRecorder(10)
+	ms.recorder = recorder
+	for _, name := range []string{"aws-auth", "team-a"} {
+		// team ConfigMaps may not map ARNs to system: groups
+		mapRoles := roleMapping
+		if name != "aws-auth" {
+			mapRoles = strings.Replace(roleMapping, "system:nodes", name, 1)
+		}
+		ms.loadConfigMap(&core_v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system", ResourceVersion: "1"},
+			Data:       map[string]string{"mapRoles": mapRoles},
+		})
+	}
+	var duplicates int
+	for _, e := range recordedEvents(recorder) {
+		if strings.HasPrefix(e, "Warning "+EventDuplicateMapping) {
+			duplicates++
+		}
+	}
+	if duplicates != 1 {
+		t.Errorf("expected a %s event on team-a, got %d", EventDuplicateMapping, duplicates)
+	}
+}
@@ -1,7 +1,9 @@
 package configmap
 
 import (
-	"strings"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
 
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
@@ -12,12 +14,33 @@ type ConfigMapMapper struct {
 }
 
 var _ mapper.Mapper = &ConfigMapMapper{}
+var _ mapper.Loader = &ConfigMapMapper{}
+var _ mapper.Lister = &ConfigMapMapper{}
+var _ mapper.StatusReporter = &ConfigMapMapper{}
 
 func NewConfigMapMapper(cfg config.Config) (*ConfigMapMapper, error) {
-	ms, err := New(cfg.Master, cfg.Kubeconfig)
+	namespace, name := Location(cfg)
+	ms, err := New(cfg, namespace, name)
 	if err != nil {
 		return nil, err
 	}
+	ms.partition = cfg.PartitionID
+	ms.strict = cfg.StrictARNMatching
+	ms.failOnPartialParse = cfg.FailOnPartialParse
+	ms.failOnUsernameCollisions = cfg.FailOnUsernameCollisions
+	ms.assertions = cfg.MappingAssertions
+	ms.deletionGracePeriod = cfg.ConfigMapDeletionGracePeriod
+	ms.retryMinBackoff = cfg.KubeAPIRetryMinBackoff
+	ms.retryMaxBackoff = cfg.KubeAPIRetryMaxBackoff
+	ms.outageThreshold = cfg.KubeAPIOutageThreshold
+	ms.unsafeGroupsAction = cfg.UnsafeGroupsAction
+	ms.reservedGroupPrefixes = cfg.ReservedGroupPrefixes
+	if cfg.BackendConfigMapSelector != "" {
+		ms.selector, err = labels.Parse(cfg.BackendConfigMapSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ConfigMap selector: %v", err)
+		}
+	}
 	return &ConfigMapMapper{ms}, nil
 }
 
@@ -30,31 +53,40 @@ func (m *ConfigMapMapper) Start(stopCh <-chan struct{}) error {
 	return nil
 }
 
+func (m *ConfigMapMapper) Load(_ <-chan struct{}) error {
+	return m.MapStore.Load()
+}
+
 func (m *ConfigMapMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
-	canonicalARN = strings.ToLower(canonicalARN)
+	canonicalARN = mapper.ARNKey(canonicalARN, m.strict)
 
 	rm, err := m.RoleMapping(canonicalARN)
 	// TODO: Check for non Role/UserNotFound errors
 	if err == nil {
 		return &config.IdentityMapping{
-			IdentityARN: canonicalARN,
-			Username:    rm.Username,
-			Groups:      rm.Groups,
+			IdentityARN:    canonicalARN,
+			Username:       rm.Username,
+			Groups:         rm.Groups,
+			IdentityExtras: rm.IdentityExtras,
+			NotAfter:       rm.NotAfter,
 		}, nil
 	}
 
 	um, err := m.UserMapping(canonicalARN)
 	if err == nil {
 		return &config.IdentityMapping{
-			IdentityARN: canonicalARN,
-			Username:    um.Username,
-			Groups:      um.Groups,
+			IdentityARN:     canonicalARN,
+			Username:        um.Username,
+			Groups:          um.Groups,
+			IdentityExtras:  um.IdentityExtras,
+			NotAfter:        um.NotAfter,
+			LookupIAMGroups: um.LookupIAMGroups,
 		}, nil
 	}
 
 	return nil, mapper.ErrNotMapped
 }
 
-func (m *ConfigMapMapper) IsAccountAllowed(accountID string) bool {
-	return m.AWSAccount(accountID)
+func (m *ConfigMapMapper) IsAccountAllowed(accountID string) (bool, error) {
+	return m.AWSAccount(accountID), nil
 }
@@ -0,0 +1,280 @@
+package configmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// configMapMappings are the mappings parsed from a single ConfigMap.
+type configMapMappings struct {
+	users    []config.UserMapping
+	roles    []config.RoleMapping
+	accounts []string
+	// ref is the ConfigMap the mappings were parsed from, for its Events.
+	ref *core_v1.ObjectReference
+}
+
+// setSource replaces the mappings of the ConfigMap name and merges the
+// mappings of all the ConfigMaps.
+func (ms *MapStore) setSource(name string, m configMapMappings) {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	if ms.sources == nil {
+		ms.sources = map[string]configMapMappings{}
+	}
+	if name == ms.configMapName() {
+		ms.mainRestoredLocked()
+	}
+	ms.sources[name] = m
+	ms.mergeSources()
+}
+
+// removeSource drops the mappings of the ConfigMap name, if it was loaded.
+func (ms *MapStore) removeSource(name string) {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	if _, ok := ms.sources[name]; !ok {
+		return
+	}
+	delete(ms.sources, name)
+	ms.mergeSources()
+}
+
+// source returns the loaded mappings of the ConfigMap name, which are empty
+// if it isn't loaded.
+func (ms *MapStore) source(name string) configMapMappings {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	return ms.sources[name]
+}
+
+// hasSource returns whether the mappings of the ConfigMap name are loaded.
+func (ms *MapStore) hasSource(name string) bool {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	_, ok := ms.sources[name]
+	return ok
+}
+
+// replaceSources replaces the mappings of all the ConfigMaps. The mappings of
+// the main ConfigMap are kept during the deletion grace period if it is
+// missing.
+func (ms *MapStore) replaceSources(sources map[string]configMapMappings) {
+	ms.sourcesMutex.Lock()
+	defer ms.sourcesMutex.Unlock()
+	main := ms.configMapName()
+	if _, ok := sources[main]; ok {
+		ms.mainRestoredLocked()
+	} else if ms.mainDeletedLocked() {
+		if sources == nil {
+			sources = map[string]configMapMappings{}
+		}
+		sources[main] = ms.sources[main]
+	}
+	ms.sources = sources
+	ms.mergeSources()
+}
+
+// teamReservedGroupPrefix starts the groups the selected ConfigMaps may not
+// map ARNs to, in addition to the reserved group prefixes, as they would
+// grant teams the cluster roles bound to them.
+const teamReservedGroupPrefix = "system:"
+
+// mergeSources saves the mappings of the main ConfigMap and then those of the
+// selected ConfigMaps in name order. An ARN mapped by several ConfigMaps keeps
+// the first mapping, so teams can't override the main ConfigMap or each
+// other; the conflict is logged. Only the main ConfigMap may map accounts or
+// map ARNs to reserved groups: the accounts of the selected ConfigMaps and
+// their mappings granting reserved groups are ignored and logged. Acquire
+// sourcesMutex before calling.
+func (ms *MapStore) mergeSources() {
+	main := ms.configMapName()
+	names := make([]string, 0, len(ms.sources))
+	for name := range ms.sources {
+		if name != main {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := ms.sources[main]; ok {
+		names = append([]string{main}, names...)
+	}
+
+	var users []config.UserMapping
+	var roles []config.RoleMapping
+	var accounts, arns []string
+	owners := map[string]string{}
+	claim := func(arn, name string) bool {
+		arn = mapper.ARNKey(arn, ms.strict)
+		if owner, ok := owners[arn]; ok {
+			if owner != name {
+				logger.WithFields(logrus.Fields{
+					"arn":     arn,
+					"used":    owner,
+					"ignored": name,
+				}).Warn("ARN is mapped by several ConfigMaps, using the first mapping")
+				ms.event(ms.sources[name].ref, core_v1.EventTypeWarning, EventDuplicateMapping, "%s is already mapped by ConfigMap %s, ignoring this mapping", arn, owner)
+			}
+			return false
+		}
+		owners[arn] = name
+		return true
+	}
+	for _, name := range names {
+		m := ms.sources[name]
+		team := name != main
+		for _, u := range m.users {
+			arns = append(arns, u.UserARN)
+			if team && !ms.allowTeamGroups(name, u.UserARN, u.Groups) {
+				continue
+			}
+			if claim(u.UserARN, name) {
+				users = append(users, u)
+			}
+		}
+		for _, r := range m.roles {
+			arns = append(arns, r.RoleARN)
+			if team && !ms.allowTeamGroups(name, r.RoleARN, r.Groups) {
+				continue
+			}
+			if claim(r.RoleARN, name) {
+				roles = append(roles, r)
+			}
+		}
+		if team && len(m.accounts) > 0 {
+			logger.WithFields(logrus.Fields{
+				"configmap": name,
+				"accounts":  m.accounts,
+			}).Warn("Only the main ConfigMap may map accounts, ignoring mapAccounts")
+			ms.event(m.ref, core_v1.EventTypeWarning, EventTeamMappingIgnored, "Only ConfigMap %s may map accounts, ignoring mapAccounts", main)
+			continue
+		}
+		accounts = append(accounts, m.accounts...)
+	}
+	mapper.WarnCaseCollisions(mapper.ModeEKSConfigMap, arns)
+	if !ms.checkAssertions(users, roles, ms.sources[main].ref) {
+		return
+	}
+	if !ms.checkUsernameCollisions(users, roles, ms.sources[main].ref) {
+		return
+	}
+	ms.warnUnsafeGroups(users, roles)
+	ms.saveMap(users, roles, accounts)
+	if ms.changes != nil {
+		ms.changes.Record(ms.List())
+	}
+}
+
+// allowTeamGroups reports whether the selected ConfigMap name may map arn to
+// groups, which it may not if any of them is reserved; the ignored mapping is
+// logged.
+func (ms *MapStore) allowTeamGroups(name, arn string, groups []string) bool {
+	var reserved []string
+	for _, group := range groups {
+		if strings.HasPrefix(group, teamReservedGroupPrefix) || len(mapper.ReservedGroups([]string{group}, ms.reservedGroupPrefixes)) > 0 {
+			reserved = append(reserved, group)
+		}
+	}
+	if len(reserved) == 0 {
+		return true
+	}
+	logger.WithFields(logrus.Fields{
+		"configmap": name,
+		"arn":       arn,
+		"reserved":  reserved,
+	}).Warn("Only the main ConfigMap may map ARNs to reserved groups, ignoring this mapping")
+	ms.event(ms.sources[name].ref, core_v1.EventTypeWarning, EventTeamMappingIgnored, "Only ConfigMap %s may map ARNs to the reserved groups %v, ignoring the mapping of %s", ms.configMapName(), reserved, arn)
+	return false
+}
+
+// checkAssertions reports whether the merged mappings satisfy the mapping
+// assertions, logging those they fail, and emitting an Event on the main
+// ConfigMap ref, so the previous mappings are kept.
+func (ms *MapStore) checkAssertions(users []config.UserMapping, roles []config.RoleMapping, ref *core_v1.ObjectReference) bool {
+	if len(ms.assertions) == 0 {
+		return true
+	}
+	errs := mapper.CheckAssertions(ms.assertions, identityMappings(users, roles), ms.strict)
+	if len(errs) == 0 {
+		return true
+	}
+	metrics.MappingAssertionFailures.Inc()
+	err := fmt.Errorf("mapping assertions failed: %v", errs)
+	logger.WithError(err).Error("Keeping the previous mappings")
+	ms.event(ref, core_v1.EventTypeWarning, EventAssertionsFailed, "Keeping the previous mappings: %v", err)
+	if ms.loads != nil {
+		ms.loads.Failed(err, time.Now())
+	}
+	return false
+}
+
+// checkUsernameCollisions logs the static usernames the merged mappings map
+// several ARNs to, emitting an Event on the main ConfigMap ref, and reports
+// whether the mappings may be saved, which they may not if there are any and
+// failOnUsernameCollisions is set.
+func (ms *MapStore) checkUsernameCollisions(users []config.UserMapping, roles []config.RoleMapping, ref *core_v1.ObjectReference) bool {
+	collisions := mapper.UsernameCollisions(identityMappings(users, roles))
+	if len(collisions) == 0 {
+		return true
+	}
+	for _, c := range collisions {
+		logger.WithFields(logrus.Fields{
+			"username": c.Username,
+			"arns":     c.ARNs,
+		}).Warn("aws-auth maps several ARNs to the same username, which share its RBAC bindings")
+	}
+	if !ms.failOnUsernameCollisions {
+		ms.event(ref, core_v1.EventTypeWarning, EventUsernameCollision, "Several ARNs are mapped to the same username: %v", collisions)
+		return true
+	}
+	err := fmt.Errorf("several ARNs are mapped to the same username: %v", collisions)
+	logger.WithError(err).Error("Keeping the previous mappings")
+	ms.event(ref, core_v1.EventTypeWarning, EventUsernameCollision, "Keeping the previous mappings: %v", err)
+	if ms.loads != nil {
+		ms.loads.Failed(err, time.Now())
+	}
+	return false
+}
+
+// identityMappings converts the user and role mappings of a ConfigMap.
+func identityMappings(users []config.UserMapping, roles []config.RoleMapping) []config.IdentityMapping {
+	mappings := make([]config.IdentityMapping, 0, len(users)+len(roles))
+	for _, u := range users {
+		mappings = append(mappings, config.IdentityMapping{IdentityARN: u.UserARN, Username: u.Username, Groups: u.Groups})
+	}
+	for _, r := range roles {
+		mappings = append(mappings, config.IdentityMapping{IdentityARN: r.RoleARN, Username: r.Username, Groups: r.Groups})
+	}
+	return mappings
+}
+
+// warnUnsafeGroups logs the mappings granting reserved groups, so an edit
+// granting them is noticed when it is loaded rather than when it is used.
+func (ms *MapStore) warnUnsafeGroups(users []config.UserMapping, roles []config.RoleMapping) {
+	if ms.unsafeGroupsAction == "" || ms.unsafeGroupsAction == mapper.UnsafeGroupsAllow {
+		return
+	}
+	warn := func(arn string, groups []string) {
+		if reserved := mapper.ReservedGroups(groups, ms.reservedGroupPrefixes); len(reserved) > 0 {
+			logger.WithFields(logrus.Fields{
+				"arn":      arn,
+				"reserved": reserved,
+				"action":   ms.unsafeGroupsAction,
+			}).Warn("aws-auth mapping grants reserved groups")
+		}
+	}
+	for _, u := range users {
+		warn(u.UserARN, u.Groups)
+	}
+	for _, r := range roles {
+		warn(r.RoleARN, r.Groups)
+	}
+}
@@ -0,0 +1,146 @@
+package configmap
+
+import (
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func teamConfigMap(name string, selected bool, mapRoles string) *core_v1.ConfigMap {
+	cm := &core_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: name},
+		Data:       map[string]string{"mapRoles": mapRoles},
+	}
+	if selected {
+		cm.Labels = map[string]string{"aws-iam-authenticator/mappings": "team"}
+	}
+	return cm
+}
+
+func TestMergeConfigMaps(t *testing.T) {
+	main := teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n")
+	main.Data["mapAccounts"] = "- \"111122223333\"\n"
+	teamA := teamConfigMap("aws-auth-team-a", true, "- rolearn: arn:aws:iam::111122223333:role/TeamA\n  username: team-a\n- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: hijacked\n")
+	teamA.Data["mapAccounts"] = "- \"444455556666\"\n"
+	teamB := teamConfigMap("aws-auth-team-b", true, "- rolearn: arn:aws:iam::111122223333:role/TeamA\n  username: team-b\n- rolearn: arn:aws:iam::111122223333:role/TeamB\n  username: team-b\n")
+	other := teamConfigMap("unrelated", false, "- rolearn: arn:aws:iam::111122223333:role/Other\n  username: other\n")
+
+	ms := &MapStore{
+		configMap: k8sfake.NewSimpleClientset(main, teamA, teamB, other).CoreV1().ConfigMaps("kube-system"),
+		selector:  labels.SelectorFromSet(labels.Set{"aws-iam-authenticator/mappings": "team"}),
+	}
+	if err := ms.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	expected := map[string]string{
+		"arn:aws:iam::111122223333:role/admin": "admin",
+		"arn:aws:iam::111122223333:role/teama": "team-a",
+		"arn:aws:iam::111122223333:role/teamb": "team-b",
+	}
+	for arn, username := range expected {
+		rm, err := ms.RoleMapping(arn)
+		if err != nil {
+			t.Errorf("expected %s to be mapped: %v", arn, err)
+		} else if rm.Username != username {
+			t.Errorf("expected %s to map to %s, got %s", arn, username, rm.Username)
+		}
+	}
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/other"); err != RoleNotFound {
+		t.Errorf("expected the mappings of an unselected ConfigMap to be ignored, got %v", err)
+	}
+	if !ms.AWSAccount("111122223333") {
+		t.Errorf("expected the accounts of the main ConfigMap")
+	}
+	if ms.AWSAccount("444455556666") {
+		t.Errorf("expected the accounts of a selected ConfigMap to be ignored")
+	}
+
+	// deleting a team ConfigMap only drops its mappings
+	ms.handleWatchEvent(watch.Event{Type: watch.Deleted, Object: teamA})
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/admin"); err != nil {
+		t.Errorf("expected the main mappings to be kept: %v", err)
+	}
+	if rm, err := ms.RoleMapping("arn:aws:iam::111122223333:role/teama"); err != nil || rm.Username != "team-b" {
+		t.Errorf("expected team-b's mapping of TeamA once team-a is deleted, got %+v, %v", rm, err)
+	}
+	// a ConfigMap relabeled out of the selector is dropped too
+	ms.handleWatchEvent(watch.Event{Type: watch.Modified, Object: teamConfigMap("aws-auth-team-b", false, teamB.Data["mapRoles"])})
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/teamb"); err != RoleNotFound {
+		t.Errorf("expected the mappings of an unselected ConfigMap to be dropped, got %v", err)
+	}
+}
+
+func TestMergeTeamReservedGroups(t *testing.T) {
+	main := teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n  groups:\n  - system:masters\n")
+	team := teamConfigMap("aws-auth-team-a", true, "- rolearn: arn:aws:iam::111122223333:role/Escalate\n  username: escalate\n  groups:\n  - team-a\n  - system:masters\n- rolearn: arn:aws:iam::111122223333:role/Platform\n  username: platform\n  groups:\n  - eks:platform\n- rolearn: arn:aws:iam::111122223333:role/TeamA\n  username: team-a\n  groups:\n  - team-a\n")
+
+	ms := &MapStore{
+		configMap:             k8sfake.NewSimpleClientset(main, team).CoreV1().ConfigMaps("kube-system"),
+		selector:              labels.SelectorFromSet(labels.Set{"aws-iam-authenticator/mappings": "team"}),
+		reservedGroupPrefixes: []string{"eks:"},
+	}
+	if err := ms.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/admin"); err != nil {
+		t.Errorf("expected the main ConfigMap to map reserved groups: %v", err)
+	}
+	for _, arn := range []string{"arn:aws:iam::111122223333:role/escalate", "arn:aws:iam::111122223333:role/platform"} {
+		if _, err := ms.RoleMapping(arn); err != RoleNotFound {
+			t.Errorf("expected the mapping of %s to reserved groups to be ignored, got %v", arn, err)
+		}
+	}
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/teama"); err != nil {
+		t.Errorf("expected the other team mappings to be kept: %v", err)
+	}
+}
+
+func TestMergeMappingAssertions(t *testing.T) {
+	ms := &MapStore{assertions: []config.MappingAssertion{{
+		ARN:    "arn:aws:iam::111122223333:role/Admin",
+		Groups: []string{"system:masters"},
+	}}}
+	ms.loadConfigMap(teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n  groups:\n  - system:masters\n"))
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/admin"); err != nil {
+		t.Fatalf("expected a revision satisfying the assertions to be activated, got %v", err)
+	}
+
+	ms.loadConfigMap(teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n- rolearn: arn:aws:iam::111122223333:role/Other\n  username: other\n"))
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/other"); err == nil {
+		t.Errorf("expected a revision failing the assertions not to be activated")
+	}
+	role, err := ms.RoleMapping("arn:aws:iam::111122223333:role/admin")
+	if err != nil || len(role.Groups) != 1 {
+		t.Errorf("expected the previous revision to stay active, got %+v, %v", role, err)
+	}
+}
+
+func TestMergeUsernameCollisions(t *testing.T) {
+	colliding := teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n- rolearn: arn:aws:iam::111122223333:role/Other\n  username: admin\n")
+
+	ms := &MapStore{}
+	ms.loadConfigMap(colliding)
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/other"); err != nil {
+		t.Errorf("expected colliding mappings to be activated with a warning, got %v", err)
+	}
+
+	ms = &MapStore{failOnUsernameCollisions: true}
+	ms.loadConfigMap(teamConfigMap("aws-auth", false, "- rolearn: arn:aws:iam::111122223333:role/Admin\n  username: admin\n- rolearn: arn:aws:iam::111122223333:role/Node\n  username: system:node:{{EC2PrivateDNSName}}\n- rolearn: arn:aws:iam::111122223333:role/Node2\n  username: system:node:{{EC2PrivateDNSName}}\n"))
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/node2"); err != nil {
+		t.Fatalf("expected templated usernames not to collide, got %v", err)
+	}
+	ms.loadConfigMap(colliding)
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/other"); err == nil {
+		t.Errorf("expected colliding mappings not to be activated")
+	}
+	if _, err := ms.RoleMapping("arn:aws:iam::111122223333:role/node"); err != nil {
+		t.Errorf("expected the previous revision to stay active, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package configmap
+
+import (
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// apiUnreachable records a failure to reach the API server at now. Once it
+// has been unreachable for outageThreshold the MapStore is degraded: it keeps
+// serving the last mappings it loaded, and retries at the maximum backoff
+// rather than ramping up again after every probe.
+func (ms *MapStore) apiUnreachable(err error, now time.Time) {
+	ms.outageMutex.Lock()
+	defer ms.outageMutex.Unlock()
+	if ms.unreachableSince.IsZero() {
+		ms.unreachableSince = now
+	}
+	if ms.loads != nil {
+		ms.loads.Failed(err, now)
+	}
+	if ms.degraded || ms.outageThreshold <= 0 || now.Sub(ms.unreachableSince) < ms.outageThreshold {
+		return
+	}
+	ms.degraded = true
+	metrics.APIServerDegraded.Set(1)
+	logger.WithField("since", ms.unreachableSince).Errorf("The API server has been unreachable for over %s, serving the last known good mappings of the %s ConfigMap", ms.outageThreshold, ms.configMapName())
+}
+
+// apiReachable records that the API server was reached again, ending any
+// outage.
+func (ms *MapStore) apiReachable() {
+	ms.outageMutex.Lock()
+	defer ms.outageMutex.Unlock()
+	ms.unreachableSince = time.Time{}
+	if ms.degraded {
+		ms.degraded = false
+		metrics.APIServerDegraded.Set(0)
+		logger.Info("The API server is reachable again, reloading the mappings")
+	}
+}
+
+// isDegraded returns whether the API server has been unreachable for longer
+// than outageThreshold.
+func (ms *MapStore) isDegraded() bool {
+	ms.outageMutex.Lock()
+	defer ms.outageMutex.Unlock()
+	return ms.degraded
+}
+
+// watchBackoffs returns the bounds of the delay before re-establishing a
+// watch.
+func (ms *MapStore) watchBackoffs() (min, max time.Duration) {
+	min, max = watchMinBackoff, watchMaxBackoff
+	if ms.retryMinBackoff > 0 {
+		min = ms.retryMinBackoff
+	}
+	if ms.retryMaxBackoff > 0 {
+		max = ms.retryMaxBackoff
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
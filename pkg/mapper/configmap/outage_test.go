@@ -0,0 +1,125 @@
+package configmap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+func degradedGauge(t *testing.T) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.APIServerDegraded.Write(&m); err != nil {
+		t.Fatalf("could not read gauge: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestAPIOutage(t *testing.T) {
+	ms := makeStore()
+	ms.outageThreshold = time.Minute
+	ms.loads = mapper.NewLoadTracker(mapper.ModeEKSConfigMap)
+	start := time.Unix(1600000000, 0)
+	err := errors.New("connection refused")
+
+	ms.apiUnreachable(err, start)
+	ms.apiUnreachable(err, start.Add(59*time.Second))
+	if ms.isDegraded() {
+		t.Fatalf("degraded before the outage threshold")
+	}
+	ms.apiUnreachable(err, start.Add(time.Minute))
+	if !ms.isDegraded() {
+		t.Fatalf("not degraded after the outage threshold")
+	}
+	if degradedGauge(t) != 1 {
+		t.Errorf("degraded gauge = %v, want 1", degradedGauge(t))
+	}
+	if status := ms.loads.LoadStatus(); status.LastError != err.Error() {
+		t.Errorf("last error = %q, want %q", status.LastError, err)
+	}
+	if !ms.AWSAccount("123") {
+		t.Errorf("expected the last known good mappings to be kept")
+	}
+
+	ms.apiReachable()
+	if ms.isDegraded() {
+		t.Errorf("still degraded after the API server was reached")
+	}
+	if degradedGauge(t) != 0 {
+		t.Errorf("degraded gauge = %v, want 0", degradedGauge(t))
+	}
+	// a new outage starts counting afresh
+	ms.apiUnreachable(err, start.Add(2*time.Minute))
+	if ms.isDegraded() {
+		t.Errorf("degraded at the start of a new outage")
+	}
+}
+
+func TestAPIOutageDisabled(t *testing.T) {
+	ms := makeStore()
+	start := time.Unix(1600000000, 0)
+	ms.apiUnreachable(errors.New("connection refused"), start)
+	ms.apiUnreachable(errors.New("connection refused"), start.Add(24*time.Hour))
+	if ms.isDegraded() {
+		t.Errorf("degraded without an outage threshold")
+	}
+}
+
+func TestWatchBackoffs(t *testing.T) {
+	ms := makeStore()
+	if min, max := ms.watchBackoffs(); min != watchMinBackoff || max != watchMaxBackoff {
+		t.Errorf("default backoffs = %v, %v", min, max)
+	}
+	ms.retryMinBackoff = 5 * time.Second
+	ms.retryMaxBackoff = 30 * time.Second
+	if min, max := ms.watchBackoffs(); min != 5*time.Second || max != 30*time.Second {
+		t.Errorf("backoffs = %v, %v, want 5s, 30s", min, max)
+	}
+	ms.retryMinBackoff = 5 * time.Minute
+	if min, max := ms.watchBackoffs(); min != 5*time.Minute || max != 5*time.Minute {
+		t.Errorf("backoffs = %v, %v, want the maximum raised to the minimum", min, max)
+	}
+}
+
+func TestWatchRetryAfterOutage(t *testing.T) {
+	ms, fakeConfigMaps := makeStoreWClient()
+	ms.retryMinBackoff = time.Millisecond
+	ms.retryMaxBackoff = 10 * time.Millisecond
+	ms.outageThreshold = time.Nanosecond
+
+	watchers := make(chan *watch.FakeWatcher, 10)
+	failures := 3
+	fakeConfigMaps.Fake.Fake.AddWatchReactor("configmaps",
+		func(action k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			if failures > 0 {
+				failures--
+				return true, nil, errors.New("connection refused")
+			}
+			watcher := watch.NewFake()
+			watchers <- watcher
+			return true, watcher, nil
+		})
+
+	stopCh := make(chan struct{})
+	ms.startLoadConfigMap(stopCh)
+	defer close(stopCh)
+
+	select {
+	case <-watchers:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch was not re-established after the outage")
+	}
+	// the outage ends right after the watch is established
+	for i := 0; ms.isDegraded(); i++ {
+		if i == 100 {
+			t.Fatalf("still degraded after the watch was established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
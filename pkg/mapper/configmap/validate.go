@@ -0,0 +1,103 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+)
+
+// AllowedSystemGroups are the system: groups that aws-auth may map
+// identities to. Other system: groups are reserved for Kubernetes, and
+// mapping to them is almost always a mistake, e.g. system:authenticated.
+var AllowedSystemGroups = map[string]bool{
+	"system:masters":       true,
+	"system:bootstrappers": true,
+	"system:nodes":         true,
+	"system:node-proxier":  true,
+}
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Validate checks the data of an aws-auth ConfigMap for mistakes that would
+// break authentication or grant unintended access: invalid YAML, duplicate
+// keys within a mapping, invalid or duplicate ARNs, reserved system: groups
+// and invalid account IDs. It returns all the problems found.
+func Validate(data map[string]string) []error {
+	users, roles, accounts, errs := parseMapData(data)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for _, key := range []string{"mapUsers", "mapRoles"} {
+		if err := checkDuplicateKeys(data, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	checkMapping := func(key, mappingARN string, groups []string) {
+		canonicalARN, err := arn.Canonicalize(strings.ToLower(mappingARN))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			return
+		}
+		if seen[canonicalARN] {
+			errs = append(errs, fmt.Errorf("%s: %s is mapped more than once", key, mappingARN))
+		}
+		seen[canonicalARN] = true
+		for _, group := range groups {
+			if strings.HasPrefix(group, "system:") && !AllowedSystemGroups[group] {
+				errs = append(errs, fmt.Errorf("%s: %s is mapped to the reserved group %s", key, mappingARN, group))
+			}
+		}
+	}
+	for _, u := range users {
+		checkMapping("mapUsers", u.UserARN, u.Groups)
+	}
+	for _, r := range roles {
+		checkMapping("mapRoles", r.RoleARN, r.Groups)
+	}
+	for _, account := range accounts {
+		if !accountIDPattern.MatchString(account) {
+			errs = append(errs, fmt.Errorf("mapAccounts: %q is not a 12 digit account ID", account))
+		}
+	}
+	return errs
+}
+
+// checkDuplicateKeys returns an error if a mapping under key defines a field
+// twice, which the lenient parser would resolve silently.
+func checkDuplicateKeys(data map[string]string, key string) error {
+	value, ok := data[key]
+	if !ok {
+		return nil
+	}
+	decoded, err := decodeMappingData(value)
+	if err != nil {
+		return err
+	}
+	var mappings []map[string]interface{}
+	if err := yaml.UnmarshalStrict([]byte(decoded), &mappings); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
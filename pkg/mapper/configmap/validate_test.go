@@ -0,0 +1,44 @@
+package configmap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		data    map[string]string
+		wantErr string
+	}{
+		{"valid", map[string]string{
+			"mapRoles": `- rolearn: arn:aws:iam::123456789012:role/Node
+  username: system:node:{{EC2PrivateDNSName}}
+  groups: [system:bootstrappers, system:nodes]
+`,
+			"mapUsers":    "- userarn: arn:aws:iam::123456789012:user/Alice\n  username: alice\n  groups: [system:masters]\n",
+			"mapAccounts": `["123456789012"]`,
+		}, ""},
+		{"invalid YAML", map[string]string{"mapRoles": "- rolearn: [oops"}, "did not find expected"},
+		{"duplicate key", map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/A\n  username: a\n  username: b\n"}, "already set"},
+		{"invalid ARN", map[string]string{"mapRoles": "- rolearn: arn:aws:s3:::bucket\n  username: a\n"}, "not a valid service"},
+		{"duplicate ARN", map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/A\n  username: a\n- rolearn: arn:aws:iam::123456789012:role/a\n  username: b\n"}, "mapped more than once"},
+		{"reserved group", map[string]string{"mapUsers": "- userarn: arn:aws:iam::123456789012:user/Alice\n  username: alice\n  groups: [system:authenticated]\n"}, "reserved group system:authenticated"},
+		{"invalid account", map[string]string{"mapAccounts": `["1234"]`}, "not a 12 digit account ID"},
+	} {
+		errs := Validate(c.data)
+		if c.wantErr == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %v", c.name, errs)
+			}
+			continue
+		}
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), c.wantErr)
+		}
+		if !found {
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.wantErr, errs)
+		}
+	}
+}
@@ -38,12 +38,65 @@ type IAMIdentityMappingSpec struct {
 	ARN      string   `json:"arn"`
 	Username string   `json:"username"`
 	Groups   []string `json:"groups"`
+	// IdentityExtras, if set, overrides the server's --identity-extras for
+	// this mapping.
+	IdentityExtras *bool `json:"identityExtras,omitempty"`
+	// NotAfter, if set, is when the mapping expires. Expired mappings are
+	// ignored.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
 }
 
 // IAMIdentityMappingStatus is the status for a IAMIdentityMapping resource
 type IAMIdentityMappingStatus struct {
 	CanonicalARN string `json:"canonicalARN"`
 	UserID       string `json:"userID"`
+	// ObservedGeneration is the generation of the spec the conditions were
+	// computed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions report whether the mapping is in effect.
+	Conditions []IAMIdentityMappingCondition `json:"conditions,omitempty"`
+}
+
+// ConditionAccepted is the type of the condition that is True when an
+// IAMIdentityMapping is in effect. When it is False, its reason is one of
+// ReasonConflict, ReasonInvalidARN or ReasonExpired.
+const ConditionAccepted = "Accepted"
+
+// Reasons of the Accepted condition.
+const (
+	// ReasonAccepted is a mapping in effect.
+	ReasonAccepted = "Accepted"
+	// ReasonConflict is a mapping of an ARN that an older
+	// IAMIdentityMapping already maps.
+	ReasonConflict = "Conflict"
+	// ReasonInvalidARN is a mapping of an ARN that can't be canonicalized.
+	ReasonInvalidARN = "InvalidARN"
+	// ReasonExpired is a mapping past its notAfter.
+	ReasonExpired = "Expired"
+)
+
+// IAMIdentityMappingCondition is a condition of an IAMIdentityMapping.
+type IAMIdentityMappingCondition struct {
+	// Type is the type of the condition, such as ConditionAccepted.
+	Type string `json:"type"`
+	// Status is True, False or Unknown.
+	Status string `json:"status"`
+	// Reason is a CamelCase reason for the status.
+	Reason string `json:"reason,omitempty"`
+	// Message describes the status for people.
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is when the status last changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// Condition returns the condition of type conditionType, or nil.
+func (s *IAMIdentityMappingStatus) Condition(conditionType string) *IAMIdentityMappingCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
 }
 
 // +genclient:nonNamespaced
@@ -56,3 +109,29 @@ type IAMIdentityMappingList struct {
 
 	Items []IAMIdentityMapping `json:"items"`
 }
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NamespacedIAMIdentityMapping maps an IAM identity like an
+// IAMIdentityMapping, but can be delegated to the owners of a namespace: its
+// username and groups are prefixed with "ns:<namespace>:", so it can't grant
+// more than the RBAC bindings of that prefix allow.
+type NamespacedIAMIdentityMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IAMIdentityMappingSpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NamespacedIAMIdentityMappingList is a list of NamespacedIAMIdentityMapping
+// resources
+type NamespacedIAMIdentityMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []NamespacedIAMIdentityMapping `json:"items"`
+}
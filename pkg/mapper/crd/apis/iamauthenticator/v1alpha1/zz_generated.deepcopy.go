@@ -29,7 +29,7 @@ func (in *IAMIdentityMapping) DeepCopyInto(out *IAMIdentityMapping) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -51,6 +51,23 @@ func (in *IAMIdentityMapping) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IAMIdentityMappingCondition) DeepCopyInto(out *IAMIdentityMappingCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IAMIdentityMappingCondition.
+func (in *IAMIdentityMappingCondition) DeepCopy() *IAMIdentityMappingCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(IAMIdentityMappingCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IAMIdentityMappingList) DeepCopyInto(out *IAMIdentityMappingList) {
 	*out = *in
@@ -92,6 +109,15 @@ func (in *IAMIdentityMappingSpec) DeepCopyInto(out *IAMIdentityMappingSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.IdentityExtras != nil {
+		in, out := &in.IdentityExtras, &out.IdentityExtras
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -108,6 +134,13 @@ func (in *IAMIdentityMappingSpec) DeepCopy() *IAMIdentityMappingSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IAMIdentityMappingStatus) DeepCopyInto(out *IAMIdentityMappingStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]IAMIdentityMappingCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -120,3 +153,63 @@ func (in *IAMIdentityMappingStatus) DeepCopy() *IAMIdentityMappingStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedIAMIdentityMapping) DeepCopyInto(out *NamespacedIAMIdentityMapping) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedIAMIdentityMapping.
+func (in *NamespacedIAMIdentityMapping) DeepCopy() *NamespacedIAMIdentityMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedIAMIdentityMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedIAMIdentityMapping) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedIAMIdentityMappingList) DeepCopyInto(out *NamespacedIAMIdentityMappingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespacedIAMIdentityMapping, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedIAMIdentityMappingList.
+func (in *NamespacedIAMIdentityMappingList) DeepCopy() *NamespacedIAMIdentityMappingList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedIAMIdentityMappingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedIAMIdentityMappingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -15,11 +15,13 @@ package controller
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -29,9 +31,8 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
-	"github.com/sirupsen/logrus"
-
 	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
 	clientset "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/clientset/versioned"
 	iamscheme "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/clientset/versioned/scheme"
@@ -39,6 +40,8 @@ import (
 	listers "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/listers/iamauthenticator/v1alpha1"
 )
 
+var logger = logging.For(logging.ComponentMapper)
+
 const (
 	// controllerAgentName is the name the controller appears as in the Event logger
 	controllerAgentName = "aws-iam-authenticator"
@@ -68,21 +71,28 @@ type Controller struct {
 	workqueue workqueue.RateLimitingInterface
 	// recorder implements the Event recorder interface for logging events.
 	recorder record.EventRecorder
+
+	// strict reports mappings whose ARNs differ only by case as different
+	// identities rather than conflicts.
+	strict bool
+	// now returns the current time, to tell expired mappings.
+	now func() time.Time
 }
 
 // New will initialize a default controller object
 func New(
 	kubeclientset kubernetes.Interface,
 	iamclientset clientset.Interface,
-	iamMappingInformer informers.IAMIdentityMappingInformer) *Controller {
+	iamMappingInformer informers.IAMIdentityMappingInformer,
+	strict bool) *Controller {
 
 	// Initialize the Scheme
 	utilruntime.Must(iamscheme.AddToScheme(scheme.Scheme))
 
 	// Setup event broadcaster
-	logrus.Info("creating event broadcaster")
+	logger.Info("creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(logrus.Infof)
+	eventBroadcaster.StartLogging(logger.Infof)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
@@ -93,25 +103,31 @@ func New(
 		iamMappingsSynced: iamMappingInformer.Informer().HasSynced,
 		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "IAMIdentityMappings"),
 		recorder:          recorder,
+		strict:            strict,
+		now:               time.Now,
 	}
 
-	logrus.Info("setting up event handlers")
+	logger.Info("setting up event handlers")
 	// adding event handlers to load the informer and convert roles into
-	// canonical ARNs, we're ignoring deletes because all checks for roles happen
-	// using the in-memory cache which is updated automatically on deletes no further
-	// actions are necessary
+	// canonical ARNs. Checks for roles happen using the in-memory cache, which
+	// is updated automatically on deletes, so deletes only update the status
+	// of the other mappings of the same ARN
 	iamMappingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.enqueueIAMIdentityMapping,
 		UpdateFunc: func(old, new interface{}) {
 			controller.enqueueIAMIdentityMapping(new)
+			controller.enqueuePeers(old)
 		},
+		// the conditions of the other mappings of a deleted mapping's
+		// identity may change
+		DeleteFunc: controller.enqueuePeers,
 	})
 
 	err := iamMappingInformer.Informer().GetIndexer().AddIndexers(cache.Indexers{
 		"canonicalARN": IndexIAMIdentityMappingByCanonicalArn,
 	})
 	if err != nil {
-		logrus.WithError(err).Fatal("error adding index")
+		logger.WithError(err).Fatal("error adding index")
 	}
 
 	controller.iamMappingsIndex = iamMappingInformer.Informer().GetIndexer()
@@ -124,21 +140,21 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.workqueue.ShutDown()
 
-	logrus.Info("starting aws iam authenticator controller")
+	logger.Info("starting aws iam authenticator controller")
 
-	logrus.Info("waiting for informer caches to sync")
+	logger.Info("waiting for informer caches to sync")
 	if ok := cache.WaitForCacheSync(stopCh, c.iamMappingsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
-	logrus.Info("starting workers")
+	logger.Info("starting workers")
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
-	logrus.Info("started workers")
+	logger.Info("started workers")
 	<-stopCh
-	logrus.Info("shutting down workers")
+	logger.Info("shutting down workers")
 
 	return nil
 }
@@ -173,7 +189,7 @@ func (c *Controller) processNextWorkItem() bool {
 		}
 
 		c.workqueue.Forget(obj)
-		logrus.Infof("successfully synced %s", key)
+		logger.Infof("successfully synced %s", key)
 		return nil
 	}(obj)
 
@@ -202,25 +218,125 @@ func (c *Controller) syncHandler(key string) (err error) {
 	}
 
 	// Process items
-	if iamIdentityMapping.Spec.ARN != "" {
+	status := c.status(iamIdentityMapping)
+	if !reflect.DeepEqual(status, iamIdentityMapping.Status) {
 		iamIdentityMappingCopy := iamIdentityMapping.DeepCopy()
-
-		canonicalizedARN, err := arn.Canonicalize(strings.ToLower(iamIdentityMapping.Spec.ARN))
-		if err != nil {
-			return err
-		}
-
-		iamIdentityMappingCopy.Status.CanonicalARN = canonicalizedARN
+		iamIdentityMappingCopy.Status = status
 		_, err = c.iamclientset.IamauthenticatorV1alpha1().IAMIdentityMappings().UpdateStatus(iamIdentityMappingCopy)
 		if err != nil {
 			return err
 		}
 	}
+	// sync again when the mapping expires, to report it
+	if notAfter := iamIdentityMapping.Spec.NotAfter; notAfter != nil && c.now().Before(notAfter.Time) {
+		c.workqueue.AddAfter(key, notAfter.Sub(c.now()))
+	}
 
 	c.recorder.Event(iamIdentityMapping, corev1.EventTypeNormal, SuccessSynced, IdentitySynced)
 	return nil
 }
 
+// status returns the status of mapping: its canonical ARN, and whether it is
+// in effect in the Accepted condition.
+func (c *Controller) status(mapping *iamauthenticatorv1alpha1.IAMIdentityMapping) iamauthenticatorv1alpha1.IAMIdentityMappingStatus {
+	status := *mapping.Status.DeepCopy()
+	status.ObservedGeneration = mapping.Generation
+
+	canonicalizedARN, err := arn.Canonicalize(strings.ToLower(mapping.Spec.ARN))
+	if err != nil {
+		status.CanonicalARN = ""
+		c.setAccepted(&status, corev1.ConditionFalse, iamauthenticatorv1alpha1.ReasonInvalidARN, fmt.Sprintf("the ARN can't be mapped: %v", err))
+		return status
+	}
+	status.CanonicalARN = canonicalizedARN
+
+	switch active := ActiveMapping(c.sameIdentity(mapping, canonicalizedARN)); {
+	case active.Name != mapping.Name:
+		c.setAccepted(&status, corev1.ConditionFalse, iamauthenticatorv1alpha1.ReasonConflict, fmt.Sprintf("the ARN is already mapped by IAMIdentityMapping %s", active.Name))
+	case mapping.Spec.NotAfter != nil && !c.now().Before(mapping.Spec.NotAfter.Time):
+		c.setAccepted(&status, corev1.ConditionFalse, iamauthenticatorv1alpha1.ReasonExpired, "the mapping is past its notAfter")
+	default:
+		c.setAccepted(&status, corev1.ConditionTrue, iamauthenticatorv1alpha1.ReasonAccepted, "the mapping is in effect")
+	}
+	return status
+}
+
+// sameIdentity returns mapping and the other IAMIdentityMappings of the
+// identity with canonicalizedARN.
+func (c *Controller) sameIdentity(mapping *iamauthenticatorv1alpha1.IAMIdentityMapping, canonicalizedARN string) []*iamauthenticatorv1alpha1.IAMIdentityMapping {
+	mappings := []*iamauthenticatorv1alpha1.IAMIdentityMapping{mapping}
+	objects, _ := c.iamMappingsIndex.ByIndex("canonicalARN", canonicalizedARN)
+	for _, obj := range objects {
+		other, ok := obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
+		if !ok || other.Name == mapping.Name {
+			continue
+		}
+		// with strict ARN matching, ARNs that differ by case are different
+		// identities
+		if c.strict {
+			a, errA := arn.Canonicalize(mapping.Spec.ARN)
+			b, errB := arn.Canonicalize(other.Spec.ARN)
+			if errA != nil || errB != nil || a != b {
+				continue
+			}
+		}
+		mappings = append(mappings, other)
+	}
+	return mappings
+}
+
+// setAccepted sets the Accepted condition of status, keeping its transition
+// time unless its status changes.
+func (c *Controller) setAccepted(status *iamauthenticatorv1alpha1.IAMIdentityMappingStatus, conditionStatus corev1.ConditionStatus, reason, message string) {
+	condition := iamauthenticatorv1alpha1.IAMIdentityMappingCondition{
+		Type:               iamauthenticatorv1alpha1.ConditionAccepted,
+		Status:             string(conditionStatus),
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.NewTime(c.now().Truncate(time.Second)),
+	}
+	if existing := status.Condition(iamauthenticatorv1alpha1.ConditionAccepted); existing != nil {
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
+
+// ActiveMapping returns the IAMIdentityMapping in effect among mappings of
+// the same identity: the oldest one, or the first by name among those
+// created at the same time.
+func ActiveMapping(mappings []*iamauthenticatorv1alpha1.IAMIdentityMapping) *iamauthenticatorv1alpha1.IAMIdentityMapping {
+	var active *iamauthenticatorv1alpha1.IAMIdentityMapping
+	for _, m := range mappings {
+		if active == nil || m.CreationTimestamp.Before(&active.CreationTimestamp) ||
+			(m.CreationTimestamp.Equal(&active.CreationTimestamp) && m.Name < active.Name) {
+			active = m
+		}
+	}
+	return active
+}
+
+// enqueuePeers enqueues the other IAMIdentityMappings of the identity of
+// obj, whose Accepted condition may change with it.
+func (c *Controller) enqueuePeers(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	mapping, ok := obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
+	if !ok || mapping.Status.CanonicalARN == "" {
+		return
+	}
+	objects, _ := c.iamMappingsIndex.ByIndex("canonicalARN", mapping.Status.CanonicalARN)
+	for _, other := range objects {
+		if other.(*iamauthenticatorv1alpha1.IAMIdentityMapping).Name != mapping.Name {
+			c.enqueueIAMIdentityMapping(other)
+		}
+	}
+}
+
 // enqueueIAMIdentityMapping will pull in a new IAMIdentityMapping and update it
 func (c *Controller) enqueueIAMIdentityMapping(obj interface{}) {
 	var key string
@@ -33,6 +33,7 @@ import (
 )
 
 var (
+	testNow            = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
 	alwaysReady        = func() bool { return true }
 	noResyncPeriodFunc = func() time.Duration { return 0 }
 )
@@ -79,10 +80,11 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory)
 
 	i := informers.NewSharedInformerFactory(f.client, noResyncPeriodFunc())
 
-	c := New(f.kubeclient, f.client, i.Iamauthenticator().V1alpha1().IAMIdentityMappings())
+	c := New(f.kubeclient, f.client, i.Iamauthenticator().V1alpha1().IAMIdentityMappings(), false)
 
 	c.iamMappingsSynced = alwaysReady
 	c.recorder = &record.FakeRecorder{}
+	c.now = func() time.Time { return testNow }
 
 	for _, f := range f.iamIdentityLister {
 		i.Iamauthenticator().V1alpha1().IAMIdentityMappings().Informer().GetIndexer().Add(f)
@@ -232,10 +234,80 @@ func TestIAMIdentityMappingCreation(t *testing.T) {
 
 	// Update will always add these parameters
 	canonicalizedArn := "arn:aws:iam::xxxxxxxxxxxx:user/authorizeduser"
-	iamidentity.Status = iamauthenticatorv1alpha1.IAMIdentityMappingStatus{
+	status := iamidentity.DeepCopy()
+	status.Status = iamauthenticatorv1alpha1.IAMIdentityMappingStatus{
 		CanonicalARN: canonicalizedArn,
+		Conditions:   []iamauthenticatorv1alpha1.IAMIdentityMappingCondition{accepted("True", iamauthenticatorv1alpha1.ReasonAccepted, "the mapping is in effect")},
+	}
+
+	f.expectUpdateStatusAction(status)
+	f.run(getKey(iamidentity, t))
+}
+
+func accepted(status, reason, message string) iamauthenticatorv1alpha1.IAMIdentityMappingCondition {
+	return iamauthenticatorv1alpha1.IAMIdentityMappingCondition{
+		Type:               iamauthenticatorv1alpha1.ConditionAccepted,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.NewTime(testNow),
+	}
+}
+
+func TestIAMIdentityMappingStatusUnchanged(t *testing.T) {
+	f := newFixture(t)
+	iamidentity := newIAMIdentityMapping("test", "arn:aws:iam::XXXXXXXXXXXX:user/AuthorizedUser", "user-1")
+	iamidentity.Status = iamauthenticatorv1alpha1.IAMIdentityMappingStatus{
+		CanonicalARN: "arn:aws:iam::xxxxxxxxxxxx:user/authorizeduser",
+		Conditions:   []iamauthenticatorv1alpha1.IAMIdentityMappingCondition{accepted("True", iamauthenticatorv1alpha1.ReasonAccepted, "the mapping is in effect")},
 	}
+	f.iamIdentityLister = append(f.iamIdentityLister, iamidentity)
+	f.objects = append(f.objects, iamidentity)
 
-	f.expectUpdateStatusAction(iamidentity)
+	// an up to date status isn't written again
 	f.run(getKey(iamidentity, t))
 }
+
+func TestIAMIdentityMappingConditions(t *testing.T) {
+	older := newIAMIdentityMapping("older", "arn:aws:iam::111122223333:role/Admin", "admin")
+	older.CreationTimestamp = metav1.NewTime(testNow.Add(-time.Hour))
+	older.Status.CanonicalARN = "arn:aws:iam::111122223333:role/admin"
+	newer := newIAMIdentityMapping("newer", "arn:aws:iam::111122223333:role/admin", "other")
+	newer.CreationTimestamp = metav1.NewTime(testNow)
+	newer.Status.CanonicalARN = "arn:aws:iam::111122223333:role/admin"
+	invalid := newIAMIdentityMapping("invalid", "not-an-arn", "x")
+	expired := newIAMIdentityMapping("expired", "arn:aws:iam::111122223333:role/Old", "old")
+	expired.Spec.NotAfter = &metav1.Time{Time: testNow.Add(-time.Minute)}
+
+	f := newFixture(t)
+	f.iamIdentityLister = []*iamauthenticatorv1alpha1.IAMIdentityMapping{older, newer, invalid, expired}
+	c, _ := f.newController()
+
+	for _, tc := range []struct {
+		mapping *iamauthenticatorv1alpha1.IAMIdentityMapping
+		status  string
+		reason  string
+	}{
+		{older, "True", iamauthenticatorv1alpha1.ReasonAccepted},
+		{newer, "False", iamauthenticatorv1alpha1.ReasonConflict},
+		{invalid, "False", iamauthenticatorv1alpha1.ReasonInvalidARN},
+		{expired, "False", iamauthenticatorv1alpha1.ReasonExpired},
+	} {
+		status := c.status(tc.mapping)
+		condition := status.Condition(iamauthenticatorv1alpha1.ConditionAccepted)
+		if condition == nil || condition.Status != tc.status || condition.Reason != tc.reason {
+			t.Errorf("%s: expected Accepted %s with reason %s, got %+v", tc.mapping.Name, tc.status, tc.reason, condition)
+		}
+	}
+
+	// the transition time only changes with the status
+	newer.Status.Conditions = []iamauthenticatorv1alpha1.IAMIdentityMappingCondition{accepted("False", iamauthenticatorv1alpha1.ReasonConflict, "")}
+	newer.Status.Conditions[0].LastTransitionTime = metav1.NewTime(testNow.Add(-time.Hour))
+	if got := c.status(newer).Conditions[0].LastTransitionTime; !got.Equal(&newer.Status.Conditions[0].LastTransitionTime) {
+		t.Errorf("expected the transition time to be kept, got %v", got)
+	}
+
+	if got := ActiveMapping([]*iamauthenticatorv1alpha1.IAMIdentityMapping{newer, older}); got != older {
+		t.Errorf("expected the oldest mapping to be active, got %s", got.Name)
+	}
+}
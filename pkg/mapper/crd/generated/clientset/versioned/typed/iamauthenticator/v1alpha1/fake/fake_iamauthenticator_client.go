@@ -31,6 +31,10 @@ func (c *FakeIamauthenticatorV1alpha1) IAMIdentityMappings() v1alpha1.IAMIdentit
 	return &FakeIAMIdentityMappings{c}
 }
 
+func (c *FakeIamauthenticatorV1alpha1) NamespacedIAMIdentityMappings(namespace string) v1alpha1.NamespacedIAMIdentityMappingInterface {
+	return &FakeNamespacedIAMIdentityMappings{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeIamauthenticatorV1alpha1) RESTClient() rest.Interface {
@@ -26,6 +26,7 @@ import (
 type IamauthenticatorV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	IAMIdentityMappingsGetter
+	NamespacedIAMIdentityMappingsGetter
 }
 
 // IamauthenticatorV1alpha1Client is used to interact with features provided by the iamauthenticator.k8s.aws group.
@@ -37,6 +38,10 @@ func (c *IamauthenticatorV1alpha1Client) IAMIdentityMappings() IAMIdentityMappin
 	return newIAMIdentityMappings(c)
 }
 
+func (c *IamauthenticatorV1alpha1Client) NamespacedIAMIdentityMappings(namespace string) NamespacedIAMIdentityMappingInterface {
+	return newNamespacedIAMIdentityMappings(c, namespace)
+}
+
 // NewForConfig creates a new IamauthenticatorV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*IamauthenticatorV1alpha1Client, error) {
 	config := *c
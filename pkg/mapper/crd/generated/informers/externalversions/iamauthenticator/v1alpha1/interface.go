@@ -25,6 +25,8 @@ import (
 type Interface interface {
 	// IAMIdentityMappings returns a IAMIdentityMappingInformer.
 	IAMIdentityMappings() IAMIdentityMappingInformer
+	// NamespacedIAMIdentityMappings returns a NamespacedIAMIdentityMappingInformer.
+	NamespacedIAMIdentityMappings() NamespacedIAMIdentityMappingInformer
 }
 
 type version struct {
@@ -42,3 +44,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) IAMIdentityMappings() IAMIdentityMappingInformer {
 	return &iAMIdentityMappingInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// NamespacedIAMIdentityMappings returns a NamespacedIAMIdentityMappingInformer.
+func (v *version) NamespacedIAMIdentityMappings() NamespacedIAMIdentityMappingInformer {
+	return &namespacedIAMIdentityMappingInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
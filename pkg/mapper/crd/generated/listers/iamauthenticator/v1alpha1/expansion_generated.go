@@ -20,3 +20,11 @@ package v1alpha1
 // IAMIdentityMappingListerExpansion allows custom methods to be added to
 // IAMIdentityMappingLister.
 type IAMIdentityMappingListerExpansion interface{}
+
+// NamespacedIAMIdentityMappingListerExpansion allows custom methods to be added to
+// NamespacedIAMIdentityMappingLister.
+type NamespacedIAMIdentityMappingListerExpansion interface{}
+
+// NamespacedIAMIdentityMappingNamespaceListerExpansion allows custom methods to be added to
+// NamespacedIAMIdentityMappingNamespaceLister.
+type NamespacedIAMIdentityMappingNamespaceListerExpansion interface{}
@@ -5,11 +5,14 @@ import (
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/kubeclient"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
 	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/controller"
@@ -17,6 +20,8 @@ import (
 	informers "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/informers/externalversions"
 )
 
+var logger = logging.For(logging.ComponentMapper)
+
 type CRDMapper struct {
 	*controller.Controller
 	// iamInformerFactory is an informer factory that must be Started
@@ -25,9 +30,28 @@ type CRDMapper struct {
 	iamMappingsSynced cache.InformerSynced
 	// iamMappingsIndex is a custom indexer which allows for indexing on canonical arns
 	iamMappingsIndex cache.Indexer
+	// namespacedMappingsSynced and namespacedMappingsIndex are set when
+	// NamespacedIAMIdentityMappings are enabled
+	namespacedMappingsSynced cache.InformerSynced
+	namespacedMappingsIndex  cache.Indexer
+	// namespacedARNs are the ARNs the NamespacedIAMIdentityMappings of each
+	// namespace may map.
+	namespacedARNs map[string][]string
+	// strict only maps identities whose canonical ARN has the case of the
+	// mapping's ARN. The indexes are always lowercase.
+	strict bool
+	// changes, if set, logs the changes of the mappings once the informers
+	// have synced.
+	changes *mapper.ChangeRecorder
+	// roleGC, if set, runs every roleGCInterval once the informers have
+	// synced.
+	roleGC         *roleGC
+	roleGCInterval time.Duration
 }
 
 var _ mapper.Mapper = &CRDMapper{}
+var _ mapper.Loader = &CRDMapper{}
+var _ mapper.Lister = &CRDMapper{}
 
 func NewCRDMapper(cfg config.Config) (*CRDMapper, error) {
 	var err error
@@ -36,13 +60,9 @@ func NewCRDMapper(cfg config.Config) (*CRDMapper, error) {
 	var iamClient clientset.Interface
 	var iamInformerFactory informers.SharedInformerFactory
 
-	if cfg.Master != "" || cfg.Kubeconfig != "" {
-		k8sconfig, err = clientcmd.BuildConfigFromFlags(cfg.Master, cfg.Kubeconfig)
-	} else {
-		k8sconfig, err = rest.InClusterConfig()
-	}
+	k8sconfig, err = kubeclient.RESTConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("can't create kubernetes config: %v", err)
+		return nil, err
 	}
 
 	kubeClient, err = kubernetes.NewForConfig(k8sconfig)
@@ -61,21 +81,63 @@ func NewCRDMapper(cfg config.Config) (*CRDMapper, error) {
 	iamMappingsSynced := iamMappingInformer.Informer().HasSynced
 	iamMappingsIndex := iamMappingInformer.Informer().GetIndexer()
 
-	ctrl := controller.New(kubeClient, iamClient, iamMappingInformer)
+	ctrl := controller.New(kubeClient, iamClient, iamMappingInformer, cfg.StrictARNMatching)
 
-	return &CRDMapper{ctrl, iamInformerFactory, iamMappingsSynced, iamMappingsIndex}, nil
+	m := &CRDMapper{
+		Controller:         ctrl,
+		iamInformerFactory: iamInformerFactory,
+		iamMappingsSynced:  iamMappingsSynced,
+		iamMappingsIndex:   iamMappingsIndex,
+		strict:             cfg.StrictARNMatching,
+		changes:            mapper.NewChangeRecorder(mapper.ModeCRD),
+	}
+	iamMappingInformer.Informer().AddEventHandler(m.changeHandler())
+	if cfg.CRDRoleGCAction != "" {
+		m.roleGC = newRoleGC(cfg, iamClient, iamMappingsIndex)
+		m.roleGCInterval = cfg.CRDRoleGCInterval
+	}
+	if cfg.CRDNamespacedMappings {
+		namespacedInformer := iamInformerFactory.Iamauthenticator().V1alpha1().NamespacedIAMIdentityMappings().Informer()
+		if err := namespacedInformer.AddIndexers(cache.Indexers{
+			"canonicalARN": IndexNamespacedIAMIdentityMappingByARN,
+		}); err != nil {
+			return nil, fmt.Errorf("can't index NamespacedIAMIdentityMappings: %v", err)
+		}
+		m.namespacedMappingsSynced = namespacedInformer.HasSynced
+		m.namespacedMappingsIndex = namespacedInformer.GetIndexer()
+		m.namespacedARNs = cfg.CRDNamespacedMappingARNs
+		namespacedInformer.AddEventHandler(m.changeHandler())
+	}
+	return m, nil
 }
 
 func NewCRDMapperWithIndexer(iamMappingsIndex cache.Indexer) *CRDMapper {
 	return &CRDMapper{iamMappingsIndex: iamMappingsIndex}
 }
 
+// NewCRDMapperWithIndexers returns a CRDMapper for the IAMIdentityMappings
+// of iamMappingsIndex and the NamespacedIAMIdentityMappings of
+// namespacedMappingsIndex, which may map the namespacedARNs of their
+// namespace.
+func NewCRDMapperWithIndexers(iamMappingsIndex, namespacedMappingsIndex cache.Indexer, namespacedARNs map[string][]string) *CRDMapper {
+	return &CRDMapper{iamMappingsIndex: iamMappingsIndex, namespacedMappingsIndex: namespacedMappingsIndex, namespacedARNs: namespacedARNs}
+}
+
 func (m *CRDMapper) Name() string {
 	return mapper.ModeCRD
 }
 
 func (m *CRDMapper) Start(stopCh <-chan struct{}) error {
 	m.iamInformerFactory.Start(stopCh)
+	go func() {
+		// record the initial mappings, which later changes are logged against
+		if m.synced(stopCh) {
+			m.recordChanges()
+			if m.roleGC != nil {
+				go wait.Until(m.roleGC.run, m.roleGCInterval, stopCh)
+			}
+		}
+	}()
 	go func() {
 		// Run starts worker goroutines and blocks
 		if err := m.Controller.Run(2, stopCh); err != nil {
@@ -86,29 +148,79 @@ func (m *CRDMapper) Start(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// synced waits for the informers to sync and reports whether they did before
+// stopCh was closed.
+func (m *CRDMapper) synced(stopCh <-chan struct{}) bool {
+	if !cache.WaitForCacheSync(stopCh, m.iamMappingsSynced) {
+		return false
+	}
+	return m.namespacedMappingsSynced == nil || cache.WaitForCacheSync(stopCh, m.namespacedMappingsSynced)
+}
+
+// changeHandler records the changes of the mappings on every event of an
+// informer.
+func (m *CRDMapper) changeHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { m.recordChanges() },
+		UpdateFunc: func(interface{}, interface{}) { m.recordChanges() },
+		DeleteFunc: func(interface{}) { m.recordChanges() },
+	}
+}
+
+// recordChanges logs the changes of the mappings since they were last
+// recorded. Events of the initial list are skipped until the informers have
+// synced.
+func (m *CRDMapper) recordChanges() {
+	if m.changes == nil || !m.iamMappingsSynced() || (m.namespacedMappingsSynced != nil && !m.namespacedMappingsSynced()) {
+		return
+	}
+	mappings, accounts := m.List()
+	if n := m.Namespaced(); n != nil {
+		namespaced, _ := n.List()
+		mappings = append(mappings, namespaced...)
+	}
+	m.changes.Record(mappings, accounts)
+}
+
+func (m *CRDMapper) Load(stopCh <-chan struct{}) error {
+	m.iamInformerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, m.iamMappingsSynced) {
+		return fmt.Errorf("timed out listing IAMIdentityMappings")
+	}
+	if m.namespacedMappingsSynced != nil && !cache.WaitForCacheSync(stopCh, m.namespacedMappingsSynced) {
+		return fmt.Errorf("timed out listing NamespacedIAMIdentityMappings")
+	}
+	return nil
+}
+
 func (m *CRDMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
+	exactARN := canonicalARN
 	canonicalARN = strings.ToLower(canonicalARN)
 
 	var iamidentity *iamauthenticatorv1alpha1.IAMIdentityMapping
-	var ok bool
 	objects, err := m.iamMappingsIndex.ByIndex("canonicalARN", canonicalARN)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(objects) > 0 {
+		var candidates []*iamauthenticatorv1alpha1.IAMIdentityMapping
 		for _, obj := range objects {
-			iamidentity, ok = obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
-			if ok {
-				break
+			candidate, ok := obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
+			if ok && m.matches(candidate.Spec.ARN, exactARN) {
+				candidates = append(candidates, candidate)
 			}
 		}
+		// the same mapping the controller reports as accepted
+		iamidentity = controller.ActiveMapping(candidates)
 
 		if iamidentity != nil {
 			return &config.IdentityMapping{
-				IdentityARN: canonicalARN,
-				Username:    iamidentity.Spec.Username,
-				Groups:      iamidentity.Spec.Groups,
+				IdentityARN:    canonicalARN,
+				Username:       iamidentity.Spec.Username,
+				Groups:         iamidentity.Spec.Groups,
+				IdentityExtras: iamidentity.Spec.IdentityExtras,
+				NotAfter:       notAfter(iamidentity.Spec),
 			}, nil
 		}
 	}
@@ -116,6 +228,46 @@ func (m *CRDMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
 	return nil, mapper.ErrNotMapped
 }
 
-func (m *CRDMapper) IsAccountAllowed(accountID string) bool {
-	return false
+// List returns the IAMIdentityMappings whose canonical ARN the controller
+// has resolved, as only those can be mapped. The NamespacedIAMIdentityMappings
+// are listed by Namespaced.
+func (m *CRDMapper) List() ([]config.IdentityMapping, []string) {
+	var mappings []config.IdentityMapping
+	for _, obj := range m.iamMappingsIndex.List() {
+		iamidentity, ok := obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
+		if !ok || iamidentity.Status.CanonicalARN == "" {
+			continue
+		}
+		mappings = append(mappings, config.IdentityMapping{
+			IdentityARN:    strings.ToLower(iamidentity.Status.CanonicalARN),
+			Username:       iamidentity.Spec.Username,
+			Groups:         iamidentity.Spec.Groups,
+			IdentityExtras: iamidentity.Spec.IdentityExtras,
+			NotAfter:       notAfter(iamidentity.Spec),
+		})
+	}
+	return mappings, nil
+}
+
+// matches reports whether a mapping of mappingARN applies to the identity
+// with canonical ARN exactARN, which the index already matched regardless of
+// case.
+func (m *CRDMapper) matches(mappingARN, exactARN string) bool {
+	if !m.strict {
+		return true
+	}
+	canonicalARN, err := arn.Canonicalize(mappingARN)
+	return err == nil && canonicalARN == exactARN
+}
+
+func (m *CRDMapper) IsAccountAllowed(accountID string) (bool, error) {
+	return false, nil
+}
+
+// notAfter returns the expiration of a mapping with spec, if any.
+func notAfter(spec iamauthenticatorv1alpha1.IAMIdentityMappingSpec) *time.Time {
+	if spec.NotAfter == nil {
+		return nil
+	}
+	return &spec.NotAfter.Time
 }
@@ -0,0 +1,202 @@
+package crd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
+)
+
+// NamespacePrefix returns the prefix of the username and groups granted by
+// the NamespacedIAMIdentityMappings of namespace.
+func NamespacePrefix(namespace string) string {
+	return "ns:" + namespace + ":"
+}
+
+// ParseNamespacedMappingARNs parses namespace=arn entries into the ARNs the
+// NamespacedIAMIdentityMappings of each namespace may map. An ARN ending with
+// * matches the ARNs it is a prefix of.
+func ParseNamespacedMappingARNs(entries []string) (map[string][]string, error) {
+	allowed := map[string][]string{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || len(validation.IsDNS1123Label(parts[0])) > 0 || !strings.HasPrefix(parts[1], "arn:") {
+			return nil, fmt.Errorf("invalid namespaced mapping ARN %q: expected namespace=arn", entry)
+		}
+		allowed[parts[0]] = append(allowed[parts[0]], parts[1])
+	}
+	return allowed, nil
+}
+
+// IndexNamespacedIAMIdentityMappingByARN indexes NamespacedIAMIdentityMappings
+// by the canonical form of their ARN. Unlike IAMIdentityMappings it is
+// computed here rather than by the controller, so the server doesn't need
+// write access to the namespaces.
+func IndexNamespacedIAMIdentityMappingByARN(obj interface{}) ([]string, error) {
+	mapping, ok := obj.(*iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping)
+	if !ok || mapping.Spec.ARN == "" {
+		return []string{}, nil
+	}
+	canonicalARN, err := arn.Canonicalize(strings.ToLower(mapping.Spec.ARN))
+	if err != nil {
+		return []string{}, nil
+	}
+	return []string{strings.ToLower(canonicalARN)}, nil
+}
+
+// namespacedIdentityMapping returns the mapping of m, with its username and
+// groups prefixed with the prefix of its namespace unless they already are,
+// so a namespace's owners can't map anyone to a user or group outside it.
+func namespacedIdentityMapping(canonicalARN string, m *iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping) *config.IdentityMapping {
+	prefix := NamespacePrefix(m.Namespace)
+	withPrefix := func(s string) string {
+		if strings.HasPrefix(s, prefix) {
+			return s
+		}
+		return prefix + s
+	}
+	groups := make([]string, 0, len(m.Spec.Groups))
+	for _, g := range m.Spec.Groups {
+		groups = append(groups, withPrefix(g))
+	}
+	return &config.IdentityMapping{
+		IdentityARN:    canonicalARN,
+		Username:       withPrefix(m.Spec.Username),
+		Groups:         groups,
+		IdentityExtras: m.Spec.IdentityExtras,
+		NotAfter:       notAfter(m.Spec),
+	}
+}
+
+// NamespacedMapper maps identities with the NamespacedIAMIdentityMappings
+// watched by a CRD backend. It is consulted after every other backend, so a
+// namespace can't take over the identity of a cluster-wide mapping, and only
+// maps the ARNs allowed for the namespace of each mapping.
+type NamespacedMapper struct {
+	crd *CRDMapper
+}
+
+var _ mapper.Mapper = &NamespacedMapper{}
+var _ mapper.Lister = &NamespacedMapper{}
+
+// Namespaced returns the mapper of the NamespacedIAMIdentityMappings of m, or
+// nil if they are disabled. Its informer is started and loaded by m.
+func (m *CRDMapper) Namespaced() *NamespacedMapper {
+	if m.namespacedMappingsIndex == nil {
+		return nil
+	}
+	return &NamespacedMapper{crd: m}
+}
+
+func (n *NamespacedMapper) Name() string {
+	return mapper.ModeCRDNamespaced
+}
+
+// Start does nothing, the CRD backend runs the informer.
+func (n *NamespacedMapper) Start(stopCh <-chan struct{}) error {
+	return nil
+}
+
+func (n *NamespacedMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
+	exactARN := canonicalARN
+	canonicalARN = strings.ToLower(canonicalARN)
+	mapping, err := n.crd.mapNamespaced(canonicalARN, exactARN)
+	if err != nil {
+		return nil, err
+	}
+	if mapping == nil {
+		return nil, mapper.ErrNotMapped
+	}
+	return mapping, nil
+}
+
+// List returns the NamespacedIAMIdentityMappings with a valid ARN allowed
+// for their namespace.
+func (n *NamespacedMapper) List() ([]config.IdentityMapping, []string) {
+	return n.crd.listNamespaced(), nil
+}
+
+func (n *NamespacedMapper) IsAccountAllowed(accountID string) (bool, error) {
+	return false, nil
+}
+
+// allowedInNamespace reports whether the NamespacedIAMIdentityMappings of
+// namespace may map canonicalARN, the lowercase form of exactARN.
+func (m *CRDMapper) allowedInNamespace(namespace, canonicalARN, exactARN string) bool {
+	for _, allowed := range m.namespacedARNs[namespace] {
+		candidate := exactARN
+		if !m.strict {
+			allowed, candidate = strings.ToLower(allowed), canonicalARN
+		}
+		if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed {
+			if strings.HasPrefix(candidate, prefix) {
+				return true
+			}
+		} else if canonical, err := arn.Canonicalize(allowed); err == nil && canonical == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// mapNamespaced returns the NamespacedIAMIdentityMapping of canonicalARN, the
+// lowercase form of exactARN, among those of namespaces allowed to map it.
+// When several namespaces map the ARN the first by namespace and name is
+// used, so the result doesn't depend on the informer's order.
+func (m *CRDMapper) mapNamespaced(canonicalARN, exactARN string) (*config.IdentityMapping, error) {
+	objects, err := m.namespacedMappingsIndex.ByIndex("canonicalARN", canonicalARN)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []*iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping
+	for _, obj := range objects {
+		mapping, ok := obj.(*iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping)
+		if !ok || !m.matches(mapping.Spec.ARN, exactARN) {
+			continue
+		}
+		if !m.allowedInNamespace(mapping.Namespace, canonicalARN, exactARN) {
+			logger.WithFields(logrus.Fields{
+				"namespace": mapping.Namespace,
+				"name":      mapping.Name,
+				"arn":       exactARN,
+			}).Debug("ignoring NamespacedIAMIdentityMapping of an ARN not allowed in its namespace")
+			continue
+		}
+		mappings = append(mappings, mapping)
+	}
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Namespace != mappings[j].Namespace {
+			return mappings[i].Namespace < mappings[j].Namespace
+		}
+		return mappings[i].Name < mappings[j].Name
+	})
+	return namespacedIdentityMapping(canonicalARN, mappings[0]), nil
+}
+
+// listNamespaced returns the NamespacedIAMIdentityMappings with a valid ARN
+// allowed for their namespace.
+func (m *CRDMapper) listNamespaced() []config.IdentityMapping {
+	var mappings []config.IdentityMapping
+	for _, obj := range m.namespacedMappingsIndex.List() {
+		keys, _ := IndexNamespacedIAMIdentityMappingByARN(obj)
+		if len(keys) == 0 {
+			continue
+		}
+		mapping := obj.(*iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping)
+		exactARN, _ := arn.Canonicalize(mapping.Spec.ARN)
+		if !m.allowedInNamespace(mapping.Namespace, keys[0], exactARN) {
+			continue
+		}
+		mappings = append(mappings, *namespacedIdentityMapping(keys[0], mapping))
+	}
+	return mappings
+}
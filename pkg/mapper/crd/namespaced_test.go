@@ -0,0 +1,99 @@
+package crd
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/controller"
+)
+
+func TestMapNamespaced(t *testing.T) {
+	clusterIndex := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		"canonicalARN": controller.IndexIAMIdentityMappingByCanonicalArn,
+	})
+	clusterIndex.Add(&iamauthenticatorv1alpha1.IAMIdentityMapping{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+		Spec:       iamauthenticatorv1alpha1.IAMIdentityMappingSpec{ARN: "arn:aws:iam::111122223333:role/Admin", Username: "admin", Groups: []string{"system:masters"}},
+		Status:     iamauthenticatorv1alpha1.IAMIdentityMappingStatus{CanonicalARN: "arn:aws:iam::111122223333:role/admin"},
+	})
+	namespacedIndex := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		"canonicalARN": IndexNamespacedIAMIdentityMappingByARN,
+	})
+	add := func(namespace, name, roleARN, username string, groups ...string) {
+		namespacedIndex.Add(&iamauthenticatorv1alpha1.NamespacedIAMIdentityMapping{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       iamauthenticatorv1alpha1.IAMIdentityMappingSpec{ARN: roleARN, Username: username, Groups: groups},
+		})
+	}
+	add("team-b", "ci", "arn:aws:iam::111122223333:role/CI", "ci", "deployers")
+	add("team-a", "ci", "arn:aws:iam::111122223333:role/CI", "ci", "deployers", "system:masters", "ns:team-a:viewers")
+	add("team-a", "admin", "arn:aws:iam::111122223333:role/Admin", "admin", "system:masters")
+	add("team-a", "invalid", "not-an-arn", "invalid")
+	add("team-a", "deploy", "arn:aws:iam::111122223333:role/team-a/Deploy", "deploy")
+	add("team-b", "escalate", "arn:aws:iam::111122223333:role/Escalate", "escalate")
+	m := NewCRDMapperWithIndexers(clusterIndex, namespacedIndex, map[string][]string{
+		"team-a": {"arn:aws:iam::111122223333:role/CI", "arn:aws:iam::111122223333:role/Admin", "arn:aws:iam::111122223333:role/team-a/*"},
+		"team-b": {"arn:aws:iam::111122223333:role/ci"},
+	})
+	n := m.Namespaced()
+
+	if _, err := m.Map("arn:aws:iam::111122223333:role/CI"); err != mapper.ErrNotMapped {
+		t.Errorf("expected the CRD backend not to map namespaced mappings, got %v", err)
+	}
+	mapping, err := n.Map("arn:aws:iam::111122223333:role/CI")
+	if err != nil {
+		t.Fatalf("expected the namespaced mapping, got %v", err)
+	}
+	if mapping.Username != "ns:team-a:ci" {
+		t.Errorf("expected the username prefixed with the first namespace, got %q", mapping.Username)
+	}
+	expectedGroups := []string{"ns:team-a:deployers", "ns:team-a:system:masters", "ns:team-a:viewers"}
+	if !reflect.DeepEqual(mapping.Groups, expectedGroups) {
+		t.Errorf("expected groups %v, got %v", expectedGroups, mapping.Groups)
+	}
+
+	mapping, err = m.Map("arn:aws:iam::111122223333:role/Admin")
+	if err != nil || mapping.Username != "admin" {
+		t.Errorf("expected the IAMIdentityMapping to map the ARN, got %+v, %v", mapping, err)
+	}
+
+	mapping, err = n.Map("arn:aws:iam::111122223333:role/team-a/Deploy")
+	if err != nil || mapping.Username != "ns:team-a:deploy" {
+		t.Errorf("expected an ARN allowed by prefix to be mapped, got %+v, %v", mapping, err)
+	}
+	if _, err := n.Map("arn:aws:iam::111122223333:role/Escalate"); err != mapper.ErrNotMapped {
+		t.Errorf("expected an ARN not allowed in the namespace to be ignored, got %v", err)
+	}
+	if _, err := n.Map("arn:aws:iam::111122223333:role/Other"); err != mapper.ErrNotMapped {
+		t.Errorf("expected ErrNotMapped, got %v", err)
+	}
+
+	if mappings, _ := m.List(); len(mappings) != 1 {
+		t.Errorf("expected the IAMIdentityMapping, got %+v", mappings)
+	}
+	if mappings, _ := n.List(); len(mappings) != 4 {
+		t.Errorf("expected the 4 valid and allowed namespaced mappings, got %+v", mappings)
+	}
+	if NewCRDMapperWithIndexer(clusterIndex).Namespaced() != nil {
+		t.Errorf("expected no namespaced mapper when they are disabled")
+	}
+}
+
+func TestParseNamespacedMappingARNs(t *testing.T) {
+	allowed, err := ParseNamespacedMappingARNs([]string{"team-a=arn:aws:iam::111122223333:role/CI", "team-a=arn:aws:iam::111122223333:role/team-a/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed["team-a"]) != 2 {
+		t.Errorf("expected both ARNs of team-a, got %v", allowed)
+	}
+	for _, entry := range []string{"team-a", "Team_A=arn:aws:iam::111122223333:role/CI", "team-a=CI"} {
+		if _, err := ParseNamespacedMappingARNs([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
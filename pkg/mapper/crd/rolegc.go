@@ -0,0 +1,191 @@
+package crd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
+	clientset "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/clientset/versioned"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// Actions taken on IAMIdentityMappings of deleted IAM roles.
+const (
+	// RoleGCLabel labels them with RoleDeletedLabel.
+	RoleGCLabel = "label"
+	// RoleGCDelete labels them, then deletes them once their role has been
+	// missing for the grace period.
+	RoleGCDelete = "delete"
+)
+
+// RoleGCActions are the valid actions on mappings of deleted roles.
+var RoleGCActions = []string{RoleGCLabel, RoleGCDelete}
+
+const (
+	// RoleDeletedLabel is set to "true" on the IAMIdentityMappings whose
+	// role doesn't exist, so they can be listed with a label selector.
+	RoleDeletedLabel = "iamauthenticator.k8s.aws/role-deleted"
+	// RoleMissingSinceAnnotation is when the role of an IAMIdentityMapping
+	// was first found missing, in RFC 3339.
+	RoleMissingSinceAnnotation = "iamauthenticator.k8s.aws/role-missing-since"
+)
+
+type roleGetter interface {
+	GetRole(roleName string) (*iamapi.Role, error)
+}
+
+// roleGC finds the IAMIdentityMappings of IAM roles that no longer exist
+// with iam:GetRole, and labels or deletes them. Only roles of the account of
+// the credentials can be described, so mappings of other accounts are left
+// alone.
+type roleGC struct {
+	iam     roleGetter
+	client  clientset.Interface
+	index   cache.Indexer
+	action  string
+	grace   time.Duration
+	now     func() time.Time
+	account func() (string, error)
+}
+
+func newRoleGC(cfg config.Config, client clientset.Interface, index cache.Indexer) *roleGC {
+	return &roleGC{
+		iam:     iamapi.New(cfg.PartitionID, cfg.CRDRoleGCRoleARN),
+		client:  client,
+		index:   index,
+		action:  cfg.CRDRoleGCAction,
+		grace:   cfg.CRDRoleGCGracePeriod,
+		now:     time.Now,
+		account: callerAccount(cfg.PartitionID, cfg.CRDRoleGCRoleARN),
+	}
+}
+
+// callerAccount returns a function returning the account of roleARN, or of
+// the server's credentials if it is empty.
+func callerAccount(partitionID, roleARN string) func() (string, error) {
+	return func() (string, error) {
+		if roleARN != "" {
+			parsed, err := awsarn.Parse(roleARN)
+			if err != nil {
+				return "", err
+			}
+			return parsed.AccountID, nil
+		}
+		sess, err := session.NewSession(aws.NewConfig().WithRegion(iamapi.GlobalRegion(partitionID, endpoints.StsServiceID)))
+		if err != nil {
+			return "", err
+		}
+		identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(identity.Account), nil
+	}
+}
+
+// run checks the role of every IAMIdentityMapping of the account once.
+func (gc *roleGC) run() {
+	account, err := gc.account()
+	if err != nil {
+		logger.WithError(err).Warn("could not look up the account of the credentials, skipping the role garbage collection")
+		return
+	}
+	for _, obj := range gc.index.List() {
+		mapping, ok := obj.(*iamauthenticatorv1alpha1.IAMIdentityMapping)
+		if !ok {
+			continue
+		}
+		if err := gc.check(mapping, account); err != nil {
+			logger.WithError(err).WithField("name", mapping.Name).Warn("could not garbage-collect IAMIdentityMapping")
+		}
+	}
+}
+
+// check labels, unlabels or deletes mapping depending on whether its role in
+// account exists.
+func (gc *roleGC) check(mapping *iamauthenticatorv1alpha1.IAMIdentityMapping, account string) error {
+	roleName, ok := roleOf(mapping.Spec.ARN, account)
+	if !ok {
+		return nil
+	}
+	_, err := gc.iam.GetRole(roleName)
+	if err != nil && !errors.Is(err, iamapi.ErrNoSuchEntity) {
+		return err
+	}
+	log := logger.WithFields(logrus.Fields{"name": mapping.Name, "arn": mapping.Spec.ARN})
+	mappings := gc.client.IamauthenticatorV1alpha1().IAMIdentityMappings()
+
+	if err == nil {
+		if mapping.Labels[RoleDeletedLabel] == "" && mapping.Annotations[RoleMissingSinceAnnotation] == "" {
+			return nil
+		}
+		// the role was recreated
+		updated := mapping.DeepCopy()
+		delete(updated.Labels, RoleDeletedLabel)
+		delete(updated.Annotations, RoleMissingSinceAnnotation)
+		if _, err := mappings.Update(updated); err != nil {
+			return err
+		}
+		log.Info("role of IAMIdentityMapping exists again, removed its role-deleted label")
+		authmetrics.CRDRoleGC.WithLabelValues("unlabel").Inc()
+		return nil
+	}
+
+	missingSince, err := time.Parse(time.RFC3339, mapping.Annotations[RoleMissingSinceAnnotation])
+	if err != nil {
+		updated := mapping.DeepCopy()
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Labels[RoleDeletedLabel] = "true"
+		updated.Annotations[RoleMissingSinceAnnotation] = gc.now().UTC().Format(time.RFC3339)
+		if _, err := mappings.Update(updated); err != nil {
+			return err
+		}
+		log.Warn("role of IAMIdentityMapping doesn't exist, labeled it role-deleted")
+		authmetrics.CRDRoleGC.WithLabelValues(RoleGCLabel).Inc()
+		return nil
+	}
+
+	if gc.action != RoleGCDelete || gc.now().Sub(missingSince) < gc.grace {
+		return nil
+	}
+	err = mappings.Delete(mapping.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &mapping.UID},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	log.WithField("missingSince", missingSince).Warn("role of IAMIdentityMapping doesn't exist, deleted it")
+	authmetrics.CRDRoleGC.WithLabelValues(RoleGCDelete).Inc()
+	return nil
+}
+
+// roleOf returns the name of the IAM role mappingARN maps, if it is a role of
+// account.
+func roleOf(mappingARN, account string) (string, bool) {
+	principal, err := arn.Parse(mappingARN)
+	if err != nil {
+		return "", false
+	}
+	principal = principal.Canonical()
+	if principal.AccountID != account || principal.Type != arn.TypeRole {
+		return "", false
+	}
+	return principal.Name, true
+}
@@ -0,0 +1,118 @@
+package crd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/generated/clientset/versioned/fake"
+)
+
+type fakeRoles struct {
+	existing map[string]bool
+	calls    []string
+}
+
+func (f *fakeRoles) GetRole(roleName string) (*iamapi.Role, error) {
+	f.calls = append(f.calls, roleName)
+	if !f.existing[roleName] {
+		return nil, fmt.Errorf("could not get IAM role %q: %w", roleName, iamapi.ErrNoSuchEntity)
+	}
+	return &iamapi.Role{ARN: "arn:aws:iam::111122223333:role/" + roleName}, nil
+}
+
+func TestRoleGC(t *testing.T) {
+	mapping := func(name, roleARN string) *iamauthenticatorv1alpha1.IAMIdentityMapping {
+		return &iamauthenticatorv1alpha1.IAMIdentityMapping{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name)},
+			Spec:       iamauthenticatorv1alpha1.IAMIdentityMappingSpec{ARN: roleARN, Username: name},
+		}
+	}
+	objects := []*iamauthenticatorv1alpha1.IAMIdentityMapping{
+		mapping("kept", "arn:aws:iam::111122223333:role/Kept"),
+		mapping("gone", "arn:aws:iam::111122223333:role/team/Gone"),
+		mapping("other-account", "arn:aws:iam::444455556666:role/Gone"),
+		mapping("user", "arn:aws:iam::111122223333:user/Alice"),
+	}
+	client := fake.NewSimpleClientset(objects[0], objects[1], objects[2], objects[3])
+	index := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	// sync refreshes the index from the API, like the informer would
+	sync := func() {
+		for _, obj := range index.List() {
+			index.Delete(obj)
+		}
+		list, err := client.IamauthenticatorV1alpha1().IAMIdentityMappings().List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range list.Items {
+			index.Add(&list.Items[i])
+		}
+	}
+	get := func(name string) (*iamauthenticatorv1alpha1.IAMIdentityMapping, error) {
+		return client.IamauthenticatorV1alpha1().IAMIdentityMappings().Get(name, metav1.GetOptions{})
+	}
+
+	roles := &fakeRoles{existing: map[string]bool{"Kept": true}}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	gc := &roleGC{
+		iam:     roles,
+		client:  client,
+		index:   index,
+		action:  RoleGCDelete,
+		grace:   time.Hour,
+		now:     func() time.Time { return now },
+		account: func() (string, error) { return "111122223333", nil },
+	}
+
+	sync()
+	gc.run()
+	if len(roles.calls) != 2 {
+		t.Errorf("expected only the roles of the account to be described, got %v", roles.calls)
+	}
+	gone, err := get("gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gone.Labels[RoleDeletedLabel] != "true" || gone.Annotations[RoleMissingSinceAnnotation] != "2021-06-01T12:00:00Z" {
+		t.Errorf("expected the mapping of the deleted role to be labeled, got %v %v", gone.Labels, gone.Annotations)
+	}
+	if kept, _ := get("kept"); kept.Labels[RoleDeletedLabel] != "" {
+		t.Errorf("expected the mapping of an existing role not to be labeled")
+	}
+
+	// within the grace period, the role is recreated
+	now = now.Add(30 * time.Minute)
+	roles.existing["Gone"] = true
+	sync()
+	gc.run()
+	if gone, _ := get("gone"); gone.Labels[RoleDeletedLabel] != "" || gone.Annotations[RoleMissingSinceAnnotation] != "" {
+		t.Errorf("expected the label of a recreated role to be removed, got %v %v", gone.Labels, gone.Annotations)
+	}
+
+	// the role is deleted again and stays missing for the grace period
+	roles.existing["Gone"] = false
+	sync()
+	gc.run()
+	now = now.Add(59 * time.Minute)
+	sync()
+	gc.run()
+	if _, err := get("gone"); err != nil {
+		t.Errorf("expected the mapping to be kept within the grace period, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	sync()
+	gc.run()
+	if _, err := get("gone"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the mapping to be deleted after the grace period, got %v", err)
+	}
+	if _, err := get("other-account"); err != nil {
+		t.Errorf("expected the mapping of another account to be kept, got %v", err)
+	}
+}
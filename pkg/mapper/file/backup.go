@@ -0,0 +1,49 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+// backupMappings is the format of the backup mapping file: the mapRoles and
+// mapUsers of the server configuration file.
+type backupMappings struct {
+	RoleMappings []config.RoleMapping `json:"mapRoles"`
+	UserMappings []config.UserMapping `json:"mapUsers"`
+}
+
+// NewBackupFileMapper creates a mapper for the break-glass mappings of
+// cfg.BackupMappingFile. The file is read once, so access can be recovered
+// when the in-cluster backends are corrupted, and allows no accounts.
+func NewBackupFileMapper(cfg config.Config) (*FileMapper, error) {
+	data, err := ioutil.ReadFile(cfg.BackupMappingFile)
+	if err != nil {
+		return nil, err
+	}
+	var backup backupMappings
+	if data, err = utilyaml.ToJSON(data); err == nil {
+		err = json.Unmarshal(data, &backup)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", cfg.BackupMappingFile, err)
+	}
+
+	fileCfg := config.Config{
+		PartitionID:       cfg.PartitionID,
+		StrictARNMatching: cfg.StrictARNMatching,
+		RoleMappings:      backup.RoleMappings,
+		UserMappings:      backup.UserMappings,
+	}
+	fileMapper, err := NewFileMapper(fileCfg)
+	if err != nil {
+		return nil, err
+	}
+	fileMapper.name = mapper.ModeBackupFile
+	return fileMapper, nil
+}
@@ -0,0 +1,52 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+func TestNewBackupFileMapper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "break-glass.yaml")
+	data := `
+mapRoles:
+- rolearn: arn:aws:iam::111122223333:role/BreakGlass
+  username: break-glass
+  groups:
+  - system:masters
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewBackupFileMapper(config.Config{PartitionID: "aws", BackupMappingFile: path})
+	if err != nil {
+		t.Fatalf("NewBackupFileMapper: %v", err)
+	}
+	if m.Name() != mapper.ModeBackupFile {
+		t.Errorf("expected the mapper to be named %s, was %s", mapper.ModeBackupFile, m.Name())
+	}
+	mapping, err := m.Map("arn:aws:iam::111122223333:role/BreakGlass")
+	if err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	if mapping.Username != "break-glass" || len(mapping.Groups) != 1 || mapping.Groups[0] != "system:masters" {
+		t.Errorf("unexpected mapping %+v", mapping)
+	}
+	if allowed, _ := m.IsAccountAllowed("111122223333"); allowed {
+		t.Errorf("expected the backup mapping file to allow no accounts")
+	}
+
+	if _, err := NewBackupFileMapper(config.Config{BackupMappingFile: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// mappingFile is the format of the files of cfg.MappingFiles: the mapRoles,
+// mapUsers and mapAccounts of the server configuration file, and the files
+// to include before it.
+type mappingFile struct {
+	Include      []string             `json:"include"`
+	RoleMappings []config.RoleMapping `json:"mapRoles"`
+	UserMappings []config.UserMapping `json:"mapUsers"`
+	Accounts     []string             `json:"mapAccounts"`
+}
+
+// includeLine starts the top-level include directive of a mapping file.
+var includeLine = regexp.MustCompile(`^include\s*:`)
+
+// LoadMappingFiles reads the mappings of the files matching patterns, and of
+// the files they include, returning them in order. Each file is read once,
+// after the files it includes, so it can use the YAML anchors they define:
+// the files are parsed as a single YAML document.
+func LoadMappingFiles(patterns []string) ([]config.RoleMapping, []config.UserMapping, []string, error) {
+	l := &mappingFileLoader{state: map[string]int{}}
+	if err := l.includeAll(patterns, ""); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(l.paths) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	// each file is an item of a list, so the anchors of earlier files are
+	// defined when later ones use them
+	var doc bytes.Buffer
+	for i, path := range l.paths {
+		fmt.Fprintf(&doc, "# %s\n-\n", path)
+		for _, line := range strings.Split(strings.TrimRight(string(l.contents[i]), "\n"), "\n") {
+			doc.WriteString("  " + line + "\n")
+		}
+	}
+	data, err := utilyaml.ToJSON(doc.Bytes())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not parse mapping files %v: %v", l.paths, err)
+	}
+	var files []*mappingFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, nil, nil, fmt.Errorf("could not parse mapping files %v: %v", l.paths, err)
+	}
+	var roles []config.RoleMapping
+	var users []config.UserMapping
+	var accounts []string
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		roles = append(roles, f.RoleMappings...)
+		users = append(users, f.UserMappings...)
+		accounts = append(accounts, f.Accounts...)
+	}
+	return roles, users, accounts, nil
+}
+
+// states of the files of a mappingFileLoader
+const (
+	fileLoading = iota + 1
+	fileLoaded
+)
+
+type mappingFileLoader struct {
+	// paths are the files to parse in order, and contents their contents.
+	paths    []string
+	contents [][]byte
+	// state tracks the files being or already loaded, to read each once and
+	// detect include cycles.
+	state map[string]int
+}
+
+// includeAll loads the files matching patterns, which are relative to dir
+// unless absolute. Globs may match no file, but other paths must exist.
+func (l *mappingFileLoader) includeAll(patterns []string, dir string) error {
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) && dir != "" {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid mapping file pattern %q: %v", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+			return fmt.Errorf("mapping file %s does not exist", pattern)
+		}
+		for _, path := range matches {
+			if err := l.load(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// load loads the files path includes, then path.
+func (l *mappingFileLoader) load(path string) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	switch l.state[path] {
+	case fileLoaded:
+		return nil
+	case fileLoading:
+		return fmt.Errorf("mapping file %s is included in a cycle", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	includes, err := parseIncludes(data)
+	if err != nil {
+		return fmt.Errorf("could not parse the includes of %s: %v", path, err)
+	}
+	l.state[path] = fileLoading
+	if err := l.includeAll(includes, filepath.Dir(path)); err != nil {
+		return err
+	}
+	l.state[path] = fileLoaded
+	l.paths = append(l.paths, path)
+	l.contents = append(l.contents, data)
+	return nil
+}
+
+// parseIncludes returns the include directive of the mapping file data. It is
+// parsed on its own, as the file may use anchors of the files it includes.
+func parseIncludes(data []byte) ([]string, error) {
+	if bytes.HasPrefix(data, []byte("---")) || bytes.Contains(data, []byte("\n---")) {
+		return nil, fmt.Errorf("mapping files must be a single YAML document")
+	}
+	var directive []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if directive == nil {
+			if includeLine.MatchString(line) {
+				directive = []string{line}
+			}
+			continue
+		}
+		// the directive ends at the next top-level key
+		if line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "#") {
+			break
+		}
+		directive = append(directive, line)
+	}
+	if directive == nil {
+		return nil, nil
+	}
+	var f mappingFile
+	jsonData, err := utilyaml.ToJSON([]byte(strings.Join(directive, "\n")))
+	if err == nil {
+		err = json.Unmarshal(jsonData, &f)
+	}
+	return f.Include, err
+}
@@ -0,0 +1,103 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func writeMappingFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mappings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadMappingFiles(t *testing.T) {
+	dir := writeMappingFiles(t, map[string]string{
+		"common.yaml": `
+groups:
+  viewers: &viewers
+  - view
+mapAccounts:
+- "111122223333"
+`,
+		"teams/payments.yaml": `
+include:
+- ../common.yaml
+mapRoles:
+- rolearn: arn:aws:iam::111122223333:role/Payments
+  username: payments
+  groups: *viewers
+`,
+		"teams/search.yaml": `
+include: [../common.yaml]
+mapUsers:
+- userarn: arn:aws:iam::111122223333:user/Alice
+  username: alice
+  groups: *viewers
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	roles, users, accounts, err := LoadMappingFiles([]string{filepath.Join(dir, "teams", "*.yaml"), filepath.Join(dir, "none", "*.yaml")})
+	if err != nil {
+		t.Fatalf("LoadMappingFiles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Username != "payments" || !reflect.DeepEqual(roles[0].Groups, []string{"view"}) {
+		t.Errorf("expected the payments role with the viewers groups, got %+v", roles)
+	}
+	if len(users) != 1 || users[0].Username != "alice" || !reflect.DeepEqual(users[0].Groups, []string{"view"}) {
+		t.Errorf("expected alice with the viewers groups, got %+v", users)
+	}
+	if !reflect.DeepEqual(accounts, []string{"111122223333"}) {
+		t.Errorf("expected the accounts of the common file once, got %v", accounts)
+	}
+
+	m, err := NewFileMapper(config.Config{PartitionID: "aws", MappingFiles: []string{filepath.Join(dir, "teams", "*.yaml")}})
+	if err != nil {
+		t.Fatalf("NewFileMapper: %v", err)
+	}
+	if mapping, err := m.Map("arn:aws:iam::111122223333:role/Payments"); err != nil || mapping.Username != "payments" {
+		t.Errorf("expected the mapping of an included file, got %+v, %v", mapping, err)
+	}
+}
+
+func TestLoadMappingFilesErrors(t *testing.T) {
+	dir := writeMappingFiles(t, map[string]string{
+		"a.yaml":       "include: [b.yaml]\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"missing.yaml": "include: [nowhere.yaml]\n",
+		"alias.yaml":   "mapRoles:\n- rolearn: arn:aws:iam::111122223333:role/X\n  username: x\n  groups: *undefined\n",
+		"multi.yaml":   "mapRoles: []\n---\nmapUsers: []\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for file, want := range map[string]string{
+		"a.yaml":       "included in a cycle",
+		"missing.yaml": "does not exist",
+		"alias.yaml":   "could not parse mapping files",
+		"multi.yaml":   "single YAML document",
+	} {
+		_, _, _, err := LoadMappingFiles([]string{filepath.Join(dir, file)})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", file, want, err)
+		}
+	}
+}
@@ -2,45 +2,79 @@ package file
 
 import (
 	"fmt"
-	"strings"
 
 	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/organizations"
 )
 
 type FileMapper struct {
 	lowercaseRoleMap map[string]config.RoleMapping
 	lowercaseUserMap map[string]config.UserMapping
 	accountMap       map[string]bool
+	// accountCaches hold accounts allowed in addition to accountMap that are
+	// read from a file or listed from Organizations and refreshed
+	// periodically.
+	accountCaches []*mapper.AccountCache
+	// strict disables lowercasing ARNs, so they only match with the same
+	// case.
+	strict bool
+	// name is the name of the mapper, ModeMountedFile if empty.
+	name string
 }
 
 var _ mapper.Mapper = &FileMapper{}
+var _ mapper.Lister = &FileMapper{}
 
 func NewFileMapper(cfg config.Config) (*FileMapper, error) {
 	fileMapper := &FileMapper{
 		lowercaseRoleMap: make(map[string]config.RoleMapping),
 		lowercaseUserMap: make(map[string]config.UserMapping),
 		accountMap:       make(map[string]bool),
+		strict:           cfg.StrictARNMatching,
 	}
 
+	if len(cfg.MappingFiles) > 0 {
+		roles, users, accounts, err := LoadMappingFiles(cfg.MappingFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RoleMappings = append(append([]config.RoleMapping{}, cfg.RoleMappings...), roles...)
+		cfg.UserMappings = append(append([]config.UserMapping{}, cfg.UserMappings...), users...)
+		cfg.AutoMappedAWSAccounts = append(append([]string{}, cfg.AutoMappedAWSAccounts...), accounts...)
+	}
+
+	var arns []string
 	for _, m := range cfg.RoleMappings {
-		canonicalizedARN, err := arn.Canonicalize(strings.ToLower(m.RoleARN))
+		canonicalizedARN, err := arn.CanonicalizeInPartition(mapper.ARNKey(m.RoleARN, cfg.StrictARNMatching), cfg.PartitionID)
 		if err != nil {
 			return nil, fmt.Errorf("error canonicalizing ARN: %v", err)
 		}
 		fileMapper.lowercaseRoleMap[canonicalizedARN] = m
+		arns = append(arns, m.RoleARN)
 	}
 	for _, m := range cfg.UserMappings {
-		canonicalizedARN, err := arn.Canonicalize(strings.ToLower(m.UserARN))
+		canonicalizedARN, err := arn.CanonicalizeInPartition(mapper.ARNKey(m.UserARN, cfg.StrictARNMatching), cfg.PartitionID)
 		if err != nil {
 			return nil, fmt.Errorf("error canonicalizing ARN: %v", err)
 		}
 		fileMapper.lowercaseUserMap[canonicalizedARN] = m
+		arns = append(arns, m.UserARN)
 	}
+	mapper.WarnCaseCollisions(mapper.ModeMountedFile, arns)
 	for _, m := range cfg.AutoMappedAWSAccounts {
 		fileMapper.accountMap[m] = true
 	}
+	if cfg.AccountsFile != "" {
+		fileMapper.accountCaches = append(fileMapper.accountCaches,
+			mapper.NewAccountCache(&mapper.FileAccountSource{Path: cfg.AccountsFile}, cfg.AccountsCacheTTL, cfg.AccountsMaxStale))
+	}
+	if len(cfg.AutoMappedOrganizationalUnits) > 0 {
+		source := organizations.NewAccountSource(cfg.PartitionID, cfg.OrganizationsRoleARN, cfg.AutoMappedOrganizationalUnits)
+		fileMapper.accountCaches = append(fileMapper.accountCaches,
+			mapper.NewAccountCache(source, cfg.OrganizationsRefreshInterval, cfg.AccountsMaxStale))
+	}
 
 	return fileMapper, nil
 }
@@ -57,7 +91,10 @@ func NewFileMapperWithMaps(
 }
 
 func (m *FileMapper) Name() string {
-	return mapper.ModeMountedFile
+	if m.name == "" {
+		return mapper.ModeMountedFile
+	}
+	return m.name
 }
 
 func (m *FileMapper) Start(_ <-chan struct{}) error {
@@ -65,27 +102,79 @@ func (m *FileMapper) Start(_ <-chan struct{}) error {
 }
 
 func (m *FileMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
-	canonicalARN = strings.ToLower(canonicalARN)
+	canonicalARN = mapper.ARNKey(canonicalARN, m.strict)
 
 	if roleMapping, exists := m.lowercaseRoleMap[canonicalARN]; exists {
 		return &config.IdentityMapping{
-			IdentityARN: canonicalARN,
-			Username:    roleMapping.Username,
-			Groups:      roleMapping.Groups,
+			IdentityARN:    canonicalARN,
+			Username:       roleMapping.Username,
+			Groups:         roleMapping.Groups,
+			IdentityExtras: roleMapping.IdentityExtras,
+			NotAfter:       roleMapping.NotAfter,
 		}, nil
 	}
 
 	if userMapping, exists := m.lowercaseUserMap[canonicalARN]; exists {
 		return &config.IdentityMapping{
-			IdentityARN: canonicalARN,
-			Username:    userMapping.Username,
-			Groups:      userMapping.Groups,
+			IdentityARN:     canonicalARN,
+			Username:        userMapping.Username,
+			Groups:          userMapping.Groups,
+			IdentityExtras:  userMapping.IdentityExtras,
+			NotAfter:        userMapping.NotAfter,
+			LookupIAMGroups: userMapping.LookupIAMGroups,
 		}, nil
 	}
 
 	return nil, mapper.ErrNotMapped
 }
 
-func (m *FileMapper) IsAccountAllowed(accountID string) bool {
-	return m.accountMap[accountID]
+// IsAccountAllowed checks mapAccounts and then each account source. An error
+// is only returned if no source allows the account and one of them failed.
+func (m *FileMapper) IsAccountAllowed(accountID string) (bool, error) {
+	if m.accountMap[accountID] {
+		return true, nil
+	}
+	var firstErr error
+	for _, cache := range m.accountCaches {
+		allowed, err := cache.IsAllowed(accountID)
+		if allowed {
+			return true, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return false, firstErr
+}
+
+// List returns the role and user mappings and the accounts of mapAccounts.
+// Accounts from the accounts file aren't included.
+func (m *FileMapper) List() ([]config.IdentityMapping, []string) {
+	var mappings []config.IdentityMapping
+	for arn, rm := range m.lowercaseRoleMap {
+		mappings = append(mappings, config.IdentityMapping{
+			IdentityARN:    arn,
+			Username:       rm.Username,
+			Groups:         rm.Groups,
+			IdentityExtras: rm.IdentityExtras,
+			NotAfter:       rm.NotAfter,
+		})
+	}
+	for arn, um := range m.lowercaseUserMap {
+		mappings = append(mappings, config.IdentityMapping{
+			IdentityARN:     arn,
+			Username:        um.Username,
+			Groups:          um.Groups,
+			IdentityExtras:  um.IdentityExtras,
+			NotAfter:        um.NotAfter,
+			LookupIAMGroups: um.LookupIAMGroups,
+		})
+	}
+	var accounts []string
+	for account, allowed := range m.accountMap {
+		if allowed {
+			accounts = append(accounts, account)
+		}
+	}
+	return mappings, accounts
 }
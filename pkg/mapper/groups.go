@@ -0,0 +1,100 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions taken on mappings from backends other than MountedFile that grant
+// reserved groups.
+const (
+	UnsafeGroupsAllow  = "allow"
+	UnsafeGroupsWarn   = "warn"
+	UnsafeGroupsReject = "reject"
+)
+
+// UnsafeGroupsActions are the valid actions on unsafe groups.
+var UnsafeGroupsActions = []string{UnsafeGroupsAllow, UnsafeGroupsWarn, UnsafeGroupsReject}
+
+// DefaultReservedGroupPrefixes are the groups that can't be granted safely
+// by a backend that is edited in the cluster, as they grant full access to it.
+var DefaultReservedGroupPrefixes = []string{"system:masters"}
+
+// ReservedGroups returns the groups that start with one of prefixes.
+func ReservedGroups(groups, prefixes []string) []string {
+	var reserved []string
+	for _, group := range groups {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(group, prefix) {
+				reserved = append(reserved, group)
+				break
+			}
+		}
+	}
+	return reserved
+}
+
+// Actions taken on identities whose groups exceed the GroupLimits.
+const (
+	// GroupLimitsReject denies the identity.
+	GroupLimitsReject = "reject"
+	// GroupLimitsTruncate drops the groups over the limits. Group names are
+	// never shortened, as a shortened name could be another group.
+	GroupLimitsTruncate = "truncate"
+)
+
+// GroupLimitsActions are the valid actions on groups over the GroupLimits.
+var GroupLimitsActions = []string{GroupLimitsReject, GroupLimitsTruncate}
+
+// GroupLimits bound the groups an identity is authenticated with, so that
+// pathological mappings can't produce TokenReviews the API server struggles
+// with. Zero values are unlimited.
+type GroupLimits struct {
+	// MaxGroups is the maximum number of groups.
+	MaxGroups int
+	// MaxGroupNameLength is the maximum length of a group name in bytes.
+	MaxGroupNameLength int
+	// GroupNamePattern is a regular expression group names must match.
+	GroupNamePattern *regexp.Regexp
+}
+
+// CompileGroupNamePattern compiles pattern to match whole group names. An
+// empty pattern returns nil, which matches every name.
+func CompileGroupNamePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid group name pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// Enabled reports whether any limit is set.
+func (l GroupLimits) Enabled() bool {
+	return l.MaxGroups > 0 || l.MaxGroupNameLength > 0 || l.GroupNamePattern != nil
+}
+
+// Apply returns the groups within the limits and a description of each
+// violation. Groups with invalid names are dropped first, then the groups
+// over MaxGroups, in their order.
+func (l GroupLimits) Apply(groups []string) ([]string, []string) {
+	var kept, violations []string
+	for _, group := range groups {
+		switch {
+		case l.MaxGroupNameLength > 0 && len(group) > l.MaxGroupNameLength:
+			violations = append(violations, fmt.Sprintf("group %q is longer than %d characters", group, l.MaxGroupNameLength))
+		case l.GroupNamePattern != nil && !l.GroupNamePattern.MatchString(group):
+			violations = append(violations, fmt.Sprintf("group %q does not match %s", group, l.GroupNamePattern))
+		default:
+			kept = append(kept, group)
+		}
+	}
+	if l.MaxGroups > 0 && len(kept) > l.MaxGroups {
+		violations = append(violations, fmt.Sprintf("%d groups exceed the maximum of %d", len(kept), l.MaxGroups))
+		kept = kept[:l.MaxGroups]
+	}
+	return kept, violations
+}
@@ -0,0 +1,54 @@
+package mapper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupLimits(t *testing.T) {
+	pattern, err := CompileGroupNamePattern("[a-z:-]+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name           string
+		limits         GroupLimits
+		groups         []string
+		want           []string
+		wantViolations int
+	}{
+		{"unlimited", GroupLimits{}, []string{"a", "b"}, []string{"a", "b"}, 0},
+		{"within limits", GroupLimits{MaxGroups: 2, MaxGroupNameLength: 3, GroupNamePattern: pattern}, []string{"a", "b:c"}, []string{"a", "b:c"}, 0},
+		{"too many", GroupLimits{MaxGroups: 2}, []string{"a", "b", "c"}, []string{"a", "b"}, 1},
+		{"too long", GroupLimits{MaxGroupNameLength: 3}, []string{"abcd", "abc"}, []string{"abc"}, 1},
+		{"invalid characters", GroupLimits{GroupNamePattern: pattern}, []string{"a b", "a", "a\n"}, []string{"a"}, 2},
+		{"invalid names dropped first", GroupLimits{MaxGroups: 1, GroupNamePattern: pattern}, []string{"A", "b", "c"}, []string{"b"}, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, violations := c.limits.Apply(c.groups)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected groups %v, got %v", c.want, got)
+			}
+			if len(violations) != c.wantViolations {
+				t.Errorf("expected %d violations, got %v", c.wantViolations, violations)
+			}
+		})
+	}
+}
+
+func TestCompileGroupNamePattern(t *testing.T) {
+	if re, err := CompileGroupNamePattern(""); re != nil || err != nil {
+		t.Errorf("expected no pattern, got %v, %v", re, err)
+	}
+	re, err := CompileGroupNamePattern("team-[a-z]+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if re.MatchString("x:team-a") || !re.MatchString("team-a") {
+		t.Errorf("expected %s to match whole group names", re)
+	}
+	if _, err := CompileGroupNamePattern("("); err == nil || !strings.Contains(err.Error(), "invalid group name pattern") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+}
@@ -3,12 +3,19 @@ package mapper
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/sirupsen/logrus"
+
 	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 )
 
+var logger = logging.For(logging.ComponentMapper)
+
 const (
 	// Deprecated: use ModeMountedFile instead
 	ModeFile string = "File"
@@ -20,25 +27,111 @@ const (
 	ModeEKSConfigMap string = "EKSConfigMap"
 
 	ModeCRD string = "CRD"
+
+	ModeIAMRoleTags string = "IAMRoleTags"
+
+	ModeEKSAccessEntries string = "EKSAccessEntries"
+
+	// ModeBackupFile is the name of the break-glass mappings of the backup
+	// mapping file, which is consulted after the backends. It can't be
+	// chosen as a backend mode.
+	ModeBackupFile string = "BackupFile"
+
+	// ModeCRDNamespaced is the name of the NamespacedIAMIdentityMappings of
+	// the CRD backend, which are consulted after every other backend. It
+	// can't be chosen as a backend mode.
+	ModeCRDNamespaced string = "CRDNamespaced"
 )
 
 var (
-	ValidBackendModeChoices      = []string{ModeFile, ModeConfigMap, ModeMountedFile, ModeEKSConfigMap, ModeCRD}
+	ValidBackendModeChoices      = []string{ModeFile, ModeConfigMap, ModeMountedFile, ModeEKSConfigMap, ModeCRD, ModeIAMRoleTags, ModeEKSAccessEntries}
 	DeprecatedBackendModeChoices = map[string]string{
 		ModeFile:      ModeMountedFile,
 		ModeConfigMap: ModeEKSConfigMap,
 	}
-	BackendModeChoices = []string{ModeMountedFile, ModeEKSConfigMap, ModeCRD}
+	BackendModeChoices = []string{ModeMountedFile, ModeEKSConfigMap, ModeCRD, ModeIAMRoleTags, ModeEKSAccessEntries}
 )
 
 var ErrNotMapped = errors.New("ARN is not mapped")
 
+// ARNKey returns the arn.Key of canonicalARN, canonicalizing the roles of
+// IAM Identity Center with the SSORoleCanonicalization feature gate.
+func ARNKey(canonicalARN string, strict bool) string {
+	return arn.Key(canonicalARN, strict, config.DefaultFeatureGate.Enabled(config.SSORoleCanonicalization))
+}
+
+// WarnCaseCollisions logs the ARNs mapped by source that differ only by
+// case. Without strict ARN matching only one of them is used; with it they
+// are different identities, which is rarely intended as IAM names are unique
+// regardless of case.
+func WarnCaseCollisions(source string, arns []string) {
+	seen := map[string]string{}
+	for _, arn := range arns {
+		lower := strings.ToLower(arn)
+		if other, ok := seen[lower]; ok && other != arn {
+			logger.WithFields(logrus.Fields{
+				"source": source,
+				"arn":    arn,
+				"other":  other,
+			}).Warn("mapped ARNs differ only by case")
+			continue
+		}
+		seen[lower] = arn
+	}
+}
+
 type Mapper interface {
 	Name() string
 	// Start must be non-blocking
 	Start(stopCh <-chan struct{}) error
 	Map(canonicalARN string) (*config.IdentityMapping, error)
-	IsAccountAllowed(accountID string) bool
+	// IsAccountAllowed reports whether identities from accountID may
+	// authenticate without a mapping. An error means the backend could not
+	// tell, which is not the same as the account not being allowed.
+	IsAccountAllowed(accountID string) (bool, error)
+}
+
+// Loader is implemented by mappers that fetch their mappings from an API. Load
+// fetches them once and returns when they are available, for one-off
+// evaluations such as the verify command that don't Start a watch.
+type Loader interface {
+	Load(stopCh <-chan struct{}) error
+}
+
+// Load loads the mappings of m once if it is a Loader, looking through
+// circuit breakers.
+func Load(m Mapper, stopCh <-chan struct{}) error {
+	if cb, ok := m.(*CircuitBreaker); ok {
+		m = cb.Mapper
+	}
+	if loader, ok := m.(Loader); ok {
+		return loader.Load(stopCh)
+	}
+	return nil
+}
+
+// Lister is implemented by mappers that can list the mappings they currently
+// hold, to show what the server enforces.
+type Lister interface {
+	// List returns the mappings, keyed by lowercase canonical ARN, and the
+	// accounts whose identities may authenticate without a mapping.
+	List() ([]config.IdentityMapping, []string)
+}
+
+// List returns the mappings and accounts of m, or false if m can't list
+// them. Circuit breakers are looked through.
+func List(m Mapper) ([]config.IdentityMapping, []string, bool) {
+	if cb, ok := m.(*CircuitBreaker); ok {
+		m = cb.Mapper
+	}
+	l, ok := m.(Lister)
+	if !ok {
+		return nil, nil, false
+	}
+	mappings, accounts := l.List()
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].IdentityARN < mappings[j].IdentityARN })
+	sort.Strings(accounts)
+	return mappings, accounts, true
 }
 
 func ValidateBackendMode(modes []string) []error {
@@ -53,7 +146,7 @@ func ValidateBackendMode(modes []string) []error {
 
 	for _, mode := range modes {
 		if replacementMode, ok := DeprecatedBackendModeChoices[mode]; ok {
-			logrus.Warningf("warning: backend-mode %q is deprecated, use %q instead", mode, replacementMode)
+			logger.Warningf("warning: backend-mode %q is deprecated, use %q instead", mode, replacementMode)
 		}
 	}
 
@@ -57,3 +57,28 @@ func TestValidateBackendMode(t *testing.T) {
 		})
 	}
 }
+
+func TestARNKeySSORoleCanonicalization(t *testing.T) {
+	ssoRole := "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/eu-west-1/AWSReservedSSO_Admin_0123456789abcdef"
+	if got := ARNKey(ssoRole, true); got != ssoRole {
+		t.Errorf("expected the path to be kept without the feature gate, got %s", got)
+	}
+
+	if err := config.DefaultFeatureGate.Set("SSORoleCanonicalization=true"); err != nil {
+		t.Fatal(err)
+	}
+	defer config.DefaultFeatureGate.Set("SSORoleCanonicalization=false")
+	for _, tc := range []struct {
+		arn    string
+		strict bool
+		want   string
+	}{
+		{ssoRole, true, "arn:aws:iam::123456789012:role/AWSReservedSSO_Admin_0123456789abcdef"},
+		{ssoRole, false, "arn:aws:iam::123456789012:role/awsreservedsso_admin_0123456789abcdef"},
+		{"arn:aws:iam::123456789012:role/team/Admin", true, "arn:aws:iam::123456789012:role/team/Admin"},
+	} {
+		if got := ARNKey(tc.arn, tc.strict); got != tc.want {
+			t.Errorf("ARNKey(%s, %v) = %s, want %s", tc.arn, tc.strict, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package roletags
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+var logger = logging.For(logging.ComponentMapper)
+
+const (
+	// UsernameTag is the tag of an IAM role holding the Kubernetes username
+	// of the role. Roles without it aren't mapped.
+	UsernameTag = "kubernetes/username"
+	// GroupsTag is the tag of an IAM role holding its Kubernetes groups,
+	// separated by spaces as IAM tag values can't contain commas.
+	GroupsTag = "kubernetes/groups"
+)
+
+// reservedPrefix starts the users and groups of Kubernetes components, which
+// tags may only grant if they are allowed explicitly.
+const reservedPrefix = "system:"
+
+type roleGetter interface {
+	GetRole(roleName string) (*iamapi.Role, error)
+}
+
+// RoleTagsMapper maps IAM roles by their tags, describing each role with
+// iam:GetRole the first time it authenticates. Only roles of the account of
+// the server's credentials, or of the assumed RoleTagsRoleARN, can be
+// described.
+type RoleTagsMapper struct {
+	iam           roleGetter
+	partition     string
+	allowedGroups sets.String
+	cacheTTL      time.Duration
+	// negativeCacheTTL is how long roles that aren't mapped are remembered,
+	// so unmapped roles don't call IAM on every request.
+	negativeCacheTTL time.Duration
+	now              func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	// mapping is nil if the role isn't mapped.
+	mapping *config.IdentityMapping
+	expires time.Time
+}
+
+var _ mapper.Mapper = &RoleTagsMapper{}
+
+func NewRoleTagsMapper(cfg config.Config) (*RoleTagsMapper, error) {
+	return newRoleTagsMapper(iamapi.New(cfg.PartitionID, cfg.RoleTagsRoleARN), cfg), nil
+}
+
+func newRoleTagsMapper(iam roleGetter, cfg config.Config) *RoleTagsMapper {
+	m := &RoleTagsMapper{
+		iam:              iam,
+		partition:        cfg.PartitionID,
+		cacheTTL:         cfg.RoleTagsCacheTTL,
+		negativeCacheTTL: cfg.RoleTagsNegativeCacheTTL,
+		now:              time.Now,
+		cache:            map[string]cacheEntry{},
+	}
+	if len(cfg.RoleTagsAllowedGroups) > 0 {
+		m.allowedGroups = sets.NewString(cfg.RoleTagsAllowedGroups...)
+	}
+	return m
+}
+
+func (m *RoleTagsMapper) Name() string {
+	return mapper.ModeIAMRoleTags
+}
+
+func (m *RoleTagsMapper) Start(_ <-chan struct{}) error {
+	return nil
+}
+
+func (m *RoleTagsMapper) Map(canonicalARN string) (*config.IdentityMapping, error) {
+	canonicalARN = strings.ToLower(canonicalARN)
+	principal, err := arn.Parse(canonicalARN)
+	if err != nil || principal.Type != arn.TypeRole {
+		return nil, mapper.ErrNotMapped
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	entry, ok := m.cache[canonicalARN]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		if entry.mapping == nil {
+			return nil, mapper.ErrNotMapped
+		}
+		return entry.mapping, nil
+	}
+
+	role, err := m.iam.GetRole(principal.Name)
+	if err != nil && !errors.Is(err, iamapi.ErrNoSuchEntity) {
+		return nil, err
+	}
+	var mapping *config.IdentityMapping
+	if err == nil {
+		mapping = m.mappingFor(canonicalARN, role)
+	}
+
+	ttl := m.cacheTTL
+	if mapping == nil {
+		ttl = m.negativeCacheTTL
+	}
+	if ttl > 0 {
+		m.mu.Lock()
+		m.cache[canonicalARN] = cacheEntry{mapping: mapping, expires: now.Add(ttl)}
+		m.mu.Unlock()
+	}
+	if mapping == nil {
+		return nil, mapper.ErrNotMapped
+	}
+	return mapping, nil
+}
+
+// mappingFor returns the mapping of the tags of role, or nil if role isn't
+// canonicalARN or isn't tagged with a username that may be granted.
+func (m *RoleTagsMapper) mappingFor(canonicalARN string, role *iamapi.Role) *config.IdentityMapping {
+	// GetRole only takes a name, so a role of the same name in the
+	// server's account must not map a role of another account. Canonical
+	// ARNs of assumed roles don't have the path of the role.
+	principal, err := arn.Parse(role.ARN)
+	if err != nil || (m.partition != "" && principal.Partition != m.partition) {
+		return nil
+	}
+	if strings.ToLower(principal.WithoutPath().String()) != canonicalARN {
+		return nil
+	}
+	username := strings.TrimSpace(role.Tags[UsernameTag])
+	if username == "" {
+		return nil
+	}
+	log := logger.WithField("arn", canonicalARN)
+	if strings.HasPrefix(username, reservedPrefix) {
+		log.WithField("username", username).Warnf("ignoring role tags, %s may not grant a %s username", UsernameTag, reservedPrefix)
+		return nil
+	}
+	var groups []string
+	for _, group := range strings.Fields(role.Tags[GroupsTag]) {
+		if !m.groupAllowed(group) {
+			log.WithField("group", group).Warnf("ignoring group of %s tag that isn't allowed", GroupsTag)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return &config.IdentityMapping{
+		IdentityARN: canonicalARN,
+		Username:    username,
+		Groups:      groups,
+	}
+}
+
+// groupAllowed reports whether tags may grant group. Without a list of
+// allowed groups, any group but those of Kubernetes components is.
+func (m *RoleTagsMapper) groupAllowed(group string) bool {
+	if m.allowedGroups != nil {
+		return m.allowedGroups.Has(group)
+	}
+	return !strings.HasPrefix(group, reservedPrefix)
+}
+
+func (m *RoleTagsMapper) IsAccountAllowed(accountID string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,138 @@
+package roletags
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+type fakeIAM struct {
+	roles map[string]*iamapi.Role
+	err   error
+	calls int
+}
+
+func (f *fakeIAM) GetRole(roleName string) (*iamapi.Role, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil, iamapi.ErrNoSuchEntity
+	}
+	return role, nil
+}
+
+func testMapper(iam *fakeIAM, allowedGroups ...string) *RoleTagsMapper {
+	return newRoleTagsMapper(iam, config.Config{
+		PartitionID:              "aws",
+		RoleTagsCacheTTL:         5 * time.Minute,
+		RoleTagsNegativeCacheTTL: time.Minute,
+		RoleTagsAllowedGroups:    allowedGroups,
+	})
+}
+
+func TestMap(t *testing.T) {
+	iam := &fakeIAM{roles: map[string]*iamapi.Role{
+		"dev": {
+			ARN:  "arn:aws:iam::111122223333:role/teams/Dev",
+			Tags: map[string]string{UsernameTag: "dev", GroupsTag: "developers  viewers system:masters"},
+		},
+		"untagged": {ARN: "arn:aws:iam::111122223333:role/Untagged"},
+		"admin": {
+			ARN:  "arn:aws:iam::111122223333:role/Admin",
+			Tags: map[string]string{UsernameTag: "system:admin"},
+		},
+	}}
+	m := testMapper(iam)
+
+	mapping, err := m.Map("arn:aws:iam::111122223333:role/Dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &config.IdentityMapping{
+		IdentityARN: "arn:aws:iam::111122223333:role/dev",
+		Username:    "dev",
+		Groups:      []string{"developers", "viewers"},
+	}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("expected %+v, got %+v", expected, mapping)
+	}
+
+	for _, canonicalARN := range []string{
+		"arn:aws:iam::111122223333:role/untagged",
+		"arn:aws:iam::111122223333:role/admin",
+		"arn:aws:iam::111122223333:role/missing",
+		"arn:aws:iam::444455556666:role/dev",
+		"arn:aws:iam::111122223333:user/dev",
+	} {
+		if _, err := m.Map(canonicalARN); err != mapper.ErrNotMapped {
+			t.Errorf("%s: expected ErrNotMapped, got %v", canonicalARN, err)
+		}
+	}
+}
+
+func TestMapAllowedGroups(t *testing.T) {
+	iam := &fakeIAM{roles: map[string]*iamapi.Role{
+		"ops": {
+			ARN:  "arn:aws:iam::111122223333:role/Ops",
+			Tags: map[string]string{UsernameTag: "ops", GroupsTag: "system:masters developers"},
+		},
+	}}
+	mapping, err := testMapper(iam, "system:masters").Map("arn:aws:iam::111122223333:role/ops")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"system:masters"}; !reflect.DeepEqual(mapping.Groups, expected) {
+		t.Errorf("expected groups %v, got %v", expected, mapping.Groups)
+	}
+}
+
+func TestMapCache(t *testing.T) {
+	iam := &fakeIAM{roles: map[string]*iamapi.Role{
+		"dev": {
+			ARN:  "arn:aws:iam::111122223333:role/Dev",
+			Tags: map[string]string{UsernameTag: "dev"},
+		},
+	}}
+	m := testMapper(iam)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.Map("arn:aws:iam::111122223333:role/dev"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := m.Map("arn:aws:iam::111122223333:role/missing"); err != mapper.ErrNotMapped {
+			t.Fatalf("expected ErrNotMapped, got %v", err)
+		}
+	}
+	if iam.calls != 2 {
+		t.Errorf("expected 2 calls to IAM, got %d", iam.calls)
+	}
+
+	// The negative cache expires first.
+	now = now.Add(2 * time.Minute)
+	m.Map("arn:aws:iam::111122223333:role/dev")
+	m.Map("arn:aws:iam::111122223333:role/missing")
+	if iam.calls != 3 {
+		t.Errorf("expected 3 calls to IAM, got %d", iam.calls)
+	}
+
+	// Errors other than a missing role aren't cached.
+	now = now.Add(10 * time.Minute)
+	iam.err = errors.New("throttled")
+	if _, err := m.Map("arn:aws:iam::111122223333:role/dev"); err == nil || err == mapper.ErrNotMapped {
+		t.Errorf("expected the IAM error, got %v", err)
+	}
+	iam.err = nil
+	if _, err := m.Map("arn:aws:iam::111122223333:role/dev"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mapper
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// Snapshot is the merged view of the mappings and accounts of a chain of
+// mappers, attributed to the backend each came from.
+type Snapshot struct {
+	Roles    []SnapshotMapping `json:"roles" yaml:"roles"`
+	Users    []SnapshotMapping `json:"users" yaml:"users"`
+	Accounts []SnapshotAccount `json:"accounts" yaml:"accounts"`
+	// UnlistedBackends are the backends of the chain that can't list their
+	// mappings, so the snapshot doesn't include them.
+	UnlistedBackends []string `json:"unlistedBackends,omitempty" yaml:"unlistedBackends,omitempty"`
+}
+
+// SnapshotMapping is a role or user mapping of a backend.
+type SnapshotMapping struct {
+	// ARN is the lowercase canonical ARN the mapping applies to.
+	ARN            string   `json:"arn" yaml:"arn"`
+	Username       string   `json:"username" yaml:"username"`
+	Groups         []string `json:"groups" yaml:"groups"`
+	IdentityExtras *bool    `json:"identityExtras,omitempty" yaml:"identityExtras,omitempty"`
+	// LookupIAMGroups adds the IAM groups of the user to Groups.
+	LookupIAMGroups bool `json:"lookupIAMGroups,omitempty" yaml:"lookupIAMGroups,omitempty"`
+	// NotAfter is when the mapping expires, if ever.
+	NotAfter *time.Time `json:"notAfter,omitempty" yaml:"notAfter,omitempty"`
+	// Source is the backend the mapping comes from.
+	Source string `json:"source" yaml:"source"`
+	// ShadowedBy is the earlier backend in the chain that maps the ARN, or
+	// allows its account, first, so this mapping is never used. Empty if
+	// the mapping is in effect.
+	ShadowedBy string `json:"shadowedBy,omitempty" yaml:"shadowedBy,omitempty"`
+}
+
+// SnapshotAccount is an account a backend allows to authenticate without a
+// mapping.
+type SnapshotAccount struct {
+	AccountID string `json:"accountID" yaml:"accountID"`
+	Source    string `json:"source" yaml:"source"`
+}
+
+// NewSnapshot lists the mappings and accounts of mappers, marking the
+// mappings that the order of the chain shadows.
+func NewSnapshot(mappers []Mapper) *Snapshot {
+	snapshot := &Snapshot{
+		Roles:    []SnapshotMapping{},
+		Users:    []SnapshotMapping{},
+		Accounts: []SnapshotAccount{},
+	}
+	// the first backend to map each ARN or allow each account wins
+	mappedBy := map[string]string{}
+	allowedBy := map[string]string{}
+	for _, m := range mappers {
+		mappings, accounts, ok := List(m)
+		if !ok {
+			snapshot.UnlistedBackends = append(snapshot.UnlistedBackends, m.Name())
+			continue
+		}
+		for _, mapping := range mappings {
+			entry := SnapshotMapping{
+				ARN:             mapping.IdentityARN,
+				Username:        mapping.Username,
+				Groups:          mapping.Groups,
+				IdentityExtras:  mapping.IdentityExtras,
+				LookupIAMGroups: mapping.LookupIAMGroups,
+				NotAfter:        mapping.NotAfter,
+				Source:          m.Name(),
+			}
+			if source, ok := mappedBy[mapping.IdentityARN]; ok {
+				entry.ShadowedBy = source
+			} else if source, ok := allowedBy[arnAccountID(mapping.IdentityARN)]; ok {
+				entry.ShadowedBy = source
+			}
+			if strings.Contains(mapping.IdentityARN, ":user/") {
+				snapshot.Users = append(snapshot.Users, entry)
+			} else {
+				snapshot.Roles = append(snapshot.Roles, entry)
+			}
+		}
+		// accounts only shadow the mappings of later backends
+		for _, mapping := range mappings {
+			if _, ok := mappedBy[mapping.IdentityARN]; !ok {
+				mappedBy[mapping.IdentityARN] = m.Name()
+			}
+		}
+		for _, account := range accounts {
+			snapshot.Accounts = append(snapshot.Accounts, SnapshotAccount{AccountID: account, Source: m.Name()})
+			if _, ok := allowedBy[account]; !ok {
+				allowedBy[account] = m.Name()
+			}
+		}
+	}
+	return snapshot
+}
+
+// Conflict is a mapping of an ARN that a mapping in an earlier backend
+// shadows with a different username, groups or identity extras setting.
+type Conflict struct {
+	// Shadowed is the mapping that is not used.
+	Shadowed SnapshotMapping
+	// Winner is the mapping used instead.
+	Winner SnapshotMapping
+}
+
+// Conflicts returns the mappings of the snapshot that are shadowed by a
+// different mapping of the same ARN. Duplicates that map an ARN the same way
+// in several backends aren't conflicts.
+func (s *Snapshot) Conflicts() []Conflict {
+	var conflicts []Conflict
+	for _, entries := range [][]SnapshotMapping{s.Roles, s.Users} {
+		winners := map[string]SnapshotMapping{}
+		for _, entry := range entries {
+			if entry.ShadowedBy == "" {
+				winners[entry.ARN] = entry
+			}
+		}
+		for _, entry := range entries {
+			winner, ok := winners[entry.ARN]
+			if entry.ShadowedBy == "" || !ok || sameMapping(entry, winner) {
+				continue
+			}
+			conflicts = append(conflicts, Conflict{Shadowed: entry, Winner: winner})
+		}
+	}
+	return conflicts
+}
+
+// UsernameCollisions returns the static usernames that the mappings in
+// effect, across all backends, map several ARNs to.
+func (s *Snapshot) UsernameCollisions() []UsernameCollision {
+	var mappings []config.IdentityMapping
+	for _, entries := range [][]SnapshotMapping{s.Roles, s.Users} {
+		for _, entry := range entries {
+			if entry.ShadowedBy == "" {
+				mappings = append(mappings, config.IdentityMapping{IdentityARN: entry.ARN, Username: entry.Username})
+			}
+		}
+	}
+	return UsernameCollisions(mappings)
+}
+
+// sameMapping reports whether a and b map to the same user.
+func sameMapping(a, b SnapshotMapping) bool {
+	if a.Username != b.Username || len(a.Groups) != len(b.Groups) {
+		return false
+	}
+	for i := range a.Groups {
+		if a.Groups[i] != b.Groups[i] {
+			return false
+		}
+	}
+	return a.LookupIAMGroups == b.LookupIAMGroups && reflect.DeepEqual(a.IdentityExtras, b.IdentityExtras)
+}
+
+// arnAccountID returns the account ID field of arn.
+func arnAccountID(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[4]
+}
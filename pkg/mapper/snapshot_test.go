@@ -0,0 +1,56 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+type listMapper struct {
+	fakeMapper
+	name     string
+	mappings []config.IdentityMapping
+	accounts []string
+}
+
+func (m *listMapper) Name() string { return m.name }
+func (m *listMapper) List() ([]config.IdentityMapping, []string) {
+	return m.mappings, m.accounts
+}
+
+func TestNewSnapshot(t *testing.T) {
+	first := &listMapper{
+		name: "first",
+		mappings: []config.IdentityMapping{
+			{IdentityARN: "arn:aws:iam::111122223333:role/admin", Username: "admin"},
+		},
+		accounts: []string{"444455556666"},
+	}
+	second := &listMapper{
+		name: "second",
+		mappings: []config.IdentityMapping{
+			{IdentityARN: "arn:aws:iam::111122223333:user/bob", Username: "bob", Groups: []string{"dev"}},
+			{IdentityARN: "arn:aws:iam::111122223333:role/admin", Username: "other"},
+			{IdentityARN: "arn:aws:iam::444455556666:role/ci", Username: "ci"},
+		},
+	}
+	snapshot := NewSnapshot([]Mapper{first, NewCircuitBreaker(second, 1, time.Minute), &fakeMapper{}})
+
+	expected := &Snapshot{
+		Roles: []SnapshotMapping{
+			{ARN: "arn:aws:iam::111122223333:role/admin", Username: "admin", Source: "first"},
+			{ARN: "arn:aws:iam::111122223333:role/admin", Username: "other", Source: "second", ShadowedBy: "first"},
+			{ARN: "arn:aws:iam::444455556666:role/ci", Username: "ci", Source: "second", ShadowedBy: "first"},
+		},
+		Users: []SnapshotMapping{
+			{ARN: "arn:aws:iam::111122223333:user/bob", Username: "bob", Groups: []string{"dev"}, Source: "second"},
+		},
+		Accounts:         []SnapshotAccount{{AccountID: "444455556666", Source: "first"}},
+		UnlistedBackends: []string{"fake"},
+	}
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("expected %+v, got %+v", expected, snapshot)
+	}
+}
@@ -0,0 +1,86 @@
+package mapper
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// LoadStatus describes the last loads of the mappings of a backend.
+type LoadStatus struct {
+	// LastSuccessfulLoad is when the mappings were last loaded without
+	// errors, or zero if they never were.
+	LastSuccessfulLoad time.Time `json:"lastSuccessfulLoad"`
+	// Generation identifies the version of the mappings last loaded without
+	// errors, such as the resourceVersion of the aws-auth ConfigMap.
+	Generation string `json:"generation,omitempty"`
+	// LastError is the error of the last load if it failed, in which case
+	// the mappings may be stale or incomplete.
+	LastError string `json:"lastError,omitempty"`
+	// LastErrorTime is when the last load failed.
+	LastErrorTime time.Time `json:"lastErrorTime"`
+}
+
+// StatusReporter is implemented by mappers that track when their mappings
+// were loaded.
+type StatusReporter interface {
+	LoadStatus() LoadStatus
+}
+
+// Status returns the load status of m, or false if m doesn't track it.
+// Circuit breakers are looked through.
+func Status(m Mapper) (LoadStatus, bool) {
+	if cb, ok := m.(*CircuitBreaker); ok {
+		m = cb.Mapper
+	}
+	r, ok := m.(StatusReporter)
+	if !ok {
+		return LoadStatus{}, false
+	}
+	return r.LoadStatus(), true
+}
+
+// LoadTracker records the load status of a backend and exports it as
+// metrics. The zero value is not usable; use NewLoadTracker.
+type LoadTracker struct {
+	backend string
+
+	mu     sync.Mutex
+	status LoadStatus
+}
+
+// NewLoadTracker returns a LoadTracker for backend.
+func NewLoadTracker(backend string) *LoadTracker {
+	return &LoadTracker{backend: backend}
+}
+
+// Succeeded records a load of generation without errors.
+func (t *LoadTracker) Succeeded(generation string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = LoadStatus{LastSuccessfulLoad: now, Generation: generation}
+	metrics.MappingsLastLoad.WithLabelValues(t.backend).Set(float64(now.Unix()))
+	// resourceVersions are opaque, but etcd's are integers, which is enough
+	// to tell on a dashboard whether all the replicas loaded the same one
+	if g, err := strconv.ParseFloat(generation, 64); err == nil {
+		metrics.MappingsGeneration.WithLabelValues(t.backend).Set(g)
+	}
+}
+
+// Failed records a load that failed with err. The last successful load is
+// kept, so stale mappings can be alerted on.
+func (t *LoadTracker) Failed(err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = err.Error()
+	t.status.LastErrorTime = now
+}
+
+// LoadStatus returns the recorded status.
+func (t *LoadTracker) LoadStatus() LoadStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
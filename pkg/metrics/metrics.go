@@ -0,0 +1,394 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the prometheus collectors shared by the server,
+// token verifier and mapper backends.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace for the AWS IAM Authenticator's metrics
+const Namespace = "aws_iam_authenticator"
+
+// Results for the MappingLookups, STSCacheLookups, IAMGroupLookups and
+// RoleInfoLookups counters
+const (
+	LookupHit   = "hit"
+	LookupMiss  = "miss"
+	LookupError = "error"
+)
+
+// Reasons for the WatchRestarts counter
+const (
+	WatchRestartClosed = "closed"
+	WatchRestartError  = "watch_error"
+	WatchRestartIdle   = "idle"
+	WatchRestartFailed = "establish_failed"
+)
+
+// Reasons for the TokenReplays counter
+const (
+	ReplaySourceChanged = "source_changed"
+	ReplayMaxUses       = "max_uses"
+)
+
+// Results for the AccountAllowlistRefreshes counter
+const (
+	RefreshSuccess = "success"
+	RefreshError   = "error"
+)
+
+// Caches for the SharedCacheErrors counter
+const (
+	SharedCacheSTS    = "sts"
+	SharedCacheReplay = "replay"
+)
+
+// Results for the ShadowMappingComparisons counter
+const (
+	ShadowMatch    = "match"
+	ShadowMismatch = "mismatch"
+	ShadowLiveOnly = "live_only"
+	ShadowOnly     = "shadow_only"
+	ShadowSkipped  = "skipped"
+)
+
+// Results for the AWSAuthValidations counter
+const (
+	AWSAuthAllowed  = "allowed"
+	AWSAuthRejected = "rejected"
+)
+
+// Results for the PostMappingHookCalls counter
+const (
+	HookAllowed = "allowed"
+	HookDenied  = "denied"
+	HookError   = "error"
+)
+
+var (
+	// MappingLookups counts identity lookups by backend and result (hit,
+	// miss or error).
+	MappingLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "mapping_lookups_total",
+		Help:      "Identity mapping lookups by backend and result",
+	}, []string{"backend", "result"})
+
+	// STSLatency is the latency of sts:GetCallerIdentity calls made while
+	// verifying tokens, by HTTP status code ("error" if no response).
+	STSLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "sts_request_latency_seconds",
+		Help:      "The latency of sts:GetCallerIdentity calls",
+	}, []string{"status"})
+
+	// STSRetries counts retried sts:GetCallerIdentity calls by why they
+	// were retried: "throttled" or "server_error".
+	STSRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sts_retries_total",
+		Help:      "Retried sts:GetCallerIdentity calls by reason",
+	}, []string{"reason"})
+
+	// TokenVerificationErrors counts rejected tokens by reason.
+	TokenVerificationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "token_verification_errors_total",
+		Help:      "Tokens that failed verification by reason",
+	}, []string{"reason"})
+
+	// AuthenticationFailures counts failed authentications by the reason
+	// code reported in their responses.
+	AuthenticationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "authentication_failures_total",
+		Help:      "Failed authentications by reason code",
+	}, []string{"reason"})
+
+	// ConfigMapParseErrors counts aws-auth ConfigMap updates that could not be
+	// fully parsed.
+	ConfigMapParseErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "configmap_parse_errors_total",
+		Help:      "aws-auth ConfigMap updates that failed to parse",
+	})
+
+	// ConfigMapSize is the size in bytes of the aws-auth ConfigMap data, to
+	// track how close it is to the 1MiB ConfigMap limit.
+	ConfigMapSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "configmap_size_bytes",
+		Help:      "Size of the aws-auth ConfigMap data in bytes",
+	})
+
+	// RateLimitedRequests counts authenticate requests rejected with 429 by
+	// the limit that was hit (global, source or in_flight).
+	RateLimitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Authenticate requests rejected by rate or concurrency limits",
+	}, []string{"limit"})
+
+	// WatchRestarts counts re-establishments of the aws-auth ConfigMap watch
+	// by the reason the previous watch ended.
+	WatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "configmap_watch_restarts_total",
+		Help:      "Restarts of the aws-auth ConfigMap watch by reason",
+	}, []string{"reason"})
+
+	// ShadowMappingComparisons counts shadow mapping evaluations by how they
+	// compared to the live mapping.
+	ShadowMappingComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "shadow_mapping_comparisons_total",
+		Help:      "Shadow mapping evaluations by comparison with the live mapping",
+	}, []string{"result"})
+
+	// AccountAllowlistRefreshes counts fetches of dynamic account allowlists
+	// by source and result.
+	AccountAllowlistRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "account_allowlist_refreshes_total",
+		Help:      "Fetches of account allowlists by source and result",
+	}, []string{"source", "result"})
+
+	// AWSAuthValidations counts admission reviews of the aws-auth ConfigMap
+	// by result.
+	AWSAuthValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "aws_auth_validations_total",
+		Help:      "Admission reviews of the aws-auth ConfigMap by result",
+	}, []string{"result"})
+
+	// TokenClusterIDs counts verified tokens by the cluster ID they were
+	// signed for, when more than one cluster ID is accepted.
+	TokenClusterIDs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "token_cluster_id_total",
+		Help:      "Verified tokens by the cluster ID they were signed for",
+	}, []string{"cluster_id"})
+
+	// STSCacheLookups counts lookups in the verifier's cache of STS
+	// responses, by whether the token was found.
+	STSCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sts_cache_lookups_total",
+		Help:      "Lookups in the cache of STS GetCallerIdentity responses by result",
+	}, []string{"result"})
+
+	// TokenReplays counts verified tokens rejected as replayed, by reason.
+	TokenReplays = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "token_replays_total",
+		Help:      "Tokens rejected by replay detection by reason",
+	}, []string{"reason"})
+
+	// NegativeCacheHits counts tokens rejected because their identity was
+	// recently found unmapped, without verifying them with STS again.
+	NegativeCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "negative_cache_hits_total",
+		Help:      "Tokens rejected from the cache of unmapped identities",
+	})
+
+	// UnsafeGroupMappings counts identities mapped to reserved groups by a
+	// backend other than MountedFile, by backend and action taken.
+	UnsafeGroupMappings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "unsafe_group_mappings_total",
+		Help:      "Identities mapped to reserved groups by in-cluster backends by backend and action",
+	}, []string{"backend", "action"})
+
+	// GroupLimitViolations counts identities whose groups exceeded the group
+	// limits, by action taken.
+	GroupLimitViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "group_limit_violations_total",
+		Help:      "Identities whose groups exceeded the group limits by action",
+	}, []string{"action"})
+
+	// MappingChanges counts the mappings and accounts added, removed or
+	// changed by reloads of each backend.
+	MappingChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "mapping_changes_total",
+		Help:      "Mappings and accounts added, removed or changed by backend reloads by backend and change",
+	}, []string{"backend", "change"})
+
+	// ExpiredMappings counts lookups that found a mapping past its notAfter
+	// time, which is ignored, by backend.
+	ExpiredMappings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "expired_mappings_total",
+		Help:      "Lookups that ignored a mapping past its notAfter time by backend",
+	}, []string{"backend"})
+
+	// MappingAssertionFailures counts the revisions of the aws-auth mappings
+	// that weren't activated because they failed the mapping assertions.
+	MappingAssertionFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "mapping_assertion_failures_total",
+		Help:      "Revisions of the aws-auth mappings not activated because they failed the mapping assertions",
+	})
+
+	// ConfigMapDeleted is 1 while the aws-auth ConfigMap is deleted, whether
+	// its last mappings are still kept or were dropped.
+	ConfigMapDeleted = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "configmap_deleted",
+		Help:      "1 while the aws-auth ConfigMap is deleted",
+	})
+
+	// APIServerDegraded is 1 while the API server has been unreachable for
+	// longer than the outage threshold and the last known good aws-auth
+	// mappings are served.
+	APIServerDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "configmap_api_server_degraded",
+		Help:      "1 while the API server is unreachable and the last known good aws-auth mappings are served",
+	})
+
+	// MappingsLastLoad is the time the mappings of each backend were last
+	// loaded without errors, to alert on mappings left stale by parse
+	// failures.
+	MappingsLastLoad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "mappings_last_load_timestamp_seconds",
+		Help:      "Unix time the mappings of the backend were last loaded without errors",
+	}, []string{"backend"})
+
+	// MappingsGeneration is the resourceVersion of the mappings last loaded
+	// without errors by each backend, when it is numeric.
+	MappingsGeneration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "mappings_generation",
+		Help:      "resourceVersion of the mappings the backend last loaded without errors",
+	}, []string{"backend"})
+
+	// IAMGroupLookups counts lookups of the IAM groups of mapped users, by
+	// whether they were cached.
+	IAMGroupLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "iam_group_lookups_total",
+		Help:      "Lookups of the IAM groups of mapped IAM users by result",
+	}, []string{"result"})
+
+	// RoleInfoLookups counts lookups of the description and tags of the
+	// roles of authenticated sessions, by whether they were cached.
+	RoleInfoLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "role_info_lookups_total",
+		Help:      "Lookups of the description and tags of the IAM roles of authenticated sessions by result",
+	}, []string{"result"})
+
+	// PostMappingHookCalls counts calls to the post-mapping hook by result.
+	PostMappingHookCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "post_mapping_hook_calls_total",
+		Help:      "Calls to the post-mapping hook by result",
+	}, []string{"result"})
+
+	// SharedCacheErrors counts failed requests to the shared cache, by
+	// cache (sts or replay). The local cache is used when it fails.
+	SharedCacheErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "shared_cache_errors_total",
+		Help:      "Failed requests to the shared cache by cache",
+	}, []string{"cache"})
+
+	// MappingConflicts is the number of mappings of each backend that a
+	// different mapping of the same ARN in an earlier backend shadows.
+	MappingConflicts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "mapping_conflicts",
+		Help:      "Mappings of a backend shadowed by a different mapping of the same ARN in an earlier backend",
+	}, []string{"backend"})
+
+	// UsernameCollisions is the number of static usernames that the
+	// mappings in effect map several ARNs to.
+	UsernameCollisions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "username_collisions",
+		Help:      "Static usernames several mapped ARNs share",
+	})
+
+	// CRDRoleGC counts the IAMIdentityMappings labeled, unlabeled or
+	// deleted because their IAM role no longer exists, or exists again.
+	CRDRoleGC = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "crd_role_gc_total",
+		Help:      "IAMIdentityMappings of deleted IAM roles by action (label, unlabel or delete)",
+	}, []string{"action"})
+
+	// CircuitBreakerState exposes the circuit breaker state per backend:
+	// 0 closed, 1 open, 2 half-open.
+	CircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker for a mapper backend (0 closed, 1 open, 2 half-open)",
+	}, []string{"backend"})
+
+	// FeatureEnabled is 1 for the feature gates that are enabled and 0 for
+	// the others, by name and stage (ALPHA, BETA, or empty once GA).
+	FeatureEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "feature_enabled",
+		Help:      "Whether the feature gate is enabled (1) or disabled (0)",
+	}, []string{"name", "stage"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		MappingLookups,
+		STSLatency,
+		STSRetries,
+		TokenVerificationErrors,
+		AuthenticationFailures,
+		ConfigMapParseErrors,
+		ConfigMapSize,
+		CircuitBreakerState,
+		RateLimitedRequests,
+		WatchRestarts,
+		ShadowMappingComparisons,
+		AccountAllowlistRefreshes,
+		TokenClusterIDs,
+		STSCacheLookups,
+		TokenReplays,
+		NegativeCacheHits,
+		UnsafeGroupMappings,
+		GroupLimitViolations,
+		ExpiredMappings,
+		MappingChanges,
+		ConfigMapDeleted,
+		APIServerDegraded,
+		MappingAssertionFailures,
+		MappingsLastLoad,
+		MappingsGeneration,
+		MappingConflicts,
+		UsernameCollisions,
+		CRDRoleGC,
+		IAMGroupLookups,
+		RoleInfoLookups,
+		PostMappingHookCalls,
+		SharedCacheErrors,
+		AWSAuthValidations,
+		FeatureEnabled,
+	)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package noderoles discovers the IAM roles of nodes from the instance
+// profiles of the EC2 instances of Auto Scaling groups or with given tags,
+// so the bootstrap writer can map the roles of new node groups without
+// editing aws-auth.
+package noderoles
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+)
+
+// autoScalingGroupTag is the tag EC2 Auto Scaling adds to the instances of
+// a group.
+const autoScalingGroupTag = "aws:autoscaling:groupName"
+
+// NodeUsername is the username of discovered node roles.
+const NodeUsername = "system:node:{{EC2PrivateDNSName}}"
+
+var (
+	// nodeGroups are the groups of discovered node roles.
+	nodeGroups = []string{"system:bootstrappers", "system:nodes"}
+	// windowsNodeGroups are the groups of roles of Windows nodes, which
+	// also run kube-proxy with the permissions EKS grants this group.
+	windowsNodeGroups = []string{"system:bootstrappers", "system:nodes", "eks:kube-proxy-windows"}
+)
+
+type instanceProfileGetter interface {
+	GetInstanceProfile(profileName string) ([]string, error)
+}
+
+// Source is a configmap.BootstrapSource of the roles of the instances of
+// node groups. Instance profiles are looked up once, as their roles rarely
+// change; the instances are described on every reconcile, so Auto Scaling
+// groups without instances have no roles discovered until they scale out.
+type Source struct {
+	ec2 ec2iface.EC2API
+	iam instanceProfileGetter
+	// queries are the filters of each DescribeInstances call; an instance
+	// matching any of them is a node.
+	queries [][]*ec2.Filter
+
+	mu       sync.Mutex
+	profiles map[string][]string
+}
+
+var _ configmap.BootstrapSource = &Source{}
+
+// New creates a Source for the Auto Scaling groups and instance tags of cfg,
+// or returns nil if neither is set. EC2 and IAM are called with the SDK's
+// default credential chain, or with the role of NodeRoleDiscoveryRoleARN
+// assumed with them.
+func New(cfg config.Config) (*Source, error) {
+	queries, err := filterQueries(cfg.NodeRoleAutoScalingGroups, cfg.NodeRoleInstanceTags)
+	if err != nil || len(queries) == 0 {
+		return nil, err
+	}
+	sess := session.Must(session.NewSession())
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "authenticatorUserAgent",
+		Fn: request.MakeAddToUserAgentHandler(
+			"aws-iam-authenticator", pkg.Version),
+	})
+	if aws.StringValue(sess.Config.Region) == "" {
+		region, err := ec2metadata.New(sess).Region()
+		if err != nil {
+			return nil, fmt.Errorf("could not find the region of the node groups: %v", err)
+		}
+		sess.Config.Region = aws.String(region)
+	}
+	var cfgs []*aws.Config
+	if cfg.NodeRoleDiscoveryRoleARN != "" {
+		cfgs = append(cfgs, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, cfg.NodeRoleDiscoveryRoleARN)))
+	}
+	return &Source{
+		ec2:      ec2.New(sess, cfgs...),
+		iam:      iamapi.New(cfg.PartitionID, cfg.NodeRoleDiscoveryRoleARN),
+		queries:  queries,
+		profiles: map[string][]string{},
+	}, nil
+}
+
+// filterQueries returns the DescribeInstances filters of running instances
+// of autoScalingGroups, and of those with all of tags. Group names and tag
+// values can contain * wildcards. A tag is key=value, or key for any value.
+func filterQueries(autoScalingGroups, tags []string) ([][]*ec2.Filter, error) {
+	running := &ec2.Filter{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})}
+	var queries [][]*ec2.Filter
+	if len(autoScalingGroups) > 0 {
+		queries = append(queries, []*ec2.Filter{
+			running,
+			{Name: aws.String("tag:" + autoScalingGroupTag), Values: aws.StringSlice(autoScalingGroups)},
+		})
+	}
+	if len(tags) > 0 {
+		filters := []*ec2.Filter{running}
+		for _, tag := range tags {
+			parts := strings.SplitN(tag, "=", 2)
+			if parts[0] == "" {
+				return nil, fmt.Errorf("invalid node role tag %q, expected key=value or key", tag)
+			}
+			if len(parts) == 1 {
+				filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice(parts[:1])})
+				continue
+			}
+			filters = append(filters, &ec2.Filter{Name: aws.String("tag:" + parts[0]), Values: aws.StringSlice(parts[1:])})
+		}
+		queries = append(queries, filters)
+	}
+	return queries, nil
+}
+
+func (s *Source) Name() string {
+	return "node-role-discovery"
+}
+
+// RoleMappings returns node mappings of the roles of the instance profiles
+// of the instances found.
+func (s *Source) RoleMappings() ([]config.RoleMapping, error) {
+	// the instance profiles found, and whether one of their instances runs
+	// Windows
+	profiles := map[string]bool{}
+	for _, filters := range s.queries {
+		err := s.ec2.DescribeInstancesPages(&ec2.DescribeInstancesInput{Filters: filters}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					if instance.IamInstanceProfile == nil {
+						continue
+					}
+					profileARN := aws.StringValue(instance.IamInstanceProfile.Arn)
+					profiles[profileARN] = profiles[profileARN] || aws.StringValue(instance.Platform) == ec2.PlatformValuesWindows
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not describe node instances: %v", err)
+		}
+	}
+
+	roles := map[string]bool{}
+	for profileARN, windows := range profiles {
+		roleARNs, err := s.profileRoles(profileARN)
+		if err != nil {
+			return nil, err
+		}
+		for _, roleARN := range roleARNs {
+			roles[roleARN] = roles[roleARN] || windows
+		}
+	}
+	mappings := make([]config.RoleMapping, 0, len(roles))
+	for roleARN, windows := range roles {
+		groups := nodeGroups
+		if windows {
+			groups = windowsNodeGroups
+		}
+		mappings = append(mappings, config.RoleMapping{RoleARN: roleARN, Username: NodeUsername, Groups: groups})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].RoleARN < mappings[j].RoleARN })
+	return mappings, nil
+}
+
+// profileRoles returns the role ARNs of the instance profile profileARN
+// without their paths, which aws-auth can't match.
+func (s *Source) profileRoles(profileARN string) ([]string, error) {
+	s.mu.Lock()
+	roles, ok := s.profiles[profileARN]
+	s.mu.Unlock()
+	if ok {
+		return roles, nil
+	}
+	parsed, err := awsarn.Parse(profileARN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance profile ARN %q: %v", profileARN, err)
+	}
+	roleARNs, err := s.iam.GetInstanceProfile(path.Base(parsed.Resource))
+	if err != nil {
+		return nil, err
+	}
+	for _, roleARN := range roleARNs {
+		role, err := arn.Parse(roleARN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role ARN %q: %v", roleARN, err)
+		}
+		roles = append(roles, role.WithoutPath().String())
+	}
+	s.mu.Lock()
+	s.profiles[profileARN] = roles
+	s.mu.Unlock()
+	return roles, nil
+}
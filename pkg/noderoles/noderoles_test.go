@@ -0,0 +1,121 @@
+package noderoles
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+type fakeEC2 struct {
+	ec2iface.EC2API
+	// instances returns the instances matching filters.
+	instances func(filters []*ec2.Filter) []*ec2.Instance
+	queries   [][]*ec2.Filter
+}
+
+func (f *fakeEC2) DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+	f.queries = append(f.queries, input.Filters)
+	fn(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: f.instances(input.Filters)}}}, true)
+	return nil
+}
+
+func (f *fakeEC2) DescribeInstancesPagesWithContext(aws.Context, *ec2.DescribeInstancesInput, func(*ec2.DescribeInstancesOutput, bool) bool, ...request.Option) error {
+	panic("not implemented")
+}
+
+type fakeIAM struct {
+	profiles map[string][]string
+	calls    int
+}
+
+func (f *fakeIAM) GetInstanceProfile(profileName string) ([]string, error) {
+	f.calls++
+	return f.profiles[profileName], nil
+}
+
+func instance(profileARN, platform string) *ec2.Instance {
+	i := &ec2.Instance{IamInstanceProfile: &ec2.IamInstanceProfile{Arn: aws.String(profileARN)}}
+	if platform != "" {
+		i.Platform = aws.String(platform)
+	}
+	return i
+}
+
+func TestFilterQueries(t *testing.T) {
+	queries, err := filterQueries([]string{"prod-nodes-*"}, []string{"team=platform", "kubernetes.io/cluster/prod"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	running := &ec2.Filter{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})}
+	expected := [][]*ec2.Filter{
+		{running, {Name: aws.String("tag:aws:autoscaling:groupName"), Values: aws.StringSlice([]string{"prod-nodes-*"})}},
+		{
+			running,
+			{Name: aws.String("tag:team"), Values: aws.StringSlice([]string{"platform"})},
+			{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{"kubernetes.io/cluster/prod"})},
+		},
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected %v, got %v", expected, queries)
+	}
+
+	if queries, err := filterQueries(nil, nil); err != nil || len(queries) != 0 {
+		t.Errorf("expected no queries, got %v, %v", queries, err)
+	}
+	if _, err := filterQueries(nil, []string{"=value"}); err == nil {
+		t.Errorf("expected an error for a tag without a key")
+	}
+}
+
+func TestNewWithoutSelectors(t *testing.T) {
+	s, err := New(config.Config{})
+	if s != nil || err != nil {
+		t.Errorf("expected no source, got %v, %v", s, err)
+	}
+}
+
+func TestRoleMappings(t *testing.T) {
+	ec2Client := &fakeEC2{instances: func(filters []*ec2.Filter) []*ec2.Instance {
+		if aws.StringValue(filters[1].Name) == "tag:aws:autoscaling:groupName" {
+			return []*ec2.Instance{
+				instance("arn:aws:iam::123456789012:instance-profile/eks/linux-nodes", ""),
+				instance("arn:aws:iam::123456789012:instance-profile/linux-nodes", ""),
+				{},
+			}
+		}
+		return []*ec2.Instance{instance("arn:aws:iam::123456789012:instance-profile/windows-nodes", ec2.PlatformValuesWindows)}
+	}}
+	iam := &fakeIAM{profiles: map[string][]string{
+		"linux-nodes":   {"arn:aws:iam::123456789012:role/eks/LinuxNodeRole"},
+		"windows-nodes": {"arn:aws:iam::123456789012:role/WindowsNodeRole"},
+	}}
+	queries, _ := filterQueries([]string{"nodes"}, []string{"os=windows"})
+	s := &Source{ec2: ec2Client, iam: iam, queries: queries, profiles: map[string][]string{}}
+
+	mappings, err := s.RoleMappings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []config.RoleMapping{
+		{RoleARN: "arn:aws:iam::123456789012:role/LinuxNodeRole", Username: NodeUsername, Groups: nodeGroups},
+		{RoleARN: "arn:aws:iam::123456789012:role/WindowsNodeRole", Username: NodeUsername, Groups: windowsNodeGroups},
+	}
+	if !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("expected %+v, got %+v", expected, mappings)
+	}
+	if len(ec2Client.queries) != 2 {
+		t.Errorf("expected a query per selector, got %d", len(ec2Client.queries))
+	}
+
+	if _, err := s.RoleMappings(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if iam.calls != 3 {
+		t.Errorf("expected instance profiles to be looked up once, got %d lookups", iam.calls)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package organizations lists the accounts of AWS Organizations
+// organizational units, so every account of an OU can be trusted.
+package organizations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+const (
+	serviceID  = "organizations"
+	apiVersion = "2016-11-28"
+)
+
+// accountStatusActive is the status of accounts that are members of the
+// organization. Suspended accounts aren't trusted.
+const accountStatusActive = "ACTIVE"
+
+// AccountSource lists the active accounts of organizational units and of the
+// OUs nested in them. Parents can also be the root of the organization.
+type AccountSource struct {
+	client  *client.Client
+	parents []string
+}
+
+var _ mapper.AccountSource = &AccountSource{}
+
+// NewAccountSource creates an AccountSource for the parents, OU IDs such as
+// "ou-ab12-cdef3456" or root IDs such as "r-ab12". Organizations is called
+// with the SDK's default credential chain, or with the role of roleARN
+// assumed with them; it must be the management account or a delegated
+// administrator of the organization.
+func NewAccountSource(partitionID, roleARN string, parents []string) *AccountSource {
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(iamapi.GlobalRegion(partitionID, serviceID))))
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "authenticatorUserAgent",
+		Fn: request.MakeAddToUserAgentHandler(
+			"aws-iam-authenticator", pkg.Version),
+	})
+	var cfgs []*aws.Config
+	if roleARN != "" {
+		cfgs = append(cfgs, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, roleARN)))
+	}
+	return newAccountSource(sess, parents, cfgs...)
+}
+
+// newAccountSource sets the client up the way the generated service clients
+// are. The SDK's Organizations package isn't vendored, nor its JSON protocol
+// handlers, which are simple enough to implement here.
+func newAccountSource(p client.ConfigProvider, parents []string, cfgs ...*aws.Config) *AccountSource {
+	c := p.ClientConfig(serviceID, cfgs...)
+	cl := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   serviceID,
+			ServiceID:     "Organizations",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			PartitionID:   c.PartitionID,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+			JSONVersion:   "1.1",
+			TargetPrefix:  "AWSOrganizationsV20161128",
+		},
+		c.Handlers,
+	)
+	cl.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	cl.Handlers.Build.PushBackNamed(request.NamedHandler{Name: "organizations.Build", Fn: build})
+	cl.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "organizations.Unmarshal", Fn: unmarshal})
+	cl.Handlers.UnmarshalError.PushBackNamed(request.NamedHandler{Name: "organizations.UnmarshalError", Fn: unmarshalError})
+	return &AccountSource{client: cl, parents: parents}
+}
+
+func build(r *request.Request) {
+	body, err := jsonutil.BuildJSON(r.Params)
+	if err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed encoding JSON request", err)
+		return
+	}
+	r.SetBufferBody(body)
+	r.HTTPRequest.Header.Set("X-Amz-Target", r.ClientInfo.TargetPrefix+"."+r.Operation.Name)
+	r.HTTPRequest.Header.Set("Content-Type", "application/x-amz-json-"+r.ClientInfo.JSONVersion)
+}
+
+func unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	if err := jsonutil.UnmarshalJSON(r.Data, r.HTTPResponse.Body); err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed decoding JSON response", err)
+	}
+}
+
+func unmarshalError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	body, err := ioutil.ReadAll(r.HTTPResponse.Body)
+	if err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed reading error response", err)
+		return
+	}
+	var resp struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &resp)
+	// The type can be prefixed with a namespace, e.g.
+	// "com.amazonaws.organizations#AccessDeniedException".
+	code := resp.Type[strings.LastIndex(resp.Type, "#")+1:]
+	if code == "" {
+		code = "UnknownError"
+	}
+	r.Error = awserr.NewRequestFailure(awserr.New(code, resp.Message, nil), r.HTTPResponse.StatusCode, r.RequestID)
+}
+
+func (s *AccountSource) Name() string {
+	return "organizations"
+}
+
+// Accounts returns the IDs of the active accounts of every parent.
+func (s *AccountSource) Accounts() ([]string, error) {
+	var accounts []string
+	for _, parent := range s.parents {
+		ids, err := s.accountsOf(parent)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, ids...)
+	}
+	return accounts, nil
+}
+
+type listInput struct {
+	_ struct{} `type:"structure"`
+
+	NextToken *string `type:"string"`
+	ParentId  *string `type:"string" required:"true"`
+}
+
+type listAccountsForParentOutput struct {
+	_ struct{} `type:"structure"`
+
+	Accounts  []*account `type:"list"`
+	NextToken *string    `type:"string"`
+}
+
+type account struct {
+	_ struct{} `type:"structure"`
+
+	Id     *string `type:"string"`
+	Status *string `type:"string"`
+}
+
+type listOrganizationalUnitsForParentOutput struct {
+	_ struct{} `type:"structure"`
+
+	NextToken           *string               `type:"string"`
+	OrganizationalUnits []*organizationalUnit `type:"list"`
+}
+
+type organizationalUnit struct {
+	_ struct{} `type:"structure"`
+
+	Id *string `type:"string"`
+}
+
+// accountsOf returns the active accounts of parent and of the OUs nested in
+// it, following pagination.
+func (s *AccountSource) accountsOf(parent string) ([]string, error) {
+	var accounts []string
+	input := &listInput{ParentId: aws.String(parent)}
+	for {
+		output := &listAccountsForParentOutput{}
+		if err := s.send("ListAccountsForParent", input, output); err != nil {
+			return nil, fmt.Errorf("could not list the accounts of %s: %v", parent, err)
+		}
+		for _, a := range output.Accounts {
+			if aws.StringValue(a.Status) == accountStatusActive {
+				accounts = append(accounts, aws.StringValue(a.Id))
+			}
+		}
+		if input.NextToken = output.NextToken; aws.StringValue(input.NextToken) == "" {
+			break
+		}
+	}
+
+	input = &listInput{ParentId: aws.String(parent)}
+	for {
+		output := &listOrganizationalUnitsForParentOutput{}
+		if err := s.send("ListOrganizationalUnitsForParent", input, output); err != nil {
+			return nil, fmt.Errorf("could not list the organizational units of %s: %v", parent, err)
+		}
+		for _, ou := range output.OrganizationalUnits {
+			nested, err := s.accountsOf(aws.StringValue(ou.Id))
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, nested...)
+		}
+		if input.NextToken = output.NextToken; aws.StringValue(input.NextToken) == "" {
+			return accounts, nil
+		}
+	}
+}
+
+func (s *AccountSource) send(name string, input, output interface{}) error {
+	return s.client.NewRequest(&request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output).Send()
+}
@@ -0,0 +1,75 @@
+package organizations
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// testOrganization serves ListAccountsForParent and
+// ListOrganizationalUnitsForParent from responses keyed by operation and
+// parent, with NextToken appended to the parent for later pages.
+func testOrganization(responses map[string]string) (*httptest.Server, *session.Session) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			ParentId  string
+			NextToken string
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSOrganizationsV20161128.")
+		response, ok := responses[operation+" "+input.ParentId+input.NextToken]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.organizations#ParentNotFoundException","message":"not found"}`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+	}))
+	return server, sess
+}
+
+func TestAccounts(t *testing.T) {
+	server, sess := testOrganization(map[string]string{
+		"ListAccountsForParent ou-root-teams":                 `{"Accounts":[{"Id":"111111111111","Status":"ACTIVE"},{"Id":"222222222222","Status":"SUSPENDED"}],"NextToken":"page2"}`,
+		"ListAccountsForParent ou-root-teamspage2":            `{"Accounts":[{"Id":"333333333333","Status":"ACTIVE"}]}`,
+		"ListOrganizationalUnitsForParent ou-root-teams":      `{"OrganizationalUnits":[{"Id":"ou-root-dev"}]}`,
+		"ListAccountsForParent ou-root-dev":                   `{"Accounts":[{"Id":"444444444444","Status":"ACTIVE"}]}`,
+		"ListOrganizationalUnitsForParent ou-root-dev":        `{"OrganizationalUnits":[]}`,
+		"ListAccountsForParent ou-root-sandbox":               `{"Accounts":[{"Id":"555555555555","Status":"ACTIVE"}]}`,
+		"ListOrganizationalUnitsForParent ou-root-sandbox":    `{}`,
+		"ListOrganizationalUnitsForParent ou-root-teamspage2": `{}`,
+	})
+	defer server.Close()
+
+	accounts, err := newAccountSource(sess, []string{"ou-root-teams", "ou-root-sandbox"}).Accounts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(accounts)
+	if expected := []string{"111111111111", "333333333333", "444444444444", "555555555555"}; !reflect.DeepEqual(accounts, expected) {
+		t.Errorf("expected %v, got %v", expected, accounts)
+	}
+}
+
+func TestAccountsError(t *testing.T) {
+	server, sess := testOrganization(nil)
+	defer server.Close()
+
+	_, err := newAccountSource(sess, []string{"ou-root-missing"}).Accounts()
+	if err == nil || !strings.Contains(err.Error(), "ParentNotFoundException") {
+		t.Errorf("expected a ParentNotFoundException error, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package roleinfo resolves the description, path and tags of the IAM roles
+// of assumed-role sessions, to add them to the user extras and evaluate
+// mapping rules.
+package roleinfo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// Keys of the user extras the description and tags of roles are added as.
+const (
+	ExtraDescription = "authentication.kubernetes.io/aws-iam-role-description"
+	// ExtraTagPrefix is followed by the tag key in lower case.
+	ExtraTagPrefix = "authentication.kubernetes.io/aws-iam-role-tag-"
+)
+
+// Info is the description, path and tags of an IAM role.
+type Info struct {
+	Description string
+	// Path is the path of the role, such as "/" or "/team/payments/". It
+	// isn't part of the ARNs of role sessions.
+	Path string
+	// Tags are the tags of the role by key.
+	Tags map[string]string
+}
+
+// Provider returns the description and tags of IAM roles.
+type Provider interface {
+	// Role returns the Info of the IAM role roleARN.
+	Role(roleARN string) (*Info, error)
+}
+
+// Options configures a Provider.
+type Options struct {
+	// PartitionID is the partition of the IAM endpoint to call.
+	PartitionID string
+	// RoleARN, if set, is assumed to call IAM, for roles in another account
+	// than the server's credentials.
+	RoleARN string
+	// CacheTTL is how long the Info of a role, or the failure to get it, is
+	// cached.
+	CacheTTL time.Duration
+}
+
+type provider struct {
+	getter   roleGetter
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	info    *Info
+	err     error
+	expires time.Time
+}
+
+// roleGetter gets an IAM role of the account of its credentials.
+type roleGetter interface {
+	GetRole(roleName string) (*iamapi.Role, error)
+}
+
+// New creates a Provider calling IAM with the SDK's default credential
+// chain, or with the role of opts.RoleARN assumed with them.
+func New(opts Options) Provider {
+	return newProvider(iamapi.New(opts.PartitionID, opts.RoleARN), opts.CacheTTL)
+}
+
+func newProvider(getter roleGetter, cacheTTL time.Duration) *provider {
+	return &provider{
+		getter:   getter,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    map[string]cacheEntry{},
+	}
+}
+
+// Role returns the Info of roleARN. Failures are cached too, so roles IAM
+// can't describe, such as those of other accounts, aren't looked up on every
+// request.
+func (p *provider) Role(roleARN string) (*Info, error) {
+	key := strings.ToLower(roleARN)
+	now := p.now()
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		metrics.RoleInfoLookups.WithLabelValues(metrics.LookupHit).Inc()
+		return entry.info, entry.err
+	}
+
+	info, err := p.get(roleARN)
+	if err != nil {
+		metrics.RoleInfoLookups.WithLabelValues(metrics.LookupError).Inc()
+	} else {
+		metrics.RoleInfoLookups.WithLabelValues(metrics.LookupMiss).Inc()
+	}
+	if p.cacheTTL > 0 {
+		p.mu.Lock()
+		p.cache[key] = cacheEntry{info: info, err: err, expires: now.Add(p.cacheTTL)}
+		p.mu.Unlock()
+	}
+	return info, err
+}
+
+func (p *provider) get(roleARN string) (*Info, error) {
+	roleName, err := arn.RoleName(roleARN)
+	if err != nil {
+		return nil, err
+	}
+	role, err := p.getter.GetRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Description: role.Description, Path: "/", Tags: role.Tags}
+	// the ARN of the role includes its path
+	if principal, err := arn.Parse(role.ARN); err == nil {
+		info.Path = principal.Path
+	}
+	return info, nil
+}
+
+// Extras returns the user extras of info: its description if description
+// is set, and the values of the tags of tagKeys it has.
+func Extras(info *Info, description bool, tagKeys []string) map[string][]string {
+	extras := map[string][]string{}
+	if description && info.Description != "" {
+		extras[ExtraDescription] = []string{info.Description}
+	}
+	for _, key := range tagKeys {
+		if value, ok := info.Tags[key]; ok {
+			extras[ExtraTagPrefix+strings.ToLower(key)] = []string{value}
+		}
+	}
+	return extras
+}
+
+// tagKeyPattern matches the tag keys that can be part of a user extra key.
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateTagKey returns an error unless the tag key can be added to the
+// user extras.
+func ValidateTagKey(key string) error {
+	if !tagKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid role tag key %q for the user extras: expected letters, digits, '.', '_' and '-'", key)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package roleinfo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+)
+
+type fakeGetter struct {
+	role  *iamapi.Role
+	err   error
+	calls []string
+}
+
+func (g *fakeGetter) GetRole(roleName string) (*iamapi.Role, error) {
+	g.calls = append(g.calls, roleName)
+	return g.role, g.err
+}
+
+func TestRole(t *testing.T) {
+	getter := &fakeGetter{role: &iamapi.Role{
+		ARN:         "arn:aws:iam::111122223333:role/team/Developer",
+		Description: "Developers of the payments team",
+		Tags:        map[string]string{"Team": "payments", "CostCenter": "1234"},
+	}}
+	p := newProvider(getter, time.Minute)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		info, err := p.Role("arn:aws:iam::111122223333:role/Developer")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Description != "Developers of the payments team" || info.Path != "/team/" || info.Tags["Team"] != "payments" {
+			t.Errorf("unexpected role info %+v", info)
+		}
+	}
+	if !reflect.DeepEqual(getter.calls, []string{"Developer"}) {
+		t.Errorf("expected 1 call to IAM for Developer, got %v", getter.calls)
+	}
+
+	// failures are cached too
+	getter.err = errors.New("access denied")
+	for i := 0; i < 2; i++ {
+		if _, err := p.Role("arn:aws:iam::444455556666:role/Other"); err == nil {
+			t.Error("expected an error")
+		}
+	}
+	if len(getter.calls) != 2 {
+		t.Errorf("expected the failure to be cached, got calls %v", getter.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := p.Role("arn:aws:iam::111122223333:role/Developer"); err == nil {
+		t.Error("expected an error once the cache expired")
+	}
+
+	if _, err := p.Role("arn:aws:iam::111122223333:user/Alice"); err == nil {
+		t.Error("expected an error for a user ARN")
+	}
+}
+
+func TestExtras(t *testing.T) {
+	info := &Info{
+		Description: "Developers",
+		Tags:        map[string]string{"Team": "payments", "CostCenter": "1234"},
+	}
+	expected := map[string][]string{
+		ExtraDescription:        {"Developers"},
+		ExtraTagPrefix + "team": {"payments"},
+	}
+	if extras := Extras(info, true, []string{"Team", "Owner"}); !reflect.DeepEqual(extras, expected) {
+		t.Errorf("expected %v, got %v", expected, extras)
+	}
+	if extras := Extras(info, false, nil); len(extras) != 0 {
+		t.Errorf("expected no extras, got %v", extras)
+	}
+}
+
+func TestValidateTagKey(t *testing.T) {
+	for key, valid := range map[string]bool{
+		"Team":        true,
+		"cost-center": true,
+		"a.b_c":       true,
+		"":            false,
+		"aws:team":    false,
+		"team name":   false,
+	} {
+		if err := ValidateTagKey(key); (err == nil) != valid {
+			t.Errorf("%q: expected valid %t, got %v", key, valid, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// AWSAuthValidationPath is where the validating admission webhook for the
+// aws-auth ConfigMap is served.
+const AWSAuthValidationPath = "/validate-aws-auth"
+
+// admissionReview is the subset of an admission.k8s.io AdmissionReview
+// (v1 or v1beta1, which share their format) used by the webhook.
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *admissionRequest  `json:"request,omitempty"`
+	Response        *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       types.UID       `json:"uid"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+type admissionResponse struct {
+	UID     types.UID      `json:"uid"`
+	Allowed bool           `json:"allowed"`
+	Result  *metav1.Status `json:"result,omitempty"`
+}
+
+// validateAWSAuthEndpoint returns a handler that rejects creates and updates
+// of the ConfigMap name in namespace whose mappings are invalid, before they
+// can break authentication for the cluster. Other objects and operations are
+// allowed, so the webhook can be registered with a broad rule.
+func validateAWSAuthEndpoint(namespace, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		serveAWSAuthValidation(w, req, namespace, name)
+	}
+}
+
+func serveAWSAuthValidation(w http.ResponseWriter, req *http.Request, namespace, name string) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var review admissionReview
+	if err := json.NewDecoder(req.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "expected a request body to be an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionResponse{UID: review.Request.UID, Allowed: true}
+	if errs := validateAWSAuth(review.Request, namespace, name); len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: "invalid aws-auth ConfigMap: " + strings.Join(messages, "; "),
+		}
+		logger.WithFields(logrus.Fields{
+			"operation": review.Request.Operation,
+			"errors":    messages,
+		}).Warn("rejected an invalid aws-auth ConfigMap")
+		authmetrics.AWSAuthValidations.WithLabelValues(authmetrics.AWSAuthRejected).Inc()
+	} else {
+		authmetrics.AWSAuthValidations.WithLabelValues(authmetrics.AWSAuthAllowed).Inc()
+	}
+
+	review.Request = nil
+	review.Response = response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// validateAWSAuth returns the problems of the ConfigMap in req, if req
+// creates or updates the ConfigMap name in namespace.
+func validateAWSAuth(req *admissionRequest, namespace, name string) []error {
+	if req.Operation != "CREATE" && req.Operation != "UPDATE" {
+		return nil
+	}
+	var cm core_v1.ConfigMap
+	if err := json.Unmarshal(req.Object, &cm); err != nil {
+		return []error{fmt.Errorf("could not decode the ConfigMap: %v", err)}
+	}
+	reqNamespace, reqName := req.Namespace, req.Name
+	if reqName == "" {
+		reqName = cm.Name
+	}
+	if reqNamespace != namespace || reqName != name {
+		return nil
+	}
+	return configmap.Validate(cm.Data)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func reviewAWSAuth(t *testing.T, operation, namespace, name string, data map[string]string) *admissionResponse {
+	t.Helper()
+	object, _ := json.Marshal(core_v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Data: data})
+	body, _ := json.Marshal(admissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  &admissionRequest{UID: "uid-1", Namespace: namespace, Name: name, Operation: operation, Object: object},
+	})
+	rr := httptest.NewRecorder()
+	validateAWSAuthEndpoint("kube-system", "aws-auth")(rr, httptest.NewRequest(http.MethodPost, AWSAuthValidationPath, bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var review admissionReview
+	if err := json.Unmarshal(rr.Body.Bytes(), &review); err != nil {
+		t.Fatalf("could not decode the response: %v", err)
+	}
+	if review.APIVersion != "admission.k8s.io/v1" || review.Response == nil || review.Response.UID != "uid-1" {
+		t.Fatalf("unexpected response %+v", review)
+	}
+	return review.Response
+}
+
+func TestValidateAWSAuthEndpoint(t *testing.T) {
+	invalid := map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/A\n  username: a\n  groups: [system:authenticated]\n"}
+
+	resp := reviewAWSAuth(t, "UPDATE", "kube-system", "aws-auth", invalid)
+	if resp.Allowed || resp.Result == nil || !strings.Contains(resp.Result.Message, "reserved group") {
+		t.Errorf("expected the invalid aws-auth to be rejected, got %+v", resp)
+	}
+	valid := map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/A\n  username: a\n  groups: [system:masters]\n"}
+	if resp := reviewAWSAuth(t, "CREATE", "kube-system", "aws-auth", valid); !resp.Allowed {
+		t.Errorf("expected a valid aws-auth to be allowed, got %+v", resp)
+	}
+	if resp := reviewAWSAuth(t, "UPDATE", "default", "aws-auth", invalid); !resp.Allowed {
+		t.Errorf("expected other ConfigMaps to be allowed, got %+v", resp)
+	}
+	if resp := reviewAWSAuth(t, "DELETE", "kube-system", "aws-auth", invalid); !resp.Allowed {
+		t.Errorf("expected deletes to be allowed, got %+v", resp)
+	}
+}
+
+func TestValidateAWSAuthLocation(t *testing.T) {
+	invalid := map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/A\n  username: a\n  groups: [system:authenticated]\n"}
+	req := func(namespace, name string) *admissionRequest {
+		object, _ := json.Marshal(core_v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Data: invalid})
+		return &admissionRequest{Namespace: namespace, Name: name, Operation: "UPDATE", Object: object}
+	}
+	if errs := validateAWSAuth(req("iam-auth", "mappings"), "iam-auth", "mappings"); len(errs) == 0 {
+		t.Error("expected the configured ConfigMap to be validated")
+	}
+	if errs := validateAWSAuth(req("kube-system", "aws-auth"), "iam-auth", "mappings"); len(errs) != 0 {
+		t.Errorf("expected the default ConfigMap to be ignored when another is configured, got %v", errs)
+	}
+}
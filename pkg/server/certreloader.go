@@ -0,0 +1,155 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// certReloader serves the listener's certificate and swaps it without a
+// restart when the files in the state directory change, or when a
+// self-signed certificate nears expiry and is rotated.
+type certReloader struct {
+	cfg *config.Config
+	now func() time.Time
+
+	mutex        sync.RWMutex
+	cert         *tls.Certificate
+	certModTime  time.Time
+	keyModTime   time.Time
+	expiryWarned bool
+}
+
+func newCertReloader(cfg *config.Config, cert *tls.Certificate) *certReloader {
+	r := &certReloader{
+		cfg:  cfg,
+		now:  time.Now,
+		cert: cert,
+	}
+	r.certModTime, r.keyModTime = r.modTimes()
+	return r
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// run checks the certificate every CertReloadInterval until stopCh is closed.
+func (r *certReloader) run(stopCh <-chan struct{}) {
+	if r.cfg.CertReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.CertReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+func (r *certReloader) modTimes() (time.Time, time.Time) {
+	var certModTime, keyModTime time.Time
+	if fi, err := os.Stat(r.cfg.CertPath()); err == nil {
+		certModTime = fi.ModTime()
+	}
+	if fi, err := os.Stat(r.cfg.KeyPath()); err == nil {
+		keyModTime = fi.ModTime()
+	}
+	return certModTime, keyModTime
+}
+
+// check reloads the certificate if it changed on disk and rotates it if it
+// is self-signed and expires within CertRotateBefore.
+func (r *certReloader) check() {
+	certModTime, keyModTime := r.modTimes()
+	if !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime) {
+		cert, err := r.cfg.LoadExistingCertificate()
+		if err != nil || cert == nil {
+			// the pair may be mid-update, try again on the next check
+			logger.WithError(err).Warn("could not reload certificate")
+			return
+		}
+		logger.Info("certificate changed on disk, reloading")
+		r.swap(cert, certModTime, keyModTime)
+	}
+
+	r.mutex.RLock()
+	cert := r.cert
+	r.mutex.RUnlock()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		logger.WithError(err).Error("could not parse serving certificate")
+		return
+	}
+	remaining := leaf.NotAfter.Sub(r.now())
+	if r.cfg.CertRotateBefore <= 0 || remaining > r.cfg.CertRotateBefore {
+		return
+	}
+	if leaf.CheckSignatureFrom(leaf) != nil {
+		// not ours to rotate, whoever provisioned it has to replace it
+		if !r.expiryWarned {
+			logger.WithField("notAfter", leaf.NotAfter).Warn("serving certificate is not self-signed and expires soon")
+			r.expiryWarned = true
+		}
+		return
+	}
+
+	logger.WithField("notAfter", leaf.NotAfter).Info("self-signed certificate expires soon, rotating")
+	cert, err = r.cfg.RotateCertificate()
+	if err != nil {
+		logger.WithError(err).Error("could not rotate certificate")
+		return
+	}
+	certModTime, keyModTime = r.modTimes()
+	r.swap(cert, certModTime, keyModTime)
+}
+
+// set replaces the served certificate.
+func (r *certReloader) set(cert *tls.Certificate) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = cert
+}
+
+func (r *certReloader) swap(cert *tls.Certificate, certModTime, keyModTime time.Time) {
+	r.mutex.Lock()
+	r.cert = cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	r.expiryWarned = false
+	r.mutex.Unlock()
+
+	if !r.cfg.KubeconfigPregenerated {
+		// the API server has to pick up the new CA from the kubeconfig
+		if err := r.cfg.CreateKubeconfig(); err != nil {
+			logger.WithError(err).Error("could not regenerate kubeconfig")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func newTestCertReloader(t *testing.T, cfg *config.Config) *certReloader {
+	t.Helper()
+	cert, err := cfg.GetOrCreateCertificate()
+	if err != nil {
+		t.Fatalf("GetOrCreateCertificate: %v", err)
+	}
+	return newCertReloader(cfg, cert)
+}
+
+func servedCertificate(t *testing.T, r *certReloader) []byte {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certreloader")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{Address: "127.0.0.1", Hostname: "127.0.0.1", StateDir: dir, KubeconfigPregenerated: true}
+	r := newTestCertReloader(t, cfg)
+	before := servedCertificate(t, r)
+
+	r.check()
+	if !bytes.Equal(before, servedCertificate(t, r)) {
+		t.Fatalf("expected the certificate to be unchanged")
+	}
+
+	// replace the certificate on disk, as an external provisioner would
+	other := *cfg
+	if _, err := other.RotateCertificate(); err != nil {
+		t.Fatalf("RotateCertificate: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(cfg.CertPath(), future, future)
+
+	r.check()
+	if bytes.Equal(before, servedCertificate(t, r)) {
+		t.Errorf("expected the changed certificate to be reloaded")
+	}
+}
+
+func TestCertReloaderRotatesExpiringCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certreloader")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{
+		Address:                "127.0.0.1",
+		Hostname:               "127.0.0.1",
+		HostPort:               21362,
+		StateDir:               dir,
+		GenerateKubeconfigPath: filepath.Join(dir, "kubeconfig.yaml"),
+		CertLifetime:           time.Hour,
+		CertRotateBefore:       24 * time.Hour,
+	}
+	r := newTestCertReloader(t, cfg)
+	before := servedCertificate(t, r)
+
+	r.check()
+	if bytes.Equal(before, servedCertificate(t, r)) {
+		t.Errorf("expected the expiring certificate to be rotated")
+	}
+	if _, err := os.Stat(cfg.GenerateKubeconfigPath); err != nil {
+		t.Errorf("expected the kubeconfig to be regenerated: %v", err)
+	}
+
+	cfg.CertRotateBefore = time.Minute
+	rotated := servedCertificate(t, r)
+	r.check()
+	if !bytes.Equal(rotated, servedCertificate(t, r)) {
+		t.Errorf("expected a certificate outside the rotation window to be kept")
+	}
+}
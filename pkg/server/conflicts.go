@@ -0,0 +1,98 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// conflictCheckInterval is how often the backends are checked for
+// conflicting mappings, so conflicts introduced by a reloaded ConfigMap or a
+// new IAMIdentityMapping are reported soon after they are loaded.
+const conflictCheckInterval = time.Minute
+
+// conflictDetector reports mappings that an earlier backend shadows with a
+// different mapping of the same ARN. The earlier backend always wins, so
+// such a mapping has no effect and is likely a mistake. It also reports
+// static usernames that several ARNs are mapped to, possibly by different
+// backends, as each of these ARNs gets the RBAC bindings of the others.
+type conflictDetector struct {
+	// mappers returns the mappers to check, which change when the
+	// configuration is reloaded.
+	mappers func() []mapper.Mapper
+	// reported are the conflicts and username collisions found by the last
+	// check, so each is only logged once for as long as it lasts.
+	reported map[string]bool
+}
+
+func newConflictDetector(mappers func() []mapper.Mapper) *conflictDetector {
+	return &conflictDetector{mappers: mappers, reported: map[string]bool{}}
+}
+
+// check logs new conflicts and updates the conflict metric. A single
+// backend is not checked.
+func (d *conflictDetector) check() {
+	mappers := d.mappers()
+	if len(mappers) < 2 {
+		return
+	}
+	counts := map[string]int{}
+	for _, m := range mappers {
+		counts[m.Name()] = 0
+	}
+	reported := map[string]bool{}
+	snapshot := mapper.NewSnapshot(mappers)
+	for _, c := range snapshot.Conflicts() {
+		counts[c.Shadowed.Source]++
+		key := fmt.Sprintf("%s %s %s %v %v", c.Shadowed.Source, c.Shadowed.ARN, c.Shadowed.Username, c.Shadowed.Groups, c.Winner)
+		reported[key] = true
+		if d.reported[key] {
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"arn":             c.Shadowed.ARN,
+			"backend":         c.Shadowed.Source,
+			"username":        c.Shadowed.Username,
+			"groups":          c.Shadowed.Groups,
+			"winningBackend":  c.Winner.Source,
+			"winningUsername": c.Winner.Username,
+			"winningGroups":   c.Winner.Groups,
+		}).Warn("conflicting mapping is shadowed by an earlier backend and never used")
+	}
+	collisions := snapshot.UsernameCollisions()
+	for _, c := range collisions {
+		key := fmt.Sprintf("username %s %v", c.Username, c.ARNs)
+		reported[key] = true
+		if d.reported[key] {
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"username": c.Username,
+			"arns":     c.ARNs,
+		}).Warn("several ARNs are mapped to the same username and share its RBAC bindings")
+	}
+	d.reported = reported
+	for backend, count := range counts {
+		authmetrics.MappingConflicts.WithLabelValues(backend).Set(float64(count))
+	}
+	authmetrics.UsernameCollisions.Set(float64(len(collisions)))
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+func conflictCount(t *testing.T, backend string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := authmetrics.MappingConflicts.WithLabelValues(backend).Write(&m); err != nil {
+		t.Fatalf("could not read gauge: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestConflictDetector(t *testing.T) {
+	first := file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/admin": {Username: "admin", Groups: []string{"system:masters"}},
+		"arn:aws:iam::012345678912:role/dev":   {Username: "dev"},
+	}, nil, nil)
+	second := &namedMapper{Mapper: file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/admin": {Username: "admin", Groups: []string{"viewers"}},
+		"arn:aws:iam::012345678912:role/dev":   {Username: "dev", Groups: []string{}},
+	}, nil, nil), name: "second"}
+
+	d := newConflictDetector(func() []mapper.Mapper { return []mapper.Mapper{first, second} })
+	d.check()
+	if got := conflictCount(t, "second"); got != 1 {
+		t.Errorf("expected 1 conflict in the second backend, got %v", got)
+	}
+	if got := conflictCount(t, mapper.ModeMountedFile); got != 0 {
+		t.Errorf("expected no conflicts in the first backend, got %v", got)
+	}
+	if len(d.reported) != 1 {
+		t.Errorf("expected 1 reported conflict, got %v", d.reported)
+	}
+}
+
+func TestConflictDetectorUsernameCollisions(t *testing.T) {
+	first := file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/admin": {Username: "admin"},
+		"arn:aws:iam::012345678912:role/node":  {Username: "system:node:{{EC2PrivateDNSName}}"},
+	}, nil, nil)
+	second := &namedMapper{Mapper: file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/other": {Username: "admin"},
+		"arn:aws:iam::012345678912:role/node2": {Username: "system:node:{{EC2PrivateDNSName}}"},
+	}, nil, nil), name: "second"}
+
+	d := newConflictDetector(func() []mapper.Mapper { return []mapper.Mapper{first, second} })
+	d.check()
+	var m dto.Metric
+	if err := authmetrics.UsernameCollisions.Write(&m); err != nil {
+		t.Fatalf("could not read gauge: %v", err)
+	}
+	if got := m.GetGauge().GetValue(); got != 1 {
+		t.Errorf("expected 1 username collision, got %v", got)
+	}
+	if len(d.reported) != 1 {
+		t.Errorf("expected 1 reported collision, got %v", d.reported)
+	}
+}
+
+// namedMapper renames a mapper, to chain several of the same backend.
+type namedMapper struct {
+	mapper.Mapper
+	name string
+}
+
+func (m *namedMapper) Name() string { return m.name }
+
+func (m *namedMapper) List() ([]config.IdentityMapping, []string) {
+	return m.Mapper.(mapper.Lister).List()
+}
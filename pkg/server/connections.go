@@ -0,0 +1,39 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// configureConnections applies the keep-alive settings of cfg to srv and, if
+// enableHTTP2, its HTTP/2 settings. HTTP/2 is only negotiated if the TLS
+// listener of srv offers h2.
+func configureConnections(srv *http.Server, cfg *config.Config, enableHTTP2 bool) error {
+	srv.IdleTimeout = cfg.IdleTimeout
+	srv.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+	if !enableHTTP2 {
+		return nil
+	}
+	return http2.ConfigureServer(srv, &http2.Server{
+		MaxConcurrentStreams: uint32(cfg.HTTP2MaxConcurrentStreams),
+		IdleTimeout:          cfg.IdleTimeout,
+	})
+}
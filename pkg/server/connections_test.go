@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func TestConfigureConnections(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		http2         bool
+		expectedProto int
+		expectedClose bool
+	}{
+		{name: "http2", cfg: config.Config{HTTP2MaxConcurrentStreams: 10}, http2: true, expectedProto: 2},
+		{name: "http1", expectedProto: 1},
+		{name: "no keep-alives", cfg: config.Config{DisableKeepAlives: true}, expectedProto: 1, expectedClose: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			if err := configureConnections(srv.Config, &test.cfg, test.http2); err != nil {
+				t.Fatal(err)
+			}
+			srv.TLS = &tls.Config{NextProtos: []string{"http/1.1"}}
+			if test.http2 {
+				srv.TLS.NextProtos = []string{"h2", "http/1.1"}
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			client := srv.Client()
+			client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != test.expectedProto {
+				t.Errorf("expected HTTP/%d, got %s", test.expectedProto, resp.Proto)
+			}
+			if resp.Close != test.expectedClose {
+				t.Errorf("expected the connection to be closed %t, got %t", test.expectedClose, resp.Close)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+// debugMappings is the redacted dump of the mappings of one backend.
+type debugMappings struct {
+	Backend string `json:"backend"`
+	// Listable is false for backends that can't list their mappings.
+	Listable bool                     `json:"listable"`
+	Mappings []config.IdentityMapping `json:"mappings,omitempty"`
+	Accounts []string                 `json:"accounts,omitempty"`
+}
+
+// debugConfig is the load status of the mappings of one backend.
+type debugConfig struct {
+	Backend string `json:"backend"`
+	// Tracked is false for backends that don't track when they load their
+	// mappings, such as those that only load them on startup.
+	Tracked bool `json:"tracked"`
+	mapper.LoadStatus
+}
+
+// newDebugHandler serves pprof profiles under /debug/pprof/, expvar
+// variables at /debug/vars, the loaded mappings of the current mappers, with
+// account IDs redacted, at /debug/mappings and when they were last loaded at
+// /debug/config.
+func newDebugHandler(mappers func() []mapper.Mapper) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/mappings", func(w http.ResponseWriter, r *http.Request) {
+		dump := []debugMappings{}
+		for _, m := range mappers() {
+			mappings, accounts, ok := mapper.List(m)
+			d := debugMappings{Backend: m.Name(), Listable: ok}
+			for _, mapping := range mappings {
+				mapping.IdentityARN = redactARN(mapping.IdentityARN)
+				d.Mappings = append(d.Mappings, mapping)
+			}
+			for _, account := range accounts {
+				d.Accounts = append(d.Accounts, redactAccountID(account))
+			}
+			dump = append(dump, d)
+		}
+		writeDebugJSON(w, dump)
+	})
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		dump := []debugConfig{}
+		for _, m := range mappers() {
+			status, ok := mapper.Status(m)
+			dump = append(dump, debugConfig{Backend: m.Name(), Tracked: ok, LoadStatus: status})
+		}
+		writeDebugJSON(w, dump)
+	})
+	return mux
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// redactAccountID hides all but the last four digits of an account ID, which
+// is enough to tell accounts apart while debugging.
+func redactAccountID(accountID string) string {
+	if len(accountID) <= 4 {
+		return strings.Repeat("*", len(accountID))
+	}
+	return strings.Repeat("*", len(accountID)-4) + accountID[len(accountID)-4:]
+}
+
+// redactARN redacts the account ID of arn.
+func redactARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return arn
+	}
+	parts[4] = redactAccountID(parts[4])
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+)
+
+func TestDebugMappings(t *testing.T) {
+	fileMapper := file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/test": {
+			RoleARN:  "arn:aws:iam::012345678912:role/Test",
+			Username: "test",
+			Groups:   []string{"system:masters"},
+		},
+	}, nil, map[string]bool{"111122223333": true})
+	h := newDebugHandler(func() []mapper.Mapper { return []mapper.Mapper{fileMapper, &unlistableMapper{}} })
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "http://localhost/debug/mappings", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	var dump []debugMappings
+	if err := json.NewDecoder(resp.Body).Decode(&dump); err != nil {
+		t.Fatalf("could not decode the mappings: %v", err)
+	}
+	expected := []debugMappings{
+		{
+			Backend:  mapper.ModeMountedFile,
+			Listable: true,
+			Mappings: []config.IdentityMapping{{
+				IdentityARN: "arn:aws:iam::********8912:role/test",
+				Username:    "test",
+				Groups:      []string{"system:masters"},
+			}},
+			Accounts: []string{"********3333"},
+		},
+		{Backend: "unlistable"},
+	}
+	if !reflect.DeepEqual(dump, expected) {
+		t.Errorf("expected %+v, got %+v", expected, dump)
+	}
+}
+
+func TestDebugConfig(t *testing.T) {
+	h := newDebugHandler(func() []mapper.Mapper { return []mapper.Mapper{&unlistableMapper{}} })
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "http://localhost/debug/config", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	var dump []debugConfig
+	if err := json.NewDecoder(resp.Body).Decode(&dump); err != nil {
+		t.Fatalf("could not decode the load status: %v", err)
+	}
+	expected := []debugConfig{{Backend: "unlistable"}}
+	if !reflect.DeepEqual(dump, expected) {
+		t.Errorf("expected %+v, got %+v", expected, dump)
+	}
+}
+
+func TestDebugPprof(t *testing.T) {
+	resp := httptest.NewRecorder()
+	newDebugHandler(func() []mapper.Mapper { return nil }).ServeHTTP(resp, httptest.NewRequest("GET", "http://localhost/debug/pprof/", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+}
+
+type unlistableMapper struct{}
+
+func (m *unlistableMapper) Name() string                          { return "unlistable" }
+func (m *unlistableMapper) Start(_ <-chan struct{}) error         { return nil }
+func (m *unlistableMapper) IsAccountAllowed(string) (bool, error) { return false, nil }
+func (m *unlistableMapper) Map(string) (*config.IdentityMapping, error) {
+	return nil, mapper.ErrNotMapped
+}
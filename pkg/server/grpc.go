@@ -0,0 +1,322 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/tracing"
+)
+
+// The gRPC API is defined in authenticator.proto. It is served over HTTP/2
+// by net/http with the gRPC wire format implemented here, since only unary
+// calls and a server stream are needed.
+const (
+	grpcAuthenticatePath = "/awsiamauthenticator.v1.Authenticator/Authenticate"
+	grpcHealthCheckPath  = "/grpc.health.v1.Health/Check"
+	grpcHealthWatchPath  = "/grpc.health.v1.Health/Watch"
+
+	// grpcMaxMessageSize bounds request messages, which only carry a token.
+	grpcMaxMessageSize = 64 * 1024
+)
+
+// gRPC status codes, see https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// AuthenticateRequest is the request of Authenticator.Authenticate.
+type AuthenticateRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+}
+
+func (m *AuthenticateRequest) Reset()         { *m = AuthenticateRequest{} }
+func (m *AuthenticateRequest) String() string { return proto.CompactTextString(m) }
+func (*AuthenticateRequest) ProtoMessage()    {}
+
+// AuthenticateResponse is the response of Authenticator.Authenticate. User
+// is only set when Authenticated is, and Reason and Message when it isn't.
+type AuthenticateResponse struct {
+	Authenticated bool      `protobuf:"varint,1,opt,name=authenticated,proto3" json:"authenticated,omitempty"`
+	User          *UserInfo `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Reason        string    `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Message       string    `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (m *AuthenticateResponse) Reset()         { *m = AuthenticateResponse{} }
+func (m *AuthenticateResponse) String() string { return proto.CompactTextString(m) }
+func (*AuthenticateResponse) ProtoMessage()    {}
+
+// UserInfo is the Kubernetes user a token authenticates as, with the same
+// fields as in a TokenReview.
+type UserInfo struct {
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Uid      string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	Groups   []string               `protobuf:"bytes,3,rep,name=groups,proto3" json:"groups,omitempty"`
+	Extra    map[string]*ExtraValue `protobuf:"bytes,4,rep,name=extra,proto3" json:"extra,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *UserInfo) Reset()         { *m = UserInfo{} }
+func (m *UserInfo) String() string { return proto.CompactTextString(m) }
+func (*UserInfo) ProtoMessage()    {}
+
+// ExtraValue holds the values of a user extra.
+type ExtraValue struct {
+	Values []string `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+}
+
+func (m *ExtraValue) Reset()         { *m = ExtraValue{} }
+func (m *ExtraValue) String() string { return proto.CompactTextString(m) }
+func (*ExtraValue) ProtoMessage()    {}
+
+// HealthCheckRequest and HealthCheckResponse are the messages of the
+// standard grpc.health.v1.Health service.
+type HealthCheckRequest struct {
+	Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+}
+
+func (m *HealthCheckRequest) Reset()         { *m = HealthCheckRequest{} }
+func (m *HealthCheckRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthCheckRequest) ProtoMessage()    {}
+
+type HealthCheckResponse struct {
+	Status int32 `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (m *HealthCheckResponse) Reset()         { *m = HealthCheckResponse{} }
+func (m *HealthCheckResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthCheckResponse) ProtoMessage()    {}
+
+// Serving statuses of HealthCheckResponse.
+const (
+	HealthServing    int32 = 1
+	HealthNotServing int32 = 2
+)
+
+// healthStatus is the serving status reported by the health service. Watch
+// streams are notified of changes by closing the changed channel.
+type healthStatus struct {
+	mutex   sync.Mutex
+	status  int32
+	changed chan struct{}
+}
+
+func newHealthStatus() *healthStatus {
+	return &healthStatus{status: HealthServing, changed: make(chan struct{})}
+}
+
+func (s *healthStatus) get() (int32, <-chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status, s.changed
+}
+
+func (s *healthStatus) set(status int32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status == status {
+		return
+	}
+	s.status = status
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// grpcHandler serves the gRPC API. Authenticate calls share the rate
+// limits of the webhook.
+func (h *handler) grpcHandler(limiter *httputil.RequestLimiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(grpcAuthenticatePath, limiter.Handler(grpcUnary(&AuthenticateRequest{}, func(req *http.Request, msg proto.Message) (proto.Message, int, string) {
+		return h.grpcAuthenticate(req, msg.(*AuthenticateRequest)), grpcOK, ""
+	})))
+	mux.Handle(grpcHealthCheckPath, grpcUnary(&HealthCheckRequest{}, func(req *http.Request, msg proto.Message) (proto.Message, int, string) {
+		if service := msg.(*HealthCheckRequest).Service; service != "" && service != "awsiamauthenticator.v1.Authenticator" {
+			return nil, grpcNotFound, fmt.Sprintf("unknown service %q", service)
+		}
+		status, _ := h.health.get()
+		return &HealthCheckResponse{Status: status}, grpcOK, ""
+	}))
+	mux.HandleFunc(grpcHealthWatchPath, h.grpcHealthWatch)
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		startGRPCResponse(w)
+		writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("unknown method %s", req.URL.Path))
+	})
+	return mux
+}
+
+func (h *handler) grpcAuthenticate(req *http.Request, msg *AuthenticateRequest) *AuthenticateResponse {
+	start := time.Now()
+	log := logger.WithFields(logrus.Fields{
+		"path":   req.URL.Path,
+		"client": req.RemoteAddr,
+	})
+	event := audit.Event{
+		Timestamp: start,
+		SourceIP:  sourceIP(req),
+		ClientIP:  h.clientIP(req),
+		Decision:  audit.DecisionDeny,
+	}
+	defer h.logAuditEvent(&event, start)
+
+	ctx, span := h.tracer.Start(tracing.Extract(req.Context(), req.Header), "authenticate", tracing.SpanKindServer)
+	defer func() {
+		span.SetAttribute("authenticate.result", event.Reason)
+		span.SetAttribute("authenticate.decision", event.Decision)
+		span.End()
+	}()
+
+	user, authErr := h.authenticate(ctx, msg.Token, nil, &event, log, start)
+	if authErr != nil {
+		return &AuthenticateResponse{Reason: authErr.Reason, Message: authErr.Message}
+	}
+	extra := map[string]*ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = &ExtraValue{Values: v}
+	}
+	return &AuthenticateResponse{
+		Authenticated: true,
+		User:          &UserInfo{Username: user.Username, Uid: user.UID, Groups: user.Groups, Extra: extra},
+	}
+}
+
+// grpcHealthWatch streams the serving status, sending it again each time it
+// changes, until the client cancels the call.
+func (h *handler) grpcHealthWatch(w http.ResponseWriter, req *http.Request) {
+	if _, code, message := readGRPCRequest(req, &HealthCheckRequest{}); code != grpcOK {
+		startGRPCResponse(w)
+		writeGRPCStatus(w, code, message)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	startGRPCResponse(w)
+	if !ok {
+		writeGRPCStatus(w, grpcInternal, "streaming is not supported")
+		return
+	}
+	for {
+		status, changed := h.health.get()
+		if err := writeGRPCMessage(w, &HealthCheckResponse{Status: status}); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-req.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// grpcUnary serves a unary call, decoding its request into a copy of
+// request and encoding the message returned by call.
+func grpcUnary(request proto.Message, call func(*http.Request, proto.Message) (proto.Message, int, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msg, code, message := readGRPCRequest(req, proto.Clone(request))
+		var resp proto.Message
+		if code == grpcOK {
+			resp, code, message = call(req, msg)
+		}
+		startGRPCResponse(w)
+		if code == grpcOK {
+			if err := writeGRPCMessage(w, resp); err != nil {
+				code, message = grpcInternal, err.Error()
+			}
+		}
+		writeGRPCStatus(w, code, message)
+	})
+}
+
+// readGRPCRequest decodes the single length-prefixed message of a request.
+func readGRPCRequest(req *http.Request, msg proto.Message) (proto.Message, int, string) {
+	if req.Method != http.MethodPost || req.ProtoMajor != 2 {
+		return nil, grpcInvalidArgument, "gRPC requires POST over HTTP/2"
+	}
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(req.Body, header); err != nil {
+		return nil, grpcInvalidArgument, "could not read the request message"
+	}
+	if header[0] != 0 {
+		return nil, grpcUnimplemented, "compressed messages are not supported"
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > grpcMaxMessageSize {
+		return nil, grpcInvalidArgument, "request message is too large"
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(length)))
+	if err != nil || len(data) != int(length) {
+		return nil, grpcInvalidArgument, "could not read the request message"
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, grpcInvalidArgument, fmt.Sprintf("could not decode the request message: %v", err)
+	}
+	return msg, grpcOK, ""
+}
+
+func startGRPCResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.Header().Add("Trailer", "Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeGRPCMessage(w io.Writer, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	_, err = w.Write(append(frame, data...))
+	return err
+}
+
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+}
+
+// encodeGRPCMessage percent-encodes the bytes of message that aren't
+// printable ASCII, as required for the Grpc-Message trailer.
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
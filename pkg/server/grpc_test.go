@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func startGRPCTestServer(t *testing.T, h *handler) *httptest.Server {
+	t.Helper()
+	h.health = newHealthStatus()
+	srv := httptest.NewUnstartedServer(h.grpcHandler(httputil.NewRequestLimiter(httputil.LimiterOptions{})))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	return srv
+}
+
+func grpcFrame(t *testing.T, msg proto.Message) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeGRPCMessage(&buf, msg); err != nil {
+		t.Fatalf("could not encode message: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func readGRPCFrame(t *testing.T, r io.Reader, msg proto.Message) {
+	t.Helper()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatalf("could not read message header: %v", err)
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatalf("could not read message: %v", err)
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		t.Fatalf("could not decode message: %v", err)
+	}
+}
+
+func grpcCall(t *testing.T, srv *httptest.Server, path string, req, resp proto.Message) string {
+	t.Helper()
+	r, err := srv.Client().Post(srv.URL+path, "application/grpc", bytes.NewReader(grpcFrame(t, req)))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	defer r.Body.Close()
+	if r.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", r.Proto)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if status := r.Trailer.Get("Grpc-Status"); status != "0" {
+		return status
+	}
+	readGRPCFrame(t, bytes.NewReader(body), resp)
+	return "0"
+}
+
+func TestGRPCAuthenticate(t *testing.T) {
+	identity := &token.Identity{
+		ARN:          "arn:aws:iam::0123456789012:role/Test",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+		UserID:       "Test",
+		SessionName:  "TestSession",
+		AccessKeyID:  "ABCDEF",
+	}
+	h := setup(&testVerifier{identity: identity})
+	defer cleanup(h.metrics)
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::0123456789012:role/test": {
+			RoleARN:  "arn:aws:iam::0123456789012:role/Test",
+			Username: "TestUser",
+			Groups:   []string{"sys:admin", "listers"},
+		},
+	}, nil, nil)}
+	srv := startGRPCTestServer(t, h)
+	defer srv.Close()
+
+	var resp AuthenticateResponse
+	if status := grpcCall(t, srv, grpcAuthenticatePath, &AuthenticateRequest{Token: "token"}, &resp); status != "0" {
+		t.Fatalf("expected status 0, got %s", status)
+	}
+	if !resp.Authenticated || resp.User.Username != "TestUser" || resp.User.Uid != "aws-iam-authenticator:0123456789012:Test" ||
+		len(resp.User.Groups) != 2 || resp.User.Extra["sessionName"].Values[0] != "TestSession" {
+		t.Errorf("unexpected response %v", resp.String())
+	}
+	validateMetrics(t, validateOpts{success: 1})
+
+	h.mappers = nil
+	resp = AuthenticateResponse{}
+	if status := grpcCall(t, srv, grpcAuthenticatePath, &AuthenticateRequest{Token: "token"}, &resp); status != "0" {
+		t.Fatalf("expected status 0, got %s", status)
+	}
+	if resp.Authenticated || resp.User != nil {
+		t.Errorf("expected an unmapped identity not to be authenticated, got %v", resp.String())
+	}
+	if resp.Reason != ReasonUnmappedARN {
+		t.Errorf("expected reason %q, got %q", ReasonUnmappedARN, resp.Reason)
+	}
+
+	if status := grpcCall(t, srv, "/awsiamauthenticator.v1.Authenticator/Nope", &AuthenticateRequest{}, &resp); status != "12" {
+		t.Errorf("expected status 12 for an unknown method, got %s", status)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	h := setup(&testVerifier{})
+	defer cleanup(h.metrics)
+	srv := startGRPCTestServer(t, h)
+	defer srv.Close()
+
+	var resp HealthCheckResponse
+	if status := grpcCall(t, srv, grpcHealthCheckPath, &HealthCheckRequest{}, &resp); status != "0" || resp.Status != HealthServing {
+		t.Errorf("expected SERVING, got status %s and %v", status, resp.String())
+	}
+	if status := grpcCall(t, srv, grpcHealthCheckPath, &HealthCheckRequest{Service: "other"}, &resp); status != "5" {
+		t.Errorf("expected status 5 for an unknown service, got %s", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+grpcHealthWatchPath, bytes.NewReader(grpcFrame(t, &HealthCheckRequest{})))
+	r, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	defer r.Body.Close()
+	stream := bufio.NewReader(r.Body)
+	readGRPCFrame(t, stream, &resp)
+	if resp.Status != HealthServing {
+		t.Errorf("expected the watch to start with SERVING, got %v", resp.String())
+	}
+	h.health.set(HealthNotServing)
+	readGRPCFrame(t, stream, &resp)
+	if resp.Status != HealthNotServing {
+		t.Errorf("expected the watch to report NOT_SERVING, got %v", resp.String())
+	}
+}
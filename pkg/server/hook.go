@@ -0,0 +1,221 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/tracing"
+)
+
+// What happens to identities when the post-mapping hook can't be called or
+// answers with an error.
+const (
+	// HookFailureAllow authenticates them with the mapped groups.
+	HookFailureAllow = "allow"
+	// HookFailureDeny denies them.
+	HookFailureDeny = "deny"
+)
+
+// HookFailurePolicies are the valid post-mapping hook failure policies.
+var HookFailurePolicies = []string{HookFailureAllow, HookFailureDeny}
+
+// maxHookResponseSize bounds the responses of the post-mapping hook read.
+const maxHookResponseSize = 1 << 20
+
+// PostMappingRequest is the JSON body POSTed to the post-mapping hook for
+// each mapped identity. The AWS identity is omitted for scrubbed accounts.
+type PostMappingRequest struct {
+	Username      string   `json:"username"`
+	Groups        []string `json:"groups"`
+	ARN           string   `json:"arn,omitempty"`
+	CanonicalARN  string   `json:"canonicalArn,omitempty"`
+	AccountID     string   `json:"accountId,omitempty"`
+	UserID        string   `json:"userId,omitempty"`
+	SessionName   string   `json:"sessionName,omitempty"`
+	MappingSource string   `json:"mappingSource"`
+}
+
+// PostMappingResponse is the JSON body the post-mapping hook answers with. An
+// empty object authenticates the identity as mapped.
+type PostMappingResponse struct {
+	// Deny denies the identity, for Reason.
+	Deny   bool   `json:"deny,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// RemoveGroups are removed from the mapped groups, then AddGroups are
+	// added to them.
+	RemoveGroups []string `json:"removeGroups,omitempty"`
+	AddGroups    []string `json:"addGroups,omitempty"`
+}
+
+// postMappingHook calls an external webhook after identities are mapped, so
+// entitlement systems can change their groups or deny them.
+type postMappingHook struct {
+	url           string
+	client        *http.Client
+	timeout       time.Duration
+	failurePolicy string
+}
+
+func newPostMappingHook(c config.Config) (*postMappingHook, error) {
+	transport, err := httputil.NewTransport(httputil.TransportOptions{CABundle: c.PostMappingHookCABundle})
+	if err != nil {
+		return nil, err
+	}
+	return &postMappingHook{
+		url:           c.PostMappingHookURL,
+		client:        &http.Client{Transport: transport},
+		timeout:       c.PostMappingHookTimeout,
+		failurePolicy: c.PostMappingHookFailurePolicy,
+	}, nil
+}
+
+// ValidatePostMappingHookURL checks that hookURL is an absolute HTTP or HTTPS
+// URL.
+func ValidatePostMappingHookURL(hookURL string) error {
+	parsed, err := url.Parse(hookURL)
+	if err != nil {
+		return fmt.Errorf("invalid post-mapping hook URL %q: %v", hookURL, err)
+	}
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("post-mapping hook URL %q must be an absolute http or https URL", hookURL)
+	}
+	return nil
+}
+
+// call POSTs review to the hook and returns its response.
+func (hook *postMappingHook) call(ctx context.Context, review *PostMappingRequest) (*PostMappingResponse, error) {
+	if hook.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.timeout)
+		defer cancel()
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHookResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("post-mapping hook answered %s", resp.Status)
+	}
+	var response PostMappingResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("could not parse the post-mapping hook response: %v", err)
+	}
+	return &response, nil
+}
+
+// applyPostMappingHook calls the post-mapping hook for the identity mapped to
+// username and groups by the backend source, and returns the groups to
+// authenticate it with. If the identity is denied, it returns the reason and
+// message of the denial.
+func (h *handler) applyPostMappingHook(ctx context.Context, identity *token.Identity, username string, groups []string, source string, log *logrus.Entry) ([]string, string, string) {
+	ctx, span := h.tracer.Start(ctx, "postMappingHook", tracing.SpanKindClient)
+	defer span.End()
+
+	review := &PostMappingRequest{Username: username, Groups: groups, MappingSource: source}
+	if groups == nil {
+		review.Groups = []string{}
+	}
+	if h.isLoggableIdentity(identity) {
+		review.ARN = identity.ARN
+		review.CanonicalARN = identity.CanonicalARN
+		review.AccountID = identity.AccountID
+		review.UserID = identity.UserID
+		review.SessionName = identity.SessionName
+	}
+	response, err := h.postMappingHook.call(ctx, review)
+	span.RecordError(err)
+	if err != nil {
+		authmetrics.PostMappingHookCalls.WithLabelValues(authmetrics.HookError).Inc()
+		if h.postMappingHook.failurePolicy == HookFailureAllow {
+			log.WithError(err).Warn("post-mapping hook failed, authenticating with the mapped groups")
+			return groups, "", ""
+		}
+		log.WithError(err).Warn("access denied: post-mapping hook failed")
+		return nil, ReasonHookError, "the post-mapping hook failed"
+	}
+	if response.Deny {
+		authmetrics.PostMappingHookCalls.WithLabelValues(authmetrics.HookDenied).Inc()
+		log.WithField("reason", response.Reason).Warn("access denied: post-mapping hook denied the identity")
+		message := "the post-mapping hook denied the identity"
+		if response.Reason != "" {
+			message += ": " + response.Reason
+		}
+		return nil, ReasonHookDenied, message
+	}
+	authmetrics.PostMappingHookCalls.WithLabelValues(authmetrics.HookAllowed).Inc()
+	if len(response.RemoveGroups) == 0 && len(response.AddGroups) == 0 {
+		return groups, "", ""
+	}
+	log.WithFields(logrus.Fields{
+		"removeGroups": response.RemoveGroups,
+		"addGroups":    response.AddGroups,
+	}).Info("post-mapping hook changed the groups")
+	return changeGroups(groups, response.RemoveGroups, response.AddGroups), "", ""
+}
+
+// changeGroups returns groups without remove, followed by the groups of add
+// it doesn't hold yet.
+func changeGroups(groups, remove, add []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, group := range remove {
+		removed[group] = true
+	}
+	var changed []string
+	held := map[string]bool{}
+	for _, group := range groups {
+		if !removed[group] {
+			changed = append(changed, group)
+			held[group] = true
+		}
+	}
+	for _, group := range add {
+		if !held[group] {
+			changed = append(changed, group)
+			held[group] = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func TestAuthenticatePostMappingHook(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		status        int
+		response      string
+		delay         time.Duration
+		failurePolicy string
+		wantReason    string
+		wantGroups    []string
+	}{
+		{"keep groups", http.StatusOK, `{}`, 0, HookFailureDeny, "", []string{"developers", "viewers"}},
+		{"change groups", http.StatusOK, `{"removeGroups":["viewers"],"addGroups":["payments","developers"]}`, 0, HookFailureDeny, "", []string{"developers", "payments"}},
+		{"deny", http.StatusOK, `{"deny":true,"reason":"offboarded"}`, 0, HookFailureDeny, ReasonHookDenied, nil},
+		{"error fails closed", http.StatusInternalServerError, `{}`, 0, HookFailureDeny, ReasonHookError, nil},
+		{"error fails open", http.StatusInternalServerError, `{}`, 0, HookFailureAllow, "", []string{"developers", "viewers"}},
+		{"invalid response", http.StatusOK, `[]`, 0, HookFailureDeny, ReasonHookError, nil},
+		{"timeout", http.StatusOK, `{}`, time.Second, HookFailureDeny, ReasonHookError, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			reviews := make(chan PostMappingRequest, 1)
+			hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var review PostMappingRequest
+				if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+					t.Errorf("could not decode the hook request: %v", err)
+				}
+				reviews <- review
+				select {
+				case <-time.After(c.delay):
+				case <-r.Context().Done():
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.response))
+			}))
+			defer hook.Close()
+
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:sts::123456789012:assumed-role/Developer/alice",
+				CanonicalARN: "arn:aws:iam::123456789012:role/Developer",
+				AccountID:    "123456789012",
+				SessionName:  "alice",
+			}})
+			defer cleanup(h.metrics)
+			h.postMappingHook = &postMappingHook{
+				url:           hook.URL,
+				client:        hook.Client(),
+				timeout:       100 * time.Millisecond,
+				failurePolicy: c.failurePolicy,
+			}
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::123456789012:role/developer": {RoleARN: "arn:aws:iam::123456789012:role/Developer", Username: "developer", Groups: []string{"developers", "viewers"}},
+			}, nil, nil)}
+			user, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+
+			review := <-reviews
+			if review.Username != "developer" || !reflect.DeepEqual(review.Groups, []string{"developers", "viewers"}) || review.SessionName != "alice" || review.MappingSource != mapper.ModeMountedFile {
+				t.Errorf("unexpected hook request %+v", review)
+			}
+			if c.wantReason != "" {
+				if authErr == nil {
+					t.Fatalf("expected the identity to be denied with the reason %q", c.wantReason)
+				}
+				if authErr.Reason != c.wantReason {
+					t.Errorf("expected the reason %q, got %q", c.wantReason, authErr.Reason)
+				}
+				return
+			}
+			if authErr != nil {
+				t.Fatalf("expected the identity to be authenticated, got %v", authErr)
+			}
+			if !reflect.DeepEqual(user.Groups, c.wantGroups) {
+				t.Errorf("expected groups %v, got %v", c.wantGroups, user.Groups)
+			}
+		})
+	}
+}
+
+func TestValidatePostMappingHookURL(t *testing.T) {
+	for _, c := range []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://entitlements.example.com/kubernetes", false},
+		{"http://localhost:8080", false},
+		{"entitlements.example.com", true},
+		{"ftp://entitlements.example.com", true},
+		{"https://", true},
+	} {
+		if err := ValidatePostMappingHookURL(c.url); (err != nil) != c.wantErr {
+			t.Errorf("ValidatePostMappingHookURL(%q) = %v, want error %v", c.url, err, c.wantErr)
+		}
+	}
+}
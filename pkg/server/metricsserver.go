@@ -0,0 +1,91 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// newMetricsListener opens the dedicated metrics listener on MetricsAddress
+// and MetricsPort, with TLS if a metrics certificate is configured.
+func newMetricsListener(cfg *config.Config) (net.Listener, error) {
+	addr := net.JoinHostPort(cfg.MetricsAddress, strconv.Itoa(cfg.MetricsPort))
+	if cfg.MetricsTLSCertFile == "" {
+		return net.Listen("tcp", addr)
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.MetricsTLSCertFile, cfg.MetricsTLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the metrics certificate: %v", err)
+	}
+	return tls.Listen("tcp", addr, &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	})
+}
+
+// newMetricsHandler serves the Prometheus metrics, requiring the bearer
+// token in MetricsBearerTokenFile if one is configured.
+func newMetricsHandler(cfg *config.Config) (http.Handler, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if cfg.MetricsBearerTokenFile == "" {
+		return mux, nil
+	}
+	token, err := readBearerToken(cfg.MetricsBearerTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the metrics bearer token: %v", err)
+	}
+	return bearerAuth(token, mux), nil
+}
+
+// readBearerToken reads a bearer token from path, ignoring surrounding
+// whitespace.
+func readBearerToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%q is empty", path)
+	}
+	return token, nil
+}
+
+// bearerAuth only passes requests that send token as their bearer token on
+// to next.
+func bearerAuth(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+func TestMetricsHandlerBearerToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := newMetricsHandler(&config.Config{MetricsBearerTokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		authorization string
+		wantCode      int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	} {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://k8s.io/metrics", nil)
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		h.ServeHTTP(resp, req)
+		if resp.Code != c.wantCode {
+			t.Errorf("Authorization %q: expected status code %d, was %d", c.authorization, c.wantCode, resp.Code)
+		}
+	}
+
+	if err := ioutil.WriteFile(tokenFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newMetricsHandler(&config.Config{MetricsBearerTokenFile: tokenFile}); err == nil {
+		t.Error("expected an error for an empty token file")
+	}
+}
+
+func TestMetricsHandlerUnauthenticated(t *testing.T) {
+	h, err := newMetricsHandler(&config.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "http://k8s.io/metrics", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+}
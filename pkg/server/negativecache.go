@@ -0,0 +1,86 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// negativeCacheJitter is the fraction of the TTL randomly added to each
+	// entry, so entries added in a burst don't all expire, and go back to
+	// STS, at once.
+	negativeCacheJitter = 0.2
+	// negativeCacheMaxEntries bounds the memory used by the cache. Tokens
+	// aren't cached once it is full.
+	negativeCacheMaxEntries = 10000
+	// negativeCacheSweepInterval is how often expired entries are removed.
+	negativeCacheSweepInterval = time.Minute
+)
+
+// negativeCache remembers tokens that were verified but not mapped, so a
+// client that keeps resending one is rejected without calling STS again.
+// Tokens are stored hashed.
+type negativeCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[[sha256.Size]byte]time.Time
+	lastSweep time.Time
+	rand      *rand.Rand
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{
+		ttl:     ttl,
+		entries: map[[sha256.Size]byte]time.Time{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// hit returns whether tok was found unmapped within the TTL.
+func (c *negativeCache) hit(tok string, now time.Time) bool {
+	key := sha256.Sum256([]byte(tok))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.entries[key]
+	return ok && now.Before(expires)
+}
+
+// add records that tok was found unmapped.
+func (c *negativeCache) add(tok string, now time.Time) {
+	key := sha256.Sum256([]byte(tok))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > negativeCacheSweepInterval {
+		for k, expires := range c.entries {
+			if !now.Before(expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	if len(c.entries) >= negativeCacheMaxEntries {
+		return
+	}
+	jitter := time.Duration(c.rand.Float64() * negativeCacheJitter * float64(c.ttl))
+	c.entries[key] = now.Add(c.ttl + jitter)
+}
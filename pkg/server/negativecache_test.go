@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+type countingVerifier struct {
+	testVerifier
+	calls int
+}
+
+func (v *countingVerifier) Verify(tok string) (*token.Identity, error) {
+	v.calls++
+	return v.testVerifier.Verify(tok)
+}
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	c := newNegativeCache(10 * time.Second)
+	now := time.Now()
+	c.add("token", now)
+	if !c.hit("token", now.Add(9*time.Second)) {
+		t.Errorf("expected a hit within the TTL")
+	}
+	if c.hit("other", now) {
+		t.Errorf("expected no hit for another token")
+	}
+	if c.hit("token", now.Add(12*time.Second+time.Millisecond)) {
+		t.Errorf("expected no hit after the TTL and the maximum jitter")
+	}
+}
+
+func TestAuthenticateNegativeCache(t *testing.T) {
+	verifier := &countingVerifier{testVerifier: testVerifier{identity: &token.Identity{
+		ARN:          "arn:aws:iam::0123456789012:role/Test",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+	}}}
+	h := setup(verifier)
+	defer cleanup(h.metrics)
+	h.negative = newNegativeCache(time.Minute)
+	roles := map[string]config.RoleMapping{}
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(roles, nil, nil)}
+	authenticate := func(tok string) bool {
+		_, authErr := h.authenticate(context.Background(), tok, nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+		return authErr == nil
+	}
+
+	if authenticate("token") || authenticate("token") {
+		t.Fatalf("expected the unmapped identity to be denied")
+	}
+	if verifier.calls != 1 {
+		t.Errorf("expected a single verification of a token found unmapped, got %d", verifier.calls)
+	}
+
+	// a new mapping applies to new tokens right away
+	roles["arn:aws:iam::0123456789012:role/test"] = config.RoleMapping{RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "test"}
+	if !authenticate("new-token") {
+		t.Errorf("expected a new token of the mapped identity to be authenticated")
+	}
+}
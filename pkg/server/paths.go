@@ -0,0 +1,69 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// reservedPaths are served by the server besides the authentication webhook.
+var reservedPaths = map[string]bool{
+	"/healthz":            true,
+	"/metrics":            true,
+	MappingsPath:          true,
+	AWSAuthValidationPath: true,
+	grpcAuthenticatePath:  true,
+	grpcHealthCheckPath:   true,
+	grpcHealthWatchPath:   true,
+}
+
+// ValidateAuthenticatePaths checks the paths the authentication webhook is
+// configured to be served on are distinct, exact paths that don't shadow
+// another endpoint of the server.
+func ValidateAuthenticatePaths(paths []string) error {
+	seen := map[string]bool{}
+	for _, path := range paths {
+		u, err := url.Parse(path)
+		if err != nil || u.Path != path || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid authenticate path %q: expected an absolute URL path such as %s", path, config.DefaultAuthenticatePath)
+		}
+		if strings.HasSuffix(path, "/") {
+			return fmt.Errorf("invalid authenticate path %q: it must not end with a slash, which would serve every path below it", path)
+		}
+		if reservedPaths[path] || strings.HasPrefix(path, "/debug/") {
+			return fmt.Errorf("invalid authenticate path %q: it is used by another endpoint", path)
+		}
+		if seen[path] {
+			return fmt.Errorf("authenticate path %q is listed twice", path)
+		}
+		seen[path] = true
+	}
+	return nil
+}
+
+// authenticatePaths returns the configured paths of the authentication
+// webhook, or the default one.
+func authenticatePaths(paths []string) []string {
+	if len(paths) == 0 {
+		return []string{config.DefaultAuthenticatePath}
+	}
+	return paths
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestValidateAuthenticatePaths(t *testing.T) {
+	tests := []struct {
+		paths []string
+		valid bool
+	}{
+		{paths: nil, valid: true},
+		{paths: []string{"/authenticate"}, valid: true},
+		{paths: []string{"/authenticate", "/v1/authenticate"}, valid: true},
+		{paths: []string{"authenticate"}},
+		{paths: []string{""}},
+		{paths: []string{"/"}},
+		{paths: []string{"/v1/"}},
+		{paths: []string{"/authenticate?version=1"}},
+		{paths: []string{"/healthz"}},
+		{paths: []string{MappingsPath}},
+		{paths: []string{"/debug/authenticate"}},
+		{paths: []string{"/authenticate", "/authenticate"}},
+	}
+	for _, test := range tests {
+		err := ValidateAuthenticatePaths(test.paths)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("paths %q: expected valid %t, got error %v", test.paths, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamapi"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/kubeclient"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
+)
+
+// PreflightResult is the outcome of one pre-flight check.
+type PreflightResult struct {
+	// Check names what was checked.
+	Check string
+	// Detail describes what was found, or why the check was skipped.
+	Detail string
+	// Err is why the check failed, if it did.
+	Err error
+}
+
+// preflight checks that a server with cfg would be able to start and serve.
+type preflight struct {
+	cfg config.Config
+	// callerIdentity returns the ARN of the AWS credentials of the server.
+	callerIdentity func() (string, error)
+	// kube returns a client of the API server.
+	kube func() (kubernetes.Interface, error)
+	now  func() time.Time
+}
+
+// Preflight checks the AWS credentials, API server access, serving
+// certificate and state directory a server with cfg needs, without starting
+// it, for use in an init container. It returns the results of all checks.
+func Preflight(cfg config.Config) []PreflightResult {
+	p := &preflight{
+		cfg: cfg,
+		callerIdentity: func() (string, error) {
+			sess, err := session.NewSession(aws.NewConfig().WithRegion(iamapi.GlobalRegion(cfg.PartitionID, endpoints.StsServiceID)))
+			if err != nil {
+				return "", err
+			}
+			identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			if err != nil {
+				return "", err
+			}
+			return aws.StringValue(identity.Arn), nil
+		},
+		kube: func() (kubernetes.Interface, error) {
+			return kubeclient.NewClientset(cfg)
+		},
+		now: time.Now,
+	}
+	return p.run()
+}
+
+func (p *preflight) run() []PreflightResult {
+	return []PreflightResult{
+		p.checkSTS(),
+		p.checkKubeAPI(),
+		p.checkStateDir(),
+		p.checkCertificate(),
+	}
+}
+
+// checkSTS calls sts:GetCallerIdentity with the credentials of the server,
+// which backends such as EC2 node lookups and IAM groups use.
+func (p *preflight) checkSTS() PreflightResult {
+	result := PreflightResult{Check: "sts"}
+	arn, err := p.callerIdentity()
+	if err != nil {
+		result.Err = fmt.Errorf("sts:GetCallerIdentity failed: %v", err)
+		return result
+	}
+	result.Detail = "credentials of " + arn
+	return result
+}
+
+// usesKubeAPI reports whether a server with cfg calls the API server.
+func (p *preflight) usesKubeAPI() bool {
+	if p.cfg.TLSSecret != "" {
+		return true
+	}
+	for _, mode := range p.cfg.BackendMode {
+		switch mode {
+		case mapper.ModeConfigMap, mapper.ModeEKSConfigMap, mapper.ModeCRD:
+			return true
+		}
+	}
+	return false
+}
+
+// checkKubeAPI reaches the API server and reads the aws-auth ConfigMap if
+// the server would watch it.
+func (p *preflight) checkKubeAPI() PreflightResult {
+	result := PreflightResult{Check: "kube-api"}
+	if !p.usesKubeAPI() {
+		result.Detail = "skipped: no backend or TLS secret uses the API server"
+		return result
+	}
+	client, err := p.kube()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		result.Err = fmt.Errorf("could not reach the API server: %v", err)
+		return result
+	}
+	result.Detail = "API server " + version.GitVersion
+	for _, mode := range p.cfg.BackendMode {
+		if mode != mapper.ModeConfigMap && mode != mapper.ModeEKSConfigMap {
+			continue
+		}
+		namespace, name := configmap.Location(p.cfg)
+		_, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			result.Err = fmt.Errorf("could not read ConfigMap %s/%s: %v", namespace, name, err)
+			return result
+		}
+		result.Detail += fmt.Sprintf(", ConfigMap %s/%s readable", namespace, name)
+		break
+	}
+	return result
+}
+
+// checkStateDir checks the server can write its certificate and kubeconfig
+// to the state directory.
+func (p *preflight) checkStateDir() PreflightResult {
+	result := PreflightResult{Check: "state-dir"}
+	dir := p.cfg.StateDir
+	info, err := os.Stat(dir)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if !info.IsDir() {
+		result.Err = fmt.Errorf("%s is not a directory", dir)
+		return result
+	}
+	f, err := ioutil.TempFile(dir, ".preflight")
+	if err != nil {
+		result.Err = fmt.Errorf("%s is not writable: %v", dir, err)
+		return result
+	}
+	f.Close()
+	os.Remove(f.Name())
+	result.Detail = dir + " is writable"
+	return result
+}
+
+// checkCertificate checks the serving certificate, if there is one yet, is
+// valid, and that the client CA bundle can be loaded.
+func (p *preflight) checkCertificate() PreflightResult {
+	result := PreflightResult{Check: "certificate"}
+	if _, err := p.cfg.LoadClientCAs(); err != nil {
+		result.Err = err
+		return result
+	}
+	var cert *tls.Certificate
+	var err error
+	if p.cfg.TLSSecret != "" {
+		cert, err = p.secretCertificate()
+	} else {
+		cert, err = p.cfg.LoadExistingCertificate()
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if cert == nil {
+		result.Detail = "none yet, a self-signed certificate will be generated"
+		return result
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	now := p.now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		result.Err = fmt.Errorf("certificate is only valid from %s to %s", leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+		return result
+	}
+	result.Detail = "valid until " + leaf.NotAfter.Format(time.RFC3339)
+	return result
+}
+
+// secretCertificate returns the certificate of the TLS secret.
+func (p *preflight) secretCertificate() (*tls.Certificate, error) {
+	parts := strings.Split(p.cfg.TLSSecret, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("TLS secret %q must be of the form namespace/name", p.cfg.TLSSecret)
+	}
+	client, err := p.kube()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.CoreV1().Secrets(parts[0]).Get(parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get TLS secret %q: %v", p.cfg.TLSSecret, err)
+	}
+	cert, _, err := certificateFromSecret(secret)
+	return cert, err
+}
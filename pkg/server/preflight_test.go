@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+func TestPreflight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.Config{
+		StateDir:    dir,
+		Address:     "127.0.0.1",
+		Hostname:    "localhost",
+		BackendMode: []string{mapper.ModeMountedFile, mapper.ModeEKSConfigMap},
+	}
+	client := fake.NewSimpleClientset()
+	now := time.Now()
+	p := &preflight{
+		cfg:            cfg,
+		callerIdentity: func() (string, error) { return "arn:aws:iam::111122223333:role/Authenticator", nil },
+		kube:           func() (kubernetes.Interface, error) { return client, nil },
+		now:            func() time.Time { return now },
+	}
+	failed := func(results []PreflightResult) map[string]bool {
+		checks := map[string]bool{}
+		for _, result := range results {
+			if result.Err != nil {
+				checks[result.Check] = true
+			}
+		}
+		return checks
+	}
+
+	// a missing ConfigMap and certificate are created by the server
+	if checks := failed(p.run()); len(checks) != 0 {
+		t.Errorf("expected all checks to pass, got failures %v", checks)
+	}
+
+	if _, err := p.cfg.GetOrCreateCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(200 * 365 * 24 * time.Hour)
+	p.callerIdentity = func() (string, error) { return "", errors.New("no credentials") }
+	client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "aws-auth", errors.New("denied"))
+	})
+	p.cfg.StateDir = filepath.Join(dir, "missing")
+	checks := failed(p.run())
+	for _, check := range []string{"sts", "kube-api", "state-dir"} {
+		if !checks[check] {
+			t.Errorf("expected check %s to fail", check)
+		}
+	}
+
+	p.cfg.StateDir = dir
+	if result := p.checkCertificate(); result.Err == nil {
+		t.Errorf("expected an expired certificate to fail, got %q", result.Detail)
+	}
+
+	p.cfg.BackendMode = []string{mapper.ModeMountedFile}
+	if result := p.checkKubeAPI(); result.Err != nil {
+		t.Errorf("expected the API server check to be skipped without a backend using it, got %v", result.Err)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// Reason codes of failed authentications. They are reported in the
+// status.error of TokenReview responses and the reason of gRPC responses,
+// and label the authentication_failures_total metric.
+const (
+	// ReasonMalformedToken is a token that isn't a well-formed presigned
+	// sts:GetCallerIdentity request for an accepted STS endpoint.
+	ReasonMalformedToken = "malformed-token"
+	// ReasonExpired is a token presigned too long ago.
+	ReasonExpired = "expired"
+	// ReasonClockSkew is a token presigned further in the future than the
+	// allowed clock skew.
+	ReasonClockSkew = "skew"
+	// ReasonBadClusterID is a token signed for another cluster ID, or for
+	// none of the requested audiences.
+	ReasonBadClusterID = "bad-cluster-id"
+	// ReasonBadSourceIP is a token bound to another source IP.
+	ReasonBadSourceIP = "bad-source-ip"
+	// ReasonBadRegion is a token signed for an STS region that isn't
+	// allowed.
+	ReasonBadRegion = "bad-region"
+	// ReasonLongLivedKey is a token signed with a long-lived access key while
+	// only temporary credentials are accepted.
+	ReasonLongLivedKey = "long-lived-key"
+	// ReasonSTSUnreachable is a token that couldn't be verified because STS
+	// couldn't be reached, failed or throttled the server.
+	ReasonSTSUnreachable = "sts-unreachable"
+	// ReasonTimeout is a token that couldn't be verified before the
+	// request deadline or the authentication timeout.
+	ReasonTimeout = "timeout"
+	// ReasonSTSRejected is a token STS rejected, such as one signed with
+	// expired or revoked credentials.
+	ReasonSTSRejected = "sts-rejected"
+	// ReasonReplayed is a token rejected by replay detection.
+	ReasonReplayed = "replayed"
+	// ReasonBadSessionName is a role session whose name doesn't match the
+	// session name policies of the role.
+	ReasonBadSessionName = "bad-session-name"
+	// ReasonUnmappedARN is an identity no backend maps.
+	ReasonUnmappedARN = "unmapped-arn"
+	// ReasonMappingError is an identity that couldn't be mapped because a
+	// backend failed.
+	ReasonMappingError = "mapping-error"
+	// ReasonUnsafeGroups is a mapping rejected for granting reserved groups.
+	ReasonUnsafeGroups = "unsafe-groups"
+	// ReasonInvalidGroups is a mapping rejected for granting groups over
+	// the group limits.
+	ReasonInvalidGroups = "invalid-groups"
+	// ReasonHookDenied is an identity the post-mapping hook denied.
+	ReasonHookDenied = "hook-denied"
+	// ReasonHookError is an identity denied because the post-mapping hook
+	// failed and its failure policy is deny.
+	ReasonHookError = "hook-error"
+)
+
+// AuthenticationError is the schema of the status.error of failed
+// TokenReviews, which is this object encoded as JSON.
+type AuthenticationError struct {
+	// Reason is one of the Reason constants.
+	Reason string `json:"reason"`
+	// Message describes the failure for people.
+	Message string `json:"message"`
+}
+
+// String returns the JSON encoding of e.
+func (e *AuthenticationError) String() string {
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+// ParseAuthenticationError parses the status.error of a TokenReview response
+// from the server.
+func ParseAuthenticationError(s string) (*AuthenticationError, error) {
+	var e AuthenticationError
+	if err := json.Unmarshal([]byte(s), &e); err != nil {
+		return nil, err
+	}
+	if e.Reason == "" {
+		return nil, fmt.Errorf("no reason in %q", s)
+	}
+	return &e, nil
+}
+
+// tokenErrorReasons are the reason codes of the token verification errors.
+var tokenErrorReasons = map[string]string{
+	token.ReasonExpired:           ReasonExpired,
+	token.ReasonClockSkew:         ReasonClockSkew,
+	token.ReasonMissingClusterID:  ReasonBadClusterID,
+	token.ReasonClusterIDMismatch: ReasonBadClusterID,
+	token.ReasonSourceIP:          ReasonBadSourceIP,
+	token.ReasonInvalidRegion:     ReasonBadRegion,
+	token.ReasonLongLivedKey:      ReasonLongLivedKey,
+	token.ReasonSTSUnreachable:    ReasonSTSUnreachable,
+	token.ReasonSTSTimeout:        ReasonTimeout,
+	token.ReasonSTSRejected:       ReasonSTSRejected,
+	token.ReasonSTSError:          ReasonSTSRejected,
+}
+
+// tokenErrorReason returns the reason code of an error verifying a token.
+func tokenErrorReason(err error) string {
+	var reason string
+	switch e := err.(type) {
+	case token.FormatError:
+		reason = e.Reason()
+	case token.STSError:
+		reason = e.Reason()
+	}
+	if code, ok := tokenErrorReasons[reason]; ok {
+		return code
+	}
+	return ReasonMalformedToken
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func TestTokenErrorReason(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want string
+	}{
+		{errors.New("boom"), ReasonMalformedToken},
+		{token.FormatError{}, ReasonMalformedToken},
+		{token.NewSTSError("denied"), ReasonSTSRejected},
+	} {
+		if got := tokenErrorReason(c.err); got != c.want {
+			t.Errorf("tokenErrorReason(%#v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestParseAuthenticationError(t *testing.T) {
+	want := &AuthenticationError{Reason: ReasonExpired, Message: "token expired"}
+	got, err := ParseAuthenticationError(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"", "not json", `{"message":"no reason"}`} {
+		if _, err := ParseAuthenticationError(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
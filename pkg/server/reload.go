@@ -0,0 +1,100 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// reloadable are the settings of the handler that reload replaces.
+type reloadable struct {
+	verifier         token.Verifier
+	mappers          []mapper.Mapper
+	shadowMappers    []mapper.Mapper
+	unmapped         *unmappedFallback
+	scrubbedAccounts []string
+}
+
+// current returns the reloadable settings requests are served with.
+func (h *handler) current() reloadable {
+	h.reloadMutex.RLock()
+	defer h.reloadMutex.RUnlock()
+	return reloadable{
+		verifier:         h.verifier,
+		mappers:          h.mappers,
+		shadowMappers:    h.shadowMappers,
+		unmapped:         h.unmapped,
+		scrubbedAccounts: h.scrubbedAccounts,
+	}
+}
+
+// verifierOptions returns the options of the token verifier of cfg, without
+// its shared cache and transport.
+func verifierOptions(cfg config.Config) token.VerifierOptions {
+	return token.VerifierOptions{
+		ClusterID:            cfg.ClusterID,
+		PartitionID:          cfg.PartitionID,
+		AdditionalClusterIDs: cfg.AdditionalClusterIDs,
+		ClusterIDHeaders:     cfg.ClusterIDHeaders,
+		AllowedClockSkew:     cfg.AllowedClockSkew,
+		STSCacheTTL:          cfg.STSCacheTTL,
+		STSEndpointHostnames: cfg.STSEndpointHostnames,
+		AllowedSTSRegions:    cfg.AllowedSTSRegions,
+		STSEndpointOverride:  cfg.STSEndpointOverride,
+		STSRetries:           cfg.STSRetries,
+		STSRetryBackoff:      cfg.STSRetryBackoff,
+		STSRetryDeadline:     cfg.STSRetryDeadline,
+		RejectLongLivedKeys:  cfg.RejectLongLivedKeys,
+		MinRemainingValidity: cfg.MinRemainingValidity,
+		RejectV2Tokens:       !config.DefaultFeatureGate.Enabled(config.TokenV2),
+	}
+}
+
+// Reload replaces the settings the server can change without dropping its
+// listeners with those of cfg: the token verification settings, such as the
+// allowed STS endpoints and regions, the mappers and shadow mappers, the
+// unmapped fallback and the scrubbed accounts. Requests in flight finish
+// with the settings they started with. The cluster ID, partition and the
+// other settings take effect on restart.
+//
+// The caller starts the new mappers and stops the replaced ones once Reload
+// returns.
+func (c *Server) Reload(cfg config.Config, mappers, shadowMappers []mapper.Mapper) {
+	c.handler.reload(cfg, mappers, shadowMappers)
+	logger.Info("reloaded the configuration")
+}
+
+func (h *handler) reload(cfg config.Config, mappers, shadowMappers []mapper.Mapper) {
+	opts := verifierOptions(cfg)
+	opts.ClusterID = h.verifierOptions.ClusterID
+	opts.PartitionID = h.verifierOptions.PartitionID
+	opts.SharedCache = h.verifierOptions.SharedCache
+	opts.Transport = h.verifierOptions.Transport
+	verifier := token.NewVerifierWithOptions(opts)
+	unmapped := newUnmappedFallback(cfg)
+
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+	h.verifierOptions = opts
+	h.verifier = verifier
+	h.mappers = mappers
+	h.shadowMappers = shadowMappers
+	h.unmapped = unmapped
+	h.scrubbedAccounts = cfg.ScrubbedAWSAccounts
+}
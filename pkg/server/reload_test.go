@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func TestReload(t *testing.T) {
+	verifier := &testVerifier{}
+	h := setup(verifier)
+	defer cleanup(h.metrics)
+	h.verifierOptions = token.VerifierOptions{ClusterID: "cluster", PartitionID: "aws"}
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::123456789012:role/admin": {RoleARN: "arn:aws:iam::123456789012:role/Admin", Username: "old"},
+	}, nil, nil)}
+	identity := &token.Identity{
+		ARN:          "arn:aws:sts::123456789012:assumed-role/Admin/alice",
+		CanonicalARN: "arn:aws:iam::123456789012:role/Admin",
+		AccountID:    "123456789012",
+	}
+
+	h.reload(config.Config{
+		ClusterID:           "other-cluster",
+		AllowedSTSRegions:   []string{"eu-west-1"},
+		UnmappedAccounts:    []string{"210987654321"},
+		UnmappedUsername:    "unmapped",
+		ScrubbedAWSAccounts: []string{"123456789012"},
+	}, []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::123456789012:role/admin": {RoleARN: "arn:aws:iam::123456789012:role/Admin", Username: "new"},
+	}, nil, nil)}, nil)
+
+	current := h.current()
+	if current.verifier == token.Verifier(verifier) {
+		t.Error("expected the verifier to be replaced")
+	}
+	if h.verifierOptions.ClusterID != "cluster" || h.verifierOptions.PartitionID != "aws" {
+		t.Errorf("expected the cluster ID and partition to be kept, got %s %s", h.verifierOptions.ClusterID, h.verifierOptions.PartitionID)
+	}
+	if !reflect.DeepEqual(h.verifierOptions.AllowedSTSRegions, []string{"eu-west-1"}) {
+		t.Errorf("expected the allowed STS regions to be reloaded, got %v", h.verifierOptions.AllowedSTSRegions)
+	}
+	mapping, _, err := h.doMapping(context.Background(), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Username != "new" {
+		t.Errorf("expected the reloaded mappers to map the identity, got %s", mapping.Username)
+	}
+	if current.unmapped == nil || !current.unmapped.accounts["210987654321"] {
+		t.Error("expected the unmapped fallback to be reloaded")
+	}
+	if h.isLoggableIdentity(identity) {
+		t.Error("expected the scrubbed accounts to be reloaded")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sharedcache"
+)
+
+// replaySweepInterval is how often expired tokens are removed from the
+// replay cache.
+const replaySweepInterval = time.Minute
+
+// replayKeyPrefix starts the keys of tokens in the shared cache.
+const replayKeyPrefix = "aws-iam-authenticator:replay:"
+
+// replayCache records the signatures of verified tokens until they expire,
+// to detect tokens that were captured and replayed by another client.
+//
+// A token is optionally limited to a number of uses and bound to the client
+// IP that first presented it. Without a client IP header that is the API
+// server rather than the end user when running as a webhook, so binding
+// rejects a token reused against another API server of the same cluster.
+//
+// With a shared cache, uses are recorded there so a token replayed to
+// another replica is detected too. If the shared cache fails, uses are
+// recorded locally instead.
+type replayCache struct {
+	// maxUses is the number of times a token is accepted. Zero allows
+	// unlimited uses.
+	maxUses int
+	// bindSource rejects a token presented from another source than its
+	// first use.
+	bindSource bool
+	// shared entries are scoped to the partition and cluster ID.
+	shared    sharedcache.Store
+	partition string
+	clusterID string
+
+	mu        sync.Mutex
+	entries   map[string]*replayEntry
+	lastSweep time.Time
+}
+
+type replayEntry struct {
+	source  string
+	uses    int
+	expires time.Time
+}
+
+func newReplayCache(maxUses int, bindSource bool, shared sharedcache.Store, partition, clusterID string) *replayCache {
+	return &replayCache{
+		maxUses:    maxUses,
+		bindSource: bindSource,
+		shared:     shared,
+		partition:  partition,
+		clusterID:  clusterID,
+		entries:    map[string]*replayEntry{},
+	}
+}
+
+// check records a use of the token with signature from source and returns
+// the reason it is a replay, or "" if it isn't. The source is ignored unless
+// the cache binds tokens to it.
+func (c *replayCache) check(signature, source string, expires, now time.Time) string {
+	if !c.bindSource {
+		source = ""
+	}
+	if c.shared != nil {
+		reason, err := c.checkShared(signature, source, expires.Sub(now))
+		if err == nil {
+			if reason != "" {
+				authmetrics.TokenReplays.WithLabelValues(reason).Inc()
+			}
+			return reason
+		}
+		authmetrics.SharedCacheErrors.WithLabelValues(authmetrics.SharedCacheReplay).Inc()
+		logger.WithError(err).Warn("could not record the token use in the shared cache, recording it locally")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > replaySweepInterval {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	entry, ok := c.entries[signature]
+	if !ok || now.After(entry.expires) {
+		c.entries[signature] = &replayEntry{source: source, uses: 1, expires: expires}
+		return ""
+	}
+	if entry.source != source {
+		authmetrics.TokenReplays.WithLabelValues(authmetrics.ReplaySourceChanged).Inc()
+		return authmetrics.ReplaySourceChanged
+	}
+	if c.maxUses > 0 && entry.uses >= c.maxUses {
+		authmetrics.TokenReplays.WithLabelValues(authmetrics.ReplayMaxUses).Inc()
+		return authmetrics.ReplayMaxUses
+	}
+	entry.uses++
+	return ""
+}
+
+// checkShared records a use of the token in the shared cache for ttl, the
+// remaining validity of the token.
+func (c *replayCache) checkShared(signature, source string, ttl time.Duration) (string, error) {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	key := sharedcache.Key(replayKeyPrefix, c.partition, c.clusterID, signature)
+	added, err := c.shared.Add(key, []byte(source), ttl)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		first, ok, err := c.shared.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if ok && string(first) != source {
+			return authmetrics.ReplaySourceChanged, nil
+		}
+	}
+	if c.maxUses > 0 {
+		uses, err := c.shared.Incr(key+":uses", ttl)
+		if err != nil {
+			return "", err
+		}
+		if uses > int64(c.maxUses) {
+			return authmetrics.ReplayMaxUses, nil
+		}
+	}
+	return "", nil
+}
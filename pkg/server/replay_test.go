@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+func TestReplayCacheSource(t *testing.T) {
+	now := time.Now()
+	c := newReplayCache(0, true, nil, "aws", "cluster")
+	expires := now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if reason := c.check("sig", "10.0.0.1", expires, now); reason != "" {
+			t.Fatalf("use %d: unexpected replay %q", i, reason)
+		}
+	}
+	if reason := c.check("sig", "10.0.0.2", expires, now); reason != authmetrics.ReplaySourceChanged {
+		t.Errorf("expected %q, got %q", authmetrics.ReplaySourceChanged, reason)
+	}
+	if reason := c.check("other", "10.0.0.2", expires, now); reason != "" {
+		t.Errorf("unexpected replay of a different token: %q", reason)
+	}
+	// an expired token's entry is replaced
+	if reason := c.check("sig", "10.0.0.2", expires, expires.Add(time.Second)); reason != "" {
+		t.Errorf("unexpected replay after expiry: %q", reason)
+	}
+}
+
+// A token reused against the API servers of an HA control plane reaches the
+// authenticator from each of them.
+func TestReplayCacheTwoAPIServers(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	shared := &memoryStore{values: map[string][]byte{}}
+	for name, c := range map[string]*replayCache{
+		"local":  newReplayCache(2, false, nil, "aws", "cluster"),
+		"shared": newReplayCache(2, false, shared, "aws", "cluster"),
+	} {
+		for _, apiServer := range []string{"10.0.0.1", "10.0.0.2"} {
+			if reason := c.check("sig", apiServer, expires, now); reason != "" {
+				t.Errorf("%s: unexpected replay %q from %s", name, reason, apiServer)
+			}
+		}
+		// uses from every API server count
+		if reason := c.check("sig", "10.0.0.1", expires, now); reason != authmetrics.ReplayMaxUses {
+			t.Errorf("%s: expected %q, got %q", name, authmetrics.ReplayMaxUses, reason)
+		}
+	}
+}
+
+func TestReplayCacheMaxUses(t *testing.T) {
+	now := time.Now()
+	c := newReplayCache(2, true, nil, "aws", "cluster")
+	expires := now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if reason := c.check("sig", "10.0.0.1", expires, now); reason != "" {
+			t.Fatalf("use %d: unexpected replay %q", i, reason)
+		}
+	}
+	if reason := c.check("sig", "10.0.0.1", expires, now); reason != authmetrics.ReplayMaxUses {
+		t.Errorf("expected %q, got %q", authmetrics.ReplayMaxUses, reason)
+	}
+}
+
+func TestReplayCacheSweep(t *testing.T) {
+	now := time.Now()
+	c := newReplayCache(0, true, nil, "aws", "cluster")
+	c.check("old", "10.0.0.1", now.Add(time.Second), now)
+	c.check("new", "10.0.0.1", now.Add(time.Hour), now.Add(2*replaySweepInterval))
+	if _, ok := c.entries["old"]; ok {
+		t.Error("expected the expired entry to be swept")
+	}
+	if _, ok := c.entries["new"]; !ok {
+		t.Error("expected the new entry to be kept")
+	}
+}
+
+// memoryStore is a sharedcache.Store in memory whose entries don't expire.
+type memoryStore struct {
+	values map[string][]byte
+	err    error
+}
+
+func (s *memoryStore) Get(key string) ([]byte, bool, error) {
+	value, ok := s.values[key]
+	return value, ok, s.err
+}
+
+func (s *memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.values[key] = value
+	return s.err
+}
+
+func (s *memoryStore) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	if _, ok := s.values[key]; ok || s.err != nil {
+		return false, s.err
+	}
+	s.values[key] = value
+	return true, nil
+}
+
+func (s *memoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	n, _ := strconv.ParseInt(string(s.values[key]), 10, 64)
+	s.values[key] = []byte(strconv.FormatInt(n+1, 10))
+	return n + 1, s.err
+}
+
+func TestReplayCacheShared(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	shared := &memoryStore{values: map[string][]byte{}}
+	replica1, replica2 := newReplayCache(2, true, shared, "aws", "cluster"), newReplayCache(2, true, shared, "aws", "cluster")
+
+	if reason := replica1.check("sig", "10.0.0.1", expires, now); reason != "" {
+		t.Fatalf("unexpected replay %q", reason)
+	}
+	if reason := replica2.check("sig", "10.0.0.2", expires, now); reason != authmetrics.ReplaySourceChanged {
+		t.Errorf("expected %q on the other replica, got %q", authmetrics.ReplaySourceChanged, reason)
+	}
+	if reason := replica2.check("sig", "10.0.0.1", expires, now); reason != "" {
+		t.Errorf("unexpected replay %q", reason)
+	}
+	if reason := replica1.check("sig", "10.0.0.1", expires, now); reason != authmetrics.ReplayMaxUses {
+		t.Errorf("expected %q, got %q", authmetrics.ReplayMaxUses, reason)
+	}
+
+	// uses are recorded locally while the shared cache fails
+	shared.err = errors.New("connection refused")
+	replica1.check("other", "10.0.0.1", expires, now)
+	if reason := replica1.check("other", "10.0.0.2", expires, now); reason != authmetrics.ReplaySourceChanged {
+		t.Errorf("expected %q from the local cache, got %q", authmetrics.ReplaySourceChanged, reason)
+	}
+}
+
+func TestReplayCacheSharedScopedToCluster(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	shared := &memoryStore{values: map[string][]byte{}}
+	cluster := newReplayCache(1, true, shared, "aws", "cluster")
+	other := newReplayCache(1, true, shared, "aws", "other-cluster")
+	otherPartition := newReplayCache(1, true, shared, "aws-cn", "cluster")
+
+	if reason := cluster.check("sig", "10.0.0.1", expires, now); reason != "" {
+		t.Fatalf("unexpected replay %q", reason)
+	}
+	if reason := other.check("sig", "10.0.0.2", expires, now); reason != "" {
+		t.Errorf("expected another cluster not to share the uses, got %q", reason)
+	}
+	if reason := otherPartition.check("sig", "10.0.0.2", expires, now); reason != "" {
+		t.Errorf("expected another partition not to share the uses, got %q", reason)
+	}
+}
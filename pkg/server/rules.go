@@ -0,0 +1,193 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/expr"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/roleinfo"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// mappingSourceRules is the mapping source of identities mapped by the
+// mapping rules.
+const mappingSourceRules = "rules"
+
+// ruleVariables are the variables of the expressions of mapping rules.
+// rolePath and tags are looked up with iam:GetRole when a rule uses them.
+var ruleVariables = []string{"account", "arn", "canonicalArn", "userId", "sessionName", "roleName", "userName", "rolePath", "tags"}
+
+// mappingRules map the identities no backend maps with expressions over
+// their attributes. The first rule matching an identity maps it.
+type mappingRules struct {
+	rules []mappingRule
+	// roleInfo resolves the path and tags of roles.
+	roleInfo roleinfo.Provider
+}
+
+type mappingRule struct {
+	name     string
+	match    *expr.Program
+	username *expr.Program
+	// groups is nil if the rule grants no groups.
+	groups *expr.Program
+}
+
+// compileMappingRules compiles the expressions of rules.
+func compileMappingRules(rules []config.MappingRule) ([]mappingRule, error) {
+	var compiled []mappingRule
+	names := map[string]bool{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("mapping rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("mapping rule %s is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Match == "" || rule.Username == "" {
+			return nil, fmt.Errorf("mapping rule %s needs a match and a username expression", rule.Name)
+		}
+		r := mappingRule{name: rule.Name}
+		var err error
+		if r.match, err = expr.Compile(rule.Match, ruleVariables); err != nil {
+			return nil, fmt.Errorf("invalid match expression of mapping rule %s: %v", rule.Name, err)
+		}
+		if r.username, err = expr.Compile(rule.Username, ruleVariables); err != nil {
+			return nil, fmt.Errorf("invalid username expression of mapping rule %s: %v", rule.Name, err)
+		}
+		if rule.Groups != "" {
+			if r.groups, err = expr.Compile(rule.Groups, ruleVariables); err != nil {
+				return nil, fmt.Errorf("invalid groups expression of mapping rule %s: %v", rule.Name, err)
+			}
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// ValidateMappingRules returns an error if a mapping rule is incomplete or
+// its expressions don't compile.
+func ValidateMappingRules(rules []config.MappingRule) error {
+	_, err := compileMappingRules(rules)
+	return err
+}
+
+// mapping returns the unrendered mapping of identity by the first rule
+// matching it and the name of the rule, or nil if no rule matches it.
+func (r *mappingRules) mapping(identity *token.Identity, canonicalARN string) (*config.IdentityMapping, string, error) {
+	if r == nil {
+		return nil, "", nil
+	}
+	vars := r.activation(identity)
+	for _, rule := range r.rules {
+		matched, err := rule.match.EvalBool(vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not evaluate the match expression of mapping rule %s: %v", rule.name, err)
+		}
+		if !matched {
+			continue
+		}
+		username, err := rule.username.EvalString(vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not evaluate the username expression of mapping rule %s: %v", rule.name, err)
+		}
+		if username == "" {
+			return nil, "", fmt.Errorf("mapping rule %s mapped an empty username", rule.name)
+		}
+		groups := []string{}
+		if rule.groups != nil {
+			if groups, err = rule.groups.EvalStrings(vars); err != nil {
+				return nil, "", fmt.Errorf("could not evaluate the groups expression of mapping rule %s: %v", rule.name, err)
+			}
+		}
+		return &config.IdentityMapping{
+			IdentityARN: canonicalARN,
+			Username:    username,
+			Groups:      groups,
+		}, rule.name, nil
+	}
+	return nil, "", nil
+}
+
+// activation returns the variables of identity. The role is described at
+// most once, and only if a rule uses its path or tags.
+func (r *mappingRules) activation(identity *token.Identity) expr.Activation {
+	// principal is empty if the canonical ARN doesn't parse
+	principal, _ := arn.Parse(identity.CanonicalARN)
+	isRole := principal.Type == arn.TypeRole
+
+	var info *roleinfo.Info
+	var infoErr error
+	described := false
+	describe := func() (*roleinfo.Info, error) {
+		if !described {
+			described = true
+			if r.roleInfo == nil {
+				infoErr = errors.New("role descriptions are not available")
+			} else {
+				info, infoErr = r.roleInfo.Role(identity.CanonicalARN)
+			}
+		}
+		return info, infoErr
+	}
+
+	return func(name string) (interface{}, error) {
+		switch name {
+		case "account":
+			return identity.AccountID, nil
+		case "arn":
+			return identity.ARN, nil
+		case "canonicalArn":
+			return identity.CanonicalARN, nil
+		case "userId":
+			return identity.UserID, nil
+		case "sessionName":
+			return identity.SessionName, nil
+		case "roleName":
+			if isRole {
+				return principal.Name, nil
+			}
+			return "", nil
+		case "userName":
+			if principal.Type == arn.TypeUser {
+				return principal.Name, nil
+			}
+			return "", nil
+		case "rolePath", "tags":
+			if !isRole {
+				if name == "tags" {
+					return map[string]string{}, nil
+				}
+				return "", nil
+			}
+			info, err := describe()
+			if err != nil {
+				return nil, fmt.Errorf("could not describe the role: %v", err)
+			}
+			if name == "tags" {
+				return info.Tags, nil
+			}
+			return info.Path, nil
+		}
+		return nil, fmt.Errorf("undeclared variable %s", name)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/roleinfo"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// countingRoleInfo counts the roles it describes.
+type countingRoleInfo struct {
+	testRoleInfo
+	calls int
+}
+
+func (r *countingRoleInfo) Role(roleARN string) (*roleinfo.Info, error) {
+	r.calls++
+	return r.testRoleInfo.Role(roleARN)
+}
+
+func TestAuthenticateMappingRules(t *testing.T) {
+	rules, err := compileMappingRules([]config.MappingRule{
+		{
+			Name:     "team-roles",
+			Match:    `rolePath.startsWith("/team/") && account == "123456789012"`,
+			Username: `"team:" + roleName.lowerAscii() + ":{{SessionName}}"`,
+			Groups:   `["team:" + rolePath.split("/")[2]] + ("on-call" in tags ? ["on-call"] : [])`,
+		},
+		{
+			Name:     "auditors",
+			Match:    `userName.endsWith("-auditor")`,
+			Username: `"auditor:" + userName`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamRole := &token.Identity{
+		ARN:          "arn:aws:sts::123456789012:assumed-role/Developer/alice",
+		CanonicalARN: "arn:aws:iam::123456789012:role/Developer",
+		AccountID:    "123456789012",
+		SessionName:  "alice",
+	}
+	for _, c := range []struct {
+		name         string
+		identity     *token.Identity
+		roleInfo     testRoleInfo
+		wantReason   string
+		wantUsername string
+		wantGroups   []string
+		wantCalls    int
+	}{
+		{
+			name:         "team role",
+			identity:     teamRole,
+			roleInfo:     testRoleInfo{info: &roleinfo.Info{Path: "/team/payments/", Tags: map[string]string{"on-call": "true"}}},
+			wantUsername: "team:developer:alice",
+			wantGroups:   []string{"team:payments", "on-call"},
+			wantCalls:    1,
+		},
+		{
+			name:       "other role",
+			identity:   teamRole,
+			roleInfo:   testRoleInfo{info: &roleinfo.Info{Path: "/"}},
+			wantReason: ReasonUnmappedARN,
+			wantCalls:  1,
+		},
+		{
+			name:       "role lookup error",
+			identity:   teamRole,
+			roleInfo:   testRoleInfo{err: errors.New("access denied")},
+			wantReason: ReasonMappingError,
+			wantCalls:  1,
+		},
+		{
+			name: "user",
+			identity: &token.Identity{
+				ARN:          "arn:aws:iam::123456789012:user/bob-auditor",
+				CanonicalARN: "arn:aws:iam::123456789012:user/bob-auditor",
+				AccountID:    "123456789012",
+			},
+			wantUsername: "auditor:bob-auditor",
+			wantGroups:   []string{},
+		},
+		{
+			name: "statically mapped role",
+			identity: &token.Identity{
+				ARN:          "arn:aws:sts::123456789012:assumed-role/Admin/alice",
+				CanonicalARN: "arn:aws:iam::123456789012:role/Admin",
+				AccountID:    "123456789012",
+			},
+			wantUsername: "admin",
+			wantGroups:   []string{"admins"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: c.identity})
+			defer cleanup(h.metrics)
+			roleInfo := &countingRoleInfo{testRoleInfo: c.roleInfo}
+			h.rules = &mappingRules{rules: rules, roleInfo: roleInfo}
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::123456789012:role/admin": {RoleARN: "arn:aws:iam::123456789012:role/Admin", Username: "admin", Groups: []string{"admins"}},
+			}, nil, nil)}
+			user, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+
+			if roleInfo.calls != c.wantCalls {
+				t.Errorf("expected %d role descriptions, got %d", c.wantCalls, roleInfo.calls)
+			}
+			if c.wantReason != "" {
+				if authErr == nil {
+					t.Fatalf("expected the identity to be denied with the reason %q", c.wantReason)
+				}
+				if authErr.Reason != c.wantReason {
+					t.Errorf("expected the reason %q, got %q", c.wantReason, authErr.Reason)
+				}
+				return
+			}
+			if authErr != nil {
+				t.Fatalf("expected the identity to be authenticated, got %v", authErr)
+			}
+			if user.Username != c.wantUsername || !reflect.DeepEqual(user.Groups, c.wantGroups) {
+				t.Errorf("expected %s %v, got %s %v", c.wantUsername, c.wantGroups, user.Username, user.Groups)
+			}
+		})
+	}
+}
+
+func TestValidateMappingRules(t *testing.T) {
+	for _, rules := range [][]config.MappingRule{
+		{{Match: "true", Username: `"a"`}},
+		{{Name: "a", Username: `"a"`}},
+		{{Name: "a", Match: "true", Username: `"a"`}, {Name: "a", Match: "true", Username: `"b"`}},
+		{{Name: "a", Match: "role == 'x'", Username: `"a"`}},
+		{{Name: "a", Match: "true", Username: `"a" +`}},
+		{{Name: "a", Match: "true", Username: `"a"`, Groups: `[`}},
+	} {
+		if err := ValidateMappingRules(rules); err == nil {
+			t.Errorf("expected mapping rules %+v to be invalid", rules)
+		}
+	}
+	if err := ValidateMappingRules([]config.MappingRule{{Name: "a", Match: "tags.team == 'a'", Username: "sessionName"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
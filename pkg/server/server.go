@@ -17,58 +17,167 @@ limitations under the License.
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"regexp"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/decision"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/ec2provider"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/httputil"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/iamgroups"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/accessentries"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/configmap"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/roletags"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/roleinfo"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sharedcache"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/tracing"
 
 	awsarn "github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-// tokenReviewDenyJSON is a static encoding (at init time) of the 'deny' TokenReview
-var tokenReviewDenyJSON = func() []byte {
-	res, err := json.Marshal(authenticationv1beta1.TokenReview{
+var logger = logging.For(logging.ComponentServer)
+
+// tokenReviewVersions are the TokenReview API versions the webhook accepts.
+// Apiservers pick one with --authentication-token-webhook-version; v1 is the
+// default from Kubernetes 1.19 on.
+var tokenReviewVersions = map[string]bool{
+	authenticationv1.SchemeGroupVersion.String():      true,
+	authenticationv1beta1.SchemeGroupVersion.String(): true,
+}
+
+// encodeTokenReview encodes status as a TokenReview of apiVersion, the version
+// of the request being answered. Requests without an apiVersion predate
+// version negotiation and get an untyped v1beta1 response as before.
+func encodeTokenReview(apiVersion string, status authenticationv1.TokenReviewStatus) ([]byte, error) {
+	typeMeta := metav1.TypeMeta{}
+	if apiVersion != "" {
+		typeMeta = metav1.TypeMeta{APIVersion: apiVersion, Kind: "TokenReview"}
+	}
+	if apiVersion == authenticationv1.SchemeGroupVersion.String() {
+		return json.Marshal(authenticationv1.TokenReview{TypeMeta: typeMeta, Status: status})
+	}
+
+	var extra map[string]authenticationv1beta1.ExtraValue
+	if status.User.Extra != nil {
+		extra = map[string]authenticationv1beta1.ExtraValue{}
+		for k, v := range status.User.Extra {
+			extra[k] = authenticationv1beta1.ExtraValue(v)
+		}
+	}
+	return json.Marshal(authenticationv1beta1.TokenReview{
+		TypeMeta: typeMeta,
 		Status: authenticationv1beta1.TokenReviewStatus{
-			Authenticated: false,
+			Authenticated: status.Authenticated,
+			User: authenticationv1beta1.UserInfo{
+				Username: status.User.Username,
+				UID:      status.User.UID,
+				Groups:   status.User.Groups,
+				Extra:    extra,
+			},
+			Audiences: status.Audiences,
+			Error:     status.Error,
 		},
 	})
-	if err != nil {
-		logrus.WithError(err).Fatal("could not create static 'deny' JSON response")
-	}
-	return res
-}()
-
-// Pattern to match EC2 instance IDs
-var (
-	instanceIDPattern = regexp.MustCompile("^i-(\\w{8}|\\w{17})$")
-)
+}
 
 // server state (internal)
 type handler struct {
 	http.ServeMux
-	verifier         token.Verifier
+	// reloadMutex guards the fields replaced by reload: verifier, mappers,
+	// shadowMappers, scrubbedAccounts and unmapped. Requests read them
+	// with current.
+	reloadMutex sync.RWMutex
+	verifier    token.Verifier
+	// verifierOptions are the options verifier was created with.
+	verifierOptions  token.VerifierOptions
 	metrics          metrics
 	ec2Provider      ec2provider.EC2Provider
 	clusterID        string
 	mappers          []mapper.Mapper
+	shadowMappers    []mapper.Mapper
+	shadowSem        chan struct{}
 	scrubbedAccounts []string
+	auditLogger      audit.Logger
+	tracer           *tracing.Tracer
+	auditAnnotations bool
+	// identityExtras adds the AWS identity to the user extras unless the
+	// mapping overrides it.
+	identityExtras bool
+	// validateAudiences checks requested audiences against the cluster ID
+	// the token was signed for.
+	validateAudiences bool
+	// clientIPHeader is the header carrying the IP address tokens bound to
+	// a source IP are checked against, or "" to check them against the
+	// address of the caller.
+	clientIPHeader string
+	// replays detects reuse of verified tokens. Nil disables replay
+	// detection.
+	replays *replayCache
+	// unsafeGroupsAction is taken on identities mapped to groups starting
+	// with one of reservedGroupPrefixes by a backend other than MountedFile.
+	unsafeGroupsAction    string
+	reservedGroupPrefixes []string
+	// groupLimitsAction is taken on identities whose groups, including
+	// those of IAM groups, exceed groupLimits.
+	groupLimits       mapper.GroupLimits
+	groupLimitsAction string
+	// strictARNMatching passes canonical ARNs to the mappers without
+	// lowercasing them.
+	strictARNMatching bool
+	// sessionNamePolicies restrict the session names roles may be used
+	// with.
+	sessionNamePolicies []sessionNamePolicy
+	// negative remembers tokens of unmapped identities. Nil disables
+	// negative caching.
+	negative *negativeCache
+	// unmapped authenticates identities of trusted accounts that no backend
+	// maps. Nil denies them.
+	unmapped *unmappedFallback
+	// authenticationTimeout, if positive, bounds the verification of each
+	// token on top of the deadline of the request.
+	authenticationTimeout time.Duration
+	// iamGroups resolves the IAM groups of users whose mapping sets
+	// LookupIAMGroups.
+	iamGroups iamgroups.Provider
+	// roleInfo resolves the description and tags of the roles of sessions
+	// added to the user extras. Nil disables it.
+	roleInfo            roleinfo.Provider
+	roleInfoDescription bool
+	roleInfoTags        []string
+	// rules map identities no backend maps. Nil disables them.
+	rules *mappingRules
+	// postMappingHook is called after identities are mapped to change
+	// their groups or deny them. Nil disables it.
+	postMappingHook *postMappingHook
+	// health is the serving status reported by the gRPC health service.
+	health *healthStatus
+	// grpc serves the gRPC API.
+	grpc http.Handler
 }
 
 // metrics are handles to the collectors for prometheous for the various metrics we are tracking.
@@ -76,31 +185,45 @@ type metrics struct {
 	latency *prometheus.HistogramVec
 }
 
-// namespace for the AWS IAM Authenticator's metrics
+// labels for the AWS IAM Authenticator's latency metric
 const (
-	metricNS        = "aws_iam_authenticator"
 	metricMalformed = "malformed_request"
 	metricInvalid   = "invalid_token"
 	metricSTSError  = "sts_error"
 	metricUnknown   = "uknown_user"
+	metricReplay    = "replayed_token"
+	metricUnsafe    = "unsafe_groups"
+	metricGroups    = "invalid_groups"
+	metricSession   = "invalid_session_name"
+	metricHook      = "hook_denied"
 	metricSuccess   = "success"
 )
 
-// New the authentication webhook server.
-func New(cfg config.Config, mappers []mapper.Mapper) *Server {
+// Keys of the user extras added when audit annotations are enabled. The API
+// server copies user extras into its audit log, so these make each audit
+// event self-contained for access investigations.
+const (
+	extraOriginalARN   = "authentication.kubernetes.io/aws-iam-original-arn"
+	extraMappingSource = "authentication.kubernetes.io/aws-iam-mapping-source"
+	extraSTSLatency    = "authentication.kubernetes.io/aws-iam-sts-latency"
+)
+
+// New the authentication webhook server. shadowMappers, if any, are evaluated
+// alongside mappers and only compared against them.
+func New(cfg config.Config, mappers, shadowMappers []mapper.Mapper) *Server {
 	c := &Server{
 		Config: cfg,
 	}
 
 	for _, mapping := range c.RoleMappings {
-		logrus.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"role":     mapping.RoleARN,
 			"username": mapping.Username,
 			"groups":   mapping.Groups,
 		}).Infof("mapping IAM role")
 	}
 	for _, mapping := range c.UserMappings {
-		logrus.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"user":     mapping.UserARN,
 			"username": mapping.Username,
 			"groups":   mapping.Groups,
@@ -108,53 +231,196 @@ func New(cfg config.Config, mappers []mapper.Mapper) *Server {
 	}
 
 	for _, account := range c.AutoMappedAWSAccounts {
-		logrus.WithField("accountID", account).Infof("mapping IAM Account")
+		logger.WithField("accountID", account).Infof("mapping IAM Account")
 	}
+	recordFeatureGates()
 
-	cert, err := c.GetOrCreateCertificate()
-	if err != nil {
-		logrus.WithError(err).Fatalf("could not load/generate a certificate")
-	}
+	var cert *tls.Certificate
+	var err error
+	if c.TLSSecret != "" {
+		c.tlsSecretWatcher, err = newTLSSecretWatcher(&c.Config)
+		if err != nil {
+			logger.WithError(err).Fatalf("could not watch the TLS secret")
+		}
+		cert, err = c.tlsSecretWatcher.load()
+		if err != nil {
+			logger.WithError(err).Fatalf("could not load a certificate from the TLS secret")
+		}
+	} else {
+		cert, err = c.GetOrCreateCertificate()
+		if err != nil {
+			logger.WithError(err).Fatalf("could not load/generate a certificate")
+		}
 
-	if !c.KubeconfigPregenerated {
-		if err := c.CreateKubeconfig(); err != nil {
-			logrus.WithError(err).Fatalf("could not create kubeconfig")
+		if !c.KubeconfigPregenerated {
+			if err := c.CreateKubeconfig(); err != nil {
+				logger.WithError(err).Fatalf("could not create kubeconfig")
+			}
 		}
 	}
 
-	// start a TLS listener with our custom certs
-	listener, err := tls.Listen("tcp", c.ListenAddr(), &tls.Config{
-		MinVersion:   tls.VersionTLS12,
-		Certificates: []tls.Certificate{*cert},
-	})
+	c.certReloader = newCertReloader(&c.Config, cert)
+	if c.tlsSecretWatcher != nil {
+		c.tlsSecretWatcher.reloader = c.certReloader
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.certReloader.GetCertificate,
+	}
+	if !c.DisableHTTP2 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+	clientCAs, err := c.LoadClientCAs()
 	if err != nil {
-		logrus.WithError(err).Fatal("could not open TLS listener")
+		logger.WithError(err).Fatal("could not load client CA bundle")
+	}
+	if clientCAs != nil {
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	// start a TLS listener with our custom certs, on the socket passed by
+	// systemd if the server is socket activated
+	listener, err := systemdListener()
+	if err != nil {
+		logger.WithError(err).Fatal("could not use the socket passed by systemd")
+	}
+	if listener == nil && c.SocketPath != "" {
+		listener, err = unixListener(c.SocketPath, os.FileMode(c.SocketMode))
+		if err != nil {
+			logger.WithError(err).Fatal("could not listen on the UNIX socket")
+		}
+	}
+	if listener != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	} else {
+		listener, err = tls.Listen("tcp", c.ListenAddr(), tlsConfig)
+		if err != nil {
+			logger.WithError(err).Fatal("could not open TLS listener")
+		}
 	}
 
 	// create a logrus logger for HTTP error logs
-	errLog := logrus.WithField("http", "error").Writer()
+	errLog := logger.WithField("http", "error").Writer()
 	defer errLog.Close()
 
-	logrus.Infof("listening on %s", listener.Addr())
-	logrus.Infof("reconfigure your apiserver with `--authentication-token-webhook-config-file=%s` to enable (assuming default hostPath mounts)", c.GenerateKubeconfigPath)
+	logger.Infof("listening on %s", listener.Addr())
+	logger.Infof("reconfigure your apiserver with `--authentication-token-webhook-config-file=%s` to enable (assuming default hostPath mounts)", c.GenerateKubeconfigPath)
+	c.handler = c.getHandler(mappers, shadowMappers, c.EC2DescribeInstancesQps, c.EC2DescribeInstancesBurst)
 	c.httpServer = http.Server{
 		ErrorLog: log.New(errLog, "", 0),
-		Handler:  c.getHandler(mappers, c.EC2DescribeInstancesQps, c.EC2DescribeInstancesBurst),
+		Handler:  c.handler,
+	}
+	if err := configureConnections(&c.httpServer, &c.Config, !c.DisableHTTP2); err != nil {
+		logger.WithError(err).Fatal("could not configure HTTP/2")
 	}
 	c.listener = listener
+
+	if c.GRPCPort != 0 {
+		// gRPC requires HTTP/2, which net/http serves when it is negotiated
+		grpcTLSConfig := tlsConfig.Clone()
+		grpcTLSConfig.NextProtos = []string{"h2"}
+		c.grpcListener, err = tls.Listen("tcp", net.JoinHostPort(c.Address, strconv.Itoa(c.GRPCPort)), grpcTLSConfig)
+		if err != nil {
+			logger.WithError(err).Fatal("could not open gRPC listener")
+		}
+		logger.Infof("serving gRPC on %s", c.grpcListener.Addr())
+		c.grpcServer = http.Server{
+			ErrorLog: log.New(errLog, "", 0),
+			Handler:  c.handler.grpc,
+		}
+		if err := configureConnections(&c.grpcServer, &c.Config, true); err != nil {
+			logger.WithError(err).Fatal("could not configure HTTP/2")
+		}
+	}
+
+	if c.MetricsPort != 0 {
+		metricsHandler, err := newMetricsHandler(&c.Config)
+		if err != nil {
+			logger.WithError(err).Fatal("could not configure the metrics listener")
+		}
+		c.metricsListener, err = newMetricsListener(&c.Config)
+		if err != nil {
+			logger.WithError(err).Fatal("could not open metrics listener")
+		}
+		logger.Infof("serving metrics on %s", c.metricsListener.Addr())
+		c.metricsServer = http.Server{
+			ErrorLog: log.New(errLog, "", 0),
+			Handler:  metricsHandler,
+		}
+	}
+
+	if c.DebugPort != 0 {
+		// plain HTTP on localhost only: profiles and mappings are sensitive
+		c.debugListener, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(c.DebugPort)))
+		if err != nil {
+			logger.WithError(err).Fatal("could not open debug listener")
+		}
+		logger.Warnf("serving pprof, expvar and mappings on http://%s/debug/", c.debugListener.Addr())
+		c.debugServer = http.Server{
+			ErrorLog: log.New(errLog, "", 0),
+			Handler:  newDebugHandler(func() []mapper.Mapper { return c.handler.current().mappers }),
+		}
+	}
 	return c
 }
 
-// Run will run the server closing the connection if there is a struct on the channel
+// Run serves until stopCh is closed, then drains the requests in flight and
+// returns once the server has shut down.
 func (c *Server) Run(stopCh <-chan struct{}) {
 	defer c.listener.Close()
 
+	if c.tlsSecretWatcher != nil {
+		go c.tlsSecretWatcher.run(stopCh)
+	} else {
+		go c.certReloader.run(stopCh)
+	}
+
 	go func() {
 		http.ListenAndServe(":21363", &healthzHandler{})
 	}()
-	if err := c.httpServer.Serve(c.listener); err != nil {
-		logrus.WithError(err).Fatal("http server exited")
+	drained := make(chan struct{})
+	go func() {
+		<-stopCh
+		c.handler.health.set(HealthNotServing)
+		sdNotify("STOPPING=1")
+		c.shutdown()
+		close(drained)
+	}()
+	go c.notifyReady(stopCh)
+	go wait.Until(newConflictDetector(func() []mapper.Mapper {
+		return c.handler.current().mappers
+	}).check, conflictCheckInterval, stopCh)
+	if c.grpcListener != nil {
+		defer c.grpcListener.Close()
+		go func() {
+			if err := c.grpcServer.Serve(c.grpcListener); err != http.ErrServerClosed {
+				logger.WithError(err).Fatal("gRPC server exited")
+			}
+		}()
 	}
+	if c.metricsListener != nil {
+		defer c.metricsListener.Close()
+		go func() {
+			if err := c.metricsServer.Serve(c.metricsListener); err != http.ErrServerClosed {
+				logger.WithError(err).Fatal("metrics server exited")
+			}
+		}()
+	}
+	if c.debugListener != nil {
+		defer c.debugListener.Close()
+		go func() {
+			if err := c.debugServer.Serve(c.debugListener); err != http.ErrServerClosed {
+				logger.WithError(err).Fatal("debug server exited")
+			}
+		}()
+	}
+	if err := c.httpServer.Serve(c.listener); err != http.ErrServerClosed {
+		logger.WithError(err).Fatal("http server exited")
+	}
+	// Serve returns as soon as the listener is closed, before the requests
+	// in flight are drained.
+	<-drained
 }
 
 type healthzHandler struct{}
@@ -162,7 +428,7 @@ type healthzHandler struct{}
 func (m *healthzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "ok")
 }
-func (c *Server) getHandler(mappers []mapper.Mapper, ec2DescribeQps int, ec2DescribeBurst int) *handler {
+func (c *Server) getHandler(mappers, shadowMappers []mapper.Mapper, ec2DescribeQps int, ec2DescribeBurst int) *handler {
 	if c.ServerEC2DescribeInstancesRoleARN != "" {
 		_, err := awsarn.Parse(c.ServerEC2DescribeInstancesRoleARN)
 		if err != nil {
@@ -170,29 +436,184 @@ func (c *Server) getHandler(mappers []mapper.Mapper, ec2DescribeQps int, ec2Desc
 		}
 	}
 
+	auditLogger, err := audit.New(audit.Options{
+		Path:       c.AuditLogPath,
+		MaxSize:    c.AuditLogMaxSize,
+		MaxBackups: c.AuditLogMaxBackups,
+		MaxAge:     c.AuditLogMaxAge,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("could not create audit logger")
+	}
+
+	stsTransport := c.stsTransport
+	if stsTransport == nil {
+		stsTransport, err = httputil.NewTransport(httputil.TransportOptions{
+			HTTPSProxy: c.STSHTTPSProxy,
+			NoProxy:    c.STSNoProxy,
+			CABundle:   c.STSCABundle,
+			Dialer: httputil.DialerOptions{
+				PinnedIPs:          c.STSPinnedIPs,
+				IPFamily:           c.STSIPFamily,
+				DialTimeout:        c.STSDialTimeout,
+				HappyEyeballsDelay: c.STSHappyEyeballsDelay,
+			},
+		})
+		if err != nil {
+			logger.WithError(err).Fatal("could not configure the STS client")
+		}
+	}
+	var sharedCache sharedcache.Store
+	if c.SharedCacheURL != "" {
+		sharedCache, err = sharedcache.New(c.SharedCacheURL, c.SharedCacheTimeout)
+		if err != nil {
+			logger.WithError(err).Fatal("could not configure the shared cache")
+		}
+	}
+
+	if c.STSHTTPSProxy != "" {
+		logger.WithField("noProxy", c.STSNoProxy).Info("calling STS through the configured proxy")
+	} else if os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "" {
+		logger.Info("calling STS through the proxy of the HTTPS_PROXY environment variable, unless NO_PROXY matches")
+	}
+	if c.STSEndpointOverride != "" {
+		logger.WithField("endpoint", c.STSEndpointOverride).Warn("sending tokens to the STS endpoint override instead of STS")
+	}
+	groupNamePattern, err := mapper.CompileGroupNamePattern(c.GroupNamePattern)
+	if err != nil {
+		logger.WithError(err).Fatal("could not configure the group limits")
+	}
+	sessionNamePolicies, err := compileSessionNamePolicies(c.SessionNamePolicies, c.StrictARNMatching)
+	if err != nil {
+		logger.WithError(err).Fatal("could not configure the session name policies")
+	}
+	rules, err := compileMappingRules(c.MappingRules)
+	if err != nil {
+		logger.WithError(err).Fatal("could not configure the mapping rules")
+	}
+
+	opts := verifierOptions(c.Config)
+	opts.SharedCache = sharedCache
+	opts.Transport = stsTransport
 	h := &handler{
-		verifier:         token.NewVerifier(c.ClusterID, c.PartitionID),
+		verifier:         token.NewVerifierWithOptions(opts),
+		verifierOptions:  opts,
 		metrics:          createMetrics(),
 		ec2Provider:      ec2provider.New(c.ServerEC2DescribeInstancesRoleARN, ec2DescribeQps, ec2DescribeBurst),
 		clusterID:        c.ClusterID,
 		mappers:          mappers,
+		shadowMappers:    shadowMappers,
+		shadowSem:        make(chan struct{}, maxShadowEvaluations),
 		scrubbedAccounts: c.Config.ScrubbedAWSAccounts,
+		auditLogger:      auditLogger,
+		tracer: tracing.New(tracing.Options{
+			Endpoint:    c.TracingOTLPEndpoint,
+			SampleRatio: c.TracingSampleRatio,
+		}),
+		auditAnnotations:  c.AuditAnnotations,
+		identityExtras:    c.IdentityExtras,
+		validateAudiences: c.ValidateAudiences,
+		clientIPHeader:    c.ClientIPHeader,
+		iamGroups: iamgroups.New(iamgroups.Options{
+			PartitionID: c.PartitionID,
+			RoleARN:     c.IAMGroupsRoleARN,
+			CacheTTL:    c.IAMGroupsCacheTTL,
+		}),
+		health: newHealthStatus(),
+	}
+	if c.ReplayDetection {
+		h.replays = newReplayCache(c.ReplayMaxUses, c.ReplayBindSource, sharedCache, c.PartitionID, c.ClusterID)
+	}
+	h.strictARNMatching = c.StrictARNMatching
+	h.sessionNamePolicies = sessionNamePolicies
+	h.unsafeGroupsAction = c.UnsafeGroupsAction
+	h.reservedGroupPrefixes = c.ReservedGroupPrefixes
+	h.groupLimits = mapper.GroupLimits{
+		MaxGroups:          c.MaxGroups,
+		MaxGroupNameLength: c.MaxGroupNameLength,
+		GroupNamePattern:   groupNamePattern,
+	}
+	h.groupLimitsAction = c.GroupLimitsAction
+	if c.NegativeCacheTTL > 0 {
+		h.negative = newNegativeCache(c.NegativeCacheTTL)
+	}
+	h.unmapped = newUnmappedFallback(c.Config)
+	h.authenticationTimeout = c.AuthenticationTimeout
+	var roleInfo roleinfo.Provider
+	if c.RoleInfoExtraDescription || len(c.RoleInfoExtraTags) > 0 || len(rules) > 0 {
+		roleInfo = roleinfo.New(roleinfo.Options{
+			PartitionID: c.PartitionID,
+			RoleARN:     c.RoleInfoRoleARN,
+			CacheTTL:    c.RoleInfoCacheTTL,
+		})
+	}
+	if c.RoleInfoExtraDescription || len(c.RoleInfoExtraTags) > 0 {
+		h.roleInfo = roleInfo
+		h.roleInfoDescription = c.RoleInfoExtraDescription
+		h.roleInfoTags = c.RoleInfoExtraTags
+	}
+	if len(rules) > 0 {
+		h.rules = &mappingRules{rules: rules, roleInfo: roleInfo}
+	}
+	if c.PostMappingHookURL != "" {
+		h.postMappingHook, err = newPostMappingHook(c.Config)
+		if err != nil {
+			logger.WithError(err).Fatal("could not configure the post-mapping hook")
+		}
 	}
 
-	h.HandleFunc("/authenticate", h.authenticateEndpoint)
-	h.Handle("/metrics", promhttp.Handler())
+	limiter := httputil.NewRequestLimiter(httputil.LimiterOptions{
+		QPS:            c.RateLimitQPS,
+		Burst:          c.RateLimitBurst,
+		PerSourceQPS:   c.RateLimitPerSourceQPS,
+		PerSourceBurst: c.RateLimitPerSourceBurst,
+		MaxInFlight:    c.MaxInFlightRequests,
+		OnReject: func(reason string) {
+			authmetrics.RateLimitedRequests.WithLabelValues(reason).Inc()
+		},
+	})
+	authenticate := limiter.Handler(http.HandlerFunc(h.authenticateEndpoint))
+	for _, path := range authenticatePaths(c.AuthenticatePaths) {
+		h.Handle(path, authenticate)
+	}
+	h.grpc = h.grpcHandler(limiter)
+	if c.AWSAuthValidationWebhook {
+		h.HandleFunc(AWSAuthValidationPath, validateAWSAuthEndpoint(configmap.Location(c.Config)))
+	}
+	if c.MetricsPort == 0 {
+		h.Handle("/metrics", promhttp.Handler())
+	}
+	if c.MappingsTokenFile != "" {
+		token, err := readBearerToken(c.MappingsTokenFile)
+		if err != nil {
+			logger.WithError(err).Fatal("could not read the mappings endpoint token")
+		}
+		h.Handle(MappingsPath, bearerAuth(token, http.HandlerFunc(h.mappingsEndpoint)))
+	}
 	h.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "ok")
 	})
-	logrus.Infof("Starting the h.ec2Provider.startEc2DescribeBatchProcessing ")
+	logger.Infof("Starting the h.ec2Provider.startEc2DescribeBatchProcessing ")
 	go h.ec2Provider.StartEc2DescribeBatchProcessing()
+	go h.tracer.StartExport()
 	return h
 }
 
+// recordFeatureGates sets the feature gate metric to the state of the gates.
+func recordFeatureGates() {
+	for feature, spec := range config.DefaultFeatureGates {
+		enabled := 0.0
+		if config.DefaultFeatureGate.Enabled(feature) {
+			enabled = 1
+		}
+		authmetrics.FeatureEnabled.WithLabelValues(string(feature), string(spec.PreRelease)).Set(enabled)
+	}
+}
+
 func createMetrics() metrics {
 	m := metrics{
 		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Namespace: metricNS,
+			Namespace: authmetrics.Namespace,
 			Name:      "authenticate_latency_seconds",
 			Help:      "The latency for authenticate call",
 		}, []string{"result"}),
@@ -204,6 +625,8 @@ func createMetrics() metrics {
 func BuildMapperChain(cfg config.Config) ([]mapper.Mapper, error) {
 	modes := cfg.BackendMode
 	mappers := []mapper.Mapper{}
+	// namespaced mappings are consulted after every cluster-wide mapping
+	var namespaced []mapper.Mapper
 	for _, mode := range modes {
 		switch mode {
 		case mapper.ModeFile:
@@ -228,11 +651,62 @@ func BuildMapperChain(cfg config.Config) ([]mapper.Mapper, error) {
 				return nil, fmt.Errorf("backend-mode %q creation failed: %v", mode, err)
 			}
 			mappers = append(mappers, crdMapper)
+			if n := crdMapper.Namespaced(); n != nil {
+				namespaced = append(namespaced, n)
+			}
+		case mapper.ModeIAMRoleTags:
+			roleTagsMapper, err := roletags.NewRoleTagsMapper(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("backend-mode %q creation failed: %v", mode, err)
+			}
+			mappers = append(mappers, roleTagsMapper)
+		case mapper.ModeEKSAccessEntries:
+			accessEntriesMapper, err := accessentries.NewAccessEntriesMapper(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("backend-mode %q creation failed: %v", mode, err)
+			}
+			mappers = append(mappers, accessEntriesMapper)
 		default:
 			return nil, fmt.Errorf("backend-mode %q is not a valid mode", mode)
 		}
 	}
-	return mappers, nil
+	if cfg.CircuitBreakerFailureThreshold > 0 {
+		for i, m := range mappers {
+			mappers[i] = mapper.NewCircuitBreaker(m, cfg.CircuitBreakerFailureThreshold, cfg.CircuitBreakerOpenDuration)
+		}
+	}
+	if cfg.BackupMappingFile != "" {
+		backupMapper, err := file.NewBackupFileMapper(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("backup mapping file: %v", err)
+		}
+		mappers = append(mappers, backupMapper)
+	}
+	return append(mappers, namespaced...), nil
+}
+
+// NewHandler returns the HTTP handler of a server with cfg and mappers that
+// sends its STS requests with stsTransport, for tools such as the bench
+// command that serve it in-process against a stub STS.
+func NewHandler(cfg config.Config, mappers []mapper.Mapper, stsTransport http.RoundTripper) http.Handler {
+	c := &Server{Config: cfg, stsTransport: stsTransport}
+	return c.getHandler(mappers, nil, cfg.EC2DescribeInstancesQps, cfg.EC2DescribeInstancesBurst)
+}
+
+// MapIdentity maps identity with mappers the way the server would, for tools
+// such as the verify command. It returns the Kubernetes username and groups
+// and the backend that mapped the identity.
+func MapIdentity(cfg config.Config, mappers []mapper.Mapper, identity *token.Identity) (string, []string, string, error) {
+	h := &handler{
+		ec2Provider: ec2provider.New(cfg.ServerEC2DescribeInstancesRoleARN, cfg.EC2DescribeInstancesQps, cfg.EC2DescribeInstancesBurst),
+		unmapped:    newUnmappedFallback(cfg),
+	}
+	go h.ec2Provider.StartEc2DescribeBatchProcessing()
+	mapping, source, err := h.mapIdentity(context.Background(), mappers, identity, false)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return mapping.Username, mapping.Groups, source, nil
 }
 
 func duration(start time.Time) float64 {
@@ -240,7 +714,7 @@ func duration(start time.Time) float64 {
 }
 
 func (h *handler) isLoggableIdentity(identity *token.Identity) bool {
-	for _, account := range h.scrubbedAccounts {
+	for _, account := range h.current().scrubbedAccounts {
 		if identity.AccountID == account {
 			return false
 		}
@@ -248,53 +722,205 @@ func (h *handler) isLoggableIdentity(identity *token.Identity) bool {
 	return true
 }
 
+// sourceIP returns the IP address of the client that sent req.
+func sourceIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the address tokens bound to a source IP presented in req
+// are checked against: the first address of the client IP header, if one is
+// configured, or the address of the caller. It returns "" if the header is
+// missing or isn't an IP address, so bound tokens are rejected.
+func (h *handler) clientIP(req *http.Request) string {
+	if h.clientIPHeader == "" {
+		return sourceIP(req)
+	}
+	// proxies append to the header as X-Forwarded-For does, so the first
+	// address is that of the client
+	value := strings.TrimSpace(strings.Split(req.Header.Get(h.clientIPHeader), ",")[0])
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// observeResult records the request latency under the given result label and
+// notes the result as the reason for the audited decision.
+func (h *handler) observeResult(event *audit.Event, result string, start time.Time) {
+	h.metrics.latency.WithLabelValues(result).Observe(duration(start))
+	event.Reason = result
+}
+
+// logAuditEvent writes event to the audit log, if one is configured.
+func (h *handler) logAuditEvent(event *audit.Event, start time.Time) {
+	if h.auditLogger == nil {
+		return
+	}
+	event.LatencySeconds = duration(start)
+	h.auditLogger.Log(*event)
+}
+
 func (h *handler) authenticateEndpoint(w http.ResponseWriter, req *http.Request) {
 	start := time.Now()
-	log := logrus.WithFields(logrus.Fields{
+	log := logger.WithFields(logrus.Fields{
 		"path":   req.URL.Path,
 		"client": req.RemoteAddr,
 		"method": req.Method,
 	})
 
+	event := audit.Event{
+		Timestamp: start,
+		SourceIP:  sourceIP(req),
+		ClientIP:  h.clientIP(req),
+		Decision:  audit.DecisionDeny,
+	}
+	defer h.logAuditEvent(&event, start)
+
+	ctx, span := h.tracer.Start(tracing.Extract(req.Context(), req.Header), "authenticate", tracing.SpanKindServer)
+	defer func() {
+		span.SetAttribute("authenticate.result", event.Reason)
+		span.SetAttribute("authenticate.decision", event.Decision)
+		span.End()
+	}()
+
 	if req.Method != http.MethodPost {
 		log.Error("unexpected request method")
 		http.Error(w, "expected POST", http.StatusMethodNotAllowed)
-		h.metrics.latency.WithLabelValues(metricMalformed).Observe(duration(start))
+		h.observeResult(&event, metricMalformed, start)
 		return
 	}
 	if req.Body == nil {
 		log.Error("empty request body")
 		http.Error(w, "expected a request body", http.StatusBadRequest)
-		h.metrics.latency.WithLabelValues(metricMalformed).Observe(duration(start))
+		h.observeResult(&event, metricMalformed, start)
 		return
 	}
 	defer req.Body.Close()
 
-	var tokenReview authenticationv1beta1.TokenReview
+	// v1 is a superset of v1beta1, so either version decodes into it.
+	var tokenReview authenticationv1.TokenReview
 	if err := json.NewDecoder(req.Body).Decode(&tokenReview); err != nil {
 		log.WithError(err).Error("could not parse request body")
 		http.Error(w, "expected a request body to be a TokenReview", http.StatusBadRequest)
-		h.metrics.latency.WithLabelValues(metricMalformed).Observe(duration(start))
+		h.observeResult(&event, metricMalformed, start)
+		return
+	}
+	apiVersion := tokenReview.APIVersion
+	if apiVersion != "" && !tokenReviewVersions[apiVersion] {
+		log.WithField("apiVersion", apiVersion).Error("unsupported TokenReview version")
+		http.Error(w, fmt.Sprintf("unsupported TokenReview apiVersion %q", apiVersion), http.StatusBadRequest)
+		h.observeResult(&event, metricMalformed, start)
 		return
 	}
-
-	// TODO: rate limit here so we can't be tricked into spamming AWS
 
 	// all responses from here down have JSON bodies
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
+	code := http.StatusOK
+	status := authenticationv1.TokenReviewStatus{}
+	if user, authErr := h.authenticate(ctx, tokenReview.Spec.Token, tokenReview.Spec.Audiences, &event, log, start); authErr == nil {
+		userExtra := map[string]authenticationv1.ExtraValue{}
+		for k, v := range user.Extra {
+			userExtra[k] = authenticationv1.ExtraValue(v)
+		}
+		status = authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			User: authenticationv1.UserInfo{
+				Username: user.Username,
+				UID:      user.UID,
+				Groups:   user.Groups,
+				Extra:    userExtra,
+			},
+			Audiences: user.Audiences,
+		}
+	} else {
+		code = http.StatusForbidden
+		status.Error = authErr.String()
+	}
+
+	res, err := encodeTokenReview(apiVersion, status)
+	if err != nil {
+		log.WithError(err).Error("could not encode TokenReview response")
+		http.Error(w, "could not encode TokenReview response", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(res)
+}
+
+// userInfo is the Kubernetes user a token authenticates as.
+type userInfo struct {
+	Username string
+	UID      string
+	Groups   []string
+	Extra    map[string][]string
+	// Audiences are the requested audiences the token is valid for.
+	Audiences []string
+}
+
+// deny records a failed authentication with result and reason code, and
+// returns its error.
+func (h *handler) deny(event *audit.Event, result, reason, message string, start time.Time) (*userInfo, *AuthenticationError) {
+	h.observeResult(event, result, start)
+	authmetrics.AuthenticationFailures.WithLabelValues(reason).Inc()
+	return nil, &AuthenticationError{Reason: reason, Message: message}
+}
+
+// authenticate verifies tok for audiences, if any, and maps its identity to a
+// Kubernetes user, recording the outcome in event and the metrics. It is
+// shared by the webhook and gRPC APIs, which only differ in how they encode
+// the result.
+func (h *handler) authenticate(ctx context.Context, tok string, audiences []string, event *audit.Event, log *logrus.Entry, start time.Time) (*userInfo, *AuthenticationError) {
+	if h.negative != nil && h.negative.hit(tok, time.Now()) {
+		authmetrics.NegativeCacheHits.Inc()
+		log.Warn("access denied: the identity of the token was recently found unmapped")
+		return h.deny(event, metricUnknown, ReasonUnmappedARN, "the identity of the token is not mapped", start)
+	}
+
+	// stop calling STS once the API server has given up on the request
+	if h.authenticationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.authenticationTimeout)
+		defer cancel()
+	}
+
 	// if the token is invalid, reject with a 403
-	identity, err := h.verifier.Verify(tokenReview.Spec.Token)
+	verifyStart := time.Now()
+	identity, err := h.verifyToken(ctx, tok, event.ClientIP)
+	stsLatency := time.Since(verifyStart)
 	if err != nil {
+		log.WithError(err).Warn("access denied")
+		result := metricInvalid
 		if _, ok := err.(token.STSError); ok {
-			h.metrics.latency.WithLabelValues(metricSTSError).Observe(duration(start))
-		} else {
-			h.metrics.latency.WithLabelValues(metricInvalid).Observe(duration(start))
+			result = metricSTSError
 		}
-		log.WithError(err).Warn("access denied")
-		w.WriteHeader(http.StatusForbidden)
-		w.Write(tokenReviewDenyJSON)
-		return
+		return h.deny(event, result, tokenErrorReason(err), err.Error(), start)
+	}
+
+	// Without validation the token is treated as valid for whatever the
+	// apiserver asked, as it is bound to the cluster ID rather than to an
+	// audience.
+	if h.validateAudiences && len(audiences) > 0 {
+		valid := false
+		for _, audience := range audiences {
+			if audience == identity.ClusterID {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			log.WithFields(logrus.Fields{
+				"clusterID": identity.ClusterID,
+				"audiences": audiences,
+			}).Warn("access denied: token cluster ID is not a requested audience")
+			return h.deny(event, metricInvalid, ReasonBadClusterID, "the cluster ID of the token is not a requested audience", start)
+		}
+		audiences = []string{identity.ClusterID}
 	}
 
 	if h.isLoggableIdentity(identity) {
@@ -308,15 +934,55 @@ func (h *handler) authenticateEndpoint(w http.ResponseWriter, req *http.Request)
 
 		// look up the ARN in each of our mappings to fill in the username and groups
 		log = log.WithField("arn", identity.CanonicalARN)
+
+		event.ARN = identity.ARN
+		event.CanonicalARN = identity.CanonicalARN
+		event.AccountID = identity.AccountID
+	}
+
+	if h.replays != nil {
+		if reason := h.replays.check(identity.Signature, event.ClientIP, identity.Expiration, time.Now()); reason != "" {
+			log.WithField("replay", reason).Warn("access denied: token replay detected")
+			return h.deny(event, metricReplay, ReasonReplayed, "token replay detected: "+reason, start)
+		}
+	}
+
+	if !h.checkSessionName(identity) {
+		log.WithField("session", identity.SessionName).Warn("access denied: session name not allowed by the session name policies of the role")
+		return h.deny(event, metricSession, ReasonBadSessionName, "the session name is not allowed for the role", start)
 	}
 
-	username, groups, err := h.doMapping(identity)
+	mapping, source, err := h.doMapping(ctx, identity)
 	if err != nil {
-		h.metrics.latency.WithLabelValues(metricUnknown).Observe(duration(start))
+		if h.negative != nil && err == mapper.ErrNotMapped {
+			h.negative.add(tok, time.Now())
+		}
+		h.shadowMapping(identity, "", nil, err)
 		log.WithError(err).Warn("access denied")
-		w.WriteHeader(http.StatusForbidden)
-		w.Write(tokenReviewDenyJSON)
-		return
+		if err == mapper.ErrNotMapped {
+			return h.deny(event, metricUnknown, ReasonUnmappedARN, "the identity of the token is not mapped", start)
+		}
+		return h.deny(event, metricUnknown, ReasonMappingError, err.Error(), start)
+	}
+	username, groups := mapping.Username, mapping.Groups
+	if !h.checkUnsafeGroups(groups, source, event, log) {
+		h.shadowMapping(identity, username, groups, nil)
+		return h.deny(event, metricUnsafe, ReasonUnsafeGroups, "the mapping grants reserved groups", start)
+	}
+	h.shadowMapping(identity, username, groups, nil)
+	if mapping.LookupIAMGroups {
+		groups = h.withIAMGroups(identity, groups, log)
+	}
+	if h.postMappingHook != nil {
+		var reason, message string
+		groups, reason, message = h.applyPostMappingHook(ctx, identity, username, groups, source, log)
+		if reason != "" {
+			return h.deny(event, metricHook, reason, message, start)
+		}
+	}
+	groups, ok := h.applyGroupLimits(groups, event, log)
+	if !ok {
+		return h.deny(event, metricGroups, ReasonInvalidGroups, "the mapping grants groups over the group limits", start)
 	}
 
 	uid := fmt.Sprintf("aws-iam-authenticator:administrative:%s", username)
@@ -331,101 +997,276 @@ func (h *handler) authenticateEndpoint(w http.ResponseWriter, req *http.Request)
 		"uid":      uid,
 		"groups":   groups,
 	}).Info("access granted")
-	h.metrics.latency.WithLabelValues(metricSuccess).Observe(duration(start))
-	w.WriteHeader(http.StatusOK)
+	h.observeResult(event, metricSuccess, start)
+	event.Decision = audit.DecisionAllow
+	event.Username = username
+	event.Groups = groups
 
-	userExtra := map[string]authenticationv1beta1.ExtraValue{}
-	if h.isLoggableIdentity(identity) {
-		userExtra["arn"] = authenticationv1beta1.ExtraValue{identity.ARN}
-		userExtra["canonicalArn"] = authenticationv1beta1.ExtraValue{identity.CanonicalARN}
-		userExtra["sessionName"] = authenticationv1beta1.ExtraValue{identity.SessionName}
-		userExtra["accessKeyId"] = authenticationv1beta1.ExtraValue{identity.AccessKeyID}
+	userExtra := map[string][]string{}
+	if h.isLoggableIdentity(identity) && h.identityExtrasFor(mapping) {
+		userExtra["arn"] = []string{identity.ARN}
+		userExtra["canonicalArn"] = []string{identity.CanonicalARN}
+		userExtra["accountId"] = []string{identity.AccountID}
+		userExtra["sessionName"] = []string{identity.SessionName}
+		userExtra["accessKeyId"] = []string{identity.AccessKeyID}
 	}
+	if h.auditAnnotations {
+		if h.isLoggableIdentity(identity) {
+			userExtra[extraOriginalARN] = []string{identity.ARN}
+		}
+		userExtra[extraMappingSource] = []string{source}
+		userExtra[extraSTSLatency] = []string{stsLatency.String()}
+	}
+	for k, v := range h.roleExtras(identity, log) {
+		userExtra[k] = v
+	}
+	return &userInfo{Username: username, UID: uid, Groups: groups, Extra: userExtra, Audiences: audiences}, nil
+}
 
-	json.NewEncoder(w).Encode(authenticationv1beta1.TokenReview{
-		Status: authenticationv1beta1.TokenReviewStatus{
-			Authenticated: true,
-			User: authenticationv1beta1.UserInfo{
-				Username: username,
-				UID:      uid,
-				Groups:   groups,
-				Extra:    userExtra,
-			},
-		},
+// checkUnsafeGroups applies unsafeGroupsAction to groups mapped by the
+// backend source and reports whether the identity may be authenticated.
+// MountedFile, EKSAccessEntries, backup mapping file, mapping rule and
+// unmapped fallback mappings are trusted, as they can't be edited from within
+// the cluster.
+func (h *handler) checkUnsafeGroups(groups []string, source string, event *audit.Event, log *logrus.Entry) bool {
+	backend := strings.TrimSuffix(source, mappingSourceAccountSuffix)
+	if h.unsafeGroupsAction == "" || h.unsafeGroupsAction == mapper.UnsafeGroupsAllow || backend == mapper.ModeMountedFile || backend == mapper.ModeEKSAccessEntries || backend == mapper.ModeBackupFile || backend == mappingSourceRules || backend == mappingSourceUnmapped {
+		return true
+	}
+	reserved := mapper.ReservedGroups(groups, h.reservedGroupPrefixes)
+	if len(reserved) == 0 {
+		return true
+	}
+	authmetrics.UnsafeGroupMappings.WithLabelValues(backend, h.unsafeGroupsAction).Inc()
+	log = log.WithFields(logrus.Fields{
+		"backend":  backend,
+		"reserved": reserved,
 	})
+	if h.unsafeGroupsAction == mapper.UnsafeGroupsReject {
+		log.Warn("access denied: mapping grants reserved groups")
+		return false
+	}
+	log.Warn("mapping grants reserved groups")
+	event.Warnings = append(event.Warnings, fmt.Sprintf("%s mapping grants reserved groups %v", backend, reserved))
+	return true
+}
+
+// applyGroupLimits applies groupLimitsAction to groups over groupLimits and
+// returns the groups to authenticate the identity with, and whether it may
+// be authenticated.
+func (h *handler) applyGroupLimits(groups []string, event *audit.Event, log *logrus.Entry) ([]string, bool) {
+	if !h.groupLimits.Enabled() {
+		return groups, true
+	}
+	kept, violations := h.groupLimits.Apply(groups)
+	if len(violations) == 0 {
+		return groups, true
+	}
+	action := h.groupLimitsAction
+	if action == "" {
+		action = mapper.GroupLimitsReject
+	}
+	authmetrics.GroupLimitViolations.WithLabelValues(action).Inc()
+	log = log.WithField("violations", violations)
+	if action == mapper.GroupLimitsReject {
+		log.Warn("access denied: mapping grants groups over the group limits")
+		return nil, false
+	}
+	log.Warn("dropped groups over the group limits")
+	event.Warnings = append(event.Warnings, fmt.Sprintf("dropped groups over the group limits: %s", strings.Join(violations, "; ")))
+	return kept, true
+}
+
+// roleExtras returns the user extras of the description and tags of the role
+// of identity, if it is a role session. Extras only inform admission
+// controllers, so if IAM can't be queried the session is authenticated
+// without them.
+func (h *handler) roleExtras(identity *token.Identity, log *logrus.Entry) map[string][]string {
+	if h.roleInfo == nil || !strings.Contains(identity.CanonicalARN, ":role/") {
+		return nil
+	}
+	info, err := h.roleInfo.Role(identity.CanonicalARN)
+	if err != nil {
+		log.WithError(err).Warn("could not get the description and tags of the role, authenticating without them")
+		return nil
+	}
+	return roleinfo.Extras(info, h.roleInfoDescription, h.roleInfoTags)
+}
+
+// withIAMGroups returns groups followed by the Kubernetes groups of the IAM
+// groups identity is a member of. Groups only grant permissions, so if IAM
+// can't be queried the user is authenticated with the mapped groups alone.
+func (h *handler) withIAMGroups(identity *token.Identity, groups []string, log *logrus.Entry) []string {
+	if h.iamGroups == nil || !strings.Contains(identity.CanonicalARN, ":user/") {
+		return groups
+	}
+	iamGroups, err := h.iamGroups.Groups(identity.ARN)
+	if err != nil {
+		log.WithError(err).Warn("could not look up IAM groups, continuing without them")
+		return groups
+	}
+	return append(append([]string{}, groups...), iamGroups...)
+}
+
+// identityExtrasFor reports whether the AWS identity is added to the user
+// extras of identities mapped by mapping.
+func (h *handler) identityExtrasFor(mapping *config.IdentityMapping) bool {
+	if mapping.IdentityExtras != nil {
+		return *mapping.IdentityExtras
+	}
+	return h.identityExtras
 }
 
-func (h *handler) doMapping(identity *token.Identity) (string, []string, error) {
+// verifyToken verifies the token presented from clientIP against STS within a
+// client span, until ctx is done.
+func (h *handler) verifyToken(ctx context.Context, tok, clientIP string) (*token.Identity, error) {
+	_, span := h.tracer.Start(ctx, "sts.GetCallerIdentity", tracing.SpanKindClient)
+	defer span.End()
+
+	var identity *token.Identity
+	var err error
+	verifier := h.current().verifier
+	if v, ok := verifier.(token.ContextVerifier); ok {
+		identity, err = v.VerifyWithContext(ctx, tok, clientIP)
+	} else if v, ok := verifier.(token.SourceVerifier); ok {
+		identity, err = v.VerifyFromSource(tok, clientIP)
+	} else {
+		identity, err = verifier.Verify(tok)
+	}
+	span.RecordError(err)
+	return identity, err
+}
+
+func (h *handler) lookup(ctx context.Context, m mapper.Mapper, canonicalARN string, instrument bool) (*config.IdentityMapping, error) {
+	if !instrument {
+		return m.Map(canonicalARN)
+	}
+	_, span := h.tracer.Start(ctx, "mapper.Map", tracing.SpanKindInternal)
+	defer span.End()
+	span.SetAttribute("mapper.backend", m.Name())
+	mapping, err := m.Map(canonicalARN)
+	switch err {
+	case nil:
+		authmetrics.MappingLookups.WithLabelValues(m.Name(), authmetrics.LookupHit).Inc()
+		span.SetAttribute("mapper.result", authmetrics.LookupHit)
+	case mapper.ErrNotMapped:
+		authmetrics.MappingLookups.WithLabelValues(m.Name(), authmetrics.LookupMiss).Inc()
+		span.SetAttribute("mapper.result", authmetrics.LookupMiss)
+	default:
+		authmetrics.MappingLookups.WithLabelValues(m.Name(), authmetrics.LookupError).Inc()
+		span.SetAttribute("mapper.result", authmetrics.LookupError)
+		span.RecordError(err)
+	}
+	return mapping, err
+}
+
+// mappingSourceAccountSuffix is appended to the backend name when an identity
+// is mapped because its account is allowed rather than by an explicit mapping.
+const mappingSourceAccountSuffix = "/account"
+
+// doMapping looks the identity up in each mapper in turn and returns the
+// username and groups along with the name of the backend that mapped it.
+func (h *handler) doMapping(ctx context.Context, identity *token.Identity) (*config.IdentityMapping, string, error) {
+	return h.mapIdentity(ctx, h.current().mappers, identity, true)
+}
+
+// mapIdentity looks the identity up in mappers and returns the mapping with
+// its templates rendered, and the backend that mapped it. Expired mappings
+// are skipped. Identities no mapper maps fall back to the mapping rules, then
+// the unmapped mapping, unless a mapper failed.
+// Lookups are only traced and counted in metrics if instrument is set, so
+// shadow evaluations don't skew them.
+func (h *handler) mapIdentity(ctx context.Context, mappers []mapper.Mapper, identity *token.Identity, instrument bool) (*config.IdentityMapping, string, error) {
 	var errs []error
 
-	canonicalARN := strings.ToLower(identity.CanonicalARN)
+	canonicalARN := mapper.ARNKey(identity.CanonicalARN, h.strictARNMatching)
 
-	for _, m := range h.mappers {
-		mapping, err := m.Map(canonicalARN)
+	for _, m := range mappers {
+		mapping, err := h.lookup(ctx, m, canonicalARN, instrument)
+		if err == nil && mapping.Expired(time.Now()) {
+			if instrument {
+				authmetrics.ExpiredMappings.WithLabelValues(m.Name()).Inc()
+				logger.WithFields(logrus.Fields{
+					"backend":  m.Name(),
+					"arn":      mapping.IdentityARN,
+					"notAfter": mapping.NotAfter.Format(time.RFC3339),
+				}).Warn("ignoring expired mapping")
+			}
+			err = mapper.ErrNotMapped
+		}
 		if err == nil {
 			// Mapping found, try to render any templates like {{EC2PrivateDNSName}}
 			username, groups, err := h.renderTemplates(*mapping, identity)
 			if err != nil {
-				return "", nil, fmt.Errorf("mapper %s renderTemplates error: %v", m.Name(), err)
+				return nil, "", fmt.Errorf("mapper %s renderTemplates error: %v", m.Name(), err)
 			}
-			return username, groups, nil
+			rendered := *mapping
+			rendered.Username, rendered.Groups = username, groups
+			return &rendered, m.Name(), nil
 		} else {
 			if err != mapper.ErrNotMapped {
 				errs = append(errs, fmt.Errorf("mapper %s Map error: %v", m.Name(), err))
 			}
 
-			if m.IsAccountAllowed(identity.AccountID) {
-				return identity.CanonicalARN, []string{}, nil
+			allowed, err := m.IsAccountAllowed(identity.AccountID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("mapper %s IsAccountAllowed error: %v", m.Name(), err))
+			} else if allowed {
+				return &config.IdentityMapping{
+					IdentityARN: canonicalARN,
+					Username:    identity.CanonicalARN,
+					Groups:      []string{},
+				}, m.Name() + mappingSourceAccountSuffix, nil
 			}
 		}
 	}
 
 	if len(errs) > 0 {
-		return "", nil, utilerrors.NewAggregate(errs)
+		return nil, "", utilerrors.NewAggregate(errs)
 	}
-	return "", nil, mapper.ErrNotMapped
-}
-
-func (h *handler) renderTemplates(mapping config.IdentityMapping, identity *token.Identity) (string, []string, error) {
-	var username string
-	groups := []string{}
-	var err error
-
-	userPattern := mapping.Username
-	username, err = h.renderTemplate(userPattern, identity)
+	mapping, rule, err := h.rules.mapping(identity, canonicalARN)
 	if err != nil {
-		return "", nil, fmt.Errorf("error rendering username template %q: %s", userPattern, err.Error())
+		return nil, "", err
 	}
-
-	for _, groupPattern := range mapping.Groups {
-		group, err := h.renderTemplate(groupPattern, identity)
+	if mapping != nil {
+		username, groups, err := h.renderTemplates(*mapping, identity)
 		if err != nil {
-			return "", nil, fmt.Errorf("error rendering group template %q: %s", groupPattern, err.Error())
+			return nil, "", fmt.Errorf("mapping rule %s renderTemplates error: %v", rule, err)
 		}
-		groups = append(groups, group)
+		mapping.Username, mapping.Groups = username, groups
+		return mapping, mappingSourceRules, nil
 	}
+	if mapping := h.current().unmapped.mapping(identity, canonicalARN); mapping != nil {
+		username, groups, err := h.renderTemplates(*mapping, identity)
+		if err != nil {
+			return nil, "", fmt.Errorf("unmapped fallback renderTemplates error: %v", err)
+		}
+		mapping.Username, mapping.Groups = username, groups
+		return mapping, mappingSourceUnmapped, nil
+	}
+	return nil, "", mapper.ErrNotMapped
+}
 
-	return username, groups, nil
+func (h *handler) renderTemplates(mapping config.IdentityMapping, identity *token.Identity) (string, []string, error) {
+	return decision.Render(mapping.Username, mapping.Groups, decisionIdentity(identity), h.resolvePrivateDNSName)
 }
 
 func (h *handler) renderTemplate(template string, identity *token.Identity) (string, error) {
-	// Private DNS requires EC2 API call
-	if strings.Contains(template, "{{EC2PrivateDNSName}}") {
-		if !instanceIDPattern.MatchString(identity.SessionName) {
-			return "", fmt.Errorf("SessionName did not contain an instance id")
-		}
-		privateDNSName, err := h.ec2Provider.GetPrivateDNSName(identity.SessionName)
-		if err != nil {
-			return "", err
-		}
-		template = strings.Replace(template, "{{EC2PrivateDNSName}}", privateDNSName, -1)
-	}
+	return decision.RenderTemplate(template, decisionIdentity(identity), h.resolvePrivateDNSName)
+}
 
-	template = strings.Replace(template, "{{AccountID}}", identity.AccountID, -1)
-	sessionName := strings.Replace(identity.SessionName, "@", "-", -1)
-	template = strings.Replace(template, "{{SessionName}}", sessionName, -1)
-	template = strings.Replace(template, "{{SessionNameRaw}}", identity.SessionName, -1)
-	template = strings.Replace(template, "{{AccessKeyID}}", identity.AccessKeyID, -1)
+// resolvePrivateDNSName looks up the private DNS name of an EC2 instance
+// through the EC2 API, for the {{EC2PrivateDNSName}} template.
+func (h *handler) resolvePrivateDNSName(instanceID string) (string, error) {
+	return h.ec2Provider.GetPrivateDNSName(instanceID)
+}
 
-	return template, nil
+func decisionIdentity(identity *token.Identity) decision.Identity {
+	return decision.Identity{
+		ARN:         identity.ARN,
+		AccountID:   identity.AccountID,
+		UserID:      identity.UserID,
+		SessionName: identity.SessionName,
+		AccessKeyID: identity.AccessKeyID,
+	}
 }
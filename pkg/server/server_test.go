@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -10,20 +11,38 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd"
 	iamauthenticatorv1alpha1 "sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/apis/iamauthenticator/v1alpha1"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/crd/controller"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/roleinfo"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
 
+// tokenReviewDenyJSON is the response to an unauthenticated TokenReview
+// request that carries no apiVersion, denied for reason.
+func tokenReviewDenyJSON(reason, message string) string {
+	authErr := &AuthenticationError{Reason: reason, Message: message}
+	res, err := json.Marshal(authenticationv1beta1.TokenReview{
+		Status: authenticationv1beta1.TokenReviewStatus{Error: authErr.String()},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return string(res)
+}
+
 func verifyBodyContains(t *testing.T, resp *httptest.ResponseRecorder, s string) {
 	t.Helper()
 	b, err := ioutil.ReadAll(resp.Body)
@@ -102,8 +121,9 @@ func newIAMIdentityMapping(arn, canonicalARN, username string, groups []string)
 
 func setup(verifier token.Verifier) *handler {
 	return &handler{
-		verifier: verifier,
-		metrics:  createMetrics(),
+		verifier:       verifier,
+		metrics:        createMetrics(),
+		identityExtras: true,
 	}
 }
 
@@ -309,7 +329,7 @@ func TestAuthenticateVerifierError(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonMalformedToken, "There was an error"))
 	validateMetrics(t, validateOpts{invalidToken: 1})
 }
 
@@ -331,7 +351,7 @@ func TestAuthenticateVerifierErrorCRD(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonMalformedToken, "There was an error"))
 	validateMetrics(t, validateOpts{invalidToken: 1})
 }
 
@@ -353,7 +373,7 @@ func TestAuthenticateVerifierSTSError(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonSTSRejected, "sts getCallerIdentity failed: There was an error"))
 	validateMetrics(t, validateOpts{stsError: 1})
 }
 
@@ -375,7 +395,7 @@ func TestAuthenticateVerifierSTSErrorCRD(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonSTSRejected, "sts getCallerIdentity failed: There was an error"))
 	validateMetrics(t, validateOpts{stsError: 1})
 }
 
@@ -403,7 +423,7 @@ func TestAuthenticateVerifierNotMapped(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonUnmappedARN, "the identity of the token is not mapped"))
 	validateMetrics(t, validateOpts{unknownUser: 1})
 }
 
@@ -431,7 +451,7 @@ func TestAuthenticateVerifierNotMappedCRD(t *testing.T) {
 	if resp.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
 	}
-	verifyBodyContains(t, resp, string(tokenReviewDenyJSON))
+	verifyBodyContains(t, resp, tokenReviewDenyJSON(ReasonUnmappedARN, "the identity of the token is not mapped"))
 	validateMetrics(t, validateOpts{unknownUser: 1})
 }
 
@@ -475,6 +495,7 @@ func TestAuthenticateVerifierRoleMapping(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{"ABCDEF"},
 		}))
@@ -515,6 +536,7 @@ func TestAuthenticateVerifierRoleMappingCRD(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -559,6 +581,7 @@ func TestAuthenticateVerifierUserMapping(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -599,6 +622,7 @@ func TestAuthenticateVerifierUserMappingCRD(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -639,6 +663,7 @@ func TestAuthenticateVerifierAccountMappingForUser(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -679,6 +704,7 @@ func TestAuthenticateVerifierAccountMappingForUserCRD(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:user/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -719,6 +745,7 @@ func TestAuthenticateVerifierAccountMappingForRole(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:assumed-role/Test/extra"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -759,6 +786,7 @@ func TestAuthenticateVerifierAccountMappingForRoleCRD(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:assumed-role/Test/extra"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/Test"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"TestSession"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -804,6 +832,7 @@ func TestAuthenticateVerifierNodeMapping(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/TestNodeRole"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/TestNodeRole"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"i-0c6f21bf1f24f9708"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -846,6 +875,7 @@ func TestAuthenticateVerifierNodeMappingCRD(t *testing.T) {
 		map[string]authenticationv1beta1.ExtraValue{
 			"arn":          authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/TestNodeRole"},
 			"canonicalArn": authenticationv1beta1.ExtraValue{"arn:aws:iam::0123456789012:role/TestNodeRole"},
+			"accountId":    authenticationv1beta1.ExtraValue{"0123456789012"},
 			"sessionName":  authenticationv1beta1.ExtraValue{"i-0c6f21bf1f24f9708"},
 			"accessKeyId":  authenticationv1beta1.ExtraValue{""},
 		}))
@@ -853,6 +883,367 @@ func TestAuthenticateVerifierNodeMappingCRD(t *testing.T) {
 
 }
 
+func TestAuthenticateTokenReviewV1(t *testing.T) {
+	resp := httptest.NewRecorder()
+
+	data, err := json.Marshal(authenticationv1.TokenReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"},
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     "token",
+			Audiences: []string{"https://kubernetes.default.svc"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal in put data: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+	h := setup(&testVerifier{err: nil, identity: &token.Identity{
+		ARN:          "arn:aws:iam::0123456789012:role/Test",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+		UserID:       "Test",
+		SessionName:  "TestSession",
+	}})
+	defer cleanup(h.metrics)
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::0123456789012:role/test": config.RoleMapping{
+			RoleARN:  "arn:aws:iam::0123456789012:role/Test",
+			Username: "TestUser",
+			Groups:   []string{"listers"},
+		},
+	}, nil, nil)}
+	h.authenticateEndpoint(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+
+	var actual authenticationv1.TokenReview
+	if err := json.NewDecoder(resp.Body).Decode(&actual); err != nil {
+		t.Fatalf("Could not decode TokenReview from body: %s", err)
+	}
+	if actual.APIVersion != "authentication.k8s.io/v1" || actual.Kind != "TokenReview" {
+		t.Errorf("expected a v1 TokenReview, got %s %s", actual.APIVersion, actual.Kind)
+	}
+	if !actual.Status.Authenticated || actual.Status.User.Username != "TestUser" {
+		t.Errorf("expected TestUser to be authenticated, got %+v", actual.Status)
+	}
+	if !reflect.DeepEqual(actual.Status.Audiences, []string{"https://kubernetes.default.svc"}) {
+		t.Errorf("expected requested audiences in status, got %v", actual.Status.Audiences)
+	}
+	validateMetrics(t, validateOpts{success: 1})
+}
+
+func TestAuthenticateValidateAudiences(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		audiences     []string
+		wantCode      int
+		wantAudiences []string
+	}{
+		{"cluster ID requested", []string{"https://kubernetes.default.svc", "cluster"}, http.StatusOK, []string{"cluster"}},
+		{"cluster ID not requested", []string{"https://kubernetes.default.svc"}, http.StatusForbidden, nil},
+		{"no audiences requested", nil, http.StatusOK, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			data, err := json.Marshal(authenticationv1.TokenReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"},
+				Spec:     authenticationv1.TokenReviewSpec{Token: "token", Audiences: c.audiences},
+			})
+			if err != nil {
+				t.Fatalf("Could not marshal in put data: %v", err)
+			}
+			req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+			h := setup(&testVerifier{err: nil, identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+				UserID:       "Test",
+				ClusterID:    "cluster",
+			}})
+			defer cleanup(h.metrics)
+			h.validateAudiences = true
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": config.RoleMapping{
+					RoleARN:  "arn:aws:iam::0123456789012:role/Test",
+					Username: "TestUser",
+				},
+			}, nil, nil)}
+			h.authenticateEndpoint(resp, req)
+			if resp.Code != c.wantCode {
+				t.Errorf("Expected status code %d, was %d", c.wantCode, resp.Code)
+			}
+			var actual authenticationv1.TokenReview
+			if err := json.NewDecoder(resp.Body).Decode(&actual); err != nil {
+				t.Fatalf("Could not decode TokenReview from body: %s", err)
+			}
+			if !reflect.DeepEqual(actual.Status.Audiences, c.wantAudiences) {
+				t.Errorf("expected audiences %v, got %v", c.wantAudiences, actual.Status.Audiences)
+			}
+		})
+	}
+}
+
+func TestAuthenticateReplayDetection(t *testing.T) {
+	h := setup(&testVerifier{err: nil, identity: &token.Identity{
+		ARN:          "arn:aws:iam::0123456789012:role/Test",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+		UserID:       "Test",
+		Signature:    "abcdef",
+		Expiration:   time.Now().Add(time.Minute),
+	}})
+	defer cleanup(h.metrics)
+	h.replays = newReplayCache(0, true, nil, "aws", "cluster")
+	data, err := json.Marshal(authenticationv1beta1.TokenReview{
+		Spec: authenticationv1beta1.TokenReviewSpec{
+			Token: "token",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal in put data: %v", err)
+	}
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::0123456789012:role/test": config.RoleMapping{
+			RoleARN:  "arn:aws:iam::0123456789012:role/Test",
+			Username: "TestUser",
+		},
+	}, nil, nil)}
+	for _, c := range []struct {
+		remoteAddr string
+		wantCode   int
+	}{
+		{"10.0.0.1:1234", http.StatusOK},
+		{"10.0.0.1:5678", http.StatusOK},
+		{"10.0.0.2:1234", http.StatusForbidden},
+	} {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+		req.RemoteAddr = c.remoteAddr
+		h.authenticateEndpoint(resp, req)
+		if resp.Code != c.wantCode {
+			t.Errorf("%s: expected status code %d, was %d", c.remoteAddr, c.wantCode, resp.Code)
+		}
+	}
+}
+
+func TestAuthenticateReplayDetectionTwoAPIServers(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		bindSource bool
+		header     string
+		wantCode   int
+	}{
+		{name: "unbound", wantCode: http.StatusOK},
+		{name: "bound to the API server", bindSource: true, wantCode: http.StatusForbidden},
+		{name: "bound to the client IP header", bindSource: true, header: "X-Forwarded-For", wantCode: http.StatusOK},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+				Signature:    "abcdef",
+				Expiration:   time.Now().Add(time.Minute),
+			}})
+			defer cleanup(h.metrics)
+			h.replays = newReplayCache(0, c.bindSource, nil, "aws", "cluster")
+			h.clientIPHeader = c.header
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": {RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "TestUser"},
+			}, nil, nil)}
+			data, err := json.Marshal(authenticationv1beta1.TokenReview{
+				Spec: authenticationv1beta1.TokenReviewSpec{Token: "token"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the same kubectl token reaches two API servers behind a
+			// load balancer
+			var code int
+			for _, apiServer := range []string{"10.0.0.1:6443", "10.0.0.2:6443"} {
+				resp := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+				req.RemoteAddr = apiServer
+				req.Header.Set("X-Forwarded-For", "192.0.2.10")
+				h.authenticateEndpoint(resp, req)
+				code = resp.Code
+			}
+			if code != c.wantCode {
+				t.Errorf("expected status code %d from the second API server, was %d", c.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestAuthenticateIdentityExtrasOverride(t *testing.T) {
+	enabled, disabled := true, false
+	for _, c := range []struct {
+		name     string
+		server   bool
+		mapping  *bool
+		wantARNs bool
+	}{
+		{"server default", true, nil, true},
+		{"disabled by mapping", true, &disabled, false},
+		{"enabled by mapping", false, &enabled, true},
+		{"disabled by server", false, nil, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{err: nil, identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+				UserID:       "Test",
+			}})
+			defer cleanup(h.metrics)
+			h.identityExtras = c.server
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": config.RoleMapping{
+					RoleARN:        "arn:aws:iam::0123456789012:role/Test",
+					Username:       "TestUser",
+					IdentityExtras: c.mapping,
+				},
+			}, nil, nil)}
+			user, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if authErr != nil {
+				t.Fatalf("expected the identity to be authenticated")
+			}
+			if _, got := user.Extra["accountId"]; got != c.wantARNs {
+				t.Errorf("expected identity extras %v, got %v", c.wantARNs, user.Extra)
+			}
+		})
+	}
+}
+
+type testIAMGroups struct {
+	groups []string
+	err    error
+}
+
+func (g testIAMGroups) Groups(userARN string) ([]string, error) {
+	return g.groups, g.err
+}
+
+func TestAuthenticateIAMGroups(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		lookup     bool
+		iamGroups  testIAMGroups
+		wantGroups []string
+	}{
+		{"lookup", true, testIAMGroups{groups: []string{"iam:dev"}}, []string{"mapped", "iam:dev"}},
+		{"not enabled", false, testIAMGroups{groups: []string{"iam:dev"}}, []string{"mapped"}},
+		{"lookup error", true, testIAMGroups{err: errors.New("throttled")}, []string{"mapped"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{err: nil, identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:user/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:user/Test",
+				AccountID:    "0123456789012",
+				UserID:       "Test",
+			}})
+			defer cleanup(h.metrics)
+			h.iamGroups = c.iamGroups
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(nil, map[string]config.UserMapping{
+				"arn:aws:iam::0123456789012:user/test": config.UserMapping{
+					UserARN:         "arn:aws:iam::0123456789012:user/Test",
+					Username:        "TestUser",
+					Groups:          []string{"mapped"},
+					LookupIAMGroups: c.lookup,
+				},
+			}, nil)}
+			user, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if authErr != nil {
+				t.Fatalf("expected the identity to be authenticated")
+			}
+			if !reflect.DeepEqual(user.Groups, c.wantGroups) {
+				t.Errorf("expected groups %v, got %v", c.wantGroups, user.Groups)
+			}
+		})
+	}
+}
+
+type testRoleInfo struct {
+	info *roleinfo.Info
+	err  error
+}
+
+func (r testRoleInfo) Role(roleARN string) (*roleinfo.Info, error) {
+	return r.info, r.err
+}
+
+func TestAuthenticateRoleExtras(t *testing.T) {
+	info := &roleinfo.Info{Description: "Developers", Tags: map[string]string{"Team": "payments", "Owner": "alice"}}
+	for _, c := range []struct {
+		name       string
+		roleInfo   testRoleInfo
+		wantExtras map[string][]string
+	}{
+		{"extras", testRoleInfo{info: info}, map[string][]string{
+			roleinfo.ExtraDescription:        {"Developers"},
+			roleinfo.ExtraTagPrefix + "team": {"payments"},
+		}},
+		{"lookup error", testRoleInfo{err: errors.New("access denied")}, map[string][]string{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:sts::123456789012:assumed-role/Developer/alice",
+				CanonicalARN: "arn:aws:iam::123456789012:role/Developer",
+				AccountID:    "123456789012",
+				SessionName:  "alice",
+			}})
+			defer cleanup(h.metrics)
+			h.identityExtras = false
+			h.roleInfo = c.roleInfo
+			h.roleInfoDescription = true
+			h.roleInfoTags = []string{"Team"}
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::123456789012:role/developer": {RoleARN: "arn:aws:iam::123456789012:role/Developer", Username: "developer"},
+			}, nil, nil)}
+			user, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if authErr != nil {
+				t.Fatalf("expected the identity to be authenticated, got %v", authErr)
+			}
+			if !reflect.DeepEqual(user.Extra, c.wantExtras) {
+				t.Errorf("expected extras %v, got %v", c.wantExtras, user.Extra)
+			}
+		})
+	}
+}
+
+func TestAuthenticateTokenReviewVersionEcho(t *testing.T) {
+	for _, apiVersion := range []string{"authentication.k8s.io/v1", "authentication.k8s.io/v1beta1"} {
+		t.Run(apiVersion, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			data := []byte(`{"apiVersion":"` + apiVersion + `","kind":"TokenReview","spec":{"token":"token"}}`)
+			req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+			h := setup(&testVerifier{err: errors.New("token verification failed")})
+			defer cleanup(h.metrics)
+			h.authenticateEndpoint(resp, req)
+			if resp.Code != http.StatusForbidden {
+				t.Errorf("Expected status code %d, was %d", http.StatusForbidden, resp.Code)
+			}
+			verifyBodyContains(t, resp, `"apiVersion":"`+apiVersion+`"`)
+		})
+	}
+}
+
+func TestAuthenticateTokenReviewUnsupportedVersion(t *testing.T) {
+	resp := httptest.NewRecorder()
+	data := []byte(`{"apiVersion":"authentication.k8s.io/v2","kind":"TokenReview","spec":{"token":"token"}}`)
+	req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+	h := setup(&testVerifier{err: errors.New("not called")})
+	defer cleanup(h.metrics)
+	h.authenticateEndpoint(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, was %d", http.StatusBadRequest, resp.Code)
+	}
+	verifyBodyContains(t, resp, "unsupported TokenReview apiVersion")
+	validateMetrics(t, validateOpts{malformed: 1})
+}
+
 func TestRenderTemplate(t *testing.T) {
 	h := &handler{}
 	h.ec2Provider = newTestEC2Provider("ip-172-31-27-14", 15, 5)
@@ -939,3 +1330,470 @@ func TestRenderTemplate(t *testing.T) {
 		})
 	}
 }
+
+type testAuditLogger struct {
+	events []audit.Event
+}
+
+func (l *testAuditLogger) Log(event audit.Event) {
+	l.events = append(l.events, event)
+}
+
+func TestAuthenticateAuditLog(t *testing.T) {
+	resp := httptest.NewRecorder()
+
+	data, err := json.Marshal(authenticationv1beta1.TokenReview{
+		Spec: authenticationv1beta1.TokenReviewSpec{
+			Token: "token",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal in put data: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+	req.RemoteAddr = "10.0.0.1:1234"
+	h := setup(&testVerifier{err: nil, identity: &token.Identity{
+		ARN:          "arn:aws:iam::0123456789012:user/Test",
+		CanonicalARN: "arn:aws:iam::0123456789012:user/Test",
+		AccountID:    "0123456789012",
+		UserID:       "Test",
+	}})
+	defer cleanup(h.metrics)
+	auditLogger := &testAuditLogger{}
+	h.auditLogger = auditLogger
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(nil, map[string]config.UserMapping{
+		"arn:aws:iam::0123456789012:user/test": config.UserMapping{
+			UserARN:  "arn:aws:iam::0123456789012:user/Test",
+			Username: "TestUser",
+			Groups:   []string{"sys:admin"},
+		},
+	}, nil)}
+	h.authenticateEndpoint(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	if len(auditLogger.events) != 1 {
+		t.Fatalf("Expected 1 audit event, got %d", len(auditLogger.events))
+	}
+	event := auditLogger.events[0]
+	if event.Decision != audit.DecisionAllow || event.Reason != metricSuccess {
+		t.Errorf("Unexpected decision %q with reason %q", event.Decision, event.Reason)
+	}
+	if event.ARN != "arn:aws:iam::0123456789012:user/Test" || event.AccountID != "0123456789012" {
+		t.Errorf("Unexpected identity in audit event: %+v", event)
+	}
+	if event.Username != "TestUser" || !reflect.DeepEqual(event.Groups, []string{"sys:admin"}) {
+		t.Errorf("Unexpected mapping in audit event: %+v", event)
+	}
+	if event.SourceIP != "10.0.0.1" {
+		t.Errorf("Expected source IP 10.0.0.1, got %q", event.SourceIP)
+	}
+}
+
+func TestAuthenticateAuditAnnotations(t *testing.T) {
+	resp := httptest.NewRecorder()
+
+	data, err := json.Marshal(authenticationv1beta1.TokenReview{
+		Spec: authenticationv1beta1.TokenReviewSpec{
+			Token: "token",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal in put data: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+	h := setup(&testVerifier{err: nil, identity: &token.Identity{
+		ARN:          "arn:aws:sts::0123456789012:assumed-role/Test/extra",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+		UserID:       "Test",
+		SessionName:  "TestSession",
+	}})
+	defer cleanup(h.metrics)
+	h.auditAnnotations = true
+	h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(nil, nil, map[string]bool{
+		"0123456789012": true,
+	})}
+	h.authenticateEndpoint(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	var actual authenticationv1beta1.TokenReview
+	if err := json.NewDecoder(resp.Body).Decode(&actual); err != nil {
+		t.Fatalf("Could not decode TokenReview from body: %s", err)
+	}
+	extra := actual.Status.User.Extra
+	if got := extra[extraOriginalARN]; !reflect.DeepEqual(got, authenticationv1beta1.ExtraValue{"arn:aws:sts::0123456789012:assumed-role/Test/extra"}) {
+		t.Errorf("Unexpected original ARN annotation %v", got)
+	}
+	if got := extra[extraMappingSource]; !reflect.DeepEqual(got, authenticationv1beta1.ExtraValue{mapper.ModeMountedFile + mappingSourceAccountSuffix}) {
+		t.Errorf("Unexpected mapping source annotation %v", got)
+	}
+	if got := extra[extraSTSLatency]; len(got) != 1 {
+		t.Errorf("Expected one STS latency annotation, got %v", got)
+	} else if _, err := time.ParseDuration(got[0]); err != nil {
+		t.Errorf("Could not parse STS latency annotation %q: %v", got[0], err)
+	}
+}
+
+func TestAuthenticateStrictARNMatching(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		strict    bool
+		mappedARN string
+		wantOK    bool
+	}{
+		{"case-insensitive", false, "arn:aws:iam::0123456789012:role/test", true},
+		{"strict same case", true, "arn:aws:iam::0123456789012:role/Test", true},
+		{"strict other case", true, "arn:aws:iam::0123456789012:role/test", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:sts::0123456789012:assumed-role/Test/session",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+			}})
+			defer cleanup(h.metrics)
+			h.strictARNMatching = c.strict
+			m, err := file.NewFileMapper(config.Config{
+				StrictARNMatching: c.strict,
+				RoleMappings:      []config.RoleMapping{{RoleARN: c.mappedARN, Username: "test"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.mappers = []mapper.Mapper{m}
+			_, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Errorf("expected authenticated %v, got %v", c.wantOK, ok)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUnsafeGroups(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		action       string
+		fileBackend  bool
+		wantOK       bool
+		wantWarnings int
+	}{
+		{"allow", mapper.UnsafeGroupsAllow, false, true, 0},
+		{"warn", mapper.UnsafeGroupsWarn, false, true, 1},
+		{"reject", mapper.UnsafeGroupsReject, false, false, 0},
+		{"reject trusts MountedFile", mapper.UnsafeGroupsReject, true, true, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+			}})
+			defer cleanup(h.metrics)
+			h.unsafeGroupsAction = c.action
+			h.reservedGroupPrefixes = mapper.DefaultReservedGroupPrefixes
+			roles := map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": {RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "test", Groups: []string{"system:masters"}},
+			}
+			if c.fileBackend {
+				h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(roles, nil, nil)}
+			} else {
+				indexer := createIndexer()
+				indexer.Add(newIAMIdentityMapping("arn:aws:iam::0123456789012:role/Test", "arn:aws:iam::0123456789012:role/test", "test", []string{"system:masters"}))
+				h.mappers = []mapper.Mapper{crd.NewCRDMapperWithIndexer(indexer)}
+			}
+			event := &audit.Event{}
+			_, authErr := h.authenticate(context.Background(), "token", nil, event, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Errorf("expected authenticated %v, got %v", c.wantOK, ok)
+			}
+			if len(event.Warnings) != c.wantWarnings {
+				t.Errorf("expected %d audit warnings, got %v", c.wantWarnings, event.Warnings)
+			}
+			if !c.wantOK && event.Reason != metricUnsafe {
+				t.Errorf("expected the audit reason %q, got %q", metricUnsafe, event.Reason)
+			}
+		})
+	}
+}
+
+func TestAuthenticateGroupLimits(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		action       string
+		wantOK       bool
+		wantGroups   []string
+		wantWarnings int
+	}{
+		{"reject", mapper.GroupLimitsReject, false, nil, 0},
+		{"truncate", mapper.GroupLimitsTruncate, true, []string{"a", "b"}, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+			}})
+			defer cleanup(h.metrics)
+			h.groupLimits = mapper.GroupLimits{MaxGroups: 2, MaxGroupNameLength: 8}
+			h.groupLimitsAction = c.action
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": {RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "test", Groups: []string{"a", "much-too-long", "b", "c"}},
+			}, nil, nil)}
+			event := &audit.Event{}
+			user, authErr := h.authenticate(context.Background(), "token", nil, event, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Fatalf("expected authenticated %v, got %v", c.wantOK, authErr)
+			}
+			if !c.wantOK {
+				if authErr.Reason != ReasonInvalidGroups {
+					t.Errorf("expected the reason %q, got %q", ReasonInvalidGroups, authErr.Reason)
+				}
+				return
+			}
+			if !reflect.DeepEqual(user.Groups, c.wantGroups) {
+				t.Errorf("expected groups %v, got %v", c.wantGroups, user.Groups)
+			}
+			if len(event.Warnings) != c.wantWarnings {
+				t.Errorf("expected %d audit warnings, got %v", c.wantWarnings, event.Warnings)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSessionNamePolicies(t *testing.T) {
+	policies, err := compileSessionNamePolicies([]config.SessionNamePolicy{
+		{RoleARN: "arn:aws:iam::123456789012:role/team/Shared", Pattern: "e[0-9]{6}"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name    string
+		role    string
+		session string
+		wantOK  bool
+	}{
+		{"matching session name", "Shared", "e123456", true},
+		{"other session name", "Shared", "admin", false},
+		{"partial match", "Shared", "e123456-admin", false},
+		{"role without policy", "Other", "admin", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:sts::123456789012:assumed-role/" + c.role + "/" + c.session,
+				CanonicalARN: "arn:aws:iam::123456789012:role/" + c.role,
+				AccountID:    "123456789012",
+				SessionName:  c.session,
+			}})
+			defer cleanup(h.metrics)
+			h.sessionNamePolicies = policies
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::123456789012:role/shared": {RoleARN: "arn:aws:iam::123456789012:role/Shared", Username: "shared"},
+				"arn:aws:iam::123456789012:role/other":  {RoleARN: "arn:aws:iam::123456789012:role/Other", Username: "other"},
+			}, nil, nil)}
+			_, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Fatalf("expected authenticated %v, got %v", c.wantOK, authErr)
+			}
+			if !c.wantOK && authErr.Reason != ReasonBadSessionName {
+				t.Errorf("expected the reason %q, got %q", ReasonBadSessionName, authErr.Reason)
+			}
+		})
+	}
+}
+
+func TestValidateSessionNamePolicies(t *testing.T) {
+	for _, policies := range [][]config.SessionNamePolicy{
+		{{Pattern: "("}},
+		{{RoleARN: "arn:aws:iam::123456789012:role/Shared"}},
+		{{RoleARN: "arn:aws:iam::123456789012:user/Alice", Pattern: ".*"}},
+		{{RoleARN: "not-an-arn", Pattern: ".*"}},
+	} {
+		if err := ValidateSessionNamePolicies(policies); err == nil {
+			t.Errorf("expected policies %+v to be invalid", policies)
+		}
+	}
+}
+
+func TestAuthenticateExpiredMapping(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for _, c := range []struct {
+		name     string
+		notAfter *time.Time
+		wantOK   bool
+	}{
+		{"no expiration", nil, true},
+		{"not expired", &future, true},
+		{"expired", &past, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          "arn:aws:iam::0123456789012:role/Test",
+				CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+				AccountID:    "0123456789012",
+			}})
+			defer cleanup(h.metrics)
+			roles := map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": {RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "test", NotAfter: c.notAfter},
+			}
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(roles, nil, nil)}
+			_, authErr := h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Errorf("expected authenticated %v, got %v", c.wantOK, authErr)
+			}
+			if !c.wantOK && authErr.Reason != ReasonUnmappedARN {
+				t.Errorf("expected reason %q, got %q", ReasonUnmappedARN, authErr.Reason)
+			}
+		})
+	}
+}
+
+// deadlineVerifier records the deadline of the context tokens are verified
+// with.
+type deadlineVerifier struct {
+	testVerifier
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (v *deadlineVerifier) VerifyWithContext(ctx context.Context, tok, sourceIP string) (*token.Identity, error) {
+	v.deadline, v.hasDeadline = ctx.Deadline()
+	return v.Verify(tok)
+}
+
+func TestAuthenticateTimeout(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		timeout      time.Duration
+		wantDeadline bool
+	}{
+		{"no timeout", 0, false},
+		{"timeout", time.Minute, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v := &deadlineVerifier{testVerifier: testVerifier{err: errors.New("invalid")}}
+			h := setup(v)
+			defer cleanup(h.metrics)
+			h.authenticationTimeout = c.timeout
+			start := time.Now()
+			h.authenticate(context.Background(), "token", nil, &audit.Event{}, logrus.NewEntry(logrus.New()), start)
+			if v.hasDeadline != c.wantDeadline {
+				t.Fatalf("expected a deadline %v, got %v", c.wantDeadline, v.hasDeadline)
+			}
+			if c.wantDeadline && v.deadline.After(start.Add(c.timeout+time.Second)) {
+				t.Errorf("expected the deadline within %v, got %v", c.timeout, v.deadline.Sub(start))
+			}
+		})
+	}
+}
+
+// boundVerifier verifies tokens bound to boundIP, as STS does by rejecting
+// them when presented from another address.
+type boundVerifier struct {
+	identity *token.Identity
+	boundIP  string
+	// sourceIP is the address the last token was presented from.
+	sourceIP string
+}
+
+func (v *boundVerifier) Verify(tok string) (*token.Identity, error) {
+	return v.VerifyFromSource(tok, "")
+}
+
+func (v *boundVerifier) VerifyFromSource(tok, sourceIP string) (*token.Identity, error) {
+	v.sourceIP = sourceIP
+	if sourceIP != v.boundIP {
+		return nil, errors.New("token is bound to another source IP")
+	}
+	return v.identity, nil
+}
+
+func TestAuthenticateBoundSourceIP(t *testing.T) {
+	const apiServerAddr = "10.0.0.1:52000"
+	const clientIP = "192.0.2.10"
+	for _, c := range []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		wantIP     string
+		wantCode   int
+	}{
+		{
+			name:       "checked against the API server without a client IP header",
+			remoteAddr: apiServerAddr,
+			wantIP:     "10.0.0.1",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "client IP header",
+			header:     "X-Forwarded-For",
+			remoteAddr: apiServerAddr,
+			headers:    map[string]string{"X-Forwarded-For": clientIP + ", 10.0.0.1"},
+			wantIP:     clientIP,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "client IP header over a unix socket",
+			header:     "X-Client-IP",
+			remoteAddr: "@",
+			headers:    map[string]string{"X-Client-IP": clientIP},
+			wantIP:     clientIP,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "missing client IP header",
+			header:     "X-Forwarded-For",
+			remoteAddr: clientIP + ":52000",
+			wantIP:     "",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "invalid client IP header",
+			header:     "X-Forwarded-For",
+			remoteAddr: apiServerAddr,
+			headers:    map[string]string{"X-Forwarded-For": "unknown"},
+			wantIP:     "",
+			wantCode:   http.StatusForbidden,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := json.Marshal(authenticationv1beta1.TokenReview{
+				Spec: authenticationv1beta1.TokenReviewSpec{Token: "token"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+			req.RemoteAddr = c.remoteAddr
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			verifier := &boundVerifier{
+				identity: &token.Identity{
+					ARN:          "arn:aws:iam::0123456789012:role/Test",
+					CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+					AccountID:    "0123456789012",
+				},
+				boundIP: clientIP,
+			}
+			h := setup(verifier)
+			defer cleanup(h.metrics)
+			h.clientIPHeader = c.header
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+				"arn:aws:iam::0123456789012:role/test": {RoleARN: "arn:aws:iam::0123456789012:role/Test", Username: "TestUser"},
+			}, nil, nil)}
+
+			resp := httptest.NewRecorder()
+			h.authenticateEndpoint(resp, req)
+			if resp.Code != c.wantCode {
+				t.Errorf("expected status code %d, was %d", c.wantCode, resp.Code)
+			}
+			if verifier.sourceIP != c.wantIP {
+				t.Errorf("expected the token to be checked against %q, got %q", c.wantIP, verifier.sourceIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// sessionNamePolicy is a compiled config.SessionNamePolicy.
+type sessionNamePolicy struct {
+	// roleARN is the canonical ARN of the role without its path, as in the
+	// canonical ARNs of its sessions, or "" for every role.
+	roleARN string
+	pattern *regexp.Regexp
+}
+
+// ValidateSessionNamePolicies checks the role ARNs and patterns of policies.
+func ValidateSessionNamePolicies(policies []config.SessionNamePolicy) error {
+	_, err := compileSessionNamePolicies(policies, false)
+	return err
+}
+
+func compileSessionNamePolicies(policies []config.SessionNamePolicy, strictARNMatching bool) ([]sessionNamePolicy, error) {
+	var compiled []sessionNamePolicy
+	for _, policy := range policies {
+		if policy.Pattern == "" {
+			return nil, fmt.Errorf("session name policy for %q has no pattern", policy.RoleARN)
+		}
+		pattern, err := regexp.Compile("^(?:" + policy.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid session name pattern %q: %v", policy.Pattern, err)
+		}
+		roleARN := ""
+		if policy.RoleARN != "" {
+			principal, err := arn.Parse(policy.RoleARN)
+			if err != nil {
+				return nil, err
+			}
+			principal = principal.Canonical()
+			if principal.Type != arn.TypeRole {
+				return nil, fmt.Errorf("session name policy ARN %q is not a role", policy.RoleARN)
+			}
+			roleARN = mapper.ARNKey(principal.WithoutPath().String(), strictARNMatching)
+		}
+		compiled = append(compiled, sessionNamePolicy{roleARN: roleARN, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+// checkSessionName reports whether the session name of identity matches the
+// patterns of the policies of its role. Identities other than role sessions
+// aren't subject to the policies.
+func (h *handler) checkSessionName(identity *token.Identity) bool {
+	if len(h.sessionNamePolicies) == 0 || !strings.Contains(identity.CanonicalARN, ":role/") {
+		return true
+	}
+	roleARN := mapper.ARNKey(identity.CanonicalARN, h.strictARNMatching)
+	for _, policy := range h.sessionNamePolicies {
+		if policy.roleARN != "" && policy.roleARN != roleARN {
+			continue
+		}
+		if !policy.pattern.MatchString(identity.SessionName) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// maxShadowEvaluations bounds the shadow evaluations in flight so a slow
+// shadow backend can't pile up goroutines. Evaluations over the limit are
+// skipped and counted.
+const maxShadowEvaluations = 64
+
+// shadowMapping evaluates the identity against the shadow mappers in the
+// background and records how the result compares to the live one. The
+// shadow result is never enforced.
+func (h *handler) shadowMapping(identity *token.Identity, username string, groups []string, err error) {
+	shadowMappers := h.current().shadowMappers
+	if len(shadowMappers) == 0 {
+		return
+	}
+	select {
+	case h.shadowSem <- struct{}{}:
+	default:
+		authmetrics.ShadowMappingComparisons.WithLabelValues(authmetrics.ShadowSkipped).Inc()
+		return
+	}
+	go func() {
+		defer func() { <-h.shadowSem }()
+		var shadowUsername string
+		var shadowGroups []string
+		shadowMapping, _, shadowErr := h.mapIdentity(context.Background(), shadowMappers, identity, false)
+		if shadowErr == nil {
+			shadowUsername, shadowGroups = shadowMapping.Username, shadowMapping.Groups
+		}
+		h.compareShadow(identity, username, groups, err, shadowUsername, shadowGroups, shadowErr)
+	}()
+}
+
+// compareShadow records the outcome of a shadow evaluation and logs
+// mismatches.
+func (h *handler) compareShadow(identity *token.Identity, username string, groups []string, err error, shadowUsername string, shadowGroups []string, shadowErr error) {
+	var result string
+	switch {
+	case err != nil && shadowErr != nil:
+		result = authmetrics.ShadowMatch
+	case err != nil:
+		result = authmetrics.ShadowOnly
+	case shadowErr != nil:
+		result = authmetrics.ShadowLiveOnly
+	case username != shadowUsername || !sameGroups(groups, shadowGroups):
+		result = authmetrics.ShadowMismatch
+	default:
+		result = authmetrics.ShadowMatch
+	}
+	authmetrics.ShadowMappingComparisons.WithLabelValues(result).Inc()
+	if result == authmetrics.ShadowMatch {
+		return
+	}
+
+	fields := logrus.Fields{
+		"result":         result,
+		"username":       username,
+		"groups":         groups,
+		"shadowUsername": shadowUsername,
+		"shadowGroups":   shadowGroups,
+	}
+	if h.isLoggableIdentity(identity) {
+		fields["arn"] = identity.ARN
+	}
+	logger.WithFields(fields).Warn("shadow mapping differs from live mapping")
+}
+
+// sameGroups reports whether a and b hold the same groups in any order.
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
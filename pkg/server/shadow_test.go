@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	authmetrics "sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func shadowCount(t *testing.T, result string) float64 {
+	t.Helper()
+	var m dto.Metric
+	var c prometheus.Counter = authmetrics.ShadowMappingComparisons.WithLabelValues(result)
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("could not read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestCompareShadow(t *testing.T) {
+	h := &handler{}
+	identity := &token.Identity{ARN: "arn:aws:iam::0123456789012:user/Test"}
+	notMapped := mapper.ErrNotMapped
+	cases := []struct {
+		username       string
+		groups         []string
+		err            error
+		shadowUsername string
+		shadowGroups   []string
+		shadowErr      error
+		want           string
+	}{
+		{"test", []string{"a", "b"}, nil, "test", []string{"b", "a"}, nil, authmetrics.ShadowMatch},
+		{"", nil, notMapped, "", nil, notMapped, authmetrics.ShadowMatch},
+		{"test", []string{"a"}, nil, "other", []string{"a"}, nil, authmetrics.ShadowMismatch},
+		{"test", []string{"a"}, nil, "test", []string{"a", "b"}, nil, authmetrics.ShadowMismatch},
+		{"test", nil, nil, "", nil, errors.New("unavailable"), authmetrics.ShadowLiveOnly},
+		{"", nil, notMapped, "test", nil, nil, authmetrics.ShadowOnly},
+	}
+	for i, c := range cases {
+		before := shadowCount(t, c.want)
+		h.compareShadow(identity, c.username, c.groups, c.err, c.shadowUsername, c.shadowGroups, c.shadowErr)
+		if got := shadowCount(t, c.want) - before; got != 1 {
+			t.Errorf("case %d: expected one %q comparison, got %v", i, c.want, got)
+		}
+	}
+}
+
+func TestShadowMapping(t *testing.T) {
+	h := setup(nil)
+	defer cleanup(h.metrics)
+	h.shadowSem = make(chan struct{}, 1)
+	h.shadowMappers = []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::0123456789012:role/test": {
+			RoleARN:  "arn:aws:iam::0123456789012:role/Test",
+			Username: "shadow",
+		},
+	}, nil, nil)}
+	identity := &token.Identity{
+		ARN:          "arn:aws:sts::0123456789012:assumed-role/Test/session",
+		CanonicalARN: "arn:aws:iam::0123456789012:role/Test",
+		AccountID:    "0123456789012",
+	}
+
+	before := shadowCount(t, authmetrics.ShadowMismatch)
+	h.shadowMapping(identity, "live", []string{}, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for shadowCount(t, authmetrics.ShadowMismatch) == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("shadow mapping was not compared")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// with the only slot taken the evaluation is skipped
+	h.shadowSem <- struct{}{}
+	skipped := shadowCount(t, authmetrics.ShadowSkipped)
+	h.shadowMapping(identity, "live", []string{}, nil)
+	if got := shadowCount(t, authmetrics.ShadowSkipped) - skipped; got != 1 {
+		t.Errorf("expected the evaluation to be skipped, got %v skips", got)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+)
+
+// shutdown stops the servers from accepting connections and waits up to
+// ShutdownGracePeriod for the requests in flight to finish, so a rolling
+// restart doesn't fail authentications, then closes the audit log. Requests
+// still running after the grace period have their connections closed.
+func (c *Server) shutdown() {
+	logger.Infof("shutting down, draining requests in flight for up to %s", c.ShutdownGracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownGracePeriod)
+	defer cancel()
+
+	servers := []*http.Server{&c.httpServer}
+	if c.grpcListener != nil {
+		servers = append(servers, &c.grpcServer)
+	}
+	if c.metricsListener != nil {
+		servers = append(servers, &c.metricsServer)
+	}
+	if c.debugListener != nil {
+		servers = append(servers, &c.debugServer)
+	}
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				logger.WithError(err).Warn("requests in flight didn't finish within the grace period, closing their connections")
+				s.Close()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if err := audit.Close(c.handler.auditLogger); err != nil {
+		logger.WithError(err).Error("could not close the audit log")
+	}
+	logger.Info("shut down")
+}
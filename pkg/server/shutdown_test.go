@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := &Server{handler: &handler{}}
+	c.ShutdownGracePeriod = 5 * time.Second
+	c.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	go c.httpServer.Serve(listener)
+
+	url := "http://" + listener.Addr().String()
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		c.shutdown()
+		close(stopped)
+	}()
+	// Wait for the listener to be closed before checking new connections
+	// are refused.
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 100 {
+			t.Fatal("server still accepts connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("shutdown returned before the request in flight finished")
+	default:
+	}
+
+	close(release)
+	if got := <-body; got != "done" {
+		t.Errorf("request in flight got %q, want %q", got, "done")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown didn't return after the request finished")
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c := &Server{handler: &handler{}}
+	c.ShutdownGracePeriod = 50 * time.Millisecond
+	c.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go c.httpServer.Serve(listener)
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		c.shutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown didn't return after the grace period")
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+// MappingsPath is where the snapshot of the mappings the server enforces is
+// served, if a mappings token file is configured.
+const MappingsPath = "/mappings"
+
+// mappingsEndpoint serves the merged mappings of the backends as JSON, or as
+// YAML if requested with ?format=yaml or an Accept header.
+func (h *handler) mappingsEndpoint(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "expected GET", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot := mapper.NewSnapshot(h.current().mappers)
+
+	var data []byte
+	var err error
+	if req.URL.Query().Get("format") == "yaml" || strings.Contains(req.Header.Get("Accept"), "yaml") {
+		w.Header().Set("Content-Type", "application/yaml")
+		data, err = yaml.Marshal(snapshot)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		data, err = json.MarshalIndent(snapshot, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		logger.WithError(err).Error("could not encode the mappings snapshot")
+		http.Error(w, "could not encode the mappings snapshot", http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+)
+
+func TestMappingsEndpoint(t *testing.T) {
+	h := &handler{mappers: []mapper.Mapper{file.NewFileMapperWithMaps(map[string]config.RoleMapping{
+		"arn:aws:iam::012345678912:role/test": {
+			RoleARN:  "arn:aws:iam::012345678912:role/Test",
+			Username: "test",
+			Groups:   []string{"system:masters"},
+		},
+	}, nil, map[string]bool{"111122223333": true})}}
+
+	resp := httptest.NewRecorder()
+	h.mappingsEndpoint(resp, httptest.NewRequest("GET", "http://k8s.io"+MappingsPath, nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	var snapshot mapper.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("could not decode the snapshot: %v", err)
+	}
+	if len(snapshot.Roles) != 1 || snapshot.Roles[0].Source != mapper.ModeMountedFile || snapshot.Roles[0].Username != "test" {
+		t.Errorf("unexpected roles %+v", snapshot.Roles)
+	}
+	if len(snapshot.Accounts) != 1 || snapshot.Accounts[0].AccountID != "111122223333" {
+		t.Errorf("unexpected accounts %+v", snapshot.Accounts)
+	}
+
+	resp = httptest.NewRecorder()
+	h.mappingsEndpoint(resp, httptest.NewRequest("GET", "http://k8s.io"+MappingsPath+"?format=yaml", nil))
+	if !strings.Contains(resp.Body.String(), "username: test") {
+		t.Errorf("expected a YAML snapshot, got %s", resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	h.mappingsEndpoint(resp, httptest.NewRequest("POST", "http://k8s.io"+MappingsPath, nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d, was %d", http.StatusMethodNotAllowed, resp.Code)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+// systemdListenFD is the first file descriptor passed by systemd socket
+// activation.
+const systemdListenFD = 3
+
+// systemdListener returns the listener passed by systemd socket activation,
+// or nil if the server wasn't socket activated. Only the first socket is
+// used.
+func systemdListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	// not inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if fds > 1 {
+		logger.Warnf("systemd passed %d sockets, only serving on the first one", fds)
+	}
+
+	f := os.NewFile(systemdListenFD, "systemd-socket")
+	defer f.Close()
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket %d is not a listening socket: %v", systemdListenFD, err)
+	}
+	logger.Infof("using the socket passed by systemd, ignoring the listen address")
+	return listener, nil
+}
+
+// sdNotify sends state to the notification socket of systemd, if the server
+// was started by a Type=notify unit.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		logger.WithError(err).Warn("Could not notify systemd")
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logger.WithError(err).Warn("Could not notify systemd")
+	}
+}
+
+// notifyReady tells systemd the server is ready once every backend has
+// loaded its mappings, so units ordered after it, such as kube-apiserver,
+// don't start while every identity would be denied.
+func (c *Server) notifyReady(stopCh <-chan struct{}) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	for _, m := range c.handler.current().mappers {
+		if err := mapper.Load(m, stopCh); err != nil {
+			// the backend keeps retrying on its own; don't hold up startup
+			logger.WithError(err).Warnf("Backend %s did not load its mappings, notifying systemd anyway", m.Name())
+		}
+	}
+	select {
+	case <-stopCh:
+		return
+	default:
+	}
+	sdNotify("READY=1")
+}
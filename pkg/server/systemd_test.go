@@ -0,0 +1,76 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+)
+
+// loadingMapper is a mapper whose Load blocks until loaded is closed.
+type loadingMapper struct {
+	unlistableMapper
+	loaded chan struct{}
+}
+
+func (m *loadingMapper) Load(stopCh <-chan struct{}) error {
+	<-m.loaded
+	return nil
+}
+
+func TestNotifyReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	m := &loadingMapper{loaded: make(chan struct{})}
+	c := &Server{handler: &handler{mappers: []mapper.Mapper{m}}}
+	done := make(chan struct{})
+	go func() {
+		c.notifyReady(make(chan struct{}))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected readiness to wait for the mappings to load")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(m.loaded)
+	<-done
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("expected a notification: %v", err)
+	}
+	if string(buf[:n]) != "READY=1" {
+		t.Errorf("expected READY=1, got %q", buf[:n])
+	}
+}
+
+func TestSystemdListenerNotActivated(t *testing.T) {
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	// the sockets were passed to another process
+	if l, err := systemdListener(); l != nil || err != nil {
+		t.Errorf("expected no listener, got %v, %v", l, err)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/kubeclient"
+)
+
+// Keys of a kubernetes.io/tls Secret. ca.crt is added by cert-manager.
+const (
+	secretCertKey = "tls.crt"
+	secretKeyKey  = "tls.key"
+	secretCAKey   = "ca.crt"
+)
+
+// tlsSecretWatcher serves the listener certificate from a kubernetes.io/tls
+// Secret, such as one issued by cert-manager, instead of a self-signed
+// certificate, and picks up renewals by watching the Secret.
+type tlsSecretWatcher struct {
+	cfg      *config.Config
+	secrets  v1.SecretInterface
+	name     string
+	reloader *certReloader
+	caBundle []byte
+}
+
+func newTLSSecretWatcher(cfg *config.Config) (*tlsSecretWatcher, error) {
+	parts := strings.Split(cfg.TLSSecret, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("TLS secret %q must be of the form namespace/name", cfg.TLSSecret)
+	}
+	clientset, err := kubeclient.NewClientset(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsSecretWatcher{
+		cfg:     cfg,
+		secrets: clientset.CoreV1().Secrets(parts[0]),
+		name:    parts[1],
+	}, nil
+}
+
+// load fetches the Secret and returns its certificate, writing the webhook
+// kubeconfig for its CA.
+func (w *tlsSecretWatcher) load() (*tls.Certificate, error) {
+	secret, err := w.secrets.Get(w.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get TLS secret %q: %v", w.cfg.TLSSecret, err)
+	}
+	cert, caBundle, err := certificateFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	w.updateKubeconfig(caBundle)
+	return cert, nil
+}
+
+// run watches the Secret until stopCh is closed, re-establishing the watch
+// whenever it ends.
+func (w *tlsSecretWatcher) run(stopCh <-chan struct{}) {
+	for {
+		watcher, err := w.secrets.Watch(metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", w.name).String(),
+		})
+		if err != nil {
+			logger.WithError(err).Warn("Unable to establish TLS secret watch. Sleeping for 5 seconds")
+		} else if w.consume(watcher, stopCh) {
+			return
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// consume applies Secret updates until the watch ends. It returns true if
+// stopCh was closed.
+func (w *tlsSecretWatcher) consume(watcher watch.Interface, stopCh <-chan struct{}) bool {
+	defer watcher.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return true
+		case r, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+			switch r.Type {
+			case watch.Added, watch.Modified:
+				secret, ok := r.Object.(*core_v1.Secret)
+				if !ok || secret.Name != w.name {
+					continue
+				}
+				if err := w.apply(secret); err != nil {
+					logger.WithError(err).Error("could not load certificate from TLS secret, keeping the current one")
+				}
+			case watch.Deleted:
+				logger.Warn("TLS secret was deleted, keeping the current certificate")
+			case watch.Error:
+				logger.WithFields(logrus.Fields{"error": r}).Error("recieved a TLS secret watch error")
+				return false
+			}
+		}
+	}
+}
+
+func (w *tlsSecretWatcher) apply(secret *core_v1.Secret) error {
+	cert, caBundle, err := certificateFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	current, _ := w.reloader.GetCertificate(nil)
+	if current != nil && len(current.Certificate) > 0 && bytes.Equal(current.Certificate[0], cert.Certificate[0]) {
+		return nil
+	}
+	logger.WithField("secret", w.cfg.TLSSecret).Info("TLS secret changed, reloading certificate")
+	w.reloader.set(cert)
+	w.updateKubeconfig(caBundle)
+	return nil
+}
+
+// updateKubeconfig rewrites the webhook kubeconfig if the CA changed.
+func (w *tlsSecretWatcher) updateKubeconfig(caBundle []byte) {
+	if w.cfg.KubeconfigPregenerated || bytes.Equal(caBundle, w.caBundle) {
+		return
+	}
+	if err := w.cfg.WriteKubeconfig(caBundle); err != nil {
+		logger.WithError(err).Error("could not write kubeconfig")
+		return
+	}
+	w.caBundle = caBundle
+}
+
+// certificateFromSecret parses the key pair in a kubernetes.io/tls Secret and
+// returns it with the CA bundle the API server should trust: ca.crt if
+// present, otherwise the last certificate of the tls.crt chain.
+func certificateFromSecret(secret *core_v1.Secret) (*tls.Certificate, []byte, error) {
+	certPEM, keyPEM := secret.Data[secretCertKey], secret.Data[secretKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, nil, fmt.Errorf("secret %s/%s is missing %s or %s", secret.Namespace, secret.Name, secretCertKey, secretKeyKey)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("secret %s/%s does not contain a valid key pair: %v", secret.Namespace, secret.Name, err)
+	}
+	caBundle := secret.Data[secretCAKey]
+	if len(caBundle) == 0 {
+		caBundle = pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Certificate[len(cert.Certificate)-1],
+		})
+	}
+	return &cert, caBundle, nil
+}
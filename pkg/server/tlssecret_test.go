@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+)
+
+// newTestTLSSecret generates a self-signed key pair in dir and returns it as
+// a kubernetes.io/tls Secret.
+func newTestTLSSecret(t *testing.T, dir string) *core_v1.Secret {
+	t.Helper()
+	cfg := config.Config{Address: "127.0.0.1", Hostname: "127.0.0.1", StateDir: dir}
+	if _, err := cfg.RotateCertificate(); err != nil {
+		t.Fatalf("RotateCertificate: %v", err)
+	}
+	certPEM, err := ioutil.ReadFile(cfg.CertPath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	keyPEM, err := ioutil.ReadFile(cfg.KeyPath())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return &core_v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "authenticator-tls"},
+		Type:       core_v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			secretCertKey: certPEM,
+			secretKeyKey:  keyPEM,
+		},
+	}
+}
+
+func TestCertificateFromSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlssecret")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := newTestTLSSecret(t, dir)
+	cert, caBundle, err := certificateFromSecret(secret)
+	if err != nil {
+		t.Fatalf("certificateFromSecret: %v", err)
+	}
+	if len(cert.Certificate) != 1 || !bytes.Equal(caBundle, secret.Data[secretCertKey]) {
+		t.Errorf("expected the self-signed certificate to be its own CA bundle")
+	}
+
+	secret.Data[secretCAKey] = []byte("ca bundle")
+	if _, caBundle, _ := certificateFromSecret(secret); string(caBundle) != "ca bundle" {
+		t.Errorf("expected ca.crt to be used as the CA bundle, got %q", caBundle)
+	}
+
+	delete(secret.Data, secretKeyKey)
+	if _, _, err := certificateFromSecret(secret); err == nil {
+		t.Errorf("expected an error for a secret without a key")
+	}
+}
+
+func TestTLSSecretWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlssecret")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := newTestTLSSecret(t, dir)
+	cs := fake.NewSimpleClientset(secret)
+	cfg := &config.Config{
+		Hostname:               "127.0.0.1",
+		HostPort:               21362,
+		TLSSecret:              "kube-system/authenticator-tls",
+		GenerateKubeconfigPath: filepath.Join(dir, "kubeconfig.yaml"),
+	}
+	w := &tlsSecretWatcher{
+		cfg:     cfg,
+		secrets: cs.CoreV1().Secrets("kube-system"),
+		name:    "authenticator-tls",
+	}
+	cert, err := w.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, err := os.Stat(cfg.GenerateKubeconfigPath); err != nil {
+		t.Errorf("expected the kubeconfig to be written: %v", err)
+	}
+	w.reloader = newCertReloader(cfg, cert)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.run(stopCh)
+	time.Sleep(10 * time.Millisecond)
+
+	renewed := newTestTLSSecret(t, dir)
+	if _, err := cs.CoreV1().Secrets("kube-system").Update(renewed); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	renewedCert, _, _ := certificateFromSecret(renewed)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		served, _ := w.reloader.GetCertificate(nil)
+		if bytes.Equal(served.Certificate[0], renewedCert.Certificate[0]) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("renewed certificate was not served")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
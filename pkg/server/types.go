@@ -27,6 +27,24 @@ import (
 type Server struct {
 	// Config is the whole configuration of aws-iam-authenticator used for valid keys and certs, kubeconfig, and so on
 	config.Config
-	httpServer http.Server
-	listener   net.Listener
+	httpServer   http.Server
+	listener     net.Listener
+	certReloader *certReloader
+	// tlsSecretWatcher is set when the certificate comes from a Secret
+	tlsSecretWatcher *tlsSecretWatcher
+	handler          *handler
+	// grpcServer serves the gRPC API on grpcListener, if GRPCPort is set
+	grpcServer   http.Server
+	grpcListener net.Listener
+	// metricsServer serves /metrics on metricsListener, if MetricsPort is
+	// set
+	metricsServer   http.Server
+	metricsListener net.Listener
+	// debugServer serves the debug endpoints on debugListener, if DebugPort
+	// is set
+	debugServer   http.Server
+	debugListener net.Listener
+	// stsTransport, if set, sends the STS requests of the handler instead
+	// of a transport configured from the STS options
+	stsTransport http.RoundTripper
 }
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// mappingSourceUnmapped is the mapping source of identities authenticated by
+// the unmapped fallback.
+const mappingSourceUnmapped = "unmapped"
+
+// unmappedFallback maps identities of trusted accounts that no backend maps
+// to a configured, typically low-privilege, username and groups.
+type unmappedFallback struct {
+	accounts map[string]bool
+	username string
+	groups   []string
+}
+
+// newUnmappedFallback returns the unmapped fallback of cfg, or nil if it
+// isn't enabled.
+func newUnmappedFallback(cfg config.Config) *unmappedFallback {
+	if cfg.UnmappedUsername == "" || len(cfg.UnmappedAccounts) == 0 {
+		return nil
+	}
+	f := &unmappedFallback{
+		accounts: map[string]bool{},
+		username: cfg.UnmappedUsername,
+		groups:   cfg.UnmappedGroups,
+	}
+	for _, account := range cfg.UnmappedAccounts {
+		f.accounts[account] = true
+	}
+	return f
+}
+
+// mapping returns the unrendered mapping of identity, or nil if its account
+// isn't trusted.
+func (f *unmappedFallback) mapping(identity *token.Identity, canonicalARN string) *config.IdentityMapping {
+	if f == nil || !f.accounts[identity.AccountID] {
+		return nil
+	}
+	return &config.IdentityMapping{
+		IdentityARN: canonicalARN,
+		Username:    f.username,
+		Groups:      append([]string{}, f.groups...),
+	}
+}
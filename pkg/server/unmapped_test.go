@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/audit"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper/file"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+func TestNewUnmappedFallback(t *testing.T) {
+	if f := newUnmappedFallback(config.Config{UnmappedAccounts: []string{"012345678901"}}); f != nil {
+		t.Errorf("expected no fallback without a username, got %+v", f)
+	}
+	if f := newUnmappedFallback(config.Config{UnmappedUsername: "unmapped"}); f != nil {
+		t.Errorf("expected no fallback without accounts, got %+v", f)
+	}
+	var f *unmappedFallback
+	if m := f.mapping(&token.Identity{AccountID: "012345678901"}, ""); m != nil {
+		t.Errorf("expected a disabled fallback not to map, got %+v", m)
+	}
+}
+
+func TestAuthenticateUnmappedFallback(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		accountID  string
+		mapped     bool
+		wantOK     bool
+		wantUser   string
+		wantGroups []string
+	}{
+		{"trusted account", "012345678901", false, true, "aws-unmapped:012345678901:alice", []string{"aws:authenticated"}},
+		{"untrusted account", "999999999999", false, false, "", nil},
+		{"mapped identity", "012345678901", true, true, "test", []string{"system:masters"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			arn := "arn:aws:iam::" + c.accountID + ":role/Test"
+			h := setup(&testVerifier{identity: &token.Identity{
+				ARN:          arn,
+				CanonicalARN: arn,
+				AccountID:    c.accountID,
+				SessionName:  "alice",
+			}})
+			defer cleanup(h.metrics)
+			h.unmapped = newUnmappedFallback(config.Config{
+				UnmappedAccounts: []string{"012345678901"},
+				UnmappedUsername: "aws-unmapped:{{AccountID}}:{{SessionName}}",
+				UnmappedGroups:   []string{"aws:authenticated"},
+			})
+			h.unsafeGroupsAction = mapper.UnsafeGroupsReject
+			h.reservedGroupPrefixes = mapper.DefaultReservedGroupPrefixes
+			roles := map[string]config.RoleMapping{}
+			if c.mapped {
+				roles["arn:aws:iam::012345678901:role/test"] = config.RoleMapping{RoleARN: arn, Username: "test", Groups: []string{"system:masters"}}
+			}
+			h.mappers = []mapper.Mapper{file.NewFileMapperWithMaps(roles, nil, nil)}
+
+			event := &audit.Event{}
+			user, authErr := h.authenticate(context.Background(), "token", nil, event, logrus.NewEntry(logrus.New()), time.Now())
+			if ok := authErr == nil; ok != c.wantOK {
+				t.Fatalf("expected authenticated %v, got %v", c.wantOK, authErr)
+			}
+			if !c.wantOK {
+				if authErr.Reason != ReasonUnmappedARN {
+					t.Errorf("expected reason %q, got %q", ReasonUnmappedARN, authErr.Reason)
+				}
+				return
+			}
+			if user.Username != c.wantUser || !reflect.DeepEqual(user.Groups, c.wantGroups) {
+				t.Errorf("expected %s %v, got %s %v", c.wantUser, c.wantGroups, user.Username, user.Groups)
+			}
+		})
+	}
+}
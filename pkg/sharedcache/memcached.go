@@ -0,0 +1,134 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedcache
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memcached is a Store speaking the memcached text protocol.
+type memcached struct {
+	pool *pool
+}
+
+func newMemcached(addr string, timeout time.Duration) *memcached {
+	return &memcached{pool: newPool(addr, timeout)}
+}
+
+// expiration returns ttl in whole seconds, rounded up so entries never expire
+// early. Memcached reads values above 30 days as a Unix time, far above any
+// TTL used here.
+func expiration(ttl time.Duration) int64 {
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+func (m *memcached) Get(key string) ([]byte, bool, error) {
+	var value []byte
+	var found bool
+	err := m.pool.do(func(c *conn) error {
+		fmt.Fprintf(c.w, "get %s\r\n", key)
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("memcached: unexpected response %q", line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("memcached: unexpected response %q", line)
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, data); err != nil {
+				return err
+			}
+			value, found = data[:n], true
+		}
+	})
+	return value, found, err
+}
+
+func (m *memcached) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := m.store("set", key, value, ttl)
+	return err
+}
+
+func (m *memcached) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	return m.store("add", key, value, ttl)
+}
+
+// store runs a storage command and reports whether the value was stored.
+func (m *memcached) store(command, key string, value []byte, ttl time.Duration) (bool, error) {
+	var stored bool
+	err := m.pool.do(func(c *conn) error {
+		fmt.Fprintf(c.w, "%s %s 0 %d %d\r\n", command, key, expiration(ttl), len(value))
+		c.w.Write(value)
+		c.w.WriteString("\r\n")
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "STORED":
+			stored = true
+		case "NOT_STORED":
+		default:
+			return fmt.Errorf("memcached: %s: %s", command, line)
+		}
+		return nil
+	})
+	return stored, err
+}
+
+func (m *memcached) Incr(key string, ttl time.Duration) (int64, error) {
+	// incr only increments existing counters.
+	if _, err := m.Add(key, []byte("0"), ttl); err != nil {
+		return 0, err
+	}
+	var n int64
+	err := m.pool.do(func(c *conn) error {
+		fmt.Fprintf(c.w, "incr %s 1\r\n", key)
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if n, err = strconv.ParseInt(line, 10, 64); err != nil {
+			return fmt.Errorf("memcached: incr: %s", line)
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedcache
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNil is the Redis nil reply of a missing key or a SET NX that didn't set.
+var errNil = errors.New("redis: nil")
+
+// redis is a Store speaking the Redis protocol (RESP).
+type redis struct {
+	pool *pool
+}
+
+func newRedis(u *url.URL, timeout time.Duration) (*redis, error) {
+	p := newPool(u.Host, timeout)
+	if u.Scheme == "rediss" {
+		p.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	var setup [][]string
+	if password, ok := u.User.Password(); ok {
+		if username := u.User.Username(); username != "" {
+			setup = append(setup, []string{"AUTH", username, password})
+		} else {
+			setup = append(setup, []string{"AUTH", password})
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+		setup = append(setup, []string{"SELECT", db})
+	}
+	if len(setup) > 0 {
+		p.init = func(c *conn) error {
+			for _, args := range setup {
+				if _, err := command(c, args...); err != nil {
+					return fmt.Errorf("redis: %s: %v", args[0], err)
+				}
+			}
+			return nil
+		}
+	}
+	return &redis{pool: p}, nil
+}
+
+// command sends args as a command and returns the reply, a string for
+// simple and bulk strings or an int64 for integers.
+func command(c *conn, args ...string) (interface{}, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (r *redis) do(args ...string) (interface{}, error) {
+	var reply interface{}
+	err := r.pool.do(func(c *conn) error {
+		var err error
+		reply, err = command(c, args...)
+		if err == errNil {
+			// a nil reply leaves the connection usable
+			reply = nil
+			return nil
+		}
+		return err
+	})
+	return reply, err
+}
+
+func milliseconds(ttl time.Duration) string {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+func (r *redis) Get(key string) ([]byte, bool, error) {
+	reply, err := r.do("GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return []byte(reply.(string)), true, nil
+}
+
+func (r *redis) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := r.do("SET", key, string(value), "PX", milliseconds(ttl))
+	return err
+}
+
+func (r *redis) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := r.do("SET", key, string(value), "NX", "PX", milliseconds(ttl))
+	return reply != nil, err
+}
+
+func (r *redis) Incr(key string, ttl time.Duration) (int64, error) {
+	// Create the counter with its TTL first, as INCR keeps the TTL of an
+	// existing key but creates missing ones without any.
+	if _, err := r.Add(key, []byte("0"), ttl); err != nil {
+		return 0, err
+	}
+	reply, err := r.do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", reply)
+	}
+	return n, nil
+}
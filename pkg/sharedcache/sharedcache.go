@@ -0,0 +1,169 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sharedcache stores short-lived state in Redis or memcached, so
+// replicas of the server behind the same API server share their caches.
+package sharedcache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout bounds each request to the cache server, including
+// connecting to it.
+const DefaultTimeout = 200 * time.Millisecond
+
+// maxIdleConns is the number of connections kept open to the cache server.
+const maxIdleConns = 16
+
+// Store is a key-value store whose entries expire. Keys must not contain
+// whitespace or control characters and must be at most 250 bytes long.
+type Store interface {
+	// Get returns the value of key, or false if it isn't set.
+	Get(key string) ([]byte, bool, error)
+	// Set sets key to value for ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Add sets key to value for ttl unless it is already set, and reports
+	// whether it did.
+	Add(key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr increments the counter key and returns its new value. A missing
+	// counter is created with ttl.
+	Incr(key string, ttl time.Duration) (int64, error)
+}
+
+// Key returns the key of secret, such as a credential or a token signature,
+// under prefix in the cache of the cluster clusterID in partition. Clusters
+// sharing a cache server therefore never use each other's entries. secret is
+// hashed, so it is not stored and the key is short enough for memcached.
+func Key(prefix, partition, clusterID, secret string) string {
+	sum := sha256.Sum256([]byte(partition + "\x00" + clusterID + "\x00" + secret))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// New returns a Store for rawURL, such as "redis://:password@host:6379/0",
+// "rediss://host:6379" for Redis over TLS, or "memcached://host:11211".
+func New(rawURL string, timeout time.Duration) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shared cache URL: %v", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("shared cache URL %q has no host", rawURL)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return newRedis(u, timeout)
+	case "memcached":
+		return newMemcached(u.Host, timeout), nil
+	default:
+		return nil, fmt.Errorf("shared cache URL %q must start with redis://, rediss:// or memcached://", rawURL)
+	}
+}
+
+// conn is a connection to the cache server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// pool reuses connections to a cache server. Connections that fail are
+// closed rather than returned to the pool, so a broken connection is never
+// reused.
+type pool struct {
+	addr    string
+	timeout time.Duration
+	tls     *tls.Config
+	// init, if set, is run on new connections, e.g. to authenticate.
+	init func(*conn) error
+
+	idle chan *conn
+}
+
+func newPool(addr string, timeout time.Duration) *pool {
+	return &pool{
+		addr:    addr,
+		timeout: timeout,
+		idle:    make(chan *conn, maxIdleConns),
+	}
+}
+
+// do runs f with a connection whose deadline is set to the pool timeout.
+func (p *pool) do(f func(*conn) error) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+	c.SetDeadline(time.Now().Add(p.timeout))
+	if err := f(c); err != nil {
+		c.Close()
+		return err
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+	return nil
+}
+
+func (p *pool) get() (*conn, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: p.timeout}
+	var nc net.Conn
+	var err error
+	if p.tls != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", p.addr, p.tls)
+	} else {
+		nc, err = dialer.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if p.init != nil {
+		c.SetDeadline(time.Now().Add(p.timeout))
+		if err := p.init(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// readLine reads a line terminated by "\r\n" and returns it without the
+// terminator.
+func (c *conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("malformed response line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,191 @@
+package sharedcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer serves the connections of a listener on localhost with handle,
+// storing values in data.
+type fakeServer struct {
+	net.Listener
+	mu   sync.Mutex
+	data map[string]string
+	// commands are the commands received, by name.
+	commands []string
+}
+
+func newFakeServer(t *testing.T, handle func(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{Listener: l, data: map[string]string{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r, w := bufio.NewReader(c), bufio.NewWriter(c)
+				for handle(s, r, w) == nil && w.Flush() == nil {
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) record(command string) {
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	s.mu.Unlock()
+}
+
+func fakeMemcached(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	s.record(fields[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch fields[0] {
+	case "get":
+		if v, ok := s.data[fields[1]]; ok {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+		}
+		w.WriteString("END\r\n")
+	case "set", "add":
+		n, _ := strconv.Atoi(fields[4])
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if _, ok := s.data[fields[1]]; ok && fields[0] == "add" {
+			w.WriteString("NOT_STORED\r\n")
+			return nil
+		}
+		s.data[fields[1]] = string(data[:n])
+		w.WriteString("STORED\r\n")
+	case "incr":
+		n, _ := strconv.Atoi(s.data[fields[1]])
+		s.data[fields[1]] = strconv.Itoa(n + 1)
+		fmt.Fprintf(w, "%d\r\n", n+1)
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+func fakeRedis(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	argc, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, argc)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		args[i] = string(data[:n])
+	}
+	s.record(strings.Join(args, " "))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch args[0] {
+	case "AUTH", "SELECT":
+		w.WriteString("+OK\r\n")
+	case "GET":
+		if v, ok := s.data[args[1]]; ok {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case "SET":
+		if _, ok := s.data[args[1]]; ok && args[3] == "NX" {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		s.data[args[1]] = args[2]
+		w.WriteString("+OK\r\n")
+	case "INCR":
+		n, _ := strconv.Atoi(s.data[args[1]])
+		s.data[args[1]] = strconv.Itoa(n + 1)
+		fmt.Fprintf(w, ":%d\r\n", n+1)
+	default:
+		w.WriteString("-ERR unknown command\r\n")
+	}
+	return nil
+}
+
+func testStore(t *testing.T, store Store) {
+	if _, ok, err := store.Get("missing"); ok || err != nil {
+		t.Errorf("expected a missing key, got %v, %v", ok, err)
+	}
+	if err := store.Set("key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value, ok, err := store.Get("key"); !ok || err != nil || string(value) != "value" {
+		t.Errorf("expected value, got %q, %v, %v", value, ok, err)
+	}
+	if added, err := store.Add("key", []byte("other"), time.Minute); added || err != nil {
+		t.Errorf("expected Add of an existing key to fail, got %v, %v", added, err)
+	}
+	if added, err := store.Add("new", []byte("value"), time.Minute); !added || err != nil {
+		t.Errorf("expected Add of a new key to succeed, got %v, %v", added, err)
+	}
+	for expected := int64(1); expected <= 2; expected++ {
+		if n, err := store.Incr("counter", time.Minute); n != expected || err != nil {
+			t.Errorf("expected %d, got %d, %v", expected, n, err)
+		}
+	}
+}
+
+func TestMemcached(t *testing.T) {
+	s := newFakeServer(t, fakeMemcached)
+	defer s.Close()
+	store, err := New("memcached://"+s.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testStore(t, store)
+}
+
+func TestRedis(t *testing.T) {
+	s := newFakeServer(t, fakeRedis)
+	defer s.Close()
+	store, err := New("redis://:secret@"+s.Addr().String()+"/2", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testStore(t, store)
+	if s.commands[0] != "AUTH secret" || s.commands[1] != "SELECT 2" {
+		t.Errorf("expected the connection to authenticate and select the database, got %v", s.commands[:2])
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost", "redis://", "redis://localhost/db"} {
+		if _, err := New(rawURL, time.Second); err == nil {
+			t.Errorf("%s: expected an error", rawURL)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sqsapi is a minimal client of the SQS API for receiving change
+// notifications. The SDK's SQS package isn't vendored, so the client is set
+// up the way the generated service clients are, with the query protocol.
+package sqsapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"sigs.k8s.io/aws-iam-authenticator/pkg"
+)
+
+const (
+	serviceID  = "sqs"
+	apiVersion = "2012-11-05"
+
+	// waitTimeSeconds is the longest SQS long-polls for messages.
+	waitTimeSeconds = 20
+	// maxMessages is the most messages SQS returns at once.
+	maxMessages = 10
+)
+
+// Client calls the SQS API.
+type Client struct {
+	*client.Client
+}
+
+// New creates a Client for the SQS endpoint of region, or of the SDK's
+// default region if empty, using the SDK's default credential chain or the
+// role of roleARN assumed with them.
+func New(region, roleARN string) *Client {
+	cfg := aws.NewConfig()
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "authenticatorUserAgent",
+		Fn: request.MakeAddToUserAgentHandler(
+			"aws-iam-authenticator", pkg.Version),
+	})
+	var cfgs []*aws.Config
+	if roleARN != "" {
+		cfgs = append(cfgs, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, roleARN)))
+	}
+	return NewFromConfigProvider(sess, cfgs...)
+}
+
+// NewFromConfigProvider creates a Client from a session, like the
+// constructors of the SDK's service clients.
+func NewFromConfigProvider(p client.ConfigProvider, cfgs ...*aws.Config) *Client {
+	c := p.ClientConfig(serviceID, cfgs...)
+	cl := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   serviceID,
+			ServiceID:     "SQS",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			PartitionID:   c.PartitionID,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+	cl.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	cl.Handlers.Build.PushBackNamed(query.BuildHandler)
+	cl.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	cl.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	cl.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return &Client{cl}
+}
+
+func (c *Client) send(ctx context.Context, name string, input, output interface{}) error {
+	req := c.NewRequest(&request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output)
+	req.SetContext(ctx)
+	return req.Send()
+}
+
+type receiveMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	MaxNumberOfMessages *int64  `type:"integer"`
+	QueueUrl            *string `type:"string" required:"true"`
+	WaitTimeSeconds     *int64  `type:"integer"`
+}
+
+type receiveMessageOutput struct {
+	_ struct{} `type:"structure"`
+
+	Messages []*message `locationNameList:"Message" type:"list" flattened:"true"`
+}
+
+type message struct {
+	_ struct{} `type:"structure"`
+
+	MessageId     *string `type:"string"`
+	ReceiptHandle *string `type:"string"`
+}
+
+// ReceiveMessages long-polls queueURL for messages until some arrive, ctx
+// is done or SQS gives up after 20 seconds, and returns their receipt
+// handles. The bodies aren't returned: any message is a notification.
+func (c *Client) ReceiveMessages(ctx context.Context, queueURL string) ([]string, error) {
+	output := &receiveMessageOutput{}
+	input := &receiveMessageInput{
+		MaxNumberOfMessages: aws.Int64(maxMessages),
+		QueueUrl:            aws.String(queueURL),
+		WaitTimeSeconds:     aws.Int64(waitTimeSeconds),
+	}
+	if err := c.send(ctx, "ReceiveMessage", input, output); err != nil {
+		return nil, fmt.Errorf("could not receive messages from SQS queue %q: %w", queueURL, err)
+	}
+	handles := make([]string, 0, len(output.Messages))
+	for _, m := range output.Messages {
+		handles = append(handles, aws.StringValue(m.ReceiptHandle))
+	}
+	return handles, nil
+}
+
+type deleteMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	QueueUrl      *string `type:"string" required:"true"`
+	ReceiptHandle *string `type:"string" required:"true"`
+}
+
+type deleteMessageOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// DeleteMessage deletes the message of receiptHandle from queueURL.
+func (c *Client) DeleteMessage(queueURL, receiptHandle string) error {
+	input := &deleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: aws.String(receiptHandle)}
+	if err := c.send(context.Background(), "DeleteMessage", input, &deleteMessageOutput{}); err != nil {
+		return fmt.Errorf("could not delete message from SQS queue %q: %w", queueURL, err)
+	}
+	return nil
+}
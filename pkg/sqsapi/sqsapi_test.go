@@ -0,0 +1,97 @@
+package sqsapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const queueURL = "https://sqs.us-west-2.amazonaws.com/123456789012/access-entries"
+
+// testClient returns a Client of an SQS endpoint answering each request with
+// the next of responses. The forms of the requests are appended to
+// requests.
+func testClient(requests *[]url.Values, responses ...string) (*Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		*requests = append(*requests, r.PostForm)
+		w.Write([]byte(responses[len(*requests)-1]))
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+	}))
+	return NewFromConfigProvider(sess), server.Close
+}
+
+func TestReceiveMessages(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests, `<ReceiveMessageResponse>
+  <ReceiveMessageResult>
+    <Message><MessageId>1</MessageId><ReceiptHandle>handle-1</ReceiptHandle><Body>{}</Body></Message>
+    <Message><MessageId>2</MessageId><ReceiptHandle>handle-2</ReceiptHandle><Body>{}</Body></Message>
+  </ReceiveMessageResult>
+  <ResponseMetadata><RequestId>b6633655-283d-45b4-aee4-4e84e0ae6afa</RequestId></ResponseMetadata>
+</ReceiveMessageResponse>`)
+	defer done()
+
+	handles, err := c.ReceiveMessages(context.Background(), queueURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"handle-1", "handle-2"}; !reflect.DeepEqual(handles, expected) {
+		t.Errorf("expected %v, got %v", expected, handles)
+	}
+	expected := url.Values{
+		"Action":              {"ReceiveMessage"},
+		"Version":             {"2012-11-05"},
+		"MaxNumberOfMessages": {"10"},
+		"QueueUrl":            {queueURL},
+		"WaitTimeSeconds":     {"20"},
+	}
+	if !reflect.DeepEqual(requests[0], expected) {
+		t.Errorf("expected request %v, got %v", expected, requests[0])
+	}
+}
+
+func TestReceiveMessagesEmpty(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests, `<ReceiveMessageResponse><ReceiveMessageResult/></ReceiveMessageResponse>`)
+	defer done()
+
+	handles, err := c.ReceiveMessages(context.Background(), queueURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(handles) != 0 {
+		t.Errorf("expected no messages, got %v", handles)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	var requests []url.Values
+	c, done := testClient(&requests, `<DeleteMessageResponse><ResponseMetadata><RequestId>b5293cb5-d306-4a17-9048-b263635abe42</RequestId></ResponseMetadata></DeleteMessageResponse>`)
+	defer done()
+
+	if err := c.DeleteMessage(queueURL, "handle-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := url.Values{
+		"Action":        {"DeleteMessage"},
+		"Version":       {"2012-11-05"},
+		"QueueUrl":      {queueURL},
+		"ReceiptHandle": {"handle-1"},
+	}
+	if !reflect.DeepEqual(requests[0], expected) {
+		t.Errorf("expected request %v, got %v", expected, requests[0])
+	}
+}
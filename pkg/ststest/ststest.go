@@ -0,0 +1,263 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ststest is an in-process mock of the STS GetCallerIdentity API for
+// tests and demos. It verifies the SigV4 signature of presigned requests
+// with the secret keys of canned identities and answers with the identity
+// whose credentials signed the request, like STS would.
+package ststest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	// emptyPayloadHash is the SHA-256 of the empty body of presigned GETs
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// expiration is how long after X-Amz-Date STS accepts presigned
+	// GetCallerIdentity requests
+	expiration = 15 * time.Minute
+	// requestID is the request ID of every response, keeping them
+	// deterministic
+	requestID = "00000000-0000-0000-0000-000000000000"
+)
+
+// Identity is a principal the mock STS knows.
+type Identity struct {
+	// AccessKeyID and SecretAccessKey are the credentials that sign the
+	// requests of the identity.
+	AccessKeyID     string
+	SecretAccessKey string
+	// ARN is returned by GetCallerIdentity, such as
+	// arn:aws:iam::123456789012:user/Alice or
+	// arn:aws:sts::123456789012:assumed-role/Admin/session. The account is
+	// read from it.
+	ARN string
+	// UserID is returned by GetCallerIdentity. Defaults to an ID derived
+	// from the ARN, ending in :<session name> for assumed roles.
+	UserID string
+}
+
+// STS is an http.Handler answering presigned GetCallerIdentity requests for
+// its identities. Time is read from Now, which defaults to time.Now.
+type STS struct {
+	Now func() time.Time
+
+	mu         sync.RWMutex
+	identities map[string]Identity
+}
+
+// New returns a mock STS knowing identities.
+func New(identities ...Identity) *STS {
+	s := &STS{Now: time.Now, identities: map[string]Identity{}}
+	for _, id := range identities {
+		s.AddIdentity(id)
+	}
+	return s
+}
+
+// AddIdentity adds id, replacing any identity with the same access key ID.
+func (s *STS) AddIdentity(id Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities[id.AccessKeyID] = id
+}
+
+// Server is a mock STS listening on a loopback port.
+type Server struct {
+	*STS
+	*httptest.Server
+}
+
+// NewServer starts a mock STS knowing identities at the URL of the returned
+// server, which verifiers reach with their STS endpoint override. Call Close
+// when done.
+func NewServer(identities ...Identity) *Server {
+	s := New(identities...)
+	return &Server{STS: s, Server: httptest.NewServer(s)}
+}
+
+// ServeHTTP answers a presigned GetCallerIdentity request.
+func (s *STS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.Method != http.MethodGet || query.Get("Action") != "GetCallerIdentity" || query.Get("Version") != "2011-06-15" {
+		writeError(w, http.StatusBadRequest, "InvalidAction", "only presigned GetCallerIdentity requests are supported")
+		return
+	}
+	if query.Get("X-Amz-Algorithm") != signingAlgorithm {
+		writeError(w, http.StatusForbidden, "IncompleteSignature", "the request is not presigned with "+signingAlgorithm)
+		return
+	}
+
+	// X-Amz-Credential is <access key ID>/<date>/<region>/sts/aws4_request
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[3] != "sts" || credential[4] != "aws4_request" {
+		writeError(w, http.StatusForbidden, "IncompleteSignature", "invalid X-Amz-Credential")
+		return
+	}
+	s.mu.RLock()
+	id, ok := s.identities[credential[0]]
+	s.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid.")
+		return
+	}
+
+	signed, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if err != nil || signed.Format("20060102") != credential[1] {
+		writeError(w, http.StatusForbidden, "IncompleteSignature", "invalid X-Amz-Date")
+		return
+	}
+	if _, err := strconv.Atoi(query.Get("X-Amz-Expires")); err != nil {
+		writeError(w, http.StatusForbidden, "IncompleteSignature", "invalid X-Amz-Expires")
+		return
+	}
+	// like STS, ignore X-Amz-Expires, which the signature still covers
+	if s.Now().After(signed.Add(expiration)) {
+		writeError(w, http.StatusForbidden, "ExpiredToken", "Request has expired.")
+		return
+	}
+
+	if !hmac.Equal([]byte(signature(r, query, id.SecretAccessKey, credential)), []byte(query.Get("X-Amz-Signature"))) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+		return
+	}
+	writeIdentity(w, id)
+}
+
+// signature computes the SigV4 signature of the presigned request r.
+func signature(r *http.Request, query url.Values, secretAccessKey string, credential []string) string {
+	signedHeaders := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	canonicalQuery := url.Values{}
+	for k, v := range query {
+		if k != "X-Amz-Signature" {
+			canonicalQuery[k] = v
+		}
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Replace(canonicalQuery.Encode(), "+", "%20", -1),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		emptyPayloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		query.Get("X-Amz-Date"),
+		strings.Join(credential[1:], "/"),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range credential[1:] {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// userID returns the UserID of id, or one derived from its ARN.
+func userID(id Identity) string {
+	if id.UserID != "" {
+		return id.UserID
+	}
+	resource := id.ARN[strings.LastIndex(id.ARN, ":")+1:]
+	if parts := strings.Split(resource, "/"); parts[0] == "assumed-role" && len(parts) == 3 {
+		return "AROA" + strings.ToUpper(hex.EncodeToString([]byte(parts[1]))) + ":" + parts[2]
+	}
+	return "AIDA" + strings.ToUpper(hex.EncodeToString([]byte(resource)))
+}
+
+// account returns the account ID of an ARN.
+func account(arn string) string {
+	if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 {
+		return parts[4]
+	}
+	return ""
+}
+
+type callerIdentity struct {
+	Account string `json:"Account"`
+	Arn     string `json:"Arn"`
+	UserID  string `json:"UserId"`
+}
+
+type responseMetadata struct {
+	RequestID string `json:"RequestId"`
+}
+
+func writeIdentity(w http.ResponseWriter, id Identity) {
+	var response struct {
+		GetCallerIdentityResponse struct {
+			GetCallerIdentityResult callerIdentity   `json:"GetCallerIdentityResult"`
+			ResponseMetadata        responseMetadata `json:"ResponseMetadata"`
+		} `json:"GetCallerIdentityResponse"`
+	}
+	response.GetCallerIdentityResponse.GetCallerIdentityResult = callerIdentity{
+		Account: account(id.ARN),
+		Arn:     id.ARN,
+		UserID:  userID(id),
+	}
+	response.GetCallerIdentityResponse.ResponseMetadata.RequestID = requestID
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeError writes an error in the JSON format of STS.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var response struct {
+		Error struct {
+			Type    string `json:"Type"`
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+		RequestID string `json:"RequestId"`
+	}
+	response.Error.Type, response.Error.Code, response.Error.Message = "Sender", code, message
+	response.RequestID = requestID
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
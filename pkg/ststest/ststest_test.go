@@ -0,0 +1,134 @@
+package ststest
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+var (
+	alice = Identity{
+		AccessKeyID:     "AKIAALICE",
+		SecretAccessKey: "alice-secret",
+		ARN:             "arn:aws:iam::123456789012:user/Alice",
+	}
+	admin = Identity{
+		AccessKeyID:     "ASIAADMIN",
+		SecretAccessKey: "admin-secret",
+		ARN:             "arn:aws:sts::123456789012:assumed-role/Admin/session",
+	}
+)
+
+func signToken(t *testing.T, clusterID, region string, id Identity) string {
+	sess, err := session.NewSession(&aws.Config{
+		Region:              aws.String(region),
+		STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
+		Credentials:         credentials.NewStaticCredentials(id.AccessKeyID, id.SecretAccessKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := token.NewGenerator(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := gen.GetWithSTS(clusterID, sts.New(sess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok.Token
+}
+
+func stsReason(err error) string {
+	if stsErr, ok := err.(token.STSError); ok {
+		return stsErr.Reason()
+	}
+	return ""
+}
+
+func newVerifier(clusterID string, s *Server) token.Verifier {
+	return token.NewVerifierWithOptions(token.VerifierOptions{
+		ClusterID:           clusterID,
+		PartitionID:         "aws",
+		AllowedClockSkew:    token.DefaultAllowedClockSkew,
+		STSEndpointOverride: s.URL,
+	})
+}
+
+func TestVerify(t *testing.T) {
+	s := NewServer(alice, admin)
+	defer s.Close()
+
+	for _, tc := range []struct {
+		id     Identity
+		region string
+		arn    string
+		userID string
+	}{
+		{alice, "us-east-1", "arn:aws:iam::123456789012:user/Alice", "AIDA" + strings.ToUpper("757365722f416c696365")},
+		{admin, "eu-west-1", "arn:aws:iam::123456789012:role/Admin", "AROA41646D696E"},
+	} {
+		id, err := newVerifier("cluster", s).Verify(signToken(t, "cluster", tc.region, tc.id))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.id.AccessKeyID, err)
+			continue
+		}
+		if id.CanonicalARN != tc.arn || id.AccountID != "123456789012" || id.UserID != tc.userID {
+			t.Errorf("%s: unexpected identity %+v", tc.id.AccessKeyID, id)
+		}
+	}
+}
+
+func TestVerifyRejected(t *testing.T) {
+	s := NewServer(alice)
+	defer s.Close()
+
+	// signed for another cluster
+	if _, err := newVerifier("cluster", s).Verify(signToken(t, "other", "us-east-1", alice)); stsReason(err) != token.ReasonClusterIDMismatch {
+		t.Errorf("expected a cluster ID mismatch, got %v", err)
+	}
+	// signed with the wrong secret
+	forged := alice
+	forged.SecretAccessKey = "guess"
+	if _, err := newVerifier("cluster", s).Verify(signToken(t, "cluster", "us-east-1", forged)); stsReason(err) != token.ReasonClusterIDMismatch {
+		t.Errorf("expected a signature mismatch, got %v", err)
+	}
+	// unknown credentials
+	if _, err := newVerifier("cluster", s).Verify(signToken(t, "cluster", "us-east-1", admin)); stsReason(err) != token.ReasonSTSRejected {
+		t.Errorf("expected STS to reject unknown credentials, got %v", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s := NewServer(alice)
+	defer s.Close()
+	s.Now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	tok := signToken(t, "cluster", "us-east-1", alice)
+	presigned, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(tok, "k8s-aws-v1."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(string(presigned))
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/?"+u.RawQuery, nil)
+	req.Host = u.Host
+	req.Header.Set("x-k8s-aws-id", "cluster")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected an expired request to be forbidden, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// This file implements the subset of CBOR (RFC 8949) that v2 tokens use: a
+// map with unsigned integer keys whose values are unsigned integers, byte
+// strings or text strings. Encoding is deterministic (RFC 8949 section
+// 4.2.1), and decoding rejects anything else, such as indefinite lengths,
+// non-minimal heads, duplicate keys and trailing data.
+
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborMap   = 5
+)
+
+var errCBORTruncated = errors.New("truncated CBOR data")
+
+// encodeCBORMap encodes m, whose values must be uint64, []byte or string.
+func encodeCBORMap(m map[uint64]interface{}) ([]byte, error) {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	b := appendCBORHead(nil, cborMap, uint64(len(m)))
+	for _, k := range keys {
+		b = appendCBORHead(b, cborUint, k)
+		switch v := m[k].(type) {
+		case uint64:
+			b = appendCBORHead(b, cborUint, v)
+		case []byte:
+			b = appendCBORHead(b, cborBytes, uint64(len(v)))
+			b = append(b, v...)
+		case string:
+			b = appendCBORHead(b, cborText, uint64(len(v)))
+			b = append(b, v...)
+		default:
+			return nil, fmt.Errorf("unsupported CBOR value of type %T for key %d", v, k)
+		}
+	}
+	return b, nil
+}
+
+// appendCBORHead appends the shortest head of an item of type major with
+// argument n.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return append(b, m|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(b, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	b = append(b, m|27)
+	for shift := 56; shift >= 0; shift -= 8 {
+		b = append(b, byte(n>>uint(shift)))
+	}
+	return b
+}
+
+// decodeCBORMap decodes data encoded by encodeCBORMap.
+func decodeCBORMap(data []byte) (map[uint64]interface{}, error) {
+	d := cborDecoder{data: data}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, fmt.Errorf("expected a CBOR map, got major type %d", major)
+	}
+	// every entry takes at least two bytes
+	if n > uint64(len(data)) {
+		return nil, errCBORTruncated
+	}
+
+	m := make(map[uint64]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		major, key, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if major != cborUint {
+			return nil, fmt.Errorf("expected an unsigned integer CBOR map key, got major type %d", major)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("duplicate CBOR map key %d", key)
+		}
+		if m[key], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	if d.off != len(data) {
+		return nil, errors.New("trailing data after CBOR map")
+	}
+	return m, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errCBORTruncated
+	}
+	ib := d.data[d.off]
+	d.off++
+	major, info := ib>>5, ib&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("unsupported CBOR additional information %d", info)
+	}
+	size := 1 << (info - 24)
+	if len(d.data)-d.off < size {
+		return 0, 0, errCBORTruncated
+	}
+	var n uint64
+	for _, c := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+	if len(appendCBORHead(nil, major, n)) != size+1 {
+		return 0, 0, errors.New("non-minimal CBOR integer encoding")
+	}
+	return major, n, nil
+}
+
+func (d *cborDecoder) value() (interface{}, error) {
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborBytes, cborText:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errCBORTruncated
+		}
+		v := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		if major == cborBytes {
+			return append([]byte(nil), v...), nil
+		}
+		if !utf8.Valid(v) {
+			return nil, errors.New("invalid UTF-8 in CBOR text string")
+		}
+		return string(v), nil
+	}
+	return nil, fmt.Errorf("unsupported CBOR major type %d", major)
+}
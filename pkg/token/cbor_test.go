@@ -0,0 +1,49 @@
+package token
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	m := map[uint64]interface{}{
+		1:    "text",
+		2:    []byte{0, 1, 2},
+		3:    uint64(23),
+		4:    uint64(24),
+		5:    uint64(1 << 40),
+		1000: strings.Repeat("x", 300),
+	}
+	data, err := encodeCBORMap(m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := decodeCBORMap(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %v, got %v", m, got)
+	}
+}
+
+func TestCBORDecodeInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":               {},
+		"not a map":           {0x61, 'a'},
+		"truncated":           {0xa1, 0x01, 0x63, 'a'},
+		"trailing data":       {0xa1, 0x01, 0x00, 0x00},
+		"duplicate key":       {0xa2, 0x01, 0x00, 0x01, 0x00},
+		"text key":            {0xa1, 0x61, 'a', 0x00},
+		"non-minimal integer": {0xa1, 0x18, 0x01, 0x00},
+		"indefinite length":   {0xbf, 0xff},
+		"invalid UTF-8":       {0xa1, 0x01, 0x61, 0xff},
+		"huge map":            {0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge string":         {0xa1, 0x01, 0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := decodeCBORMap(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Kinds of access key IDs, from their prefix.
+const (
+	AccessKeyLongTerm  = "long-term"
+	AccessKeyTemporary = "temporary"
+	AccessKeyUnknown   = "unknown"
+)
+
+// DecodedToken describes a token from its presigned URL alone, without
+// calling STS.
+type DecodedToken struct {
+	// Format is "v1" or "v2".
+	Format       string `json:"format"`
+	PresignedURL string `json:"presignedURL"`
+	Host         string `json:"host"`
+	// Region is the signing region, from the credential scope.
+	Region      string `json:"region"`
+	AccessKeyID string `json:"accessKeyID"`
+	// AccessKeyType is AccessKeyLongTerm for the AKIA keys of IAM users,
+	// AccessKeyTemporary for the ASIA keys of sessions, or
+	// AccessKeyUnknown.
+	AccessKeyType string    `json:"accessKeyType"`
+	SignedAt      time.Time `json:"signedAt"`
+	// Expiration is when STS stops accepting the token.
+	Expiration    time.Time `json:"expiration"`
+	SignedHeaders []string  `json:"signedHeaders"`
+	// ClusterIDSigned is whether one of the cluster ID headers, named by
+	// ClusterIDHeader, is signed. The cluster ID itself isn't part of the
+	// token: servers send their own, and STS rejects the signature unless it
+	// matches.
+	ClusterIDSigned bool   `json:"clusterIDSigned"`
+	ClusterIDHeader string `json:"clusterIDHeader,omitempty"`
+	// SourceIPBound is whether the token is bound to the source IP of the
+	// client presenting it.
+	SourceIPBound bool `json:"sourceIPBound"`
+	// ValidationError, if set, is why a verifier would reject the token
+	// before calling STS.
+	ValidationError string `json:"validationError,omitempty"`
+}
+
+// Decode describes token and checks it as a verifier with opts would before
+// calling STS, without calling STS. It only fails for tokens whose presigned
+// URL can't be decoded; other problems are reported in the ValidationError
+// of the result.
+func Decode(token string, opts VerifierOptions) (*DecodedToken, error) {
+	presignedURL, err := decodePresignedURL(token)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(presignedURL)
+	if err != nil {
+		return nil, FormatError{reason: ReasonMalformed, message: err.Error()}
+	}
+
+	d := &DecodedToken{
+		Format:        "v1",
+		PresignedURL:  presignedURL,
+		Host:          u.Host,
+		AccessKeyType: AccessKeyUnknown,
+	}
+	if strings.HasPrefix(token, v2Prefix) {
+		d.Format = "v2"
+	}
+	params := url.Values{}
+	for key, values := range u.Query() {
+		params[strings.ToLower(key)] = values
+	}
+	// <access key ID>/<date>/<region>/sts/aws4_request
+	scope := strings.Split(params.Get("x-amz-credential"), "/")
+	d.AccessKeyID = scope[0]
+	if len(scope) == 5 {
+		d.Region = scope[2]
+	}
+	switch {
+	case strings.HasPrefix(d.AccessKeyID, "AKIA"):
+		d.AccessKeyType = AccessKeyLongTerm
+	case strings.HasPrefix(d.AccessKeyID, "ASIA"):
+		d.AccessKeyType = AccessKeyTemporary
+	}
+	if signedAt, err := time.Parse(dateHeaderFormat, params.Get("x-amz-date")); err == nil {
+		d.SignedAt = signedAt
+		d.Expiration = signedAt.Add(presignedURLExpiration)
+	}
+	if signed := params.Get("x-amz-signedheaders"); signed != "" {
+		d.SignedHeaders = strings.Split(signed, ";")
+	}
+	v := newTokenVerifier(opts)
+	d.ClusterIDHeader = v.signedClusterIDHeader(&params)
+	d.ClusterIDSigned = d.ClusterIDHeader != ""
+	d.SourceIPBound = hasSignedHeader(&params, sourceIPHeader)
+
+	if _, err := v.parse(token, time.Now()); err != nil {
+		d.ValidationError = err.Error()
+	}
+	return d, nil
+}
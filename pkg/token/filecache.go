@@ -134,11 +134,11 @@ func (c *cachedCredential) IsExpired() bool {
 // readCacheWhileLocked reads the contents of the credential cache and returns the
 // parsed yaml as a cacheFile object.  This method must be called while a shared
 // lock is held on the filename.
-func readCacheWhileLocked(filename string) (cache cacheFile, err error) {
+func readCacheWhileLocked(fs filesystem, filename string) (cache cacheFile, err error) {
 	cache = cacheFile{
 		map[string]map[string]map[string]cachedCredential{},
 	}
-	data, err := f.ReadFile(filename)
+	data, err := fs.ReadFile(filename)
 	if err != nil {
 		err = fmt.Errorf("unable to open file %s: %v", filename, err)
 		return
@@ -154,11 +154,11 @@ func readCacheWhileLocked(filename string) (cache cacheFile, err error) {
 // writeCacheWhileLocked writes the contents of the credential cache using the
 // yaml marshaled form of the passed cacheFile object.  This method must be
 // called while an exclusive lock is held on the filename.
-func writeCacheWhileLocked(filename string, cache cacheFile) error {
+func writeCacheWhileLocked(fs filesystem, filename string, cache cacheFile) error {
 	data, err := yaml.Marshal(cache)
 	if err == nil {
 		// write privately owned by the user
-		err = f.WriteFile(filename, data, 0600)
+		err = fs.WriteFile(filename, data, 0600)
 	}
 	return err
 }
@@ -170,6 +170,8 @@ type FileCacheProvider struct {
 	credentials      *credentials.Credentials // the underlying implementation that has the *real* Provider
 	cacheKey         cacheKey                 // cache key parameters used to create Provider
 	cachedCredential cachedCredential         // the cached credential, if it exists
+	fs               filesystem               // where the cache is stored
+	filename         string                   // the cache file, locked while it is read or written
 }
 
 // NewFileCacheProvider creates a new Provider implementation that wraps a provided Credentials,
@@ -177,15 +179,20 @@ type FileCacheProvider struct {
 // If there are any problems accessing or initializing the cache, an error will be returned, and
 // callers should just use the existing credentials provider.
 func NewFileCacheProvider(clusterID, profile, roleARN string, creds *credentials.Credentials) (FileCacheProvider, error) {
+	return newCacheProvider(f, CacheFilename(), clusterID, profile, roleARN, creds)
+}
+
+// newCacheProvider creates a caching Provider reading and writing the cache
+// filename through fs.
+func newCacheProvider(fs filesystem, filename, clusterID, profile, roleARN string, creds *credentials.Credentials) (FileCacheProvider, error) {
 	if creds == nil {
 		return FileCacheProvider{}, errors.New("no underlying Credentials object provided")
 	}
-	filename := CacheFilename()
 	cacheKey := cacheKey{clusterID, profile, roleARN}
 	cachedCredential := cachedCredential{}
 	// ensure path to cache file exists
-	_ = f.MkdirAll(filepath.Dir(filename), 0700)
-	if info, err := f.Stat(filename); !os.IsNotExist(err) {
+	_ = fs.MkdirAll(filepath.Dir(filename), 0700)
+	if info, err := fs.Stat(filename); !os.IsNotExist(err) {
 		if info.Mode()&0077 != 0 {
 			// cache file has secret credentials and should only be accessible to the user, refuse to use it.
 			return FileCacheProvider{}, fmt.Errorf("cache file %s is not private", filename)
@@ -203,7 +210,7 @@ func NewFileCacheProvider(clusterID, profile, roleARN string, creds *credentials
 			return FileCacheProvider{}, fmt.Errorf("unable to read lock file %s: %v", filename, err)
 		}
 
-		cache, err := readCacheWhileLocked(filename)
+		cache, err := readCacheWhileLocked(fs, filename)
 		if err != nil {
 			// can't read or parse cache, refuse to use it.
 			return FileCacheProvider{}, err
@@ -219,6 +226,8 @@ func NewFileCacheProvider(clusterID, profile, roleARN string, creds *credentials
 		creds,
 		cacheKey,
 		cachedCredential,
+		fs,
+		filename,
 	}, nil
 }
 
@@ -238,7 +247,7 @@ func (f *FileCacheProvider) Retrieve() (credentials.Value, error) {
 		}
 		if expiration, err := f.credentials.ExpiresAt(); err == nil {
 			// underlying provider supports Expirer interface, so we can cache
-			filename := CacheFilename()
+			filename := f.filename
 			// do file locking on cache to prevent inconsistent writes
 			lock := newFlock(filename)
 			defer lock.Unlock()
@@ -257,9 +266,9 @@ func (f *FileCacheProvider) Retrieve() (credentials.Value, error) {
 				nil,
 			}
 			// don't really care about read error.  Either read the cache, or we create a new cache.
-			cache, _ := readCacheWhileLocked(filename)
+			cache, _ := readCacheWhileLocked(f.fs, filename)
 			cache.Put(f.cacheKey, f.cachedCredential)
-			err = writeCacheWhileLocked(filename, cache)
+			err = writeCacheWhileLocked(f.fs, filename, cache)
 			if err != nil {
 				// can't write cache, but still return the credential
 				_, _ = fmt.Fprintf(os.Stderr, "Unable to update credential cache %s: %v\n", filename, err)
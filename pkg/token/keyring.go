@@ -0,0 +1,115 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Where credentials are cached with GetTokenOptions.CacheBackend.
+const (
+	// CacheBackendAuto caches credentials in the keychain of the OS when it
+	// is available, and in the cache file otherwise.
+	CacheBackendAuto = "auto"
+	// CacheBackendFile caches credentials in the plaintext cache file.
+	CacheBackendFile = "file"
+	// CacheBackendKeyring caches credentials in the keychain of the OS: the
+	// Keychain on macOS, the Secret Service (through secret-tool) on Linux,
+	// and a file encrypted with DPAPI on Windows.
+	CacheBackendKeyring = "keyring"
+)
+
+// keyringService and keyringAccount name the keychain item the cache is
+// stored in.
+const (
+	keyringService = "aws-iam-authenticator"
+	keyringAccount = "credentials"
+)
+
+// errKeyringUnavailable is returned by newKeyring when the OS has no
+// keychain the cache can be stored in.
+var errKeyringUnavailable = errors.New("no OS keychain is available")
+
+// keyring stores the credential cache in the keychain of the OS.
+type keyring interface {
+	// get returns the stored cache, or an error satisfying os.IsNotExist if
+	// nothing is stored.
+	get() ([]byte, error)
+	set(data []byte) error
+}
+
+// A mockable keyring constructor, implemented for each OS.
+var newKeyring = newOSKeyring
+
+// keyringFS is a filesystem keeping the single file it is used for, the
+// cache, in a keyring. The cache file is still created on disk, empty, to be
+// locked.
+type keyringFS struct {
+	keyring keyring
+}
+
+func (k keyringFS) Stat(filename string) (os.FileInfo, error) {
+	if _, err := k.keyring.get(); os.IsNotExist(err) {
+		return nil, err
+	}
+	// other errors are returned when the cache is read
+	return keyringFileInfo{filepath.Base(filename)}, nil
+}
+
+func (k keyringFS) ReadFile(filename string) ([]byte, error) {
+	return k.keyring.get()
+}
+
+func (k keyringFS) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return k.keyring.set(data)
+}
+
+func (k keyringFS) MkdirAll(path string, perm os.FileMode) error {
+	return f.MkdirAll(path, perm)
+}
+
+type keyringFileInfo struct {
+	name string
+}
+
+func (i keyringFileInfo) Name() string       { return i.name }
+func (i keyringFileInfo) Size() int64        { return 0 }
+func (i keyringFileInfo) Mode() os.FileMode  { return 0600 }
+func (i keyringFileInfo) ModTime() time.Time { return time.Time{} }
+func (i keyringFileInfo) IsDir() bool        { return false }
+func (i keyringFileInfo) Sys() interface{}   { return nil }
+
+// keyringLockFilename is the file locked while the cache is read from or
+// written to the keyring.
+func keyringLockFilename() string {
+	return filepath.Join(filepath.Dir(CacheFilename()), "keyring.lock")
+}
+
+// NewKeyringCacheProvider is NewFileCacheProvider caching the credentials in
+// the keychain of the OS instead of a plaintext file. It returns an error if
+// the OS has no keychain available.
+func NewKeyringCacheProvider(clusterID, profile, roleARN string, creds *credentials.Credentials) (FileCacheProvider, error) {
+	k, err := newKeyring()
+	if err != nil {
+		return FileCacheProvider{}, err
+	}
+	return newCacheProvider(keyringFS{k}, keyringLockFilename(), clusterID, profile, roleARN, creds)
+}
+
+// newCacheBackendProvider creates the caching Provider of backend.
+func newCacheBackendProvider(backend, clusterID, profile, roleARN string, creds *credentials.Credentials) (FileCacheProvider, error) {
+	switch backend {
+	case CacheBackendFile:
+		return NewFileCacheProvider(clusterID, profile, roleARN, creds)
+	case CacheBackendKeyring:
+		return NewKeyringCacheProvider(clusterID, profile, roleARN, creds)
+	default:
+		if _, err := newKeyring(); err == nil {
+			return NewKeyringCacheProvider(clusterID, profile, roleARN, creds)
+		}
+		return NewFileCacheProvider(clusterID, profile, roleARN, creds)
+	}
+}
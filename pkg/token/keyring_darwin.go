@@ -0,0 +1,51 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// securityKeyring stores the cache in the login Keychain with the security
+// command. The cache is stored base64 encoded so that it is read back as is.
+type securityKeyring struct {
+	path string
+}
+
+func newOSKeyring() (keyring, error) {
+	path, err := exec.LookPath("security")
+	if err != nil {
+		return nil, errKeyringUnavailable
+	}
+	return securityKeyring{path}, nil
+}
+
+func (k securityKeyring) get() ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(k.path, "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 44 {
+		// errSecItemNotFound
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read the Keychain: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+func (k securityKeyring) set(data []byte) error {
+	// the password is passed on stdin rather than as an argument, which
+	// other processes could see
+	password := hex.EncodeToString([]byte(base64.StdEncoding.EncodeToString(data)))
+	cmd := exec.Command(k.path, "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", keyringService, keyringAccount, password))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not write the Keychain: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// secretToolKeyring stores the cache with the Secret Service (such as GNOME
+// Keyring or KWallet) through libsecret's secret-tool command. The cache is
+// stored base64 encoded so that it is read back as is.
+type secretToolKeyring struct {
+	path string
+}
+
+func newOSKeyring() (keyring, error) {
+	// the Secret Service is only reachable in a desktop session
+	if e.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, errKeyringUnavailable
+	}
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, errKeyringUnavailable
+	}
+	return secretToolKeyring{path}, nil
+}
+
+func (k secretToolKeyring) get() ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(k.path, "lookup", "service", keyringService, "account", keyringAccount)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+			// secret-tool fails silently when nothing is stored
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("could not read the Secret Service: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+func (k secretToolKeyring) set(data []byte) error {
+	cmd := exec.Command(k.path, "store", "--label=aws-iam-authenticator credential cache",
+		"service", keyringService, "account", keyringAccount)
+	// secret-tool reads the secret from stdin
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(data))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not write the Secret Service: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
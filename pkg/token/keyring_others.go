@@ -0,0 +1,8 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package token
+
+func newOSKeyring() (keyring, error) {
+	return nil, errKeyringUnavailable
+}
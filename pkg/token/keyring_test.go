@@ -0,0 +1,105 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+type testKeyring struct {
+	data []byte
+	err  error
+}
+
+func (k *testKeyring) get() ([]byte, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	if k.data == nil {
+		return nil, os.ErrNotExist
+	}
+	return k.data, nil
+}
+
+func (k *testKeyring) set(data []byte) error {
+	if k.err != nil {
+		return k.err
+	}
+	k.data = data
+	return nil
+}
+
+func mockKeyring(k keyring, err error) func() {
+	orig := newKeyring
+	newKeyring = func() (keyring, error) {
+		return k, err
+	}
+	return func() { newKeyring = orig }
+}
+
+func TestKeyringCacheProvider(t *testing.T) {
+	providerCredential, expiration, c := makeExpirerCredentials()
+	tf, _, _ := getMocks()
+	k := &testKeyring{}
+	defer mockKeyring(k, nil)()
+
+	// initialize from an empty keyring
+	p, err := NewKeyringCacheProvider("CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+
+	credential, err := p.Retrieve()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if credential != providerCredential {
+		t.Errorf("Cache did not return provider credential, got %v, expected %v", credential, providerCredential)
+	}
+	if len(k.data) == 0 {
+		t.Fatalf("Expected the credential to be cached in the keyring")
+	}
+	if len(tf.data) != 0 {
+		t.Errorf("Expected nothing to be written to the cache file, got %s", tf.data)
+	}
+
+	// a new provider reads the cached credential back from the keyring
+	p, err = NewKeyringCacheProvider("CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+	if p.cachedCredential.Credential != providerCredential || !p.ExpiresAt().Equal(expiration) {
+		t.Errorf("Expected the cached credential, got %v", p.cachedCredential)
+	}
+
+	// a keyring that can't be read isn't used
+	k.err = errors.New("keychain locked")
+	if _, err := NewKeyringCacheProvider("CLUSTER", "PROFILE", "ARN", c); err == nil {
+		t.Errorf("Expected an error reading the keyring")
+	}
+}
+
+func TestCacheBackendProvider(t *testing.T) {
+	_, _, c := makeExpirerCredentials()
+	tf, _, _ := getMocks()
+	tf.err = os.ErrNotExist
+
+	restore := mockKeyring(nil, errKeyringUnavailable)
+	defer restore()
+	p, err := newCacheBackendProvider(CacheBackendAuto, "CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+	if p.filename != CacheFilename() {
+		t.Errorf("Expected the cache file without a keyring, got %s", p.filename)
+	}
+	if _, err := newCacheBackendProvider(CacheBackendKeyring, "CLUSTER", "PROFILE", "ARN", c); err != errKeyringUnavailable {
+		t.Errorf("Expected the keyring to be unavailable, got %v", err)
+	}
+
+	mockKeyring(&testKeyring{}, nil)
+	p, err = newCacheBackendProvider(CacheBackendAuto, "CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+	if p.filename != keyringLockFilename() {
+		t.Errorf("Expected the keyring to be used, got %s", p.filename)
+	}
+	p, err = newCacheBackendProvider(CacheBackendFile, "CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+	if p.filename != CacheFilename() {
+		t.Errorf("Expected the cache file, got %s", p.filename)
+	}
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modcrypt32             = windows.NewLazySystemDLL("crypt32.dll")
+	procCryptProtectData   = modcrypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = modcrypt32.NewProc("CryptUnprotectData")
+)
+
+// cryptProtectUIForbidden fails rather than prompting when protecting or
+// unprotecting data requires it.
+const cryptProtectUIForbidden = 0x1
+
+// dataBlob is a DATA_BLOB.
+type dataBlob struct {
+	cbData uint32
+	pbData *byte
+}
+
+func newDataBlob(data []byte) *dataBlob {
+	if len(data) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{cbData: uint32(len(data)), pbData: &data[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	data := make([]byte, b.cbData)
+	copy(data, (*[1 << 30]byte)(unsafe.Pointer(b.pbData))[:b.cbData:b.cbData])
+	return data
+}
+
+// dpapiKeyring stores the cache in a file encrypted with DPAPI, which only
+// the current user can decrypt.
+type dpapiKeyring struct {
+	filename string
+}
+
+func newOSKeyring() (keyring, error) {
+	if err := procCryptProtectData.Find(); err != nil {
+		return nil, errKeyringUnavailable
+	}
+	return dpapiKeyring{filepath.Join(filepath.Dir(CacheFilename()), "credentials.dpapi")}, nil
+}
+
+func (k dpapiKeyring) get() ([]byte, error) {
+	encrypted, err := f.ReadFile(k.filename)
+	if err != nil {
+		return nil, err
+	}
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(uintptr(unsafe.Pointer(newDataBlob(encrypted))), 0, 0, 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("could not decrypt %s: %v", k.filename, err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.pbData)))
+	return out.bytes(), nil
+}
+
+func (k dpapiKeyring) set(data []byte) error {
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(uintptr(unsafe.Pointer(newDataBlob(data))), 0, 0, 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return fmt.Errorf("could not encrypt the credential cache: %v", err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.pbData)))
+	return f.WriteFile(k.filename, out.bytes(), 0600)
+}
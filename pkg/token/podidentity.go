@@ -0,0 +1,106 @@
+package token
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Environment variables the EKS Pod Identity webhook sets in pods whose
+// service account is associated with an IAM role.
+const (
+	containerCredentialsFullURIEnv     = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	containerAuthorizationTokenEnv     = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+	containerAuthorizationTokenFile    = "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"
+	podIdentityCredentialsExpiryWindow = 5 * time.Minute
+)
+
+// podIdentityAgentHosts are the link-local addresses the EKS Pod Identity
+// agent listens on. The SDK only accepts loopback hosts in
+// AWS_CONTAINER_CREDENTIALS_FULL_URI, so it can't use the agent by itself.
+var podIdentityAgentHosts = map[string]bool{
+	"169.254.170.23": true,
+	"fd00:ec2::23":   true,
+}
+
+// podIdentityURI returns the credentials URI of the EKS Pod Identity agent
+// from the environment, or "" if the environment doesn't point at one.
+func podIdentityURI() string {
+	uri := e.Getenv(containerCredentialsFullURIEnv)
+	if uri == "" {
+		return ""
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip == nil || !podIdentityAgentHosts[ip.String()] {
+		return ""
+	}
+	return uri
+}
+
+// podIdentityProvider retrieves credentials from the EKS Pod Identity agent.
+// The service account token it authenticates with is rotated by the kubelet,
+// so it is read again from AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE on every
+// retrieval.
+type podIdentityProvider struct {
+	*endpointcreds.Provider
+}
+
+func newPodIdentityProvider(cfg aws.Config, handlers request.Handlers, uri string) *podIdentityProvider {
+	provider := endpointcreds.NewProviderClient(cfg, handlers, uri, func(p *endpointcreds.Provider) {
+		p.ExpiryWindow = podIdentityCredentialsExpiryWindow
+	})
+	return &podIdentityProvider{Provider: provider.(*endpointcreds.Provider)}
+}
+
+func (p *podIdentityProvider) Retrieve() (credentials.Value, error) {
+	token := e.Getenv(containerAuthorizationTokenEnv)
+	if filename := e.Getenv(containerAuthorizationTokenFile); filename != "" {
+		data, err := f.ReadFile(filename)
+		if err != nil {
+			return credentials.Value{ProviderName: endpointcreds.ProviderName},
+				fmt.Errorf("could not read pod identity token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	p.AuthorizationToken = token
+	return p.Provider.Retrieve()
+}
+
+// sessionCredentialsProvider lets credentials already resolved by a session
+// be used as the first provider of a chain.
+type sessionCredentialsProvider struct {
+	*credentials.Credentials
+}
+
+func (p sessionCredentialsProvider) Retrieve() (credentials.Value, error) {
+	return p.Get()
+}
+
+// withPodIdentityCredentials falls back to the EKS Pod Identity agent when
+// the session's default credential chain doesn't find any credentials, so
+// pods using Pod Identity can generate tokens without IRSA.
+func withPodIdentityCredentials(sess *session.Session) {
+	uri := podIdentityURI()
+	if uri == "" {
+		return
+	}
+	sess.Config.Credentials = credentials.NewCredentials(&credentials.ChainProvider{
+		VerboseErrors: aws.BoolValue(sess.Config.CredentialsChainVerboseErrors),
+		Providers: []credentials.Provider{
+			sessionCredentialsProvider{sess.Config.Credentials},
+			newPodIdentityProvider(*sess.Config, sess.Handlers, uri),
+		},
+	})
+}
@@ -0,0 +1,82 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestPodIdentityURI(t *testing.T) {
+	_, te, _ := getMocks()
+	for uri, expected := range map[string]bool{
+		"":                                     false,
+		"http://169.254.170.23/v1/credentials": true,
+		"http://[fd00:ec2::23]/v1/credentials": true,
+		"http://127.0.0.1:8080/credentials":    false,
+		"http://169.254.170.2/v2/credentials":  false,
+		"http://pod-identity/v1/credentials":   false,
+		"://169.254.170.23":                    false,
+	} {
+		te.values[containerCredentialsFullURIEnv] = uri
+		if got := podIdentityURI() != ""; got != expected {
+			t.Errorf("%q: expected %t, got %t", uri, expected, got)
+		}
+	}
+}
+
+func TestPodIdentityProvider(t *testing.T) {
+	tf, te, _ := getMocks()
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `{"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","Token":"session","Expiration":%q}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewCredentials(credentials.ErrorProvider{Err: errors.New("no credentials"), ProviderName: "test"}),
+	}))
+	provider := newPodIdentityProvider(*sess.Config, sess.Handlers, server.URL)
+	creds := credentials.NewCredentials(&credentials.ChainProvider{
+		Providers: []credentials.Provider{sessionCredentialsProvider{sess.Config.Credentials}, provider},
+	})
+
+	te.values[containerAuthorizationTokenFile] = "/var/run/secrets/pods.eks.amazonaws.com/serviceaccount/eks-pod-identity-token"
+	tf.data = []byte("service-account-token\n")
+	value, err := creds.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value.AccessKeyID != "ASIAEXAMPLE" || value.SessionToken != "session" {
+		t.Errorf("unexpected credentials %+v", value)
+	}
+	if authorization != "service-account-token" {
+		t.Errorf("expected the token file to be sent, got %q", authorization)
+	}
+	if tf.filename != te.values[containerAuthorizationTokenFile] {
+		t.Errorf("expected the token file to be read, got %q", tf.filename)
+	}
+
+	// the rotated token is read again on the next retrieval
+	tf.data = []byte("rotated-token")
+	if _, err := provider.Retrieve(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if authorization != "rotated-token" {
+		t.Errorf("expected the rotated token to be sent, got %q", authorization)
+	}
+
+	tf.err = errors.New("no such file")
+	if _, err := provider.Retrieve(); err == nil {
+		t.Errorf("expected an error when the token file can't be read")
+	}
+}
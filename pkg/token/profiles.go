@@ -0,0 +1,81 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Profiles returns the sorted names of the AWS profiles defined in the shared
+// config and credentials files (honoring AWS_CONFIG_FILE and
+// AWS_SHARED_CREDENTIALS_FILE) that match pattern, a glob as understood by
+// path.Match.
+func Profiles(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid profile pattern %q: %v", pattern, err)
+	}
+
+	configFile := e.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = defaults.SharedConfigFilename()
+	}
+	credentialsFile := e.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = defaults.SharedCredentialsFilename()
+	}
+
+	found := map[string]bool{}
+	for _, file := range []struct {
+		name string
+		// config files prefix the sections of profiles other than the
+		// default one with "profile "
+		config bool
+	}{{configFile, true}, {credentialsFile, false}} {
+		data, err := f.ReadFile(file.name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", file.name, err)
+		}
+		for _, section := range iniSections(data) {
+			profile := section
+			if file.config && section != session.DefaultSharedConfigProfile {
+				if !strings.HasPrefix(section, "profile ") {
+					// sso-session, services and other non-profile sections
+					continue
+				}
+				profile = strings.TrimSpace(strings.TrimPrefix(section, "profile "))
+			}
+			if matched, _ := path.Match(pattern, profile); matched {
+				found[profile] = true
+			}
+		}
+	}
+
+	profiles := make([]string, 0, len(found))
+	for profile := range found {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// iniSections returns the names of the sections of an INI file.
+func iniSections(data []byte) []string {
+	var sections []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = append(sections, strings.TrimSpace(line[1:len(line)-1]))
+		}
+	}
+	return sections
+}
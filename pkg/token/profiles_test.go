@@ -0,0 +1,72 @@
+package token
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// filesFS is a filesystem serving files from memory.
+type filesFS struct {
+	testFS
+	files map[string]string
+}
+
+func (fs *filesFS) ReadFile(filename string) ([]byte, error) {
+	data, ok := fs.files[filename]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(data), nil
+}
+
+func TestProfiles(t *testing.T) {
+	_, te, _ := getMocks()
+	te.values["AWS_CONFIG_FILE"] = "/aws/config"
+	te.values["AWS_SHARED_CREDENTIALS_FILE"] = "/aws/credentials"
+	f = &filesFS{files: map[string]string{
+		"/aws/config": `[default]
+region = us-west-2
+
+[profile prod-us]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = default
+
+[ profile prod-eu ]
+region = eu-west-1
+
+[sso-session prod]
+sso_region = us-east-1
+`,
+		"/aws/credentials": `[default]
+aws_access_key_id = AKIAEXAMPLE
+
+[prod-ap]
+aws_access_key_id = AKIAEXAMPLE
+`,
+	}}
+
+	for pattern, expected := range map[string][]string{
+		"*":      {"default", "prod-ap", "prod-eu", "prod-us"},
+		"prod-*": {"prod-ap", "prod-eu", "prod-us"},
+		"prod":   {},
+	} {
+		profiles, err := Profiles(pattern)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", pattern, err)
+		}
+		if !reflect.DeepEqual(profiles, expected) {
+			t.Errorf("%q: expected %v, got %v", pattern, expected, profiles)
+		}
+	}
+
+	if _, err := Profiles("prod-["); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+
+	// missing files have no profiles
+	f = &filesFS{}
+	if profiles, err := Profiles("*"); err != nil || len(profiles) != 0 {
+		t.Errorf("expected no profiles, got %v, %v", profiles, err)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sharedcache"
+)
+
+// sharedKeyPrefix starts the keys of identities in the shared cache.
+const sharedKeyPrefix = "aws-iam-authenticator:sts:"
+
+// identityCache caches the identities STS returned for tokens, so clients
+// that resend a token, such as kubelets reusing theirs until it expires, are
+// verified without another GetCallerIdentity call.
+//
+// Entries are keyed by the access key ID and signature scope of the token, so
+// each credential has at most one entry, but only hit for the exact signature
+// STS accepted: the server can't check SigV4 signatures itself, and an access
+// key ID is no proof of holding its secret key.
+//
+// With a shared cache, identities verified by other replicas are used too.
+// Anyone who can write to the shared cache can make the server accept
+// arbitrary identities, so it must be as trusted as the server itself.
+type identityCache struct {
+	ttl time.Duration
+	// shared, if set, is looked up when an identity isn't cached locally.
+	// Its entries are scoped to the partition and cluster ID of the
+	// verifier.
+	shared    sharedcache.Store
+	partition string
+	clusterID string
+
+	mu        sync.Mutex
+	entries   map[string]identityCacheEntry
+	lastSweep time.Time
+}
+
+type identityCacheEntry struct {
+	signature string
+	identity  Identity
+	expires   time.Time
+}
+
+// sharedIdentityEntry is an identityCacheEntry in the shared cache.
+type sharedIdentityEntry struct {
+	Signature string    `json:"signature"`
+	Identity  Identity  `json:"identity"`
+	Expires   time.Time `json:"expires"`
+}
+
+func newIdentityCache(ttl time.Duration, shared sharedcache.Store, partition, clusterID string) *identityCache {
+	return &identityCache{
+		ttl:       ttl,
+		shared:    shared,
+		partition: partition,
+		clusterID: clusterID,
+		entries:   map[string]identityCacheEntry{},
+	}
+}
+
+// sharedKey returns the key of credential in the shared cache. Credentials
+// are hashed as they are read from tokens before they are verified.
+func (c *identityCache) sharedKey(credential string) string {
+	return sharedcache.Key(sharedKeyPrefix, c.partition, c.clusterID, credential)
+}
+
+// get returns the identity cached for credential if it was verified with the
+// same signature and hasn't expired.
+func (c *identityCache) get(credential, signature string, now time.Time) (*Identity, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[credential]
+	c.mu.Unlock()
+	if (!ok || now.After(entry.expires)) && c.shared != nil {
+		entry, ok = c.getShared(credential)
+		if ok && !now.After(entry.expires) &&
+			subtle.ConstantTimeCompare([]byte(entry.signature), []byte(signature)) == 1 {
+			c.mu.Lock()
+			c.entries[credential] = entry
+			c.mu.Unlock()
+		}
+	}
+
+	if !ok || now.After(entry.expires) ||
+		subtle.ConstantTimeCompare([]byte(entry.signature), []byte(signature)) != 1 {
+		metrics.STSCacheLookups.WithLabelValues(metrics.LookupMiss).Inc()
+		return nil, false
+	}
+	metrics.STSCacheLookups.WithLabelValues(metrics.LookupHit).Inc()
+	id := entry.identity
+	return &id, true
+}
+
+// getShared returns the entry of credential in the shared cache.
+func (c *identityCache) getShared(credential string) (identityCacheEntry, bool) {
+	data, ok, err := c.shared.Get(c.sharedKey(credential))
+	if err != nil {
+		metrics.SharedCacheErrors.WithLabelValues(metrics.SharedCacheSTS).Inc()
+		logger.WithError(err).Warn("could not look the token up in the shared cache")
+		return identityCacheEntry{}, false
+	}
+	if !ok {
+		return identityCacheEntry{}, false
+	}
+	var entry sharedIdentityEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		metrics.SharedCacheErrors.WithLabelValues(metrics.SharedCacheSTS).Inc()
+		logger.WithError(err).Warn("could not decode the identity of the shared cache")
+		return identityCacheEntry{}, false
+	}
+	return identityCacheEntry{signature: entry.Signature, identity: entry.Identity, expires: entry.Expires}, true
+}
+
+// put caches id for credential and signature until the cache TTL passes or
+// the token expires, whichever is first. It replaces the entry of a previous
+// token of the same credential.
+func (c *identityCache) put(credential, signature string, id *Identity, tokenExpiration, now time.Time) {
+	expires := now.Add(c.ttl)
+	if tokenExpiration.Before(expires) {
+		expires = tokenExpiration
+	}
+
+	if c.shared != nil {
+		data, err := json.Marshal(sharedIdentityEntry{Signature: signature, Identity: *id, Expires: expires})
+		if err == nil {
+			err = c.shared.Set(c.sharedKey(credential), data, expires.Sub(now))
+		}
+		if err != nil {
+			metrics.SharedCacheErrors.WithLabelValues(metrics.SharedCacheSTS).Inc()
+			logger.WithError(err).Warn("could not store the identity in the shared cache")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[credential] = identityCacheEntry{signature: signature, identity: *id, expires: expires}
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+}
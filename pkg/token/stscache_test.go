@@ -0,0 +1,127 @@
+package token
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySTSCache(t *testing.T) {
+	rt := &clusterIDRoundTripper{clusterID: "cluster", body: jsonResponse("arn:aws:iam::123456789012:user/Alice", "123456789012", "userid")}
+	v := tokenVerifier{
+		client:            &http.Client{Transport: rt},
+		clusterID:         "cluster",
+		validSTShostnames: stsHostsForPartition("aws"),
+		cache:             newIdentityCache(time.Minute, nil, "aws", "cluster"),
+	}
+	for _, c := range []struct {
+		name      string
+		signature string
+		wantCalls int
+	}{
+		{"first token", "signature1", 1},
+		{"same token", "signature1", 1},
+		{"other signature for the credential", "forged", 2},
+		{"new token replaced the entry", "signature1", 3},
+	} {
+		id, err := v.Verify(toToken(validURL + "&x-amz-signature=" + c.signature))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if id.ARN != "arn:aws:iam::123456789012:user/Alice" {
+			t.Errorf("%s: unexpected identity %+v", c.name, id)
+		}
+		if len(rt.seen) != c.wantCalls {
+			t.Errorf("%s: expected %d STS calls, got %d", c.name, c.wantCalls, len(rt.seen))
+		}
+	}
+}
+
+func TestIdentityCacheExpiry(t *testing.T) {
+	c := newIdentityCache(time.Minute, nil, "aws", "cluster")
+	start := time.Now()
+	c.put("AKID/scope", "sig", &Identity{ARN: "arn"}, start.Add(30*time.Second), start)
+
+	if _, ok := c.get("AKID/scope", "sig", start.Add(20*time.Second)); !ok {
+		t.Errorf("expected a hit before the token expires")
+	}
+	if _, ok := c.get("AKID/scope", "sig", start.Add(40*time.Second)); ok {
+		t.Errorf("expected a miss after the token expired")
+	}
+
+	c.put("AKID/other", "sig", &Identity{ARN: "arn"}, start.Add(time.Hour), start.Add(2*time.Minute))
+	if _, ok := c.entries["AKID/scope"]; ok {
+		t.Errorf("expected the expired entry to be swept")
+	}
+	if _, ok := c.get("AKID/other", "sig", start.Add(2*time.Minute+30*time.Second)); !ok {
+		t.Errorf("expected a hit within the TTL")
+	}
+	if _, ok := c.get("AKID/other", "sig", start.Add(4*time.Minute)); ok {
+		t.Errorf("expected a miss after the TTL")
+	}
+}
+
+// memoryStore is a sharedcache.Store in memory whose entries don't expire.
+type memoryStore map[string][]byte
+
+func (s memoryStore) Get(key string) ([]byte, bool, error) {
+	value, ok := s[key]
+	return value, ok, nil
+}
+
+func (s memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s[key] = value
+	return nil
+}
+
+func (s memoryStore) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	if _, ok := s[key]; ok {
+		return false, nil
+	}
+	s[key] = value
+	return true, nil
+}
+
+func (s memoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func TestIdentityCacheShared(t *testing.T) {
+	shared := memoryStore{}
+	replica1 := newIdentityCache(time.Minute, shared, "aws", "cluster")
+	replica2 := newIdentityCache(time.Minute, shared, "aws", "cluster")
+	start := time.Now()
+	replica1.put("AKID/scope", "sig", &Identity{ARN: "arn"}, start.Add(time.Hour), start)
+
+	if id, ok := replica2.get("AKID/scope", "sig", start.Add(time.Second)); !ok || id.ARN != "arn" {
+		t.Errorf("expected a hit from the shared cache, got %+v", id)
+	}
+	if _, ok := replica2.get("AKID/scope", "forged", start.Add(time.Second)); ok {
+		t.Errorf("expected a miss for another signature")
+	}
+	if _, ok := replica2.get("AKID/scope", "sig", start.Add(2*time.Minute)); ok {
+		t.Errorf("expected a miss after the TTL")
+	}
+	for key := range shared {
+		if strings.Contains(key, "AKID") {
+			t.Errorf("expected the credential to be hashed in key %q", key)
+		}
+	}
+}
+
+func TestIdentityCacheSharedScopedToCluster(t *testing.T) {
+	shared := memoryStore{}
+	start := time.Now()
+	newIdentityCache(time.Minute, shared, "aws", "cluster").put("AKID/scope", "sig", &Identity{ARN: "arn"}, start.Add(time.Hour), start)
+
+	if _, ok := newIdentityCache(time.Minute, shared, "aws", "other-cluster").get("AKID/scope", "sig", start); ok {
+		t.Error("expected another cluster to miss the shared entry")
+	}
+	if _, ok := newIdentityCache(time.Minute, shared, "aws-cn", "cluster").get("AKID/scope", "sig", start); ok {
+		t.Error("expected another partition to miss the shared entry")
+	}
+	if _, ok := newIdentityCache(time.Minute, shared, "aws", "cluster").get("AKID/scope", "sig", start); !ok {
+		t.Error("expected the same cluster to hit the shared entry")
+	}
+}
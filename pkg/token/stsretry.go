@@ -0,0 +1,93 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+// Reasons STS calls are retried, used as metric labels.
+const (
+	stsRetryThrottled   = "throttled"
+	stsRetryServerError = "server_error"
+)
+
+// stsRetryReason returns why a GetCallerIdentity response is worth retrying,
+// or "" if it isn't. STS throttles with 400 Throttling, and 429 and 5xx are
+// transient as well.
+func stsRetryReason(statusCode int, body []byte) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests || isThrottling(statusCode, body):
+		return stsRetryThrottled
+	case statusCode >= 500:
+		return stsRetryServerError
+	default:
+		return ""
+	}
+}
+
+func isThrottling(statusCode int, body []byte) bool {
+	return statusCode == http.StatusBadRequest && bytes.Contains(body, []byte("Throttling"))
+}
+
+// stsTimeoutError is the error of STS calls abandoned because ctx is done.
+func stsTimeoutError(ctx context.Context) STSError {
+	return STSError{reason: ReasonSTSTimeout, message: fmt.Sprintf("gave up waiting for STS: %v", ctx.Err())}
+}
+
+// getCallerIdentityWithRetries calls getCallerIdentity, retrying throttled
+// and failed calls up to stsRetries times. The delay before each retry is
+// drawn at random up to stsRetryBackoff, doubled for every retry, and
+// retries that would start after stsRetryDeadline from the first call, or
+// after the deadline of ctx, are not made, so the TokenReview is answered in
+// time.
+func (v tokenVerifier) getCallerIdentityWithRetries(ctx context.Context, presigned *presignedRequest, clusterID, sourceIP string) (int, []byte, error) {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		statusCode, body, err := v.getCallerIdentity(ctx, presigned, clusterID, sourceIP)
+		if err != nil || attempt >= v.stsRetries {
+			return statusCode, body, err
+		}
+		reason := stsRetryReason(statusCode, body)
+		if reason == "" {
+			return statusCode, body, err
+		}
+		backoff := time.Duration(rand.Int63n(int64(v.stsRetryBackoff<<uint(attempt)) + 1))
+		if v.stsRetryDeadline > 0 && time.Since(start)+backoff > v.stsRetryDeadline {
+			return statusCode, body, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			return statusCode, body, err
+		}
+		metrics.STSRetries.WithLabelValues(reason).Inc()
+		logger.WithField("status", statusCode).Debugf("retrying sts:GetCallerIdentity in %v", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, nil, stsTimeoutError(ctx)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package token
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+)
+
+func stsRetryCount(t *testing.T, reason string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.STSRetries.WithLabelValues(reason).Write(&m); err != nil {
+		t.Fatalf("could not read metric: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// flakySTS fails the first len(failures) calls with the given status codes
+// and bodies, then succeeds.
+type flakySTS struct {
+	failures []int
+	body     string
+	calls    int
+}
+
+func (f *flakySTS) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	if f.calls <= len(f.failures) {
+		return &http.Response{StatusCode: f.failures[f.calls-1], Body: ioutil.NopCloser(strings.NewReader(f.body))}, nil
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(jsonResponse("arn:aws:iam::123456789012:user/Alice", "123456789012", "Alice")))}, nil
+}
+
+func TestVerifySTSRetries(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		failures  []int
+		body      string
+		retries   int
+		deadline  time.Duration
+		wantErr   bool
+		wantCalls int
+		reason    string
+	}{
+		{"throttled", []int{400}, "<Code>Throttling</Code>", 2, 0, false, 2, stsRetryThrottled},
+		{"too many requests", []int{429, 429}, "", 2, 0, false, 3, stsRetryThrottled},
+		{"server errors", []int{503, 500}, "", 2, 0, false, 3, stsRetryServerError},
+		{"retries exhausted", []int{503, 503, 503}, "", 2, 0, true, 3, stsRetryServerError},
+		{"no retries", []int{503}, "", 0, 0, true, 1, stsRetryServerError},
+		{"past deadline", []int{503}, "", 2, time.Nanosecond, true, 1, stsRetryServerError},
+		{"not retryable", []int{403}, "<Code>SignatureDoesNotMatch</Code>", 2, 0, true, 1, stsRetryServerError},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			sts := &flakySTS{failures: c.failures, body: c.body}
+			v := NewVerifierWithOptions(VerifierOptions{
+				PartitionID:      "aws",
+				Transport:        sts,
+				STSRetries:       c.retries,
+				STSRetryBackoff:  time.Millisecond,
+				STSRetryDeadline: c.deadline,
+			})
+			before := stsRetryCount(t, c.reason)
+			_, err := v.Verify(validToken)
+			if (err != nil) != c.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if sts.calls != c.wantCalls {
+				t.Errorf("expected %d calls to STS, got %d", c.wantCalls, sts.calls)
+			}
+			if got := stsRetryCount(t, c.reason) - before; got != float64(c.wantCalls-1) {
+				t.Errorf("expected %d retries counted, got %v", c.wantCalls-1, got)
+			}
+		})
+	}
+}
+
+func TestVerifyWithContextTimeout(t *testing.T) {
+	v := NewVerifierWithOptions(VerifierOptions{
+		PartitionID: "aws",
+		// hangs until the request is abandoned
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}),
+	}).(ContextVerifier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := v.VerifyWithContext(ctx, validToken, "")
+	if e, ok := err.(STSError); !ok || e.Reason() != ReasonSTSTimeout {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestVerifySTSRetriesStopAtContextDeadline(t *testing.T) {
+	sts := &flakySTS{failures: []int{503, 503}}
+	v := NewVerifierWithOptions(VerifierOptions{
+		PartitionID:     "aws",
+		Transport:       sts,
+		STSRetries:      2,
+		STSRetryBackoff: time.Hour,
+	}).(ContextVerifier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := v.VerifyWithContext(ctx, validToken, "")
+	if e, ok := err.(STSError); !ok || e.Reason() != ReasonSTSUnreachable {
+		t.Errorf("expected the failed call to be returned, got %v", err)
+	}
+	// the backoff only fits before the deadline once in thousands of runs
+	if elapsed := time.Since(start); sts.calls == 1 && elapsed > 500*time.Millisecond {
+		t.Errorf("expected no wait for a retry that can't start in time, waited %v", elapsed)
+	}
+}
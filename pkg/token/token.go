@@ -17,13 +17,18 @@ limitations under the License.
 package token
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -36,13 +41,17 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
-	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientauthv1alpha1 "k8s.io/client-go/pkg/apis/clientauthentication/v1alpha1"
 	"sigs.k8s.io/aws-iam-authenticator/pkg"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/logging"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/metrics"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/sharedcache"
 )
 
+var logger = logging.For(logging.ComponentVerifier)
+
 // Identity is returned on successful Verify() results. It contains a parsed
 // version of the AWS identity used to create the token.
 type Identity struct {
@@ -73,6 +82,22 @@ type Identity struct {
 	// in conjuction with CloudTrail to determine the identity of the individual
 	// if the individual assumed an IAM role before making the request.
 	AccessKeyID string
+
+	// ClusterID is the cluster ID the token was signed for, the verifier's
+	// cluster ID or one of its additional cluster IDs.
+	ClusterID string
+
+	// SourceIP is the IP address the token is bound to, or "" if it isn't
+	// bound to one.
+	SourceIP string
+
+	// Signature is the SigV4 signature of the token's pre-signed request,
+	// which is unique to the token.
+	Signature string
+
+	// Expiration is when the token stops being accepted, including the
+	// allowed clock skew.
+	Expiration time.Time
 }
 
 const (
@@ -85,12 +110,33 @@ const (
 	presignedURLExpiration = 15 * time.Minute
 	v1Prefix               = "k8s-aws-v1."
 	maxTokenLenBytes       = 1024 * 4
-	clusterIDHeader        = "x-k8s-aws-id"
+	clusterIDHeader        = DefaultClusterIDHeader
+	// sourceIPHeader is signed by tokens bound to the IP address of the
+	// client presenting them to the server.
+	sourceIPHeader = "x-k8s-aws-source-ip"
 	// Format of the X-Amz-Date header used for expiration
 	// https://golang.org/pkg/time/#pkg-constants
 	dateHeaderFormat = "20060102T150405Z"
+	// Cushion between the reported token expiration and the presigned URL
+	// expiration, so clients refresh the token before STS rejects it.
+	// GetTokenOptions.RefreshBefore overrides it.
+	tokenExpirationCushion = 1 * time.Minute
 )
 
+// DefaultAllowedClockSkew is the clock skew tolerated by NewVerifier.
+const DefaultAllowedClockSkew = 5 * time.Minute
+
+// Bounds of GetTokenOptions.Expiration. The upper bound is the validity of a
+// presigned STS URL.
+const (
+	MinTokenExpiration = 1 * time.Minute
+	MaxTokenExpiration = presignedURLExpiration
+)
+
+// MaxRefreshBefore bounds GetTokenOptions.RefreshBefore, so tokens are
+// reported as valid for at least MinTokenExpiration.
+const MaxRefreshBefore = presignedURLExpiration - MinTokenExpiration
+
 // Token is generated and used by Kubernetes client-go to authenticate with a Kubernetes cluster.
 type Token struct {
 	Token      string
@@ -99,18 +145,59 @@ type Token struct {
 
 // GetTokenOptions is passed to GetWithOptions to provide an extensible get token interface
 type GetTokenOptions struct {
-	Region               string
+	// Region, if set, is the region whose regional STS endpoint roles are
+	// assumed with and the token is presigned against.
+	Region string
+	// STSRegionFromProfile presigns the token against the regional STS
+	// endpoint of the region of the AWS profile or environment when Region
+	// isn't set, instead of the global endpoint.
+	STSRegionFromProfile bool
 	ClusterID            string
+	// ClusterIDHeader is the header the cluster ID is signed in,
+	// DefaultClusterIDHeader if empty. Servers must accept it with their
+	// cluster ID headers.
+	ClusterIDHeader      string
 	AssumeRoleARN        string
 	AssumeRoleExternalID string
 	SessionName          string
 	Session              *session.Session
+	// CacheBackend is where the generator caches credentials when caching
+	// is enabled: CacheBackendAuto (the default), CacheBackendFile or
+	// CacheBackendKeyring.
+	CacheBackend string
+	// Profile, if set, is the AWS profile the session is created with
+	// instead of AWS_PROFILE or the default profile. It is ignored when
+	// Session is set.
+	Profile string
+	// RefreshBefore is how long before STS stops accepting the token it is
+	// reported as expiring, so clients refresh it before servers requiring
+	// a minimum remaining validity reject it. Defaults to a minute, and is
+	// at most MaxRefreshBefore.
+	RefreshBefore time.Duration
+	// Expiration is how long the token is reported as valid for in the
+	// ExecCredential, between MinTokenExpiration and MaxTokenExpiration
+	// (the default). STS accepts a token for 15 minutes after it is signed
+	// whatever this is set to, so it controls how often clients refresh it.
+	Expiration time.Duration
+	// STSEndpoint, if set, is the URL of the STS endpoint used to assume
+	// AssumeRoleARN and presign the token, such as a VPC interface endpoint,
+	// instead of the public endpoint. Servers only accept tokens for
+	// endpoints in their STS endpoint hostnames.
+	STSEndpoint string
+	// Format is TokenFormatV1 (the default) or TokenFormatV2. v2 tokens are
+	// smaller but need servers that accept them, and fall back to v1 for
+	// requests they can't represent.
+	Format string
+	// BindSourceIP, if set, binds the token to this IP address: servers
+	// only accept it from a client with this address.
+	BindSourceIP string
 }
 
 // FormatError is returned when there is a problem with token that is
 // an encoded sts request.  This can include the url, data, action or anything
 // else that prevents the sts call from being made.
 type FormatError struct {
+	reason  string
 	message string
 }
 
@@ -118,21 +205,66 @@ func (e FormatError) Error() string {
 	return "input token was not properly formatted: " + e.message
 }
 
+// Reason returns why the token is malformed, one of the Reason constants.
+func (e FormatError) Reason() string {
+	return e.reason
+}
+
 // STSError is returned when there was either an error calling STS or a problem
 // processing the data returned from STS.
 type STSError struct {
 	message string
+	reason  string
 }
 
 func (e STSError) Error() string {
 	return "sts getCallerIdentity failed: " + e.message
 }
 
+// Reason returns why STS didn't verify the token: ReasonSTSUnreachable,
+// ReasonSTSRejected, ReasonClusterIDMismatch, ReasonSTSTimeout, or
+// ReasonSTSError for other failures.
+func (e STSError) Reason() string {
+	if e.reason == "" {
+		return ReasonSTSError
+	}
+	return e.reason
+}
+
 // NewSTSError creates a error of type STS.
 func NewSTSError(m string) STSError {
 	return STSError{message: m}
 }
 
+// Reasons a token can fail verification, used as metric labels.
+const (
+	// ReasonSTSUnreachable, ReasonSTSRejected, ReasonClusterIDMismatch and
+	// ReasonSTSTimeout refine ReasonSTSError, which they are counted as in
+	// metrics.
+	ReasonSTSUnreachable    = "sts_unreachable"
+	ReasonSTSRejected       = "sts_rejected"
+	ReasonClusterIDMismatch = "cluster_id_mismatch"
+	ReasonSTSTimeout        = "sts_timeout"
+
+	ReasonTooLarge          = "too_large"
+	ReasonMissingPrefix     = "missing_prefix"
+	ReasonMalformed         = "malformed"
+	ReasonInvalidHost       = "invalid_host"
+	ReasonInvalidParameters = "invalid_parameters"
+	ReasonMissingClusterID  = "missing_cluster_id"
+	ReasonExpired           = "expired"
+	ReasonClockSkew         = "clock_skew"
+	ReasonSourceIP          = "source_ip"
+	ReasonSTSError          = "sts_error"
+	ReasonInvalidRegion     = "invalid_region"
+	ReasonLongLivedKey      = "long_lived_key"
+)
+
+// temporaryAccessKeyPrefix starts the access key IDs of temporary
+// credentials issued by STS. Long-lived access keys of IAM users and the
+// root user start with AKIA.
+const temporaryAccessKeyPrefix = "ASIA"
+
 var parameterWhitelist = map[string]bool{
 	"action":               true,
 	"version":              true,
@@ -228,6 +360,23 @@ func (g generator) GetWithOptions(options *GetTokenOptions) (Token, error) {
 	if options.ClusterID == "" {
 		return Token{}, fmt.Errorf("ClusterID is required")
 	}
+	if options.Expiration != 0 && (options.Expiration < MinTokenExpiration || options.Expiration > MaxTokenExpiration) {
+		return Token{}, fmt.Errorf("token expiration must be between %s and %s, not %s", MinTokenExpiration, MaxTokenExpiration, options.Expiration)
+	}
+	if options.RefreshBefore < 0 || options.RefreshBefore > MaxRefreshBefore {
+		return Token{}, fmt.Errorf("token refresh before expiry must be between 0s and %s, not %s", MaxRefreshBefore, options.RefreshBefore)
+	}
+	if options.Format != "" && options.Format != TokenFormatV1 && options.Format != TokenFormatV2 {
+		return Token{}, fmt.Errorf("token format must be %s or %s, not %q", TokenFormatV1, TokenFormatV2, options.Format)
+	}
+	switch options.CacheBackend {
+	case "", CacheBackendAuto, CacheBackendFile, CacheBackendKeyring:
+	default:
+		return Token{}, fmt.Errorf("cache backend must be %s, %s or %s, not %q", CacheBackendAuto, CacheBackendFile, CacheBackendKeyring, options.CacheBackend)
+	}
+	if options.BindSourceIP != "" && net.ParseIP(options.BindSourceIP) == nil {
+		return Token{}, fmt.Errorf("source IP %q is not a valid IP address", options.BindSourceIP)
+	}
 
 	if options.Session == nil {
 		// create a session with the "base" credentials available
@@ -235,6 +384,7 @@ func (g generator) GetWithOptions(options *GetTokenOptions) (Token, error) {
 		sess, err := session.NewSessionWithOptions(session.Options{
 			AssumeRoleTokenProvider: StdinStderrTokenProvider,
 			SharedConfigState:       session.SharedConfigEnable,
+			Profile:                 options.Profile,
 		})
 		if err != nil {
 			return Token{}, fmt.Errorf("could not create session: %v", err)
@@ -244,20 +394,28 @@ func (g generator) GetWithOptions(options *GetTokenOptions) (Token, error) {
 			Fn: request.MakeAddToUserAgentHandler(
 				"aws-iam-authenticator", pkg.Version),
 		})
+		withPodIdentityCredentials(sess)
 		if options.Region != "" {
 			sess = sess.Copy(aws.NewConfig().WithRegion(options.Region).WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint))
+		} else if options.STSRegionFromProfile {
+			if aws.StringValue(sess.Config.Region) == "" {
+				return Token{}, fmt.Errorf("no region is configured in the AWS profile or environment")
+			}
+			sess = sess.Copy(aws.NewConfig().WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint))
 		}
 
 		if g.cache {
 			// figure out what profile we're using
 			var profile string
-			if v := os.Getenv("AWS_PROFILE"); len(v) > 0 {
+			if options.Profile != "" {
+				profile = options.Profile
+			} else if v := os.Getenv("AWS_PROFILE"); len(v) > 0 {
 				profile = v
 			} else {
 				profile = session.DefaultSharedConfigProfile
 			}
 			// create a cacheing Provider wrapper around the Credentials
-			if cacheProvider, err := NewFileCacheProvider(options.ClusterID, profile, options.AssumeRoleARN, sess.Config.Credentials); err == nil {
+			if cacheProvider, err := newCacheBackendProvider(options.CacheBackend, options.ClusterID, profile, options.AssumeRoleARN, sess.Config.Credentials); err == nil {
 				sess.Config.Credentials = credentials.NewCredentials(&cacheProvider)
 			} else {
 				_, _ = fmt.Fprintf(os.Stderr, "unable to use cache: %v\n", err)
@@ -267,8 +425,13 @@ func (g generator) GetWithOptions(options *GetTokenOptions) (Token, error) {
 		options.Session = sess
 	}
 
+	stsConfig := aws.NewConfig()
+	if options.STSEndpoint != "" {
+		stsConfig = stsConfig.WithEndpoint(options.STSEndpoint)
+	}
+
 	// use an STS client based on the direct credentials
-	stsAPI := sts.New(options.Session)
+	stsAPI := sts.New(options.Session, stsConfig)
 
 	// if a roleARN was specified, replace the STS client with one that uses
 	// temporary credentials from that role.
@@ -303,20 +466,34 @@ func (g generator) GetWithOptions(options *GetTokenOptions) (Token, error) {
 		}
 
 		// create STS-based credentials that will assume the given role
-		creds := stscreds.NewCredentials(options.Session, options.AssumeRoleARN, sessionSetters...)
+		creds := stscreds.NewCredentialsWithClient(stsAPI, options.AssumeRoleARN, sessionSetters...)
 
 		// create an STS API interface that uses the assumed role's temporary credentials
-		stsAPI = sts.New(options.Session, &aws.Config{Credentials: creds})
+		stsAPI = sts.New(options.Session, stsConfig.Copy().WithCredentials(creds))
 	}
 
-	return g.GetWithSTS(options.ClusterID, stsAPI)
+	return g.getWithSTS(stsAPI, options)
 }
 
 // GetWithSTS returns a token valid for clusterID using the given STS client.
 func (g generator) GetWithSTS(clusterID string, stsAPI stsiface.STSAPI) (Token, error) {
+	return g.getWithSTS(stsAPI, &GetTokenOptions{ClusterID: clusterID})
+}
+
+// getWithSTS returns a token for the cluster ID, expiration, format and
+// source IP of options using the given STS client.
+func (g generator) getWithSTS(stsAPI stsiface.STSAPI, options *GetTokenOptions) (Token, error) {
 	// generate an sts:GetCallerIdentity request and add our custom cluster ID header
 	request, _ := stsAPI.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
-	request.HTTPRequest.Header.Add(clusterIDHeader, clusterID)
+	header := options.ClusterIDHeader
+	if header == "" {
+		header = clusterIDHeader
+	}
+	request.HTTPRequest.Header.Add(header, options.ClusterID)
+	if options.BindSourceIP != "" {
+		// signed as the server will send it, in the canonical form of the IP
+		request.HTTPRequest.Header.Add(sourceIPHeader, net.ParseIP(options.BindSourceIP).String())
+	}
 
 	// Sign the request.  The expires parameter (sets the x-amz-expires header) is
 	// currently ignored by STS, and the token expires 15 minutes after the x-amz-date
@@ -329,8 +506,24 @@ func (g generator) GetWithSTS(clusterID string, stsAPI stsiface.STSAPI) (Token,
 		return Token{}, err
 	}
 
-	// Set token expiration to 1 minute before the presigned URL expires for some cushion
-	tokenExpiration := time.Now().Local().Add(presignedURLExpiration - 1*time.Minute)
+	// Set token expiration to at least RefreshBefore (1 minute by default)
+	// before the presigned URL expires for some cushion
+	cushion := options.RefreshBefore
+	if cushion == 0 {
+		cushion = tokenExpirationCushion
+	}
+	expiration := options.Expiration
+	if expiration == 0 || expiration > presignedURLExpiration-cushion {
+		expiration = presignedURLExpiration - cushion
+	}
+	tokenExpiration := time.Now().Local().Add(expiration)
+	if options.Format == TokenFormatV2 {
+		tok, err := encodeV2(presignedURLString)
+		if err == nil {
+			return Token{tok, tokenExpiration}, nil
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "falling back to a v1 token: %v\n", err)
+	}
 	// TODO: this may need to be a constant-time base64 encoding
 	return Token{v1Prefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURLString)), tokenExpiration}, nil
 }
@@ -357,10 +550,55 @@ type Verifier interface {
 	Verify(token string) (*Identity, error)
 }
 
+// SourceVerifier is implemented by Verifiers that can check tokens bound to
+// the IP address of the client presenting them.
+type SourceVerifier interface {
+	// VerifyFromSource verifies a token presented by a client with the IP
+	// address sourceIP. Tokens that aren't bound to an address are verified
+	// as by Verify.
+	VerifyFromSource(token, sourceIP string) (*Identity, error)
+}
+
+// ContextVerifier is implemented by Verifiers that can bound the STS calls
+// made to verify a token by a context.
+type ContextVerifier interface {
+	// VerifyWithContext verifies a token like VerifyFromSource, giving up
+	// with an STSError of ReasonSTSTimeout once ctx is done.
+	VerifyWithContext(ctx context.Context, token, sourceIP string) (*Identity, error)
+}
+
 type tokenVerifier struct {
-	client            *http.Client
-	clusterID         string
-	validSTShostnames map[string]bool
+	client    *http.Client
+	clusterID string
+	// additionalClusterIDs are also accepted, e.g. while a cluster is renamed.
+	additionalClusterIDs []string
+	validSTShostnames    map[string]bool
+	// partitionID is the partition identities must be in.
+	partitionID string
+	// allowedClockSkew is tolerated between X-Amz-Date and the local clock.
+	allowedClockSkew time.Duration
+	// cache holds the identities of verified tokens, if enabled.
+	cache *identityCache
+	// allowedSTSRegions, if set, are the signing regions accepted.
+	allowedSTSRegions map[string]bool
+	// stsEndpointOverride, if set, is where tokens are sent instead of
+	// their host.
+	stsEndpointOverride string
+	// stsRetries, stsRetryBackoff and stsRetryDeadline bound the retries of
+	// throttled and failed STS calls.
+	stsRetries       int
+	stsRetryBackoff  time.Duration
+	stsRetryDeadline time.Duration
+	// clusterIDHeaders are the lowercase headers the cluster ID may be
+	// signed in, if not only clusterIDHeader.
+	clusterIDHeaders []string
+	// rejectLongLivedKeys only accepts tokens signed with temporary
+	// credentials.
+	rejectLongLivedKeys bool
+	// minRemainingValidity is how long tokens must still be valid for.
+	minRemainingValidity time.Duration
+	// rejectV2Tokens only accepts v1 tokens.
+	rejectV2Tokens bool
 }
 
 func stsHostsForPartition(partitionID string) map[string]bool {
@@ -374,23 +612,23 @@ func stsHostsForPartition(partitionID string) map[string]bool {
 		}
 	}
 	if partition == nil {
-		logrus.Errorf("Partition %s not valid", partitionID)
+		logger.Errorf("Partition %s not valid", partitionID)
 		return validSTShostnames
 	}
 	stsSvc, ok := partition.Services()["sts"]
 	if !ok {
-		logrus.Errorf("STS service not found in partition %s", partitionID)
+		logger.Errorf("STS service not found in partition %s", partitionID)
 		return validSTShostnames
 	}
 	for epName, ep := range stsSvc.Endpoints() {
 		rep, err := ep.ResolveEndpoint(endpoints.STSRegionalEndpointOption)
 		if err != nil {
-			logrus.WithError(err).Errorf("Error resolving endpoint for %s in partition %s", epName, partitionID)
+			logger.WithError(err).Errorf("Error resolving endpoint for %s in partition %s", epName, partitionID)
 			continue
 		}
 		parsedURL, err := url.Parse(rep.URL)
 		if err != nil {
-			logrus.WithError(err).Errorf("Error parsing STS URL %s", rep.URL)
+			logger.WithError(err).Errorf("Error parsing STS URL %s", rep.URL)
 			continue
 		}
 		validSTShostnames[parsedURL.Hostname()] = true
@@ -398,23 +636,149 @@ func stsHostsForPartition(partitionID string) map[string]bool {
 	return validSTShostnames
 }
 
+// VerifierOptions is passed to NewVerifierWithOptions to provide an extensible
+// verifier interface
+type VerifierOptions struct {
+	ClusterID   string
+	PartitionID string
+	// AdditionalClusterIDs are accepted besides ClusterID, for example
+	// during a cluster rename or a blue/green migration. The cluster ID is
+	// covered by the token's signature, so STS is called with each ID in
+	// turn until the signature matches: tokens for ClusterID are verified
+	// with a single call, tokens for the additional IDs take one more call
+	// per ID tried before theirs.
+	AdditionalClusterIDs []string
+	// AllowedClockSkew is tolerated between the X-Amz-Date of a token and
+	// the local clock, in both directions.
+	AllowedClockSkew time.Duration
+	// STSCacheTTL, if non-zero, is how long the identity STS returns for a
+	// token is cached, so a token that is sent again is verified without
+	// calling STS. Entries never outlive the token.
+	STSCacheTTL time.Duration
+	// SharedCache, if set, shares the cache of STSCacheTTL with the other
+	// replicas using the same store.
+	SharedCache sharedcache.Store
+	// Transport, if set, sends the requests to STS, e.g. through a proxy.
+	Transport http.RoundTripper
+	// STSEndpointHostnames are accepted as the host of tokens besides the
+	// public STS endpoints of the partition, such as the hostnames of STS
+	// VPC interface endpoints. Tokens are sent to their host for
+	// verification, so only list STS endpoints.
+	STSEndpointHostnames []string
+	// AllowedSTSRegions, if set, are the only regions accepted as the signing
+	// region of tokens, from the credential scope of their signature. Tokens
+	// presigned against the global STS endpoint are signed for us-east-1.
+	AllowedSTSRegions []string
+	// STSEndpointOverride, if set, is the URL (scheme and host) tokens are
+	// sent to for verification instead of their host, such as a mock STS
+	// in tests or air-gapped demos. The host of tokens is still checked and
+	// sent in the Host header, which the signature covers.
+	STSEndpointOverride string
+	// STSRetries is how many times a throttled (400 Throttling or 429) or
+	// failed (5xx) GetCallerIdentity call is retried. Retries back off
+	// exponentially from STSRetryBackoff (DefaultSTSRetryBackoff if zero)
+	// with full jitter, and none starts later than STSRetryDeadline, if
+	// set, after the first call.
+	STSRetries       int
+	STSRetryBackoff  time.Duration
+	STSRetryDeadline time.Duration
+	// ClusterIDHeaders are the headers tokens may sign the cluster ID in,
+	// for clients of distributions that renamed it. Defaults to
+	// DefaultClusterIDHeader.
+	ClusterIDHeaders []string
+	// RejectLongLivedKeys rejects tokens signed with anything but temporary
+	// STS credentials, such as the long-lived access keys of IAM users,
+	// without calling STS.
+	RejectLongLivedKeys bool
+	// MinRemainingValidity, if positive, rejects tokens that STS accepts
+	// for less than this long, so a request retried by the API server isn't
+	// rejected because the token expired in between.
+	MinRemainingValidity time.Duration
+	// RejectV2Tokens only accepts v1 tokens, for servers with the TokenV2
+	// feature gate disabled.
+	RejectV2Tokens bool
+}
+
+// DefaultClusterIDHeader is the header tokens sign the cluster ID in unless
+// configured otherwise.
+const DefaultClusterIDHeader = "x-k8s-aws-id"
+
+// ValidateClusterIDHeader returns an error unless name can be the header the
+// cluster ID is signed in.
+func ValidateClusterIDHeader(name string) error {
+	lower := strings.ToLower(name)
+	if !clusterIDHeaderPattern.MatchString(lower) || lower == "host" || strings.HasPrefix(lower, "x-amz-") || lower == sourceIPHeader {
+		return fmt.Errorf("invalid cluster ID header %q: expected a header name such as %s", name, DefaultClusterIDHeader)
+	}
+	return nil
+}
+
+var clusterIDHeaderPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// DefaultSTSRetryBackoff is the delay the retries of STS calls back off
+// from by default.
+const DefaultSTSRetryBackoff = 100 * time.Millisecond
+
 // NewVerifier creates a Verifier that is bound to the clusterID and uses the default http client.
 func NewVerifier(clusterID string, partitionID string) Verifier {
-	return tokenVerifier{
+	return NewVerifierWithOptions(VerifierOptions{
+		ClusterID:        clusterID,
+		PartitionID:      partitionID,
+		AllowedClockSkew: DefaultAllowedClockSkew,
+	})
+}
+
+// NewVerifierWithOptions creates a Verifier from opts that uses the default http client.
+func NewVerifierWithOptions(opts VerifierOptions) Verifier {
+	return newTokenVerifier(opts)
+}
+
+func newTokenVerifier(opts VerifierOptions) tokenVerifier {
+	v := tokenVerifier{
 		client: &http.Client{
+			Transport: opts.Transport,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
 		},
-		clusterID:         clusterID,
-		validSTShostnames: stsHostsForPartition(partitionID),
+		clusterID:            opts.ClusterID,
+		additionalClusterIDs: opts.AdditionalClusterIDs,
+		validSTShostnames:    stsHostsForPartition(opts.PartitionID),
+		partitionID:          opts.PartitionID,
+		allowedClockSkew:     opts.AllowedClockSkew,
+		stsEndpointOverride:  opts.STSEndpointOverride,
+		stsRetries:           opts.STSRetries,
+		stsRetryBackoff:      opts.STSRetryBackoff,
+		stsRetryDeadline:     opts.STSRetryDeadline,
+		rejectLongLivedKeys:  opts.RejectLongLivedKeys,
+		minRemainingValidity: opts.MinRemainingValidity,
+		rejectV2Tokens:       opts.RejectV2Tokens,
+	}
+	if v.stsRetryBackoff <= 0 {
+		v.stsRetryBackoff = DefaultSTSRetryBackoff
+	}
+	for _, header := range opts.ClusterIDHeaders {
+		v.clusterIDHeaders = append(v.clusterIDHeaders, strings.ToLower(header))
+	}
+	for _, hostname := range opts.STSEndpointHostnames {
+		v.validSTShostnames[strings.ToLower(hostname)] = true
 	}
+	if len(opts.AllowedSTSRegions) > 0 {
+		v.allowedSTSRegions = map[string]bool{}
+		for _, region := range opts.AllowedSTSRegions {
+			v.allowedSTSRegions[region] = true
+		}
+	}
+	if opts.STSCacheTTL > 0 {
+		v.cache = newIdentityCache(opts.STSCacheTTL, opts.SharedCache, opts.PartitionID, opts.ClusterID)
+	}
+	return v
 }
 
 // verify a sts host, doc: http://docs.amazonaws.cn/en_us/general/latest/gr/rande.html#sts_region
 func (v tokenVerifier) verifyHost(host string) error {
 	if _, ok := v.validSTShostnames[host]; !ok {
-		return FormatError{fmt.Sprintf("unexpected hostname %q in pre-signed URL", host)}
+		return FormatError{reason: ReasonInvalidHost, message: fmt.Sprintf("unexpected hostname %q in pre-signed URL", host)}
 	}
 	return nil
 }
@@ -423,27 +787,170 @@ func (v tokenVerifier) verifyHost(host string) error {
 // Identity that contains information about the AWS principal that created the
 // token. On failure, returns nil and a non-nil error.
 func (v tokenVerifier) Verify(token string) (*Identity, error) {
-	if len(token) > maxTokenLenBytes {
-		return nil, FormatError{"token is too large"}
+	return v.VerifyFromSource(token, "")
+}
+
+// VerifyFromSource verifies a token like Verify, additionally checking tokens
+// bound to a source IP address were presented from sourceIP. Bound tokens are
+// rejected if sourceIP is empty.
+func (v tokenVerifier) VerifyFromSource(token, sourceIP string) (*Identity, error) {
+	return v.VerifyWithContext(context.Background(), token, sourceIP)
+}
+
+// VerifyWithContext verifies a token like VerifyFromSource, calling STS and
+// waiting between retries only until ctx is done.
+func (v tokenVerifier) VerifyWithContext(ctx context.Context, token, sourceIP string) (*Identity, error) {
+	id, err := v.verify(ctx, token, sourceIP)
+	switch e := err.(type) {
+	case FormatError:
+		metrics.TokenVerificationErrors.WithLabelValues(e.reason).Inc()
+	case STSError:
+		metrics.TokenVerificationErrors.WithLabelValues(ReasonSTSError).Inc()
 	}
+	return id, err
+}
 
-	if !strings.HasPrefix(token, v1Prefix) {
-		return nil, FormatError{fmt.Sprintf("token is missing expected %q prefix", v1Prefix)}
+func (v tokenVerifier) verify(ctx context.Context, token, sourceIP string) (*Identity, error) {
+	now := time.Now()
+	presigned, err := v.parse(token, now)
+	if err != nil {
+		return nil, err
+	}
+	queryParamsLower := presigned.params
+	accessKeyID, credential, expiration := presigned.accessKeyID, presigned.credential, presigned.expiration
+
+	// STS checks the address a token is bound to, as the server sends the
+	// source IP in the signed header.
+	boundSourceIP := ""
+	if hasSignedHeader(&queryParamsLower, sourceIPHeader) {
+		ip := net.ParseIP(sourceIP)
+		if ip == nil {
+			return nil, FormatError{reason: ReasonSourceIP, message: "token is bound to a source IP, but the address of the client presenting it is unknown"}
+		}
+		boundSourceIP = ip.String()
+	}
+
+	signature := queryParamsLower.Get("x-amz-signature")
+	// STS only accepted the signature of a bound token with the source IP
+	// it was verified from, so that is cached along with it.
+	cacheSignature := signature
+	if boundSourceIP != "" {
+		cacheSignature = signature + "/" + boundSourceIP
+	}
+	if v.cache != nil {
+		if id, ok := v.cache.get(credential, cacheSignature, now); ok {
+			return id, nil
+		}
+	}
+
+	clusterIDs := append([]string{v.clusterID}, v.additionalClusterIDs...)
+	var responseBody []byte
+	var tokenClusterID string
+	for i, clusterID := range clusterIDs {
+		statusCode, body, err := v.getCallerIdentityWithRetries(ctx, presigned, clusterID, boundSourceIP)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode == http.StatusForbidden && i < len(clusterIDs)-1 {
+			// the token may have been signed for one of the other IDs
+			continue
+		}
+		if statusCode == http.StatusForbidden && boundSourceIP != "" {
+			return nil, STSError{
+				reason:  ReasonSourceIP,
+				message: fmt.Sprintf("error from AWS (expected 200, got %d), the token may be bound to another source IP than %s. Body: %s", statusCode, boundSourceIP, string(body[:])),
+			}
+		}
+		if statusCode != 200 {
+			return nil, STSError{
+				reason:  stsStatusReason(statusCode, body),
+				message: fmt.Sprintf("error from AWS (expected 200, got %d). Body: %s", statusCode, string(body[:])),
+			}
+		}
+		if len(clusterIDs) > 1 {
+			metrics.TokenClusterIDs.WithLabelValues(clusterID).Inc()
+		}
+		responseBody = body
+		tokenClusterID = clusterID
+		break
 	}
 
-	// TODO: this may need to be a constant-time base64 decoding
-	tokenBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, v1Prefix))
+	var callerIdentity getCallerIdentityWrapper
+	err = json.Unmarshal(responseBody, &callerIdentity)
 	if err != nil {
-		return nil, FormatError{err.Error()}
+		return nil, NewSTSError(err.Error())
 	}
 
-	parsedURL, err := url.Parse(string(tokenBytes))
+	// parse the response into an Identity
+	id := &Identity{
+		ARN:         callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Arn,
+		AccountID:   callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Account,
+		AccessKeyID: accessKeyID,
+		ClusterID:   tokenClusterID,
+		SourceIP:    boundSourceIP,
+		Signature:   signature,
+		Expiration:  expiration.Add(v.allowedClockSkew),
+	}
+	id.CanonicalARN, err = arn.CanonicalizeInPartition(id.ARN, v.partitionID)
 	if err != nil {
-		return nil, FormatError{err.Error()}
+		return nil, NewSTSError(err.Error())
+	}
+
+	// The user ID is either UserID:SessionName (for assumed roles) or just
+	// UserID (for IAM User principals).
+	userIDParts := strings.Split(callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.UserID, ":")
+	if len(userIDParts) == 2 {
+		id.UserID = userIDParts[0]
+		id.SessionName = userIDParts[1]
+	} else if len(userIDParts) == 1 {
+		id.UserID = userIDParts[0]
+	} else {
+		return nil, NewSTSError(fmt.Sprintf(
+			"malformed UserID %q",
+			callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.UserID))
+	}
+
+	if v.cache != nil {
+		v.cache.put(credential, cacheSignature, id, id.Expiration, now)
+	}
+	return id, nil
+}
+
+// presignedRequest is a token decoded and checked without calling STS.
+type presignedRequest struct {
+	url *url.URL
+	// params are the query parameters with lowercase keys.
+	params      url.Values
+	accessKeyID string
+	// credential is the access key ID and the signature scope.
+	credential string
+	expiration time.Time
+	// clusterIDHeader is the header the cluster ID is signed in.
+	clusterIDHeader string
+}
+
+// parse decodes token and checks it is a presigned GetCallerIdentity
+// request for an accepted STS host and region that is valid at now, which
+// is all that can be checked without calling STS.
+func (v tokenVerifier) parse(token string, now time.Time) (*presignedRequest, error) {
+	if len(token) > maxTokenLenBytes {
+		return nil, FormatError{reason: ReasonTooLarge, message: "token is too large"}
+	}
+	if v.rejectV2Tokens && strings.HasPrefix(token, v2Prefix) {
+		return nil, FormatError{reason: ReasonMissingPrefix, message: fmt.Sprintf("token is missing expected %q prefix, v2 tokens are disabled", v1Prefix)}
+	}
+	presignedURL, err := decodePresignedURL(token)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedURL, err := url.Parse(presignedURL)
+	if err != nil {
+		return nil, FormatError{reason: ReasonMalformed, message: err.Error()}
 	}
 
 	if parsedURL.Scheme != "https" {
-		return nil, FormatError{fmt.Sprintf("unexpected scheme %q in pre-signed URL", parsedURL.Scheme)}
+		return nil, FormatError{reason: ReasonInvalidHost, message: fmt.Sprintf("unexpected scheme %q in pre-signed URL", parsedURL.Scheme)}
 	}
 
 	if err = v.verifyHost(parsedURL.Host); err != nil {
@@ -451,120 +958,196 @@ func (v tokenVerifier) Verify(token string) (*Identity, error) {
 	}
 
 	if parsedURL.Path != "/" {
-		return nil, FormatError{"unexpected path in pre-signed URL"}
+		return nil, FormatError{reason: ReasonInvalidParameters, message: "unexpected path in pre-signed URL"}
 	}
 
 	queryParamsLower := make(url.Values)
 	queryParams, err := url.ParseQuery(parsedURL.RawQuery)
 	if err != nil {
-		return nil, FormatError{"malformed query parameter"}
+		return nil, FormatError{reason: ReasonMalformed, message: "malformed query parameter"}
 	}
 
 	for key, values := range queryParams {
 		if !parameterWhitelist[strings.ToLower(key)] {
-			return nil, FormatError{fmt.Sprintf("non-whitelisted query parameter %q", key)}
+			return nil, FormatError{reason: ReasonInvalidParameters, message: fmt.Sprintf("non-whitelisted query parameter %q", key)}
 		}
 		if len(values) != 1 {
-			return nil, FormatError{"query parameter with multiple values not supported"}
+			return nil, FormatError{reason: ReasonInvalidParameters, message: "query parameter with multiple values not supported"}
 		}
 		queryParamsLower.Set(strings.ToLower(key), values[0])
 	}
 
 	if queryParamsLower.Get("action") != "GetCallerIdentity" {
-		return nil, FormatError{"unexpected action parameter in pre-signed URL"}
+		return nil, FormatError{reason: ReasonInvalidParameters, message: "unexpected action parameter in pre-signed URL"}
 	}
 
-	if !hasSignedClusterIDHeader(&queryParamsLower) {
-		return nil, FormatError{fmt.Sprintf("client did not sign the %s header in the pre-signed URL", clusterIDHeader)}
+	signedClusterIDHeader := v.signedClusterIDHeader(&queryParamsLower)
+	if signedClusterIDHeader == "" {
+		return nil, FormatError{reason: ReasonMissingClusterID, message: fmt.Sprintf("client did not sign the %s header in the pre-signed URL", strings.Join(v.clusterIDHeaderNames(), " or "))}
 	}
 
 	// We validate x-amz-expires is between 0 and 15 minutes (900 seconds) although currently pre-signed STS URLs, and
 	// therefore tokens, expire exactly 15 minutes after the x-amz-date header, regardless of x-amz-expires.
 	expires, err := strconv.Atoi(queryParamsLower.Get("x-amz-expires"))
 	if err != nil || expires < 0 || expires > 900 {
-		return nil, FormatError{fmt.Sprintf("invalid X-Amz-Expires parameter in pre-signed URL: %d", expires)}
+		return nil, FormatError{reason: ReasonInvalidParameters, message: fmt.Sprintf("invalid X-Amz-Expires parameter in pre-signed URL: %d", expires)}
 	}
 
 	date := queryParamsLower.Get("x-amz-date")
 	if date == "" {
-		return nil, FormatError{"X-Amz-Date parameter must be present in pre-signed URL"}
+		return nil, FormatError{reason: ReasonInvalidParameters, message: "X-Amz-Date parameter must be present in pre-signed URL"}
 	}
 
 	// Obtain AWS Access Key ID from supplied credentials
 	accessKeyID := strings.Split(queryParamsLower.Get("x-amz-credential"), "/")[0]
+	if v.rejectLongLivedKeys && !strings.HasPrefix(accessKeyID, temporaryAccessKeyPrefix) {
+		return nil, FormatError{reason: ReasonLongLivedKey, message: "token was not signed with temporary credentials"}
+	}
 
 	dateParam, err := time.Parse(dateHeaderFormat, date)
 	if err != nil {
-		return nil, FormatError{fmt.Sprintf("error parsing X-Amz-Date parameter %s into format %s: %s", date, dateHeaderFormat, err.Error())}
+		return nil, FormatError{reason: ReasonInvalidParameters, message: fmt.Sprintf("error parsing X-Amz-Date parameter %s into format %s: %s", date, dateHeaderFormat, err.Error())}
 	}
 
-	now := time.Now()
 	expiration := dateParam.Add(presignedURLExpiration)
-	if now.After(expiration) {
-		return nil, FormatError{fmt.Sprintf("X-Amz-Date parameter is expired (%.f minute expiration) %s", presignedURLExpiration.Minutes(), dateParam)}
+	if now.After(expiration.Add(v.allowedClockSkew)) {
+		return nil, FormatError{reason: ReasonExpired, message: fmt.Sprintf("X-Amz-Date parameter is expired (%.f minute expiration) %s", presignedURLExpiration.Minutes(), dateParam)}
+	}
+	if v.minRemainingValidity > 0 && expiration.Add(v.allowedClockSkew).Sub(now) < v.minRemainingValidity {
+		return nil, FormatError{reason: ReasonExpired, message: fmt.Sprintf("token expires in less than the minimum remaining validity of %s", v.minRemainingValidity)}
+	}
+	if dateParam.After(now.Add(v.allowedClockSkew)) {
+		// a token from the future can only come from a client whose clock is ahead
+		return nil, FormatError{reason: ReasonClockSkew, message: fmt.Sprintf("X-Amz-Date parameter %s is more than %s ahead of the server clock", dateParam, v.allowedClockSkew)}
 	}
 
-	req, err := http.NewRequest("GET", parsedURL.String(), nil)
-	req.Header.Set(clusterIDHeader, v.clusterID)
+	// the credential is the access key ID and the signature scope
+	credential := queryParamsLower.Get("x-amz-credential")
+	if v.allowedSTSRegions != nil {
+		// <access key ID>/<date>/<region>/sts/aws4_request
+		scope := strings.Split(credential, "/")
+		if len(scope) != 5 || !v.allowedSTSRegions[scope[2]] {
+			return nil, FormatError{reason: ReasonInvalidRegion, message: "token was not signed for an allowed STS region"}
+		}
+	}
+	return &presignedRequest{
+		url:             parsedURL,
+		params:          queryParamsLower,
+		accessKeyID:     accessKeyID,
+		credential:      credential,
+		expiration:      expiration,
+		clusterIDHeader: signedClusterIDHeader,
+	}, nil
+}
+
+// decodePresignedURL returns the presigned URL a v1 or v2 token encodes.
+func decodePresignedURL(token string) (string, error) {
+	switch {
+	case strings.HasPrefix(token, v1Prefix):
+		// TODO: this may need to be a constant-time base64 decoding
+		tokenBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, v1Prefix))
+		if err != nil {
+			return "", FormatError{reason: ReasonMalformed, message: err.Error()}
+		}
+		return string(tokenBytes), nil
+	case strings.HasPrefix(token, v2Prefix):
+		presignedURL, err := decodeV2(strings.TrimPrefix(token, v2Prefix))
+		if err != nil {
+			return "", FormatError{reason: ReasonMalformed, message: fmt.Sprintf("invalid v2 token: %v", err)}
+		}
+		return presignedURL, nil
+	default:
+		return "", FormatError{reason: ReasonMissingPrefix, message: fmt.Sprintf("token is missing expected %q or %q prefix", v1Prefix, v2Prefix)}
+	}
+}
+
+// getCallerIdentity sends the pre-signed request to STS with clusterID as
+// the signed cluster ID header, and sourceIP as the signed source IP header if
+// set, and returns the response status and body.
+func (v tokenVerifier) getCallerIdentity(ctx context.Context, presigned *presignedRequest, clusterID, sourceIP string) (int, []byte, error) {
+	parsedURL := presigned.url
+	req, err := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
+	if err != nil {
+		return 0, nil, NewSTSError(fmt.Sprintf("error creating request: %v", err))
+	}
+	if v.stsEndpointOverride != "" {
+		override, err := url.Parse(v.stsEndpointOverride)
+		if err != nil {
+			return 0, nil, NewSTSError(fmt.Sprintf("invalid STS endpoint override: %v", err))
+		}
+		req.URL.Scheme, req.URL.Host = override.Scheme, override.Host
+		req.Host = parsedURL.Host
+	}
+	req.Header.Set(presigned.clusterIDHeader, clusterID)
+	if sourceIP != "" {
+		req.Header.Set(sourceIPHeader, sourceIP)
+	}
 	req.Header.Set("accept", "application/json")
 
+	stsStart := time.Now()
 	response, err := v.client.Do(req)
 	if err != nil {
+		metrics.STSLatency.WithLabelValues("error").Observe(time.Since(stsStart).Seconds())
+		if ctx.Err() != nil {
+			return 0, nil, stsTimeoutError(ctx)
+		}
 		// special case to avoid printing the full URL if possible
 		if urlErr, ok := err.(*url.Error); ok {
-			return nil, NewSTSError(fmt.Sprintf("error during GET: %v", urlErr.Err))
+			if _, ok := urlErr.Err.(x509.UnknownAuthorityError); ok {
+				return 0, nil, STSError{reason: ReasonSTSUnreachable, message: fmt.Sprintf("error during GET: %v (if STS is reached through a TLS-intercepting proxy, trust its CA with --sts-ca-bundle)", urlErr.Err)}
+			}
+			return 0, nil, STSError{reason: ReasonSTSUnreachable, message: fmt.Sprintf("error during GET: %v", urlErr.Err)}
 		}
-		return nil, NewSTSError(fmt.Sprintf("error during GET: %v", err))
+		return 0, nil, STSError{reason: ReasonSTSUnreachable, message: fmt.Sprintf("error during GET: %v", err)}
 	}
 	defer response.Body.Close()
+	metrics.STSLatency.WithLabelValues(strconv.Itoa(response.StatusCode)).Observe(time.Since(stsStart).Seconds())
 
 	responseBody, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return nil, NewSTSError(fmt.Sprintf("error reading HTTP result: %v", err))
+	if err != nil && ctx.Err() != nil {
+		return 0, nil, stsTimeoutError(ctx)
+	} else if err != nil {
+		return 0, nil, STSError{reason: ReasonSTSUnreachable, message: fmt.Sprintf("error reading HTTP result: %v", err)}
 	}
+	return response.StatusCode, responseBody, nil
+}
 
-	if response.StatusCode != 200 {
-		return nil, NewSTSError(fmt.Sprintf("error from AWS (expected 200, got %d). Body: %s", response.StatusCode, string(responseBody[:])))
-	}
-
-	var callerIdentity getCallerIdentityWrapper
-	err = json.Unmarshal(responseBody, &callerIdentity)
-	if err != nil {
-		return nil, NewSTSError(err.Error())
+// stsStatusReason classifies an error response of STS. The server sends
+// its own cluster ID in the signed cluster ID header, so a signature mismatch
+// means the token was signed for another cluster (or tampered with).
+func stsStatusReason(statusCode int, body []byte) string {
+	switch {
+	case statusCode >= 500 || statusCode == http.StatusTooManyRequests || isThrottling(statusCode, body):
+		return ReasonSTSUnreachable
+	case statusCode == http.StatusForbidden && bytes.Contains(body, []byte("SignatureDoesNotMatch")):
+		return ReasonClusterIDMismatch
+	default:
+		return ReasonSTSRejected
 	}
+}
 
-	// parse the response into an Identity
-	id := &Identity{
-		ARN:         callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Arn,
-		AccountID:   callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Account,
-		AccessKeyID: accessKeyID,
-	}
-	id.CanonicalARN, err = arn.Canonicalize(id.ARN)
-	if err != nil {
-		return nil, NewSTSError(err.Error())
+func (v tokenVerifier) clusterIDHeaderNames() []string {
+	if len(v.clusterIDHeaders) == 0 {
+		return []string{clusterIDHeader}
 	}
+	return v.clusterIDHeaders
+}
 
-	// The user ID is either UserID:SessionName (for assumed roles) or just
-	// UserID (for IAM User principals).
-	userIDParts := strings.Split(callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.UserID, ":")
-	if len(userIDParts) == 2 {
-		id.UserID = userIDParts[0]
-		id.SessionName = userIDParts[1]
-	} else if len(userIDParts) == 1 {
-		id.UserID = userIDParts[0]
-	} else {
-		return nil, STSError{fmt.Sprintf(
-			"malformed UserID %q",
-			callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.UserID)}
+// signedClusterIDHeader returns the first of the cluster ID headers that is
+// signed, or "" if none is.
+func (v tokenVerifier) signedClusterIDHeader(paramsLower *url.Values) string {
+	for _, header := range v.clusterIDHeaderNames() {
+		if hasSignedHeader(paramsLower, header) {
+			return header
+		}
 	}
-
-	return id, nil
+	return ""
 }
 
-func hasSignedClusterIDHeader(paramsLower *url.Values) bool {
+func hasSignedHeader(paramsLower *url.Values, header string) bool {
 	signedHeaders := strings.Split(paramsLower.Get("x-amz-signedheaders"), ";")
 	for _, hdr := range signedHeaders {
-		if strings.ToLower(hdr) == strings.ToLower(clusterIDHeader) {
+		if strings.ToLower(hdr) == strings.ToLower(header) {
 			return true
 		}
 	}
@@ -0,0 +1,218 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// v2 tokens carry the components of the presigned GetCallerIdentity URL in
+// a CBOR map rather than the URL itself. Constant parameters are left out,
+// and the signature and session token are stored as raw bytes instead of
+// hex, base64 and percent-encoding, which makes tokens of temporary
+// credentials about a third smaller than v1 tokens.
+const v2Prefix = "k8s-aws-v2."
+
+// Token formats generated by GetWithOptions.
+const (
+	TokenFormatV1 = "v1"
+	TokenFormatV2 = "v2"
+)
+
+// Keys of the CBOR map of a v2 token.
+const (
+	v2KeyHost = 1 + iota
+	v2KeyAccessKeyID
+	v2KeyRegion
+	v2KeyDate
+	v2KeyExpires
+	v2KeySignedHeaders
+	v2KeySignature
+	v2KeySecurityToken
+)
+
+// Parameters of presigned GetCallerIdentity URLs that v2 tokens leave out.
+const (
+	v2Action    = "GetCallerIdentity"
+	v2Version   = "2011-06-15"
+	v2Algorithm = "AWS4-HMAC-SHA256"
+	v2Service   = "sts"
+	v2Terminal  = "aws4_request"
+)
+
+// encodeV2 encodes a presigned GetCallerIdentity URL as a v2 token. It fails
+// if the URL has parameters a v2 token can't reproduce exactly.
+func encodeV2(presignedURL string) (string, error) {
+	u, err := url.Parse(presignedURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Path != "/" || u.User != nil || u.Fragment != "" {
+		return "", fmt.Errorf("unexpected presigned URL %s://%s%s", u.Scheme, u.Host, u.Path)
+	}
+
+	params := map[string]string{}
+	for key, values := range u.Query() {
+		if len(values) != 1 {
+			return "", fmt.Errorf("multiple values for parameter %s", key)
+		}
+		params[key] = values[0]
+	}
+	for key, want := range map[string]string{"Action": v2Action, "Version": v2Version, "X-Amz-Algorithm": v2Algorithm} {
+		if params[key] != want {
+			return "", fmt.Errorf("unexpected %s %q", key, params[key])
+		}
+		delete(params, key)
+	}
+	take := func(key string) string {
+		v := params[key]
+		delete(params, key)
+		return v
+	}
+
+	date := take("X-Amz-Date")
+	signedAt, err := time.Parse(dateHeaderFormat, date)
+	if err != nil || signedAt.Unix() < 0 || signedAt.UTC().Format(dateHeaderFormat) != date {
+		return "", fmt.Errorf("unexpected X-Amz-Date %q", date)
+	}
+
+	credential := strings.Split(take("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[1] != date[:8] || credential[3] != v2Service || credential[4] != v2Terminal {
+		return "", fmt.Errorf("unexpected X-Amz-Credential scope %q", strings.Join(credential[1:], "/"))
+	}
+
+	expiresParam := take("X-Amz-Expires")
+	expires, err := strconv.ParseUint(expiresParam, 10, 32)
+	if err != nil || strconv.FormatUint(expires, 10) != expiresParam {
+		return "", fmt.Errorf("unexpected X-Amz-Expires %q", expiresParam)
+	}
+
+	signatureParam := take("X-Amz-Signature")
+	signature, err := hex.DecodeString(signatureParam)
+	if err != nil || hex.EncodeToString(signature) != signatureParam {
+		return "", errors.New("X-Amz-Signature is not lowercase hex")
+	}
+
+	m := map[uint64]interface{}{
+		v2KeyHost:          u.Host,
+		v2KeyAccessKeyID:   credential[0],
+		v2KeyRegion:        credential[2],
+		v2KeyDate:          uint64(signedAt.Unix()),
+		v2KeyExpires:       expires,
+		v2KeySignedHeaders: take("X-Amz-SignedHeaders"),
+		v2KeySignature:     signature,
+	}
+	if _, ok := params["X-Amz-Security-Token"]; ok {
+		securityTokenParam := take("X-Amz-Security-Token")
+		securityToken, err := base64.StdEncoding.DecodeString(securityTokenParam)
+		if err != nil || base64.StdEncoding.EncodeToString(securityToken) != securityTokenParam {
+			return "", errors.New("X-Amz-Security-Token is not standard base64")
+		}
+		m[v2KeySecurityToken] = securityToken
+	}
+	for key := range params {
+		return "", fmt.Errorf("unexpected parameter %s", key)
+	}
+
+	data, err := encodeCBORMap(m)
+	if err != nil {
+		return "", err
+	}
+	return v2Prefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeV2 returns the presigned URL of the encoded v2 token, without its
+// prefix.
+func decodeV2(encoded string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	m, err := decodeCBORMap(data)
+	if err != nil {
+		return "", err
+	}
+
+	text := func(key uint64, name string) (string, error) {
+		v, ok := m[key].(string)
+		if !ok || v == "" {
+			return "", fmt.Errorf("missing or invalid %s", name)
+		}
+		return v, nil
+	}
+	host, err := text(v2KeyHost, "host")
+	if err != nil {
+		return "", err
+	}
+	accessKeyID, err := text(v2KeyAccessKeyID, "access key ID")
+	if err != nil {
+		return "", err
+	}
+	region, err := text(v2KeyRegion, "region")
+	if err != nil {
+		return "", err
+	}
+	signedHeaders, err := text(v2KeySignedHeaders, "signed headers")
+	if err != nil {
+		return "", err
+	}
+	date, ok := m[v2KeyDate].(uint64)
+	// X-Amz-Date only has room for four digit years
+	if !ok || date >= uint64(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()) {
+		return "", errors.New("missing or invalid date")
+	}
+	expires, ok := m[v2KeyExpires].(uint64)
+	if !ok {
+		return "", errors.New("missing or invalid expiry")
+	}
+	signature, ok := m[v2KeySignature].([]byte)
+	if !ok {
+		return "", errors.New("missing or invalid signature")
+	}
+	for key := range m {
+		if key < v2KeyHost || key > v2KeySecurityToken {
+			return "", fmt.Errorf("unknown key %d", key)
+		}
+	}
+
+	signedAt := time.Unix(int64(date), 0).UTC().Format(dateHeaderFormat)
+	query := url.Values{}
+	query.Set("Action", v2Action)
+	query.Set("Version", v2Version)
+	query.Set("X-Amz-Algorithm", v2Algorithm)
+	query.Set("X-Amz-Credential", strings.Join([]string{accessKeyID, signedAt[:8], region, v2Service, v2Terminal}, "/"))
+	query.Set("X-Amz-Date", signedAt)
+	query.Set("X-Amz-Expires", strconv.FormatUint(expires, 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	query.Set("X-Amz-Signature", hex.EncodeToString(signature))
+	if v, ok := m[v2KeySecurityToken]; ok {
+		securityToken, ok := v.([]byte)
+		if !ok {
+			return "", errors.New("invalid security token")
+		}
+		query.Set("X-Amz-Security-Token", base64.StdEncoding.EncodeToString(securityToken))
+	}
+	u := url.URL{Scheme: "https", Host: host, Path: "/", RawQuery: query.Encode()}
+	return u.String(), nil
+}
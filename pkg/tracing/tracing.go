@@ -0,0 +1,222 @@
+/*
+Copyright 2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records OpenTelemetry compatible spans for the
+// authentication path and exports them to an OTLP/HTTP collector.
+//
+// Incoming W3C "traceparent" headers (as sent by the kube-apiserver when its
+// own tracing is enabled) are honored so authentication spans join the
+// apiserver trace.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName = "aws-iam-authenticator"
+
+	traceparentHeader = "traceparent"
+)
+
+// SpanKind mirrors the OTLP span kinds used by the authenticator.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Options configures a Tracer.
+type Options struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, e.g.
+	// "http://localhost:4318". Spans are posted to Endpoint + "/v1/traces".
+	Endpoint string
+	// SampleRatio is the fraction of new traces that are recorded. Traces
+	// started by a sampled parent are always recorded.
+	SampleRatio float64
+}
+
+// Tracer creates spans. A nil *Tracer is valid and records nothing.
+type Tracer struct {
+	sampleRatio float64
+	exporter    *exporter
+}
+
+// New creates a Tracer exporting to opts.Endpoint. It returns nil if no
+// endpoint is configured, meaning tracing is disabled.
+func New(opts Options) *Tracer {
+	if opts.Endpoint == "" {
+		return nil
+	}
+	return &Tracer{
+		sampleRatio: opts.SampleRatio,
+		exporter:    newExporter(opts.Endpoint),
+	}
+}
+
+// StartExport sends finished spans to the collector. It blocks and is
+// meant to run in its own goroutine.
+func (t *Tracer) StartExport() {
+	if t == nil {
+		return
+	}
+	t.exporter.run()
+}
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type contextKey struct{}
+
+func fromContext(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(spanContext)
+	return sc, ok
+}
+
+// Extract returns a context carrying the remote parent described by the
+// traceparent header, if present and valid.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	// version-traceid-spanid-flags
+	parts := strings.Split(strings.TrimSpace(header.Get(traceparentHeader)), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+	sc.sampled = flags[0]&0x01 == 0x01
+	if sc.traceID == [16]byte{} || sc.spanID == [8]byte{} {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// Start begins a span named name as a child of the span in ctx, if any. The
+// returned span is nil when the trace is not sampled; all Span methods are
+// safe to call on nil.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent, hasParent := fromContext(ctx)
+	sc := spanContext{}
+	if hasParent {
+		sc.traceID = parent.traceID
+		sc.sampled = parent.sampled
+	} else {
+		rand.Read(sc.traceID[:])
+		sc.sampled = sample(t.sampleRatio)
+	}
+	rand.Read(sc.spanID[:])
+	ctx = context.WithValue(ctx, contextKey{}, sc)
+	if !sc.sampled {
+		return ctx, nil
+	}
+
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		context:    sc,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+	if hasParent {
+		s.parentID = parent.spanID
+	}
+	return ctx, s
+}
+
+func sample(ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	const precision = 1 << 20
+	n, err := rand.Int(rand.Reader, big.NewInt(precision))
+	if err != nil {
+		return false
+	}
+	return float64(n.Int64()) < ratio*precision
+}
+
+// Span is a single timed operation.
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       SpanKind
+	context    spanContext
+	parentID   [8]byte
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// SetAttribute records a string attribute on the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.tracer.exporter.enqueue(s)
+}
+
+// TraceID returns the hex encoded trace ID of the span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.context.traceID[:])
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	cases := []struct {
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-zzf067aa0ba902b7-01", false, false},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		header.Set("traceparent", c.traceparent)
+		sc, ok := fromContext(Extract(context.Background(), header))
+		if ok != c.valid {
+			t.Errorf("traceparent %q: expected valid=%t, got %t", c.traceparent, c.valid, ok)
+			continue
+		}
+		if ok && sc.sampled != c.sampled {
+			t.Errorf("traceparent %q: expected sampled=%t, got %t", c.traceparent, c.sampled, sc.sampled)
+		}
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "test", SpanKindInternal)
+	if span != nil || ctx == nil {
+		t.Fatalf("expected a nil span from a nil tracer")
+	}
+	span.SetAttribute("key", "value")
+	span.RecordError(errors.New("error"))
+	span.End()
+	if New(Options{}) != nil {
+		t.Errorf("expected tracing to be disabled without an endpoint")
+	}
+}
+
+func TestStartUnsampledParent(t *testing.T) {
+	tracer := New(Options{Endpoint: "http://localhost:4318", SampleRatio: 1})
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(Extract(context.Background(), header), "test", SpanKindServer)
+	if span != nil {
+		t.Errorf("expected no span for an unsampled parent")
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("could not decode export request: %v", err)
+		}
+	}))
+	defer collector.Close()
+
+	tracer := New(Options{Endpoint: collector.URL, SampleRatio: 1})
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := tracer.Start(Extract(context.Background(), header), "authenticate", SpanKindServer)
+	_, child := tracer.Start(ctx, "mapper.Map", SpanKindInternal)
+	child.SetAttribute("mapper.backend", "MountedFile")
+	child.RecordError(errors.New("lookup failed"))
+	child.End()
+	parent.End()
+
+	spans := []*Span{<-tracer.exporter.queue, <-tracer.exporter.queue}
+	if err := tracer.exporter.export(spans); err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected export request %+v", got)
+	}
+	exported := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(exported) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exported))
+	}
+	c, p := exported[0], exported[1]
+	if p.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || c.TraceID != p.TraceID {
+		t.Errorf("expected spans to join the remote trace, got %q and %q", p.TraceID, c.TraceID)
+	}
+	if p.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected remote parent span ID, got %q", p.ParentSpanID)
+	}
+	if c.ParentSpanID != p.SpanID {
+		t.Errorf("expected child of %q, got parent %q", p.SpanID, c.ParentSpanID)
+	}
+	if c.Status.Code != statusCodeError || c.Status.Message != "lookup failed" {
+		t.Errorf("unexpected child status %+v", c.Status)
+	}
+	if len(c.Attributes) != 1 || c.Attributes[0].Value.StringValue != "MountedFile" {
+		t.Errorf("unexpected child attributes %+v", c.Attributes)
+	}
+}